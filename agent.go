@@ -2,10 +2,13 @@ package blades
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"html/template"
+	"log/slog"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/go-kratos/blades/tools"
 	"github.com/go-kratos/kit/container/maps"
@@ -40,6 +43,16 @@ func WithInstruction(instruction string) AgentOption {
 	}
 }
 
+// WithInstructionsVersion sets the version of the instructions of the Agent,
+// which is recorded on its answers under InstructionVersionKey and in the
+// audit transcript. It defaults to a hash of the static instruction and its
+// partials.
+func WithInstructionsVersion(id string) AgentOption {
+	return func(a *agent) {
+		a.instructionVersion = id
+	}
+}
+
 // WithInstructionProvider sets a dynamic instruction provider for the Agent.
 func WithInstructionProvider(p InstructionProvider) AgentOption {
 	return func(a *agent) {
@@ -65,13 +78,25 @@ func WithOutputSchema(schema *jsonschema.Schema) AgentOption {
 func WithOutputKey(key string) AgentOption {
 	return func(a *agent) {
 		a.outputKey = key
+		a.outputJSON = false
+	}
+}
+
+// WithOutputKeyJSON is like WithOutputKey, but parses the output with
+// ParseStructured, so that templates and flow conditions can read its fields,
+// e.g. {{.review.score}}. Objects are stored as map[string]any. Output that
+// holds no JSON value is stored as text with a warning.
+func WithOutputKeyJSON(key string) AgentOption {
+	return func(a *agent) {
+		a.outputKey = key
+		a.outputJSON = true
 	}
 }
 
 // WithTools sets the tools for the Agent.
 func WithTools(tools ...tools.Tool) AgentOption {
 	return func(a *agent) {
-		a.tools = tools
+		a.tools = slices.Clone(tools)
 	}
 }
 
@@ -84,10 +109,23 @@ func WithToolsResolver(r tools.Resolver) AgentOption {
 	}
 }
 
+// ToolResultInterceptor observes or rewrites a tool result before it is added
+// to the conversation, e.g. to truncate large outputs or redact secrets.
+// An error fails the tool call like an error returned by the tool.
+type ToolResultInterceptor func(ctx context.Context, call ToolPart, result string) (string, error)
+
+// WithToolResultInterceptor adds interceptors applied, in order, to the results
+// of all tools, including those provided by the tools resolver.
+func WithToolResultInterceptor(interceptors ...ToolResultInterceptor) AgentOption {
+	return func(a *agent) {
+		a.resultInterceptors = append(a.resultInterceptors, interceptors...)
+	}
+}
+
 // WithMiddleware sets the middleware for the Agent.
 func WithMiddleware(ms ...Middleware) AgentOption {
 	return func(a *agent) {
-		a.middlewares = ms
+		a.middlewares = slices.Clone(ms)
 	}
 }
 
@@ -99,37 +137,152 @@ func WithMaxIterations(n int) AgentOption {
 	}
 }
 
+// WithModelOptions sets the model options applied to every request of the Agent.
+func WithModelOptions(opts ...ModelOption) AgentOption {
+	return func(a *agent) {
+		a.modelOptions = append(a.modelOptions, opts...)
+	}
+}
+
+// WithContextOverflowPolicy sets how the Agent handles requests that exceed
+// the model's context window, as reported by LookupModelCapabilities.
+// By default, requests are sent as-is.
+func WithContextOverflowPolicy(policy ContextOverflowPolicy) AgentOption {
+	return func(a *agent) {
+		a.overflowPolicy = policy
+	}
+}
+
+// WithTokenCounter sets the token counter used to enforce the context window.
+// By default, HeuristicTokenCounter is used.
+func WithTokenCounter(counter TokenCounter) AgentOption {
+	return func(a *agent) {
+		a.tokenCounter = counter
+	}
+}
+
+// WithSummarizer sets the summarizer used by ContextOverflowSummarize.
+// By default, the Agent's own model summarizes the dropped history.
+func WithSummarizer(summarizer Summarizer) AgentOption {
+	return func(a *agent) {
+		a.summarizer = summarizer
+	}
+}
+
+// WithLogger sets the logger of the warnings of the Agent, e.g. about an
+// output that is not JSON. Defaults to slog.Default().
+func WithLogger(logger *slog.Logger) AgentOption {
+	return func(a *agent) {
+		a.logger = logger
+	}
+}
+
 // agent is a struct that represents an AI agent.
 type agent struct {
-	name                string
-	description         string
-	instruction         string
-	instructionProvider InstructionProvider
-	outputKey           string
-	maxIterations       int
-	model               ModelProvider
-	inputSchema         *jsonschema.Schema
-	outputSchema        *jsonschema.Schema
-	middlewares         []Middleware
-	tools               []tools.Tool
-	toolsResolver       tools.Resolver // Optional resolver for dynamic tools (e.g., MCP servers)
+	name                 string
+	description          string
+	instruction          string
+	instructionProvider  InstructionProvider
+	instructionSource    InstructionSource
+	instructionWatch     <-chan struct{}
+	instructionPending   atomic.Int64 // watch signals not reloaded yet
+	instructionMu        sync.Mutex   // serializes instruction reloads
+	instructions         atomic.Pointer[instructionSnapshot]
+	instructionVersion   string
+	templateFuncs        TemplateFuncs
+	templatePartials     map[string]string
+	templateStrict       bool
+	templateSandbox      *TemplateSandbox
+	instructionFragments map[string]string
+	modelInstructions    map[string]string
+	instructionVariants  []instructionVariant
+	examples             []Example
+	exampleFormatter     ExampleFormatter
+	examplesBudget       int64
+	outputKey            string
+	outputJSON           bool
+	maxIterations        int
+	maxContinuations     int
+	candidateSelector    CandidateSelector
+	outputValidators     []OutputValidator
+	outputAttempts       int
+	language             string
+	outputFormat         OutputFormat
+	confidence           ConfidenceMode
+	model                ModelProvider
+	modelOptions         []ModelOption
+	inputSchema          *jsonschema.Schema
+	outputSchema         *jsonschema.Schema
+	middlewares          []Middleware
+	tools                []tools.Tool
+	toolsResolver        tools.Resolver // Optional resolver for dynamic tools (e.g., MCP servers)
+	resultInterceptors   []ToolResultInterceptor
+	overflowPolicy       ContextOverflowPolicy
+	tokenCounter         TokenCounter
+	summarizer           Summarizer
+	redactors            Redactors
+	promptLogger         *slog.Logger
+	logger               *slog.Logger
+	strict               bool
+	configWarnings       ConfigWarningHandler
+	warned               sync.Map // problems reported by warnConfig
 }
 
 // NewAgent creates a new Agent with the given name and options.
+// The Agent copies the slices passed to its options and does not change after
+// construction, except for its instruction when it has an InstructionSource,
+// so it is safe for concurrent use.
 func NewAgent(name string, opts ...AgentOption) (Agent, error) {
 	a := &agent{
-		name:          name,
-		maxIterations: 10,
+		name:           name,
+		maxIterations:  10,
+		outputAttempts: 3,
+		tokenCounter:   HeuristicTokenCounter,
 	}
 	for _, opt := range opts {
 		opt(a)
 	}
-	if a.model == nil {
-		return nil, ErrModelProviderRequired
+	if err := a.build(); err != nil {
+		return nil, err
 	}
 	return a, nil
 }
 
+// build checks the configuration of the agent and compiles its instruction.
+func (a *agent) build() error {
+	if a.model == nil {
+		return ErrModelProviderRequired
+	}
+	if a.strict {
+		if err := a.checkConfig(); err != nil {
+			return err
+		}
+	}
+	if err := a.checkTools(); err != nil {
+		return err
+	}
+	if err := a.checkOutputFormat(); err != nil {
+		return err
+	}
+	if err := a.checkConfidence(); err != nil {
+		return err
+	}
+	a.addInstructionFragments()
+	switch {
+	case a.instructionSource != nil:
+		if _, err := a.loadInstruction(context.Background()); err != nil {
+			return err
+		}
+	case a.instruction != "":
+		snapshot, err := a.compileInstruction(a.instruction, a.instructionVersion)
+		if err != nil {
+			return err
+		}
+		a.instructions.Store(snapshot)
+	}
+	return a.compileInstructionVariants()
+}
+
 // Name returns the name of the Agent.
 func (a *agent) Name() string {
 	return a.name
@@ -140,6 +293,39 @@ func (a *agent) Description() string {
 	return a.description
 }
 
+// RequiredStateKeys returns the session state keys the instruction, or any of its variants by model, reads
+// without an {{if}} or {{with}} guard.
+func (a *agent) RequiredStateKeys() []string {
+	if snapshot := a.instructions.Load(); snapshot != nil {
+		return slices.Clone(snapshot.stateKeys)
+	}
+	var keys []string
+	for _, variant := range a.instructionVariants {
+		for _, key := range variant.snapshot.stateKeys {
+			if !slices.Contains(keys, key) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+// InstructionVersion returns the current version of the instructions of the agent, if any.
+func (a *agent) InstructionVersion() string {
+	if snapshot := a.instructions.Load(); snapshot != nil {
+		return snapshot.version
+	}
+	if n := len(a.instructionVariants); n > 0 {
+		return a.instructionVariants[n-1].snapshot.version
+	}
+	return a.instructionVersion
+}
+
+// OutputKey returns the session state key the agent stores its output under, if any.
+func (a *agent) OutputKey() string {
+	return a.outputKey
+}
+
 // resolveTools combines static tools with dynamically resolved tools.
 func (a *agent) resolveTools(ctx context.Context) ([]tools.Tool, error) {
 	tools := make([]tools.Tool, 0, len(a.tools))
@@ -156,43 +342,95 @@ func (a *agent) resolveTools(ctx context.Context) ([]tools.Tool, error) {
 	return tools, nil
 }
 
-// prepareInvocation prepares the invocation by resolving tools and applying instructions.
-func (a *agent) prepareInvocation(ctx context.Context, invocation *Invocation) error {
+// prepareInvocation prepares the invocation by resolving tools and applying
+// instructions, and returns the instruction the invocation runs with.
+func (a *agent) prepareInvocation(ctx context.Context, invocation *Invocation) (*instructionSnapshot, error) {
 	resolvedTools, err := a.resolveTools(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	invocation.Model = a.model.Name()
+	invocation.Model = ResolveModel(ctx, a.model.Name())
 	invocation.Tools = append(invocation.Tools, resolvedTools...)
+	if a.strict && a.outputKey != "" && len(PathFromContext(ctx)) == 1 {
+		a.warnConfig(ctx, CheckOutputKey, "run the agent in a flow or remove WithOutputKey",
+			"the output key %q is set, but the agent runs outside of a flow", a.outputKey)
+	}
 	// order of precedence: static instruction > instruction provider > invocation instruction
 	if a.instructionProvider != nil {
 		instruction, err := a.instructionProvider(ctx)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		invocation.Instruction = MergeParts(SystemMessage(instruction), invocation.Instruction)
 	}
-	if a.instruction != "" {
-		if invocation.Session != nil {
-			var buf strings.Builder
-			t, err := template.New("instruction").Parse(a.instruction)
-			if err != nil {
-				return err
-			}
-			if err := t.Execute(&buf, invocation.Session.State()); err != nil {
-				return err
+	snapshot, err := a.currentInstruction(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot != nil && snapshot.template != nil {
+		instruction, err := a.renderSnapshot(ctx, snapshot, invocation)
+		if err != nil {
+			return nil, err
+		}
+		invocation.Instruction = MergeParts(SystemMessage(instruction), invocation.Instruction)
+	}
+	// The language directive comes last so that it does not replace the instruction.
+	language := a.language
+	if language == "" && invocation.Session != nil {
+		tag, ok := SessionLanguage(invocation.Session)
+		if value, set := invocation.Session.State()[LanguageStateKey]; set && !ok {
+			// The state may come from elsewhere, e.g. an imported session, so a
+			// bad value must not fail every run of the session.
+			a.log().WarnContext(ctx, "agent: ignoring invalid session language", "agent", a.name, "language", value)
+		}
+		language = tag
+	}
+	if language != "" {
+		if err := AppendLanguageDirective(invocation, language); err != nil {
+			return nil, fmt.Errorf("agent %s: %w", a.name, err)
+		}
+	}
+	return snapshot, nil
+}
+
+// renderSnapshot renders the instruction with the session state of the invocation.
+func (a *agent) renderSnapshot(ctx context.Context, snapshot *instructionSnapshot, invocation *Invocation) (string, error) {
+	state := State{}
+	if invocation.Session != nil {
+		state = invocation.Session.State()
+	}
+	for _, key := range snapshot.stateKeys {
+		if _, ok := state[key]; ok {
+			continue
+		}
+		if a.templateStrict {
+			return "", fmt.Errorf("agent %s: render instruction: %w: %q", a.name, ErrMissingStateKey, key)
+		}
+		if a.strict {
+			a.warnConfig(ctx, CheckTemplateKeys, "set the key before the agent runs or guard it with {{with}}",
+				"the instruction reads the state key %q, which is not set", key)
+		}
+	}
+	if a.templateStrict {
+		// Missing optional keys are set to nil so that their guards render,
+		// while a missing nested key still fails the template.
+		for _, key := range snapshot.readKeys {
+			if _, ok := state[key]; !ok {
+				state[key] = nil
 			}
-			invocation.Instruction = MergeParts(SystemMessage(buf.String()), invocation.Instruction)
-		} else {
-			invocation.Instruction = MergeParts(SystemMessage(a.instruction), invocation.Instruction)
 		}
 	}
-	return nil
+	instruction, err := a.renderInstruction(snapshot.template, state)
+	if err != nil {
+		return "", fmt.Errorf("agent %s: render instruction: %w", a.name, err)
+	}
+	return instruction, nil
 }
 
 // Run runs the agent with the given prompt and options, returning a streamable response.
 func (a *agent) Run(ctx context.Context, invocation *Invocation) Generator[*Message, error] {
-	return func(yield func(*Message, error) bool) {
+	ctx = NewPathContext(ctx, a.name)
+	return PathErrors(ctx, func(yield func(*Message, error) bool) {
 		// If resumable and a completed message exists, return it directly.
 		resumeMessages, ok := a.findResumeMessages(invocation)
 		if ok {
@@ -203,39 +441,132 @@ func (a *agent) Run(ctx context.Context, invocation *Invocation) Generator[*Mess
 			}
 			return
 		}
-		if err := a.prepareInvocation(ctx, invocation); err != nil {
-			yield(nil, err)
+		snapshot, err := a.prepareInvocation(ctx, invocation)
+		if err != nil {
+			a.failInvocation(invocation, yield, ErrorClassInternal, err, "")
 			return
 		}
-		ctx = NewAgentContext(ctx, a)
+		ctx = NewInvocationContext(NewAgentContext(ctx, a), invocation)
+		ctx = NewRedactorsContext(ctx, a.redactors...)
+		ctx = newSensitiveContext(ctx, invocation.Tools)
+		if snapshot != nil {
+			// The invocation keeps its instruction even if it is reloaded meanwhile.
+			ctx = context.WithValue(ctx, ctxInstructionKey{agent: a}, snapshot)
+		}
 		handler := Handler(HandleFunc(func(ctx context.Context, invocation *Invocation) Generator[*Message, error] {
+			if invocation.ModelProvider != nil {
+				invocation.Model = ResolveModel(ctx, invocation.ModelProvider.Name())
+				ctx = context.WithValue(ctx, ctxProviderKey{agent: a}, invocation.ModelProvider)
+			}
+			instruction := invocation.Instruction
+			if len(a.instructionVariants) > 0 {
+				// The variant follows the effective model, e.g. a fallback set by a middleware.
+				variant := a.instructionVariant(invocation.Model)
+				if variant.snapshot.template != nil {
+					text, err := a.renderSnapshot(ctx, variant.snapshot, invocation)
+					if err != nil {
+						return func(yield func(*Message, error) bool) { yield(nil, err) }
+					}
+					instruction = MergeParts(SystemMessage(text), instruction)
+				}
+				ctx = context.WithValue(ctx, ctxInstructionKey{agent: a}, variant.snapshot)
+				ctx = context.WithValue(ctx, ctxInstructionVariantKey{agent: a}, variant.key)
+			}
 			req := &ModelRequest{
 				Tools:        invocation.Tools,
-				Instruction:  invocation.Instruction,
+				Instruction:  instruction,
 				InputSchema:  a.inputSchema,
 				OutputSchema: a.outputSchema,
 			}
+			req.Options.Apply(a.modelOptions...)
+			if opts, ok := FromModelOptionsContext(ctx); ok {
+				req.Options.Apply(opts...)
+			}
+			if a.confidence == ConfidenceLogprobs {
+				req.Options.Logprobs = true
+			}
 			if len(invocation.History) > 0 {
 				req.Messages = AppendMessages(req.Messages, invocation.History...)
 			}
-			switch {
-			case len(resumeMessages) > 0:
-				req.Messages = AppendMessages(req.Messages, resumeMessages...)
-			case invocation.Message != nil:
+			if invocation.Message != nil {
 				req.Messages = AppendMessages(req.Messages, invocation.Message)
 			}
+			if len(resumeMessages) > 0 {
+				req.Messages = AppendMessages(req.Messages, resumeMessages...)
+			}
+			a.addExamples(ctx, invocation.Model, req)
+			req.Instruction, req.Messages = mergeSystemMessages(req.Instruction, req.Messages)
 			return a.handle(ctx, invocation, req)
 		}))
 		if len(a.middlewares) > 0 {
 			handler = ChainMiddlewares(a.middlewares...)(handler)
 		}
-		stream := handler.Handle(ctx, invocation)
+		// A panic in a middleware or the model loop fails the invocation.
+		stream := recoverHandler(a.name, handler).Handle(ctx, invocation)
+		failed := false
 		for m, err := range stream {
+			// Errors raised outside the model loop, e.g. by middlewares, still end with a failed message.
+			if err != nil && !failed {
+				a.failInvocation(invocation, yield, ErrorClassInternal, err, "")
+				return
+			}
+			if m != nil && m.Status == StatusFailed {
+				failed = true
+			}
 			if !yield(m, err) {
 				break
 			}
 		}
+	})
+}
+
+// ctxProviderKey is the context key for the model an invocation of the agent
+// runs with when a middleware set Invocation.ModelProvider.
+type ctxProviderKey struct {
+	agent *agent
+}
+
+// provider returns the model the invocation in ctx runs with.
+func (a *agent) provider(ctx context.Context) ModelProvider {
+	if model, ok := ctx.Value(ctxProviderKey{agent: a}).(ModelProvider); ok {
+		return model
+	}
+	return a.model
+}
+
+// mergeSystemMessages merges the system messages of the input into the
+// instruction, so that the request carries a single system prompt: the
+// instruction followed by the input system messages it does not already
+// contain. Developer messages are kept in place.
+func mergeSystemMessages(instruction *Message, messages []*Message) (*Message, []*Message) {
+	var (
+		merged = instruction
+		seen   = make(map[string]bool)
+		kept   = make([]*Message, 0, len(messages))
+	)
+	if instruction != nil {
+		seen[instruction.Text()] = true
+	}
+	for _, m := range messages {
+		if m.Role != RoleSystem {
+			kept = append(kept, m)
+			continue
+		}
+		text := m.Text()
+		if seen[text] {
+			continue
+		}
+		seen[text] = true
+		// The instruction may be shared, so it is copied before it is extended.
+		if merged == instruction {
+			merged = SystemMessage[string]()
+			if instruction != nil {
+				merged = instruction.Clone()
+			}
+		}
+		merged.Parts = append(merged.Parts, m.Parts...)
 	}
+	return merged, kept
 }
 
 func (a *agent) findResumeMessages(invocation *Invocation) ([]*Message, bool) {
@@ -243,8 +574,20 @@ func (a *agent) findResumeMessages(invocation *Invocation) ([]*Message, bool) {
 		return nil, false
 	}
 	var resumeMessages []*Message
+	// question is the StatusNeedsInput message the invocation paused on.
+	var question *Message
 	for _, m := range invocation.Session.History() {
-		if m.InvocationID == invocation.ID && m.Author == a.name {
+		if m.InvocationID != invocation.ID {
+			continue
+		}
+		switch {
+		case question != nil && m.Role == RoleUser:
+			resumeMessages = answerClarification(resumeMessages, question, m)
+			question = nil
+		case m.Author != a.name || m.Status == StatusCancelled:
+		case m.Status == StatusNeedsInput:
+			question = m
+		default:
 			resumeMessages = append(resumeMessages, m)
 			// If we find a completed assistant message, we can resume from here.
 			if m.Role == RoleAssistant && m.Status == StatusCompleted {
@@ -252,6 +595,10 @@ func (a *agent) findResumeMessages(invocation *Invocation) ([]*Message, bool) {
 			}
 		}
 	}
+	// An unanswered question is asked again.
+	if question != nil {
+		return []*Message{question}, true
+	}
 	return resumeMessages, false
 }
 
@@ -266,32 +613,74 @@ func (a *agent) appendMessageToSession(ctx context.Context, invocation *Invocati
 		message.Author = "user"
 		return invocation.Session.Append(ctx, message)
 	case RoleTool:
+		// Tool calls are recorded together with their results by appendToolMessage.
 		message.Author = a.name
-		if message.Status != StatusCompleted {
-			return nil
-		}
-		return invocation.Session.Append(ctx, message)
+		return nil
 	case RoleAssistant:
 		message.Author = a.name
 		if message.Status != StatusCompleted {
 			return nil
 		}
-		if a.outputKey != "" {
-			invocation.Session.SetState(a.outputKey, message.Text())
+		stampVersion(ctx, a.invocationVersion(ctx), message)
+		a.stampInstructionVariant(ctx, message)
+		if a.outputKey != "" && !rejected(message) {
+			invocation.Session.PutState(ctx, a.outputKey, a.outputValue(ctx, message))
+			if message.Metadata == nil {
+				message.Metadata = make(map[string]any)
+			}
+			message.Metadata[OutputStateKey] = a.outputKey
 		}
 		return invocation.Session.Append(ctx, message)
 	}
 	return nil
 }
 
+// appendToolMessage appends the executed tool calls to the session, so that
+// later turns replay each call with its ID, request and result.
+func (a *agent) appendToolMessage(ctx context.Context, invocation *Invocation, message *Message) error {
+	if invocation.Session == nil {
+		return nil
+	}
+	message.InvocationID = invocation.ID
+	message.Author = a.name
+	return invocation.Session.Append(ctx, message)
+}
+
+// outputValue returns the value stored under the output key.
+func (a *agent) outputValue(ctx context.Context, message *Message) any {
+	text := message.Text()
+	if !a.outputJSON {
+		return text
+	}
+	value, err := ParseStructured[any](text)
+	if err != nil {
+		a.log().WarnContext(ctx, "agent: output is not JSON, storing text", "agent", a.name, "outputKey", a.outputKey, "error", err)
+		return text
+	}
+	return value
+}
+
+// log returns the logger of the warnings of the agent.
+func (a *agent) log() *slog.Logger {
+	if a.logger != nil {
+		return a.logger
+	}
+	return slog.Default()
+}
+
 func (a *agent) handleTools(ctx context.Context, invocation *Invocation, part ToolPart) (ToolPart, error) {
 	// Search through all available tools (static + resolved)
 	for _, tool := range invocation.Tools {
 		if tool.Name() == part.Name {
-			response, err := tool.Handle(ctx, part.Request)
+			response, err := handleTool(ctx, tool, part.Request)
 			if err != nil {
 				return part, err
 			}
+			for _, intercept := range a.resultInterceptors {
+				if response, err = intercept(ctx, part, response); err != nil {
+					return part, fmt.Errorf("agent: tool %s result: %w", part.Name, err)
+				}
+			}
 			part.Response = response
 			return part, nil
 		}
@@ -299,25 +688,39 @@ func (a *agent) handleTools(ctx context.Context, invocation *Invocation, part To
 	return part, fmt.Errorf("agent: tool %s not found", part.Name)
 }
 
-// executeTools executes the tools specified in the tool parts.
+// executeTools executes the tools specified in the tool parts. Each tool call
+// writes the session state through its own overlay; the overlays are
+// committed in call order once every call succeeded, and discarded otherwise.
 func (a *agent) executeTools(ctx context.Context, invocation *Invocation, message *Message) (*Message, error) {
 	var (
-		m sync.Mutex
+		m        sync.Mutex
+		overlays = make([]*StateOverlay, len(message.Parts))
+		// questions are the questions the calls pause the invocation on.
+		questions = make([]*NeedsInputError, len(message.Parts))
 	)
 	actions := maps.New(message.Actions)
-	eg, ctx := errgroup.WithContext(ctx)
+	eg, egCtx := errgroup.WithContext(ctx)
 	for i, part := range message.Parts {
 		switch v := any(part).(type) {
 		case ToolPart:
 			eg.Go(func() error {
-				toolCtx := NewToolContext(ctx, &toolContext{
+				toolCtx := NewToolContext(egCtx, &toolContext{
 					id:      v.ID,
 					name:    v.Name,
 					actions: actions,
 				})
+				toolCtx = NewPathContext(toolCtx, v.Name)
+				if invocation.Session != nil {
+					overlays[i] = NewStateOverlay(invocation.Session)
+					toolCtx = NewSessionContext(toolCtx, overlays[i])
+				}
 				part, err := a.handleTools(toolCtx, invocation, v)
+				if errors.As(err, &questions[i]) {
+					// The call is answered by the user once the invocation resumes.
+					return nil
+				}
 				if err != nil {
-					return err
+					return WrapPathError(toolCtx, err)
 				}
 				m.Lock()
 				message.Parts[i] = part
@@ -327,7 +730,40 @@ func (a *agent) executeTools(ctx context.Context, invocation *Invocation, messag
 			})
 		}
 	}
-	return message, eg.Wait()
+	if err := eg.Wait(); err != nil {
+		return message, err
+	}
+	for _, overlay := range overlays {
+		if overlay != nil {
+			overlay.Commit(ctx)
+		}
+	}
+	for i, question := range questions {
+		if question != nil {
+			return message, &toolQuestion{callID: message.Parts[i].(ToolPart).ID, NeedsInputError: question}
+		}
+	}
+	return message, nil
+}
+
+// toolQuestion is the question a tool call paused the invocation on.
+type toolQuestion struct {
+	*NeedsInputError
+	callID string
+}
+
+// cancelInvocation records in the session that the invocation was cancelled
+// by the user and returns the StatusCancelled message that ends the stream.
+func (a *agent) cancelInvocation(ctx context.Context, invocation *Invocation) (*Message, error) {
+	message := NewAssistantMessage(StatusCancelled)
+	message.Author = a.name
+	if invocation.Session != nil {
+		message.InvocationID = invocation.ID
+		if err := invocation.Session.Append(context.WithoutCancel(ctx), message); err != nil {
+			return nil, err
+		}
+	}
+	return message, nil
 }
 
 // handle constructs the default handlers for Run and Stream using the provider.
@@ -336,52 +772,136 @@ func (a *agent) handle(ctx context.Context, invocation *Invocation, req *ModelRe
 		var (
 			err           error
 			finalResponse *ModelResponse
+			// violations collects the violations of the rejected answers.
+			violations []error
+			attempts   int
+			rejections []error
 		)
+		if err := a.adaptRequest(ctx, req); err != nil {
+			a.failInvocation(invocation, yield, ErrorClassModel, err, "")
+			return
+		}
 		for i := 0; i < a.maxIterations; i++ {
+			// Stop between iterations once the invocation is cancelled.
+			if invocationCancelled(ctx) {
+				yield(a.cancelInvocation(ctx, invocation))
+				return
+			}
+			if err := CheckLimits(ctx, a.name, invocation); err != nil {
+				a.failInvocation(invocation, yield, ErrorClassLimit, err, "")
+				return
+			}
+			if err := a.fitContext(ctx, req); err != nil {
+				a.failInvocation(invocation, yield, ErrorClassInternal, err, "")
+				return
+			}
+			a.logPrompt(ctx, invocation, req)
+			if isDryRun(ctx) {
+				message, err := a.dryRun(ctx, invocation, req)
+				if err != nil {
+					a.failInvocation(invocation, yield, ErrorClassInternal, err, "")
+					return
+				}
+				yield(message, nil)
+				return
+			}
 			if !invocation.Streamable {
-				finalResponse, err = a.model.Generate(ctx, req)
+				finalResponse, err = a.generate(ctx, req)
 				if err != nil {
-					yield(nil, err)
+					if invocationCancelled(ctx) {
+						yield(a.cancelInvocation(ctx, invocation))
+						return
+					}
+					a.failInvocation(invocation, yield, ErrorClassModel, limitCause(ctx, err), "")
 					return
 				}
+				rejections = a.validateOutput(ctx, finalResponse.Message)
+				if len(rejections) == 0 {
+					a.assessConfidence(ctx, req, finalResponse.Message)
+				}
 				if err := a.appendMessageToSession(ctx, invocation, finalResponse.Message); err != nil {
-					yield(nil, err)
+					a.failInvocation(invocation, yield, ErrorClassInternal, err, "")
 					return
 				}
 				if finalResponse.Message.Role == RoleAssistant {
-					if !yield(finalResponse.Message, nil) {
+					if !yield(a.formatOutput(finalResponse.Message, rejections), nil) {
 						return
 					}
 				}
 			} else {
-				streaming := a.model.NewStreaming(ctx, req)
+				// partial collects the streamed text so far, kept in the failed message on error.
+				var partial strings.Builder
+				streaming := a.stream(ctx, req)
 				for finalResponse, err = range streaming {
 					if err != nil {
-						yield(nil, err)
+						if invocationCancelled(ctx) {
+							yield(a.cancelInvocation(ctx, invocation))
+							return
+						}
+						a.failInvocation(invocation, yield, ErrorClassModel, limitCause(ctx, err), partial.String())
 						return
 					}
+					if finalResponse.Message.Status != StatusIncomplete {
+						a.estimateUsage(ctx, req, finalResponse.Message)
+					}
+					// Only the final message of the stream is validated.
+					rejections = a.validateOutput(ctx, finalResponse.Message)
+					if len(rejections) == 0 {
+						a.assessConfidence(ctx, req, finalResponse.Message)
+					}
 					if err := a.appendMessageToSession(ctx, invocation, finalResponse.Message); err != nil {
-						yield(nil, err)
+						a.failInvocation(invocation, yield, ErrorClassInternal, err, partial.String())
 						return
 					}
+					if finalResponse.Message.Role == RoleAssistant && finalResponse.Message.Status == StatusIncomplete {
+						partial.WriteString(finalResponse.Message.Text())
+					}
 					if finalResponse.Message.Role == RoleTool && finalResponse.Message.Status == StatusCompleted {
 						// Skip yielding tool messages during streaming.
 						// Tool messages with StatusCompleted indicate that a tool call has been made,
 						continue
 					}
-					if !yield(finalResponse.Message, nil) {
+					if !yield(a.formatOutput(finalResponse.Message, rejections), nil) {
 						return // early termination
 					}
 				}
 			}
 			if finalResponse == nil {
-				yield(nil, ErrNoFinalResponse)
+				a.failInvocation(invocation, yield, ErrorClassModel, ErrNoFinalResponse, "")
+				return
+			}
+			recordModelCall(ctx, invocation.Model, finalResponse.Message)
+			if err := spendTokens(ctx, a.name, finalResponse.Message.TokenUsage); err != nil {
+				a.failInvocation(invocation, yield, ErrorClassLimit, err, "")
 				return
 			}
 			if finalResponse.Message.Role == RoleTool {
+				if err := spendToolCalls(ctx, a.name, finalResponse.Message); err != nil {
+					a.failInvocation(invocation, yield, ErrorClassLimit, err, "")
+					return
+				}
 				toolMessage, err := a.executeTools(ctx, invocation, finalResponse.Message)
+				if question, ok := err.(*toolQuestion); ok {
+					paused, err := a.pauseInvocation(ctx, invocation, toolMessage, question.callID, question.Question)
+					if err != nil {
+						a.failInvocation(invocation, yield, ErrorClassInternal, err, "")
+						return
+					}
+					if yield(toolMessage, nil) {
+						yield(paused, nil)
+					}
+					return
+				}
 				if err != nil {
-					yield(nil, err)
+					if invocationCancelled(ctx) {
+						yield(a.cancelInvocation(ctx, invocation))
+						return
+					}
+					a.failInvocation(invocation, yield, ErrorClassTool, limitCause(ctx, err), "")
+					return
+				}
+				if err := a.appendToolMessage(ctx, invocation, toolMessage); err != nil {
+					a.failInvocation(invocation, yield, ErrorClassInternal, err, "")
 					return
 				}
 				if !yield(toolMessage, nil) {
@@ -391,9 +911,30 @@ func (a *agent) handle(ctx context.Context, invocation *Invocation, req *ModelRe
 				req.Messages = append(req.Messages, toolMessage)
 				continue // continue to the next iteration
 			}
+			if len(rejections) > 0 {
+				attempts++
+				for _, v := range rejections {
+					violations = append(violations, fmt.Errorf("attempt %d: %w", attempts, v))
+				}
+				if attempts >= a.outputAttempts {
+					err := &OutputValidationError{Agent: a.name, Attempts: attempts, Violations: violations}
+					a.failInvocation(invocation, yield, ErrorClassValidation, err, "")
+					return
+				}
+				correction := correctionMessage(rejections)
+				if err := a.appendMessageToSession(ctx, invocation, correction); err != nil {
+					a.failInvocation(invocation, yield, ErrorClassInternal, err, "")
+					return
+				}
+				if !yield(correction, nil) {
+					return
+				}
+				req.Messages = append(req.Messages, finalResponse.Message, correction)
+				continue
+			}
 			return
 		}
 		// Exceeded maximum iterations
-		yield(nil, ErrMaxIterationsExceeded)
+		a.failInvocation(invocation, yield, ErrorClassMaxIterations, ErrMaxIterationsExceeded, "")
 	}
 }
@@ -0,0 +1,401 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-kratos/blades/tools"
+)
+
+func TestAgentConcurrentToolStateWrites(t *testing.T) {
+	const n = 50
+	model := &mockModel{
+		generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+			if len(req.Messages) > 1 {
+				return textResponse("done"), nil
+			}
+			message := &Message{Role: RoleTool, Status: StatusCompleted}
+			for i := 0; i < n; i++ {
+				message.Parts = append(message.Parts, ToolPart{ID: fmt.Sprintf("call-%d", i), Name: "write", Request: fmt.Sprint(i)})
+			}
+			return &ModelResponse{Message: message}, nil
+		},
+	}
+	writer := tools.NewTool("write", "writes state", tools.HandleFunc(func(ctx context.Context, input string) (string, error) {
+		session, ok := FromSessionContext(ctx)
+		if !ok {
+			return "", ErrNoSessionContext
+		}
+		session.SetState("key-"+input, input)
+		_ = session.State()
+		_ = session.History()
+		return "ok", nil
+	}))
+	agent, err := NewAgent("writer", WithModel(model), WithTools(writer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := NewSession()
+	if _, err := NewRunner(agent).Run(context.Background(), UserMessage("go"), WithSession(session)); err != nil {
+		t.Fatal(err)
+	}
+	state := session.State()
+	for i := 0; i < n; i++ {
+		if state[fmt.Sprintf("key-%d", i)] != fmt.Sprint(i) {
+			t.Fatalf("missing state for key-%d", i)
+		}
+	}
+}
+
+func TestSessionStateSnapshot(t *testing.T) {
+	session := NewSession(map[string]any{"a": 1})
+	state := session.State()
+	state["a"] = 2
+	state["b"] = 3
+	if got := session.State(); got["a"] != 1 || len(got) != 1 {
+		t.Fatalf("mutating the returned state must not affect the session, got %v", got)
+	}
+}
+
+func TestAgentContextOverflow(t *testing.T) {
+	RegisterModelCapabilities("fake-1k", ModelCapabilities{ContextWindow: 1000})
+	newInvocation := func() *Invocation {
+		invocation := &Invocation{Session: NewSession(), Message: UserMessage("current question")}
+		for i := 0; i < 10; i++ {
+			invocation.History = append(invocation.History, UserMessage(fmt.Sprintf("old-%d %s", i, strings.Repeat("x", 400))))
+		}
+		return invocation
+	}
+
+	tests := []struct {
+		name    string
+		options []AgentOption
+		check   func(t *testing.T, req *ModelRequest)
+		wantErr bool
+	}{
+		{
+			name:    "truncate",
+			options: []AgentOption{WithContextOverflowPolicy(ContextOverflowTruncate)},
+			check: func(t *testing.T, req *ModelRequest) {
+				last := req.Messages[len(req.Messages)-1]
+				if last.Text() != "current question" {
+					t.Fatalf("current turn must be kept, got %q", last.Text())
+				}
+				if req.Instruction == nil || req.Instruction.Text() != "be brief" {
+					t.Fatal("instruction must be kept")
+				}
+				if first := req.Messages[0].Text(); strings.HasPrefix(first, "old-0 ") {
+					t.Fatal("oldest history must be dropped")
+				}
+				if tokens := HeuristicTokenCounter.CountTokens(append([]*Message{req.Instruction}, req.Messages...)...); tokens > 1000 {
+					t.Fatalf("request must fit the context window, has %d tokens", tokens)
+				}
+			},
+		},
+		{
+			name: "summarize",
+			options: []AgentOption{
+				WithContextOverflowPolicy(ContextOverflowSummarize),
+				WithSummarizer(func(ctx context.Context, messages []*Message) (*Message, error) {
+					return SystemMessage(fmt.Sprintf("summary of %d messages", len(messages))), nil
+				}),
+			},
+			check: func(t *testing.T, req *ModelRequest) {
+				if first := req.Messages[0].Text(); !strings.HasPrefix(first, "summary of ") {
+					t.Fatalf("expected summary first, got %q", first)
+				}
+				if last := req.Messages[len(req.Messages)-1]; last.Text() != "current question" {
+					t.Fatalf("current turn must be kept, got %q", last.Text())
+				}
+			},
+		},
+		{
+			name:    "error",
+			options: []AgentOption{WithContextOverflowPolicy(ContextOverflowError)},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *ModelRequest
+			model := &mockModel{
+				name: "fake-1k",
+				generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+					got = req
+					return textResponse("ok"), nil
+				},
+			}
+			options := append([]AgentOption{WithModel(model), WithInstruction("be brief")}, tt.options...)
+			agent, err := NewAgent("fitter", options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var runErr error
+			for _, err := range agent.Run(context.Background(), newInvocation()) {
+				if err != nil {
+					runErr = err
+				}
+			}
+			if tt.wantErr {
+				var overflow *ContextWindowError
+				if !errors.As(runErr, &overflow) || overflow.Excess() <= 0 {
+					t.Fatalf("expected ContextWindowError, got %v", runErr)
+				}
+				if model.calls.Load() != 0 {
+					t.Fatal("model must not be called when the request does not fit")
+				}
+				return
+			}
+			if runErr != nil {
+				t.Fatal(runErr)
+			}
+			tt.check(t, got)
+		})
+	}
+}
+
+// staticResolver resolves a fixed list of tools.
+type staticResolver []tools.Tool
+
+func (r staticResolver) Resolve(context.Context) ([]tools.Tool, error) {
+	return r, nil
+}
+
+func TestAgentInterleavedToolCalls(t *testing.T) {
+	var replayed *Message
+	model := &mockModel{
+		generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+			last := req.Messages[len(req.Messages)-1]
+			if last.Role == RoleTool {
+				replayed = last
+				return textResponse("Sunny, and it is noon."), nil
+			}
+			message := &Message{Role: RoleTool, Status: StatusCompleted, Parts: []Part{
+				TextPart{Text: "Let me check the weather."},
+				ToolPart{ID: "call-1", Name: "weather", Request: "{}"},
+				TextPart{Text: "And the time."},
+				ToolPart{ID: "call-2", Name: "time", Request: "{}"},
+			}}
+			return &ModelResponse{Message: message}, nil
+		},
+	}
+	weather := tools.NewTool("weather", "Returns the weather.", tools.HandleFunc(func(ctx context.Context, input string) (string, error) {
+		return "sunny", nil
+	}))
+	clock := tools.NewTool("time", "Returns the time.", tools.HandleFunc(func(ctx context.Context, input string) (string, error) {
+		return "noon", nil
+	}))
+	agent, err := NewAgent("assistant", WithModel(model), WithTools(weather, clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Part{
+		TextPart{Text: "Let me check the weather."},
+		ToolPart{ID: "call-1", Name: "weather", Request: "{}", Response: "sunny"},
+		TextPart{Text: "And the time."},
+		ToolPart{ID: "call-2", Name: "time", Request: "{}", Response: "noon"},
+	}
+	session := NewSession()
+	var narrated *Message
+	for message, err := range NewRunner(agent).RunStream(context.Background(), UserMessage("Weather?"), WithSession(session)) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if message.Role == RoleTool {
+			narrated = message
+		}
+	}
+	if narrated == nil || !slices.Equal(narrated.Parts, want) {
+		t.Fatalf("want the narration streamed with the results, got %v", narrated)
+	}
+	if !slices.Equal(replayed.Parts, want) {
+		t.Fatalf("want the turn replayed in order, got %v", replayed.Parts)
+	}
+	if history := session.History(); len(history) != 3 || !slices.Equal(history[1].Parts, want) {
+		t.Fatalf("want the turn in the history in order, got %v", history)
+	}
+}
+
+func TestAgentToolResultInterceptor(t *testing.T) {
+	lookup := tools.NewTool("lookup", "Looks up a record.", tools.HandleFunc(func(context.Context, string) (string, error) {
+		return "token=s3cr3t " + strings.Repeat("x", 100), nil
+	}))
+	redact := func(ctx context.Context, call ToolPart, result string) (string, error) {
+		return strings.ReplaceAll(result, "s3cr3t", "[REDACTED]"), nil
+	}
+	truncate := func(ctx context.Context, call ToolPart, result string) (string, error) {
+		return result[:20], nil
+	}
+	failing := func(ctx context.Context, call ToolPart, result string) (string, error) {
+		return "", errors.New("result too large")
+	}
+	tests := []struct {
+		name         string
+		interceptors []ToolResultInterceptor
+		want         string
+		wantErr      bool
+	}{
+		{"redact then truncate", []ToolResultInterceptor{redact, truncate}, "token=[REDACTED] xxx", false},
+		{"error", []ToolResultInterceptor{failing}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			model := &mockModel{
+				generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+					last := req.Messages[len(req.Messages)-1]
+					if last.Role != RoleTool {
+						message := &Message{Role: RoleTool, Status: StatusCompleted}
+						message.Parts = []Part{ToolPart{ID: "call", Name: "lookup", Request: "{}"}}
+						return &ModelResponse{Message: message}, nil
+					}
+					seen = last.Parts[0].(ToolPart).Response
+					return textResponse("done"), nil
+				},
+			}
+			agent, err := NewAgent("interceptor",
+				WithModel(model),
+				WithToolsResolver(staticResolver{lookup}),
+				WithToolResultInterceptor(tt.interceptors...),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var failed *Message
+			for message, err := range agent.Run(context.Background(), &Invocation{Message: UserMessage("go")}) {
+				if err != nil {
+					if !tt.wantErr {
+						t.Fatal(err)
+					}
+					break
+				}
+				if message.Status == StatusFailed {
+					failed = message
+				}
+			}
+			if tt.wantErr {
+				if failed == nil || failed.Error.Class != ErrorClassTool {
+					t.Fatalf("want a tool failure, got %+v", failed)
+				}
+				return
+			}
+			if seen != tt.want {
+				t.Fatalf("want the model to see %q, got %q", tt.want, seen)
+			}
+		})
+	}
+}
+
+// panickingTool is a tool that is not built with tools.NewTool.
+type panickingTool struct {
+	tools.Tool
+}
+
+func (panickingTool) Handle(context.Context, string) (string, error) {
+	panic("tool bug")
+}
+
+func TestAgentPanic(t *testing.T) {
+	callTool := &mockModel{
+		generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+			message := &Message{Role: RoleTool, Status: StatusCompleted}
+			message.Parts = []Part{ToolPart{ID: "call", Name: "buggy", Request: "{}"}}
+			return &ModelResponse{Message: message}, nil
+		},
+	}
+	tests := []struct {
+		name      string
+		opts      []AgentOption
+		wantScope string
+		wantClass ErrorClass
+	}{
+		{
+			name: "middleware",
+			opts: []AgentOption{
+				WithModel(&mockModel{}),
+				WithMiddleware(func(next Handler) Handler {
+					return HandleFunc(func(context.Context, *Invocation) Generator[*Message, error] {
+						panic("middleware bug")
+					})
+				}),
+			},
+			wantScope: "agent",
+			wantClass: ErrorClassInternal,
+		},
+		{
+			name: "resolved tool",
+			opts: []AgentOption{
+				WithModel(callTool),
+				WithToolsResolver(staticResolver{panickingTool{tools.NewTool("buggy", "Panics.", nil)}}),
+			},
+			wantScope: "tool",
+			wantClass: ErrorClassTool,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agent, err := NewAgent("fragile", tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var (
+				failed *Message
+				runErr error
+			)
+			for message, err := range agent.Run(context.Background(), &Invocation{Message: UserMessage("go")}) {
+				if err != nil {
+					runErr = err
+					break
+				}
+				failed = message
+			}
+			var panicErr *PanicError
+			if !errors.As(runErr, &panicErr) || panicErr.Scope != tt.wantScope {
+				t.Fatalf("want a %s PanicError, got %v", tt.wantScope, runErr)
+			}
+			if failed == nil || failed.Status != StatusFailed || failed.Error.Class != tt.wantClass {
+				t.Fatalf("want a failed message of class %s, got %+v", tt.wantClass, failed)
+			}
+		})
+	}
+}
+
+func TestAgentMergesSystemMessages(t *testing.T) {
+	var got *ModelRequest
+	model := &mockModel{generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+		got = req
+		return textResponse("ok"), nil
+	}}
+	agent, err := NewAgent("assistant", WithModel(model), WithInstruction("Be brief."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	invocation := &Invocation{
+		History: []*Message{
+			SystemMessage("Be brief."),
+			SystemMessage("Answer in French."),
+			DeveloperMessage("Use metric units."),
+			UserMessage("Hello"),
+		},
+		Message: UserMessage("How tall is Mont Blanc?"),
+	}
+	for _, err := range agent.Run(context.Background(), invocation) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if text := got.Instruction.Text(); text != "Be brief.\nAnswer in French." {
+		t.Fatalf("want the input system message merged into the instruction once, got %q", text)
+	}
+	var roles []Role
+	for _, m := range got.Messages {
+		roles = append(roles, m.Role)
+	}
+	if want := []Role{RoleDeveloper, RoleUser, RoleUser}; !slices.Equal(roles, want) {
+		t.Fatalf("want messages %v, got %v", want, roles)
+	}
+}
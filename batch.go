@@ -0,0 +1,277 @@
+package blades
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// RateLimiter paces the runs of a batch, e.g. to the requests per minute of a
+// provider account. The *rate.Limiter of golang.org/x/time/rate implements it.
+// It knows nothing of priorities: the runs of a batch take its tokens as they
+// ask, with no regard for other callers sharing it. Runs that must go before
+// the batch should share a Limiter of the Runner instead, which admits the
+// batch at PriorityLow.
+type RateLimiter interface {
+	// Wait blocks until a run may start, or fails once ctx is done.
+	Wait(ctx context.Context) error
+}
+
+// BatchOptions configures BatchRun.
+type BatchOptions struct {
+	// Concurrency is the number of inputs run at once, 1 by default. A
+	// Limiter of the Runner caps it further across all its runs.
+	Concurrency int
+	// ContinueOnError keeps running the other inputs when one fails;
+	// otherwise the first failure stops the batch.
+	ContinueOnError bool
+	// RateLimiter, if set, is waited on before each run, whatever its
+	// priority.
+	RateLimiter RateLimiter
+	// Checkpoint is the path of a file the answers are appended to as they
+	// complete. Running the batch again with the same file skips the inputs
+	// it holds an answer to, unless their text changed, so an interrupted
+	// batch continues where it left off.
+	Checkpoint string
+	// OnResult is called with each result as it completes, including those
+	// restored from the checkpoint, one at a time.
+	OnResult func(BatchResult)
+	// RunOptions apply to every run. Each input runs in a new session with
+	// PriorityLow unless they say otherwise.
+	RunOptions []RunOption
+}
+
+// BatchResult is the outcome of an input of a batch.
+type BatchResult struct {
+	// Index is the position of the input.
+	Index  int
+	Output *Message
+	Err    error
+	// Usage and Cost are those of the run; see RunReport.
+	Usage TokenUsage
+	Cost  float64
+	// Resumed is set on results restored from the checkpoint.
+	Resumed bool
+}
+
+// BatchSummary is the outcome of a batch.
+type BatchSummary struct {
+	// Results are the results of the inputs, in their order. The result of
+	// an input that did not run, because the batch stopped first, only has
+	// its Index.
+	Results []BatchResult
+	// Succeeded and Failed count the inputs that completed, Resumed those
+	// restored from the checkpoint among them, and Pending those that did
+	// not run.
+	Succeeded, Failed, Resumed, Pending int
+	// Usage and Cost are the sums over the succeeded inputs.
+	Usage TokenUsage
+	Cost  float64
+}
+
+// BatchRun runs the independent inputs through the runner with a pool of
+// workers, for throughput rather than latency, e.g. to classify many
+// records offline. It returns the summary of the batch along with the
+// error that stopped it: the cause of ctx, or the first failure unless
+// ContinueOnError is set.
+func BatchRun(ctx context.Context, runner *Runner, inputs []*Message, opts BatchOptions) (*BatchSummary, error) {
+	summary := &BatchSummary{Results: make([]BatchResult, len(inputs))}
+	for i := range summary.Results {
+		summary.Results[i].Index = i
+	}
+	restored, err := loadBatchCheckpoint(opts.Checkpoint, inputs)
+	if err != nil {
+		return summary, err
+	}
+	var checkpoint *os.File
+	if opts.Checkpoint != "" {
+		checkpoint, err = os.OpenFile(opts.Checkpoint, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return summary, fmt.Errorf("batch checkpoint: %w", err)
+		}
+		defer checkpoint.Close()
+	}
+	ctx, stop := context.WithCancelCause(ctx)
+	defer stop(nil)
+	var mu sync.Mutex
+	record := func(result BatchResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		if checkpoint != nil && result.Err == nil && !result.Resumed {
+			if err := writeBatchCheckpoint(checkpoint, inputs[result.Index], result); err != nil {
+				stop(err)
+			}
+		}
+		summary.Results[result.Index] = result
+		if opts.OnResult != nil {
+			opts.OnResult(result)
+		}
+	}
+	for _, result := range restored {
+		record(result)
+	}
+
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for range max(opts.Concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				result := runBatchInput(ctx, runner, i, inputs[i], opts)
+				if result.Err != nil && ctx.Err() != nil {
+					// The batch stopped during the run.
+					continue
+				}
+				record(result)
+				if result.Err != nil && !opts.ContinueOnError {
+					stop(fmt.Errorf("batch input %d: %w", i, result.Err))
+				}
+			}
+		}()
+	}
+feed:
+	for i := range inputs {
+		if _, ok := restored[i]; ok {
+			continue
+		}
+		select {
+		case indices <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(indices)
+	wg.Wait()
+
+	for _, result := range summary.Results {
+		switch {
+		case result.Err != nil:
+			summary.Failed++
+		case result.Output == nil:
+			summary.Pending++
+		default:
+			summary.Succeeded++
+			if result.Resumed {
+				summary.Resumed++
+			}
+			summary.Usage = summary.Usage.Add(result.Usage)
+			summary.Cost += result.Cost
+		}
+	}
+	if ctx.Err() != nil {
+		return summary, context.Cause(ctx)
+	}
+	return summary, nil
+}
+
+// runBatchInput runs an input of a batch, and looks up its usage and cost in
+// the report of the run.
+func runBatchInput(ctx context.Context, runner *Runner, i int, input *Message, opts BatchOptions) BatchResult {
+	result := BatchResult{Index: i}
+	if opts.RateLimiter != nil {
+		if result.Err = opts.RateLimiter.Wait(ctx); result.Err != nil {
+			return result
+		}
+	}
+	invocationID := NewInvocationID()
+	runOpts := append([]RunOption{WithPriority(PriorityLow)}, opts.RunOptions...)
+	runOpts = append(runOpts, WithInvocationID(invocationID))
+	result.Output, result.Err = runner.Run(ctx, input, runOpts...)
+	if report, ok := runner.Report(invocationID); ok {
+		total := report.Total()
+		result.Usage, result.Cost = total.Usage, total.Cost
+	}
+	if result.Err != nil {
+		result.Output = nil
+	}
+	return result
+}
+
+// BatchCheckpointVersion is the format version of the lines of the batch
+// checkpoints. Version 0 lines were written without an envelope.
+const BatchCheckpointVersion = 1
+
+// batchMigrations upgrades the checkpoint lines of older versions on load.
+var batchMigrations = NewMigrations("batch_checkpoint", BatchCheckpointVersion).
+	Register(0, keepPayload)
+
+// batchEntry is a line of a batch checkpoint: the answer to an input.
+type batchEntry struct {
+	Index int `json:"index"`
+	// Input is the SHA-256 of the text of the input, which must match for
+	// the answer to be reused.
+	Input  string     `json:"input"`
+	Output *Message   `json:"output"`
+	Usage  TokenUsage `json:"usage"`
+	Cost   float64    `json:"cost"`
+}
+
+// loadBatchCheckpoint returns the results restored from the checkpoint, by
+// index. A missing file restores none, and malformed lines, such as the
+// last one of an interrupted write, are skipped.
+func loadBatchCheckpoint(path string, inputs []*Message) (map[int]BatchResult, error) {
+	restored := make(map[int]BatchResult)
+	if path == "" {
+		return restored, nil
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return restored, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("batch checkpoint: %w", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		var entry batchEntry
+		if err := batchMigrations.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			if errors.Is(err, ErrFutureVersion) {
+				return nil, fmt.Errorf("batch checkpoint: %w", err)
+			}
+			continue
+		}
+		if entry.Output == nil {
+			continue
+		}
+		if entry.Index < 0 || entry.Index >= len(inputs) || entry.Input != inputDigest(inputs[entry.Index]) {
+			continue
+		}
+		restored[entry.Index] = BatchResult{Index: entry.Index, Output: entry.Output, Usage: entry.Usage, Cost: entry.Cost, Resumed: true}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("batch checkpoint: %w", err)
+	}
+	return restored, nil
+}
+
+// writeBatchCheckpoint appends the answer to an input to the checkpoint.
+func writeBatchCheckpoint(f *os.File, input *Message, result BatchResult) error {
+	line, err := batchMigrations.Marshal(batchEntry{
+		Index:  result.Index,
+		Input:  inputDigest(input),
+		Output: result.Output,
+		Usage:  result.Usage,
+		Cost:   result.Cost,
+	})
+	if err != nil {
+		return fmt.Errorf("batch checkpoint: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("batch checkpoint: %w", err)
+	}
+	return nil
+}
+
+// inputDigest returns the SHA-256 of the text of the input.
+func inputDigest(input *Message) string {
+	sum := sha256.Sum256([]byte(input.Text()))
+	return hex.EncodeToString(sum[:])
+}
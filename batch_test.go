@@ -0,0 +1,140 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// countingLimiter is a RateLimiter counting its waits.
+type countingLimiter struct {
+	mu    sync.Mutex
+	waits int
+}
+
+func (l *countingLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.waits++
+	return ctx.Err()
+}
+
+func TestBatchRunResume(t *testing.T) {
+	RegisterModelPricing("batch-classifier", ModelPricing{Input: 1, Output: 2})
+	var (
+		mu   sync.Mutex
+		seen []string
+	)
+	model := &mockModel{
+		name: "batch-classifier",
+		generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+			text := req.Messages[len(req.Messages)-1].Text()
+			mu.Lock()
+			seen = append(seen, text)
+			mu.Unlock()
+			res := textResponse("label:" + text)
+			res.Message.TokenUsage = TokenUsage{InputTokens: 100, OutputTokens: 10, TotalTokens: 110}
+			return res, nil
+		},
+	}
+	agent, err := NewAgent("classifier", WithModel(model))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := NewRunner(agent)
+	var inputs []*Message
+	for i := range 20 {
+		inputs = append(inputs, UserMessage(fmt.Sprint("record-", i)))
+	}
+	checkpoint := filepath.Join(t.TempDir(), "batch.jsonl")
+
+	// The batch is interrupted after 8 results.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	results := 0
+	first, err := BatchRun(ctx, runner, inputs, BatchOptions{
+		Concurrency: 3,
+		Checkpoint:  checkpoint,
+		OnResult: func(BatchResult) {
+			if results++; results == 8 {
+				cancel()
+			}
+		},
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("want the batch interrupted, got %v", err)
+	}
+	if first.Succeeded < 8 || first.Pending == 0 || first.Succeeded+first.Pending != len(inputs) {
+		t.Fatalf("want 8 or more inputs done and the rest pending, got %+v", first)
+	}
+	done := first.Succeeded
+
+	// Running it again only runs the inputs without an answer.
+	mu.Lock()
+	seen = nil
+	mu.Unlock()
+	limiter := &countingLimiter{}
+	second, err := BatchRun(context.Background(), runner, inputs, BatchOptions{
+		Concurrency: 4,
+		Checkpoint:  checkpoint,
+		RateLimiter: limiter,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != len(inputs)-done || limiter.waits != len(seen) {
+		t.Fatalf("want %d inputs run once each, got %d runs and %d waits", len(inputs)-done, len(seen), limiter.waits)
+	}
+	if second.Succeeded != len(inputs) || second.Resumed != done || second.Pending != 0 {
+		t.Fatalf("want every input done, %d of them resumed, got %+v", done, second)
+	}
+	for i, result := range second.Results {
+		if result.Index != i || result.Output.Text() != fmt.Sprint("label:record-", i) {
+			t.Fatalf("want the answer to input %d at its index, got %+v", i, result)
+		}
+	}
+	wantUsage := TokenUsage{InputTokens: 2000, OutputTokens: 200, TotalTokens: 2200}
+	if second.Usage != wantUsage || fmt.Sprintf("%.4f", second.Cost) != "0.0024" {
+		t.Fatalf("want the usage and cost of all the inputs, got %+v and %f", second.Usage, second.Cost)
+	}
+}
+
+func TestBatchRunErrors(t *testing.T) {
+	model := &mockModel{
+		generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+			text := req.Messages[len(req.Messages)-1].Text()
+			if strings.HasSuffix(text, "-3") {
+				return nil, errors.New("model unavailable")
+			}
+			return textResponse("ok"), nil
+		},
+	}
+	agent, err := NewAgent("classifier", WithModel(model))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var inputs []*Message
+	for i := range 6 {
+		inputs = append(inputs, UserMessage(fmt.Sprint("record-", i)))
+	}
+
+	summary, err := BatchRun(context.Background(), NewRunner(agent), inputs, BatchOptions{Concurrency: 2, ContinueOnError: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Succeeded != 5 || summary.Failed != 1 || summary.Results[3].Err == nil {
+		t.Fatalf("want the failure of input 3 recorded, got %+v", summary)
+	}
+
+	summary, err = BatchRun(context.Background(), NewRunner(agent), inputs, BatchOptions{})
+	if err == nil || !strings.Contains(err.Error(), "batch input 3") {
+		t.Fatalf("want the batch stopped by input 3, got %v", err)
+	}
+	if summary.Succeeded != 3 || summary.Failed != 1 || summary.Pending != 2 {
+		t.Fatalf("want the inputs after the failure pending, got %+v", summary)
+	}
+}
@@ -0,0 +1,32 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// invocationCancelled reports whether ctx was cancelled through Runner.Cancel.
+func invocationCancelled(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrInvocationCancelled)
+}
+
+// IsInvocationCancelled reports whether the invocation with the given ID, or
+// one of its sub-agent invocations, was cancelled by the user in the session,
+// as opposed to failing, so that a resumed run can tell the two apart.
+func IsInvocationCancelled(session Session, invocationID string) bool {
+	for _, m := range session.Messages(MessageFilter{Role: RoleAssistant}) {
+		if !isInvocationOrChild(m.InvocationID, invocationID) {
+			continue
+		}
+		if m.Status == StatusCancelled {
+			return true
+		}
+	}
+	return false
+}
+
+// isInvocationOrChild reports whether id is invocationID or a hierarchical child of it.
+func isInvocationOrChild(id, invocationID string) bool {
+	return id == invocationID || strings.HasPrefix(id, invocationID+".")
+}
@@ -0,0 +1,49 @@
+package blades
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// CandidateKey is the metadata key of the index of the candidate selected by
+// WithCandidateSelector among those the model returned.
+const CandidateKey = "candidate"
+
+// CandidateSelector returns the index of the best of the candidate responses,
+// e.g. as scored by a reward model or an evaluation judge.
+type CandidateSelector func(ctx context.Context, candidates []*Message) (int, error)
+
+// WithCandidateSelector sets the selector that picks the response among the
+// candidates requested with the CandidateCount model option. Without one,
+// the first candidate is used.
+func WithCandidateSelector(selector CandidateSelector) AgentOption {
+	return func(a *agent) {
+		a.candidateSelector = selector
+	}
+}
+
+// selectCandidate makes the selected candidate the message of the response.
+// It keeps the usage of all candidates on the selected message.
+func (a *agent) selectCandidate(ctx context.Context, res *ModelResponse) error {
+	if a.candidateSelector == nil || len(res.Alternatives) == 0 {
+		return nil
+	}
+	candidates := append([]*Message{res.Message}, res.Alternatives...)
+	index, err := a.candidateSelector(ctx, candidates)
+	if err != nil {
+		return fmt.Errorf("agent: select candidate: %w", err)
+	}
+	if index < 0 || index >= len(candidates) {
+		return fmt.Errorf("agent: select candidate: index %d out of range [0, %d)", index, len(candidates))
+	}
+	selected := candidates[index]
+	selected.TokenUsage, res.Message.TokenUsage = res.Message.TokenUsage, TokenUsage{}
+	if selected.Metadata == nil {
+		selected.Metadata = make(map[string]any)
+	}
+	selected.Metadata[CandidateKey] = index
+	res.Message = selected
+	res.Alternatives = slices.Delete(candidates, index, index+1)
+	return nil
+}
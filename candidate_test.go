@@ -0,0 +1,88 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestCandidateSelector(t *testing.T) {
+	var requested int64
+	model := &mockModel{
+		generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+			requested = req.Options.CandidateCount
+			res := textResponse("Paris.")
+			res.Message.TokenUsage = TokenUsage{InputTokens: 10, OutputTokens: 9, TotalTokens: 19}
+			for _, text := range []string{"The capital is Paris.", "It is Paris."} {
+				res.Alternatives = append(res.Alternatives, textResponse(text).Message)
+			}
+			return res, nil
+		},
+	}
+	longest := func(ctx context.Context, candidates []*Message) (int, error) {
+		best := 0
+		for i, candidate := range candidates {
+			if len(candidate.Text()) > len(candidates[best].Text()) {
+				best = i
+			}
+		}
+		return best, nil
+	}
+	tests := []struct {
+		name       string
+		selector   CandidateSelector
+		streamable bool
+		want       string
+		wantErr    error
+	}{
+		{name: "default first", want: "Paris."},
+		{name: "selector", selector: longest, want: "The capital is Paris."},
+		{
+			name: "out of range",
+			selector: func(context.Context, []*Message) (int, error) {
+				return 3, nil
+			},
+		},
+		{name: "streaming", streamable: true, wantErr: ErrStreamingCandidates},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agent, err := NewAgent("sampler",
+				WithModel(model),
+				WithModelOptions(CandidateCount(3)),
+				WithCandidateSelector(tt.selector),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var final *Message
+			var runErr error
+			for message, err := range agent.Run(context.Background(), &Invocation{Message: UserMessage("Capital of France?"), Streamable: tt.streamable}) {
+				if err != nil {
+					runErr = err
+					break
+				}
+				final = message
+			}
+			if tt.want == "" {
+				if runErr == nil || (tt.wantErr != nil && !errors.Is(runErr, tt.wantErr)) {
+					t.Fatalf("want error %v, got %v", tt.wantErr, runErr)
+				}
+				return
+			}
+			if runErr != nil {
+				t.Fatal(runErr)
+			}
+			if requested != 3 || final.Text() != tt.want {
+				t.Fatalf("want %q from 3 candidates, got %q from %d", tt.want, final.Text(), requested)
+			}
+			if final.TokenUsage.TotalTokens != 19 {
+				t.Fatalf("want the usage of all candidates, got %+v", final.TokenUsage)
+			}
+			if tt.selector != nil && fmt.Sprint(final.Metadata[CandidateKey]) != "1" {
+				t.Fatalf("want the selected index in the metadata, got %v", final.Metadata[CandidateKey])
+			}
+		})
+	}
+}
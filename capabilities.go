@@ -0,0 +1,126 @@
+package blades
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// UsageEstimatedKey is the metadata key set on streamed answers whose token
+// usage was estimated because the model does not report it when streaming.
+const UsageEstimatedKey = "usage_estimated"
+
+// CapabilityError is returned before calling a model for a request that needs
+// a capability the model lacks, instead of the error of the provider. It
+// unwraps to ErrCapabilityUnsupported.
+type CapabilityError struct {
+	// Model is the name of the model.
+	Model string
+	// Capability is the missing capability, e.g. "tool calling".
+	Capability string
+	// Hint tells how to fix the request.
+	Hint string
+}
+
+func (e *CapabilityError) Error() string {
+	return fmt.Sprintf("model %s does not support %s; %s", e.Model, e.Capability, e.Hint)
+}
+
+// Unwrap returns ErrCapabilityUnsupported.
+func (e *CapabilityError) Unwrap() error {
+	return ErrCapabilityUnsupported
+}
+
+// capabilities returns the capabilities of the model the invocation in ctx runs with.
+func (a *agent) capabilities(ctx context.Context) (string, ModelCapabilities) {
+	model := a.provider(ctx)
+	name := ResolveModel(ctx, model.Name())
+	return name, capabilitiesOf(model, name)
+}
+
+// checkTools fails fast when the agent has tools its model cannot call.
+func (a *agent) checkTools() error {
+	if len(a.tools) == 0 {
+		return nil
+	}
+	if c := capabilitiesOf(a.model, a.model.Name()); c.Tools == Unsupported {
+		return &CapabilityError{Model: a.model.Name(), Capability: "tool calling", Hint: "remove WithTools or switch models"}
+	}
+	return nil
+}
+
+// adaptRequest checks the request against the capabilities of the model and
+// replaces the output schema with an instruction for models without
+// structured output, or when a Structured run asks for it.
+func (a *agent) adaptRequest(ctx context.Context, req *ModelRequest) error {
+	name, c := a.capabilities(ctx)
+	if len(req.Tools) > 0 && c.Tools == Unsupported {
+		return &CapabilityError{Model: name, Capability: "tool calling", Hint: "remove WithTools or switch models"}
+	}
+	if c.Vision == Unsupported && hasImages(req.Messages) {
+		return &CapabilityError{Model: name, Capability: "image input", Hint: "remove the image parts or switch models"}
+	}
+	if a.strict {
+		if c.Vision == SupportUnknown && hasImages(req.Messages) {
+			a.warnConfig(ctx, CheckVision, "register the capabilities of the model with RegisterModelCapabilities",
+				"images are sent to model %s, whose vision support is unknown", name)
+		}
+		if req.OutputSchema != nil && c.StructuredOutput == Unsupported {
+			a.warnConfig(ctx, CheckStructuredOutput, "switch models, or check the output with WithOutputValidators",
+				"model %s does not support structured output, so the output schema is only sent as an instruction", name)
+		}
+	}
+	inject := c.StructuredOutput == Unsupported
+	if s, ok := structuredFromContext(ctx); ok {
+		req.OutputSchema, inject = s.schema, inject || s.inject
+	}
+	if req.OutputSchema != nil && inject {
+		schema, err := json.Marshal(req.OutputSchema)
+		if err != nil {
+			return fmt.Errorf("agent %s: output schema: %w", a.name, err)
+		}
+		directive := SystemMessage("Respond only with a JSON value that conforms to this JSON schema, without any other text:\n" + string(schema))
+		if req.Instruction != nil {
+			directive = MergeParts(req.Instruction.Clone(), directive)
+		}
+		req.Instruction, req.OutputSchema = directive, nil
+	}
+	return nil
+}
+
+// hasImages reports whether any of the messages has an image part.
+func hasImages(messages []*Message) bool {
+	for _, m := range messages {
+		for _, part := range m.Parts {
+			switch v := part.(type) {
+			case FilePart:
+				if v.MIMEType.Type() == "image" {
+					return true
+				}
+			case DataPart:
+				if v.MIMEType.Type() == "image" {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// estimateUsage estimates the token usage of a streamed answer of a model
+// that does not report it, so that token limits and budgets still apply.
+func (a *agent) estimateUsage(ctx context.Context, req *ModelRequest, message *Message) {
+	if message.TokenUsage != (TokenUsage{}) {
+		return
+	}
+	if _, c := a.capabilities(ctx); c.StreamingUsage != Unsupported {
+		return
+	}
+	input := a.tokenCounter.CountTokens(append([]*Message{req.Instruction}, req.Messages...)...)
+	output := a.tokenCounter.CountTokens(message)
+	message.TokenUsage = TokenUsage{InputTokens: input, OutputTokens: output, TotalTokens: input + output}
+	if message.Metadata == nil {
+		message.Metadata = make(map[string]any)
+	}
+	message.Metadata[UsageEstimatedKey] = true
+}
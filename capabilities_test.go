@@ -0,0 +1,143 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-kratos/blades/tools"
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+// capableModel is a mock model that reports its capabilities.
+type capableModel struct {
+	*mockModel
+	capabilities ModelCapabilities
+}
+
+func (m *capableModel) Capabilities(model string) ModelCapabilities {
+	return m.capabilities
+}
+
+func TestLookupModelCapabilities(t *testing.T) {
+	tests := []struct {
+		name string
+		want ModelCapabilities
+		ok   bool
+	}{
+		{"gpt-4o-2024-08-06", logprobs(Supported, chat(128000)), true},
+		{"gpt-3.5-turbo", ModelCapabilities{ContextWindow: 16385, Tools: Supported, Vision: Unsupported, StructuredOutput: Unsupported, StreamingUsage: Supported, Logprobs: Supported}, true},
+		{"o1-mini-2024-09-12", ModelCapabilities{ContextWindow: 128000, Tools: Unsupported, Vision: Unsupported, StructuredOutput: Unsupported, StreamingUsage: Supported, Logprobs: Unsupported}, true},
+		{"gemini-2.5-flash-lite", chat(1048576), true},
+		{"anthropic.claude-sonnet-4-20250514-v1:0", withoutSchema(chat(200000)), true},
+		{"us.anthropic.claude-sonnet-4-20250514-v1:0", withoutSchema(chat(200000)), true},
+		{"unknown-model", ModelCapabilities{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := LookupModelCapabilities(tt.name)
+			if got != tt.want || ok != tt.ok {
+				t.Fatalf("want %+v %v, got %+v %v", tt.want, tt.ok, got, ok)
+			}
+		})
+	}
+}
+
+func TestRegisterModelCapabilities(t *testing.T) {
+	// Overrides keep the defaults they do not set.
+	RegisterModelCapabilities("claude-3-5-haiku-override", ModelCapabilities{Vision: Unsupported})
+	RegisterModelCapabilities("claude-3-5-haiku-override", ModelCapabilities{ContextWindow: 100000})
+	got, ok := LookupModelCapabilities("claude-3-5-haiku-override-1")
+	want := ModelCapabilities{ContextWindow: 100000, Tools: Supported, Vision: Unsupported, StructuredOutput: Supported, StreamingUsage: Supported, Logprobs: Unsupported}
+	if !ok || got != want {
+		t.Fatalf("want %+v, got %+v", want, got)
+	}
+	if got, _ := LookupModelCapabilities("claude-3-5-haiku"); got.Vision != Supported {
+		t.Fatalf("want other models unchanged, got %+v", got)
+	}
+
+	// Registered capabilities override those the provider reports, which
+	// override the defaults.
+	model := &capableModel{mockModel: &mockModel{name: "gpt-4o-provider"}, capabilities: ModelCapabilities{Vision: Unsupported, StreamingUsage: Unsupported}}
+	if got := capabilitiesOf(WrapModel(model), "gpt-4o-provider"); got.Vision != Unsupported || got.StreamingUsage != Unsupported || got.Tools != Supported {
+		t.Fatalf("want the provider capabilities over the defaults, got %+v", got)
+	}
+	RegisterModelCapabilities("gpt-4o-provider", ModelCapabilities{Vision: Supported})
+	if got := capabilitiesOf(model, "gpt-4o-provider"); got.Vision != Supported || got.StreamingUsage != Unsupported {
+		t.Fatalf("want the registered capabilities over the provider, got %+v", got)
+	}
+}
+
+func TestAgentCapabilities(t *testing.T) {
+	lookup := tools.NewTool("lookup", "Looks up.", tools.HandleFunc(func(ctx context.Context, input string) (string, error) {
+		return "", nil
+	}))
+	_, err := NewAgent("assistant", WithModel(&mockModel{name: "o1-mini"}), WithTools(lookup))
+	var capabilityErr *CapabilityError
+	if !errors.As(err, &capabilityErr) || !errors.Is(err, ErrCapabilityUnsupported) ||
+		err.Error() != "model o1-mini does not support tool calling; remove WithTools or switch models" {
+		t.Fatalf("want a tool calling error, got %v", err)
+	}
+
+	model := &mockModel{name: "deepseek-chat", generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+		return textResponse("a cat"), nil
+	}}
+	agent, err := NewAgent("assistant", WithModel(model))
+	if err != nil {
+		t.Fatal(err)
+	}
+	photo := &Message{Role: RoleUser, Parts: []Part{TextPart{Text: "What is this?"}, DataPart{Name: "photo.png", Bytes: []byte("png"), MIMEType: MIMEImagePNG}}}
+	if _, err := NewRunner(agent).Run(context.Background(), photo); !errors.Is(err, ErrCapabilityUnsupported) || !strings.Contains(err.Error(), "image input") {
+		t.Fatalf("want an image input error, got %v", err)
+	}
+	if model.calls.Load() != 0 {
+		t.Fatal("want the model not called")
+	}
+}
+
+func TestAgentStructuredOutputFallback(t *testing.T) {
+	var got *ModelRequest
+	model := &capableModel{
+		mockModel: &mockModel{generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+			got = req
+			return textResponse(`{"score": 1}`), nil
+		}},
+		capabilities: ModelCapabilities{StructuredOutput: Unsupported},
+	}
+	schema := &jsonschema.Schema{Type: "object", Properties: map[string]*jsonschema.Schema{"score": {Type: "integer"}}}
+	agent, err := NewAgent("scorer", WithModel(model), WithInstruction("Score the answer."), WithOutputSchema(schema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewRunner(agent).Run(context.Background(), UserMessage("42")); err != nil {
+		t.Fatal(err)
+	}
+	if got.OutputSchema != nil || !strings.HasPrefix(got.Instruction.Text(), "Score the answer.") ||
+		!strings.Contains(got.Instruction.Text(), `"score":{"type":"integer"}`) {
+		t.Fatalf("want the schema in the instruction, got %v %q", got.OutputSchema, got.Instruction.Text())
+	}
+}
+
+func TestAgentEstimatesStreamingUsage(t *testing.T) {
+	model := &capableModel{
+		mockModel: &mockModel{generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+			return textResponse("The answer is forty-two."), nil
+		}},
+		capabilities: ModelCapabilities{StreamingUsage: Unsupported},
+	}
+	agent, err := NewAgent("assistant", WithModel(model))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var answer *Message
+	for m, err := range NewRunner(agent).RunStream(context.Background(), UserMessage("What is the answer?")) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		answer = m
+	}
+	if answer.TokenUsage.InputTokens == 0 || answer.TokenUsage.OutputTokens == 0 || answer.Metadata[UsageEstimatedKey] != true {
+		t.Fatalf("want the usage estimated, got %+v %v", answer.TokenUsage, answer.Metadata)
+	}
+}
@@ -0,0 +1,112 @@
+package blades
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/go-kratos/blades/tools"
+)
+
+// AskUserToolName is the name of the tool created by NewAskUserTool.
+const AskUserToolName = "ask_user"
+
+// ClarificationToolCallKey is the metadata key of the ID of the tool call a
+// StatusNeedsInput message asks the question of.
+const ClarificationToolCallKey = "tool_call_id"
+
+// NeedsInputError is returned by a tool to pause the invocation until the
+// user answers Question. It unwraps to ErrNeedsInput.
+//
+// The agent records the tool call and ends the stream with a StatusNeedsInput
+// message holding the question, which flows pass on without running their
+// next steps. A resumable Runner run with the same invocation ID and the
+// answer as input replays the completed steps, hands the answer to the
+// paused agent as the result of the tool call and continues from there.
+type NeedsInputError struct {
+	Question string
+}
+
+func (e *NeedsInputError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrNeedsInput, e.Question)
+}
+
+// Unwrap returns ErrNeedsInput.
+func (e *NeedsInputError) Unwrap() error {
+	return ErrNeedsInput
+}
+
+// ClarificationRequest is the input of the tool created by NewAskUserTool.
+type ClarificationRequest struct {
+	Question string `json:"question" jsonschema:"The question to ask the user."`
+}
+
+// NewAskUserTool creates the tool a model calls to ask the user a question
+// in the middle of a flow, e.g. "which region do you mean?". The call pauses
+// the invocation with a NeedsInputError; the answer of the user becomes its result.
+func NewAskUserTool() (tools.Tool, error) {
+	return tools.NewFunc(
+		AskUserToolName,
+		"Ask the user a question when the request is ambiguous or misses information you need, and wait for the answer.",
+		func(ctx context.Context, req ClarificationRequest) (string, error) {
+			return "", &NeedsInputError{Question: req.Question}
+		},
+	)
+}
+
+// pauseInvocation records the tool calls of the message, the call asking the
+// question left without result, and returns the StatusNeedsInput message
+// that ends the stream.
+func (a *agent) pauseInvocation(ctx context.Context, invocation *Invocation, message *Message, callID string, question string) (*Message, error) {
+	if err := a.appendToolMessage(ctx, invocation, message); err != nil {
+		return nil, err
+	}
+	paused := NewAssistantMessage(StatusNeedsInput)
+	paused.Author = a.name
+	paused.InvocationID = invocation.ID
+	paused.Parts = Parts(question)
+	paused.Metadata = map[string]any{ClarificationToolCallKey: callID}
+	if invocation.Session != nil {
+		if err := invocation.Session.Append(ctx, paused); err != nil {
+			return nil, err
+		}
+	}
+	return paused, nil
+}
+
+// pendingQuestion returns the StatusNeedsInput message the invocation, or
+// one of its sub-agent invocations, paused on and the user has not answered
+// yet, or nil if there is none.
+func pendingQuestion(session Session, invocationID string) *Message {
+	var question *Message
+	for _, m := range session.History() {
+		switch {
+		case question != nil && m.Role == RoleUser && m.InvocationID == question.InvocationID:
+			question = nil
+		case m.Status == StatusNeedsInput && isInvocationOrChild(m.InvocationID, invocationID):
+			question = m
+		}
+	}
+	return question
+}
+
+// answerClarification returns the messages with the answer set as the result
+// of the tool call the question asked.
+func answerClarification(messages []*Message, question *Message, answer *Message) []*Message {
+	callID, _ := question.Metadata[ClarificationToolCallKey].(string)
+	for i := len(messages) - 1; i >= 0; i-- {
+		for j, part := range messages[i].Parts {
+			call, ok := part.(ToolPart)
+			if !ok || call.ID != callID {
+				continue
+			}
+			call.Response = answer.Text()
+			answered := messages[i].Clone()
+			answered.Parts[j] = call
+			messages = slices.Clone(messages)
+			messages[i] = answered
+			return messages
+		}
+	}
+	return messages
+}
@@ -0,0 +1,82 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// clarifyingModel asks the user for the region, then answers with the input
+// and the answer.
+func clarifyingModel() *mockModel {
+	return &mockModel{generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+		last := req.Messages[len(req.Messages)-1]
+		for _, part := range last.Parts {
+			if call, ok := part.(ToolPart); ok && call.Name == AskUserToolName {
+				return textResponse(fmt.Sprintf("%s in %s", req.Messages[0].Text(), call.Response)), nil
+			}
+		}
+		return &ModelResponse{Message: &Message{Role: RoleTool, Status: StatusCompleted, Parts: []Part{
+			ToolPart{ID: "call-1", Name: AskUserToolName, Request: `{"question":"Which region?"}`},
+		}}}, nil
+	}}
+}
+
+func TestAskUserResume(t *testing.T) {
+	newRunner := func(model *mockModel) *Runner {
+		askUser, err := NewAskUserTool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		agent, err := NewAgent("deployer", WithModel(model), WithTools(askUser))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return NewRunner(agent, WithResumable(true))
+	}
+	ctx := context.Background()
+	session := NewSession()
+	model := clarifyingModel()
+	runner := newRunner(model)
+	paused, err := runner.Run(ctx, UserMessage("deploy the app"), WithSession(session), WithInvocationID("inv-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if paused.Status != StatusNeedsInput || paused.Text() != "Which region?" || paused.Metadata[ClarificationToolCallKey] != "call-1" {
+		t.Fatalf("want the run paused on the question, got %s %q %v", paused.Status, paused.Text(), paused.Metadata)
+	}
+	// Retrying the input asks the question again.
+	again, err := runner.Run(ctx, UserMessage("deploy the app"), WithSession(session), WithInvocationID("inv-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Status != StatusNeedsInput || model.calls.Load() != 1 {
+		t.Fatalf("want the question replayed without calling the model, got %s after %d calls", again.Status, model.calls.Load())
+	}
+
+	// Resume with the answer in another process.
+	data, err := Snapshot(session, "inv-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := Restore(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	model = clarifyingModel()
+	runner = newRunner(model)
+	answer, err := runner.Run(ctx, UserMessage("eu-west"), WithSession(restored), WithInvocationID("inv-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer.Status != StatusCompleted || answer.Text() != "deploy the app in eu-west" || model.calls.Load() != 1 {
+		t.Fatalf("want the answer handed to the paused call, got %s %q after %d calls", answer.Status, answer.Text(), model.calls.Load())
+	}
+	if question := pendingQuestion(restored, "inv-1"); question != nil {
+		t.Fatalf("want the question answered, got %q pending", question.Text())
+	}
+	if _, err := runner.Run(ctx, UserMessage("us-east"), WithSession(restored), WithInvocationID("inv-1")); !errors.Is(err, ErrInvocationMismatch) {
+		t.Fatalf("want another input of the answered invocation rejected, got %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package blades
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// WithName sets the name of the Agent, e.g. to tell a clone from its original.
+func WithName(name string) AgentOption {
+	return func(a *agent) {
+		a.name = name
+	}
+}
+
+// WithAddedMiddleware adds middleware after the middleware already set, e.g.
+// to extend the middleware of a clone. WithMiddleware replaces it instead.
+func WithAddedMiddleware(ms ...Middleware) AgentOption {
+	return func(a *agent) {
+		a.middlewares = append(a.middlewares, ms...)
+	}
+}
+
+// CloneAgent returns a new Agent with the configuration of an Agent created by
+// NewAgent and the options applied over it, e.g. a variant on a cheaper model,
+// with extra middleware or another instruction. The original is not changed.
+//
+// The clone copies the slices and maps of the configuration, but shares the
+// values they hold with the original: tools, the tools resolver, the model,
+// middleware and sources are used by both. A new instruction replaces the
+// InstructionSource of the original.
+//
+// The clone keeps the name of the original unless WithName is given; flows
+// fail with ErrDuplicateAgentName on two sub-agents of the same name.
+func CloneAgent(original Agent, opts ...AgentOption) (Agent, error) {
+	o, ok := original.(*agent)
+	if !ok {
+		return nil, fmt.Errorf("clone agent %s: %w", original.Name(), ErrAgentNotCloneable)
+	}
+	a := o.clone()
+	for _, opt := range opts {
+		opt(a)
+	}
+	if a.instruction != o.instruction {
+		a.instructionSource, a.instructionWatch = nil, nil
+		if a.instructionVersion == o.instructionVersion {
+			a.instructionVersion = ""
+		}
+	}
+	if err := a.build(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// clone returns a copy of the configuration of the agent, without its
+// compiled instruction.
+func (a *agent) clone() *agent {
+	c := &agent{
+		name:                 a.name,
+		description:          a.description,
+		instruction:          a.instruction,
+		instructionProvider:  a.instructionProvider,
+		instructionVersion:   a.instructionVersion,
+		templateFuncs:        maps.Clone(a.templateFuncs),
+		templatePartials:     maps.Clone(a.templatePartials),
+		templateStrict:       a.templateStrict,
+		templateSandbox:      a.templateSandbox,
+		instructionFragments: maps.Clone(a.instructionFragments),
+		modelInstructions:    maps.Clone(a.modelInstructions),
+		examples:             slices.Clone(a.examples),
+		exampleFormatter:     a.exampleFormatter,
+		examplesBudget:       a.examplesBudget,
+		outputKey:            a.outputKey,
+		outputJSON:           a.outputJSON,
+		maxIterations:        a.maxIterations,
+		maxContinuations:     a.maxContinuations,
+		candidateSelector:    a.candidateSelector,
+		outputValidators:     slices.Clone(a.outputValidators),
+		outputAttempts:       a.outputAttempts,
+		language:             a.language,
+		outputFormat:         a.outputFormat,
+		confidence:           a.confidence,
+		model:                a.model,
+		modelOptions:         slices.Clone(a.modelOptions),
+		inputSchema:          a.inputSchema,
+		outputSchema:         a.outputSchema,
+		middlewares:          slices.Clone(a.middlewares),
+		tools:                slices.Clone(a.tools),
+		toolsResolver:        a.toolsResolver,
+		resultInterceptors:   slices.Clone(a.resultInterceptors),
+		overflowPolicy:       a.overflowPolicy,
+		tokenCounter:         a.tokenCounter,
+		summarizer:           a.summarizer,
+		redactors:            slices.Clone(a.redactors),
+		promptLogger:         a.promptLogger,
+		logger:               a.logger,
+		strict:               a.strict,
+		configWarnings:       a.configWarnings,
+	}
+	if a.instructionSource != nil {
+		// The clone watches the source for itself, since a signal of the
+		// watch of the original only reaches one of them.
+		WithInstructionsSource(a.instructionSource)(c)
+	}
+	return c
+}
@@ -0,0 +1,122 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// staticAgent is an Agent not created by NewAgent.
+type staticAgent struct{}
+
+func (staticAgent) Name() string        { return "static" }
+func (staticAgent) Description() string { return "" }
+func (staticAgent) Run(ctx context.Context, invocation *Invocation) Generator[*Message, error] {
+	return func(yield func(*Message, error) bool) {}
+}
+
+func TestCloneAgent(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls []string
+	)
+	record := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return HandleFunc(func(ctx context.Context, invocation *Invocation) Generator[*Message, error] {
+				mu.Lock()
+				calls = append(calls, name)
+				mu.Unlock()
+				return next.Handle(ctx, invocation)
+			})
+		}
+	}
+	answer := func(name string) *mockModel {
+		return &mockModel{name: name, generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+			return textResponse(name + ": " + req.Instruction.Text()), nil
+		}}
+	}
+	large, small := answer("large"), answer("small")
+	original, err := NewAgent("assistant",
+		WithModel(large),
+		WithInstruction("Be {{.tone}}."),
+		WithTemplatePartials(map[string]string{"footer": "Thanks."}),
+		WithMiddleware(record("log")),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clone, err := CloneAgent(original,
+		WithName("assistant-cheap"),
+		WithModel(small),
+		WithInstruction(`Be {{.tone}}. {{template "footer"}}`),
+		WithTemplatePartials(map[string]string{"footer": "Bye."}),
+		WithAddedMiddleware(record("guard")),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clone.Name() != "assistant-cheap" || original.Name() != "assistant" {
+		t.Fatalf("names %q and %q", original.Name(), clone.Name())
+	}
+	run := func(agent Agent) string {
+		session := NewSession(map[string]any{"tone": "brief"})
+		output, err := NewRunner(agent).Run(context.Background(), UserMessage("hi"), WithSession(session))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return output.Text()
+	}
+	if got := run(clone); got != "small: Be brief. Bye." {
+		t.Fatalf("clone answered %q", got)
+	}
+	if got := run(original); got != "large: Be brief." {
+		t.Fatalf("original answered %q", got)
+	}
+	if want := []string{"log", "guard", "log"}; !slices.Equal(calls, want) {
+		t.Fatalf("want middleware calls %v, got %v", want, calls)
+	}
+
+	if _, err := CloneAgent(original, WithModel(nil)); !errors.Is(err, ErrModelProviderRequired) {
+		t.Fatalf("want ErrModelProviderRequired, got %v", err)
+	}
+	if _, err := CloneAgent(staticAgent{}); !errors.Is(err, ErrAgentNotCloneable) {
+		t.Fatalf("want ErrAgentNotCloneable, got %v", err)
+	}
+}
+
+func TestCloneAgentInstructionSource(t *testing.T) {
+	source := InstructionSourceFunc(func(ctx context.Context) (string, string, error) {
+		return "From the source.", "v1", nil
+	})
+	model := &mockModel{generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+		return textResponse(req.Instruction.Text()), nil
+	}}
+	original, err := NewAgent("assistant", WithModel(model), WithInstructionsSource(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name string
+		opts []AgentOption
+		want string
+	}{
+		{name: "kept", want: "From the source."},
+		{name: "replaced", opts: []AgentOption{WithInstruction("Overridden.")}, want: "Overridden."},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			clone, err := CloneAgent(original, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			output, err := NewRunner(clone).Run(context.Background(), UserMessage("hi"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := output.Text(); got != tt.want {
+				t.Fatalf("want %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
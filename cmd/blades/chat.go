@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/go-kratos/blades"
+	"github.com/go-kratos/blades/contrib/mcp"
+	"github.com/go-kratos/blades/contrib/openai"
+	"github.com/go-kratos/blades/memory"
+	"github.com/go-kratos/blades/middleware"
+	"github.com/go-kratos/blades/tools"
+	"github.com/spf13/cobra"
+)
+
+// chatOptions holds the flags of the chat command.
+type chatOptions struct {
+	model            string
+	baseURL          string
+	apiKey           string
+	instructionsFile string
+	memory           bool
+	mcpConfig        string
+	history          int
+}
+
+var (
+	chatOpts chatOptions
+	chatCmd  = &cobra.Command{
+		Use:   "chat",
+		Short: "Chat with an agent in the terminal",
+		Long: `Start an interactive chat with an agent.
+
+End a line with "\" to continue it on the next line, or wrap a block in """.
+Commands:
+  /debug             show the report of the last reply and its state diffs
+  /debug on|off      record the session state after each step of the replies
+  /debug json        show the state diffs of the last reply as JSON
+  /dryrun <text>     show the request the text would send, without sending it
+  /reset             start a new session
+  /save <file>       save the transcript as JSON
+  /system <text>     replace the instructions
+  /exit              quit`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runChat(cmd.Context(), chatOpts, cmd.InOrStdin(), cmd.OutOrStdout(), cmd.ErrOrStderr())
+		},
+	}
+)
+
+func init() {
+	chatCmd.Flags().StringVarP(&chatOpts.model, "model", "m", os.Getenv("OPENAI_MODEL"), "Model to chat with")
+	chatCmd.Flags().StringVarP(&chatOpts.baseURL, "base-url", "b", os.Getenv("OPENAI_BASE_URL"), "Base URL for the OpenAI compatible API")
+	chatCmd.Flags().StringVarP(&chatOpts.apiKey, "api-key", "k", os.Getenv("OPENAI_API_KEY"), "API key for the OpenAI compatible API")
+	chatCmd.Flags().StringVarP(&chatOpts.instructionsFile, "instructions", "i", "", "File with the agent instructions")
+	chatCmd.Flags().BoolVar(&chatOpts.memory, "memory", false, "Enable the memory tool; reset sessions are kept as memories")
+	chatCmd.Flags().StringVar(&chatOpts.mcpConfig, "mcp", "", "JSON file with a list of MCP server configs")
+	chatCmd.Flags().IntVar(&chatOpts.history, "history", 50, "Number of session messages sent as history")
+	rootCmd.AddCommand(chatCmd)
+}
+
+// chat is the state of an interactive chat.
+type chat struct {
+	opts        chatOptions
+	model       blades.ModelProvider
+	instruction string
+	tools       []tools.Tool
+	resolver    tools.Resolver
+	memory      *memory.InMemoryStore
+	runner      *blades.Runner
+	session     blades.Session
+	// debug records state snapshots of the replies, and lastRun is the
+	// invocation ID of the last reply, which /debug reports on.
+	debug       bool
+	lastRun     string
+	out, errOut io.Writer
+}
+
+func runChat(ctx context.Context, opts chatOptions, in io.Reader, out, errOut io.Writer) error {
+	if opts.model == "" {
+		return errors.New("chat: a model is required, set --model or OPENAI_MODEL")
+	}
+	c := &chat{
+		opts:    opts,
+		model:   openai.NewModel(opts.model, openai.Config{BaseURL: opts.baseURL, APIKey: opts.apiKey}),
+		session: blades.NewSession(),
+		out:     out,
+		errOut:  errOut,
+	}
+	if opts.instructionsFile != "" {
+		data, err := os.ReadFile(opts.instructionsFile)
+		if err != nil {
+			return fmt.Errorf("chat: read instructions: %w", err)
+		}
+		c.instruction = string(data)
+	}
+	if opts.memory {
+		c.memory = memory.NewInMemoryStore()
+		tool, err := memory.NewMemoryTool(c.memory)
+		if err != nil {
+			return err
+		}
+		c.tools = append(c.tools, tool)
+	}
+	if opts.mcpConfig != "" {
+		resolver, err := loadMCP(opts.mcpConfig)
+		if err != nil {
+			return err
+		}
+		defer resolver.Close()
+		c.resolver = resolver
+	}
+	if err := c.build(); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Chatting with %s. Type /exit to quit.\n", opts.model)
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for {
+		input, ok := readInput(scanner, out)
+		if !ok {
+			return scanner.Err()
+		}
+		if input == "" {
+			continue
+		}
+		if strings.HasPrefix(input, "/") {
+			quit, err := c.command(ctx, input)
+			if err != nil {
+				fmt.Fprintln(errOut, "error:", err)
+			}
+			if quit {
+				return nil
+			}
+			continue
+		}
+		if err := c.send(ctx, input); err != nil {
+			fmt.Fprintln(errOut, "error:", err)
+		}
+	}
+}
+
+// loadMCP reads the MCP server configs and creates a resolver for their tools.
+func loadMCP(path string) (*mcp.ToolsResolver, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("chat: read mcp config: %w", err)
+	}
+	var configs []mcp.ClientConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("chat: parse mcp config: %w", err)
+	}
+	return mcp.NewToolsResolver(configs...)
+}
+
+// build creates the agent and runner from the current instruction and tools.
+func (c *chat) build() error {
+	opts := []blades.AgentOption{
+		blades.WithModel(c.model),
+		blades.WithInstruction(c.instruction),
+		blades.WithTools(spinnerTools(c.errOut, c.tools)...),
+		blades.WithMiddleware(middleware.ConversationBuffered(c.opts.history)),
+	}
+	if c.resolver != nil {
+		opts = append(opts, blades.WithToolsResolver(&spinnerResolver{Resolver: c.resolver, out: c.errOut}))
+	}
+	agent, err := blades.NewAgent("assistant", opts...)
+	if err != nil {
+		return err
+	}
+	c.runner = blades.NewRunner(agent)
+	return nil
+}
+
+// command runs a slash command and reports whether the chat should end.
+func (c *chat) command(ctx context.Context, input string) (bool, error) {
+	name, arg, _ := strings.Cut(input, " ")
+	arg = strings.TrimSpace(arg)
+	switch name {
+	case "/exit", "/quit":
+		return true, nil
+	case "/debug":
+		return false, c.debugCommand(arg)
+	case "/dryrun":
+		if arg == "" {
+			return false, errors.New("usage: /dryrun <text>")
+		}
+		answer, err := c.runner.Run(ctx, blades.UserMessage(arg), blades.WithSession(c.session), blades.DryRun())
+		if err != nil {
+			return false, err
+		}
+		fmt.Fprintln(c.out, answer.Text())
+		if result, ok := answer.Metadata[blades.DryRunKey].(*blades.DryRunResult); ok {
+			tools := make([]string, 0, len(result.Tools))
+			for _, tool := range result.Tools {
+				tools = append(tools, tool.Name)
+			}
+			fmt.Fprintf(c.out, "~%d tokens (instruction %d, messages %d, tools %d); tools: %s\n",
+				result.Tokens(), result.InstructionTokens, result.MessageTokens, result.ToolTokens, strings.Join(tools, ", "))
+		}
+	case "/reset":
+		if c.memory != nil {
+			if err := c.memory.SaveSession(ctx, c.session); err != nil {
+				return false, err
+			}
+		}
+		c.session = blades.NewSession()
+		fmt.Fprintln(c.out, "Started a new session.")
+	case "/save":
+		if arg == "" {
+			return false, errors.New("usage: /save <file>")
+		}
+		data, err := json.MarshalIndent(c.session.History(), "", "  ")
+		if err != nil {
+			return false, err
+		}
+		if err := os.WriteFile(arg, data, 0644); err != nil {
+			return false, err
+		}
+		fmt.Fprintf(c.out, "Saved %d messages to %s.\n", len(c.session.History()), arg)
+	case "/system":
+		previous := c.instruction
+		c.instruction = arg
+		if err := c.build(); err != nil {
+			c.instruction = previous
+			return false, err
+		}
+		fmt.Fprintln(c.out, "Updated the instructions.")
+	default:
+		return false, fmt.Errorf("unknown command %s", name)
+	}
+	return false, nil
+}
+
+// debugCommand toggles the state snapshots or shows the report of the last reply.
+func (c *chat) debugCommand(arg string) error {
+	switch arg {
+	case "on", "off":
+		c.debug = arg == "on"
+		fmt.Fprintf(c.out, "State snapshots are %s.\n", arg)
+		return nil
+	case "", "json":
+	default:
+		return errors.New("usage: /debug [on|off|json]")
+	}
+	report, ok := c.runner.Report(c.lastRun)
+	if !ok {
+		return errors.New("no reply to report on yet")
+	}
+	if arg == "json" {
+		data, err := report.StateDiffsJSON()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(c.out, string(data))
+		return nil
+	}
+	if err := report.Render(c.out); err != nil {
+		return err
+	}
+	if len(report.Snapshots) == 0 {
+		fmt.Fprintln(c.out, "No state snapshots; turn them on with /debug on.")
+		return nil
+	}
+	fmt.Fprintln(c.out)
+	return report.RenderStateDiffs(c.out)
+}
+
+// send streams the reply to the input; Ctrl-C interrupts the reply, not the chat.
+func (c *chat) send(ctx context.Context, input string) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	c.lastRun = blades.NewInvocationID()
+	opts := []blades.RunOption{blades.WithSession(c.session), blades.WithInvocationID(c.lastRun)}
+	if c.debug {
+		opts = append(opts, blades.WithStateSnapshots())
+	}
+	streamed := false
+	for message, err := range c.runner.RunStream(ctx, blades.UserMessage(input), opts...) {
+		if err != nil {
+			if streamed {
+				fmt.Fprintln(c.out)
+			}
+			return err
+		}
+		if message.Role != blades.RoleAssistant {
+			continue
+		}
+		switch message.Status {
+		case blades.StatusIncomplete:
+			fmt.Fprint(c.out, message.Text())
+			streamed = true
+		case blades.StatusCompleted:
+			if !streamed {
+				fmt.Fprint(c.out, message.Text())
+			}
+			fmt.Fprintln(c.out)
+			streamed = false
+		}
+	}
+	return nil
+}
+
+// readInput reads one prompt, joining lines that end with "\" and """ blocks.
+func readInput(scanner *bufio.Scanner, out io.Writer) (string, bool) {
+	var (
+		lines []string
+		block bool
+	)
+	fmt.Fprint(out, "> ")
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.TrimSpace(line) == `"""`:
+			if block {
+				return strings.Join(lines, "\n"), true
+			}
+			block = true
+		case block:
+			lines = append(lines, line)
+		case strings.HasSuffix(line, `\`):
+			lines = append(lines, strings.TrimSuffix(line, `\`))
+		default:
+			lines = append(lines, line)
+			return strings.TrimSpace(strings.Join(lines, "\n")), true
+		}
+		fmt.Fprint(out, ". ")
+	}
+	return "", false
+}
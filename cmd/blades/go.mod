@@ -0,0 +1,32 @@
+module github.com/go-kratos/blades/cmd/blades
+
+go 1.24.0
+
+replace (
+	github.com/go-kratos/blades => ../..
+	github.com/go-kratos/blades/contrib/mcp => ../../contrib/mcp
+	github.com/go-kratos/blades/contrib/openai => ../../contrib/openai
+)
+
+require (
+	github.com/go-kratos/blades v0.0.0
+	github.com/go-kratos/blades/contrib/mcp v0.0.0
+	github.com/go-kratos/blades/contrib/openai v0.0.0
+	github.com/spf13/cobra v1.10.1
+)
+
+require (
+	github.com/go-kratos/kit v0.0.0-20251121083925-65298ad2aa44 // indirect
+	github.com/google/jsonschema-go v0.3.0 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/inconshreveable/mousetrap v1.1.0 // indirect
+	github.com/modelcontextprotocol/go-sdk v1.0.0 // indirect
+	github.com/openai/openai-go/v3 v3.8.1 // indirect
+	github.com/spf13/pflag v1.0.9 // indirect
+	github.com/tidwall/gjson v1.18.0 // indirect
+	github.com/tidwall/match v1.2.0 // indirect
+	github.com/tidwall/pretty v1.2.1 // indirect
+	github.com/tidwall/sjson v1.2.5 // indirect
+	github.com/yosida95/uritemplate/v3 v3.0.2 // indirect
+	golang.org/x/sync v0.17.0 // indirect
+)
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"log"
+
+	"github.com/spf13/cobra"
+)
+
+var rootCmd = &cobra.Command{
+	Use:   "blades",
+	Short: "Blades command line tools",
+	Long:  `A set of tools to run and try out Blades agents`,
+}
+
+func main() {
+	if err := rootCmd.Execute(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/go-kratos/blades/tools"
+)
+
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// spin shows a spinner with the label until the returned func is called.
+func spin(out io.Writer, label string) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for i := 0; ; i++ {
+			fmt.Fprintf(out, "\r%s %s", spinnerFrames[i%len(spinnerFrames)], label)
+			select {
+			case <-ticker.C:
+			case <-done:
+				fmt.Fprint(out, "\r\033[K")
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// spinnerTool shows a spinner while the tool runs.
+type spinnerTool struct {
+	tools.Tool
+	out io.Writer
+}
+
+func (t *spinnerTool) Handle(ctx context.Context, input string) (string, error) {
+	stop := spin(t.out, "calling "+t.Name())
+	defer stop()
+	return t.Tool.Handle(ctx, input)
+}
+
+func spinnerTools(out io.Writer, ts []tools.Tool) []tools.Tool {
+	wrapped := make([]tools.Tool, 0, len(ts))
+	for _, t := range ts {
+		wrapped = append(wrapped, &spinnerTool{Tool: t, out: out})
+	}
+	return wrapped
+}
+
+// spinnerResolver wraps the resolved tools with spinners.
+type spinnerResolver struct {
+	tools.Resolver
+	out io.Writer
+}
+
+func (r *spinnerResolver) Resolve(ctx context.Context) ([]tools.Tool, error) {
+	ts, err := r.Resolver.Resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return spinnerTools(r.out, ts), nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"strings"
+)
+
+// segment is a part of a markdown document. Verbatim segments, such as front
+// matter and fenced code blocks, are copied to the output untouched.
+type segment struct {
+	text     string
+	verbatim bool
+}
+
+// splitMarkdown splits a markdown document into prose chunks of at most size
+// bytes, cut at headings and then at blank lines, and verbatim segments.
+// Joining the text of all segments gives back the document.
+func splitMarkdown(content string, size int) []segment {
+	var (
+		segments []segment
+		prose    []string
+		section  strings.Builder
+	)
+	flushSection := func() {
+		if section.Len() > 0 {
+			prose = append(prose, section.String())
+			section.Reset()
+		}
+	}
+	flushProse := func() {
+		flushSection()
+		for _, chunk := range packChunks(prose, size) {
+			segments = append(segments, segment{text: chunk})
+		}
+		prose = nil
+	}
+	lines := strings.SplitAfter(content, "\n")
+	i := 0
+	// Front matter must open the document.
+	if len(lines) > 0 && strings.TrimSpace(lines[0]) == "---" {
+		for j := 1; j < len(lines); j++ {
+			if strings.TrimSpace(lines[j]) == "---" {
+				segments = append(segments, segment{text: strings.Join(lines[:j+1], ""), verbatim: true})
+				i = j + 1
+				break
+			}
+		}
+	}
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		if fence := codeFence(trimmed); fence != "" {
+			flushProse()
+			block := []string{line}
+			for i++; i < len(lines); i++ {
+				block = append(block, lines[i])
+				if strings.HasPrefix(strings.TrimSpace(lines[i]), fence) {
+					break
+				}
+			}
+			segments = append(segments, segment{text: strings.Join(block, ""), verbatim: true})
+			continue
+		}
+		if strings.HasPrefix(trimmed, "#") {
+			flushSection()
+		}
+		section.WriteString(line)
+	}
+	flushProse()
+	return segments
+}
+
+// codeFence returns the fence that opens a code block on the line, if any.
+func codeFence(line string) string {
+	for _, fence := range []string{"```", "~~~"} {
+		if strings.HasPrefix(line, fence) {
+			return fence
+		}
+	}
+	return ""
+}
+
+// packChunks groups consecutive sections into chunks of at most size bytes.
+// Sections larger than size are split at blank lines.
+func packChunks(sections []string, size int) []string {
+	var (
+		chunks  []string
+		current strings.Builder
+	)
+	add := func(part string) {
+		if current.Len() > 0 && current.Len()+len(part) > size {
+			chunks = append(chunks, current.String())
+			current.Reset()
+		}
+		current.WriteString(part)
+	}
+	for _, section := range sections {
+		if len(section) <= size {
+			add(section)
+			continue
+		}
+		for _, paragraph := range strings.SplitAfter(section, "\n\n") {
+			if paragraph != "" {
+				add(paragraph)
+			}
+		}
+	}
+	if current.Len() > 0 {
+		chunks = append(chunks, current.String())
+	}
+	return chunks
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitMarkdown(t *testing.T) {
+	content := "---\ntitle: 文档\n---\n# 标题\n\n介绍。\n\n```go\n// 注释\nfunc main() {}\n```\n## 用法\n\n第一段。\n\n第二段。\n"
+	segments := splitMarkdown(content, 24)
+	var (
+		joined   strings.Builder
+		verbatim []string
+		prose    int
+	)
+	for _, s := range segments {
+		joined.WriteString(s.text)
+		if s.verbatim {
+			verbatim = append(verbatim, s.text)
+			continue
+		}
+		prose++
+		if strings.Contains(s.text, "```") || strings.Contains(s.text, "title:") {
+			t.Fatalf("code or front matter in a prose chunk: %q", s.text)
+		}
+	}
+	if joined.String() != content {
+		t.Fatalf("segments do not reassemble the document:\n%q", joined.String())
+	}
+	if len(verbatim) != 2 || !strings.HasPrefix(verbatim[0], "---") || !strings.HasPrefix(verbatim[1], "```go") {
+		t.Fatalf("unexpected verbatim segments: %q", verbatim)
+	}
+	if prose < 3 {
+		t.Fatalf("expected the prose to be split into chunks, got %d", prose)
+	}
+}
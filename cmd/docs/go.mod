@@ -6,6 +6,7 @@ require (
 	github.com/go-kratos/blades v0.2.0
 	github.com/go-kratos/blades/contrib/openai v0.2.0
 	github.com/spf13/cobra v1.10.1
+	golang.org/x/sync v0.18.0
 )
 
 require (
@@ -18,5 +19,4 @@ require (
 	github.com/tidwall/match v1.2.0 // indirect
 	github.com/tidwall/pretty v1.2.1 // indirect
 	github.com/tidwall/sjson v1.2.5 // indirect
-	golang.org/x/sync v0.18.0 // indirect
 )
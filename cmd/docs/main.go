@@ -8,11 +8,15 @@ import (
 )
 
 var (
-	to      string
-	model   string
-	baseURL string
-	apiKey  string
-	output  string
+	to          string
+	model       string
+	baseURL     string
+	apiKey      string
+	output      string
+	glossary    string
+	stateFile   string
+	concurrency int
+	chunkSize   int
 )
 
 var (
@@ -23,8 +27,8 @@ var (
 	}
 	translateCmd = &cobra.Command{
 		Use:   "translate",
-		Short: "Translate markdown file",
-		Long:  `Translate markdown file using OpenAI API`,
+		Short: "Translate markdown files",
+		Long:  `Translate a markdown file, or all markdown files in a directory, using OpenAI API`,
 		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			if err := translate(args[0]); err != nil {
@@ -40,6 +44,10 @@ func init() {
 	translateCmd.Flags().StringVarP(&model, "model", "m", os.Getenv("OPENAI_MODEL"), "OpenAI model to use for translation")
 	translateCmd.Flags().StringVarP(&baseURL, "base-url", "b", os.Getenv("OPENAI_BASE_URL"), "Base URL for OpenAI API")
 	translateCmd.Flags().StringVarP(&apiKey, "api-key", "k", os.Getenv("OPENAI_API_KEY"), "API key for OpenAI")
+	translateCmd.Flags().StringVarP(&glossary, "glossary", "g", "", "Glossary file with \"term = translation\" lines")
+	translateCmd.Flags().StringVarP(&stateFile, "state", "s", ".translate-state.json", "State file used to skip unchanged files; empty disables it")
+	translateCmd.Flags().IntVarP(&concurrency, "concurrency", "c", 4, "Number of files translated concurrently")
+	translateCmd.Flags().IntVar(&chunkSize, "chunk-size", 8000, "Maximum size in bytes of a markdown chunk sent to the model")
 	rootCmd.AddCommand(translateCmd)
 }
 
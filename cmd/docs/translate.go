@@ -1,19 +1,54 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 
 	"github.com/go-kratos/blades"
 	"github.com/go-kratos/blades/contrib/openai"
+	"golang.org/x/sync/errgroup"
 )
 
+const translateInstructions = `You are a professional technical translator.
+	Please translate the following Markdown document into **{{.target_language}}**.
+	Follow these strict rules:
+	1. **Preserve all Markdown formatting**, including headings, bold/italic text, lists, quotes, tables, code blocks, links, and images.
+	2. **Do not translate code**, filenames, paths, variable names, commands, URLs, or HTML tags.
+	3. **Keep technical terms consistent** (e.g., API, SDK, Server, Client — keep them untranslated when appropriate).
+	4. The translation should be **natural, accurate, and professional**.
+	5. **Keep the same paragraph structure and line breaks** as in the original.
+	6. For mixed-language content, maintain logical consistency.
+	7. Output **only the translated Markdown document** — do not add explanations, comments, or extra text.`
+
+// translator translates markdown files, skipping those unchanged since the last run.
+type translator struct {
+	agent blades.Agent
+	// digest identifies the settings that affect the output, so that changing
+	// the target language or glossary translates the files again.
+	digest string
+	mu     sync.Mutex
+	state  map[string]string
+}
+
 func translate(from string) error {
-	content, err := os.ReadFile(from)
+	glossaryText, err := loadGlossary(glossary)
 	if err != nil {
 		return err
 	}
+	instructions := translateInstructions
+	if glossaryText != "" {
+		instructions += "\n\tUse exactly these translations for the following terms:\n" + glossaryText
+	}
 	provider := openai.NewModel(model, openai.Config{
 		BaseURL: baseURL,
 		APIKey:  apiKey,
@@ -21,35 +56,190 @@ func translate(from string) error {
 	agent, err := blades.NewAgent(
 		"Document translator",
 		blades.WithModel(provider),
-		blades.WithInstructions(`You are a professional technical translator.
-	Please translate the following Markdown document into **{{.target_language}}**.
-	Follow these strict rules:
-	1. **Preserve all Markdown formatting**, including headings, bold/italic text, lists, quotes, tables, code blocks, links, and images.
-	2. **Do not translate code**, filenames, paths, variable names, commands, URLs, or HTML tags.
-	3. **Keep technical terms consistent** (e.g., API, SDK, Server, Client — keep them untranslated when appropriate).
-	4. The translation should be **natural, accurate, and professional**.
-	5. **Keep the same paragraph structure and line breaks** as in the original.
-	6. For mixed-language content, maintain logical consistency.
-	7. Output **only the translated Markdown document** — do not add explanations, comments, or extra text.`),
+		blades.WithInstructions(instructions),
 	)
 	if err != nil {
 		return err
 	}
+	t := &translator{
+		agent:  agent,
+		digest: hash(to, glossaryText),
+		state:  make(map[string]string),
+	}
+	if err := t.loadState(); err != nil {
+		return err
+	}
+	files, err := markdownFiles(from)
+	if err != nil {
+		return err
+	}
+	eg, ctx := errgroup.WithContext(context.Background())
+	eg.SetLimit(max(concurrency, 1))
+	for src, dst := range files {
+		eg.Go(func() error {
+			return t.translateFile(ctx, src, dst)
+		})
+	}
+	err = eg.Wait()
+	// Keep the state of the files translated so far, even if some failed.
+	if serr := t.saveState(); serr != nil && err == nil {
+		err = serr
+	}
+	return err
+}
+
+// markdownFiles maps the markdown files under from to their output paths,
+// preserving the directory structure when from is a directory.
+func markdownFiles(from string) (map[string]string, error) {
+	info, err := os.Stat(from)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return map[string]string{from: translateOutput(from, output)}, nil
+	}
+	files := make(map[string]string)
+	err = filepath.WalkDir(from, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.EqualFold(filepath.Ext(path), ".md") {
+			return nil
+		}
+		rel, err := filepath.Rel(from, path)
+		if err != nil {
+			return err
+		}
+		files[path] = filepath.Join(output, rel)
+		return nil
+	})
+	return files, err
+}
+
+// translateFile translates src chunk by chunk into dst.
+func (t *translator) translateFile(ctx context.Context, src, dst string) error {
+	content, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	sum := hash(t.digest, string(content))
+	if t.unchanged(src, sum) {
+		if _, err := os.Stat(dst); err == nil {
+			log.Printf("skip %s: unchanged", src)
+			return nil
+		}
+	}
+	var result strings.Builder
+	for _, s := range splitMarkdown(string(content), chunkSize) {
+		if s.verbatim || strings.TrimSpace(s.text) == "" {
+			result.WriteString(s.text)
+			continue
+		}
+		translated, err := t.translateChunk(ctx, s.text)
+		if err != nil {
+			return fmt.Errorf("translate %s: %w", src, err)
+		}
+		result.WriteString(translated)
+	}
+	if dir := filepath.Dir(dst); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(dst, []byte(result.String()), 0644); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	t.state[src] = sum
+	t.mu.Unlock()
+	log.Printf("translated %s -> %s", src, dst)
+	return nil
+}
+
+// translateChunk translates a prose chunk, keeping its surrounding whitespace.
+func (t *translator) translateChunk(ctx context.Context, chunk string) (string, error) {
+	trimmed := strings.TrimSpace(chunk)
+	start := strings.Index(chunk, trimmed)
 	session := blades.NewSession(map[string]any{
 		"target_language": to,
 	})
-	runner := blades.NewRunner(agent, blades.WithSession(session))
-	result, err := runner.Run(context.Background(), blades.UserMessage(string(content)))
+	runner := blades.NewRunner(t.agent, blades.WithSession(session))
+	result, err := runner.Run(ctx, blades.UserMessage(trimmed))
+	if err != nil {
+		return "", err
+	}
+	return chunk[:start] + strings.TrimSpace(result.Text()) + chunk[start+len(trimmed):], nil
+}
+
+func (t *translator) unchanged(src, sum string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.state[src] == sum
+}
+
+// loadState reads the source hashes of the previous run.
+func (t *translator) loadState() error {
+	if stateFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(stateFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
 	if err != nil {
 		return err
 	}
-	dir, _ := filepath.Split(translateOutput(from, output))
-	if _, err = os.Stat(dir); os.IsNotExist(err) && dir != "" {
-		if err = os.MkdirAll(dir, 0755); err != nil {
-			return err
+	return json.Unmarshal(data, &t.state)
+}
+
+// saveState writes the source hashes of the translated files.
+func (t *translator) saveState() error {
+	if stateFile == "" {
+		return nil
+	}
+	t.mu.Lock()
+	data, err := json.MarshalIndent(t.state, "", "  ")
+	t.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(stateFile, data, 0644)
+}
+
+// loadGlossary reads "term = translation" lines and formats them for the instructions.
+// Empty lines and lines starting with # are ignored.
+func loadGlossary(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	var buf strings.Builder
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		term, translation, ok := strings.Cut(text, "=")
+		if !ok {
+			return "", fmt.Errorf("glossary %s:%d: expected \"term = translation\"", path, line)
 		}
+		fmt.Fprintf(&buf, "\t- %s → %s\n", strings.TrimSpace(term), strings.TrimSpace(translation))
+	}
+	return buf.String(), scanner.Err()
+}
+
+func hash(parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
 	}
-	return os.WriteFile(translateOutput(from, output), []byte(result.Text()), 0644)
+	return hex.EncodeToString(h.Sum(nil))
 }
 
 func translateOutput(from, output string) string {
@@ -0,0 +1,228 @@
+package blades
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// OverloadedError is returned when a run is rejected because the queue of its
+// Limiter is full. It unwraps to ErrOverloaded.
+type OverloadedError struct {
+	// Limit is the number of runs the Limiter admits at once, and Queued the
+	// number of runs waiting for a slot.
+	Limit  int
+	Queued int
+}
+
+func (e *OverloadedError) Error() string {
+	return fmt.Sprintf("%s: %d runs in flight and %d queued", ErrOverloaded, e.Limit, e.Queued)
+}
+
+// Unwrap returns ErrOverloaded.
+func (e *OverloadedError) Unwrap() error {
+	return ErrOverloaded
+}
+
+// DefaultMaxStarvation is how long a run waits for a slot of a Limiter at
+// most before it is admitted ahead of the runs of higher priorities.
+const DefaultMaxStarvation = 30 * time.Second
+
+// LimiterEvent describes the admission of a run by a Limiter.
+type LimiterEvent struct {
+	// Priority is the priority the run waited with.
+	Priority Priority
+	// Wait is how long the run waited for a slot.
+	Wait time.Duration
+	// InFlight and Queued are the runs holding and waiting for a slot once
+	// the run was admitted, rejected or gave up.
+	InFlight int
+	Queued   int
+	// Err is ErrOverloaded if the run was rejected, or the cause of its
+	// context if it gave up waiting; nil once admitted.
+	Err error
+}
+
+// LimiterObserver is called with every admission of a Limiter, e.g. to record
+// the queue depth and wait time as metrics.
+type LimiterObserver func(ctx context.Context, event LimiterEvent)
+
+// LimiterOption configures a Limiter.
+type LimiterOption func(*Limiter)
+
+// WithMaxQueue rejects runs with an *OverloadedError once n runs are waiting
+// for a slot, so that callers can shed load. With 0, runs are rejected as
+// soon as every slot is taken. By default the queue is unbounded.
+func WithMaxQueue(n int) LimiterOption {
+	return func(l *Limiter) {
+		l.maxQueue = n
+	}
+}
+
+// WithLimiterObserver adds an observer of the admissions of the Limiter.
+func WithLimiterObserver(observer LimiterObserver) LimiterOption {
+	return func(l *Limiter) {
+		l.observers = append(l.observers, observer)
+	}
+}
+
+// WithMaxStarvation bounds how long a run of a low priority waits behind the
+// runs of higher priorities: once the longest waiting run waited for d, it
+// is admitted next whatever its priority. With 0, runs are admitted in
+// arrival order. Defaults to DefaultMaxStarvation.
+func WithMaxStarvation(d time.Duration) LimiterOption {
+	return func(l *Limiter) {
+		l.maxStarvation = d
+	}
+}
+
+// Limiter caps the number of runs in flight across the Runners it is passed
+// to, e.g. to protect a single provider account from a traffic spike. Runs
+// beyond the cap wait for a slot until their context is done; the runs of
+// the highest priority, read with PriorityFromContext, are admitted first,
+// in arrival order.
+type Limiter struct {
+	limit         int
+	maxQueue      int
+	maxStarvation time.Duration
+	observers     []LimiterObserver
+	mu            sync.Mutex
+	inFlight      int
+	// waiters are the runs waiting for a slot, in arrival order.
+	waiters []*limiterWaiter
+}
+
+// limiterWaiter is a run waiting for a slot; ready is closed once it holds one.
+type limiterWaiter struct {
+	priority Priority
+	queued   time.Time
+	ready    chan struct{}
+}
+
+// NewLimiter creates a Limiter admitting n runs at once; values below 1 are treated as 1.
+func NewLimiter(n int, opts ...LimiterOption) *Limiter {
+	l := &Limiter{limit: max(n, 1), maxQueue: -1, maxStarvation: DefaultMaxStarvation}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Limit returns the number of runs the Limiter admits at once.
+func (l *Limiter) Limit() int {
+	return l.limit
+}
+
+// InFlight returns the number of runs holding a slot.
+func (l *Limiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight
+}
+
+// Queued returns the number of runs waiting for a slot.
+func (l *Limiter) Queued() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.waiters)
+}
+
+// Acquire waits for a slot and returns the func that frees it. It fails with
+// an *OverloadedError when the queue is full, or with the cause of ctx if
+// it is done first.
+func (l *Limiter) Acquire(ctx context.Context) (func(), error) {
+	started := time.Now()
+	priority := PriorityFromContext(ctx)
+	l.mu.Lock()
+	if l.inFlight < l.limit && len(l.waiters) == 0 {
+		l.inFlight++
+		l.mu.Unlock()
+		return l.admitted(ctx, priority, started), nil
+	}
+	if l.maxQueue >= 0 && len(l.waiters) >= l.maxQueue {
+		err := &OverloadedError{Limit: l.limit, Queued: len(l.waiters)}
+		inFlight := l.inFlight
+		l.mu.Unlock()
+		l.observe(ctx, LimiterEvent{Priority: priority, InFlight: inFlight, Queued: err.Queued, Err: err})
+		return nil, err
+	}
+	w := &limiterWaiter{priority: priority, queued: started, ready: make(chan struct{})}
+	l.waiters = append(l.waiters, w)
+	l.mu.Unlock()
+	select {
+	case <-w.ready:
+		return l.admitted(ctx, priority, started), nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		i := slices.Index(l.waiters, w)
+		if i >= 0 {
+			l.waiters = slices.Delete(l.waiters, i, i+1)
+		}
+		inFlight, queued := l.inFlight, len(l.waiters)
+		l.mu.Unlock()
+		if i < 0 {
+			// The run was handed a slot while giving up.
+			l.release()
+		}
+		err := context.Cause(ctx)
+		l.observe(ctx, LimiterEvent{Priority: priority, Wait: time.Since(started), InFlight: inFlight, Queued: queued, Err: err})
+		return nil, err
+	}
+}
+
+// admitted reports the admission of a run and returns the func that frees its slot.
+func (l *Limiter) admitted(ctx context.Context, priority Priority, started time.Time) func() {
+	l.mu.Lock()
+	inFlight, queued := l.inFlight, len(l.waiters)
+	l.mu.Unlock()
+	l.observe(ctx, LimiterEvent{Priority: priority, Wait: time.Since(started), InFlight: inFlight, Queued: queued})
+	var once sync.Once
+	return func() {
+		once.Do(l.release)
+	}
+}
+
+// release hands the slot of a finished run to the next waiting run, or frees it.
+func (l *Limiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.waiters) == 0 {
+		l.inFlight--
+		return
+	}
+	next := 0
+	if time.Since(l.waiters[0].queued) < l.maxStarvation {
+		for i, w := range l.waiters {
+			if w.priority > l.waiters[next].priority {
+				next = i
+			}
+		}
+	}
+	close(l.waiters[next].ready)
+	l.waiters = slices.Delete(l.waiters, next, next+1)
+}
+
+func (l *Limiter) observe(ctx context.Context, event LimiterEvent) {
+	for _, observer := range l.observers {
+		observer(ctx, event)
+	}
+}
+
+// WithConcurrencyLimit caps the number of runs of the Runner in flight at n;
+// further runs wait for a slot. It is a shorthand for WithLimiter(NewLimiter(n)).
+func WithConcurrencyLimit(n int) RunnerOption {
+	return WithLimiter(NewLimiter(n))
+}
+
+// WithLimiter sets the Limiter that admits the runs of the Runner, which may
+// be shared with other Runners to cap their runs together. A run takes a
+// slot before its input is recorded in the session and frees it once its
+// stream ends; dry runs, collapsed duplicates and replayed idempotency keys
+// take none.
+func WithLimiter(limiter *Limiter) RunnerOption {
+	return func(r *Runner) {
+		r.limiter = limiter
+	}
+}
@@ -0,0 +1,271 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingModel answers once released, reporting each call on started.
+func blockingModel(started chan<- string, release <-chan struct{}) *mockModel {
+	return &mockModel{generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+		started <- req.Messages[len(req.Messages)-1].Text()
+		select {
+		case <-release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		return textResponse("done"), nil
+	}}
+}
+
+func TestConcurrencyLimitShared(t *testing.T) {
+	started := make(chan string, 4)
+	release := make(chan struct{})
+	agent, err := NewAgent("worker", WithModel(blockingModel(started, release)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		mu     sync.Mutex
+		events []LimiterEvent
+	)
+	limiter := NewLimiter(1, WithLimiterObserver(func(ctx context.Context, event LimiterEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}))
+	first, second := NewRunner(agent, WithLimiter(limiter)), NewRunner(agent, WithLimiter(limiter))
+	waiting := NewSession()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if _, err := first.Run(context.Background(), UserMessage("one")); err != nil {
+			t.Error(err)
+		}
+	}()
+	<-started
+	go func() {
+		defer wg.Done()
+		if _, err := second.Run(context.Background(), UserMessage("two"), WithSession(waiting)); err != nil {
+			t.Error(err)
+		}
+	}()
+	for limiter.Queued() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case input := <-started:
+		t.Fatalf("want %q to wait for a slot", input)
+	case <-time.After(20 * time.Millisecond):
+	}
+	if n := len(waiting.History()); n != 0 {
+		t.Fatalf("want the queued input not recorded yet, got %d messages", n)
+	}
+	release <- struct{}{}
+	if input := <-started; input != "two" {
+		t.Fatalf("want the queued run admitted, got %q", input)
+	}
+	close(release)
+	wg.Wait()
+
+	if limiter.InFlight() != 0 || limiter.Queued() != 0 {
+		t.Fatalf("want every slot freed, got %d in flight and %d queued", limiter.InFlight(), limiter.Queued())
+	}
+	if len(events) != 2 || events[0].Wait > events[1].Wait || events[1].Wait < 20*time.Millisecond || events[1].Err != nil {
+		t.Fatalf("want the wait of the queued run observed, got %+v", events)
+	}
+}
+
+func TestConcurrencyLimitOverloaded(t *testing.T) {
+	started := make(chan string, 2)
+	release := make(chan struct{})
+	agent, err := NewAgent("worker", WithModel(blockingModel(started, release)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := NewRunner(agent, WithLimiter(NewLimiter(1, WithMaxQueue(0))))
+	done := make(chan error)
+	go func() {
+		_, err := runner.Run(context.Background(), UserMessage("one"))
+		done <- err
+	}()
+	<-started
+	session := NewSession()
+	_, err = runner.Run(context.Background(), UserMessage("two"), WithSession(session))
+	var overloaded *OverloadedError
+	if !errors.As(err, &overloaded) || !errors.Is(err, ErrOverloaded) || overloaded.Limit != 1 {
+		t.Fatalf("want an OverloadedError, got %v", err)
+	}
+	if status := HTTPStatus(err); status != http.StatusServiceUnavailable {
+		t.Fatalf("want status 503, got %d", status)
+	}
+	if n := len(session.History()); n != 0 {
+		t.Fatalf("want the rejected input not recorded, got %d messages", n)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConcurrencyLimitCancel(t *testing.T) {
+	limiter := NewLimiter(1)
+	release, err := limiter.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want the wait to end with the context, got %v", err)
+	}
+	if limiter.Queued() != 0 {
+		t.Fatalf("want the cancelled run dequeued, got %d", limiter.Queued())
+	}
+	release()
+	release()
+	if limiter.InFlight() != 0 {
+		t.Fatalf("want the slot freed once, got %d in flight", limiter.InFlight())
+	}
+}
+
+// acquireIn acquires a slot of the limiter in the background with the
+// priority, holding it for hold, and sends its name once admitted.
+func acquireIn(limiter *Limiter, priority Priority, name string, hold time.Duration, admitted chan<- string) {
+	go func() {
+		release, err := limiter.Acquire(NewPriorityContext(context.Background(), priority))
+		if err != nil {
+			return
+		}
+		admitted <- name
+		time.Sleep(hold)
+		release()
+	}()
+}
+
+func TestLimiterPriority(t *testing.T) {
+	limiter := NewLimiter(1)
+	release, err := limiter.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	admitted := make(chan string, 4)
+	for i, priority := range []Priority{PriorityLow, PriorityNormal, PriorityLow, PriorityHigh} {
+		acquireIn(limiter, priority, fmt.Sprintf("%s-%d", priority, i), 0, admitted)
+		for limiter.Queued() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	release()
+	var order []string
+	for range 4 {
+		order = append(order, <-admitted)
+	}
+	if want := []string{"high-3", "normal-1", "low-0", "low-2"}; !slices.Equal(order, want) {
+		t.Fatalf("want admissions %v, got %v", want, order)
+	}
+}
+
+func TestLimiterMaxStarvation(t *testing.T) {
+	limiter := NewLimiter(1, WithMaxStarvation(20*time.Millisecond))
+	release, err := limiter.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	admitted := make(chan string, 2)
+	acquireIn(limiter, PriorityLow, "low", 0, admitted)
+	time.Sleep(30 * time.Millisecond)
+	acquireIn(limiter, PriorityHigh, "high", 0, admitted)
+	for limiter.Queued() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	release()
+	if first := <-admitted; first != "low" {
+		t.Fatalf("want the starved run admitted first, got %s", first)
+	}
+	<-admitted
+}
+
+// TestLimiterPriorityLatency saturates a limiter with background runs and
+// checks that interactive runs wait for about one run, not for the queue.
+func TestLimiterPriorityLatency(t *testing.T) {
+	const hold = 5 * time.Millisecond
+	var (
+		mu    sync.Mutex
+		waits = make(map[Priority][]time.Duration)
+	)
+	limiter := NewLimiter(2, WithLimiterObserver(func(ctx context.Context, event LimiterEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		waits[event.Priority] = append(waits[event.Priority], event.Wait)
+	}))
+	admitted := make(chan string, 100)
+	for i := range 80 {
+		acquireIn(limiter, PriorityLow, fmt.Sprint("low-", i), hold, admitted)
+	}
+	for limiter.Queued() < 70 {
+		time.Sleep(time.Millisecond)
+	}
+	for i := range 5 {
+		release, err := limiter.Acquire(NewPriorityContext(context.Background(), PriorityHigh))
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(hold)
+		release()
+		if i == 0 && limiter.Queued() < 50 {
+			t.Fatalf("want the limiter saturated, got %d queued", limiter.Queued())
+		}
+	}
+	for range 80 {
+		<-admitted
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	// A background run waits for the queue ahead of it, about 80*hold/2.
+	if slowest := slices.Max(waits[PriorityLow]); slowest < 20*hold {
+		t.Fatalf("want the background runs queued, the slowest waited %v", slowest)
+	}
+	for _, wait := range waits[PriorityHigh] {
+		if wait > 10*hold {
+			t.Fatalf("want the interactive runs admitted within about one run, got %v", waits[PriorityHigh])
+		}
+	}
+}
+
+func TestJobRunnerPriority(t *testing.T) {
+	agent, err := NewAgent("worker", WithModel(&mockModel{generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+		return textResponse("done"), nil
+	}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	priorities := make(chan Priority, 3)
+	runner := NewRunner(agent, WithLimiter(NewLimiter(1, WithLimiterObserver(func(ctx context.Context, event LimiterEvent) {
+		priorities <- event.Priority
+	}))))
+	jobs := NewJobRunner(runner)
+	for _, opts := range [][]RunOption{nil, {WithPriority(PriorityHigh)}} {
+		id, err := jobs.Submit(context.Background(), UserMessage("batch"), opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		waitJobStatus(t, jobs, id, JobCompleted)
+	}
+	if _, err := runner.Run(context.Background(), UserMessage("chat")); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []Priority{PriorityLow, PriorityHigh, PriorityNormal} {
+		if got := <-priorities; got != want {
+			t.Fatalf("want priority %s, got %s", want, got)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package blades
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+// ConfidenceMode is how an agent estimates its confidence in its answers.
+type ConfidenceMode string
+
+const (
+	// ConfidenceLogprobs maps the average token log probability of the
+	// answer, reported by the provider under AverageLogprobKey, to the
+	// probability of an average token. It needs a model that returns log
+	// probabilities; see ModelCapabilities.Logprobs.
+	ConfidenceLogprobs ConfidenceMode = "logprobs"
+	// ConfidenceSelfAssessment asks the model, in a follow-up request with
+	// the conversation and the answer, to rate its confidence and justify it.
+	ConfidenceSelfAssessment ConfidenceMode = "self_assessment"
+)
+
+const (
+	// AverageLogprobKey is the message metadata key under which providers
+	// report the average log probability of the tokens of an answer, when
+	// the request asked for log probabilities.
+	AverageLogprobKey = "avg_logprob"
+	// ConfidenceKey is the message metadata key of the confidence in an
+	// answer, from 0 to 1, estimated by WithConfidence.
+	ConfidenceKey = "confidence"
+	// ConfidenceMethodKey is the message metadata key of the ConfidenceMode
+	// the confidence was estimated with.
+	ConfidenceMethodKey = "confidence_method"
+	// ConfidenceJustificationKey is the message metadata key of the reason
+	// the model gave for its confidence in a self-assessment.
+	ConfidenceJustificationKey = "confidence_justification"
+)
+
+// confidencePrompt asks the model to rate its previous answer.
+const confidencePrompt = `Rate how confident you are that your previous answer is correct and complete, from 0 (a guess) to 1 (certain), and justify the rating in one sentence.
+Respond only with a JSON value that conforms to this JSON schema, without any other text:
+`
+
+// selfAssessment is the answer to confidencePrompt.
+type selfAssessment struct {
+	Confidence    float64 `json:"confidence" jsonschema:"Confidence that the previous answer is correct, from 0 to 1."`
+	Justification string  `json:"justification" jsonschema:"One sentence justifying the confidence."`
+}
+
+// selfAssessmentSchema is the output schema of the self-assessment.
+var selfAssessmentSchema, _ = jsonschema.For[selfAssessment](nil)
+
+// WithConfidence makes the Agent estimate its confidence in every final
+// answer with the mode and store it, with the method, in the metadata of
+// the answer under ConfidenceKey and ConfidenceMethodKey. An answer whose
+// confidence cannot be estimated, e.g. because the provider returned no log
+// probabilities or the self-assessment failed, is left without. Disabled by
+// default.
+func WithConfidence(mode ConfidenceMode) AgentOption {
+	return func(a *agent) {
+		a.confidence = mode
+	}
+}
+
+// checkConfidence checks the confidence mode against the capabilities of the model.
+func (a *agent) checkConfidence() error {
+	switch a.confidence {
+	case "", ConfidenceSelfAssessment:
+		return nil
+	case ConfidenceLogprobs:
+		if c := capabilitiesOf(a.model, a.model.Name()); c.Logprobs == Unsupported {
+			return &CapabilityError{Model: a.model.Name(), Capability: "log probabilities", Hint: "use ConfidenceSelfAssessment or switch models"}
+		}
+		return nil
+	}
+	return fmt.Errorf("agent %s: %w: unknown confidence mode %q", a.name, ErrInvalidConfig, a.confidence)
+}
+
+// assessConfidence stores the confidence in the completed answer in its metadata.
+func (a *agent) assessConfidence(ctx context.Context, req *ModelRequest, answer *Message) {
+	if a.confidence == "" || answer.Role != RoleAssistant || answer.Status != StatusCompleted || answer.IsRefusal() {
+		return
+	}
+	var (
+		confidence    float64
+		justification string
+	)
+	switch a.confidence {
+	case ConfidenceLogprobs:
+		logprob, ok := answer.Metadata[AverageLogprobKey].(float64)
+		if !ok {
+			return
+		}
+		confidence = math.Exp(logprob)
+	case ConfidenceSelfAssessment:
+		assessment, ok := a.selfAssess(ctx, req, answer)
+		if !ok {
+			return
+		}
+		confidence, justification = assessment.Confidence, assessment.Justification
+	}
+	if answer.Metadata == nil {
+		answer.Metadata = make(map[string]any)
+	}
+	answer.Metadata[ConfidenceKey] = min(max(confidence, 0), 1)
+	answer.Metadata[ConfidenceMethodKey] = string(a.confidence)
+	if justification != "" {
+		answer.Metadata[ConfidenceJustificationKey] = justification
+	}
+}
+
+// selfAssess asks the model to rate its answer. The follow-up request counts
+// toward the run report and the token limits of the invocation.
+func (a *agent) selfAssess(ctx context.Context, req *ModelRequest, answer *Message) (selfAssessment, bool) {
+	schema, err := selfAssessmentSchema.MarshalJSON()
+	if err != nil {
+		return selfAssessment{}, false
+	}
+	followUp := &ModelRequest{
+		Instruction: req.Instruction,
+		Messages:    append(append(make([]*Message, 0, len(req.Messages)+2), req.Messages...), answer, UserMessage(confidencePrompt+string(schema))),
+	}
+	name, c := a.capabilities(ctx)
+	if c.StructuredOutput != Unsupported {
+		followUp.OutputSchema = selfAssessmentSchema
+	}
+	res, err := a.provider(ctx).Generate(ctx, followUp)
+	if err != nil {
+		return selfAssessment{}, false
+	}
+	recordModelCall(ctx, name, res.Message)
+	if err := spendTokens(ctx, a.name, res.Message.TokenUsage); err != nil {
+		return selfAssessment{}, false
+	}
+	assessment, err := ParseStructured[selfAssessment](res.Message.Text())
+	if err != nil {
+		return selfAssessment{}, false
+	}
+	return assessment, true
+}
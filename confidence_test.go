@@ -0,0 +1,110 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestConfidence(t *testing.T) {
+	tests := []struct {
+		name          string
+		mode          ConfidenceMode
+		generate      func(context.Context, *ModelRequest) (*ModelResponse, error)
+		calls         int64
+		confidence    float64
+		justification string
+	}{
+		{
+			name: "logprobs",
+			mode: ConfidenceLogprobs,
+			generate: func(_ context.Context, req *ModelRequest) (*ModelResponse, error) {
+				res := textResponse("Paris")
+				if req.Options.Logprobs {
+					res.Message.Metadata[AverageLogprobKey] = math.Log(0.8)
+				}
+				return res, nil
+			},
+			calls:      1,
+			confidence: 0.8,
+		},
+		{
+			name: "self assessment",
+			mode: ConfidenceSelfAssessment,
+			generate: func(_ context.Context, req *ModelRequest) (*ModelResponse, error) {
+				last := req.Messages[len(req.Messages)-1]
+				if !strings.HasPrefix(last.Text(), "Rate how confident") {
+					return textResponse("Paris"), nil
+				}
+				if req.OutputSchema == nil || req.Messages[len(req.Messages)-2].Text() != "Paris" {
+					return nil, errors.New("want the answer rated with a schema")
+				}
+				return textResponse(`{"confidence": 0.9, "justification": "Paris is the well-known capital."}`), nil
+			},
+			calls:         2,
+			confidence:    0.9,
+			justification: "Paris is the well-known capital.",
+		},
+		{
+			name: "self assessment failed",
+			mode: ConfidenceSelfAssessment,
+			generate: func(_ context.Context, req *ModelRequest) (*ModelResponse, error) {
+				if len(req.Messages) > 1 {
+					return textResponse("not sure"), nil
+				}
+				return textResponse("Paris"), nil
+			},
+			calls: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := &mockModel{name: "gpt-4o", generate: tt.generate}
+			agent, err := NewAgent("geo", WithModel(model), WithConfidence(tt.mode))
+			if err != nil {
+				t.Fatal(err)
+			}
+			session := NewSession()
+			answer, err := NewRunner(agent).Run(context.Background(), UserMessage("Capital of France?"), WithSession(session))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if answer.Text() != "Paris" {
+				t.Fatalf("want the answer kept, got %q", answer.Text())
+			}
+			if n := model.calls.Load(); n != tt.calls {
+				t.Fatalf("want %d model calls, got %d", tt.calls, n)
+			}
+			stored := session.History()[len(session.History())-1]
+			confidence, ok := stored.Metadata[ConfidenceKey].(float64)
+			if tt.confidence == 0 {
+				if ok {
+					t.Fatalf("want no confidence, got %v", stored.Metadata)
+				}
+				return
+			}
+			if !ok || math.Abs(confidence-tt.confidence) > 1e-9 {
+				t.Fatalf("want the confidence %v stored, got %v", tt.confidence, stored.Metadata)
+			}
+			if method := stored.Metadata[ConfidenceMethodKey]; method != string(tt.mode) {
+				t.Fatalf("want the method %s, got %v", tt.mode, method)
+			}
+			if got, _ := stored.Metadata[ConfidenceJustificationKey].(string); got != tt.justification {
+				t.Fatalf("want the justification %q, got %q", tt.justification, got)
+			}
+		})
+	}
+}
+
+func TestConfidenceConfig(t *testing.T) {
+	_, err := NewAgent("geo", WithModel(&mockModel{name: "claude-sonnet-4"}), WithConfidence(ConfidenceLogprobs))
+	var capability *CapabilityError
+	if !errors.As(err, &capability) || capability.Capability != "log probabilities" {
+		t.Fatalf("want a CapabilityError for a model without log probabilities, got %v", err)
+	}
+	if _, err := NewAgent("geo", WithModel(&mockModel{}), WithConfidence("vibes")); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("want ErrInvalidConfig for an unknown mode, got %v", err)
+	}
+}
@@ -0,0 +1,253 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-kratos/blades"
+	"github.com/go-kratos/blades/flow"
+)
+
+// echoModel answers with the rendered instruction, so outputs depend on the session state.
+type echoModel struct {
+	name   string
+	apiKey string
+}
+
+func (m *echoModel) Name() string { return m.name }
+
+func (m *echoModel) Generate(ctx context.Context, req *blades.ModelRequest) (*blades.ModelResponse, error) {
+	message := blades.NewAssistantMessage(blades.StatusCompleted)
+	message.Parts = blades.Parts(strings.Join(strings.Fields(req.Instruction.Text()), " "))
+	return &blades.ModelResponse{Message: message}, nil
+}
+
+func (m *echoModel) NewStreaming(ctx context.Context, req *blades.ModelRequest) blades.Generator[*blades.ModelResponse, error] {
+	return func(yield func(*blades.ModelResponse, error) bool) {
+		yield(m.Generate(ctx, req))
+	}
+}
+
+const parallelWorkflow = `
+root: WritingSequenceAgent
+models:
+  - name: default
+    provider: echo
+    model: echo-1
+    apiKey: ${BLADES_TEST_API_KEY}
+agents:
+  - name: writerAgent
+    model: default
+    instruction: Draft a short paragraph on climate change.
+    outputKey: draft
+  - name: editorAgent1
+    model: default
+    instruction: |
+      Edit the paragraph for grammar.
+      **Paragraph:**
+      {{.draft}}
+    outputKey: grammar_edit
+  - name: editorAgent2
+    model: default
+    instruction: |
+      Edit the paragraph for style.
+      **Paragraph:**
+      {{.draft}}
+    outputKey: style_edit
+  - name: finalReviewerAgent
+    model: default
+    instruction: |
+      Consolidate the grammar and style edits into a final version.
+      **Draft:**
+      {{.draft}}
+
+      **Grammar Edit:**
+      {{.grammar_edit}}
+
+      **Style Edit:**
+      {{.style_edit}}
+flows:
+  - name: EditorParallelAgent
+    description: Edits the drafted paragraph in parallel for grammar and style.
+    type: parallel
+    agents: [editorAgent1, editorAgent2]
+  - name: WritingSequenceAgent
+    description: Drafts, edits, and reviews a paragraph about climate change.
+    type: sequential
+    agents: [writerAgent, EditorParallelAgent, finalReviewerAgent]
+`
+
+// buildParallelWorkflow mirrors examples/workflow-parallel in Go.
+func buildParallelWorkflow(t *testing.T, model blades.ModelProvider) blades.Agent {
+	t.Helper()
+	newAgent := func(name, instruction, outputKey string) blades.Agent {
+		agent, err := blades.NewAgent(name,
+			blades.WithModel(model),
+			blades.WithInstruction(instruction),
+			blades.WithOutputKey(outputKey),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return agent
+	}
+	writer := newAgent("writerAgent", "Draft a short paragraph on climate change.", "draft")
+	editor1 := newAgent("editorAgent1", "Edit the paragraph for grammar.\n**Paragraph:**\n{{.draft}}\n", "grammar_edit")
+	editor2 := newAgent("editorAgent2", "Edit the paragraph for style.\n**Paragraph:**\n{{.draft}}\n", "style_edit")
+	reviewer := newAgent("finalReviewerAgent", "Consolidate the grammar and style edits into a final version.\n**Draft:**\n{{.draft}}\n\n**Grammar Edit:**\n{{.grammar_edit}}\n\n**Style Edit:**\n{{.style_edit}}\n", "")
+	parallel, err := flow.NewParallelAgent(flow.ParallelConfig{
+		Name:      "EditorParallelAgent",
+		SubAgents: []blades.Agent{editor1, editor2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sequential, err := flow.NewSequentialAgent(flow.SequentialConfig{
+		Name:      "WritingSequenceAgent",
+		SubAgents: []blades.Agent{writer, parallel, reviewer},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sequential
+}
+
+func run(t *testing.T, agent blades.Agent) (blades.State, string) {
+	t.Helper()
+	session := blades.NewSession()
+	output, err := blades.NewRunner(agent).Run(context.Background(), blades.UserMessage("write"), blades.WithSession(session))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return session.State(), output.Text()
+}
+
+func TestParallelWorkflowRoundTrip(t *testing.T) {
+	t.Setenv("BLADES_TEST_API_KEY", "sk-test")
+	var built *echoModel
+	registry := NewRegistry()
+	registry.RegisterProvider("echo", func(spec ModelSpec) (blades.ModelProvider, error) {
+		built = &echoModel{name: spec.Model, apiKey: spec.APIKey}
+		return built, nil
+	})
+	spec, err := Parse([]byte(parallelWorkflow))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := registry.BuildRoot(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if built.apiKey != "sk-test" {
+		t.Fatalf("expected API key from the environment, got %q", built.apiKey)
+	}
+	gotState, gotOutput := run(t, root)
+	wantState, wantOutput := run(t, buildParallelWorkflow(t, &echoModel{name: "echo-1"}))
+	if !reflect.DeepEqual(gotState, wantState) {
+		t.Fatalf("state mismatch:\nwant %v\ngot  %v", wantState, gotState)
+	}
+	if gotOutput != wantOutput || !strings.Contains(gotOutput, "Grammar Edit") {
+		t.Fatalf("output mismatch:\nwant %q\ngot  %q", wantOutput, gotOutput)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		wantPath string
+		wantLine int
+	}{
+		{
+			name:     "unknown field",
+			input:    "agents:\n  - name: a\n    model: m\n    instructions: typo\n",
+			wantPath: "agents[0].instructions",
+			wantLine: 4,
+		},
+		{
+			name:     "missing env",
+			input:    "models:\n  - name: m\n    provider: echo\n    apiKey: ${BLADES_TEST_MISSING}\n",
+			wantPath: "models[0].apiKey",
+			wantLine: 4,
+		},
+		{
+			name:     "unknown flow type",
+			input:    "agents:\n  - {name: a, model: m}\nflows:\n  - name: f\n    type: fanout\n    agents: [a]\n",
+			wantPath: "flows[0].type",
+			wantLine: 5,
+		},
+		{
+			name:     "dangling reference",
+			input:    `{"agents": [{"name": "a", "model": "m"}], "flows": [{"name": "f", "type": "sequential", "agents": ["a", "b"]}]}`,
+			wantPath: "flows[0].agents[1]",
+			wantLine: 1,
+		},
+		{
+			name:     "invalid while expression",
+			input:    "agents:\n  - {name: a, model: m}\nflows:\n  - name: f\n    type: loop\n    agents: [a]\n    while: state.revision < && true\n",
+			wantPath: "flows[0].while",
+			wantLine: 7,
+		},
+		{
+			name:     "final agent outside the flow",
+			input:    "agents:\n  - {name: a, model: m}\n  - {name: b, model: m}\nflows:\n  - name: f\n    type: sequential\n    agents: [a]\n    final: b\n",
+			wantPath: "flows[0].final",
+			wantLine: 8,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.input))
+			var specErr *Error
+			if !errors.As(err, &specErr) {
+				t.Fatalf("expected *Error, got %v", err)
+			}
+			if specErr.Path != tt.wantPath || specErr.Line != tt.wantLine {
+				t.Fatalf("want %s (line %d), got %v", tt.wantPath, tt.wantLine, specErr)
+			}
+		})
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	t.Setenv("BLADES_TEST_MODEL", "registered")
+	registry := NewRegistry()
+	registry.RegisterModel("registered", &echoModel{name: "echo"})
+	tests := []struct {
+		name     string
+		input    string
+		wantPath string
+	}{
+		{
+			name:     "unknown model",
+			input:    "agents:\n  - name: a\n    model: missing\n",
+			wantPath: "agents[0].model",
+		},
+		{
+			name:     "unknown tool",
+			input:    "agents:\n  - name: a\n    model: ${BLADES_TEST_MODEL}\n    tools: [search]\n",
+			wantPath: "agents[0].tools[0]",
+		},
+		{
+			name:     "cycle",
+			input:    "agents:\n  - {name: a, model: registered}\nflows:\n  - {name: f, type: sequential, agents: [a, g]}\n  - {name: g, type: sequential, agents: [f]}\n",
+			wantPath: "flows[0].agents",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := Parse([]byte(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = registry.Build(spec)
+			var specErr *Error
+			if !errors.As(err, &specErr) || specErr.Path != tt.wantPath || specErr.Line == 0 {
+				t.Fatalf("want error at %s, got %v", tt.wantPath, err)
+			}
+		})
+	}
+}
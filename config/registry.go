@@ -0,0 +1,272 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/go-kratos/blades"
+	"github.com/go-kratos/blades/flow"
+	"github.com/go-kratos/blades/tools"
+)
+
+// ProviderFactory builds a model provider from a model spec.
+type ProviderFactory func(ModelSpec) (blades.ModelProvider, error)
+
+// Registry holds the models, providers, tools and loop conditions that a spec
+// may reference by name. It is safe for concurrent use.
+type Registry struct {
+	mu         sync.RWMutex
+	models     map[string]blades.ModelProvider
+	providers  map[string]ProviderFactory
+	tools      map[string]tools.Tool
+	conditions map[string]flow.LoopCondition
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		models:     make(map[string]blades.ModelProvider),
+		providers:  make(map[string]ProviderFactory),
+		tools:      make(map[string]tools.Tool),
+		conditions: make(map[string]flow.LoopCondition),
+	}
+}
+
+// RegisterModel makes a model available to agents under the given name.
+func (r *Registry) RegisterModel(name string, model blades.ModelProvider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.models[name] = model
+}
+
+// RegisterProvider makes a provider available to the models section of a spec.
+func (r *Registry) RegisterProvider(name string, factory ProviderFactory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers[name] = factory
+}
+
+// RegisterTool makes tools available to agents under their names.
+func (r *Registry) RegisterTool(ts ...tools.Tool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, t := range ts {
+		r.tools[t.Name()] = t
+	}
+}
+
+// RegisterCondition makes a loop condition available to loop flows under the given name.
+func (r *Registry) RegisterCondition(name string, condition flow.LoopCondition) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.conditions[name] = condition
+}
+
+// BuildRoot materializes the spec and returns the agent named by its root.
+func (r *Registry) BuildRoot(spec *Spec) (blades.Agent, error) {
+	if spec.Root == "" {
+		return nil, spec.errorf("root", "root is required")
+	}
+	agents, err := r.Build(spec)
+	if err != nil {
+		return nil, err
+	}
+	return agents[spec.Root], nil
+}
+
+// Build materializes every agent and flow in the spec and returns them by name.
+// Errors are *Error values pointing at the offending path of the spec.
+func (r *Registry) Build(spec *Spec) (map[string]blades.Agent, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	b := &builder{
+		registry: r,
+		spec:     spec,
+		models:   make(map[string]blades.ModelProvider, len(spec.Models)),
+		agents:   make(map[string]blades.Agent, len(spec.Agents)+len(spec.Flows)),
+		flows:    make(map[string]int, len(spec.Flows)),
+		building: make(map[string]bool),
+	}
+	for i, m := range spec.Models {
+		model, err := b.buildModel(i, m)
+		if err != nil {
+			return nil, err
+		}
+		b.models[m.Name] = model
+	}
+	var errs []error
+	for i, a := range spec.Agents {
+		agent, err := b.buildAgent(i, a)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		b.agents[a.Name] = agent
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	for i, f := range spec.Flows {
+		b.flows[f.Name] = i
+	}
+	for _, f := range spec.Flows {
+		if _, err := b.resolve(f.Name); err != nil {
+			return nil, err
+		}
+	}
+	return b.agents, nil
+}
+
+// builder holds the state of a single Build call.
+type builder struct {
+	registry *Registry
+	spec     *Spec
+	models   map[string]blades.ModelProvider
+	agents   map[string]blades.Agent
+	flows    map[string]int
+	building map[string]bool
+}
+
+func (b *builder) buildModel(i int, m ModelSpec) (blades.ModelProvider, error) {
+	path := fmt.Sprintf("models[%d]", i)
+	factory, ok := b.registry.providers[m.Provider]
+	if !ok {
+		return nil, b.spec.errorf(path+".provider", "unknown provider %q", m.Provider)
+	}
+	model, err := factory(m)
+	if err != nil {
+		return nil, b.spec.errorf(path, "%v", err)
+	}
+	return model, nil
+}
+
+func (b *builder) model(name string) (blades.ModelProvider, bool) {
+	if model, ok := b.models[name]; ok {
+		return model, true
+	}
+	model, ok := b.registry.models[name]
+	return model, ok
+}
+
+func (b *builder) buildAgent(i int, a AgentSpec) (blades.Agent, error) {
+	path := fmt.Sprintf("agents[%d]", i)
+	model, ok := b.model(a.Model)
+	if !ok {
+		return nil, b.spec.errorf(path+".model", "unknown model %q", a.Model)
+	}
+	opts := []blades.AgentOption{
+		blades.WithModel(model),
+		blades.WithDescription(a.Description),
+		blades.WithInstruction(a.Instruction),
+		blades.WithOutputKey(a.OutputKey),
+	}
+	if a.MaxIterations > 0 {
+		opts = append(opts, blades.WithMaxIterations(a.MaxIterations))
+	}
+	if len(a.Tools) > 0 {
+		agentTools := make([]tools.Tool, 0, len(a.Tools))
+		for j, name := range a.Tools {
+			t, ok := b.registry.tools[name]
+			if !ok {
+				return nil, b.spec.errorf(fmt.Sprintf("%s.tools[%d]", path, j), "unknown tool %q", name)
+			}
+			agentTools = append(agentTools, t)
+		}
+		opts = append(opts, blades.WithTools(agentTools...))
+	}
+	agent, err := blades.NewAgent(a.Name, opts...)
+	if err != nil {
+		return nil, b.spec.errorf(path, "%v", err)
+	}
+	return agent, nil
+}
+
+// resolve returns the agent or flow with the given name, building flows on demand.
+func (b *builder) resolve(name string) (blades.Agent, error) {
+	if agent, ok := b.agents[name]; ok {
+		return agent, nil
+	}
+	i := b.flows[name]
+	path := fmt.Sprintf("flows[%d]", i)
+	if b.building[name] {
+		return nil, b.spec.errorf(path+".agents", "flow %q references itself", name)
+	}
+	b.building[name] = true
+	defer delete(b.building, name)
+
+	f := b.spec.Flows[i]
+	subAgents := make([]blades.Agent, 0, len(f.Agents))
+	for _, sub := range f.Agents {
+		agent, err := b.resolve(sub)
+		if err != nil {
+			return nil, err
+		}
+		subAgents = append(subAgents, agent)
+	}
+	var (
+		agent blades.Agent
+		err   error
+	)
+	switch f.Type {
+	case FlowSequential:
+		agent, err = flow.NewSequentialAgent(flow.SequentialConfig{
+			Name:        f.Name,
+			Description: f.Description,
+			SubAgents:   subAgents,
+			FinalAgent:  f.Final,
+		})
+	case FlowParallel:
+		agent, err = flow.NewParallelAgent(flow.ParallelConfig{
+			Name:        f.Name,
+			Description: f.Description,
+			SubAgents:   subAgents,
+			FinalAgent:  f.Final,
+		})
+	case FlowLoop:
+		config := flow.LoopConfig{
+			Name:          f.Name,
+			Description:   f.Description,
+			MaxIterations: f.MaxIterations,
+			SubAgents:     subAgents,
+		}
+		if f.Condition != "" {
+			condition, ok := b.registry.conditions[f.Condition]
+			if !ok {
+				return nil, b.spec.errorf(path+".condition", "unknown condition %q", f.Condition)
+			}
+			config.Condition = condition
+		}
+		if f.While != "" {
+			condition, err := flow.ConditionExpr(f.While)
+			if err != nil {
+				return nil, b.spec.errorf(path+".while", "%v", err)
+			}
+			config.Condition = condition
+		}
+		agent, err = flow.NewLoopAgent(config)
+	case FlowHandoff:
+		model, ok := b.model(f.Model)
+		if !ok {
+			return nil, b.spec.errorf(path+".model", "unknown model %q", f.Model)
+		}
+		handoff, err := flow.NewHandoffAgent(flow.HandoffConfig{
+			Name:        f.Name,
+			Description: f.Description,
+			Model:       model,
+			SubAgents:   subAgents,
+		})
+		if err != nil {
+			return nil, b.spec.errorf(path, "%v", err)
+		}
+		agent = handoff
+	}
+	if err != nil {
+		return nil, b.spec.errorf(path, "%v", err)
+	}
+	b.agents[name] = agent
+	return agent, nil
+}
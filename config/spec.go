@@ -0,0 +1,317 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/go-kratos/blades/expr"
+	"gopkg.in/yaml.v3"
+)
+
+// FlowType is the kind of flow composing a set of agents.
+type FlowType string
+
+const (
+	// FlowSequential runs the agents one after another.
+	FlowSequential FlowType = "sequential"
+	// FlowParallel runs the agents concurrently.
+	FlowParallel FlowType = "parallel"
+	// FlowLoop runs the agents repeatedly until the condition stops it.
+	FlowLoop FlowType = "loop"
+	// FlowHandoff lets a routing model hand the request off to one of the agents.
+	FlowHandoff FlowType = "handoff"
+)
+
+// Spec is a declarative definition of models, agents and flows.
+type Spec struct {
+	// Root names the agent or flow returned by Registry.BuildRoot.
+	Root   string      `json:"root,omitempty" yaml:"root,omitempty"`
+	Models []ModelSpec `json:"models,omitempty" yaml:"models,omitempty"`
+	Agents []AgentSpec `json:"agents,omitempty" yaml:"agents,omitempty"`
+	Flows  []FlowSpec  `json:"flows,omitempty" yaml:"flows,omitempty"`
+
+	// lines maps the YAML path of every node to its line in the source.
+	lines map[string]int
+}
+
+// ModelSpec defines a model built by a provider registered in the Registry.
+type ModelSpec struct {
+	Name     string         `json:"name" yaml:"name"`
+	Provider string         `json:"provider" yaml:"provider"`
+	Model    string         `json:"model" yaml:"model"`
+	APIKey   string         `json:"apiKey,omitempty" yaml:"apiKey,omitempty"`
+	BaseURL  string         `json:"baseURL,omitempty" yaml:"baseURL,omitempty"`
+	Options  map[string]any `json:"options,omitempty" yaml:"options,omitempty"`
+}
+
+// AgentSpec defines a single agent.
+type AgentSpec struct {
+	Name          string   `json:"name" yaml:"name"`
+	Description   string   `json:"description,omitempty" yaml:"description,omitempty"`
+	Model         string   `json:"model" yaml:"model"`
+	Instruction   string   `json:"instruction,omitempty" yaml:"instruction,omitempty"`
+	Tools         []string `json:"tools,omitempty" yaml:"tools,omitempty"`
+	OutputKey     string   `json:"outputKey,omitempty" yaml:"outputKey,omitempty"`
+	MaxIterations int      `json:"maxIterations,omitempty" yaml:"maxIterations,omitempty"`
+}
+
+// FlowSpec defines a flow over agents or other flows, referenced by name.
+type FlowSpec struct {
+	Name        string   `json:"name" yaml:"name"`
+	Description string   `json:"description,omitempty" yaml:"description,omitempty"`
+	Type        FlowType `json:"type" yaml:"type"`
+	Agents      []string `json:"agents" yaml:"agents"`
+	// MaxIterations bounds a loop flow.
+	MaxIterations int `json:"maxIterations,omitempty" yaml:"maxIterations,omitempty"`
+	// Condition names a loop condition registered in the Registry.
+	Condition string `json:"condition,omitempty" yaml:"condition,omitempty"`
+	// While is an expression that keeps a loop flow running while it is true,
+	// as an alternative to Condition; see flow.ConditionExpr.
+	While string `json:"while,omitempty" yaml:"while,omitempty"`
+	// Model names the routing model of a handoff flow.
+	Model string `json:"model,omitempty" yaml:"model,omitempty"`
+	// Final names the agent of a sequential or parallel flow whose output is
+	// the final answer; it defaults to the last agent.
+	Final string `json:"final,omitempty" yaml:"final,omitempty"`
+}
+
+// Error describes an invalid value in a spec.
+type Error struct {
+	// Path is the YAML path of the value, such as "agents[1].model".
+	Path string
+	// Line is the line of the value in the source, or 0 if unknown.
+	Line    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("config: %s (line %d): %s", e.Path, e.Line, e.Message)
+	}
+	return fmt.Sprintf("config: %s: %s", e.Path, e.Message)
+}
+
+// ParseFile reads and parses a YAML or JSON spec from the given path.
+func ParseFile(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse parses a YAML or JSON spec.
+// String values may reference environment variables as ${NAME} or
+// ${NAME:-default}; referencing an unset variable without a default is an error.
+// The returned errors are *Error values joined with errors.Join.
+func Parse(data []byte) (*Spec, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	spec := &Spec{lines: make(map[string]int)}
+	if len(root.Content) == 0 {
+		return spec, nil
+	}
+	doc := root.Content[0]
+	var errs []error
+	walk(doc, reflect.TypeOf(spec).Elem(), "", spec.lines, &errs)
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	if err := doc.Decode(spec); err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+var envPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandEnv replaces ${NAME} and ${NAME:-default} references in s.
+func expandEnv(s string) (string, error) {
+	var missing []string
+	expanded := envPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		m := envPattern.FindStringSubmatch(ref)
+		if v, ok := os.LookupEnv(m[1]); ok {
+			return v
+		}
+		if m[2] != "" {
+			return m[3]
+		}
+		missing = append(missing, m[1])
+		return ""
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
+
+// walk records the line of every node, expands environment variables in
+// scalar values and reports keys that do not match a field of t.
+func walk(node *yaml.Node, t reflect.Type, path string, lines map[string]int, errs *[]error) {
+	lines[path] = node.Line
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch node.Kind {
+	case yaml.AliasNode:
+		walk(node.Alias, t, path, lines, errs)
+	case yaml.ScalarNode:
+		if node.Tag != "!!str" {
+			return
+		}
+		value, err := expandEnv(node.Value)
+		if err != nil {
+			*errs = append(*errs, &Error{Path: path, Line: node.Line, Message: err.Error()})
+			return
+		}
+		node.Value = value
+	case yaml.SequenceNode:
+		elem := t
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			elem = t.Elem()
+		}
+		for i, child := range node.Content {
+			walk(child, elem, fmt.Sprintf("%s[%d]", path, i), lines, errs)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			childPath := key.Value
+			if path != "" {
+				childPath = path + "." + key.Value
+			}
+			switch t.Kind() {
+			case reflect.Struct:
+				field, ok := fieldByTag(t, key.Value)
+				if !ok {
+					*errs = append(*errs, &Error{Path: childPath, Line: key.Line, Message: fmt.Sprintf("unknown field %q", key.Value)})
+					continue
+				}
+				walk(value, field.Type, childPath, lines, errs)
+			case reflect.Map:
+				walk(value, t.Elem(), childPath, lines, errs)
+			default:
+				walk(value, t, childPath, lines, errs)
+			}
+		}
+	}
+}
+
+// fieldByTag returns the exported struct field whose yaml tag name is name.
+func fieldByTag(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if tag == name {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// Validate checks the spec for missing names, duplicates and dangling references.
+func (s *Spec) Validate() error {
+	var errs []error
+	fail := func(path, format string, args ...any) {
+		errs = append(errs, s.errorf(path, format, args...))
+	}
+	models := make(map[string]bool, len(s.Models))
+	for i, m := range s.Models {
+		path := fmt.Sprintf("models[%d]", i)
+		switch {
+		case m.Name == "":
+			fail(path+".name", "name is required")
+		case models[m.Name]:
+			fail(path+".name", "duplicate model %q", m.Name)
+		}
+		models[m.Name] = true
+		if m.Provider == "" {
+			fail(path+".provider", "provider is required")
+		}
+	}
+	names := make(map[string]bool, len(s.Agents)+len(s.Flows))
+	for i, a := range s.Agents {
+		path := fmt.Sprintf("agents[%d]", i)
+		switch {
+		case a.Name == "":
+			fail(path+".name", "name is required")
+		case names[a.Name]:
+			fail(path+".name", "duplicate agent %q", a.Name)
+		}
+		names[a.Name] = true
+		if a.Model == "" {
+			fail(path+".model", "model is required")
+		}
+	}
+	for i, f := range s.Flows {
+		path := fmt.Sprintf("flows[%d]", i)
+		switch {
+		case f.Name == "":
+			fail(path+".name", "name is required")
+		case names[f.Name]:
+			fail(path+".name", "duplicate agent %q", f.Name)
+		}
+		names[f.Name] = true
+		switch f.Type {
+		case FlowSequential, FlowParallel, FlowLoop:
+		case FlowHandoff:
+			if f.Model == "" {
+				fail(path+".model", "model is required for a handoff flow")
+			}
+		default:
+			fail(path+".type", "unknown flow type %q", f.Type)
+		}
+		if len(f.Agents) == 0 {
+			fail(path+".agents", "at least one agent is required")
+		}
+		if f.While != "" {
+			switch {
+			case f.Type != FlowLoop:
+				fail(path+".while", "while is only supported by loop flows")
+			case f.Condition != "":
+				fail(path+".while", "while and condition are mutually exclusive")
+			}
+			var syntax *expr.SyntaxError
+			if _, err := expr.Compile(f.While); errors.As(err, &syntax) {
+				fail(path+".while", "invalid expression at column %d: %s", syntax.Column, syntax.Message)
+			}
+		}
+		if f.Final != "" {
+			switch {
+			case f.Type != FlowSequential && f.Type != FlowParallel:
+				fail(path+".final", "final is only supported by sequential and parallel flows")
+			case !slices.Contains(f.Agents, f.Final):
+				fail(path+".final", "%q is not an agent of the flow", f.Final)
+			}
+		}
+	}
+	for i, f := range s.Flows {
+		for j, name := range f.Agents {
+			if !names[name] {
+				fail(fmt.Sprintf("flows[%d].agents[%d]", i, j), "unknown agent %q", name)
+			}
+		}
+	}
+	if s.Root != "" && !names[s.Root] {
+		fail("root", "unknown agent %q", s.Root)
+	}
+	return errors.Join(errs...)
+}
+
+// errorf builds an *Error for the given path, annotated with its source line.
+func (s *Spec) errorf(path, format string, args ...any) *Error {
+	return &Error{Path: path, Line: s.lines[path], Message: fmt.Sprintf(format, args...)}
+}
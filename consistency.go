@@ -0,0 +1,290 @@
+package blades
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ConsistencyKey is the metadata key of the Consistency of a message
+// answered by a SelfConsistent agent.
+const ConsistencyKey = "self_consistency"
+
+// AnswerExtractor returns the final answer of a sample, which is compared
+// with the answers of the other samples. An error or an empty answer
+// abstains from the vote.
+type AnswerExtractor func(message *Message) (string, error)
+
+// TextAnswer is an AnswerExtractor that uses the whole text of the message.
+func TextAnswer(message *Message) (string, error) {
+	return strings.TrimSpace(message.Text()), nil
+}
+
+// RegexAnswer returns an AnswerExtractor that uses the first submatch of re,
+// or the whole match if re has no groups, e.g. `(?m)^Answer: (.+)$`.
+func RegexAnswer(re *regexp.Regexp) AnswerExtractor {
+	return func(message *Message) (string, error) {
+		match := re.FindStringSubmatch(message.Text())
+		if match == nil {
+			return "", fmt.Errorf("consistency: no match for %s", re)
+		}
+		return strings.TrimSpace(match[len(match)-1]), nil
+	}
+}
+
+// FieldAnswer returns an AnswerExtractor that uses a field of the JSON object
+// answered with structured output, as parsed by ParseStructured.
+func FieldAnswer(field string) AnswerExtractor {
+	return func(message *Message) (string, error) {
+		object, err := ParseStructured[map[string]any](message.Text())
+		if err != nil {
+			return "", fmt.Errorf("consistency: %w", err)
+		}
+		value, ok := object[field]
+		if !ok {
+			return "", fmt.Errorf("consistency: no field %q", field)
+		}
+		if s, ok := value.(string); ok {
+			return strings.TrimSpace(s), nil
+		}
+		data, err := json.Marshal(value)
+		return string(data), err
+	}
+}
+
+// TieBreaker picks the answer among the tied answers, which are listed in
+// the order they were first sampled.
+type TieBreaker func(ctx context.Context, tied []string) (string, error)
+
+// Consistency is the outcome of the vote of a SelfConsistent agent.
+type Consistency struct {
+	// Answer is the majority answer.
+	Answer string `json:"answer"`
+	// Confidence is the share of the samples that gave the answer.
+	Confidence float64 `json:"confidence"`
+	// Votes counts the samples per answer.
+	Votes map[string]int `json:"votes"`
+	// Answers lists the answer of every sample, empty for abstentions.
+	Answers []string `json:"answers"`
+}
+
+// ConsistencyOption configures a SelfConsistent agent.
+type ConsistencyOption func(*selfConsistent)
+
+// WithEarlyExit stops sampling once at least minSamples samples have been
+// taken and the leading answer has the given share of them, e.g. 0.75.
+func WithEarlyExit(minSamples int, agreement float64) ConsistencyOption {
+	return func(s *selfConsistent) {
+		s.minSamples = minSamples
+		s.agreement = agreement
+	}
+}
+
+// WithTieBreaker sets how tied answers are decided. By default the answer
+// sampled first wins.
+func WithTieBreaker(breaker TieBreaker) ConsistencyOption {
+	return func(s *selfConsistent) {
+		s.tieBreaker = breaker
+	}
+}
+
+// selfConsistent is an agent that answers with the majority of the answers
+// of several runs of another agent.
+type selfConsistent struct {
+	agent      Agent
+	samples    int
+	extract    AnswerExtractor
+	minSamples int
+	agreement  float64
+	tieBreaker TieBreaker
+}
+
+// SelfConsistent returns an agent that runs the agent up to k times on the
+// same invocation and answers with the message of the majority answer, as
+// extracted by extract, or TextAnswer if nil. The message carries the vote
+// under ConsistencyKey and the token usage of all samples.
+//
+// Each sample runs on a fork of the session; only the messages and state of
+// the selected sample are kept.
+func SelfConsistent(agent Agent, k int, extract AnswerExtractor, opts ...ConsistencyOption) Agent {
+	s := &selfConsistent{agent: agent, samples: max(k, 1), extract: extract}
+	if s.extract == nil {
+		s.extract = TextAnswer
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *selfConsistent) Name() string {
+	return s.agent.Name()
+}
+
+func (s *selfConsistent) Description() string {
+	return s.agent.Description()
+}
+
+// sample is a run of the wrapped agent.
+type sample struct {
+	answer  string
+	message *Message
+	session Session
+	// forked is the length of the history of the session when it was forked.
+	forked int
+}
+
+func (s *selfConsistent) Run(ctx context.Context, invocation *Invocation) Generator[*Message, error] {
+	ctx = NewPathContext(ctx, s.Name())
+	return PathErrors(ctx, func(yield func(*Message, error) bool) {
+		var (
+			samples []sample
+			usage   TokenUsage
+			votes   = make(map[string]int)
+		)
+		for i := range s.samples {
+			result, err := s.sample(ctx, invocation, i)
+			if err != nil {
+				s.fail(invocation, yield, err)
+				return
+			}
+			usage = usage.Add(result.message.TokenUsage)
+			if result.answer != "" {
+				votes[result.answer]++
+			}
+			samples = append(samples, result)
+			if s.decided(samples, votes) {
+				break
+			}
+		}
+		winner, err := s.elect(ctx, samples, votes)
+		if err != nil {
+			s.fail(invocation, yield, err)
+			return
+		}
+		consistency := Consistency{Answer: winner.answer, Votes: votes}
+		consistency.Confidence = float64(votes[winner.answer]) / float64(len(samples))
+		for _, result := range samples {
+			consistency.Answers = append(consistency.Answers, result.answer)
+		}
+		message := winner.message
+		message.TokenUsage = usage
+		if message.Metadata == nil {
+			message.Metadata = make(map[string]any)
+		}
+		message.Metadata[ConsistencyKey] = consistency
+		if err := s.keep(ctx, invocation.Session, winner); err != nil {
+			s.fail(invocation, yield, err)
+			return
+		}
+		yield(message, nil)
+	})
+}
+
+// sample runs the agent once on a fork of the session.
+func (s *selfConsistent) sample(ctx context.Context, invocation *Invocation, i int) (sample, error) {
+	child := invocation.Child(fmt.Sprintf("sample%d", i))
+	child.Streamable = false
+	var forked int
+	if invocation.Session != nil {
+		fork, err := invocation.Session.Fork("")
+		if err != nil {
+			return sample{}, err
+		}
+		forked = len(fork.History())
+		child.Session = fork
+		ctx = NewSessionContext(ctx, fork)
+	}
+	var last *Message
+	for message, err := range s.agent.Run(ctx, child) {
+		if err != nil {
+			return sample{}, err
+		}
+		last = message
+	}
+	if last == nil || last.Status != StatusCompleted {
+		return sample{}, ErrNoFinalResponse
+	}
+	answer, err := s.extract(last)
+	if err != nil {
+		answer = ""
+	}
+	return sample{answer: answer, message: last, session: child.Session, forked: forked}, nil
+}
+
+// decided reports whether sampling can stop early.
+func (s *selfConsistent) decided(samples []sample, votes map[string]int) bool {
+	if s.agreement <= 0 || len(samples) < s.minSamples {
+		return false
+	}
+	leader := 0
+	for _, n := range votes {
+		leader = max(leader, n)
+	}
+	return float64(leader) >= s.agreement*float64(len(samples))
+}
+
+// elect returns the first sample of the majority answer.
+func (s *selfConsistent) elect(ctx context.Context, samples []sample, votes map[string]int) (sample, error) {
+	leader := 0
+	for _, n := range votes {
+		leader = max(leader, n)
+	}
+	if leader == 0 {
+		return sample{}, ErrNoConsensus
+	}
+	var tied []string
+	for _, result := range samples {
+		if votes[result.answer] == leader && !slices.Contains(tied, result.answer) {
+			tied = append(tied, result.answer)
+		}
+	}
+	answer := tied[0]
+	if len(tied) > 1 && s.tieBreaker != nil {
+		var err error
+		if answer, err = s.tieBreaker(ctx, tied); err != nil {
+			return sample{}, fmt.Errorf("consistency: break tie: %w", err)
+		}
+	}
+	for _, result := range samples {
+		if result.answer == answer && answer != "" {
+			return result, nil
+		}
+	}
+	return sample{}, fmt.Errorf("consistency: tie breaker chose %q, which is not a tied answer", answer)
+}
+
+// keep copies the messages and state of the selected sample to the session.
+// The messages are those the sample added after the fork, as the session may
+// have grown since, e.g. under a parallel flow.
+func (s *selfConsistent) keep(ctx context.Context, session Session, winner sample) error {
+	fork := winner.session
+	if session == nil || fork == nil {
+		return nil
+	}
+	for _, message := range fork.History()[winner.forked:] {
+		if err := session.Append(ctx, message); err != nil {
+			return err
+		}
+	}
+	state := session.State()
+	for key, value := range fork.State() {
+		if old, ok := state[key]; !ok || !reflect.DeepEqual(old, value) {
+			session.PutState(ctx, key, value)
+		}
+	}
+	return nil
+}
+
+func (s *selfConsistent) fail(invocation *Invocation, yield func(*Message, error) bool, err error) {
+	message := NewFailedMessage(s.Name(), ErrorClassInternal, err, "")
+	message.InvocationID = invocation.ID
+	if !yield(message, nil) {
+		return
+	}
+	yield(nil, err)
+}
@@ -0,0 +1,191 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sync/atomic"
+	"testing"
+)
+
+// disagreeingModel answers with the next of its scripted answers on every call.
+func disagreeingModel(answers ...string) *mockModel {
+	var calls atomic.Int64
+	return &mockModel{
+		generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+			n := calls.Add(1) - 1
+			res := textResponse(answers[int(n)%len(answers)])
+			res.Message.TokenUsage = TokenUsage{InputTokens: 10, OutputTokens: 5, TotalTokens: 15}
+			return res, nil
+		},
+	}
+}
+
+func TestSelfConsistent(t *testing.T) {
+	answer := RegexAnswer(regexp.MustCompile(`Answer: (\w+)`))
+	longest := func(ctx context.Context, tied []string) (string, error) {
+		best := tied[0]
+		for _, answer := range tied {
+			if len(answer) > len(best) {
+				best = answer
+			}
+		}
+		return best, nil
+	}
+	tests := []struct {
+		name           string
+		answers        []string
+		k              int
+		opts           []ConsistencyOption
+		want           string
+		wantConfidence float64
+		wantCalls      int64
+		wantErr        error
+	}{
+		{
+			name:           "majority",
+			answers:        []string{"Answer: 42", "Answer: 41", "So... Answer: 42", "I think 40", "Answer: 42"},
+			k:              5,
+			want:           "Answer: 42",
+			wantConfidence: 0.6,
+			wantCalls:      5,
+		},
+		{
+			name:           "early exit",
+			answers:        []string{"Answer: 42", "Answer: 42", "Answer: 42", "Answer: 41"},
+			k:              8,
+			opts:           []ConsistencyOption{WithEarlyExit(3, 0.9)},
+			want:           "Answer: 42",
+			wantConfidence: 1,
+			wantCalls:      3,
+		},
+		{
+			name:           "tie first sampled",
+			answers:        []string{"Answer: no", "Answer: yes"},
+			k:              4,
+			want:           "Answer: no",
+			wantConfidence: 0.5,
+			wantCalls:      4,
+		},
+		{
+			name:           "tie breaker",
+			answers:        []string{"Answer: no", "Answer: yes"},
+			k:              4,
+			opts:           []ConsistencyOption{WithTieBreaker(longest)},
+			want:           "Answer: yes",
+			wantConfidence: 0.5,
+			wantCalls:      4,
+		},
+		{
+			name:      "no answer",
+			answers:   []string{"I am not sure."},
+			k:         3,
+			wantCalls: 3,
+			wantErr:   ErrNoConsensus,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := disagreeingModel(tt.answers...)
+			solver, err := NewAgent("solver", WithModel(model), WithOutputKey("answer"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			session := NewSession()
+			agent := SelfConsistent(solver, tt.k, answer, tt.opts...)
+			var (
+				final  *Message
+				runErr error
+			)
+			for message, err := range agent.Run(context.Background(), &Invocation{Session: session, Message: UserMessage("What is 6 x 7?")}) {
+				if err != nil {
+					runErr = err
+					break
+				}
+				final = message
+			}
+			if model.calls.Load() != tt.wantCalls {
+				t.Fatalf("want %d samples, got %d", tt.wantCalls, model.calls.Load())
+			}
+			if tt.wantErr != nil {
+				if !errors.Is(runErr, tt.wantErr) || final.Status != StatusFailed {
+					t.Fatalf("want %v, got %v", tt.wantErr, runErr)
+				}
+				return
+			}
+			if runErr != nil {
+				t.Fatal(runErr)
+			}
+			consistency, _ := final.Metadata[ConsistencyKey].(Consistency)
+			if final.Text() != tt.want || consistency.Confidence != tt.wantConfidence || len(consistency.Answers) != int(tt.wantCalls) {
+				t.Fatalf("want %q with confidence %v, got %q with %+v", tt.want, tt.wantConfidence, final.Text(), consistency)
+			}
+			if final.TokenUsage.TotalTokens != 15*tt.wantCalls {
+				t.Fatalf("want the usage of all samples, got %+v", final.TokenUsage)
+			}
+			// Only the selected sample is kept in the session.
+			history := session.History()
+			if len(history) != 1 || history[0].Text() != tt.want || session.State()["answer"] != tt.want {
+				t.Fatalf("unexpected session: %d messages, state %v", len(history), session.State())
+			}
+		})
+	}
+}
+
+func TestSelfConsistentParentGrows(t *testing.T) {
+	session := NewSession()
+	if err := session.Append(context.Background(), UserMessage("What is 6 x 7?")); err != nil {
+		t.Fatal(err)
+	}
+	model := &mockModel{
+		generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+			// Another branch writes to the session while the sample runs.
+			if err := session.Append(ctx, AssistantMessage("elsewhere")); err != nil {
+				return nil, err
+			}
+			return textResponse("Answer: 42"), nil
+		},
+	}
+	solver, err := NewAgent("solver", WithModel(model))
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent := SelfConsistent(solver, 3, nil)
+	for _, err := range agent.Run(context.Background(), &Invocation{Session: session, Message: UserMessage("What is 6 x 7?")}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	history := session.History()
+	if len(history) != 5 || history[4].Text() != "Answer: 42" {
+		t.Fatalf("want the answer of the sample appended once, got %d messages", len(history))
+	}
+}
+
+func TestFieldAnswer(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    string
+		wantErr error
+	}{
+		{name: "bare", text: `{"answer": " 42 "}`, want: "42"},
+		{name: "fenced", text: "```json\n{\"answer\": 42}\n```", want: "42"},
+		{name: "prefixed", text: "Here it is: {\"answer\": [4, 2]}", want: "[4,2]"},
+		{name: "not json", text: "42", wantErr: ErrInvalidStructuredOutput},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FieldAnswer("answer")(AssistantMessage(tt.text))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("want %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("want %q, got %q, %v", tt.want, got, err)
+			}
+		})
+	}
+}
@@ -37,6 +37,29 @@ func FromAgentContext(ctx context.Context) (AgentContext, bool) {
 	return agent, ok
 }
 
+// ctxInvocationKey is the context key for the current Invocation.
+type ctxInvocationKey struct{}
+
+// NewInvocationContext returns a new context that carries the invocation.
+func NewInvocationContext(ctx context.Context, invocation *Invocation) context.Context {
+	return context.WithValue(ctx, ctxInvocationKey{}, invocation)
+}
+
+// FromInvocationContext retrieves the current Invocation from the context, if present.
+func FromInvocationContext(ctx context.Context) (*Invocation, bool) {
+	invocation, ok := ctx.Value(ctxInvocationKey{}).(*Invocation)
+	return invocation, ok
+}
+
+// InvocationIDFromContext returns the ID of the current invocation, if present.
+func InvocationIDFromContext(ctx context.Context) (string, bool) {
+	invocation, ok := FromInvocationContext(ctx)
+	if !ok || invocation.ID == "" {
+		return "", false
+	}
+	return invocation.ID, true
+}
+
 // ctxToolKey is the context key for ToolContext.
 type ctxToolKey struct{}
 
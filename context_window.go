@@ -0,0 +1,146 @@
+package blades
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ContextOverflowPolicy decides how an Agent handles requests that exceed the model's context window.
+type ContextOverflowPolicy int
+
+const (
+	// ContextOverflowNone sends requests as-is and lets the provider reject oversized ones.
+	ContextOverflowNone ContextOverflowPolicy = iota
+	// ContextOverflowTruncate drops the oldest history messages until the request fits.
+	ContextOverflowTruncate
+	// ContextOverflowSummarize replaces the oldest history messages with a summary.
+	ContextOverflowSummarize
+	// ContextOverflowError fails fast with a *ContextWindowError.
+	ContextOverflowError
+)
+
+// ContextWindowError is returned when a request does not fit the model's context window.
+type ContextWindowError struct {
+	Model  string
+	Tokens int64
+	Limit  int64
+}
+
+// Excess returns how many tokens the request is over budget.
+func (e *ContextWindowError) Excess() int64 {
+	return e.Tokens - e.Limit
+}
+
+func (e *ContextWindowError) Error() string {
+	return fmt.Sprintf("context window exceeded for model %s: request has %d tokens, limit is %d (%d over budget)",
+		e.Model, e.Tokens, e.Limit, e.Excess())
+}
+
+// Summarizer condenses a sequence of messages into a single message.
+type Summarizer func(context.Context, []*Message) (*Message, error)
+
+const summarizeInstruction = `Summarize the following conversation concisely.
+Keep facts, decisions, open questions and tool results that later turns may rely on.`
+
+// summarizeWith returns a Summarizer that asks the given model for a summary.
+func summarizeWith(model ModelProvider) Summarizer {
+	return func(ctx context.Context, messages []*Message) (*Message, error) {
+		var buf strings.Builder
+		for _, m := range messages {
+			buf.WriteString(string(m.Role))
+			buf.WriteString(": ")
+			buf.WriteString(m.String())
+			buf.WriteByte('\n')
+		}
+		res, err := model.Generate(ctx, &ModelRequest{
+			Instruction: SystemMessage(summarizeInstruction),
+			Messages:    []*Message{UserMessage(buf.String())},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("summarize history: %w", err)
+		}
+		return SystemMessage("Summary of the earlier conversation:\n" + res.Message.Text()), nil
+	}
+}
+
+// fitContext applies the agent's overflow policy to the request so that it fits
+// the model's context window. The instruction, system messages, examples and the current
+// turn (the last user message and everything after it) are always kept; a tool
+// message carries both the call and its result, so it is dropped as a unit.
+func (a *agent) fitContext(ctx context.Context, req *ModelRequest) error {
+	if a.overflowPolicy == ContextOverflowNone {
+		return nil
+	}
+	name, info := a.capabilities(ctx)
+	if info.ContextWindow <= 0 {
+		return nil
+	}
+	count := func(messages []*Message) int64 {
+		return a.tokenCounter.CountTokens(append([]*Message{req.Instruction}, messages...)...)
+	}
+	tokens := count(req.Messages)
+	if tokens <= info.ContextWindow {
+		return nil
+	}
+	overflow := &ContextWindowError{Model: name, Tokens: tokens, Limit: info.ContextWindow}
+	if a.overflowPolicy == ContextOverflowError {
+		return overflow
+	}
+	current := len(req.Messages) - 1
+	for i, m := range slices.Backward(req.Messages) {
+		if m.Role == RoleUser {
+			current = i
+			break
+		}
+	}
+	if current < 0 {
+		return overflow
+	}
+	var (
+		pinned  []*Message
+		history []*Message
+		turn    = req.Messages[current:]
+	)
+	for _, m := range req.Messages[:current] {
+		if IsSystemRole(m.Role) || isExample(m) {
+			pinned = append(pinned, m)
+		} else {
+			history = append(history, m)
+		}
+	}
+	assemble := func(prefix, history []*Message) []*Message {
+		messages := make([]*Message, 0, len(pinned)+len(prefix)+len(history)+len(turn))
+		messages = append(append(append(messages, pinned...), prefix...), history...)
+		return append(messages, turn...)
+	}
+	// Drop the oldest history messages until the request fits.
+	var dropped []*Message
+	for len(history) > 0 && count(assemble(nil, history)) > info.ContextWindow {
+		dropped, history = append(dropped, history[0]), history[1:]
+	}
+	var prefix []*Message
+	if a.overflowPolicy == ContextOverflowSummarize && len(dropped) > 0 {
+		summarizer := a.summarizer
+		if summarizer == nil {
+			summarizer = summarizeWith(a.provider(ctx))
+		}
+		summary, err := summarizer(ctx, dropped)
+		if err != nil {
+			return err
+		}
+		prefix = []*Message{summary}
+		// Make room for the summary itself if needed.
+		for len(history) > 0 && count(assemble(prefix, history)) > info.ContextWindow {
+			history = history[1:]
+		}
+	}
+	messages := assemble(prefix, history)
+	if tokens := count(messages); tokens > info.ContextWindow {
+		overflow.Tokens = tokens
+		return overflow
+	}
+	req.Messages = messages
+	return nil
+}
@@ -0,0 +1,198 @@
+package blades
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ContinuationsKey is the metadata key of the number of continuations merged
+// into a message by WithAutoContinue.
+const ContinuationsKey = "continuations"
+
+// continuePrompt asks the model to resume a response cut off by the output token limit.
+const continuePrompt = "Your previous response was cut off. Continue exactly where it stopped, without repeating or introducing anything."
+
+// WithAutoContinue makes the Agent continue responses cut off by the output
+// token limit with up to maxContinuations follow-up requests, merging the
+// pieces into one message with aggregated usage. Disabled by default.
+func WithAutoContinue(maxContinuations int) AgentOption {
+	return func(a *agent) {
+		a.maxContinuations = maxContinuations
+	}
+}
+
+// truncated reports whether the message is an answer cut off by the output token limit.
+func truncated(message *Message) bool {
+	return message.Role == RoleAssistant && message.FinishReason == FinishReasonLength
+}
+
+// continueRequest returns the request for the continuation of the partial answer.
+func continueRequest(req *ModelRequest, partial *Message) *ModelRequest {
+	next := *req
+	next.Messages = append(slices.Clip(req.Messages), partial, UserMessage(continuePrompt))
+	// Only the selected candidate is continued.
+	next.Options.CandidateCount = 0
+	return &next
+}
+
+// generate calls the model, continuing answers cut off by the output token limit.
+func (a *agent) generate(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+	res, err := a.provider(ctx).Generate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.selectCandidate(ctx, res); err != nil {
+		return nil, err
+	}
+	for n := 1; n <= a.maxContinuations && truncated(res.Message); n++ {
+		next, err := a.provider(ctx).Generate(ctx, continueRequest(req, res.Message))
+		if err != nil {
+			return nil, err
+		}
+		mergeContinuation(res.Message, next.Message, n)
+	}
+	return res, nil
+}
+
+// stream streams the model response, continuing answers cut off by the output
+// token limit. The deltas of the continuations are streamed as they arrive and
+// only the merged final message is yielded.
+func (a *agent) stream(ctx context.Context, req *ModelRequest) Generator[*ModelResponse, error] {
+	if req.Options.CandidateCount > 1 {
+		return func(yield func(*ModelResponse, error) bool) {
+			yield(nil, fmt.Errorf("agent %s: %w", a.name, ErrStreamingCandidates))
+		}
+	}
+	if a.maxContinuations <= 0 {
+		return a.provider(ctx).NewStreaming(ctx, req)
+	}
+	return func(yield func(*ModelResponse, error) bool) {
+		var final *ModelResponse
+		for n := 0; n <= a.maxContinuations; n++ {
+			segmentReq := req
+			seam := &fenceSeam{}
+			if final != nil {
+				segmentReq = continueRequest(req, final.Message)
+				seam.open = openFence(final.Message.Text())
+			}
+			var last *ModelResponse
+			for res, err := range a.provider(ctx).NewStreaming(ctx, segmentReq) {
+				if err != nil {
+					yield(nil, err)
+					return
+				}
+				if res.Message.Status == StatusIncomplete && res.Message.Role == RoleAssistant {
+					if final != nil {
+						text, ok := seam.next(res.Message.Text())
+						if !ok {
+							continue
+						}
+						res.Message.Parts = Parts(text)
+					}
+					if !yield(res, nil) {
+						return
+					}
+					continue
+				}
+				// Hold back the last message of the segment, which may be merged.
+				if last != nil && !yield(last, nil) {
+					return
+				}
+				last = res
+			}
+			if last == nil {
+				if final != nil {
+					yield(final, nil)
+				}
+				return
+			}
+			if final == nil {
+				final = last
+			} else {
+				mergeContinuation(final.Message, last.Message, n)
+			}
+			if !truncated(final.Message) {
+				break
+			}
+		}
+		yield(final, nil)
+	}
+}
+
+// mergeContinuation appends the continuation to the partial message.
+func mergeContinuation(message, continuation *Message, n int) {
+	text := joinContinuation(message.Text(), continuation.Text())
+	parts := Parts(text)
+	for _, part := range slices.Concat(message.Parts, continuation.Parts) {
+		if _, ok := part.(TextPart); !ok {
+			parts = append(parts, part)
+		}
+	}
+	message.Parts = parts
+	message.FinishReason = continuation.FinishReason
+	message.TokenUsage = message.TokenUsage.Add(continuation.TokenUsage)
+	if message.Metadata == nil {
+		message.Metadata = make(map[string]any)
+	}
+	message.Metadata[ContinuationsKey] = n
+}
+
+// joinContinuation concatenates the pieces, dropping the code fence the
+// continuation re-opens when the partial text was cut off inside a code block.
+func joinContinuation(partial, continuation string) string {
+	if openFence(partial) {
+		continuation = stripFence(continuation)
+	}
+	return partial + continuation
+}
+
+// openFence reports whether the text ends inside a fenced code block.
+func openFence(text string) bool {
+	open := false
+	for line := range strings.Lines(text) {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			open = !open
+		}
+	}
+	return open
+}
+
+// stripFence removes a leading fence line, e.g. "```go\n", from the text.
+func stripFence(text string) string {
+	trimmed := strings.TrimLeft(text, " \t\r\n")
+	if !strings.HasPrefix(trimmed, "```") {
+		return text
+	}
+	if i := strings.IndexByte(trimmed, '\n'); i >= 0 {
+		return trimmed[i+1:]
+	}
+	return ""
+}
+
+// fenceSeam strips a re-opened fence from the first deltas of a streamed continuation.
+type fenceSeam struct {
+	open    bool
+	done    bool
+	pending strings.Builder
+}
+
+// next returns the text to stream for the delta, or false while it cannot yet
+// tell whether the continuation starts with a fence.
+func (s *fenceSeam) next(delta string) (string, bool) {
+	if !s.open || s.done {
+		return delta, true
+	}
+	s.pending.WriteString(delta)
+	buffered := s.pending.String()
+	trimmed := strings.TrimLeft(buffered, " \t\r\n")
+	switch {
+	case trimmed == "" || (len(trimmed) < 3 && strings.HasPrefix("```", trimmed)):
+		return "", false
+	case strings.HasPrefix(trimmed, "```") && !strings.Contains(trimmed, "\n"):
+		return "", false
+	}
+	s.done = true
+	return stripFence(buffered), true
+}
@@ -0,0 +1,117 @@
+package blades
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// truncatingModel returns one segment per call, cut off by the output token
+// limit except for the last one, streaming each segment in two deltas.
+type truncatingModel struct {
+	segments []string
+	calls    int
+}
+
+func (m *truncatingModel) Name() string { return "truncating" }
+
+func (m *truncatingModel) response() *ModelResponse {
+	i := min(m.calls, len(m.segments)-1)
+	m.calls++
+	message := NewAssistantMessage(StatusCompleted)
+	message.Parts = Parts(m.segments[i])
+	message.FinishReason = "stop"
+	if i < len(m.segments)-1 {
+		message.FinishReason = FinishReasonLength
+	}
+	message.TokenUsage = TokenUsage{InputTokens: 10, OutputTokens: 5, TotalTokens: 15}
+	return &ModelResponse{Message: message}
+}
+
+func (m *truncatingModel) Generate(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+	return m.response(), nil
+}
+
+func (m *truncatingModel) NewStreaming(ctx context.Context, req *ModelRequest) Generator[*ModelResponse, error] {
+	return func(yield func(*ModelResponse, error) bool) {
+		res := m.response()
+		text := res.Message.Text()
+		for _, delta := range []string{text[:len(text)/2], text[len(text)/2:]} {
+			chunk := NewAssistantMessage(StatusIncomplete)
+			chunk.Parts = Parts(delta)
+			if !yield(&ModelResponse{Message: chunk}, nil) {
+				return
+			}
+		}
+		yield(res, nil)
+	}
+}
+
+func TestAutoContinue(t *testing.T) {
+	tests := []struct {
+		name          string
+		segments      []string
+		max           int
+		want          string
+		wantCalls     int
+		wantFinish    FinishReason
+		continuations int
+	}{
+		{"natural stop", []string{"Hello."}, 3, "Hello.", 1, "stop", 0},
+		{"disabled", []string{"The quick ", "brown fox."}, 0, "The quick ", 1, FinishReasonLength, 0},
+		{"continued", []string{"The quick ", "brown ", "fox."}, 3, "The quick brown fox.", 3, "stop", 2},
+		{"bounded", []string{"a", "b", "c", "d", "e"}, 2, "abc", 3, FinishReasonLength, 2},
+		{
+			"code fence seam",
+			[]string{"Here:\n```go\nfunc main() {\n", "```go\n\tprintln(1)\n}\n```\nDone."},
+			1,
+			"Here:\n```go\nfunc main() {\n\tprintln(1)\n}\n```\nDone.",
+			2, "stop", 1,
+		},
+	}
+	for _, tt := range tests {
+		for _, streamable := range []bool{false, true} {
+			name := tt.name
+			if streamable {
+				name += "/streaming"
+			}
+			t.Run(name, func(t *testing.T) {
+				model := &truncatingModel{segments: tt.segments}
+				agent, err := NewAgent("writer", WithModel(model), WithAutoContinue(tt.max))
+				if err != nil {
+					t.Fatal(err)
+				}
+				var (
+					final    *Message
+					streamed strings.Builder
+				)
+				invocation := &Invocation{Message: UserMessage("write"), Streamable: streamable}
+				for message, err := range agent.Run(context.Background(), invocation) {
+					if err != nil {
+						t.Fatal(err)
+					}
+					if message.Status == StatusIncomplete {
+						streamed.WriteString(message.Text())
+						continue
+					}
+					final = message
+				}
+				if final.Text() != tt.want {
+					t.Fatalf("want %q, got %q", tt.want, final.Text())
+				}
+				if streamable && streamed.String() != tt.want {
+					t.Fatalf("want streamed %q, got %q", tt.want, streamed.String())
+				}
+				if model.calls != tt.wantCalls || final.FinishReason != tt.wantFinish {
+					t.Fatalf("want %d calls ending with %q, got %d ending with %q", tt.wantCalls, tt.wantFinish, model.calls, final.FinishReason)
+				}
+				if got := final.TokenUsage.TotalTokens; got != int64(15*tt.wantCalls) {
+					t.Fatalf("want aggregated usage %d, got %d", 15*tt.wantCalls, got)
+				}
+				if got, _ := final.Metadata[ContinuationsKey].(int); got != tt.continuations {
+					t.Fatalf("want %d continuations, got %d", tt.continuations, got)
+				}
+			})
+		}
+	}
+}
@@ -2,11 +2,13 @@ package anthropic
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/anthropics/anthropic-sdk-go/option"
 	"github.com/go-kratos/blades"
+	"github.com/go-kratos/blades/stream"
 )
 
 // Config holds configuration options for the Claude client.
@@ -52,33 +54,75 @@ func (m *Claude) Name() string {
 	return m.model
 }
 
+// Capabilities reports that the adapter does not send output schemas, so that
+// agents describe the schema in the instruction instead, and that the API
+// returns no log probabilities.
+// It implements blades.CapabilityProvider.
+func (m *Claude) Capabilities(model string) blades.ModelCapabilities {
+	return blades.ModelCapabilities{StructuredOutput: blades.Unsupported, Logprobs: blades.Unsupported}
+}
+
+// Check verifies that the API is reachable and serves the model.
+// It implements blades.Checkable.
+func (m *Claude) Check(ctx context.Context) error {
+	_, err := m.client.Models.Get(ctx, blades.ResolveModel(ctx, m.model), anthropic.ModelGetParams{}, requestOptions(ctx)...)
+	return err
+}
+
 // Generate generates content using the Claude API.
 // Returns blades.ModelResponse instead of SDK-specific types.
 func (m *Claude) Generate(ctx context.Context, req *blades.ModelRequest) (*blades.ModelResponse, error) {
-	params, err := m.toClaudeParams(req)
+	params, err := m.toClaudeParams(ctx, req)
 	if err != nil {
 		return nil, fmt.Errorf("converting request: %w", err)
 	}
-	message, err := m.client.Messages.New(ctx, *params)
+	message, err := m.client.Messages.New(ctx, *params, requestOptions(ctx)...)
 	if err != nil {
 		return nil, fmt.Errorf("generating content: %w", err)
 	}
-	return convertClaudeToBlades(message, blades.StatusCompleted)
+	res, err := convertClaudeToBlades(message, blades.StatusCompleted)
+	if err != nil {
+		return nil, err
+	}
+	res.RawResponse = json.RawMessage(message.RawJSON())
+	m.annotateIgnoredOptions(res.Message, req)
+	return res, nil
+}
+
+// RenderRequest returns the JSON body of the messages request.
+func (m *Claude) RenderRequest(ctx context.Context, req *blades.ModelRequest) (json.RawMessage, error) {
+	params, err := m.toClaudeParams(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("converting request: %w", err)
+	}
+	return json.Marshal(params)
 }
 
 // NewStreaming executes the request and returns a stream of assistant responses.
 func (m *Claude) NewStreaming(ctx context.Context, req *blades.ModelRequest) blades.Generator[*blades.ModelResponse, error] {
 	return func(yield func(*blades.ModelResponse, error) bool) {
-		params, err := m.toClaudeParams(req)
+		params, err := m.toClaudeParams(ctx, req)
 		if err != nil {
 			yield(nil, err)
 			return
 		}
-		streaming := m.client.Messages.NewStreaming(ctx, *params)
-		defer streaming.Close()
+		// The events are read ahead of the consumer through a pipe.
+		events := stream.Produce(ctx, func(ctx context.Context, send func(anthropic.MessageStreamEventUnion) error) error {
+			streaming := m.client.Messages.NewStreaming(ctx, *params, requestOptions(ctx)...)
+			defer streaming.Close()
+			for streaming.Next() {
+				if err := send(streaming.Current()); err != nil {
+					return err
+				}
+			}
+			return streaming.Err()
+		})
 		message := &anthropic.Message{}
-		for streaming.Next() {
-			event := streaming.Current()
+		for event, err := range events {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
 			if err := message.Accumulate(event); err != nil {
 				yield(nil, err)
 				return
@@ -89,28 +133,64 @@ func (m *Claude) NewStreaming(ctx context.Context, req *blades.ModelRequest) bla
 					yield(nil, err)
 					return
 				}
+				response.RawResponse = json.RawMessage(event.RawJSON())
 				if !yield(response, nil) {
 					return
 				}
 			}
 		}
-		if err := streaming.Err(); err != nil {
-			yield(nil, err)
-			return
-		}
 		finalResponse, err := convertClaudeToBlades(message, blades.StatusCompleted)
 		if err != nil {
 			yield(nil, err)
 			return
 		}
+		m.annotateIgnoredOptions(finalResponse.Message, req)
 		yield(finalResponse, nil)
 	}
 }
 
+// annotateIgnoredOptions notes the model options that Claude does not support,
+// including a Seed set in the Config.
+func (m *Claude) annotateIgnoredOptions(message *blades.Message, req *blades.ModelRequest) {
+	var ignored []string
+	if m.config.Seed > 0 || req.Options.Seed != nil {
+		ignored = append(ignored, "seed")
+	}
+	if req.Options.FrequencyPenalty != nil {
+		ignored = append(ignored, "frequency_penalty")
+	}
+	if req.Options.PresencePenalty != nil {
+		ignored = append(ignored, "presence_penalty")
+	}
+	if req.Options.CandidateCount > 1 {
+		ignored = append(ignored, "candidate_count")
+	}
+	if len(ignored) > 0 {
+		message.Metadata[blades.IgnoredOptionsKey] = ignored
+	}
+}
+
+// requestOptions returns the per-request options that override the client's
+// base URL and API key with the blades.RequestConfig carried by ctx.
+func requestOptions(ctx context.Context) []option.RequestOption {
+	config, ok := blades.FromRequestConfigContext(ctx)
+	if !ok {
+		return nil
+	}
+	var opts []option.RequestOption
+	if config.BaseURL != "" {
+		opts = append(opts, option.WithBaseURL(config.BaseURL))
+	}
+	if config.APIKey != "" {
+		opts = append(opts, option.WithAPIKey(config.APIKey))
+	}
+	return opts
+}
+
 // toClaudeParams converts Blades ModelRequest and ModelOptions to Claude MessageNewParams.
-func (m *Claude) toClaudeParams(req *blades.ModelRequest) (*anthropic.MessageNewParams, error) {
+func (m *Claude) toClaudeParams(ctx context.Context, req *blades.ModelRequest) (*anthropic.MessageNewParams, error) {
 	params := &anthropic.MessageNewParams{
-		Model: anthropic.Model(m.model),
+		Model: anthropic.Model(blades.ResolveModel(ctx, m.model)),
 	}
 	if m.config.MaxOutputTokens > 0 {
 		params.MaxTokens = m.config.MaxOutputTokens
@@ -130,26 +210,30 @@ func (m *Claude) toClaudeParams(req *blades.ModelRequest) (*anthropic.MessageNew
 	if m.config.Thinking != nil {
 		params.Thinking = *m.config.Thinking
 	}
+	// Per-request model options override the static config.
+	if len(req.Options.StopSequences) > 0 {
+		params.StopSequences = req.Options.StopSequences
+	}
+	if req.Options.TopK != nil {
+		params.TopK = anthropic.Int(*req.Options.TopK)
+	}
+	// The system prompt takes several text blocks: the instruction, then the
+	// system and developer messages in order.
 	if req.Instruction != nil {
-		params.System = []anthropic.TextBlockParam{{Text: req.Instruction.Text()}}
+		params.System = append(params.System, anthropic.TextBlockParam{Text: req.Instruction.Text()})
 	}
 	for _, msg := range req.Messages {
 		switch msg.Role {
-		case blades.RoleSystem:
-			params.System = []anthropic.TextBlockParam{{Text: msg.Text()}}
+		case blades.RoleSystem, blades.RoleDeveloper:
+			params.System = append(params.System, anthropic.TextBlockParam{Text: msg.Text()})
 		case blades.RoleUser:
 			params.Messages = append(params.Messages, anthropic.NewUserMessage(convertPartsToContent(msg.Parts)...))
 		case blades.RoleAssistant:
-			params.Messages = append(params.Messages, anthropic.NewUserMessage(convertPartsToContent(msg.Parts)...))
+			params.Messages = append(params.Messages, anthropic.NewAssistantMessage(convertPartsToContent(msg.Parts)...))
 		case blades.RoleTool:
-			var content []anthropic.ContentBlockParamUnion
-			for _, part := range msg.Parts {
-				switch v := any(part).(type) {
-				case blades.ToolPart:
-					content = append(content, anthropic.NewToolResultBlock(v.ID, v.Response, false))
-				}
-			}
-			params.Messages = append(params.Messages, anthropic.NewUserMessage(content...))
+			// Each tool_result must answer a tool_use of the preceding assistant message.
+			content, results := convertToolParts(msg.Parts)
+			params.Messages = append(params.Messages, anthropic.NewAssistantMessage(content...), anthropic.NewUserMessage(results...))
 		}
 	}
 	if len(req.Tools) > 0 {
@@ -159,5 +243,55 @@ func (m *Claude) toClaudeParams(req *blades.ModelRequest) (*anthropic.MessageNew
 		}
 		params.Tools = tools
 	}
+	if req.Options.CacheHint {
+		setCacheBreakpoints(params)
+	}
+	if err := applyExtensions(params, req); err != nil {
+		return params, err
+	}
 	return params, nil
 }
+
+// applyExtensions merges the provider extensions of the request into the JSON
+// body of params. A field the params already set is a conflict that wraps
+// blades.ErrExtensionConflict.
+func applyExtensions(params *anthropic.MessageNewParams, req *blades.ModelRequest) error {
+	extensions := req.ProviderExtensions()
+	if len(extensions) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("extensions: %w", err)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(data, &body); err != nil {
+		return fmt.Errorf("extensions: %w", err)
+	}
+	if err := blades.MergeExtensions(body, extensions); err != nil {
+		return err
+	}
+	// Merged objects replace the fields they extend.
+	fields := make(map[string]any, len(extensions))
+	for key := range extensions {
+		fields[key] = body[key]
+	}
+	params.SetExtraFields(fields)
+	return nil
+}
+
+// setCacheBreakpoints marks the system prompt and the end of the message
+// history with cache_control, so that the next turn reads both from the cache.
+func setCacheBreakpoints(params *anthropic.MessageNewParams) {
+	if n := len(params.System); n > 0 {
+		params.System[n-1].CacheControl = anthropic.NewCacheControlEphemeralParam()
+	}
+	if n := len(params.Messages); n > 0 {
+		content := params.Messages[n-1].Content
+		if m := len(content); m > 0 {
+			if cc := content[m-1].GetCacheControl(); cc != nil {
+				*cc = anthropic.NewCacheControlEphemeralParam()
+			}
+		}
+	}
+}
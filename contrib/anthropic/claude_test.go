@@ -0,0 +1,394 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/go-kratos/blades"
+	"github.com/go-kratos/blades/providertest"
+)
+
+func TestClaudeParamsModelOptions(t *testing.T) {
+	model := &Claude{model: "claude-test", config: Config{MaxOutputTokens: 64, TopK: 5}}
+	req := &blades.ModelRequest{Messages: []*blades.Message{blades.UserMessage("List two colors.")}}
+	req.Options.Apply(
+		blades.Seed(7),
+		blades.StopSequences("\n\n"),
+		blades.FrequencyPenalty(0.5),
+		blades.TopK(40),
+	)
+	params, err := model.toClaudeParams(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got["stop_sequences"], []any{"\n\n"}) || got["top_k"] != float64(40) {
+		t.Fatalf("unexpected params: %s", data)
+	}
+	for _, key := range []string{"seed", "frequency_penalty"} {
+		if _, ok := got[key]; ok {
+			t.Fatalf("%s is not supported by Claude and must not be sent", key)
+		}
+	}
+
+	message := blades.NewAssistantMessage(blades.StatusCompleted)
+	model.annotateIgnoredOptions(message, req)
+	if want := []string{"seed", "frequency_penalty"}; !reflect.DeepEqual(message.Metadata[blades.IgnoredOptionsKey], want) {
+		t.Fatalf("want ignored options %v, got %v", want, message.Metadata[blades.IgnoredOptionsKey])
+	}
+	// A seed in the config is reported too.
+	seeded := &Claude{model: "claude-test", config: Config{Seed: 7}}
+	message = blades.NewAssistantMessage(blades.StatusCompleted)
+	seeded.annotateIgnoredOptions(message, &blades.ModelRequest{})
+	if want := []string{"seed"}; !reflect.DeepEqual(message.Metadata[blades.IgnoredOptionsKey], want) {
+		t.Fatalf("want ignored options %v, got %v", want, message.Metadata[blades.IgnoredOptionsKey])
+	}
+}
+
+func TestClaudeParamsCacheHint(t *testing.T) {
+	model := &Claude{model: "claude-test", config: Config{MaxOutputTokens: 64}}
+	req := &blades.ModelRequest{
+		Instruction: blades.SystemMessage("You are a long, static assistant prompt."),
+		Messages: []*blades.Message{
+			blades.UserMessage("Hello"),
+			blades.AssistantMessage("Hi"),
+			blades.UserMessage("List two colors."),
+		},
+	}
+	req.Options.Apply(blades.CacheHint())
+	params, err := model.toClaudeParams(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		System []struct {
+			CacheControl map[string]any `json:"cache_control"`
+		} `json:"system"`
+		Messages []struct {
+			Content []struct {
+				CacheControl map[string]any `json:"cache_control"`
+			} `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	ephemeral := map[string]any{"type": "ephemeral"}
+	if len(got.System) != 1 || !reflect.DeepEqual(got.System[0].CacheControl, ephemeral) {
+		t.Fatalf("expected a cache breakpoint on the system prompt: %s", data)
+	}
+	for i, msg := range got.Messages {
+		want := i == len(got.Messages)-1
+		if has := msg.Content[0].CacheControl != nil; has != want {
+			t.Fatalf("message %d: cache breakpoint %v, want %v: %s", i, has, want, data)
+		}
+	}
+}
+
+func TestClaudeParamsSystemMessages(t *testing.T) {
+	model := &Claude{model: "claude-test", config: Config{MaxOutputTokens: 64}}
+	req := &blades.ModelRequest{
+		Instruction: blades.SystemMessage("Be brief."),
+		Messages: []*blades.Message{
+			blades.SystemMessage("Answer in French."),
+			blades.DeveloperMessage("Use metric units."),
+			blades.UserMessage("Hello"),
+		},
+	}
+	params, err := model.toClaudeParams(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		System []struct {
+			Text string `json:"text"`
+		} `json:"system"`
+		Messages []struct {
+			Role string `json:"role"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	var system []string
+	for _, block := range got.System {
+		system = append(system, block.Text)
+	}
+	if want := []string{"Be brief.", "Answer in French.", "Use metric units."}; !reflect.DeepEqual(system, want) {
+		t.Fatalf("want system blocks %q, got %q", want, system)
+	}
+	if len(got.Messages) != 1 || got.Messages[0].Role != "user" {
+		t.Fatalf("want only the user message, got %s", data)
+	}
+}
+
+func TestConvertUsage(t *testing.T) {
+	var message anthropic.Message
+	if err := json.Unmarshal([]byte(`{"id":"m1","type":"message","role":"assistant","model":"claude-test",
+		"content":[{"type":"text","text":"red"}],
+		"usage":{"input_tokens":10,"cache_read_input_tokens":900,"cache_creation_input_tokens":90,"output_tokens":5}}`), &message); err != nil {
+		t.Fatal(err)
+	}
+	res, err := convertClaudeToBlades(&message, blades.StatusCompleted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := blades.TokenUsage{
+		InputTokens:           1000,
+		OutputTokens:          5,
+		TotalTokens:           1005,
+		CachedInputTokens:     900,
+		CacheWriteInputTokens: 90,
+	}
+	if res.Message.TokenUsage != want {
+		t.Fatalf("want usage %+v, got %+v", want, res.Message.TokenUsage)
+	}
+}
+
+func TestConvertStopReason(t *testing.T) {
+	tests := []struct {
+		name     string
+		message  string
+		want     blades.FinishReason
+		wantText string
+	}{
+		{
+			name:     "end turn",
+			message:  `{"id":"m1","type":"message","role":"assistant","model":"claude-test","stop_reason":"end_turn","content":[{"type":"text","text":"red"}],"usage":{"input_tokens":10,"output_tokens":1}}`,
+			want:     blades.FinishReasonStop,
+			wantText: "red",
+		},
+		{
+			name:     "refusal",
+			message:  `{"id":"m2","type":"message","role":"assistant","model":"claude-test","stop_reason":"refusal","content":[{"type":"text","text":"I can't help"}],"usage":{"input_tokens":10,"output_tokens":3}}`,
+			want:     blades.FinishReasonRefusal,
+			wantText: "I can't help",
+		},
+		{
+			name:    "tool use",
+			message: `{"id":"m3","type":"message","role":"assistant","model":"claude-test","stop_reason":"tool_use","content":[{"type":"tool_use","id":"t1","name":"weather","input":{}}],"usage":{"input_tokens":10,"output_tokens":3}}`,
+			want:    blades.FinishReasonToolCalls,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var message anthropic.Message
+			if err := json.Unmarshal([]byte(tt.message), &message); err != nil {
+				t.Fatal(err)
+			}
+			res, err := convertClaudeToBlades(&message, blades.StatusCompleted)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Message.FinishReason != tt.want || res.Message.Text() != tt.wantText {
+				t.Fatalf("want %q with %q, got %q with %q", tt.want, tt.wantText, res.Message.FinishReason, res.Message.Text())
+			}
+			if res.Message.IsRefusal() != (tt.want == blades.FinishReasonRefusal) {
+				t.Fatalf("unexpected IsRefusal for %q", res.Message.FinishReason)
+			}
+		})
+	}
+}
+
+func TestClaudeParamsToolHistory(t *testing.T) {
+	model := &Claude{model: "claude-test", config: Config{MaxOutputTokens: 64}}
+	req := &blades.ModelRequest{
+		Messages: []*blades.Message{
+			blades.UserMessage("Weather in Paris?"),
+			{Role: blades.RoleTool, Parts: []blades.Part{
+				blades.ToolPart{ID: "call-1", Name: "weather", Request: `{"city":"Paris"}`, Response: "sunny"},
+			}},
+			blades.AssistantMessage("It is sunny."),
+			blades.UserMessage("And tomorrow?"),
+		},
+	}
+	params, err := model.toClaudeParams(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Messages []struct {
+			Role    string `json:"role"`
+			Content []struct {
+				Type      string         `json:"type"`
+				ID        string         `json:"id"`
+				Name      string         `json:"name"`
+				Input     map[string]any `json:"input"`
+				ToolUseID string         `json:"tool_use_id"`
+			} `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	var roles []string
+	for _, msg := range got.Messages {
+		roles = append(roles, msg.Role)
+	}
+	if want := []string{"user", "assistant", "user", "assistant", "user"}; !reflect.DeepEqual(roles, want) {
+		t.Fatalf("want roles %q, got %q", want, roles)
+	}
+	use, result := got.Messages[1].Content[0], got.Messages[2].Content[0]
+	if use.Type != "tool_use" || use.ID != "call-1" || use.Name != "weather" || use.Input["city"] != "Paris" {
+		t.Fatalf("want the tool_use block replayed, got %s", data)
+	}
+	if result.Type != "tool_result" || result.ToolUseID != "call-1" {
+		t.Fatalf("want the tool_result linked to the call, got %s", data)
+	}
+}
+
+func TestClaudeInterleavedToolCalls(t *testing.T) {
+	want := []blades.Part{
+		blades.TextPart{Text: "Let me check the weather."},
+		blades.ToolPart{ID: "toolu_1", Name: "weather", Request: `{"city":"Paris"}`},
+		blades.TextPart{Text: "And the time there."},
+		blades.ToolPart{ID: "toolu_2", Name: "time", Request: `{"city":"Paris"}`},
+	}
+	fixture, err := os.ReadFile(filepath.Join("testdata", "tool_message.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var message anthropic.Message
+	if err := json.Unmarshal(fixture, &message); err != nil {
+		t.Fatal(err)
+	}
+	res, err := convertClaudeToBlades(&message, blades.StatusCompleted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Message.Role != blades.RoleTool || !reflect.DeepEqual(res.Message.Parts, want) {
+		t.Fatalf("want a tool message with the text around the calls, got %s %#v", res.Message.Role, res.Message.Parts)
+	}
+
+	server := providertest.ServeSSE(t, filepath.Join("testdata", "tool_stream.txt"), 0)
+	model := NewModel("claude-test", Config{
+		BaseURL:         server.URL,
+		APIKey:          "test",
+		MaxOutputTokens: 64,
+		RequestOptions:  []option.RequestOption{option.WithMaxRetries(0)},
+	})
+	var (
+		streamed string
+		final    *blades.Message
+	)
+	for res, err := range model.NewStreaming(context.Background(), &blades.ModelRequest{Messages: []*blades.Message{blades.UserMessage("Weather in Paris?")}}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Message.Status == blades.StatusIncomplete {
+			streamed += res.Message.Text()
+		}
+		final = res.Message
+	}
+	if streamed != "Let me check the weather.And the time there." {
+		t.Fatalf("want the narration streamed, got %q", streamed)
+	}
+	if final.Role != blades.RoleTool || !reflect.DeepEqual(final.Parts, want) {
+		t.Fatalf("want a tool message with the text around the calls, got %s %#v", final.Role, final.Parts)
+	}
+
+	// The history replays the assistant turn in order, then the results.
+	history := &blades.Message{Role: blades.RoleTool, Parts: slices.Clone(want)}
+	history.Parts[1] = blades.ToolPart{ID: "toolu_1", Name: "weather", Request: `{"city":"Paris"}`, Response: "sunny"}
+	history.Parts[3] = blades.ToolPart{ID: "toolu_2", Name: "time", Request: `{"city":"Paris"}`, Response: "10:00"}
+	params, err := model.(*Claude).toClaudeParams(context.Background(), &blades.ModelRequest{Messages: []*blades.Message{blades.UserMessage("Weather in Paris?"), history}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Messages []struct {
+			Role    string `json:"role"`
+			Content []struct {
+				Type      string `json:"type"`
+				Text      string `json:"text"`
+				ToolUseID string `json:"tool_use_id"`
+			} `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	var blocks []string
+	for _, block := range got.Messages[1].Content {
+		blocks = append(blocks, block.Type)
+	}
+	if want := []string{"text", "tool_use", "text", "tool_use"}; got.Messages[1].Role != "assistant" || !reflect.DeepEqual(blocks, want) {
+		t.Fatalf("want the assistant turn %q, got %s", want, data)
+	}
+	if results := got.Messages[2].Content; len(results) != 2 || results[0].ToolUseID != "toolu_1" || results[1].ToolUseID != "toolu_2" {
+		t.Fatalf("want both results answered, got %s", data)
+	}
+}
+
+func TestClaudeParamsExtensions(t *testing.T) {
+	model := &Claude{model: "claude-test", config: Config{MaxOutputTokens: 64}}
+	req := &blades.ModelRequest{Messages: []*blades.Message{blades.UserMessage("Hello")}}
+	req.Options.Apply(blades.ProviderOptions(map[string]any{"service_tier": "standard_only"}))
+	req.Extensions = map[string]any{"metadata": map[string]any{"user_id": "u-1"}}
+	params, err := model.toClaudeParams(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["service_tier"] != "standard_only" || got["max_tokens"] != float64(64) {
+		t.Fatalf("want the provider options merged into the request, got %s", data)
+	}
+	if metadata, _ := got["metadata"].(map[string]any); metadata["user_id"] != "u-1" {
+		t.Fatalf("want the extensions merged into the request, got %s", data)
+	}
+
+	req.Extensions = map[string]any{"max_tokens": 128}
+	if _, err := model.toClaudeParams(context.Background(), req); !errors.Is(err, blades.ErrExtensionConflict) {
+		t.Fatalf("want a conflict with max_tokens, got %v", err)
+	}
+}
+
+func TestClaudeStreamingConformance(t *testing.T) {
+	server := providertest.ServeSSE(t, filepath.Join("testdata", "stream.txt"), 50*time.Millisecond)
+	model := NewModel("claude-test", Config{
+		BaseURL:         server.URL,
+		APIKey:          "test",
+		MaxOutputTokens: 64,
+		RequestOptions:  []option.RequestOption{option.WithMaxRetries(0)},
+	})
+	providertest.TestStreaming(t, model, providertest.Config{CancelWithin: 150 * time.Millisecond})
+}
@@ -21,6 +21,28 @@ func convertPartsToContent(parts []blades.Part) []anthropic.ContentBlockParamUni
 	return content
 }
 
+// convertToolParts converts a tool message to the content of the assistant
+// turn, its text and tool_use blocks in order, and the tool_result blocks that
+// answer the calls.
+func convertToolParts(parts []blades.Part) (content, results []anthropic.ContentBlockParamUnion) {
+	for _, part := range parts {
+		switch v := part.(type) {
+		case blades.TextPart:
+			if v.Text != "" {
+				content = append(content, anthropic.NewTextBlock(v.Text))
+			}
+		case blades.ToolPart:
+			input := json.RawMessage(v.Request)
+			if !json.Valid(input) {
+				input = json.RawMessage("{}")
+			}
+			content = append(content, anthropic.NewToolUseBlock(v.ID, input, v.Name))
+			results = append(results, anthropic.NewToolResultBlock(v.ID, v.Response, false))
+		}
+	}
+	return content, results
+}
+
 // convertBladesToolsToClaude converts Blades Tools to Claude ToolParams.
 func convertBladesToolsToClaude(tools []tools.Tool) ([]anthropic.ToolUnionParam, error) {
 	var claudeTools []anthropic.ToolUnionParam
@@ -47,9 +69,30 @@ func convertBladesToolsToClaude(tools []tools.Tool) ([]anthropic.ToolUnionParam,
 	return claudeTools, nil
 }
 
-// convertClaudeToBlades converts a Claude Message to Blades ModelResponse.
+// convertStopReason converts a Claude stop reason. Reasons without a
+// counterpart are kept as they are.
+func convertStopReason(reason anthropic.StopReason) blades.FinishReason {
+	switch reason {
+	case anthropic.StopReasonEndTurn, anthropic.StopReasonStopSequence:
+		return blades.FinishReasonStop
+	case anthropic.StopReasonMaxTokens:
+		return blades.FinishReasonLength
+	case anthropic.StopReasonToolUse:
+		return blades.FinishReasonToolCalls
+	case anthropic.StopReasonRefusal:
+		return blades.FinishReasonRefusal
+	default:
+		return blades.FinishReason(reason)
+	}
+}
+
+// convertClaudeToBlades converts a Claude Message to Blades ModelResponse. A
+// message with tool_use blocks is a tool message, whose parts keep the text
+// the model said around the calls in order.
 func convertClaudeToBlades(message *anthropic.Message, status blades.Status) (*blades.ModelResponse, error) {
 	msg := blades.NewAssistantMessage(status)
+	msg.TokenUsage = convertUsage(message.Usage)
+	msg.FinishReason = convertStopReason(message.StopReason)
 	for _, block := range message.Content {
 		switch b := block.AsAny().(type) {
 		case anthropic.TextBlock:
@@ -59,6 +102,7 @@ func convertClaudeToBlades(message *anthropic.Message, status blades.Status) (*b
 			if err != nil {
 				return nil, err
 			}
+			msg.Role = blades.RoleTool
 			msg.Parts = append(msg.Parts, blades.ToolPart{
 				ID:      b.ID,
 				Name:    b.Name,
@@ -71,6 +115,19 @@ func convertClaudeToBlades(message *anthropic.Message, status blades.Status) (*b
 	}, nil
 }
 
+// convertUsage converts Claude usage to Blades TokenUsage. Claude reports the
+// cached input tokens separately, so they are added to InputTokens.
+func convertUsage(usage anthropic.Usage) blades.TokenUsage {
+	input := usage.InputTokens + usage.CacheReadInputTokens + usage.CacheCreationInputTokens
+	return blades.TokenUsage{
+		InputTokens:           input,
+		OutputTokens:          usage.OutputTokens,
+		TotalTokens:           input + usage.OutputTokens,
+		CachedInputTokens:     usage.CacheReadInputTokens,
+		CacheWriteInputTokens: usage.CacheCreationInputTokens,
+	}
+}
+
 // convertStreamDeltaToBlades converts a Claude ContentBlockDeltaEvent to Blades ModelResponse.
 func convertStreamDeltaToBlades(event anthropic.ContentBlockDeltaEvent) (*blades.ModelResponse, error) {
 	message := blades.NewAssistantMessage(blades.StatusIncomplete)
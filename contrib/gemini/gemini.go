@@ -2,9 +2,12 @@ package gemini
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 
 	"github.com/go-kratos/blades"
+	"github.com/go-kratos/blades/stream"
 	"google.golang.org/genai"
 )
 
@@ -47,6 +50,24 @@ func (m *Gemini) Name() string {
 	return m.model
 }
 
+// Capabilities reports that the adapter does not send output schemas, so that
+// agents describe the schema in the instruction instead.
+// It implements blades.CapabilityProvider.
+func (m *Gemini) Capabilities(model string) blades.ModelCapabilities {
+	return blades.ModelCapabilities{StructuredOutput: blades.Unsupported}
+}
+
+// Check verifies that the API is reachable and serves the model.
+// It implements blades.Checkable.
+func (m *Gemini) Check(ctx context.Context) error {
+	client, err := m.clientFor(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = client.Models.Get(ctx, blades.ResolveModel(ctx, m.model), nil)
+	return err
+}
+
 func (m *Gemini) Generate(ctx context.Context, req *blades.ModelRequest) (*blades.ModelResponse, error) {
 	system, contents, err := convertMessageToGenAI(req)
 	if err != nil {
@@ -57,11 +78,131 @@ func (m *Gemini) Generate(ctx context.Context, req *blades.ModelRequest) (*blade
 		return nil, err
 	}
 	config.SystemInstruction = system
-	resp, err := m.client.Models.GenerateContent(ctx, m.model, contents, config)
+	client, err := m.clientFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := withExtensions(ctx, config, req)
+	defer cancel(nil)
+	resp, err := client.Models.GenerateContent(ctx, blades.ResolveModel(ctx, m.model), contents, config)
+	if err != nil {
+		return nil, extensionError(ctx, err)
+	}
+	res, err := convertGenAIToBlades(resp, blades.StatusCompleted)
 	if err != nil {
 		return nil, err
 	}
-	return convertGenAIToBlades(resp, blades.StatusCompleted)
+	res.RawResponse = rawResponse(resp)
+	return res, nil
+}
+
+// RenderRequest returns the model, contents and config of the request as
+// genai encodes them, with the provider extensions merged in.
+func (m *Gemini) RenderRequest(ctx context.Context, req *blades.ModelRequest) (json.RawMessage, error) {
+	system, contents, err := convertMessageToGenAI(req)
+	if err != nil {
+		return nil, err
+	}
+	config, err := m.toGenerateConfig(req)
+	if err != nil {
+		return nil, err
+	}
+	config.SystemInstruction = system
+	data, err := json.Marshal(map[string]any{
+		"model":    blades.ResolveModel(ctx, m.model),
+		"contents": contents,
+		"config":   config,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var body map[string]any
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, err
+	}
+	if err := blades.MergeExtensions(body, req.ProviderExtensions()); err != nil {
+		return nil, fmt.Errorf("gemini: %w", err)
+	}
+	return json.Marshal(body)
+}
+
+// appendParts appends the parts of a chunk, merging text into the last text
+// part so that the streamed text forms a single part.
+func appendParts(parts, chunk []*genai.Part) []*genai.Part {
+	for _, part := range chunk {
+		if n := len(parts); n > 0 && isText(parts[n-1]) && isText(part) && parts[n-1].Thought == part.Thought {
+			merged := *parts[n-1]
+			merged.Text += part.Text
+			parts[n-1] = &merged
+			continue
+		}
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// isText reports whether the part only carries text.
+func isText(part *genai.Part) bool {
+	return part.FunctionCall == nil && part.FunctionResponse == nil && part.InlineData == nil &&
+		part.FileData == nil && part.ExecutableCode == nil && part.CodeExecutionResult == nil
+}
+
+// withExtensions merges the provider extensions of the request into the body
+// genai builds for config. genai builds the body once the call has started,
+// so a conflict cancels the returned context with the error, which fails the
+// call before the request is sent.
+func withExtensions(ctx context.Context, config *genai.GenerateContentConfig, req *blades.ModelRequest) (context.Context, context.CancelCauseFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	extensions := req.ProviderExtensions()
+	if len(extensions) == 0 {
+		return ctx, cancel
+	}
+	if config.HTTPOptions == nil {
+		config.HTTPOptions = &genai.HTTPOptions{}
+	}
+	config.HTTPOptions.ExtrasRequestProvider = func(body map[string]any) map[string]any {
+		if err := blades.MergeExtensions(body, extensions); err != nil {
+			cancel(fmt.Errorf("gemini: %w", err))
+		}
+		return body
+	}
+	return ctx, cancel
+}
+
+// extensionError returns the extension conflict that cancelled ctx in place of err.
+func extensionError(ctx context.Context, err error) error {
+	if cause := context.Cause(ctx); errors.Is(cause, blades.ErrExtensionConflict) {
+		return cause
+	}
+	return err
+}
+
+// rawResponse returns the response as decoded by genai, which keeps the
+// fields blades does not model.
+func rawResponse(resp *genai.GenerateContentResponse) json.RawMessage {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// clientFor returns the client for the request. When ctx carries a
+// blades.RequestConfig with its own API key or base URL, a client with
+// those credentials is created; otherwise the shared client is used.
+func (m *Gemini) clientFor(ctx context.Context) (*genai.Client, error) {
+	rc, ok := blades.FromRequestConfigContext(ctx)
+	if !ok || (rc.APIKey == "" && rc.BaseURL == "") {
+		return m.client, nil
+	}
+	config := m.config.ClientConfig
+	if rc.APIKey != "" {
+		config.APIKey = rc.APIKey
+	}
+	if rc.BaseURL != "" {
+		config.HTTPOptions.BaseURL = rc.BaseURL
+	}
+	return genai.NewClient(ctx, &config)
 }
 
 func (m *Gemini) toGenerateConfig(req *blades.ModelRequest) (*genai.GenerateContentConfig, error) {
@@ -90,6 +231,28 @@ func (m *Gemini) toGenerateConfig(req *blades.ModelRequest) (*genai.GenerateCont
 	if m.config.Seed > 0 {
 		config.Seed = &m.config.Seed
 	}
+	// Per-request model options override the static config.
+	if req.Options.Seed != nil {
+		config.Seed = genai.Ptr(int32(*req.Options.Seed))
+	}
+	if len(req.Options.StopSequences) > 0 {
+		config.StopSequences = req.Options.StopSequences
+	}
+	if req.Options.FrequencyPenalty != nil {
+		config.FrequencyPenalty = genai.Ptr(float32(*req.Options.FrequencyPenalty))
+	}
+	if req.Options.PresencePenalty != nil {
+		config.PresencePenalty = genai.Ptr(float32(*req.Options.PresencePenalty))
+	}
+	if req.Options.TopK != nil {
+		config.TopK = genai.Ptr(float32(*req.Options.TopK))
+	}
+	if req.Options.CandidateCount > 0 {
+		config.CandidateCount = int32(req.Options.CandidateCount)
+	}
+	if req.Options.Logprobs {
+		config.ResponseLogprobs = true
+	}
 	if m.config.ThinkingConfig != nil {
 		config.ThinkingConfig = m.config.ThinkingConfig
 	}
@@ -106,6 +269,10 @@ func (m *Gemini) toGenerateConfig(req *blades.ModelRequest) (*genai.GenerateCont
 // NewStreaming is an alias for GenerateStream to implement the ModelProvider interface.
 func (m *Gemini) NewStreaming(ctx context.Context, req *blades.ModelRequest) blades.Generator[*blades.ModelResponse, error] {
 	return func(yield func(*blades.ModelResponse, error) bool) {
+		if req.Options.CandidateCount > 1 {
+			yield(nil, blades.ErrStreamingCandidates)
+			return
+		}
 		system, contents, err := convertMessageToGenAI(req)
 		if err != nil {
 			yield(nil, err)
@@ -117,11 +284,29 @@ func (m *Gemini) NewStreaming(ctx context.Context, req *blades.ModelRequest) bla
 			return
 		}
 		config.SystemInstruction = system
-		streaming := m.client.Models.GenerateContentStream(ctx, m.model, contents, config)
+		client, err := m.clientFor(ctx)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		ctx, cancel := withExtensions(ctx, config, req)
+		defer cancel(nil)
+		// The chunks are read ahead of the consumer through a pipe.
+		streaming := stream.Produce(ctx, func(ctx context.Context, send func(*genai.GenerateContentResponse) error) error {
+			for chunk, err := range client.Models.GenerateContentStream(ctx, blades.ResolveModel(ctx, m.model), contents, config) {
+				if err != nil {
+					return err
+				}
+				if err := send(chunk); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
 		var accumulatedResponse *genai.GenerateContentResponse
 		for chunk, err := range streaming {
 			if err != nil {
-				yield(nil, err)
+				yield(nil, extensionError(ctx, err))
 				return
 			}
 			response, err := convertGenAIToBlades(chunk, blades.StatusIncomplete)
@@ -129,6 +314,9 @@ func (m *Gemini) NewStreaming(ctx context.Context, req *blades.ModelRequest) bla
 				yield(nil, err)
 				return
 			}
+			response.RawResponse = rawResponse(chunk)
+			// Chunks report the usage so far; it is reported once, on the final response.
+			response.Message.TokenUsage = blades.TokenUsage{}
 			if !yield(response, nil) {
 				return
 			}
@@ -144,12 +332,18 @@ func (m *Gemini) NewStreaming(ctx context.Context, req *blades.ModelRequest) bla
 						if candidate.Content == nil {
 							candidate.Content = &genai.Content{Parts: []*genai.Part{}}
 						}
-						candidate.Content.Parts = append(candidate.Content.Parts, chunkCandidate.Content.Parts...)
+						candidate.Content.Parts = appendParts(candidate.Content.Parts, chunkCandidate.Content.Parts)
 					}
 					// Update finish reason if present
 					if chunkCandidate.FinishReason != "" {
 						candidate.FinishReason = chunkCandidate.FinishReason
 					}
+					// The average of a chunk does not cover the whole response.
+					candidate.AvgLogprobs = 0
+				}
+				// The last chunk reports the usage of the whole response.
+				if chunk.UsageMetadata != nil {
+					accumulatedResponse.UsageMetadata = chunk.UsageMetadata
 				}
 			}
 		}
@@ -0,0 +1,250 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/blades"
+	"github.com/go-kratos/blades/providertest"
+	"google.golang.org/genai"
+)
+
+func TestGenerateConfigModelOptions(t *testing.T) {
+	model := &Gemini{model: "gemini-test", config: Config{TopK: 10, StopSequences: []string{"END"}}}
+	req := &blades.ModelRequest{}
+	req.Options.Apply(
+		blades.Seed(7),
+		blades.StopSequences("\n\n"),
+		blades.FrequencyPenalty(0.5),
+		blades.PresencePenalty(0.25),
+		blades.TopK(40),
+	)
+	config, err := model.toGenerateConfig(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"seed":             float64(7),
+		"stopSequences":    []any{"\n\n"},
+		"frequencyPenalty": 0.5,
+		"presencePenalty":  0.25,
+		"topK":             float64(40),
+	}
+	for key, value := range want {
+		if !reflect.DeepEqual(got[key], value) {
+			t.Fatalf("%s: want %v, got %v", key, value, got[key])
+		}
+	}
+}
+
+func TestConvertSystemMessages(t *testing.T) {
+	req := &blades.ModelRequest{
+		Instruction: blades.SystemMessage("Be brief."),
+		Messages: []*blades.Message{
+			blades.SystemMessage("Answer in French."),
+			blades.DeveloperMessage("Use metric units."),
+			blades.UserMessage("Hello"),
+		},
+	}
+	system, contents, err := convertMessageToGenAI(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(system.Parts) != 1 || system.Parts[0].Text != "Be brief.\n\nAnswer in French.\n\nUse metric units." {
+		t.Fatalf("want the system messages joined into one instruction, got %+v", system.Parts)
+	}
+	if len(contents) != 1 || contents[0].Role != genai.RoleUser {
+		t.Fatalf("want only the user message, got %+v", contents)
+	}
+
+	system, _, err = convertMessageToGenAI(&blades.ModelRequest{Messages: []*blades.Message{blades.UserMessage("Hello")}})
+	if err != nil || system != nil {
+		t.Fatalf("want no system instruction, got %+v, %v", system, err)
+	}
+}
+
+func TestConvertToolHistory(t *testing.T) {
+	req := &blades.ModelRequest{
+		Messages: []*blades.Message{
+			blades.UserMessage("Weather in Paris?"),
+			{Role: blades.RoleTool, Parts: []blades.Part{
+				blades.ToolPart{ID: "call-1", Name: "weather", Request: `{"city":"Paris"}`, Response: "sunny"},
+			}},
+			blades.AssistantMessage("It is sunny."),
+		},
+	}
+	_, contents, err := convertMessageToGenAI(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var roles []string
+	for _, content := range contents {
+		roles = append(roles, content.Role)
+	}
+	if want := []string{genai.RoleUser, genai.RoleModel, genai.RoleUser, genai.RoleModel}; !reflect.DeepEqual(roles, want) {
+		t.Fatalf("want roles %q, got %q", want, roles)
+	}
+	call, response := contents[1].Parts[0].FunctionCall, contents[2].Parts[0].FunctionResponse
+	if call == nil || call.ID != "call-1" || call.Name != "weather" || call.Args["city"] != "Paris" {
+		t.Fatalf("want the function call replayed, got %+v", contents[1].Parts[0])
+	}
+	if response == nil || response.ID != "call-1" || response.Response["output"] != "sunny" {
+		t.Fatalf("want the function response linked to the call, got %+v", contents[2].Parts[0])
+	}
+}
+
+func TestConvertFinishReason(t *testing.T) {
+	tests := []struct {
+		fixture  string
+		want     blades.FinishReason
+		wantText string
+	}{
+		{"stop.json", blades.FinishReasonStop, "Red and blue."},
+		{"safety_candidate.json", blades.FinishReasonContentFilter, ""},
+		{"blocked_prompt.json", blades.FinishReasonContentFilter, "The prompt was blocked."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", tt.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var resp genai.GenerateContentResponse
+			if err := json.Unmarshal(data, &resp); err != nil {
+				t.Fatal(err)
+			}
+			res, err := convertGenAIToBlades(&resp, blades.StatusCompleted)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Message.FinishReason != tt.want || res.Message.Text() != tt.wantText {
+				t.Fatalf("want %q with %q, got %q with %q", tt.want, tt.wantText, res.Message.FinishReason, res.Message.Text())
+			}
+			if res.Message.IsFiltered() != (tt.want == blades.FinishReasonContentFilter) {
+				t.Fatalf("unexpected IsFiltered for %q", res.Message.FinishReason)
+			}
+		})
+	}
+}
+
+func TestConvertCandidates(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "candidates.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp genai.GenerateContentResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		t.Fatal(err)
+	}
+	res, err := convertGenAIToBlades(&resp, blades.StatusCompleted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Message.Text() != "Red and blue." || len(res.Alternatives) != 1 || res.Alternatives[0].Text() != "Green and yellow." {
+		t.Fatalf("unexpected candidates %q and %+v", res.Message.Text(), res.Alternatives)
+	}
+	want := blades.TokenUsage{InputTokens: 9, OutputTokens: 8, TotalTokens: 17}
+	if res.Message.TokenUsage != want {
+		t.Fatalf("want usage %+v, got %+v", want, res.Message.TokenUsage)
+	}
+
+	req := &blades.ModelRequest{}
+	req.Options.Apply(blades.CandidateCount(2))
+	config, err := (&Gemini{}).toGenerateConfig(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.CandidateCount != 2 {
+		t.Fatalf("want candidate count 2, got %d", config.CandidateCount)
+	}
+	for _, err := range (&Gemini{}).NewStreaming(context.Background(), req) {
+		if !errors.Is(err, blades.ErrStreamingCandidates) {
+			t.Fatalf("want ErrStreamingCandidates, got %v", err)
+		}
+	}
+}
+
+func TestGenerateExtensions(t *testing.T) {
+	var bodies []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		var body map[string]any
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		bodies = append(bodies, body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"candidates":[{"content":{"role":"model","parts":[{"text":"ok"}]},"finishReason":"STOP"}],"modelVersion":"gemini-test-001"}`)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	model, err := NewModel(ctx, "gemini-test", Config{ClientConfig: genai.ClientConfig{
+		APIKey:      "test",
+		Backend:     genai.BackendGeminiAPI,
+		HTTPOptions: genai.HTTPOptions{BaseURL: server.URL},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &blades.ModelRequest{
+		Messages: []*blades.Message{blades.UserMessage("hi")},
+		Extensions: map[string]any{
+			"generationConfig": map[string]any{"thinkingConfig": map[string]any{"thinkingBudget": 0}},
+		},
+	}
+	req.Options.Apply(blades.TopK(40))
+	resp, err := model.Generate(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bodies) != 1 {
+		t.Fatalf("want 1 request, got %d", len(bodies))
+	}
+	config, _ := bodies[0]["generationConfig"].(map[string]any)
+	if config["topK"] != float64(40) || !reflect.DeepEqual(config["thinkingConfig"], map[string]any{"thinkingBudget": float64(0)}) {
+		t.Fatalf("want the extension merged into the generation config, got %v", config)
+	}
+	var raw map[string]any
+	if err := json.Unmarshal(resp.RawResponse, &raw); err != nil || raw["modelVersion"] != "gemini-test-001" {
+		t.Fatalf("want the raw response, got %s (%v)", resp.RawResponse, err)
+	}
+
+	req.Extensions = map[string]any{"generationConfig": map[string]any{"topK": 1}}
+	if _, err := model.Generate(ctx, req); !errors.Is(err, blades.ErrExtensionConflict) {
+		t.Fatalf("want ErrExtensionConflict, got %v", err)
+	}
+	if len(bodies) != 1 {
+		t.Fatalf("want no request sent on a conflict, got %d requests", len(bodies))
+	}
+}
+
+func TestStreamingConformance(t *testing.T) {
+	server := providertest.ServeSSE(t, filepath.Join("testdata", "stream.txt"), 100*time.Millisecond)
+	model, err := NewModel(context.Background(), "gemini-test", Config{ClientConfig: genai.ClientConfig{
+		APIKey:      "test",
+		Backend:     genai.BackendGeminiAPI,
+		HTTPOptions: genai.HTTPOptions{BaseURL: server.URL},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	providertest.TestStreaming(t, model, providertest.Config{CancelWithin: 150 * time.Millisecond})
+}
@@ -11,36 +11,56 @@ import (
 
 func convertMessageToGenAI(req *blades.ModelRequest) (*genai.Content, []*genai.Content, error) {
 	var (
-		system   *genai.Content
-		contents []*genai.Content
+		system       *genai.Content
+		contents     []*genai.Content
+		instructions = []*blades.Message{req.Instruction}
 	)
-	if req.Instruction != nil {
-		system = &genai.Content{Parts: convertMessagePartsToGenAI(req.Instruction.Parts)}
-	}
 	for _, msg := range req.Messages {
 		switch msg.Role {
-		case blades.RoleSystem:
-			system = &genai.Content{Parts: convertMessagePartsToGenAI(msg.Parts)}
+		case blades.RoleSystem, blades.RoleDeveloper:
+			instructions = append(instructions, msg)
 		case blades.RoleUser:
 			contents = append(contents, &genai.Content{Role: genai.RoleUser, Parts: convertMessagePartsToGenAI(msg.Parts)})
 		case blades.RoleAssistant:
-			contents = append(contents, &genai.Content{Role: genai.RoleUser, Parts: convertMessagePartsToGenAI(msg.Parts)})
+			contents = append(contents, &genai.Content{Role: genai.RoleModel, Parts: convertMessagePartsToGenAI(msg.Parts)})
 		case blades.RoleTool:
-			var parts []*genai.Part
-			for _, part := range msg.Parts {
-				switch v := any(part).(type) {
-				case blades.ToolPart:
-					response := map[string]any{}
-					if err := json.Unmarshal([]byte(v.Response), &response); err != nil {
-						response["output"] = v.Response
-					}
-					parts = append(parts, genai.NewPartFromFunctionResponse(v.Name, response))
+			// Each function response follows the model turn that made the call.
+			calls, responses := convertToolParts(msg.Parts)
+			contents = append(contents,
+				&genai.Content{Role: genai.RoleModel, Parts: calls},
+				&genai.Content{Role: genai.RoleUser, Parts: responses},
+			)
+		}
+	}
+	// Gemini takes a single system instruction, so the instruction and the
+	// system and developer messages are joined.
+	if text := blades.JoinSystemMessages(instructions...); text != "" {
+		system = &genai.Content{Parts: []*genai.Part{{Text: text}}}
+	}
+	return system, contents, nil
+}
+
+// convertToolParts converts the tool parts of a tool message to the function
+// calls of the model turn and the function responses that answer them.
+func convertToolParts(parts []blades.Part) (calls, responses []*genai.Part) {
+	for _, part := range parts {
+		switch v := part.(type) {
+		case blades.ToolPart:
+			args := map[string]any{}
+			if v.Request != "" {
+				if err := json.Unmarshal([]byte(v.Request), &args); err != nil {
+					args = map[string]any{"input": v.Request}
 				}
 			}
-			contents = append(contents, &genai.Content{Role: genai.RoleUser, Parts: parts})
+			response := map[string]any{}
+			if err := json.Unmarshal([]byte(v.Response), &response); err != nil {
+				response["output"] = v.Response
+			}
+			calls = append(calls, &genai.Part{FunctionCall: &genai.FunctionCall{ID: v.ID, Name: v.Name, Args: args}})
+			responses = append(responses, &genai.Part{FunctionResponse: &genai.FunctionResponse{ID: v.ID, Name: v.Name, Response: response}})
 		}
 	}
-	return system, contents, nil
+	return calls, responses
 }
 
 func convertMessagePartsToGenAI(parts []blades.Part) []*genai.Part {
@@ -97,21 +117,86 @@ func convertBladesToolToGenAI(tool tools.Tool) (*genai.Tool, error) {
 	}, nil
 }
 
+// convertGenAIToBlades converts a GenAI response. The first candidate is the
+// message and the others are its alternatives.
 func convertGenAIToBlades(resp *genai.GenerateContentResponse, status blades.Status) (*blades.ModelResponse, error) {
-	message := blades.NewAssistantMessage(status)
+	res := &blades.ModelResponse{}
 	for _, candidate := range resp.Candidates {
-		if candidate.Content == nil {
-			continue
+		message, err := convertCandidateToBlades(candidate, status)
+		if err != nil {
+			return nil, err
 		}
-		for _, part := range candidate.Content.Parts {
-			bladesPart, err := convertGenAIPartToBlades(part)
-			if err != nil {
-				return nil, err
-			}
-			message.Parts = append(message.Parts, bladesPart)
+		if res.Message == nil {
+			res.Message = message
+		} else {
+			res.Alternatives = append(res.Alternatives, message)
+		}
+	}
+	if res.Message == nil {
+		res.Message = blades.NewAssistantMessage(status)
+	}
+	if feedback := resp.PromptFeedback; feedback != nil && feedback.BlockReason != "" {
+		// The prompt was blocked, so there are no candidates.
+		res.Message.FinishReason = blades.FinishReasonContentFilter
+		res.Message.Metadata["block_reason"] = string(feedback.BlockReason)
+		if feedback.BlockReasonMessage != "" {
+			res.Message.Parts = append(res.Message.Parts, blades.TextPart{Text: feedback.BlockReasonMessage})
 		}
 	}
-	return &blades.ModelResponse{Message: message}, nil
+	// The usage covers all candidates.
+	res.Message.TokenUsage = convertUsage(resp.UsageMetadata)
+	return res, nil
+}
+
+// convertCandidateToBlades converts a GenAI candidate to a message.
+func convertCandidateToBlades(candidate *genai.Candidate, status blades.Status) (*blades.Message, error) {
+	message := blades.NewAssistantMessage(status)
+	if candidate.FinishReason != "" {
+		message.FinishReason = convertFinishReason(candidate.FinishReason)
+	}
+	if candidate.AvgLogprobs != 0 {
+		message.Metadata[blades.AverageLogprobKey] = candidate.AvgLogprobs
+	}
+	if candidate.Content == nil {
+		return message, nil
+	}
+	for _, part := range candidate.Content.Parts {
+		bladesPart, err := convertGenAIPartToBlades(part)
+		if err != nil {
+			return nil, err
+		}
+		message.Parts = append(message.Parts, bladesPart)
+	}
+	return message, nil
+}
+
+// convertUsage converts the usage metadata, counting thoughts as output.
+func convertUsage(usage *genai.GenerateContentResponseUsageMetadata) blades.TokenUsage {
+	if usage == nil {
+		return blades.TokenUsage{}
+	}
+	return blades.TokenUsage{
+		InputTokens:       int64(usage.PromptTokenCount),
+		OutputTokens:      int64(usage.CandidatesTokenCount + usage.ThoughtsTokenCount),
+		TotalTokens:       int64(usage.TotalTokenCount),
+		CachedInputTokens: int64(usage.CachedContentTokenCount),
+	}
+}
+
+// convertFinishReason converts a GenAI finish reason. Reasons without a
+// counterpart are kept as they are.
+func convertFinishReason(reason genai.FinishReason) blades.FinishReason {
+	switch reason {
+	case genai.FinishReasonStop:
+		return blades.FinishReasonStop
+	case genai.FinishReasonMaxTokens:
+		return blades.FinishReasonLength
+	case genai.FinishReasonSafety, genai.FinishReasonRecitation, genai.FinishReasonBlocklist,
+		genai.FinishReasonProhibitedContent, genai.FinishReasonSPII, genai.FinishReasonImageSafety:
+		return blades.FinishReasonContentFilter
+	default:
+		return blades.FinishReason(reason)
+	}
 }
 
 // convertGenAIPartToBlades converts a GenAI Part to Blades Part
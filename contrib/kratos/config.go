@@ -0,0 +1,128 @@
+package kratos
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/go-kratos/kratos/v2/config"
+	"github.com/go-kratos/kratos/v2/log"
+
+	"github.com/go-kratos/blades"
+	bladesconfig "github.com/go-kratos/blades/config"
+)
+
+// ConfigOption defines options for LoadAgent.
+type ConfigOption func(*ConfigAgent)
+
+// WithReloadErrorHandler sets the function called when a changed config
+// cannot be built into an agent. By default the error is logged.
+func WithReloadErrorHandler(fn func(error)) ConfigOption {
+	return func(a *ConfigAgent) {
+		a.onError = fn
+	}
+}
+
+// WithReloadHandler sets the function called with the agent built from a changed config.
+func WithReloadHandler(fn func(blades.Agent)) ConfigOption {
+	return func(a *ConfigAgent) {
+		a.onReload = fn
+	}
+}
+
+// ConfigAgent is an agent defined by a spec of the blades config package
+// under a key of a kratos config, and rebuilt whenever the config changes.
+// Invocations that already started keep the agent they started with.
+type ConfigAgent struct {
+	key      string
+	registry *bladesconfig.Registry
+	onError  func(error)
+	onReload func(blades.Agent)
+
+	mu    sync.RWMutex
+	agent blades.Agent
+}
+
+// LoadAgent builds the root agent of the spec under the key of the loaded
+// config with the registry, and watches the key to rebuild it, so that
+// instructions can be changed without a restart. A change that does not
+// build keeps the current agent.
+func LoadAgent(c config.Config, key string, registry *bladesconfig.Registry, opts ...ConfigOption) (*ConfigAgent, error) {
+	a := &ConfigAgent{
+		key:      key,
+		registry: registry,
+		onError: func(err error) {
+			log.Errorf("blades: reload agent: %v", err)
+		},
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	agent, err := a.build(c.Value(key))
+	if err != nil {
+		return nil, err
+	}
+	a.agent = agent
+	if err := c.Watch(key, a.reload); err != nil {
+		return nil, fmt.Errorf("kratos: watch %s: %w", key, err)
+	}
+	return a, nil
+}
+
+// build parses the spec of the config value and builds its root agent.
+func (a *ConfigAgent) build(v config.Value) (blades.Agent, error) {
+	var raw json.RawMessage
+	if err := v.Scan(&raw); err != nil {
+		return nil, fmt.Errorf("kratos: load %s: %w", a.key, err)
+	}
+	spec, err := bladesconfig.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	return a.registry.BuildRoot(spec)
+}
+
+// reload is the config observer of the key.
+func (a *ConfigAgent) reload(_ string, v config.Value) {
+	agent, err := a.build(v)
+	if err != nil {
+		if a.onError != nil {
+			a.onError(err)
+		}
+		return
+	}
+	a.mu.Lock()
+	a.agent = agent
+	a.mu.Unlock()
+	if a.onReload != nil {
+		a.onReload(agent)
+	}
+}
+
+// Agent returns the current agent.
+func (a *ConfigAgent) Agent() blades.Agent {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.agent
+}
+
+// Name returns the name of the current agent.
+func (a *ConfigAgent) Name() string {
+	return a.Agent().Name()
+}
+
+// Description returns the description of the current agent.
+func (a *ConfigAgent) Description() string {
+	return a.Agent().Description()
+}
+
+// SubAgents returns the current agent, so that HealthCheck walks it.
+func (a *ConfigAgent) SubAgents() []blades.Agent {
+	return []blades.Agent{a.Agent()}
+}
+
+// Run runs the current agent.
+func (a *ConfigAgent) Run(ctx context.Context, invocation *blades.Invocation) blades.Generator[*blades.Message, error] {
+	return a.Agent().Run(ctx, invocation)
+}
@@ -0,0 +1,134 @@
+package kratos
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/config"
+
+	"github.com/go-kratos/blades"
+	bladesconfig "github.com/go-kratos/blades/config"
+)
+
+// echoModel answers with the instruction it received.
+type echoModel struct{}
+
+func (echoModel) Name() string { return "echo" }
+
+func (m echoModel) Generate(ctx context.Context, req *blades.ModelRequest) (*blades.ModelResponse, error) {
+	message := blades.NewAssistantMessage(blades.StatusCompleted)
+	message.Parts = blades.Parts(strings.TrimSpace(req.Instruction.Text()))
+	return &blades.ModelResponse{Message: message}, nil
+}
+
+func (m echoModel) NewStreaming(ctx context.Context, req *blades.ModelRequest) blades.Generator[*blades.ModelResponse, error] {
+	return func(yield func(*blades.ModelResponse, error) bool) {
+		yield(m.Generate(ctx, req))
+	}
+}
+
+// memorySource is a config source whose content is changed by the test.
+type memorySource struct {
+	data    string
+	changes chan string
+	once    sync.Once
+}
+
+func newMemorySource(data string) *memorySource {
+	return &memorySource{data: data, changes: make(chan string)}
+}
+
+func (s *memorySource) Load() ([]*config.KeyValue, error) {
+	return []*config.KeyValue{{Key: "agents.yaml", Value: []byte(s.data), Format: "yaml"}}, nil
+}
+
+func (s *memorySource) Watch() (config.Watcher, error) {
+	return s, nil
+}
+
+func (s *memorySource) Next() ([]*config.KeyValue, error) {
+	data, ok := <-s.changes
+	if !ok {
+		return nil, context.Canceled
+	}
+	return []*config.KeyValue{{Key: "agents.yaml", Value: []byte(data), Format: "yaml"}}, nil
+}
+
+func (s *memorySource) Stop() error {
+	s.once.Do(func() { close(s.changes) })
+	return nil
+}
+
+func agentsConfig(instruction, model string) string {
+	return `
+blades:
+  root: assistant
+  agents:
+    - name: assistant
+      model: ` + model + `
+      instruction: ` + instruction + `
+`
+}
+
+func TestLoadAgentReload(t *testing.T) {
+	source := newMemorySource(agentsConfig("Answer politely.", "echo"))
+	c := config.New(config.WithSource(source))
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	registry := bladesconfig.NewRegistry()
+	registry.RegisterModel("echo", echoModel{})
+	reloaded := make(chan blades.Agent, 1)
+	failed := make(chan error, 1)
+	agent, err := LoadAgent(c, "blades", registry,
+		WithReloadHandler(func(agent blades.Agent) { reloaded <- agent }),
+		WithReloadErrorHandler(func(err error) { failed <- err }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := blades.NewRunner(agent)
+	answer := func() string {
+		t.Helper()
+		message, err := runner.Run(context.Background(), blades.UserMessage("hi"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return message.Text()
+	}
+	if got := answer(); got != "Answer politely." {
+		t.Fatalf("want the loaded instruction, got %q", got)
+	}
+
+	source.changes <- agentsConfig("Answer tersely.", "echo")
+	select {
+	case <-reloaded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("agent was not reloaded")
+	}
+	if got := answer(); got != "Answer tersely." {
+		t.Fatalf("want the reloaded instruction, got %q", got)
+	}
+
+	// A config that does not build keeps the current agent.
+	source.changes <- agentsConfig("Answer loudly.", "missing")
+	select {
+	case err := <-failed:
+		if !strings.Contains(err.Error(), `unknown model "missing"`) {
+			t.Fatalf("unexpected reload error %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("reload error was not reported")
+	}
+	if got := answer(); got != "Answer tersely." {
+		t.Fatalf("want the last good instruction kept, got %q", got)
+	}
+
+	if _, err := LoadAgent(c, "missing", registry); err == nil {
+		t.Fatal("want an error for a missing key")
+	}
+}
@@ -0,0 +1,53 @@
+package kratos
+
+import (
+	"context"
+
+	"github.com/go-kratos/kratos/v2/middleware"
+
+	"github.com/go-kratos/blades"
+)
+
+// Middleware returns a blades middleware that runs every agent invocation
+// through the kratos middlewares, e.g. logging, metrics or tracing, so that
+// agents are observed like the kratos endpoints serving them.
+//
+// The kratos handler receives the *blades.Invocation as request and returns
+// the last message as reply. Messages still reach the caller as they are
+// produced; the handler returns once the invocation ends.
+func Middleware(ms ...middleware.Middleware) blades.Middleware {
+	chain := middleware.Chain(ms...)
+	return func(next blades.Handler) blades.Handler {
+		return blades.HandleFunc(func(ctx context.Context, invocation *blades.Invocation) blades.Generator[*blades.Message, error] {
+			return func(yield func(*blades.Message, error) bool) {
+				// stopped is set once yield returned false; nothing is yielded after,
+				// even if a middleware calls the handler again, e.g. to retry.
+				stopped := false
+				handler := chain(func(ctx context.Context, req any) (any, error) {
+					var last *blades.Message
+					if stopped {
+						return last, nil
+					}
+					for message, err := range next.Handle(ctx, req.(*blades.Invocation)) {
+						if err != nil {
+							return last, err
+						}
+						last = message
+						if !yield(message, nil) {
+							stopped = true
+							return last, nil
+						}
+					}
+					return last, nil
+				})
+				_, err := handler(ctx, invocation)
+				if stopped {
+					return
+				}
+				if err != nil {
+					yield(nil, err)
+				}
+			}
+		})
+	}
+}
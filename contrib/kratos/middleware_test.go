@@ -0,0 +1,40 @@
+package kratos
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/middleware"
+
+	"github.com/go-kratos/blades"
+)
+
+func TestMiddlewareStopped(t *testing.T) {
+	// again calls the handler a second time, like a retrying middleware.
+	again := func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req any) (any, error) {
+			handler(ctx, req)
+			return handler(ctx, req)
+		}
+	}
+	next := blades.HandleFunc(func(ctx context.Context, invocation *blades.Invocation) blades.Generator[*blades.Message, error] {
+		return func(yield func(*blades.Message, error) bool) {
+			if !yield(blades.AssistantMessage("first"), nil) {
+				return
+			}
+			yield(nil, errors.New("failed"))
+		}
+	})
+	var got []string
+	for message, err := range Middleware(again)(next).Handle(context.Background(), &blades.Invocation{}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, message.Text())
+		break
+	}
+	if len(got) != 1 || got[0] != "first" {
+		t.Fatalf("want only the first message, got %q", got)
+	}
+}
@@ -0,0 +1,183 @@
+package kratos
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LastEventIDHeader is the request header of a client reconnecting to a
+// stream, holding the ID of the last event it received.
+const LastEventIDHeader = "Last-Event-ID"
+
+// ResumePolicy bounds the events kept for the clients that reconnect to a
+// stream. Zero fields use their defaults.
+type ResumePolicy struct {
+	// MaxEvents is the number of the last events kept per stream, 1024 by
+	// default. A client that missed older events cannot resume.
+	MaxEvents int
+	// MaxStreams is the number of streams kept, 1000 by default. The streams
+	// that ended first are dropped first.
+	MaxStreams int
+	// Retention is how long the events of a stream are kept after it ended,
+	// 5 minutes by default.
+	Retention time.Duration
+}
+
+// WithResumableStreams numbers the events of streamed completions and keeps
+// the last ones in memory, so that a client that lost the connection sends
+// the request again, or a GET to ChatCompletionsPath, with the
+// Last-Event-ID header and gets the events it missed, then the live ones.
+// Streamed completions keep running when their client disconnects.
+func WithResumableStreams(policy ResumePolicy) ServiceOption {
+	if policy.MaxEvents <= 0 {
+		policy.MaxEvents = 1024
+	}
+	if policy.MaxStreams <= 0 {
+		policy.MaxStreams = 1000
+	}
+	if policy.Retention <= 0 {
+		policy.Retention = 5 * time.Minute
+	}
+	return func(s *service) {
+		s.events = &eventBuffer{policy: policy, streams: make(map[string]*eventStream)}
+	}
+}
+
+// eventBuffer keeps the last events of the streams.
+type eventBuffer struct {
+	policy  ResumePolicy
+	mu      sync.Mutex
+	streams map[string]*eventStream
+	order   []string // stream IDs, oldest first
+}
+
+// eventStream is the buffered events of a streamed completion; its fields
+// are guarded by the mutex of the buffer.
+type eventStream struct {
+	buffer *eventBuffer
+	id     string
+	events []bufferedEvent
+	last   int64
+	done   bool
+	ended  time.Time
+	// notify is closed and replaced on every change.
+	notify chan struct{}
+}
+
+// bufferedEvent is an event of a stream and its sequence number, from 1.
+type bufferedEvent struct {
+	seq  int64
+	data []byte
+}
+
+// open starts buffering the events of a stream, after dropping the streams
+// that are over the limits of the policy.
+func (b *eventBuffer) open(id string) *eventStream {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.drop(func(s *eventStream) bool {
+		return s.done && now.Sub(s.ended) > b.policy.Retention
+	})
+	for len(b.streams) >= b.policy.MaxStreams {
+		before := len(b.streams)
+		b.drop(func(s *eventStream) bool { return s.done && len(b.streams) >= b.policy.MaxStreams })
+		if len(b.streams) == before {
+			// All are running: the oldest one can no longer be resumed.
+			delete(b.streams, b.order[0])
+			b.order = b.order[1:]
+		}
+	}
+	s := &eventStream{buffer: b, id: id, notify: make(chan struct{})}
+	b.streams[id] = s
+	b.order = append(b.order, id)
+	return s
+}
+
+// drop removes the streams that match; b.mu must be held.
+func (b *eventBuffer) drop(match func(*eventStream) bool) {
+	kept := b.order[:0]
+	for _, id := range b.order {
+		if match(b.streams[id]) {
+			delete(b.streams, id)
+			continue
+		}
+		kept = append(kept, id)
+	}
+	b.order = kept
+}
+
+// get returns the stream of the ID if it is kept.
+func (b *eventBuffer) get(id string) (*eventStream, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, ok := b.streams[id]
+	if ok && s.done && time.Since(s.ended) > b.policy.Retention {
+		return nil, false
+	}
+	return s, ok
+}
+
+// append buffers an event and returns its ID.
+func (s *eventStream) append(data []byte) string {
+	s.buffer.mu.Lock()
+	defer s.buffer.mu.Unlock()
+	s.last++
+	s.events = append(s.events, bufferedEvent{seq: s.last, data: data})
+	if over := len(s.events) - s.buffer.policy.MaxEvents; over > 0 {
+		s.events = s.events[over:]
+	}
+	s.changed()
+	return eventID(s.id, s.last)
+}
+
+// close marks the stream ended.
+func (s *eventStream) close() {
+	s.buffer.mu.Lock()
+	defer s.buffer.mu.Unlock()
+	s.done, s.ended = true, time.Now()
+	s.changed()
+}
+
+// changed wakes up the readers of the stream; the mutex of the buffer must be held.
+func (s *eventStream) changed() {
+	close(s.notify)
+	s.notify = make(chan struct{})
+}
+
+// since returns the events after the sequence number, whether the stream
+// ended and a channel closed on its next change. It fails if some of the
+// events after seq are no longer kept.
+func (s *eventStream) since(seq int64) ([]bufferedEvent, bool, <-chan struct{}, error) {
+	s.buffer.mu.Lock()
+	defer s.buffer.mu.Unlock()
+	if seq > s.last {
+		return nil, false, nil, fmt.Errorf("event %d was not sent", seq)
+	}
+	i := len(s.events) - int(s.last-seq)
+	if i < 0 {
+		return nil, false, nil, fmt.Errorf("events after %d are no longer kept", seq)
+	}
+	return s.events[i:], s.done, s.notify, nil
+}
+
+// eventID returns the ID of the event of a stream.
+func eventID(stream string, seq int64) string {
+	return stream + ":" + strconv.FormatInt(seq, 10)
+}
+
+// parseEventID returns the stream and the sequence number of an event ID.
+func parseEventID(id string) (string, int64, error) {
+	i := strings.LastIndexByte(id, ':')
+	if i <= 0 {
+		return "", 0, fmt.Errorf("invalid event ID %q", id)
+	}
+	seq, err := strconv.ParseInt(id[i+1:], 10, 64)
+	if err != nil || seq < 0 {
+		return "", 0, fmt.Errorf("invalid event ID %q", id)
+	}
+	return id[:i], seq, nil
+}
@@ -0,0 +1,193 @@
+package kratos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/transport/http"
+
+	"github.com/go-kratos/blades"
+)
+
+// gatedModel streams its chunks, waiting for the gate after the first ones.
+type gatedModel struct {
+	chunks []string
+	before int
+	gate   chan struct{}
+}
+
+func (gatedModel) Name() string { return "gated" }
+
+func (m gatedModel) Generate(ctx context.Context, req *blades.ModelRequest) (*blades.ModelResponse, error) {
+	message := blades.NewAssistantMessage(blades.StatusCompleted)
+	message.Parts = blades.Parts(strings.Join(m.chunks, ""))
+	return &blades.ModelResponse{Message: message}, nil
+}
+
+func (m gatedModel) NewStreaming(ctx context.Context, req *blades.ModelRequest) blades.Generator[*blades.ModelResponse, error] {
+	return func(yield func(*blades.ModelResponse, error) bool) {
+		for i, chunk := range m.chunks {
+			if i == m.before {
+				<-m.gate
+			}
+			delta := blades.NewAssistantMessage(blades.StatusIncomplete)
+			delta.Parts = blades.Parts(chunk)
+			if !yield(&blades.ModelResponse{Message: delta}, nil) {
+				return
+			}
+		}
+		yield(m.Generate(ctx, req))
+	}
+}
+
+// cutWriter is a client that loses the connection after n events.
+type cutWriter struct {
+	*httptest.ResponseRecorder
+	n    int
+	once sync.Once
+	cut  chan struct{}
+}
+
+func (w *cutWriter) Write(p []byte) (int, error) {
+	if w.n == 0 {
+		w.once.Do(func() { close(w.cut) })
+		return 0, errors.New("connection reset")
+	}
+	w.n--
+	return w.ResponseRecorder.Write(p)
+}
+
+// notifyWriter is a client that signals its first event.
+type notifyWriter struct {
+	*httptest.ResponseRecorder
+	once  sync.Once
+	wrote chan struct{}
+}
+
+func (w *notifyWriter) Write(p []byte) (int, error) {
+	defer w.once.Do(func() { close(w.wrote) })
+	return w.ResponseRecorder.Write(p)
+}
+
+// sseEvent is an event parsed from a server-sent event stream.
+type sseEvent struct {
+	id   string
+	data string
+}
+
+func parseEvents(body string) []sseEvent {
+	var events []sseEvent
+	for _, block := range strings.Split(body, "\n\n") {
+		var event sseEvent
+		for _, line := range strings.Split(block, "\n") {
+			if v, ok := strings.CutPrefix(line, "id: "); ok {
+				event.id = v
+			}
+			if v, ok := strings.CutPrefix(line, "data: "); ok {
+				event.data = v
+			}
+		}
+		if event.data != "" {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+func TestResumableStreams(t *testing.T) {
+	chunks := []string{"The ", "tide ", "rises ", "and ", "falls."}
+	gate := make(chan struct{})
+	agent, err := blades.NewAgent("assistant", blades.WithModel(gatedModel{chunks: chunks, before: 3, gate: gate}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := http.NewServer()
+	RegisterHTTPServer(srv, agent, WithResumableStreams(ResumePolicy{}))
+	const body = `{"stream":true,"messages":[{"role":"user","content":"Tides?"}]}`
+	request := func(w nethttp.ResponseWriter, method, lastEventID string) {
+		req := httptest.NewRequest(method, ChatCompletionsPath, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if lastEventID != "" {
+			req.Header.Set(LastEventIDHeader, lastEventID)
+		}
+		srv.ServeHTTP(w, req)
+	}
+
+	// The first connection drops after two events, in the middle of the answer.
+	first := &cutWriter{ResponseRecorder: httptest.NewRecorder(), n: 2, cut: make(chan struct{})}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		request(first, "POST", "")
+	}()
+	<-first.cut
+	received := parseEvents(first.Body.String())
+	if len(received) != 2 {
+		t.Fatalf("want two events before the cut, got %q", first.Body)
+	}
+	// The client reconnects while the answer is still generated.
+	second := &notifyWriter{ResponseRecorder: httptest.NewRecorder(), wrote: make(chan struct{})}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		request(second, "POST", received[1].id)
+	}()
+	// The missed event is replayed, then the live ones follow.
+	<-second.wrote
+	close(gate)
+	wg.Wait()
+	resumed := parseEvents(second.Body.String())
+	events := append(received, resumed...)
+
+	var text strings.Builder
+	stream, _, _ := parseEventID(events[0].id)
+	for i, event := range events {
+		if event.id != eventID(stream, int64(i+1)) {
+			t.Fatalf("want event %d, got %q in %v", i+1, event.id, events)
+		}
+		var chunk ChatCompletion
+		if json.Unmarshal([]byte(event.data), &chunk) == nil && chunk.Choices[0].Delta != nil {
+			text.WriteString(chunk.Choices[0].Delta.Content)
+		}
+	}
+	if text.String() != strings.Join(chunks, "") || events[len(events)-1].data != "[DONE]" {
+		t.Fatalf("want the whole answer once then [DONE], got %q from %v", text.String(), events)
+	}
+
+	// After the end, the missed events that are kept are replayed, then the stream closes.
+	last := len(events)
+	replay := httptest.NewRecorder()
+	request(replay, "GET", eventID(stream, int64(last-2)))
+	if got := parseEvents(replay.Body.String()); len(got) != 2 || got[0].id != events[last-2].id || got[1].data != "[DONE]" {
+		t.Fatalf("want the last two events replayed, got %q", replay.Body)
+	}
+	unknown := httptest.NewRecorder()
+	request(unknown, "POST", eventID("chatcmpl-unknown", 1))
+	if unknown.Code != 404 {
+		t.Fatalf("want 404 for an unknown stream, got %d %s", unknown.Code, unknown.Body)
+	}
+
+	// A client that missed more events than are kept cannot resume.
+	agent, err = blades.NewAgent("assistant", blades.WithModel(chunkModel{answer: "The tide rises."}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv = http.NewServer()
+	RegisterHTTPServer(srv, agent, WithResumableStreams(ResumePolicy{MaxEvents: 2}))
+	done := httptest.NewRecorder()
+	request(done, "POST", "")
+	events = parseEvents(done.Body.String())
+	expired := httptest.NewRecorder()
+	stream, _, _ = parseEventID(events[0].id)
+	request(expired, "GET", eventID(stream, 0))
+	if expired.Code != 410 {
+		t.Fatalf("want 410 for events no longer kept, got %d %s", expired.Code, expired.Body)
+	}
+}
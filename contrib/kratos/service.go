@@ -0,0 +1,395 @@
+package kratos
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	nethttp "net/http"
+	"strings"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/go-kratos/kratos/v2/transport/http"
+
+	"github.com/go-kratos/blades"
+	"github.com/go-kratos/blades/stream"
+)
+
+const (
+	// ChatCompletionsPath is the path of the OpenAI-compatible chat completions endpoint.
+	ChatCompletionsPath = "/v1/chat/completions"
+	// HealthPath is the path of the health check endpoint.
+	HealthPath = "/healthz"
+	// OperationChatCompletions is the operation of the chat completions endpoint,
+	// which kratos middlewares can select on.
+	OperationChatCompletions = "/blades.v1.Agent/ChatCompletions"
+	// IdempotencyKeyHeader is the request header holding the idempotency key
+	// of a completion; see blades.WithIdempotencyKey.
+	IdempotencyKeyHeader = "Idempotency-Key"
+)
+
+// ChatMessage is a message of a chat completion.
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// ChatCompletionRequest is the body of a chat completions request. Only text
+// content is supported.
+type ChatCompletionRequest struct {
+	Model    string        `json:"model,omitempty"`
+	Messages []ChatMessage `json:"messages"`
+	Stream   bool          `json:"stream,omitempty"`
+}
+
+// ChatCompletion is a chat completion, or a chunk of one when streaming.
+type ChatCompletion struct {
+	ID      string       `json:"id"`
+	Object  string       `json:"object"`
+	Created int64        `json:"created"`
+	Model   string       `json:"model"`
+	Choices []ChatChoice `json:"choices"`
+}
+
+// ChatChoice is the answer of a chat completion.
+type ChatChoice struct {
+	Index        int          `json:"index"`
+	Message      *ChatMessage `json:"message,omitempty"`
+	Delta        *ChatMessage `json:"delta,omitempty"`
+	FinishReason string       `json:"finish_reason,omitempty"`
+}
+
+// ServiceOption defines options for the agent service.
+type ServiceOption func(*service)
+
+// WithRunnerOptions sets the options of the Runner that serves the requests.
+func WithRunnerOptions(opts ...blades.RunnerOption) ServiceOption {
+	return func(s *service) {
+		s.runnerOpts = append(s.runnerOpts, opts...)
+	}
+}
+
+// WithHealthOptions sets the options of the health check.
+func WithHealthOptions(opts ...blades.HealthOption) ServiceOption {
+	return func(s *service) {
+		s.healthOpts = append(s.healthOpts, opts...)
+	}
+}
+
+// WithSmoothing paces the streamed deltas with stream.Smooth, for models that
+// stream large irregular chunks.
+func WithSmoothing(opts ...stream.SmoothOption) ServiceOption {
+	return func(s *service) {
+		s.smooth = true
+		s.smoothOpts = append(s.smoothOpts, opts...)
+	}
+}
+
+// service serves an agent over HTTP.
+type service struct {
+	agent      blades.Agent
+	runner     *blades.Runner
+	runnerOpts []blades.RunnerOption
+	healthOpts []blades.HealthOption
+	smooth     bool
+	smoothOpts []stream.SmoothOption
+	events     *eventBuffer
+}
+
+// RegisterHTTPServer registers the OpenAI-compatible chat completions endpoint
+// of the agent, at ChatCompletionsPath, and its health check, at HealthPath,
+// on the kratos HTTP server. The completions run through the middlewares of
+// the server, and the server can be passed to kratos.Server of an App.
+func RegisterHTTPServer(srv *http.Server, agent blades.Agent, opts ...ServiceOption) {
+	s := &service{agent: agent}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.runner = blades.NewRunner(agent, s.runnerOpts...)
+	r := srv.Route("/")
+	r.POST(ChatCompletionsPath, s.chatCompletions)
+	if s.events != nil {
+		r.GET(ChatCompletionsPath, s.resumeCompletion)
+	}
+	srv.Handle(HealthPath, blades.HealthHandler(agent, s.healthOpts...))
+}
+
+func (s *service) chatCompletions(ctx http.Context) error {
+	var in ChatCompletionRequest
+	if err := ctx.Bind(&in); err != nil {
+		return err
+	}
+	http.SetOperation(ctx, OperationChatCompletions)
+	h := ctx.Middleware(func(c context.Context, req any) (any, error) {
+		completion, err := s.complete(c, ctx.Response(), req.(*ChatCompletionRequest))
+		if completion == nil {
+			return nil, err
+		}
+		return completion, err
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		// The completion was streamed.
+		return nil
+	}
+	return ctx.Result(nethttp.StatusOK, out)
+}
+
+// resumeCompletion sends the events of a streamed completion after the one
+// of the Last-Event-ID header.
+func (s *service) resumeCompletion(ctx http.Context) error {
+	http.SetOperation(ctx, OperationChatCompletions)
+	h := ctx.Middleware(func(c context.Context, req any) (any, error) {
+		return nil, s.resume(c, ctx.Response(), req.(string))
+	})
+	_, err := h(ctx, ctx.Request().Header.Get(LastEventIDHeader))
+	return err
+}
+
+// complete runs the agent on the last message, with the others as history. A
+// streamed completion is written to w and returns nil. A repeated
+// Idempotency-Key header replays the answer of the first request with the
+// same messages, and a Last-Event-ID header resumes a streamed completion.
+func (s *service) complete(ctx context.Context, w nethttp.ResponseWriter, in *ChatCompletionRequest) (*ChatCompletion, error) {
+	if tr, ok := transport.FromServerContext(ctx); ok && s.events != nil {
+		if id := tr.RequestHeader().Get(LastEventIDHeader); id != "" {
+			return nil, s.resume(ctx, w, id)
+		}
+	}
+	if len(in.Messages) == 0 {
+		return nil, errors.BadRequest("INVALID_ARGUMENT", "messages are required")
+	}
+	var key string
+	if tr, ok := transport.FromServerContext(ctx); ok {
+		key = tr.RequestHeader().Get(IdempotencyKeyHeader)
+	}
+	session := blades.NewSession()
+	if key != "" {
+		// Idempotency keys are scoped to a session; retries of the request
+		// share the session of its key and history.
+		session = blades.NewSessionWithID(idempotencySessionID(key, in.Messages[:len(in.Messages)-1]))
+	}
+	for _, m := range in.Messages[:len(in.Messages)-1] {
+		message, err := toMessage(m)
+		if err != nil {
+			return nil, err
+		}
+		if err := session.Append(ctx, message); err != nil {
+			return nil, toError(err)
+		}
+	}
+	last := in.Messages[len(in.Messages)-1]
+	if last.Role != "user" {
+		return nil, errors.BadRequest("INVALID_ARGUMENT", "the last message must be a user message")
+	}
+	completion := &ChatCompletion{
+		ID:      "chatcmpl-" + blades.NewInvocationID(),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   in.Model,
+	}
+	if completion.Model == "" {
+		completion.Model = s.agent.Name()
+	}
+	runOpts := []blades.RunOption{blades.WithSession(session), blades.WithInvocationID(completion.ID)}
+	if key != "" {
+		runOpts = append(runOpts, blades.WithIdempotencyKey(key))
+	}
+	if in.Stream {
+		return nil, s.stream(ctx, w, completion, blades.UserMessage(last.Content), runOpts)
+	}
+	answer, err := s.runner.Run(ctx, blades.UserMessage(last.Content), runOpts...)
+	if err != nil {
+		return nil, toError(err)
+	}
+	completion.Choices = []ChatChoice{{
+		Message:      &ChatMessage{Role: "assistant", Content: answer.Text()},
+		FinishReason: "stop",
+	}}
+	return completion, nil
+}
+
+// idempotencySessionID returns the ID of the session of the requests with the
+// idempotency key and the history, so that only a caller that sent the same
+// conversation is replayed its answer.
+func idempotencySessionID(key string, history []ChatMessage) string {
+	h := sha256.New()
+	json.NewEncoder(h).Encode(key)
+	json.NewEncoder(h).Encode(history)
+	return "idempotency-" + hex.EncodeToString(h.Sum(nil))
+}
+
+// stream writes the completion as server-sent events of chunks. Errors after
+// the first chunk are sent as an error event. With resumable streams, the
+// events are numbered and buffered, and the run goes on if the client leaves.
+func (s *service) stream(ctx context.Context, w nethttp.ResponseWriter, completion *ChatCompletion, input *blades.Message, opts []blades.RunOption) error {
+	completion.Object = "chat.completion.chunk"
+	var (
+		events  *eventStream
+		request = ctx
+	)
+	if s.events != nil {
+		events = s.events.open(completion.ID)
+		defer events.close()
+		ctx = context.WithoutCancel(ctx)
+	}
+	started, streamed, gone := false, false, false
+	emit := func(data []byte) error {
+		var id string
+		if events != nil {
+			id = events.append(data)
+		}
+		if gone {
+			return nil
+		}
+		if !started {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			started = true
+		}
+		err := writeEvent(w, id, data)
+		if events != nil && (err != nil || request.Err() != nil) {
+			// The client left; it resumes from the buffer.
+			gone = true
+			return nil
+		}
+		return err
+	}
+	send := func(choice ChatChoice) error {
+		completion.Choices = []ChatChoice{choice}
+		data, err := json.Marshal(completion)
+		if err != nil {
+			return err
+		}
+		return emit(data)
+	}
+	messages := s.runner.RunStream(ctx, input, opts...)
+	if s.smooth {
+		messages = stream.Smooth(messages, s.smoothOpts...)
+	}
+	for message, err := range messages {
+		if err != nil {
+			data, _ := json.Marshal(map[string]any{"error": map[string]any{"message": err.Error(), "code": blades.HTTPStatus(err)}})
+			if !started && !gone {
+				if events != nil {
+					events.append(data)
+				}
+				return toError(err)
+			}
+			return emit(data)
+		}
+		if message.Role != blades.RoleAssistant && message.Role != blades.RoleTool {
+			continue
+		}
+		var sendErr error
+		switch message.Status {
+		case blades.StatusIncomplete:
+			if message.Role == blades.RoleAssistant {
+				streamed = true
+				sendErr = send(ChatChoice{Delta: &ChatMessage{Role: "assistant", Content: message.Text()}})
+			}
+		case blades.StatusCompleted:
+			// Models that do not stream only send the completed message, and
+			// the text said around tool calls, e.g. "let me check the weather",
+			// with the calls.
+			if text := message.Text(); !streamed && (message.Role == blades.RoleAssistant || text != "") {
+				sendErr = send(ChatChoice{Delta: &ChatMessage{Role: "assistant", Content: text}})
+			}
+			streamed = false
+		}
+		if sendErr != nil {
+			return sendErr
+		}
+	}
+	if err := send(ChatChoice{Delta: &ChatMessage{}, FinishReason: "stop"}); err != nil {
+		return err
+	}
+	return emit([]byte("[DONE]"))
+}
+
+// resume writes the buffered events of a stream after the event of the ID,
+// then its live events until it ends.
+func (s *service) resume(ctx context.Context, w nethttp.ResponseWriter, lastEventID string) error {
+	id, seq, err := parseEventID(lastEventID)
+	if err != nil {
+		return errors.BadRequest("INVALID_ARGUMENT", err.Error())
+	}
+	events, ok := s.events.get(id)
+	if !ok {
+		return errors.NotFound("STREAM_NOT_FOUND", fmt.Sprintf("stream %s is not kept", id))
+	}
+	started := false
+	for {
+		missed, done, changed, err := events.since(seq)
+		if err != nil {
+			if !started {
+				return errors.New(nethttp.StatusGone, "EVENTS_EXPIRED", err.Error())
+			}
+			data, _ := json.Marshal(map[string]any{"error": map[string]any{"message": err.Error(), "code": nethttp.StatusGone}})
+			return writeEvent(w, "", data)
+		}
+		if !started {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			started = true
+		}
+		for _, event := range missed {
+			if err := writeEvent(w, eventID(id, event.seq), event.data); err != nil {
+				return err
+			}
+			seq = event.seq
+		}
+		if done {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// writeEvent writes a server-sent event, with its ID if it has one.
+func writeEvent(w nethttp.ResponseWriter, id string, data []byte) error {
+	var err error
+	if id != "" {
+		_, err = fmt.Fprintf(w, "id: %s\ndata: %s\n\n", id, data)
+	} else {
+		_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+	}
+	if err != nil {
+		return err
+	}
+	if f, ok := w.(nethttp.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// toMessage converts a chat message of the history.
+func toMessage(m ChatMessage) (*blades.Message, error) {
+	switch m.Role {
+	case "system", "developer":
+		return blades.SystemMessage(m.Content), nil
+	case "user":
+		return blades.UserMessage(m.Content), nil
+	case "assistant":
+		return blades.AssistantMessage(m.Content), nil
+	default:
+		return nil, errors.BadRequest("INVALID_ARGUMENT", fmt.Sprintf("unsupported role %q", m.Role))
+	}
+}
+
+// toError converts an agent error to a kratos error with the status of blades.HTTPStatus.
+func toError(err error) error {
+	code := blades.HTTPStatus(err)
+	reason := strings.ToUpper(strings.ReplaceAll(nethttp.StatusText(code), " ", "_"))
+	return errors.New(code, reason, err.Error()).WithCause(err)
+}
@@ -0,0 +1,233 @@
+package kratos
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/go-kratos/kratos/v2/transport/http"
+
+	"github.com/go-kratos/blades"
+	"github.com/go-kratos/blades/stream"
+	"github.com/go-kratos/blades/tools"
+)
+
+func TestRegisterHTTPServer(t *testing.T) {
+	var operations []string
+	record := func(name string) middleware.Middleware {
+		return func(next middleware.Handler) middleware.Handler {
+			return func(ctx context.Context, req any) (any, error) {
+				operation := name
+				if tr, ok := transport.FromServerContext(ctx); ok {
+					operation += " " + tr.Operation()
+				}
+				operations = append(operations, operation)
+				return next(ctx, req)
+			}
+		}
+	}
+	agent, err := blades.NewAgent("assistant",
+		blades.WithModel(echoModel{}),
+		blades.WithInstruction("Answer politely."),
+		blades.WithMiddleware(Middleware(record("agent"))),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := http.NewServer(http.Middleware(record("server")))
+	RegisterHTTPServer(srv, agent)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", ChatCompletionsPath, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		srv.ServeHTTP(w, req)
+		return w
+	}
+	w := post(`{"messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"hi"}]}`)
+	var completion ChatCompletion
+	if err := json.Unmarshal(w.Body.Bytes(), &completion); err != nil {
+		t.Fatalf("%v: %s", err, w.Body)
+	}
+	if completion.Model != "assistant" || len(completion.Choices) != 1 || completion.Choices[0].Message.Content != "Answer politely." {
+		t.Fatalf("unexpected completion %s", w.Body)
+	}
+	want := []string{"server " + OperationChatCompletions, "agent " + OperationChatCompletions}
+	if strings.Join(operations, ",") != strings.Join(want, ",") {
+		t.Fatalf("want middlewares %v, got %v", want, operations)
+	}
+
+	w = post(`{"stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+	body := w.Body.String()
+	if w.Header().Get("Content-Type") != "text/event-stream" || !strings.Contains(body, `"content":"Answer politely."`) || !strings.HasSuffix(body, "data: [DONE]\n\n") {
+		t.Fatalf("unexpected stream %q", body)
+	}
+
+	if w := post(`{"messages":[{"role":"tool","content":"x"},{"role":"user","content":"hi"}]}`); w.Code != 400 {
+		t.Fatalf("want 400 for an unsupported role, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest("GET", HealthPath, nil))
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `"healthy":true`) {
+		t.Fatalf("unexpected health %d %s", w.Code, w.Body)
+	}
+}
+
+// chunkModel streams its answer as a single delta.
+type chunkModel struct{ answer string }
+
+func (chunkModel) Name() string { return "chunk" }
+
+func (m chunkModel) Generate(ctx context.Context, req *blades.ModelRequest) (*blades.ModelResponse, error) {
+	message := blades.NewAssistantMessage(blades.StatusCompleted)
+	message.Parts = blades.Parts(m.answer)
+	return &blades.ModelResponse{Message: message}, nil
+}
+
+func (m chunkModel) NewStreaming(ctx context.Context, req *blades.ModelRequest) blades.Generator[*blades.ModelResponse, error] {
+	return func(yield func(*blades.ModelResponse, error) bool) {
+		delta := blades.NewAssistantMessage(blades.StatusIncomplete)
+		delta.Parts = blades.Parts(m.answer)
+		if !yield(&blades.ModelResponse{Message: delta}, nil) {
+			return
+		}
+		yield(m.Generate(ctx, req))
+	}
+}
+
+func TestRegisterHTTPServerSmoothing(t *testing.T) {
+	agent, err := blades.NewAgent("assistant", blades.WithModel(chunkModel{answer: "The quick brown fox jumps."}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := http.NewServer()
+	RegisterHTTPServer(srv, agent, WithSmoothing(stream.WithSmoothChars(5), stream.WithSmoothInterval(0)))
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", ChatCompletionsPath, strings.NewReader(`{"stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	srv.ServeHTTP(w, req)
+
+	var deltas []string
+	for _, line := range strings.Split(w.Body.String(), "\n\n") {
+		var chunk ChatCompletion
+		if json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &chunk) != nil || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+		deltas = append(deltas, chunk.Choices[0].Delta.Content)
+	}
+	if len(deltas) != 6 || strings.Join(deltas, "") != "The quick brown fox jumps." {
+		t.Fatalf("want the answer in chunks of 5 characters, got %q", deltas)
+	}
+}
+
+// narratingModel calls a tool with a remark, then answers.
+type narratingModel struct{}
+
+func (narratingModel) Name() string { return "narrating" }
+
+func (narratingModel) Generate(ctx context.Context, req *blades.ModelRequest) (*blades.ModelResponse, error) {
+	if last := req.Messages[len(req.Messages)-1]; last.Role == blades.RoleTool {
+		answer := blades.NewAssistantMessage(blades.StatusCompleted)
+		answer.Parts = blades.Parts(" It is sunny.")
+		return &blades.ModelResponse{Message: answer}, nil
+	}
+	message := &blades.Message{Role: blades.RoleTool, Status: blades.StatusCompleted, Parts: []blades.Part{
+		blades.TextPart{Text: "Let me check the weather."},
+		blades.ToolPart{ID: "call-1", Name: "weather", Request: "{}"},
+	}}
+	return &blades.ModelResponse{Message: message}, nil
+}
+
+func (m narratingModel) NewStreaming(ctx context.Context, req *blades.ModelRequest) blades.Generator[*blades.ModelResponse, error] {
+	return func(yield func(*blades.ModelResponse, error) bool) {
+		yield(m.Generate(ctx, req))
+	}
+}
+
+func TestRegisterHTTPServerToolNarration(t *testing.T) {
+	weather := tools.NewTool("weather", "Returns the weather.", tools.HandleFunc(func(ctx context.Context, input string) (string, error) {
+		return "sunny", nil
+	}))
+	agent, err := blades.NewAgent("assistant", blades.WithModel(narratingModel{}), blades.WithTools(weather))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := http.NewServer()
+	RegisterHTTPServer(srv, agent)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", ChatCompletionsPath, strings.NewReader(`{"stream":true,"messages":[{"role":"user","content":"Weather?"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	srv.ServeHTTP(w, req)
+	var content string
+	for _, line := range strings.Split(w.Body.String(), "\n\n") {
+		var chunk ChatCompletion
+		if json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &chunk) == nil && chunk.Choices[0].Delta != nil {
+			content += chunk.Choices[0].Delta.Content
+		}
+	}
+	if content != "Let me check the weather. It is sunny." {
+		t.Fatalf("want the narration before the answer, got %q", content)
+	}
+}
+
+// countModel answers with the number of the call.
+type countModel struct{ calls *atomic.Int64 }
+
+func (countModel) Name() string { return "count" }
+
+func (m countModel) Generate(ctx context.Context, req *blades.ModelRequest) (*blades.ModelResponse, error) {
+	message := blades.NewAssistantMessage(blades.StatusCompleted)
+	message.Parts = blades.Parts(fmt.Sprintf("answer %d", m.calls.Add(1)))
+	return &blades.ModelResponse{Message: message}, nil
+}
+
+func (m countModel) NewStreaming(ctx context.Context, req *blades.ModelRequest) blades.Generator[*blades.ModelResponse, error] {
+	return func(yield func(*blades.ModelResponse, error) bool) {
+		yield(m.Generate(ctx, req))
+	}
+}
+
+func TestRegisterHTTPServerIdempotencyKey(t *testing.T) {
+	var calls atomic.Int64
+	agent, err := blades.NewAgent("assistant", blades.WithModel(countModel{calls: &calls}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := http.NewServer()
+	RegisterHTTPServer(srv, agent)
+
+	post := func(key string, content ...string) string {
+		body := `{"messages":[{"role":"user","content":"hi"}]}`
+		if len(content) > 0 {
+			body = `{"messages":[{"role":"user","content":"` + content[0] + `"}]}`
+		}
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", ChatCompletionsPath, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		srv.ServeHTTP(w, req)
+		if w.Code == nethttp.StatusUnprocessableEntity {
+			return "reused"
+		}
+		var completion ChatCompletion
+		if err := json.Unmarshal(w.Body.Bytes(), &completion); err != nil || len(completion.Choices) != 1 {
+			t.Fatalf("unexpected completion %s", w.Body)
+		}
+		return completion.Choices[0].Message.Content
+	}
+	answers := []string{post("k1"), post("k1"), post("k2"), post(""), post("k1", "bye")}
+	want := []string{"answer 1", "answer 1", "answer 2", "answer 3", "reused"}
+	if strings.Join(answers, ",") != strings.Join(want, ",") {
+		t.Fatalf("want answers %v, got %v", want, answers)
+	}
+}
@@ -133,6 +133,20 @@ func (c *Client) ListTools(ctx context.Context) ([]*mcp.Tool, error) {
 	return result.Tools, nil
 }
 
+// Check connects to the server if needed and pings it.
+// It implements blades.Checkable.
+func (c *Client) Check(ctx context.Context) error {
+	if !c.connected.Load() {
+		if err := c.Connect(ctx); err != nil {
+			return err
+		}
+	}
+	if err := c.session.Ping(ctx, nil); err != nil {
+		return fmt.Errorf("mcp [%s] ping: %w", c.config.Name, err)
+	}
+	return nil
+}
+
 // Resolve implements the tools.Resolver interface.
 func (c *Client) Resolve(ctx context.Context) ([]tools.Tool, error) {
 	ctx, cancel := context.WithTimeout(ctx, c.config.Timeout)
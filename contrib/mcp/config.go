@@ -39,6 +39,10 @@ type ClientConfig struct {
 	Headers map[string]string
 	// Timeout is the request timeout duration
 	Timeout time.Duration
+	// SensitiveFields are masked in the arguments of every tool of the
+	// server wherever the calls are logged, traced or recorded; see
+	// tools.MaskArguments.
+	SensitiveFields []string
 }
 
 // validate checks if the configuration is valid
@@ -2,6 +2,7 @@ package mcp
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"sync/atomic"
@@ -35,6 +36,18 @@ func NewToolsResolver(configs ...ClientConfig) (*ToolsResolver, error) {
 	}, nil
 }
 
+// Check checks every MCP server and returns the joined errors.
+// It implements blades.Checkable.
+func (r *ToolsResolver) Check(ctx context.Context) error {
+	var errs []error
+	for _, client := range r.clients {
+		if err := client.Check(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
 func (r *ToolsResolver) getTools() []tools.Tool {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -77,7 +90,7 @@ func (r *ToolsResolver) Resolve(ctx context.Context) ([]tools.Tool, error) {
 				errors = append(errors, fmt.Errorf("failed to convert MCP tool [%s]: %w", mcpTool.Name, err))
 				continue
 			}
-			allTools = append(allTools, tool)
+			allTools = append(allTools, tools.MarkSensitive(tool, client.config.SensitiveFields...))
 		}
 	}
 	// If we collected errors but also got some tools, log errors but continue
@@ -63,14 +63,26 @@ func (m *audioModel) Name() string {
 	return m.model
 }
 
-func (m *audioModel) buildAudioParams(req *blades.ModelRequest) openai.AudioSpeechNewParams {
+func (m *audioModel) buildAudioParams(ctx context.Context, req *blades.ModelRequest) (openai.AudioSpeechNewParams, error) {
+	// System and developer messages are instructions, not text to speak.
+	var (
+		system = []*blades.Message{req.Instruction}
+		input  = make([]*blades.Message, 0, len(req.Messages))
+	)
+	for _, msg := range req.Messages {
+		if blades.IsSystemRole(msg.Role) {
+			system = append(system, msg)
+		} else {
+			input = append(input, msg)
+		}
+	}
 	params := openai.AudioSpeechNewParams{
-		Input: promptFromMessages(req.Messages),
-		Model: m.model,
+		Input: promptFromMessages(input),
+		Model: blades.ResolveModel(ctx, m.model),
 		Voice: openai.AudioSpeechNewParamsVoice(m.config.Voice),
 	}
-	if req.Instruction != nil {
-		params.Instructions = param.NewOpt(req.Instruction.Text())
+	if text := blades.JoinSystemMessages(system...); text != "" {
+		params.Instructions = param.NewOpt(text)
 	}
 	if m.config.ResponseFormat != "" {
 		params.ResponseFormat = openai.AudioSpeechNewParamsResponseFormat(m.config.ResponseFormat)
@@ -84,13 +96,19 @@ func (m *audioModel) buildAudioParams(req *blades.ModelRequest) openai.AudioSpee
 	if len(m.config.ExtraFields) > 0 {
 		params.SetExtraFields(m.config.ExtraFields)
 	}
-	return params
+	if err := applyExtensions(&params, req); err != nil {
+		return params, err
+	}
+	return params, nil
 }
 
 // Generate generates audio from text input using the configured OpenAI model.
 func (p *audioModel) Generate(ctx context.Context, req *blades.ModelRequest) (*blades.ModelResponse, error) {
-	params := p.buildAudioParams(req)
-	resp, err := p.client.Audio.Speech.New(ctx, params)
+	params, err := p.buildAudioParams(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Audio.Speech.New(ctx, params, requestOptions(ctx)...)
 	if err != nil {
 		return nil, err
 	}
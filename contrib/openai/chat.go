@@ -5,8 +5,13 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"log"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
 
 	"github.com/go-kratos/blades"
+	"github.com/go-kratos/blades/stream"
 	"github.com/go-kratos/blades/tools"
 	"github.com/openai/openai-go/v3"
 	"github.com/openai/openai-go/v3/option"
@@ -27,12 +32,26 @@ type Config struct {
 	ExtraFields      map[string]any
 	RequestOptions   []option.RequestOption
 	ReasoningEffort  shared.ReasoningEffort
+	// Compatibility is the profile of an OpenAI-compatible backend. If nil, it
+	// is detected from the base URL, e.g. DeepSeek or OpenRouter.
+	Compatibility *Compatibility
+	// StreamResume configures how streams that break midway are resumed; by
+	// default they are.
+	StreamResume StreamResume
+	// OnDecodeWarning is called with the deviations from the chat completions
+	// format that were tolerated in a response, such as string-typed numbers
+	// or skipped malformed chunks. By default they are logged to Logger.
+	OnDecodeWarning func(ctx context.Context, warning string)
+	// Logger receives the decode warnings when OnDecodeWarning is not set.
+	// Defaults to slog.Default().
+	Logger *slog.Logger
 }
 
 // chatModel implements blades.chatModel for OpenAI-compatible chat models.
 type chatModel struct {
 	model  string
 	config Config
+	compat Compatibility
 	client openai.Client
 }
 
@@ -48,9 +67,14 @@ func NewModel(model string, config Config) blades.ModelProvider {
 	if config.APIKey != "" {
 		opts = append(opts, option.WithAPIKey(config.APIKey))
 	}
+	compat := detectCompatibility(config.BaseURL)
+	if config.Compatibility != nil {
+		compat = *config.Compatibility
+	}
 	return &chatModel{
 		model:  model,
 		config: config,
+		compat: compat,
 		client: openai.NewClient(opts...),
 	}
 }
@@ -60,69 +84,200 @@ func (m *chatModel) Name() string {
 	return m.model
 }
 
+// Capabilities reports that streamed responses of backends without
+// stream_options may not report the token usage.
+// It implements blades.CapabilityProvider.
+func (m *chatModel) Capabilities(model string) blades.ModelCapabilities {
+	if m.compat.OmitStreamOptions {
+		return blades.ModelCapabilities{StreamingUsage: blades.Unsupported}
+	}
+	return blades.ModelCapabilities{}
+}
+
+// Check verifies that the API is reachable and serves the model.
+// It implements blades.Checkable.
+func (m *chatModel) Check(ctx context.Context) error {
+	_, err := m.client.Models.Get(ctx, blades.ResolveModel(ctx, m.model), requestOptions(ctx)...)
+	return err
+}
+
 // Generate executes a non-streaming chat completion request.
 func (m *chatModel) Generate(ctx context.Context, req *blades.ModelRequest) (*blades.ModelResponse, error) {
-	params, err := m.toChatCompletionParams(req)
+	params, err := m.toChatCompletionParams(ctx, req)
 	if err != nil {
 		return nil, err
 	}
-	chatResponse, err := m.client.Chat.Completions.New(ctx, params)
+	if err := applyExtensions(&params, req); err != nil {
+		return nil, err
+	}
+	opts := append(requestOptions(ctx), option.WithMiddleware(tolerantDecoding(m.config.OnDecodeWarning, m.config.Logger)))
+	chatResponse, err := m.client.Chat.Completions.New(ctx, params, opts...)
 	if err != nil {
 		return nil, err
 	}
-	res, err := choiceToResponse(ctx, params, chatResponse)
+	res, err := m.choiceToResponse(ctx, params, chatResponse)
 	if err != nil {
 		return nil, err
 	}
+	res.RawResponse = json.RawMessage(chatResponse.RawJSON())
+	annotateIgnoredOptions(res.Message, req)
 	return res, nil
 }
 
+// RenderRequest returns the JSON body of the chat completion request.
+func (m *chatModel) RenderRequest(ctx context.Context, req *blades.ModelRequest) (json.RawMessage, error) {
+	params, err := m.toChatCompletionParams(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyExtensions(&params, req); err != nil {
+		return nil, err
+	}
+	return json.Marshal(params)
+}
+
 // NewStreaming streams chat completion chunks and converts each choice delta
 // into a ModelResponse for incremental consumption.
 func (m *chatModel) NewStreaming(ctx context.Context, req *blades.ModelRequest) blades.Generator[*blades.ModelResponse, error] {
 	return func(yield func(*blades.ModelResponse, error) bool) {
-		params, err := m.toChatCompletionParams(req)
+		if req.Options.CandidateCount > 1 {
+			yield(nil, blades.ErrStreamingCandidates)
+			return
+		}
+		params, err := m.toChatCompletionParams(ctx, req)
 		if err != nil {
 			yield(nil, err)
 			return
 		}
-		streaming := m.client.Chat.Completions.NewStreaming(ctx, params)
-		defer streaming.Close()
-		acc := openai.ChatCompletionAccumulator{}
-		for streaming.Next() {
-			chunk := streaming.Current()
-			acc.AddChunk(chunk)
-			message, err := chunkChoiceToResponse(ctx, chunk.Choices)
-			if err != nil {
+		capabilities, _ := blades.LookupModelCapabilities(params.Model)
+		if !m.compat.OmitStreamOptions && capabilities.StreamingUsage != blades.Unsupported {
+			// Request the usage chunk, so that the final response reports token usage.
+			params.StreamOptions.IncludeUsage = param.NewOpt(true)
+		}
+		if err := applyExtensions(&params, req); err != nil {
+			yield(nil, err)
+			return
+		}
+		opts := append(requestOptions(ctx), option.WithMiddleware(skipSSEComments, tolerantDecoding(m.config.OnDecodeWarning, m.config.Logger)))
+		var (
+			acc       openai.ChatCompletionAccumulator
+			cached    int64
+			reasoning strings.Builder
+			// text is the response text received so far, and prefix the part
+			// of it received before the last resumption.
+			text, prefix strings.Builder
+			usage        blades.TokenUsage
+			messages     = params.Messages
+			resumes      int
+			// layout keeps the order of the text and tool calls the accumulator merges.
+			layout streamLayout
+		)
+		for {
+			acc = openai.ChatCompletionAccumulator{}
+			layout = streamLayout{}
+			received, toolCalls := false, false
+			// The chunks are read ahead of the consumer through a pipe.
+			chunks := stream.Produce(ctx, func(ctx context.Context, send func(openai.ChatCompletionChunk) error) error {
+				streaming := m.client.Chat.Completions.NewStreaming(ctx, params, opts...)
+				defer streaming.Close()
+				for streaming.Next() {
+					if err := send(streaming.Current()); err != nil {
+						return err
+					}
+				}
+				return streaming.Err()
+			})
+			var err error
+			for chunk, e := range chunks {
+				if e != nil {
+					err = e
+					break
+				}
+				acc.AddChunk(chunk)
+				layout.add(chunk.Choices)
+				// The accumulator does not sum the prompt token details.
+				cached += cachedTokens(chunk.Usage)
+				if len(chunk.Choices) == 0 {
+					continue
+				}
+				message, err := m.chunkChoiceToResponse(ctx, chunk.Choices)
+				if err != nil {
+					yield(nil, err)
+					return
+				}
+				message.RawResponse = json.RawMessage(chunk.RawJSON())
+				for _, part := range message.Message.Parts {
+					switch v := part.(type) {
+					case blades.ReasoningPart:
+						reasoning.WriteString(v.Text)
+					case blades.ToolPart:
+						toolCalls = true
+					}
+				}
+				if message.Message.Role == blades.RoleAssistant {
+					text.WriteString(message.Message.Text())
+				}
+				received = true
+				if !yield(message, nil) {
+					return
+				}
+			}
+			if err == nil {
+				break
+			}
+			// A stream that broke after part of the text is resumed with that text as a prefix.
+			if !received || toolCalls || resumes >= m.config.StreamResume.attempts() || !brokenStream(ctx, err) {
 				yield(nil, err)
 				return
 			}
-			if !yield(message, nil) {
+			if err := wait(ctx, m.config.StreamResume.backoff(resumes)); err != nil {
+				yield(nil, err)
 				return
 			}
+			// The broken stream rarely reports its usage, which is then unknown.
+			usage = usage.Add(convertUsage(acc.Usage))
+			prefix.Reset()
+			prefix.WriteString(text.String())
+			params = resumeParams(params, messages, text.String())
+			resumes++
 		}
-		if err := streaming.Err(); err != nil {
-			yield(nil, err)
-			return
-		}
-		finalResponse, err := choiceToResponse(ctx, params, &acc.ChatCompletion)
+		finalResponse, err := m.choiceToResponse(ctx, params, &acc.ChatCompletion)
 		if err != nil {
 			yield(nil, err)
 			return
 		}
+		layout.apply(finalResponse.Message)
+		finalResponse.Message.TokenUsage = usage.Add(finalResponse.Message.TokenUsage)
+		finalResponse.Message.TokenUsage.CachedInputTokens = cached
+		if resumes > 0 {
+			prependText(finalResponse.Message, prefix.String())
+			finalResponse.Message.Metadata[StreamResumesKey] = resumes
+		}
+		// The accumulator drops the nonstandard reasoning field.
+		if reasoning.Len() > 0 {
+			finalResponse.Message.Parts = append([]blades.Part{blades.ReasoningPart{Text: reasoning.String()}}, finalResponse.Message.Parts...)
+		}
+		annotateIgnoredOptions(finalResponse.Message, req)
 		yield(finalResponse, nil)
 	}
 }
 
+// annotateIgnoredOptions notes the model options that chat completions do not support.
+func annotateIgnoredOptions(message *blades.Message, req *blades.ModelRequest) {
+	if req.Options.TopK != nil {
+		message.Metadata[blades.IgnoredOptionsKey] = []string{"top_k"}
+	}
+}
+
 // toChatCompletionParams converts a generic model request into OpenAI params.
-func (m *chatModel) toChatCompletionParams(req *blades.ModelRequest) (openai.ChatCompletionNewParams, error) {
+func (m *chatModel) toChatCompletionParams(ctx context.Context, req *blades.ModelRequest) (openai.ChatCompletionNewParams, error) {
 	tools, err := toTools(req.Tools)
 	if err != nil {
 		return openai.ChatCompletionNewParams{}, err
 	}
 	params := openai.ChatCompletionNewParams{
 		Tools:           tools,
-		Model:           m.model,
+		Model:           blades.ResolveModel(ctx, m.model),
 		ReasoningEffort: m.config.ReasoningEffort,
 		Messages:        make([]openai.ChatCompletionMessageParamUnion, 0, len(req.Messages)),
 	}
@@ -147,6 +302,25 @@ func (m *chatModel) toChatCompletionParams(req *blades.ModelRequest) (openai.Cha
 	if len(m.config.StopSequences) > 0 {
 		params.Stop = openai.ChatCompletionNewParamsStopUnion{OfStringArray: m.config.StopSequences}
 	}
+	// Per-request model options override the static config.
+	if req.Options.Seed != nil {
+		params.Seed = param.NewOpt(*req.Options.Seed)
+	}
+	if req.Options.CandidateCount > 0 {
+		params.N = param.NewOpt(req.Options.CandidateCount)
+	}
+	if req.Options.Logprobs {
+		params.Logprobs = param.NewOpt(true)
+	}
+	if req.Options.FrequencyPenalty != nil {
+		params.FrequencyPenalty = param.NewOpt(*req.Options.FrequencyPenalty)
+	}
+	if req.Options.PresencePenalty != nil {
+		params.PresencePenalty = param.NewOpt(*req.Options.PresencePenalty)
+	}
+	if len(req.Options.StopSequences) > 0 {
+		params.Stop = openai.ChatCompletionNewParamsStopUnion{OfStringArray: req.Options.StopSequences}
+	}
 	if len(m.config.ExtraFields) > 0 {
 		params.SetExtraFields(m.config.ExtraFields)
 	}
@@ -166,20 +340,34 @@ func (m *chatModel) toChatCompletionParams(req *blades.ModelRequest) (openai.Cha
 			OfJSONSchema: &openai.ResponseFormatJSONSchemaParam{JSONSchema: schemaParam},
 		}
 	}
-	if req.Instruction != nil {
-		params.Messages = append(params.Messages, openai.SystemMessage(toTextParts(req.Instruction)))
+	messages := req.Messages
+	if m.compat.SingleSystemMessage {
+		system := []*blades.Message{req.Instruction}
+		messages = make([]*blades.Message, 0, len(req.Messages))
+		for _, msg := range req.Messages {
+			if blades.IsSystemRole(msg.Role) {
+				system = append(system, msg)
+			} else {
+				messages = append(messages, msg)
+			}
+		}
+		if text := blades.JoinSystemMessages(system...); text != "" {
+			params.Messages = append(params.Messages, m.systemMessage(blades.RoleSystem, blades.SystemMessage(text)))
+		}
+	} else if req.Instruction != nil {
+		params.Messages = append(params.Messages, m.systemMessage(blades.RoleSystem, req.Instruction))
 	}
-	for _, msg := range req.Messages {
+	for _, msg := range messages {
 		switch msg.Role {
 		case blades.RoleUser:
 			params.Messages = append(params.Messages, openai.UserMessage(toContentParts(msg)))
 		case blades.RoleAssistant:
-			params.Messages = append(params.Messages, openai.UserMessage(toContentParts(msg)))
-		case blades.RoleSystem:
-			params.Messages = append(params.Messages, openai.SystemMessage(toTextParts(msg)))
+			params.Messages = append(params.Messages, openai.AssistantMessage(msg.Text()))
+		case blades.RoleSystem, blades.RoleDeveloper:
+			params.Messages = append(params.Messages, m.systemMessage(msg.Role, msg))
 		case blades.RoleTool:
 			params.Messages = append(params.Messages, toToolCallMessage(msg))
-			// Also include any tool responses in the messages.
+			// Each tool response is linked to its call by the tool_call_id.
 			for _, part := range msg.Parts {
 				switch v := any(part).(type) {
 				case blades.ToolPart:
@@ -191,6 +379,30 @@ func (m *chatModel) toChatCompletionParams(req *blades.ModelRequest) (openai.Cha
 	return params, nil
 }
 
+// systemMessage converts a system or developer message. Reasoning models take
+// system instructions with the developer role, and backends without the
+// developer role take developer instructions with the system role.
+func (m *chatModel) systemMessage(role blades.Role, msg *blades.Message) openai.ChatCompletionMessageParamUnion {
+	if role == blades.RoleSystem && developerModel(m.model) {
+		role = blades.RoleDeveloper
+	}
+	if role == blades.RoleDeveloper && !m.compat.NoDeveloperRole {
+		return openai.DeveloperMessage(toTextParts(msg))
+	}
+	return openai.SystemMessage(toTextParts(msg))
+}
+
+// developerModel reports whether the model expects instructions with the
+// developer role, as the o-series and GPT-5 reasoning models do.
+func developerModel(model string) bool {
+	for _, prefix := range []string{"o1", "o3", "o4", "gpt-5"} {
+		if strings.HasPrefix(model, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 func toToolCallMessage(msg *blades.Message) openai.ChatCompletionMessageParamUnion {
 	toolCalls := make([]openai.ChatCompletionMessageToolCallUnionParam, 0, len(msg.Parts))
 	for _, part := range msg.Parts {
@@ -207,11 +419,12 @@ func toToolCallMessage(msg *blades.Message) openai.ChatCompletionMessageParamUni
 			})
 		}
 	}
-	return openai.ChatCompletionMessageParamUnion{
-		OfAssistant: &openai.ChatCompletionAssistantMessageParam{
-			ToolCalls: toolCalls,
-		},
+	assistant := &openai.ChatCompletionAssistantMessageParam{ToolCalls: toolCalls}
+	// Chat completions take the text said around the calls as a single content.
+	if text := msg.Text(); text != "" {
+		assistant.Content.OfString = param.NewOpt(text)
 	}
+	return openai.ChatCompletionMessageParamUnion{OfAssistant: assistant}
 }
 
 func toTools(tools []tools.Tool) ([]openai.ChatCompletionToolUnionParam, error) {
@@ -330,55 +543,98 @@ func choiceToToolCalls(ctx context.Context, tools []*tools.Tool, choices []opena
 	}, nil
 }
 
-// choiceToResponse converts a non-streaming choice to a ModelResponse.
-func choiceToResponse(ctx context.Context, params openai.ChatCompletionNewParams, cc *openai.ChatCompletion) (*blades.ModelResponse, error) {
-	message := blades.NewAssistantMessage(blades.StatusCompleted)
-	message.TokenUsage = blades.TokenUsage{
-		InputTokens:  cc.Usage.PromptTokens,
-		OutputTokens: cc.Usage.CompletionTokens,
-		TotalTokens:  cc.Usage.TotalTokens,
-	}
+// choiceToResponse converts a non-streaming completion to a ModelResponse.
+// The first choice is the message and the others are its alternatives.
+func (m *chatModel) choiceToResponse(ctx context.Context, params openai.ChatCompletionNewParams, cc *openai.ChatCompletion) (*blades.ModelResponse, error) {
+	res := &blades.ModelResponse{}
 	for _, choice := range cc.Choices {
-		if choice.Message.Content != "" {
-			message.Parts = append(message.Parts, blades.TextPart{Text: choice.Message.Content})
-		}
-		if choice.Message.Audio.Data != "" {
-			bytes, err := base64.StdEncoding.DecodeString(choice.Message.Audio.Data)
-			if err != nil {
-				return nil, err
-			}
-			message.Parts = append(message.Parts, blades.DataPart{Bytes: bytes})
+		message, err := m.choiceToMessage(choice)
+		if err != nil {
+			return nil, err
 		}
-		if choice.Message.Refusal != "" {
-			// TODO: map refusal codes to specific error types
+		if res.Message == nil {
+			res.Message = message
+		} else {
+			res.Alternatives = append(res.Alternatives, message)
 		}
-		if choice.FinishReason != "" {
-			message.FinishReason = choice.FinishReason
+	}
+	if res.Message == nil {
+		res.Message = blades.NewAssistantMessage(blades.StatusCompleted)
+	}
+	// The usage covers all choices.
+	res.Message.TokenUsage = convertUsage(cc.Usage)
+	if cc.SystemFingerprint != "" {
+		// The fingerprint changes with the backend configuration, which affects determinism.
+		res.Message.Metadata["system_fingerprint"] = cc.SystemFingerprint
+	}
+	return res, nil
+}
+
+// choiceToMessage converts a non-streaming choice to a message.
+func (m *chatModel) choiceToMessage(choice openai.ChatCompletionChoice) (*blades.Message, error) {
+	message := blades.NewAssistantMessage(blades.StatusCompleted)
+	if text := m.compat.reasoning(choice.Message.JSON.ExtraFields); text != "" {
+		message.Parts = append(message.Parts, blades.ReasoningPart{Text: text})
+	}
+	if choice.Message.Content != "" {
+		message.Parts = append(message.Parts, blades.TextPart{Text: choice.Message.Content})
+	}
+	if choice.Message.Audio.Data != "" {
+		bytes, err := base64.StdEncoding.DecodeString(choice.Message.Audio.Data)
+		if err != nil {
+			return nil, err
 		}
-		for _, call := range choice.Message.ToolCalls {
-			message.Role = blades.RoleTool
-			message.Parts = append(message.Parts, blades.ToolPart{
-				ID:      call.ID,
-				Name:    call.Function.Name,
-				Request: call.Function.Arguments,
-			})
+		message.Parts = append(message.Parts, blades.DataPart{Bytes: bytes})
+	}
+	if choice.FinishReason != "" {
+		message.FinishReason = finishReason(choice.FinishReason)
+	}
+	if choice.Message.Refusal != "" {
+		message.Parts = append(message.Parts, blades.TextPart{Text: choice.Message.Refusal})
+		message.FinishReason = blades.FinishReasonRefusal
+	}
+	for _, call := range choice.Message.ToolCalls {
+		message.Role = blades.RoleTool
+		message.Parts = append(message.Parts, blades.ToolPart{
+			ID:      call.ID,
+			Name:    call.Function.Name,
+			Request: call.Function.Arguments,
+		})
+	}
+	if tokens := choice.Logprobs.Content; len(tokens) > 0 {
+		var sum float64
+		for _, token := range tokens {
+			sum += token.Logprob
 		}
+		message.Metadata[blades.AverageLogprobKey] = sum / float64(len(tokens))
 	}
-	return &blades.ModelResponse{Message: message}, nil
+	return message, nil
+}
+
+// finishReason converts a finish reason of chat completions.
+func finishReason(reason string) blades.FinishReason {
+	if reason == "function_call" {
+		return blades.FinishReasonToolCalls
+	}
+	return blades.FinishReason(reason)
 }
 
 // chunkChoiceToResponse converts a streaming chunk choice to a ModelResponse.
-func chunkChoiceToResponse(ctx context.Context, choices []openai.ChatCompletionChunkChoice) (*blades.ModelResponse, error) {
+func (m *chatModel) chunkChoiceToResponse(ctx context.Context, choices []openai.ChatCompletionChunkChoice) (*blades.ModelResponse, error) {
 	message := blades.NewAssistantMessage(blades.StatusIncomplete)
 	for _, choice := range choices {
+		if text := m.compat.reasoning(choice.Delta.JSON.ExtraFields); text != "" {
+			message.Parts = append(message.Parts, blades.ReasoningPart{Text: text})
+		}
 		if choice.Delta.Content != "" {
 			message.Parts = append(message.Parts, blades.TextPart{Text: choice.Delta.Content})
 		}
-		if choice.Delta.Refusal != "" {
-			// TODO: map refusal codes to specific error types
-		}
 		if choice.FinishReason != "" {
-			message.FinishReason = choice.FinishReason
+			message.FinishReason = finishReason(choice.FinishReason)
+		}
+		if choice.Delta.Refusal != "" {
+			message.Parts = append(message.Parts, blades.TextPart{Text: choice.Delta.Refusal})
+			message.FinishReason = blades.FinishReasonRefusal
 		}
 		for _, call := range choice.Delta.ToolCalls {
 			message.Role = blades.RoleTool
@@ -391,3 +647,83 @@ func chunkChoiceToResponse(ctx context.Context, choices []openai.ChatCompletionC
 	}
 	return &blades.ModelResponse{Message: message}, nil
 }
+
+// streamLayout records how the first choice of a stream interleaves its text
+// and tool calls, e.g. a remark between two calls, which the accumulated
+// completion loses by joining the text into a single content.
+type streamLayout struct {
+	entries []layoutEntry
+	calls   map[int64]bool
+}
+
+// layoutEntry is a run of text or, if call is set, a tool call by its index.
+type layoutEntry struct {
+	text  string
+	call  bool
+	index int64
+}
+
+func (l *streamLayout) add(choices []openai.ChatCompletionChunkChoice) {
+	for _, choice := range choices {
+		if choice.Index != 0 {
+			continue
+		}
+		if text := choice.Delta.Content; text != "" {
+			if n := len(l.entries); n > 0 && !l.entries[n-1].call {
+				l.entries[n-1].text += text
+			} else {
+				l.entries = append(l.entries, layoutEntry{text: text})
+			}
+		}
+		for _, call := range choice.Delta.ToolCalls {
+			if l.calls[call.Index] {
+				continue
+			}
+			if l.calls == nil {
+				l.calls = make(map[int64]bool)
+			}
+			l.calls[call.Index] = true
+			l.entries = append(l.entries, layoutEntry{call: true, index: call.Index})
+		}
+	}
+}
+
+// apply orders the text and tool parts of the accumulated message as they
+// were streamed. Messages whose text all came before the calls are unchanged.
+func (l *streamLayout) apply(message *blades.Message) {
+	interleaved := false
+	for i := 1; i < len(l.entries); i++ {
+		if l.entries[i-1].call && !l.entries[i].call {
+			interleaved = true
+		}
+	}
+	if !interleaved {
+		return
+	}
+	var (
+		parts []blades.Part
+		calls []blades.ToolPart
+	)
+	for _, part := range message.Parts {
+		switch v := part.(type) {
+		case blades.ToolPart:
+			calls = append(calls, v)
+		case blades.TextPart:
+		default:
+			parts = append(parts, part)
+		}
+	}
+	if len(calls) != len(l.calls) {
+		return
+	}
+	// The accumulated calls are ordered by their index.
+	indices := slices.Sorted(maps.Keys(l.calls))
+	for _, entry := range l.entries {
+		if !entry.call {
+			parts = append(parts, blades.TextPart{Text: entry.text})
+			continue
+		}
+		parts = append(parts, calls[slices.Index(indices, entry.index)])
+	}
+	message.Parts = parts
+}
@@ -0,0 +1,608 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/blades"
+	"github.com/go-kratos/blades/providertest"
+	"github.com/openai/openai-go/v3/option"
+)
+
+// newTestServer serves a canned chat completion and records the request body.
+func newTestServer(t *testing.T, body *map[string]any, respond func(w http.ResponseWriter)) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		if err := json.Unmarshal(data, body); err != nil {
+			t.Error(err)
+		}
+		respond(w)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newRequest() *blades.ModelRequest {
+	req := &blades.ModelRequest{Messages: []*blades.Message{blades.UserMessage("List two colors.")}}
+	req.Options.Apply(
+		blades.Seed(7),
+		blades.StopSequences("\n\n"),
+		blades.FrequencyPenalty(0.5),
+		blades.PresencePenalty(0.25),
+		blades.TopK(40),
+	)
+	return req
+}
+
+func TestChatModelOptions(t *testing.T) {
+	var body map[string]any
+	server := newTestServer(t, &body, func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"c1","object":"chat.completion","created":1,"model":"gpt-test","system_fingerprint":"fp_123",
+			"choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"red"}}],
+			"usage":{"prompt_tokens":3,"completion_tokens":1,"total_tokens":4,"prompt_tokens_details":{"cached_tokens":2}}}`)
+	})
+	model := NewModel("gpt-test", Config{
+		BaseURL:          server.URL,
+		APIKey:           "test",
+		FrequencyPenalty: 0.1,
+		RequestOptions:   []option.RequestOption{option.WithMaxRetries(0)},
+	})
+	res, err := model.Generate(context.Background(), newRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"seed":              float64(7),
+		"stop":              []any{"\n\n"},
+		"frequency_penalty": 0.5,
+		"presence_penalty":  0.25,
+	}
+	for key, value := range want {
+		if !reflect.DeepEqual(body[key], value) {
+			t.Fatalf("%s: want %v, got %v", key, value, body[key])
+		}
+	}
+	if _, ok := body["top_k"]; ok {
+		t.Fatal("top_k is not supported by chat completions and must not be sent")
+	}
+	if got := res.Message.Metadata["system_fingerprint"]; got != "fp_123" {
+		t.Fatalf("expected system fingerprint, got %v", got)
+	}
+	if got := res.Message.Metadata[blades.IgnoredOptionsKey]; !reflect.DeepEqual(got, []string{"top_k"}) {
+		t.Fatalf("expected ignored options note, got %v", got)
+	}
+	if usage := res.Message.TokenUsage; usage.InputTokens != 3 || usage.CachedInputTokens != 2 {
+		t.Fatalf("unexpected usage: %+v", usage)
+	}
+}
+
+func TestChatSystemMessages(t *testing.T) {
+	tests := []struct {
+		name   string
+		model  string
+		compat Compatibility
+		want   []string
+	}{
+		{"system model", "gpt-4o", CompatibilityOpenAI, []string{"system: Be brief.", "system: Answer in French.", "developer: Use metric units.", "user: Hello"}},
+		{"reasoning model", "o3-mini", CompatibilityOpenAI, []string{"developer: Be brief.", "developer: Answer in French.", "developer: Use metric units.", "user: Hello"}},
+		{"no developer role", "o3-mini", CompatibilityDeepSeek, []string{"system: Be brief.", "system: Answer in French.", "system: Use metric units.", "user: Hello"}},
+		{"single system message", "gpt-4o", Compatibility{SingleSystemMessage: true}, []string{"system: Be brief.\n\nAnswer in French.\n\nUse metric units.", "user: Hello"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body map[string]any
+			server := newTestServer(t, &body, func(w http.ResponseWriter) {
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprint(w, `{"id":"c1","object":"chat.completion","created":1,"model":"gpt-test",
+					"choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"ok"}}]}`)
+			})
+			model := NewModel(tt.model, Config{
+				BaseURL:        server.URL,
+				APIKey:         "test",
+				Compatibility:  &tt.compat,
+				RequestOptions: []option.RequestOption{option.WithMaxRetries(0)},
+			})
+			req := &blades.ModelRequest{
+				Instruction: blades.SystemMessage("Be brief."),
+				Messages: []*blades.Message{
+					blades.SystemMessage("Answer in French."),
+					blades.DeveloperMessage("Use metric units."),
+					blades.UserMessage("Hello"),
+				},
+			}
+			if _, err := model.Generate(context.Background(), req); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, m := range body["messages"].([]any) {
+				message := m.(map[string]any)
+				var texts []string
+				for _, part := range message["content"].([]any) {
+					texts = append(texts, part.(map[string]any)["text"].(string))
+				}
+				got = append(got, fmt.Sprintf("%s: %s", message["role"], strings.Join(texts, "")))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("want messages %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestChatToolHistory(t *testing.T) {
+	var body map[string]any
+	server := newTestServer(t, &body, func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"c1","object":"chat.completion","created":1,"model":"gpt-test",
+			"choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"ok"}}]}`)
+	})
+	model := NewModel("gpt-4o", Config{
+		BaseURL:        server.URL,
+		APIKey:         "test",
+		RequestOptions: []option.RequestOption{option.WithMaxRetries(0)},
+	})
+	req := &blades.ModelRequest{
+		Messages: []*blades.Message{
+			blades.UserMessage("Weather in Paris?"),
+			{Role: blades.RoleTool, Parts: []blades.Part{
+				blades.ToolPart{ID: "call-1", Name: "weather", Request: `{"city":"Paris"}`, Response: "sunny"},
+			}},
+			blades.AssistantMessage("It is sunny."),
+			blades.UserMessage("And tomorrow?"),
+		},
+	}
+	if _, err := model.Generate(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	messages := body["messages"].([]any)
+	var roles []string
+	for _, m := range messages {
+		roles = append(roles, m.(map[string]any)["role"].(string))
+	}
+	if want := []string{"user", "assistant", "tool", "assistant", "user"}; !reflect.DeepEqual(roles, want) {
+		t.Fatalf("want roles %q, got %q", want, roles)
+	}
+	call := messages[1].(map[string]any)["tool_calls"].([]any)[0].(map[string]any)
+	if call["id"] != "call-1" || call["function"].(map[string]any)["arguments"] != `{"city":"Paris"}` {
+		t.Fatalf("want the tool call replayed, got %v", call)
+	}
+	if result := messages[2].(map[string]any); result["tool_call_id"] != "call-1" || result["content"] != "sunny" {
+		t.Fatalf("want the tool result linked to the call, got %v", result)
+	}
+	if answer := messages[3].(map[string]any); answer["content"] != "It is sunny." {
+		t.Fatalf("want the assistant answer replayed, got %v", answer)
+	}
+}
+
+func TestChatExtensions(t *testing.T) {
+	var body map[string]any
+	server := newTestServer(t, &body, func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"c1","object":"chat.completion","created":1,"model":"gpt-test","service_tier":"flex",
+			"choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"ok"}}]}`)
+	})
+	model := NewModel("gpt-4o", Config{
+		BaseURL:        server.URL,
+		APIKey:         "test",
+		RequestOptions: []option.RequestOption{option.WithMaxRetries(0)},
+	})
+	req := newRequest()
+	req.Options.Apply(blades.ProviderOptions(map[string]any{"service_tier": "flex"}))
+	req.Extensions = map[string]any{"prediction": map[string]any{"type": "content", "content": "red, blue"}}
+	res, err := model.Generate(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body["service_tier"] != "flex" || body["seed"] != float64(7) {
+		t.Fatalf("want the provider options merged into the request, got %v", body)
+	}
+	if prediction, _ := body["prediction"].(map[string]any); prediction["content"] != "red, blue" {
+		t.Fatalf("want the extensions merged into the request, got %v", body)
+	}
+	var raw map[string]any
+	if err := json.Unmarshal(res.RawResponse, &raw); err != nil || raw["service_tier"] != "flex" {
+		t.Fatalf("want the raw response, got %s (%v)", res.RawResponse, err)
+	}
+
+	body = nil
+	req = newRequest()
+	req.Options.Apply(blades.ProviderOptions(map[string]any{"seed": 1}))
+	if _, err := model.Generate(context.Background(), req); !errors.Is(err, blades.ErrExtensionConflict) {
+		t.Fatalf("want a conflict with the seed option, got %v", err)
+	}
+	if body != nil {
+		t.Fatalf("want no request sent on a conflict, got %v", body)
+	}
+}
+
+func TestChatStreamingStopSequence(t *testing.T) {
+	var body map[string]any
+	chunks := []string{
+		`{"id":"c1","object":"chat.completion.chunk","created":1,"model":"gpt-test","system_fingerprint":"fp_123","choices":[{"index":0,"delta":{"role":"assistant","content":"red,"}}]}`,
+		`{"id":"c1","object":"chat.completion.chunk","created":1,"model":"gpt-test","system_fingerprint":"fp_123","choices":[{"index":0,"delta":{"content":" blue"}}]}`,
+		// The server stops mid-chunk when the stop sequence is produced.
+		`{"id":"c1","object":"chat.completion.chunk","created":1,"model":"gpt-test","system_fingerprint":"fp_123","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+		`{"id":"c1","object":"chat.completion.chunk","created":1,"model":"gpt-test","system_fingerprint":"fp_123","choices":[],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5,"prompt_tokens_details":{"cached_tokens":2}}}`,
+	}
+	server := newTestServer(t, &body, func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range chunks {
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	})
+	model := NewModel("gpt-test", Config{
+		BaseURL:        server.URL,
+		APIKey:         "test",
+		RequestOptions: []option.RequestOption{option.WithMaxRetries(0)},
+	})
+	var (
+		deltas []string
+		final  *blades.Message
+	)
+	for res, err := range model.NewStreaming(context.Background(), newRequest()) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Message.Status == blades.StatusCompleted {
+			if final != nil {
+				t.Fatal("expected a single final response")
+			}
+			final = res.Message
+			continue
+		}
+		deltas = append(deltas, res.Message.Text())
+	}
+	if !reflect.DeepEqual(body["stop"], []any{"\n\n"}) {
+		t.Fatalf("expected stop sequences in the request, got %v", body["stop"])
+	}
+	if final == nil {
+		t.Fatal("expected a final response")
+	}
+	if got := strings.Join(deltas, ""); got != "red, blue" || final.Text() != got {
+		t.Fatalf("unexpected text: deltas %q final %q", got, final.Text())
+	}
+	if final.FinishReason != "stop" || final.Metadata["system_fingerprint"] != "fp_123" {
+		t.Fatalf("unexpected final message: %+v", final)
+	}
+	if opts, _ := body["stream_options"].(map[string]any); opts["include_usage"] != true {
+		t.Fatalf("expected the usage chunk to be requested, got %v", body["stream_options"])
+	}
+	if usage := final.TokenUsage; usage.TotalTokens != 5 || usage.CachedInputTokens != 2 {
+		t.Fatalf("unexpected usage: %+v", usage)
+	}
+}
+
+func TestChatCompatibility(t *testing.T) {
+	tests := []struct {
+		name        string
+		compat      Compatibility
+		fixture     string
+		stream      bool
+		wantUsage   blades.TokenUsage
+		wantOptions bool
+	}{
+		{"deepseek", CompatibilityDeepSeek, "deepseek_chat.json", false, blades.TokenUsage{InputTokens: 12, OutputTokens: 8, TotalTokens: 20, CachedInputTokens: 10}, false},
+		{"deepseek stream", CompatibilityDeepSeek, "deepseek_stream.txt", true, blades.TokenUsage{InputTokens: 12, OutputTokens: 8, TotalTokens: 20, CachedInputTokens: 10}, true},
+		{"openrouter", CompatibilityOpenRouter, "openrouter_chat.json", false, blades.TokenUsage{InputTokens: 12, OutputTokens: 8, TotalTokens: 20}, false},
+		// The stream has no usage block.
+		{"openrouter stream", CompatibilityOpenRouter, "openrouter_stream.txt", true, blades.TokenUsage{}, true},
+		{"gateway without stream options", Compatibility{OmitStreamOptions: true, ReasoningField: "reasoning"}, "openrouter_stream.txt", true, blades.TokenUsage{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fixture, err := os.ReadFile(filepath.Join("testdata", tt.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var body map[string]any
+			server := newTestServer(t, &body, func(w http.ResponseWriter) {
+				if tt.stream {
+					w.Header().Set("Content-Type", "text/event-stream")
+				} else {
+					w.Header().Set("Content-Type", "application/json")
+				}
+				w.Write(fixture)
+			})
+			model := NewModel("compat-test", Config{
+				BaseURL:        server.URL,
+				APIKey:         "test",
+				Compatibility:  &tt.compat,
+				RequestOptions: []option.RequestOption{option.WithMaxRetries(0)},
+			})
+			req := &blades.ModelRequest{Messages: []*blades.Message{blades.UserMessage("List two colors.")}}
+			var final *blades.Message
+			if tt.stream {
+				var reasoning strings.Builder
+				for res, err := range model.NewStreaming(context.Background(), req) {
+					if err != nil {
+						t.Fatal(err)
+					}
+					if res.Message.Status == blades.StatusCompleted {
+						final = res.Message
+						continue
+					}
+					for _, part := range res.Message.Parts {
+						if v, ok := part.(blades.ReasoningPart); ok {
+							reasoning.WriteString(v.Text)
+						}
+					}
+				}
+				if reasoning.String() != "The user wants two colors." {
+					t.Fatalf("unexpected streamed reasoning %q", reasoning.String())
+				}
+			} else {
+				res, err := model.Generate(context.Background(), req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				final = res.Message
+			}
+			want := []blades.Part{blades.ReasoningPart{Text: "The user wants two colors."}, blades.TextPart{Text: "Red and blue."}}
+			if !reflect.DeepEqual(final.Parts, want) {
+				t.Fatalf("want parts %+v, got %+v", want, final.Parts)
+			}
+			if final.TokenUsage != tt.wantUsage {
+				t.Fatalf("want usage %+v, got %+v", tt.wantUsage, final.TokenUsage)
+			}
+			if _, ok := body["stream_options"]; ok != tt.wantOptions {
+				t.Fatalf("want stream_options sent %t, got %v", tt.wantOptions, body["stream_options"])
+			}
+		})
+	}
+}
+
+func TestDetectCompatibility(t *testing.T) {
+	tests := []struct {
+		baseURL string
+		want    Compatibility
+	}{
+		{"https://api.deepseek.com/v1", CompatibilityDeepSeek},
+		{"https://openrouter.ai/api/v1", CompatibilityOpenRouter},
+		{"https://api.openai.com/v1", CompatibilityOpenAI},
+		{"http://localhost:8000/v1", CompatibilityOpenAI},
+	}
+	for _, tt := range tests {
+		if got := detectCompatibility(tt.baseURL); got != tt.want {
+			t.Errorf("%s: want %+v, got %+v", tt.baseURL, tt.want, got)
+		}
+	}
+}
+
+func TestChatFinishReason(t *testing.T) {
+	tests := []struct {
+		fixture  string
+		stream   bool
+		want     blades.FinishReason
+		wantText string
+	}{
+		{"deepseek_chat.json", false, blades.FinishReasonStop, "Red and blue."},
+		{"refusal_chat.json", false, blades.FinishReasonRefusal, "I can't help with that."},
+		{"refusal_stream.txt", true, blades.FinishReasonRefusal, "I can't help with that."},
+		{"content_filter_chat.json", false, blades.FinishReasonContentFilter, "Here is how to"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			fixture, err := os.ReadFile(filepath.Join("testdata", tt.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var body map[string]any
+			server := newTestServer(t, &body, func(w http.ResponseWriter) {
+				if tt.stream {
+					w.Header().Set("Content-Type", "text/event-stream")
+				} else {
+					w.Header().Set("Content-Type", "application/json")
+				}
+				w.Write(fixture)
+			})
+			model := NewModel("finish-test", Config{
+				BaseURL:        server.URL,
+				APIKey:         "test",
+				RequestOptions: []option.RequestOption{option.WithMaxRetries(0)},
+			})
+			req := &blades.ModelRequest{Messages: []*blades.Message{blades.UserMessage("Explain.")}}
+			var final *blades.Message
+			if tt.stream {
+				for res, err := range model.NewStreaming(context.Background(), req) {
+					if err != nil {
+						t.Fatal(err)
+					}
+					final = res.Message
+				}
+			} else {
+				res, err := model.Generate(context.Background(), req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				final = res.Message
+			}
+			if final.FinishReason != tt.want || final.Text() != tt.wantText {
+				t.Fatalf("want %q with %q, got %q with %q", tt.want, tt.wantText, final.FinishReason, final.Text())
+			}
+			if final.IsRefusal() != (tt.want == blades.FinishReasonRefusal) || final.IsFiltered() != (tt.want == blades.FinishReasonContentFilter) {
+				t.Fatalf("unexpected predicates for %q", final.FinishReason)
+			}
+		})
+	}
+}
+
+func TestChatInterleavedToolCalls(t *testing.T) {
+	weather := blades.ToolPart{ID: "call_1", Name: "weather", Request: `{"city":"Paris"}`}
+	clock := blades.ToolPart{ID: "call_2", Name: "time", Request: `{"city":"Paris"}`}
+	tests := []struct {
+		fixture string
+		stream  bool
+		want    []blades.Part
+	}{
+		{"tool_calls_chat.json", false, []blades.Part{blades.TextPart{Text: "Let me check the weather and the time."}, weather, clock}},
+		{"tool_calls_stream.txt", true, []blades.Part{blades.TextPart{Text: "Let me check the weather."}, weather, blades.TextPart{Text: "And the time there."}, clock}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			fixture, err := os.ReadFile(filepath.Join("testdata", tt.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var body map[string]any
+			server := newTestServer(t, &body, func(w http.ResponseWriter) {
+				if tt.stream {
+					w.Header().Set("Content-Type", "text/event-stream")
+				} else {
+					w.Header().Set("Content-Type", "application/json")
+				}
+				w.Write(fixture)
+			})
+			model := NewModel("tools-test", Config{
+				BaseURL:        server.URL,
+				APIKey:         "test",
+				RequestOptions: []option.RequestOption{option.WithMaxRetries(0)},
+			})
+			req := &blades.ModelRequest{Messages: []*blades.Message{blades.UserMessage("Weather in Paris?")}}
+			var final *blades.Message
+			if tt.stream {
+				var streamed string
+				for res, err := range model.NewStreaming(context.Background(), req) {
+					if err != nil {
+						t.Fatal(err)
+					}
+					if res.Message.Status == blades.StatusIncomplete {
+						streamed += res.Message.Text()
+					}
+					final = res.Message
+				}
+				if streamed != "Let me check the weather.And the time there." {
+					t.Fatalf("want the narration streamed, got %q", streamed)
+				}
+			} else {
+				res, err := model.Generate(context.Background(), req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				final = res.Message
+			}
+			if final.Role != blades.RoleTool || !reflect.DeepEqual(final.Parts, tt.want) {
+				t.Fatalf("want a tool message with the text around the calls, got %s %#v", final.Role, final.Parts)
+			}
+
+			// The text is replayed as the content of the assistant turn of the calls.
+			history := final.Clone()
+			req.Messages = append(req.Messages, history)
+			if _, err := model.Generate(context.Background(), req); err != nil && !tt.stream {
+				t.Fatal(err)
+			}
+			turn := body["messages"].([]any)[1].(map[string]any)
+			if turn["content"] != final.Text() || len(turn["tool_calls"].([]any)) != 2 {
+				t.Fatalf("want the text and the calls replayed, got %v", turn)
+			}
+		})
+	}
+}
+
+func TestChatCandidates(t *testing.T) {
+	fixture, err := os.ReadFile(filepath.Join("testdata", "candidates_chat.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]any
+	server := newTestServer(t, &body, func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(fixture)
+	})
+	model := NewModel("candidates-test", Config{
+		BaseURL:        server.URL,
+		APIKey:         "test",
+		RequestOptions: []option.RequestOption{option.WithMaxRetries(0)},
+	})
+	req := &blades.ModelRequest{Messages: []*blades.Message{blades.UserMessage("List two colors.")}}
+	req.Options.Apply(blades.CandidateCount(2))
+	res, err := model.Generate(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body["n"] != float64(2) {
+		t.Fatalf("want n sent, got %v", body["n"])
+	}
+	if res.Message.Text() != "Red and blue." || len(res.Alternatives) != 1 || res.Alternatives[0].Text() != "Green and yellow." {
+		t.Fatalf("unexpected candidates %q and %+v", res.Message.Text(), res.Alternatives)
+	}
+	if res.Message.TokenUsage.TotalTokens != 22 {
+		t.Fatalf("want the usage of all candidates, got %+v", res.Message.TokenUsage)
+	}
+	for _, err := range model.NewStreaming(context.Background(), req) {
+		if !errors.Is(err, blades.ErrStreamingCandidates) {
+			t.Fatalf("want ErrStreamingCandidates, got %v", err)
+		}
+	}
+}
+
+func TestChatStreamingConformance(t *testing.T) {
+	tests := []struct {
+		name    string
+		compat  Compatibility
+		fixture string
+		noUsage bool
+	}{
+		{"deepseek", CompatibilityDeepSeek, "deepseek_stream.txt", false},
+		{"openrouter", CompatibilityOpenRouter, "openrouter_stream.txt", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := providertest.ServeSSE(t, filepath.Join("testdata", tt.fixture), 100*time.Millisecond)
+			model := NewModel("conformance-test", Config{
+				BaseURL:        server.URL,
+				APIKey:         "test",
+				Compatibility:  &tt.compat,
+				RequestOptions: []option.RequestOption{option.WithMaxRetries(0)},
+			})
+			providertest.TestStreaming(t, model, providertest.Config{NoUsage: tt.noUsage, CancelWithin: 250 * time.Millisecond})
+		})
+	}
+}
+
+func TestChatRenderRequest(t *testing.T) {
+	var body map[string]any
+	server := newTestServer(t, &body, func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"c1","object":"chat.completion","created":1,"model":"gpt-test",
+			"choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"ok"}}]}`)
+	})
+	model := NewModel("gpt-4o", Config{
+		BaseURL:        server.URL,
+		APIKey:         "test",
+		RequestOptions: []option.RequestOption{option.WithMaxRetries(0)},
+	})
+	req := newRequest()
+	req.Instruction = blades.SystemMessage("Be brief.")
+	req.Extensions = map[string]any{"service_tier": "flex"}
+	rendered, err := model.(blades.RequestRenderer).RenderRequest(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := model.Generate(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(rendered, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, body) {
+		t.Fatalf("want the rendered request to match the sent one:\n%s\n%v", rendered, body)
+	}
+}
@@ -0,0 +1,157 @@
+package openai
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/go-kratos/blades"
+	"github.com/openai/openai-go/v3"
+	"github.com/openai/openai-go/v3/option"
+	"github.com/openai/openai-go/v3/packages/respjson"
+)
+
+// Compatibility describes how an OpenAI-compatible backend deviates from the
+// OpenAI API. The zero value is the OpenAI API itself.
+type Compatibility struct {
+	// OmitStreamOptions leaves out stream_options, which some gateways reject.
+	// Streamed responses then report usage only if the backend sends it unasked.
+	OmitStreamOptions bool
+	// ReasoningField is the nonstandard message field carrying the reasoning
+	// text, e.g. "reasoning_content". It is mapped to a blades.ReasoningPart.
+	ReasoningField string
+	// NoDeveloperRole sends developer messages with the system role, for
+	// backends that do not know the developer role.
+	NoDeveloperRole bool
+	// SingleSystemMessage joins the instruction and all system and developer
+	// messages into one system message at the start, for backends that reject
+	// more than one.
+	SingleSystemMessage bool
+}
+
+var (
+	// CompatibilityOpenAI is the profile of the OpenAI API.
+	CompatibilityOpenAI = Compatibility{}
+	// CompatibilityDeepSeek is the profile of the DeepSeek API.
+	CompatibilityDeepSeek = Compatibility{ReasoningField: "reasoning_content", NoDeveloperRole: true}
+	// CompatibilityOpenRouter is the profile of the OpenRouter API.
+	CompatibilityOpenRouter = Compatibility{ReasoningField: "reasoning"}
+)
+
+// detectCompatibility returns the profile of a well-known backend by its base
+// URL, falling back to the OPENAI_BASE_URL environment variable.
+func detectCompatibility(baseURL string) Compatibility {
+	if baseURL == "" {
+		baseURL = os.Getenv("OPENAI_BASE_URL")
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return CompatibilityOpenAI
+	}
+	host := strings.ToLower(u.Hostname())
+	switch {
+	case host == "deepseek.com" || strings.HasSuffix(host, ".deepseek.com"):
+		return CompatibilityDeepSeek
+	case host == "openrouter.ai" || strings.HasSuffix(host, ".openrouter.ai"):
+		return CompatibilityOpenRouter
+	default:
+		return CompatibilityOpenAI
+	}
+}
+
+// reasoning returns the reasoning text in the nonstandard field, if any.
+func (c Compatibility) reasoning(fields map[string]respjson.Field) string {
+	if c.ReasoningField == "" {
+		return ""
+	}
+	field, ok := fields[c.ReasoningField]
+	if !ok {
+		return ""
+	}
+	var text string
+	if err := json.Unmarshal([]byte(field.Raw()), &text); err != nil {
+		return ""
+	}
+	return text
+}
+
+// convertUsage converts the usage block, which some backends omit or fill
+// partially, to blades.TokenUsage.
+func convertUsage(usage openai.CompletionUsage) blades.TokenUsage {
+	tokens := blades.TokenUsage{
+		InputTokens:  usage.PromptTokens,
+		OutputTokens: usage.CompletionTokens,
+		TotalTokens:  usage.TotalTokens,
+		// Chat completions cache long prompts automatically.
+		CachedInputTokens: cachedTokens(usage),
+	}
+	if tokens.TotalTokens == 0 {
+		tokens.TotalTokens = tokens.InputTokens + tokens.OutputTokens
+	}
+	return tokens
+}
+
+// cachedTokens returns the prompt tokens read from the cache, which DeepSeek
+// reports as prompt_cache_hit_tokens.
+func cachedTokens(usage openai.CompletionUsage) int64 {
+	if cached := usage.PromptTokensDetails.CachedTokens; cached > 0 {
+		return cached
+	}
+	if field, ok := usage.JSON.ExtraFields["prompt_cache_hit_tokens"]; ok {
+		var cached int64
+		if err := json.Unmarshal([]byte(field.Raw()), &cached); err == nil {
+			return cached
+		}
+	}
+	return 0
+}
+
+// skipSSEComments is a request middleware that removes the comments of event
+// streams, such as the keep-alive comments of OpenRouter, which the client
+// would otherwise decode as empty events.
+func skipSSEComments(req *http.Request, next option.MiddlewareNext) (*http.Response, error) {
+	res, err := next(req)
+	if err != nil || !strings.HasPrefix(res.Header.Get("Content-Type"), "text/event-stream") {
+		return res, err
+	}
+	res.Body = &sseCommentReader{Closer: res.Body, r: bufio.NewReader(res.Body)}
+	return res, nil
+}
+
+// sseCommentReader drops comment lines from an event stream, and the blank
+// lines that would dispatch an event without fields.
+type sseCommentReader struct {
+	io.Closer
+	r      *bufio.Reader
+	buf    []byte
+	fields bool
+	err    error
+}
+
+func (s *sseCommentReader) Read(p []byte) (int, error) {
+	for len(s.buf) == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+		line, err := s.r.ReadBytes('\n')
+		s.err = err
+		trimmed := bytes.TrimRight(line, "\r\n")
+		switch {
+		case len(line) == 0, bytes.HasPrefix(trimmed, []byte(":")):
+		case len(trimmed) == 0:
+			if s.fields {
+				s.buf, s.fields = line, false
+			}
+		default:
+			s.buf, s.fields = line, true
+		}
+	}
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+	return n, nil
+}
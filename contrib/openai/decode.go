@@ -0,0 +1,306 @@
+package openai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/openai/openai-go/v3/option"
+)
+
+// maxPayload is the number of bytes of an undecodable payload kept in a DecodeError.
+const maxPayload = 512
+
+// DecodeError is returned when a response of the backend is not JSON. It
+// holds the start of the payload for debugging.
+type DecodeError struct {
+	// Payload is the first 512 bytes of the payload.
+	Payload string
+	Err     error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("openai: decode response: %v: payload %q", e.Err, e.Payload)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// newDecodeError returns a DecodeError with the start of the payload.
+func newDecodeError(payload []byte, err error) *DecodeError {
+	if len(payload) > maxPayload {
+		payload = payload[:maxPayload]
+	}
+	return &DecodeError{Payload: string(payload), Err: err}
+}
+
+// tolerantDecoding returns a request middleware that normalizes the
+// responses of backends deviating from the chat completions format before
+// the client decodes them: string-typed numbers are coerced, missing choice
+// and tool call indexes are filled in, and malformed chunks of a stream are
+// skipped. Every kind of deviation is reported once per response to warn,
+// or logged to the logger without one. Unknown fields are left for the
+// client, which ignores them.
+func tolerantDecoding(warn func(ctx context.Context, warning string), logger *slog.Logger) option.Middleware {
+	if warn == nil {
+		if logger == nil {
+			logger = slog.Default()
+		}
+		warn = func(ctx context.Context, warning string) {
+			logger.WarnContext(ctx, "openai: tolerated a deviation from the chat completions format", "warning", warning)
+		}
+	}
+	return func(req *http.Request, next option.MiddlewareNext) (*http.Response, error) {
+		res, err := next(req)
+		if err != nil || res.StatusCode >= 400 {
+			return res, err
+		}
+		n := &normalizer{ctx: req.Context(), warn: warn, warned: make(map[string]bool), toolCalls: make(map[string]int64)}
+		mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+		switch {
+		case mediaType == "text/event-stream":
+			res.Body = &sseNormalizer{Closer: res.Body, r: bufio.NewReader(res.Body), n: n}
+		case strings.Contains(mediaType, "json"):
+			payload, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			payload, err = n.normalize(payload)
+			if err != nil {
+				// The payload is the same on a retry.
+				res.Header.Set("X-Should-Retry", "false")
+				res.Body = io.NopCloser(bytes.NewReader(nil))
+				return res, newDecodeError(payload, err)
+			}
+			res.Body = io.NopCloser(bytes.NewReader(payload))
+			res.ContentLength = int64(len(payload))
+		}
+		return res, nil
+	}
+}
+
+// normalizer rewrites the payloads of one response.
+type normalizer struct {
+	ctx    context.Context
+	warn   func(ctx context.Context, warning string)
+	warned map[string]bool
+	// toolCalls are the indexes of the streamed tool calls by choice and ID,
+	// and lastToolCall the index of the last one.
+	toolCalls    map[string]int64
+	lastToolCall int64
+	changed      bool
+}
+
+// warnf reports a kind of deviation once.
+func (n *normalizer) warnf(format string, args ...any) {
+	warning := fmt.Sprintf(format, args...)
+	if n.warned[warning] {
+		return
+	}
+	n.warned[warning] = true
+	n.warn(n.ctx, warning)
+}
+
+// normalize returns the payload rewritten to the chat completions format, or
+// unchanged if it already is.
+func (n *normalizer) normalize(payload []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	var body any
+	if err := decoder.Decode(&body); err != nil {
+		return payload, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return payload, fmt.Errorf("unexpected data after the JSON value")
+	}
+	object, ok := body.(map[string]any)
+	if !ok {
+		return payload, fmt.Errorf("want a JSON object, got %T", body)
+	}
+	n.changed = false
+	n.number(object, "created")
+	if choices, ok := object["choices"].([]any); ok {
+		for i, c := range choices {
+			choice, ok := c.(map[string]any)
+			if !ok {
+				continue
+			}
+			n.number(choice, "index")
+			if choice["index"] == nil {
+				n.warnf("choice without index")
+				choice["index"] = json.Number(strconv.Itoa(i))
+				n.changed = true
+			}
+			if delta, ok := choice["delta"].(map[string]any); ok {
+				n.toolCallIndexes(fmt.Sprint(choice["index"]), delta)
+			}
+		}
+	}
+	if usage, ok := object["usage"].(map[string]any); ok {
+		n.tokens(usage)
+	}
+	if !n.changed {
+		return payload, nil
+	}
+	return json.Marshal(object)
+}
+
+// toolCallIndexes fills in the indexes of the streamed tool calls of the
+// delta, counting the tool calls of the choice by ID, so that the calls of
+// backends omitting them are not merged into one.
+func (n *normalizer) toolCallIndexes(choice string, delta map[string]any) {
+	calls, ok := delta["tool_calls"].([]any)
+	if !ok {
+		return
+	}
+	for _, c := range calls {
+		call, ok := c.(map[string]any)
+		if !ok {
+			continue
+		}
+		id, _ := call["id"].(string)
+		key := choice + "/" + id
+		n.number(call, "index")
+		if call["index"] == nil {
+			index, seen := n.toolCalls[key]
+			switch {
+			case id == "":
+				index = n.lastToolCall
+			case !seen:
+				index = int64(len(n.toolCalls))
+			}
+			n.warnf("tool call without index, counting them by id")
+			call["index"] = json.Number(strconv.FormatInt(index, 10))
+			n.changed = true
+		}
+		number, _ := call["index"].(json.Number)
+		index, _ := number.Int64()
+		if id != "" {
+			n.toolCalls[key] = index
+		}
+		n.lastToolCall = index
+	}
+}
+
+// tokens coerces the token counts of the usage block and its details.
+func (n *normalizer) tokens(usage map[string]any) {
+	for key, value := range usage {
+		switch value.(type) {
+		case map[string]any:
+			n.tokens(value.(map[string]any))
+		case string:
+			if strings.HasSuffix(key, "_tokens") {
+				n.number(usage, key)
+			}
+		}
+	}
+}
+
+// number coerces the field of the object to a number if it is a string
+// holding one, and drops it if it holds something else.
+func (n *normalizer) number(object map[string]any, field string) {
+	s, ok := object[field].(string)
+	if !ok {
+		return
+	}
+	n.changed = true
+	if _, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err != nil {
+		n.warnf("dropped %q, which is not a number", field)
+		delete(object, field)
+		return
+	}
+	n.warnf("coerced %q from a string to a number", field)
+	object[field] = json.Number(strings.TrimSpace(s))
+}
+
+// sseNormalizer normalizes the data of each event of an event stream and
+// drops the events whose data is not JSON. If no event of the stream could
+// be decoded, the stream fails with a DecodeError.
+type sseNormalizer struct {
+	io.Closer
+	r         *bufio.Reader
+	n         *normalizer
+	buf       []byte
+	err       error
+	decoded   bool
+	malformed []byte
+}
+
+func (s *sseNormalizer) Read(p []byte) (int, error) {
+	for len(s.buf) == 0 {
+		if s.err != nil {
+			if s.err == io.EOF && !s.decoded && s.malformed != nil {
+				return 0, newDecodeError(s.malformed, fmt.Errorf("no chunk of the stream is JSON"))
+			}
+			return 0, s.err
+		}
+		s.buf = s.event()
+	}
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+	return n, nil
+}
+
+// event reads the next event and returns it normalized, or nil if it is dropped.
+func (s *sseNormalizer) event() []byte {
+	var (
+		lines [][]byte
+		data  [][]byte
+	)
+	for {
+		line, err := s.r.ReadBytes('\n')
+		if err != nil {
+			s.err = err
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		if len(line) == 0 {
+			break
+		}
+		if value, ok := bytes.CutPrefix(line, []byte("data:")); ok {
+			data = append(data, bytes.TrimPrefix(value, []byte(" ")))
+		} else {
+			lines = append(lines, line)
+		}
+		if err != nil {
+			break
+		}
+	}
+	if data == nil {
+		if len(lines) == 0 {
+			return nil
+		}
+		return append(bytes.Join(lines, []byte("\n")), '\n', '\n')
+	}
+	payload := bytes.Join(data, []byte("\n"))
+	if string(bytes.TrimSpace(payload)) != "[DONE]" {
+		normalized, err := s.n.normalize(payload)
+		if err != nil {
+			s.n.warnf("skipped a malformed chunk: %v", newDecodeError(payload, err))
+			if s.malformed == nil {
+				s.malformed = payload
+			}
+			return nil
+		}
+		s.decoded = true
+		payload = normalized
+	}
+	var event bytes.Buffer
+	for _, line := range lines {
+		event.Write(line)
+		event.WriteByte('\n')
+	}
+	event.WriteString("data: ")
+	event.Write(payload)
+	event.WriteString("\n\n")
+	return event.Bytes()
+}
@@ -0,0 +1,167 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-kratos/blades"
+)
+
+// TestChatNonstandardPayloads decodes payloads observed from gateways that
+// deviate from the chat completions format.
+func TestChatNonstandardPayloads(t *testing.T) {
+	weather := blades.ToolPart{ID: "call_1", Name: "weather", Request: `{"city":"Paris"}`}
+	clock := blades.ToolPart{ID: "call_2", Name: "time", Request: `{"city":"Paris"}`}
+	tests := []struct {
+		fixture      string
+		wantParts    []blades.Part
+		wantUsage    blades.TokenUsage
+		wantWarnings []string
+		wantErr      string
+	}{
+		{
+			fixture:      "string_numbers_chat.json",
+			wantParts:    []blades.Part{blades.TextPart{Text: "Red and blue."}},
+			wantUsage:    blades.TokenUsage{InputTokens: 12, OutputTokens: 8, TotalTokens: 20, CachedInputTokens: 4},
+			wantWarnings: []string{`coerced "created"`, `coerced "index"`, `coerced "prompt_tokens"`, `coerced "cached_tokens"`},
+		},
+		{
+			fixture:      "missing_index_chat.json",
+			wantParts:    []blades.Part{blades.TextPart{Text: "Red and blue."}},
+			wantUsage:    blades.TokenUsage{InputTokens: 12, OutputTokens: 8, TotalTokens: 20},
+			wantWarnings: []string{"choice without index"},
+		},
+		{
+			fixture:      "malformed_chunk_stream.txt",
+			wantParts:    []blades.Part{blades.TextPart{Text: "Red and blue."}},
+			wantUsage:    blades.TokenUsage{InputTokens: 12, OutputTokens: 8, TotalTokens: 20},
+			wantWarnings: []string{"skipped a malformed chunk", `payload "{\"id\":\"gw-3\"`, "choice without index", `coerced "total_tokens"`},
+		},
+		{
+			fixture:      "tool_calls_without_index_stream.txt",
+			wantParts:    []blades.Part{weather, clock},
+			wantWarnings: []string{"tool call without index"},
+		},
+		{
+			fixture: "html_error_chat.json",
+			wantErr: `payload "<html><head><title>502 Bad Gateway</title>`,
+		},
+		{
+			fixture:      "html_error_stream.txt",
+			wantErr:      `payload "<html>upstream timed out</html>"`,
+			wantWarnings: []string{"skipped a malformed chunk"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			fixture, err := os.ReadFile(filepath.Join("testdata", "nonstandard", tt.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			stream := strings.HasSuffix(tt.fixture, ".txt")
+			var (
+				body     map[string]any
+				requests atomic.Int64
+				warnings []string
+			)
+			server := newTestServer(t, &body, func(w http.ResponseWriter) {
+				requests.Add(1)
+				if stream {
+					w.Header().Set("Content-Type", "text/event-stream")
+				} else {
+					w.Header().Set("Content-Type", "application/json")
+				}
+				w.Write(fixture)
+			})
+			model := NewModel("gateway-model", Config{
+				BaseURL: server.URL,
+				APIKey:  "test",
+				OnDecodeWarning: func(ctx context.Context, warning string) {
+					warnings = append(warnings, warning)
+				},
+			})
+			req := &blades.ModelRequest{Messages: []*blades.Message{blades.UserMessage("List two colors.")}}
+			var final *blades.Message
+			if stream {
+				for res, e := range model.NewStreaming(context.Background(), req) {
+					if e != nil {
+						err = e
+						break
+					}
+					final = res.Message
+				}
+			} else {
+				var res *blades.ModelResponse
+				if res, err = model.Generate(context.Background(), req); err == nil {
+					final = res.Message
+				}
+			}
+			joined := strings.Join(warnings, "\n")
+			for _, want := range tt.wantWarnings {
+				if !strings.Contains(joined, want) {
+					t.Fatalf("want a warning containing %s, got:\n%s", want, joined)
+				}
+			}
+			if tt.wantErr != "" {
+				var decodeErr *DecodeError
+				if !errors.As(err, &decodeErr) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("want a DecodeError with %s, got %v", tt.wantErr, err)
+				}
+				if n := requests.Load(); n != 1 {
+					t.Fatalf("want the undecodable response not retried, got %d requests", n)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(final.Parts, tt.wantParts) {
+				t.Fatalf("want parts %#v, got %#v", tt.wantParts, final.Parts)
+			}
+			if final.TokenUsage != tt.wantUsage {
+				t.Fatalf("want usage %+v, got %+v", tt.wantUsage, final.TokenUsage)
+			}
+		})
+	}
+}
+
+func TestDecodeErrorPayload(t *testing.T) {
+	payload := strings.Repeat("x", 2000)
+	err := newDecodeError([]byte(payload), errors.New("invalid character"))
+	if len(err.Payload) != maxPayload || !strings.Contains(err.Error(), "invalid character") {
+		t.Fatalf("want the first %d bytes of the payload, got %d bytes: %v", maxPayload, len(err.Payload), err)
+	}
+}
+
+func TestDecodeWarningLogger(t *testing.T) {
+	fixture, err := os.ReadFile(filepath.Join("testdata", "nonstandard", "missing_index_chat.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]any
+	server := newTestServer(t, &body, func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(fixture)
+	})
+	var logs strings.Builder
+	model := NewModel("gateway-model", Config{
+		BaseURL: server.URL,
+		APIKey:  "test",
+		Logger:  slog.New(slog.NewTextHandler(&logs, nil)),
+	})
+	req := &blades.ModelRequest{Messages: []*blades.Message{blades.UserMessage("List two colors.")}}
+	if _, err := model.Generate(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs.String(), "level=WARN") || !strings.Contains(logs.String(), "choice without index") {
+		t.Fatalf("want the warning in the logger, got %q", logs.String())
+	}
+}
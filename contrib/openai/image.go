@@ -3,7 +3,12 @@ package openai
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
 
 	"github.com/go-kratos/blades"
 	"github.com/openai/openai-go/v3"
@@ -50,7 +55,7 @@ func NewImage(model string, config ImageConfig) blades.ModelProvider {
 	return &imageModel{
 		model:  model,
 		config: config,
-		client: openai.NewClient(config.RequestOptions...),
+		client: openai.NewClient(opts...),
 	}
 }
 
@@ -59,35 +64,94 @@ func (m *imageModel) Name() string {
 	return m.model
 }
 
-// Generate generates images using the configured OpenAI model.
+// Generate generates images using the configured OpenAI model. The request
+// is aborted when ctx is done.
 func (m *imageModel) Generate(ctx context.Context, req *blades.ModelRequest) (*blades.ModelResponse, error) {
-	params, err := m.buildGenerateParams(req)
+	params, err := m.buildGenerateParams(ctx, req)
 	if err != nil {
 		return nil, err
 	}
-	res, err := m.client.Images.Generate(ctx, params)
+	res, err := m.client.Images.Generate(ctx, params, requestOptions(ctx)...)
 	if err != nil {
-		return nil, err
+		return nil, imageError(ctx, err)
 	}
 	return toImageResponse(res)
 }
 
-// NewStreaming wraps Generate with a single-yield stream for API compatibility.
+// NewStreaming streams the generation when PartialImages is set, yielding
+// each partial image as an incomplete message with a preview DataPart before
+// the final message. Otherwise it yields the result of Generate.
 func (m *imageModel) NewStreaming(ctx context.Context, req *blades.ModelRequest) blades.Generator[*blades.ModelResponse, error] {
 	return func(yield func(*blades.ModelResponse, error) bool) {
-		message, err := m.Generate(ctx, req)
+		if m.config.PartialImages <= 0 {
+			yield(m.Generate(ctx, req))
+			return
+		}
+		params, err := m.buildGenerateParams(ctx, req)
 		if err != nil {
 			yield(nil, err)
 			return
 		}
-		yield(message, nil)
+		stream := m.client.Images.GenerateStreaming(ctx, params, requestOptions(ctx)...)
+		defer stream.Close()
+		final := blades.NewAssistantMessage(blades.StatusCompleted)
+		images := 0
+		for stream.Next() {
+			event := stream.Current()
+			data, err := base64.StdEncoding.DecodeString(event.B64JSON)
+			if err != nil {
+				yield(nil, fmt.Errorf("openai/image: decode response: %w", err))
+				return
+			}
+			mimeType := imageMimeType(openai.ImagesResponseOutputFormat(event.OutputFormat))
+			switch event.Type {
+			case "image_generation.partial_image":
+				preview := blades.NewAssistantMessage(blades.StatusIncomplete)
+				preview.Parts = append(preview.Parts, blades.DataPart{
+					Name:     fmt.Sprintf("preview-%d", event.PartialImageIndex+1),
+					Bytes:    data,
+					MIMEType: mimeType,
+					Preview:  true,
+				})
+				preview.Metadata["partial_image_index"] = event.PartialImageIndex
+				if !yield(&blades.ModelResponse{Message: preview}, nil) {
+					return
+				}
+			case "image_generation.completed":
+				images++
+				final.Parts = append(final.Parts, blades.DataPart{
+					Name:     fmt.Sprintf("image-%d", images),
+					Bytes:    data,
+					MIMEType: mimeType,
+				})
+				final.Metadata["size"] = event.Size
+				final.Metadata["quality"] = event.Quality
+				final.Metadata["background"] = event.Background
+				final.Metadata["output_format"] = event.OutputFormat
+				final.Metadata["created"] = event.CreatedAt
+				final.TokenUsage = final.TokenUsage.Add(blades.TokenUsage{
+					InputTokens:  event.Usage.InputTokens,
+					OutputTokens: event.Usage.OutputTokens,
+					TotalTokens:  event.Usage.TotalTokens,
+				})
+			}
+		}
+		if err := stream.Err(); err != nil {
+			yield(nil, imageError(ctx, err))
+			return
+		}
+		if images == 0 {
+			yield(nil, imageError(ctx, fmt.Errorf("openai/image: stream ended without an image")))
+			return
+		}
+		yield(&blades.ModelResponse{Message: final}, nil)
 	}
 }
 
-func (m *imageModel) buildGenerateParams(req *blades.ModelRequest) (openai.ImageGenerateParams, error) {
+func (m *imageModel) buildGenerateParams(ctx context.Context, req *blades.ModelRequest) (openai.ImageGenerateParams, error) {
 	params := openai.ImageGenerateParams{
 		Prompt: promptFromMessages(req.Messages),
-		Model:  openai.ImageModel(m.model),
+		Model:  openai.ImageModel(blades.ResolveModel(ctx, m.model)),
 	}
 	if m.config.Background != "" {
 		params.Background = openai.ImageGenerateParamsBackground(m.config.Background)
@@ -125,6 +189,9 @@ func (m *imageModel) buildGenerateParams(req *blades.ModelRequest) (openai.Image
 	if len(m.config.ExtraFields) > 0 {
 		params.SetExtraFields(m.config.ExtraFields)
 	}
+	if err := applyExtensions(&params, req); err != nil {
+		return params, err
+	}
 	return params, nil
 }
 
@@ -174,3 +241,68 @@ func imageMimeType(format openai.ImagesResponseOutputFormat) blades.MIMEType {
 		return blades.MIMEImagePNG
 	}
 }
+
+var (
+	// ErrContentPolicy is wrapped by an ImageError for a prompt or image
+	// rejected by the content policy. Retrying the same prompt fails again.
+	ErrContentPolicy = errors.New("openai/image: rejected by content policy")
+	// ErrTransient is wrapped by an ImageError for a failure that may succeed
+	// when retried, such as a rate limit, a server error or a dropped connection.
+	ErrTransient = errors.New("openai/image: transient failure")
+)
+
+// ImageError is returned by the image provider when generation fails.
+type ImageError struct {
+	// Kind is ErrContentPolicy, ErrTransient or nil for other failures.
+	Kind error
+	// StatusCode is the HTTP status of the response, if any.
+	StatusCode int
+	// Code is the error code returned by the API, if any.
+	Code string
+	Err  error
+}
+
+func (e *ImageError) Error() string {
+	if e.Kind == nil {
+		return fmt.Sprintf("openai/image: %v", e.Err)
+	}
+	return fmt.Sprintf("%v: %v", e.Kind, e.Err)
+}
+
+// Unwrap returns the kind and the underlying error.
+func (e *ImageError) Unwrap() []error {
+	if e.Kind == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// imageError classifies a failed image request. Errors caused by ctx are
+// returned unchanged.
+func imageError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return context.Cause(ctx)
+	}
+	e := &ImageError{Err: err}
+	var apiErr *openai.Error
+	if errors.As(err, &apiErr) {
+		e.StatusCode, e.Code = apiErr.StatusCode, apiErr.Code
+		switch {
+		case apiErr.Code == "content_policy_violation" || apiErr.Code == "moderation_blocked":
+			e.Kind = ErrContentPolicy
+		case apiErr.StatusCode == http.StatusRequestTimeout || apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500:
+			e.Kind = ErrTransient
+		}
+		return e
+	}
+	// Errors received within a stream only carry the error object as text.
+	if text := err.Error(); strings.Contains(text, "content_policy_violation") || strings.Contains(text, "moderation_blocked") {
+		e.Kind = ErrContentPolicy
+		return e
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		e.Kind = ErrTransient
+	}
+	return e
+}
@@ -0,0 +1,121 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/blades"
+	"github.com/openai/openai-go/v3/option"
+)
+
+func newTestImage(url string, partialImages int64) blades.ModelProvider {
+	return NewImage("gpt-image-1", ImageConfig{
+		BaseURL:        url,
+		APIKey:         "test",
+		PartialImages:  partialImages,
+		RequestOptions: []option.RequestOption{option.WithMaxRetries(0)},
+	})
+}
+
+func TestImageStreamingPreviews(t *testing.T) {
+	fixture, err := os.ReadFile(filepath.Join("testdata", "image_stream.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]any
+	server := newTestServer(t, &body, func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write(fixture)
+	})
+	req := &blades.ModelRequest{Messages: []*blades.Message{blades.UserMessage("A cabin")}}
+	var (
+		previews []string
+		final    *blades.Message
+	)
+	for res, err := range newTestImage(server.URL, 2).NewStreaming(context.Background(), req) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := res.Message.Data()
+		if res.Message.Status == blades.StatusIncomplete {
+			if data == nil || !data.Preview {
+				t.Fatalf("want a preview data part, got %v", res.Message)
+			}
+			previews = append(previews, string(data.Bytes))
+			continue
+		}
+		final = res.Message
+	}
+	if body["stream"] != true || body["partial_images"] != float64(2) {
+		t.Fatalf("want a streaming request with partial images, got %v", body)
+	}
+	if len(previews) != 2 || previews[0] != "preview1" || previews[1] != "preview2" {
+		t.Fatalf("want 2 previews, got %q", previews)
+	}
+	if final == nil || final.Data() == nil || string(final.Data().Bytes) != "final" || final.Data().Preview {
+		t.Fatalf("want the final image, got %v", final)
+	}
+	if final.TokenUsage.TotalTokens != 110 {
+		t.Fatalf("want usage 110, got %d", final.TokenUsage.TotalTokens)
+	}
+}
+
+func TestImageErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   error
+	}{
+		{"content policy", http.StatusBadRequest, `{"error":{"message":"Your request was rejected by the safety system.","type":"image_generation_user_error","code":"moderation_blocked"}}`, ErrContentPolicy},
+		{"rate limit", http.StatusTooManyRequests, `{"error":{"message":"Slow down.","type":"requests","code":"rate_limit_exceeded"}}`, ErrTransient},
+		{"server error", http.StatusInternalServerError, `{"error":{"message":"Oops.","type":"server_error","code":null}}`, ErrTransient},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body map[string]any
+			server := newTestServer(t, &body, func(w http.ResponseWriter) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			})
+			req := &blades.ModelRequest{Messages: []*blades.Message{blades.UserMessage("A cabin")}}
+			_, err := newTestImage(server.URL, 0).Generate(context.Background(), req)
+			var imageErr *ImageError
+			if !errors.Is(err, tt.want) || !errors.As(err, &imageErr) || imageErr.StatusCode != tt.status {
+				t.Fatalf("want %v with status %d, got %v", tt.want, tt.status, err)
+			}
+		})
+	}
+}
+
+func TestImageCancellation(t *testing.T) {
+	aborted := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The server notices a closed connection once the body is consumed.
+		io.Copy(io.Discard, r.Body)
+		<-r.Context().Done()
+		close(aborted)
+	}))
+	t.Cleanup(server.Close)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req := &blades.ModelRequest{Messages: []*blades.Message{blades.UserMessage("A cabin")}}
+	for _, err := range newTestImage(server.URL, 2).NewStreaming(ctx, req) {
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("want the deadline error, got %v", err)
+		}
+	}
+	select {
+	case <-aborted:
+	case <-time.After(time.Second):
+		t.Fatal("want the HTTP request aborted")
+	}
+}
@@ -1,11 +1,33 @@
 package openai
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
 	"strings"
 
 	"github.com/go-kratos/blades"
+	"github.com/openai/openai-go/v3/option"
 )
 
+// requestOptions returns the per-request options that override the client's
+// base URL and API key with the blades.RequestConfig carried by ctx.
+func requestOptions(ctx context.Context) []option.RequestOption {
+	config, ok := blades.FromRequestConfigContext(ctx)
+	if !ok {
+		return nil
+	}
+	var opts []option.RequestOption
+	if config.BaseURL != "" {
+		opts = append(opts, option.WithBaseURL(config.BaseURL))
+	}
+	if config.APIKey != "" {
+		opts = append(opts, option.WithAPIKey(config.APIKey))
+	}
+	return opts
+}
+
 func promptFromMessages(messages []*blades.Message) string {
 	var sections []string
 	for _, msg := range messages {
@@ -13,3 +35,40 @@ func promptFromMessages(messages []*blades.Message) string {
 	}
 	return strings.Join(sections, "\n")
 }
+
+// extensible is a request params type that takes extra JSON fields.
+type extensible interface {
+	ExtraFields() map[string]any
+	SetExtraFields(map[string]any)
+}
+
+// applyExtensions merges the provider extensions of the request into the JSON
+// body of params. A field the params already set, including the extra fields
+// of the config, is a conflict that wraps blades.ErrExtensionConflict.
+func applyExtensions(params extensible, req *blades.ModelRequest) error {
+	extensions := req.ProviderExtensions()
+	if len(extensions) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("openai: extensions: %w", err)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(data, &body); err != nil {
+		return fmt.Errorf("openai: extensions: %w", err)
+	}
+	if err := blades.MergeExtensions(body, extensions); err != nil {
+		return fmt.Errorf("openai: %w", err)
+	}
+	fields := maps.Clone(params.ExtraFields())
+	if fields == nil {
+		fields = make(map[string]any, len(extensions))
+	}
+	// Merged objects replace the fields they extend.
+	for key := range extensions {
+		fields[key] = body[key]
+	}
+	params.SetExtraFields(fields)
+	return nil
+}
@@ -0,0 +1,105 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/go-kratos/blades"
+	"github.com/openai/openai-go/v3"
+)
+
+// StreamResumesKey is the metadata key of the number of times a streamed
+// response was resumed after its connection broke.
+const StreamResumesKey = "stream_resumes"
+
+// resumePrompt asks the model to carry on with a response whose stream broke.
+const resumePrompt = "Your previous response was interrupted. Continue exactly where it stopped, without repeating or introducing anything."
+
+// StreamResume configures how NewStreaming resumes a stream whose connection
+// breaks after part of the response was received. Chat completions cannot
+// resume a server stream, so the request is sent again with the text received
+// so far as an assistant prefix, and the new chunks continue the same stream.
+// Streams that broke during a tool call are not resumed.
+type StreamResume struct {
+	// Disabled turns resumption off, so that a broken stream fails with its error.
+	Disabled bool
+	// MaxAttempts is the number of times one stream may be resumed. It defaults to 2.
+	MaxAttempts int
+	// Backoff is the delay before the first resumption, doubled for each
+	// following one. It defaults to 500ms.
+	Backoff time.Duration
+}
+
+// attempts returns the number of resumptions allowed.
+func (r StreamResume) attempts() int {
+	if r.Disabled {
+		return 0
+	}
+	if r.MaxAttempts <= 0 {
+		return 2
+	}
+	return r.MaxAttempts
+}
+
+// backoff returns the delay before the given resumption, counted from zero.
+func (r StreamResume) backoff(attempt int) time.Duration {
+	backoff := r.Backoff
+	if backoff <= 0 {
+		backoff = 500 * time.Millisecond
+	}
+	return backoff << attempt
+}
+
+// brokenStream reports whether err broke the connection of a stream, as
+// opposed to an API error or the cancellation of ctx.
+func brokenStream(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var apiErr *openai.Error
+	if errors.As(err, &apiErr) {
+		return false
+	}
+	var netErr net.Error
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &netErr)
+}
+
+// resumeParams returns the params that continue the response after the text
+// received so far.
+func resumeParams(params openai.ChatCompletionNewParams, messages []openai.ChatCompletionMessageParamUnion, text string) openai.ChatCompletionNewParams {
+	params.Messages = append(messages[:len(messages):len(messages)],
+		openai.AssistantMessage(text),
+		openai.UserMessage(resumePrompt),
+	)
+	return params
+}
+
+// wait sleeps for the backoff before a resumption, or until ctx is done.
+func wait(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+// prependText puts the text received before the last resumption in front of
+// the text of the final message.
+func prependText(message *blades.Message, text string) {
+	if text == "" {
+		return
+	}
+	for i, part := range message.Parts {
+		if v, ok := part.(blades.TextPart); ok {
+			message.Parts[i] = blades.TextPart{Text: text + v.Text}
+			return
+		}
+	}
+	message.Parts = append(message.Parts, blades.TextPart{Text: text})
+}
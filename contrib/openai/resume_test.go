@@ -0,0 +1,129 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/blades"
+	"github.com/openai/openai-go/v3/option"
+)
+
+// newBrokenServer streams the first chunks, then breaks the connection on the
+// first request, and streams the rest on the following ones. It records the
+// request bodies.
+func newBrokenServer(t *testing.T, bodies *[]map[string]any, first, rest []string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		var body map[string]any
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Error(err)
+		}
+		*bodies = append(*bodies, body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		chunks := rest
+		if len(*bodies) == 1 {
+			chunks = first
+		}
+		for _, chunk := range chunks {
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+		if len(*bodies) > 1 {
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		w.(http.Flusher).Flush()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conn.Close()
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestChatStreamResume(t *testing.T) {
+	first := []string{
+		`{"id":"c1","object":"chat.completion.chunk","created":1,"model":"gpt-test","choices":[{"index":0,"delta":{"role":"assistant","content":"Red"}}]}`,
+		`{"id":"c1","object":"chat.completion.chunk","created":1,"model":"gpt-test","choices":[{"index":0,"delta":{"content":" and"}}]}`,
+	}
+	rest := []string{
+		`{"id":"c2","object":"chat.completion.chunk","created":1,"model":"gpt-test","choices":[{"index":0,"delta":{"role":"assistant","content":" blue."}}]}`,
+		`{"id":"c2","object":"chat.completion.chunk","created":1,"model":"gpt-test","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+		`{"id":"c2","object":"chat.completion.chunk","created":1,"model":"gpt-test","choices":[],"usage":{"prompt_tokens":9,"completion_tokens":2,"total_tokens":11}}`,
+	}
+	newModel := func(url string, resume StreamResume) blades.ModelProvider {
+		return NewModel("gpt-test", Config{
+			BaseURL:        url,
+			APIKey:         "test",
+			RequestOptions: []option.RequestOption{option.WithMaxRetries(0)},
+			StreamResume:   resume,
+		})
+	}
+
+	t.Run("resumed", func(t *testing.T) {
+		var bodies []map[string]any
+		server := newBrokenServer(t, &bodies, first, rest)
+		var (
+			deltas []string
+			final  *blades.Message
+		)
+		for res, err := range newModel(server.URL, StreamResume{Backoff: time.Millisecond}).NewStreaming(context.Background(), newRequest()) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Message.Status == blades.StatusCompleted {
+				final = res.Message
+				continue
+			}
+			deltas = append(deltas, res.Message.Text())
+		}
+		if final == nil {
+			t.Fatal("expected a final response")
+		}
+		if got := strings.Join(deltas, ""); got != "Red and blue." || final.Text() != got {
+			t.Fatalf("unexpected text: deltas %q final %q", got, final.Text())
+		}
+		if final.Metadata[StreamResumesKey] != 1 || final.FinishReason != "stop" || final.TokenUsage.TotalTokens != 11 {
+			t.Fatalf("unexpected final message: %+v", final)
+		}
+		if len(bodies) != 2 {
+			t.Fatalf("expected 2 requests, got %d", len(bodies))
+		}
+		messages, _ := bodies[1]["messages"].([]any)
+		if len(messages) != 3 {
+			t.Fatalf("expected the prefix and the resume prompt appended, got %v", messages)
+		}
+		prefix, _ := messages[1].(map[string]any)
+		prompt, _ := messages[2].(map[string]any)
+		if prefix["role"] != "assistant" || prefix["content"] != "Red and" || prompt["role"] != "user" || prompt["content"] != resumePrompt {
+			t.Fatalf("unexpected resume messages: %v", messages[1:])
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		var bodies []map[string]any
+		server := newBrokenServer(t, &bodies, first, rest)
+		var err error
+		for _, err = range newModel(server.URL, StreamResume{Disabled: true}).NewStreaming(context.Background(), newRequest()) {
+			if err != nil {
+				break
+			}
+		}
+		if err == nil || len(bodies) != 1 {
+			t.Fatalf("expected the broken stream to fail after 1 request, got %v after %d", err, len(bodies))
+		}
+	})
+}
@@ -0,0 +1,155 @@
+package otel
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+
+	"github.com/go-kratos/blades"
+)
+
+// MetricOption defines options for the session and limiter metrics.
+type MetricOption func(*metricOptions)
+
+type metricOptions struct {
+	meter metric.Meter
+}
+
+// WithMeterProvider sets a custom MeterProvider for the session and limiter metrics.
+func WithMeterProvider(mp metric.MeterProvider) MetricOption {
+	return func(o *metricOptions) {
+		o.meter = mp.Meter(traceScope)
+	}
+}
+
+// newMetricOptions returns the options with the global MeterProvider by default.
+func newMetricOptions(opts []MetricOption) metricOptions {
+	o := metricOptions{meter: otel.GetMeterProvider().Meter(traceScope)}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// sessionMetrics records the size of the session at the end of every invocation.
+type sessionMetrics struct {
+	meter      metric.Meter
+	messages   metric.Int64Histogram
+	textBytes  metric.Int64Histogram
+	stateKeys  metric.Int64Histogram
+	stateBytes metric.Int64Histogram
+	valueBytes metric.Int64Histogram
+}
+
+// sessionMetricsHandler records the session stats around the next handler.
+type sessionMetricsHandler struct {
+	*sessionMetrics
+	next blades.Handler
+}
+
+// SessionMetrics returns a middleware that records the stats of the session
+// at the end of every agent invocation, with the agent name as attribute:
+//
+//   - blades.session.messages, the number of messages in the history,
+//   - blades.session.text_bytes, the size of the history text,
+//   - blades.session.state_keys, the number of state keys,
+//   - blades.session.state_bytes, the size of the state values,
+//   - blades.session.state_value_bytes, the size of each state value, with
+//     the key as attribute.
+func SessionMetrics(opts ...MetricOption) blades.Middleware {
+	m := &sessionMetrics{meter: newMetricOptions(opts).meter}
+	m.messages = m.histogram("blades.session.messages", "Messages in the session history.", "{message}")
+	m.textBytes = m.histogram("blades.session.text_bytes", "Size of the text of the session history.", "By")
+	m.stateKeys = m.histogram("blades.session.state_keys", "Keys in the session state.", "{key}")
+	m.stateBytes = m.histogram("blades.session.state_bytes", "Size of the session state values.", "By")
+	m.valueBytes = m.histogram("blades.session.state_value_bytes", "Size of a session state value.", "By")
+	return func(next blades.Handler) blades.Handler {
+		return &sessionMetricsHandler{sessionMetrics: m, next: next}
+	}
+}
+
+// histogram creates a histogram; the meter returns a usable one even with an
+// error, which goes to the global error handler.
+func (m *sessionMetrics) histogram(name, description, unit string) metric.Int64Histogram {
+	h, err := m.meter.Int64Histogram(name, metric.WithDescription(description), metric.WithUnit(unit))
+	if err != nil {
+		otel.Handle(err)
+	}
+	return h
+}
+
+// Handle passes the invocation on and records the session stats once it ends.
+func (m *sessionMetricsHandler) Handle(ctx context.Context, invocation *blades.Invocation) blades.Generator[*blades.Message, error] {
+	agent, ok := blades.FromAgentContext(ctx)
+	if !ok || invocation.Session == nil {
+		return m.next.Handle(ctx, invocation)
+	}
+	return func(yield func(*blades.Message, error) bool) {
+		defer func() {
+			m.record(ctx, agent.Name(), blades.MeasureSession(invocation.Session))
+		}()
+		for message, err := range m.next.Handle(ctx, invocation) {
+			if !yield(message, err) {
+				return
+			}
+		}
+	}
+}
+
+func (m *sessionMetrics) record(ctx context.Context, agent string, stats blades.SessionStats) {
+	attrs := metric.WithAttributes(semconv.GenAIAgentName(agent))
+	m.messages.Record(ctx, int64(stats.Messages), attrs)
+	m.textBytes.Record(ctx, int64(stats.TextBytes), attrs)
+	m.stateKeys.Record(ctx, int64(stats.StateKeys), attrs)
+	m.stateBytes.Record(ctx, int64(stats.StateSize()), attrs)
+	for key, size := range stats.StateBytes {
+		m.valueBytes.Record(ctx, int64(size), metric.WithAttributes(semconv.GenAIAgentName(agent), attribute.String("blades.state.key", key)))
+	}
+}
+
+// LimiterMetrics returns an observer of a blades.Limiter, passed to
+// blades.WithLimiterObserver, that records:
+//
+//   - blades.limiter.wait_time, the time a run waited for a slot,
+//   - blades.limiter.in_flight, the runs holding a slot,
+//   - blades.limiter.queued, the runs waiting for a slot,
+//   - blades.limiter.rejected, the runs that were overloaded or gave up
+//     waiting, with the reason as attribute.
+//
+// The wait time and the rejections carry the priority class of the run.
+func LimiterMetrics(opts ...MetricOption) blades.LimiterObserver {
+	meter := newMetricOptions(opts).meter
+	wait, err := meter.Float64Histogram("blades.limiter.wait_time", metric.WithDescription("Time a run waited for a slot of the limiter."), metric.WithUnit("s"))
+	if err != nil {
+		otel.Handle(err)
+	}
+	inFlight, err := meter.Int64Gauge("blades.limiter.in_flight", metric.WithDescription("Runs holding a slot of the limiter."), metric.WithUnit("{run}"))
+	if err != nil {
+		otel.Handle(err)
+	}
+	queued, err := meter.Int64Gauge("blades.limiter.queued", metric.WithDescription("Runs waiting for a slot of the limiter."), metric.WithUnit("{run}"))
+	if err != nil {
+		otel.Handle(err)
+	}
+	rejected, err := meter.Int64Counter("blades.limiter.rejected", metric.WithDescription("Runs the limiter did not admit."), metric.WithUnit("{run}"))
+	if err != nil {
+		otel.Handle(err)
+	}
+	return func(ctx context.Context, event blades.LimiterEvent) {
+		inFlight.Record(ctx, int64(event.InFlight))
+		queued.Record(ctx, int64(event.Queued))
+		priority := attribute.String("blades.limiter.priority", event.Priority.String())
+		switch {
+		case event.Err == nil:
+			wait.Record(ctx, event.Wait.Seconds(), metric.WithAttributes(priority))
+		case errors.Is(event.Err, blades.ErrOverloaded):
+			rejected.Add(ctx, 1, metric.WithAttributes(priority, attribute.String("blades.limiter.reason", "overloaded")))
+		default:
+			rejected.Add(ctx, 1, metric.WithAttributes(priority, attribute.String("blades.limiter.reason", "cancelled")))
+		}
+	}
+}
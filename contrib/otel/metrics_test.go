@@ -0,0 +1,30 @@
+package otel
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kratos/blades"
+)
+
+func TestSessionMetricsHandlers(t *testing.T) {
+	handler := func(text string) blades.Handler {
+		return blades.HandleFunc(func(ctx context.Context, invocation *blades.Invocation) blades.Generator[*blades.Message, error] {
+			return func(yield func(*blades.Message, error) bool) {
+				yield(blades.AssistantMessage(text), nil)
+			}
+		})
+	}
+	// A middleware wrapping several handlers keeps each one's next.
+	middleware := SessionMetrics()
+	first := middleware(handler("first"))
+	middleware(handler("second"))
+	for message, err := range first.Handle(context.Background(), &blades.Invocation{Session: blades.NewSession()}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if message.Text() != "first" {
+			t.Fatalf("want the first handler called, got %q", message.Text())
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package otel
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/go-kratos/blades"
+)
+
+// modelTracing emits GenAI chat spans around model calls.
+type modelTracing struct {
+	*tracing
+	next blades.ModelHandler
+}
+
+// ModelTracing returns a model middleware that adds OpenTelemetry tracing to model calls.
+// Use it with blades.WrapModel, so that providers called directly are traced too.
+func ModelTracing(opts ...TraceOption) blades.ModelMiddleware {
+	t := &tracing{
+		system: "_OTHER",
+		tracer: otel.GetTracerProvider().Tracer(traceScope),
+	}
+	for _, o := range opts {
+		o(t)
+	}
+	return func(next blades.ModelHandler) blades.ModelHandler {
+		return &modelTracing{tracing: t, next: next}
+	}
+}
+
+func (t *modelTracing) Start(ctx context.Context, req *blades.ModelRequest) (context.Context, trace.Span) {
+	var name string
+	if model, ok := blades.FromModelContext(ctx); ok {
+		name = model.Name()
+	}
+	name = blades.ResolveModel(ctx, name)
+	ctx, span := t.tracer.Start(ctx, fmt.Sprintf("chat %s", name), trace.WithSpanKind(trace.SpanKindClient))
+	span.SetAttributes(
+		semconv.GenAIOperationNameChat,
+		semconv.GenAISystemKey.String(t.system),
+		semconv.GenAIRequestModel(name),
+	)
+	if req.Options.Seed != nil {
+		span.SetAttributes(semconv.GenAIRequestSeed(int(*req.Options.Seed)))
+	}
+	if len(req.Options.StopSequences) > 0 {
+		span.SetAttributes(semconv.GenAIRequestStopSequences(req.Options.StopSequences...))
+	}
+	if req.Options.TopK != nil {
+		span.SetAttributes(semconv.GenAIRequestTopK(float64(*req.Options.TopK)))
+	}
+	if req.Options.CandidateCount > 0 {
+		span.SetAttributes(semconv.GenAIRequestChoiceCount(int(req.Options.CandidateCount)))
+	}
+	if req.Options.FrequencyPenalty != nil {
+		span.SetAttributes(semconv.GenAIRequestFrequencyPenalty(*req.Options.FrequencyPenalty))
+	}
+	if req.Options.PresencePenalty != nil {
+		span.SetAttributes(semconv.GenAIRequestPresencePenalty(*req.Options.PresencePenalty))
+	}
+	return ctx, span
+}
+
+// Generate traces a single model call.
+func (t *modelTracing) Generate(ctx context.Context, req *blades.ModelRequest) (*blades.ModelResponse, error) {
+	ctx, span := t.Start(ctx, req)
+	res, err := t.next.Generate(ctx, req)
+	var msg *blades.Message
+	if res != nil {
+		msg = res.Message
+	}
+	t.End(span, msg, err)
+	return res, err
+}
+
+// NewStreaming traces a streaming model call; the span ends with the stream.
+func (t *modelTracing) NewStreaming(ctx context.Context, req *blades.ModelRequest) blades.Generator[*blades.ModelResponse, error] {
+	return func(yield func(*blades.ModelResponse, error) bool) {
+		var (
+			err error
+			msg *blades.Message
+		)
+		ctx, span := t.Start(ctx, req)
+		defer func() { t.End(span, msg, err) }()
+		for res, e := range t.next.NewStreaming(ctx, req) {
+			if e != nil {
+				err = e
+				yield(nil, e)
+				return
+			}
+			if res.Message != nil && res.Message.Status == blades.StatusCompleted {
+				msg = res.Message
+			}
+			if !yield(res, nil) {
+				return
+			}
+		}
+	}
+}
+
+// End records the outcome of the call and ends the span.
+func (t *modelTracing) End(span trace.Span, msg *blades.Message, err error) {
+	defer span.End()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else {
+		span.SetStatus(codes.Ok, codes.Ok.String())
+	}
+	setResponseAttributes(span, msg)
+}
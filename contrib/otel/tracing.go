@@ -2,9 +2,11 @@ package otel
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
 	"go.opentelemetry.io/otel/trace"
@@ -70,7 +72,11 @@ func (t *tracing) Start(ctx context.Context, agent blades.AgentContext, invocati
 		semconv.GenAIAgentDescription(agent.Description()),
 		semconv.GenAIRequestModel(invocation.Model),
 		semconv.GenAIConversationID(sessionID),
+		attribute.String("blades.invocation.id", invocation.ID),
 	)
+	if path := blades.PathFromContext(ctx); len(path) > 0 {
+		span.SetAttributes(attribute.StringSlice("blades.path", path))
+	}
 	return ctx, span
 }
 
@@ -92,6 +98,7 @@ func (t *tracing) Handle(ctx context.Context, invocation *blades.Invocation) bla
 				yield(nil, err)
 				break
 			}
+			addToolEvents(ctx, span, message)
 			if !yield(message, nil) {
 				break
 			}
@@ -100,19 +107,49 @@ func (t *tracing) Handle(ctx context.Context, invocation *blades.Invocation) bla
 	}
 }
 
+// addToolEvents records the tool calls of a completed tool message as span
+// events, with the sensitive arguments masked; see blades.RedactToolCall.
+func addToolEvents(ctx context.Context, span trace.Span, msg *blades.Message) {
+	if msg == nil || msg.Role != blades.RoleTool || msg.Status != blades.StatusCompleted {
+		return
+	}
+	for _, part := range msg.Parts {
+		call, ok := part.(blades.ToolPart)
+		if !ok {
+			continue
+		}
+		call = blades.RedactToolCall(ctx, call)
+		span.AddEvent("gen_ai.tool.call", trace.WithAttributes(
+			semconv.GenAIToolName(call.Name),
+			semconv.GenAIToolCallID(call.ID),
+			attribute.String("blades.tool.arguments", call.Request),
+		))
+	}
+}
+
 func (t *tracing) End(span trace.Span, msg *blades.Message, err error) {
 	defer span.End()
 	if err != nil {
+		// The error path also names the tool or node that failed, if any.
+		var pathErr *blades.PathError
+		if errors.As(err, &pathErr) {
+			span.SetAttributes(attribute.StringSlice("blades.error.path", pathErr.Path))
+		}
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
 	} else {
 		span.SetStatus(codes.Ok, codes.Ok.String())
 	}
+	setResponseAttributes(span, msg)
+}
+
+// setResponseAttributes records the finish reason and token usage of the final message.
+func setResponseAttributes(span trace.Span, msg *blades.Message) {
 	if msg == nil {
 		return
 	}
 	if msg.FinishReason != "" {
-		span.SetAttributes(semconv.GenAIResponseFinishReasons(msg.FinishReason))
+		span.SetAttributes(semconv.GenAIResponseFinishReasons(string(msg.FinishReason)))
 	}
 	if msg.TokenUsage.InputTokens > 0 {
 		span.SetAttributes(semconv.GenAIUsageInputTokens(int(msg.TokenUsage.InputTokens)))
@@ -0,0 +1,92 @@
+package otel
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/go-kratos/blades"
+	"github.com/go-kratos/blades/tools"
+)
+
+// scriptedModel calls the login tool, then answers.
+type scriptedModel struct{}
+
+func (scriptedModel) Name() string { return "scripted" }
+
+func (scriptedModel) Generate(ctx context.Context, req *blades.ModelRequest) (*blades.ModelResponse, error) {
+	last := req.Messages[len(req.Messages)-1]
+	if last.Role == blades.RoleUser {
+		return &blades.ModelResponse{Message: &blades.Message{Role: blades.RoleTool, Status: blades.StatusCompleted, Parts: []blades.Part{
+			blades.ToolPart{ID: "call-1", Name: "login", Request: `{"user":{"email":"ann@example.com"},"password":"hunter2"}`},
+		}}}, nil
+	}
+	message := blades.NewAssistantMessage(blades.StatusCompleted)
+	message.Parts = blades.Parts("logged in")
+	return &blades.ModelResponse{Message: message}, nil
+}
+
+func (m scriptedModel) NewStreaming(ctx context.Context, req *blades.ModelRequest) blades.Generator[*blades.ModelResponse, error] {
+	return func(yield func(*blades.ModelResponse, error) bool) {
+		yield(m.Generate(ctx, req))
+	}
+}
+
+func TestSensitiveToolArguments(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	transcripts := filepath.Join(t.TempDir(), "transcripts.jsonl")
+
+	login := tools.NewTool("login", "Logs the user in", tools.HandleFunc(func(ctx context.Context, input string) (string, error) {
+		return `{"ok":true}`, nil
+	}), tools.WithSensitiveFields("password", "/user/email"))
+	agent, err := blades.NewAgent("assistant",
+		blades.WithModel(blades.WrapModel(scriptedModel{}, blades.Audit(blades.NewJSONLTranscriptStore(transcripts)))),
+		blades.WithTools(login),
+		blades.WithMiddleware(Tracing(WithTracerProvider(provider))),
+		blades.WithPromptLogging(logger),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := blades.NewRunner(agent).Run(context.Background(), blades.UserMessage("log me in")); err != nil {
+		t.Fatal(err)
+	}
+
+	var traced strings.Builder
+	for _, span := range recorder.Ended() {
+		for _, event := range span.Events() {
+			for _, attr := range event.Attributes {
+				traced.WriteString(attr.Value.Emit())
+			}
+		}
+	}
+	audited, err := os.ReadFile(transcripts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sinks := map[string]string{
+		"log":        logs.String(),
+		"trace":      traced.String(),
+		"transcript": string(audited),
+	}
+	for sink, recorded := range sinks {
+		for _, secret := range []string{"hunter2", "ann@example.com"} {
+			if strings.Contains(recorded, secret) {
+				t.Errorf("want %s masked in the %s, got %s", secret, sink, recorded)
+			}
+		}
+		if !strings.Contains(recorded, tools.Mask) {
+			t.Errorf("want the mask in the %s, got %s", sink, recorded)
+		}
+	}
+}
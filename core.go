@@ -20,12 +20,23 @@ type Invocation struct {
 	Message     *Message
 	History     []*Message
 	Tools       []tools.Tool
+	// ModelProvider, if set by a middleware, answers the invocation instead
+	// of the agent's model, e.g. a cheaper model for simple requests. It is
+	// not passed on to sub-agents.
+	ModelProvider ModelProvider
+	// depth is the nesting of sub-agents below the root invocation.
+	depth int
 }
 
 // Generator is a generic type representing a sequence generator that yields values of type T or errors of type E.
 type Generator[T, E any] = iter.Seq2[T, E]
 
 // Agent represents an autonomous agent that can process invocations and produce a sequence of messages.
+//
+// Run may be called concurrently with different invocations, so implementations
+// keep per-run state on the Invocation rather than on the agent. The agents
+// built by NewAgent and the flow package are immutable once constructed and
+// may be shared across goroutines.
 type Agent interface {
 	// Name returns the name of the agent.
 	Name() string
@@ -35,22 +46,39 @@ type Agent interface {
 	Run(context.Context, *Invocation) Generator[*Message, error]
 }
 
-// NewInvocationID generates a new unique invocation ID.
+// NewInvocationID generates a new unique, time-ordered (UUIDv7) invocation ID.
 func NewInvocationID() string {
-	return uuid.NewString()
+	id, err := uuid.NewV7()
+	if err != nil {
+		return uuid.NewString()
+	}
+	return id.String()
+}
+
+// Child returns a copy of the invocation for a sub-agent, with the
+// hierarchical ID "parent.name" so that the sub-agent's messages, traces and
+// checkpoints can be joined with the parent invocation.
+func (inv *Invocation) Child(name string) *Invocation {
+	child := inv.Clone()
+	child.ID = inv.ID + "." + name
+	child.ModelProvider = nil
+	child.depth = inv.depth + 1
+	return child
 }
 
 // Clone creates a deep copy of the Invocation.
 func (inv *Invocation) Clone() *Invocation {
 	return &Invocation{
-		ID:          inv.ID,
-		Model:       inv.Model,
-		Session:     inv.Session,
-		Resumable:   inv.Resumable,
-		Streamable:  inv.Streamable,
-		Message:     inv.Message.Clone(),
-		Instruction: inv.Instruction.Clone(),
-		History:     slices.Clone(inv.History),
-		Tools:       slices.Clone(inv.Tools),
+		ID:            inv.ID,
+		Model:         inv.Model,
+		Session:       inv.Session,
+		Resumable:     inv.Resumable,
+		Streamable:    inv.Streamable,
+		Message:       inv.Message.Clone(),
+		Instruction:   inv.Instruction.Clone(),
+		History:       slices.Clone(inv.History),
+		Tools:         slices.Clone(inv.Tools),
+		ModelProvider: inv.ModelProvider,
+		depth:         inv.depth,
 	}
 }
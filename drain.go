@@ -0,0 +1,143 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// defaultGracePeriod is how long Drain waits for in-flight runs by default.
+const defaultGracePeriod = 30 * time.Second
+
+// DrainOption defines options for Runner.Drain and JobRunner.Drain.
+type DrainOption func(*drainOptions)
+
+type drainOptions struct {
+	grace time.Duration
+	store SessionStore
+}
+
+// WithGracePeriod sets how long in-flight runs may keep running before they
+// are cancelled. Defaults to 30 seconds.
+func WithGracePeriod(grace time.Duration) DrainOption {
+	return func(o *drainOptions) {
+		o.grace = grace
+	}
+}
+
+// WithCheckpointStore sets the store the sessions of the runs that did not
+// finish within the grace period are saved to before they are cancelled, so
+// that resumable runs can continue after a restart.
+func WithCheckpointStore(store SessionStore) DrainOption {
+	return func(o *drainOptions) {
+		o.store = store
+	}
+}
+
+// isDraining reports whether the Runner stopped accepting runs.
+func (r *Runner) isDraining() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.draining
+}
+
+// closeDrained signals that the last run finished; r.mu must be held.
+func (r *Runner) closeDrained() {
+	select {
+	case <-r.drained:
+	default:
+		close(r.drained)
+	}
+}
+
+// Drain shuts the Runner down gracefully, e.g. on SIGTERM. New runs fail with
+// ErrRunnerDraining. In-flight runs may finish within the grace period; the
+// sessions of the others are saved to the checkpoint store, if any, and they
+// are cancelled, ending with a StatusCancelled message. Drain returns once
+// every run has stopped, or with the cause of ctx if it is done first.
+func (r *Runner) Drain(ctx context.Context, opts ...DrainOption) error {
+	o := drainOptions{grace: defaultGracePeriod}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	r.mu.Lock()
+	r.draining = true
+	if r.drained == nil {
+		r.drained = make(chan struct{})
+	}
+	if len(r.active) == 0 {
+		r.closeDrained()
+	}
+	drained := r.drained
+	r.mu.Unlock()
+
+	grace := time.NewTimer(o.grace)
+	defer grace.Stop()
+	select {
+	case <-drained:
+		return nil
+	case <-grace.C:
+	case <-ctx.Done():
+	}
+	r.mu.Lock()
+	runs := make([]*activeRun, 0, len(r.active))
+	for _, run := range r.active {
+		runs = append(runs, run)
+	}
+	r.mu.Unlock()
+	var errs []error
+	if o.store != nil {
+		saved := make(map[string]bool, len(runs))
+		for _, run := range runs {
+			if run.session == nil || saved[run.session.ID()] {
+				continue
+			}
+			saved[run.session.ID()] = true
+			if err := o.store.Save(context.WithoutCancel(ctx), run.session); err != nil {
+				errs = append(errs, fmt.Errorf("runner: checkpoint %s: %w", run.session.ID(), err))
+			}
+		}
+	}
+	for _, run := range runs {
+		run.cancel(ErrInvocationCancelled)
+	}
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		errs = append(errs, fmt.Errorf("runner: drain: %w", context.Cause(ctx)))
+	}
+	return errors.Join(errs...)
+}
+
+// Drain shuts the JobRunner down gracefully. New jobs fail with
+// ErrRunnerDraining, queued jobs are cancelled, and running jobs are drained
+// like with Runner.Drain, checkpointing their sessions to the job store
+// unless another store is given. Drain returns once every job has recorded
+// its final status.
+func (r *JobRunner) Drain(ctx context.Context, opts ...DrainOption) error {
+	r.mu.Lock()
+	r.draining = true
+	jobs := make([]*liveJob, 0, len(r.jobs))
+	for _, j := range r.jobs {
+		jobs = append(jobs, j)
+	}
+	r.mu.Unlock()
+	for _, j := range jobs {
+		j.mu.Lock()
+		queued := j.job.Status == JobQueued
+		j.mu.Unlock()
+		if queued {
+			j.cancel(ErrInvocationCancelled)
+		}
+	}
+	err := r.runner.Drain(ctx, append([]DrainOption{WithCheckpointStore(r.store)}, opts...)...)
+	for _, j := range jobs {
+		select {
+		case <-j.saved:
+		case <-ctx.Done():
+			return errors.Join(err, fmt.Errorf("job runner: drain: %w", context.Cause(ctx)))
+		}
+	}
+	return err
+}
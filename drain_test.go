@@ -0,0 +1,165 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/blades/tools"
+)
+
+// newSlowAgent returns an agent whose tool runs until it is released or its
+// context is cancelled, and a channel closed once the tool started.
+func newSlowAgent(t *testing.T, release <-chan struct{}) (Agent, <-chan struct{}) {
+	t.Helper()
+	model := &mockModel{generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+		if last := req.Messages[len(req.Messages)-1]; last.Role == RoleTool {
+			return textResponse("done"), nil
+		}
+		return &ModelResponse{Message: &Message{Role: RoleTool, Status: StatusCompleted, Parts: []Part{
+			ToolPart{ID: "call-1", Name: "slow", Request: "{}"},
+		}}}, nil
+	}}
+	started := make(chan struct{})
+	slow := tools.NewTool("slow", "a long running tool", tools.HandleFunc(func(ctx context.Context, input string) (string, error) {
+		close(started)
+		select {
+		case <-release:
+			return "ok", nil
+		case <-ctx.Done():
+			return "", context.Cause(ctx)
+		}
+	}))
+	agent, err := NewAgent("worker", WithModel(model), WithTools(slow))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return agent, started
+}
+
+func TestRunnerDrain(t *testing.T) {
+	tests := []struct {
+		name       string
+		finish     bool
+		wantStatus Status
+	}{
+		{"finishes within grace period", true, StatusCompleted},
+		{"cancelled after grace period", false, StatusCancelled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			release := make(chan struct{})
+			agent, started := newSlowAgent(t, release)
+			runner := NewRunner(agent)
+			session := NewSession()
+			type result struct {
+				message *Message
+				err     error
+			}
+			results := make(chan result, 1)
+			go func() {
+				message, err := runner.Run(context.Background(), UserMessage("go"), WithSession(session), WithInvocationID("inv-1"))
+				results <- result{message, err}
+			}()
+			<-started
+			if tt.finish {
+				time.AfterFunc(10*time.Millisecond, func() { close(release) })
+			}
+			store := NewInMemorySessionStore()
+			if err := runner.Drain(context.Background(), WithGracePeriod(50*time.Millisecond), WithCheckpointStore(store)); err != nil {
+				t.Fatal(err)
+			}
+			res := <-results
+			if res.err != nil || res.message.Status != tt.wantStatus {
+				t.Fatalf("want a %s final message, got %+v, %v", tt.wantStatus, res.message, res.err)
+			}
+			_, err := store.Load(context.Background(), session.ID())
+			if checkpointed := err == nil; checkpointed == tt.finish {
+				t.Fatalf("want checkpoint %t, got %t", !tt.finish, checkpointed)
+			}
+			if !tt.finish && !IsInvocationCancelled(session, "inv-1") {
+				t.Fatal("want the session to record the cancellation")
+			}
+			if _, err := runner.Run(context.Background(), UserMessage("again")); !errors.Is(err, ErrRunnerDraining) {
+				t.Fatalf("want ErrRunnerDraining after drain, got %v", err)
+			}
+		})
+	}
+}
+
+func TestJobRunnerDrain(t *testing.T) {
+	agent, started := newSlowAgent(t, make(chan struct{}))
+	store := NewInMemorySessionStore()
+	jobs := NewJobRunner(NewRunner(agent), WithJobStore(store), WithJobWorkers(1))
+	ctx := context.Background()
+	running, err := jobs.Submit(ctx, UserMessage("first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	queued, err := jobs.Submit(ctx, UserMessage("second"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := jobs.Drain(ctx, WithGracePeriod(10*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{running, queued} {
+		job, err := jobs.Status(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status != JobCancelled {
+			t.Fatalf("want job %s cancelled, got %s", id, job.Status)
+		}
+	}
+	if _, err := jobs.Submit(ctx, UserMessage("third")); !errors.Is(err, ErrRunnerDraining) {
+		t.Fatalf("want ErrRunnerDraining after drain, got %v", err)
+	}
+}
+
+// blockingStore blocks the first Save until released.
+type blockingStore struct {
+	SessionStore
+	saving  chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (s *blockingStore) Save(ctx context.Context, session Session) error {
+	s.once.Do(func() {
+		close(s.saving)
+		<-s.release
+	})
+	return s.SessionStore.Save(ctx, session)
+}
+
+func TestJobRunnerDrainDuringSubmit(t *testing.T) {
+	agent, _ := newSlowAgent(t, make(chan struct{}))
+	store := &blockingStore{SessionStore: NewInMemorySessionStore(), saving: make(chan struct{}), release: make(chan struct{})}
+	jobs := NewJobRunner(NewRunner(agent), WithJobStore(store))
+	ctx := context.Background()
+	submitted := make(chan string)
+	go func() {
+		id, err := jobs.Submit(ctx, UserMessage("first"))
+		if err != nil {
+			t.Error(err)
+		}
+		submitted <- id
+	}()
+	// The job is registered and its first save is in progress.
+	<-store.saving
+	drained := make(chan error)
+	go func() { drained <- jobs.Drain(ctx) }()
+	time.Sleep(10 * time.Millisecond)
+	close(store.release)
+	id := <-submitted
+	if err := <-drained; err != nil {
+		t.Fatal(err)
+	}
+	if job, err := jobs.Status(ctx, id); err != nil || job.Status != JobCancelled {
+		t.Fatalf("want the job cancelled, got %+v, %v", job, err)
+	}
+}
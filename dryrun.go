@@ -0,0 +1,126 @@
+package blades
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+// DryRunKey is the metadata key of the DryRunResult of a dry run answer.
+const DryRunKey = "dry_run"
+
+// RequestRenderer is implemented by model providers that can render a request
+// exactly as they would send it, e.g. as the JSON body of their API.
+type RequestRenderer interface {
+	RenderRequest(ctx context.Context, req *ModelRequest) (json.RawMessage, error)
+}
+
+// DryRunTool is a tool offered to the model by a dry run request.
+type DryRunTool struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description,omitempty"`
+	InputSchema *jsonschema.Schema `json:"inputSchema,omitempty"`
+}
+
+// DryRunResult is the request an agent would have sent to its model.
+type DryRunResult struct {
+	Agent string `json:"agent"`
+	Model string `json:"model"`
+	// Request is the request in the format of the provider if it is a
+	// RequestRenderer, or the JSON encoding of the ModelRequest otherwise.
+	Request json.RawMessage `json:"request"`
+	// Rendered reports whether Request is in the format of the provider.
+	Rendered bool `json:"rendered"`
+	// InstructionTokens, MessageTokens and ToolTokens are estimated with the
+	// TokenCounter of the agent.
+	InstructionTokens int64        `json:"instructionTokens"`
+	MessageTokens     int64        `json:"messageTokens"`
+	ToolTokens        int64        `json:"toolTokens"`
+	Tools             []DryRunTool `json:"tools,omitempty"`
+}
+
+// Tokens returns the estimated tokens of the request.
+func (r *DryRunResult) Tokens() int64 {
+	return r.InstructionTokens + r.MessageTokens + r.ToolTokens
+}
+
+// DryRun runs the whole pipeline, including middlewares, instruction
+// templates, history assembly and tool resolution, but stops before each
+// agent calls its model. The agent answers instead with the text of the
+// request it would have sent and a DryRunResult under DryRunKey.
+//
+// Tool calls cannot be simulated, so a dry run only covers the first model
+// turn of each agent. It runs on a fork of the session, which is left
+// untouched, and is never shared with other runs.
+func DryRun() RunOption {
+	return func(o *RunOptions) {
+		o.DryRun = true
+	}
+}
+
+// ctxDryRunKey is the context key that marks a dry run.
+type ctxDryRunKey struct{}
+
+// isDryRun reports whether the run of the context is a dry run.
+func isDryRun(ctx context.Context) bool {
+	dryRun, _ := ctx.Value(ctxDryRunKey{}).(bool)
+	return dryRun
+}
+
+// dryRun returns the answer describing the request in place of the model's.
+func (a *agent) dryRun(ctx context.Context, invocation *Invocation, req *ModelRequest) (*Message, error) {
+	result := &DryRunResult{
+		Agent:             a.name,
+		Model:             invocation.Model,
+		InstructionTokens: a.tokenCounter.CountTokens(req.Instruction),
+		MessageTokens:     a.tokenCounter.CountTokens(req.Messages...),
+	}
+	for _, tool := range req.Tools {
+		t := DryRunTool{Name: tool.Name(), Description: tool.Description(), InputSchema: tool.InputSchema()}
+		data, err := json.Marshal(t)
+		if err != nil {
+			return nil, fmt.Errorf("agent %s: dry run: %w", a.name, err)
+		}
+		result.ToolTokens += charsToTokens(len(data))
+		result.Tools = append(result.Tools, t)
+	}
+	// The request is shown with the redactors of the agent applied, so that
+	// secrets rendered into the prompt do not leak into the answer.
+	redactors := FromRedactorsContext(ctx)
+	shown := *req
+	shown.Instruction = redactors.RedactMessage(ctx, req.Instruction)
+	shown.Messages = make([]*Message, 0, len(req.Messages))
+	for _, m := range req.Messages {
+		shown.Messages = append(shown.Messages, redactors.RedactMessage(ctx, m))
+	}
+	var model any = a.provider(ctx)
+	if wrapped, ok := model.(*wrappedModel); ok {
+		model = wrapped.model
+	}
+	var err error
+	if renderer, ok := model.(RequestRenderer); ok {
+		result.Request, err = renderer.RenderRequest(ctx, &shown)
+		result.Rendered = true
+	} else {
+		// Tools are interfaces without a JSON encoding; they are listed in Tools.
+		plain := shown
+		plain.Tools = nil
+		result.Request, err = json.Marshal(&plain)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("agent %s: dry run: %w", a.name, err)
+	}
+	var text bytes.Buffer
+	if err := json.Indent(&text, result.Request, "", "  "); err != nil {
+		return nil, fmt.Errorf("agent %s: dry run: %w", a.name, err)
+	}
+	message := NewAssistantMessage(StatusCompleted)
+	message.Author = a.name
+	message.InvocationID = invocation.ID
+	message.Parts = Parts(text.String())
+	message.Metadata = map[string]any{DryRunKey: result}
+	return message, nil
+}
@@ -0,0 +1,97 @@
+package blades
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/go-kratos/blades/tools"
+)
+
+// renderingModel renders requests as a provider would.
+type renderingModel struct {
+	mockModel
+}
+
+func (m *renderingModel) RenderRequest(ctx context.Context, req *ModelRequest) (json.RawMessage, error) {
+	return json.Marshal(map[string]any{"model": m.Name(), "system": req.Instruction.Text(), "turns": len(req.Messages)})
+}
+
+func TestDryRun(t *testing.T) {
+	model := &mockModel{generate: echoInstruction}
+	weather := tools.NewTool("weather", "Returns the weather of a city.", tools.HandleFunc(func(ctx context.Context, input string) (string, error) {
+		return "sunny", nil
+	}))
+	agent, err := NewAgent("assistant",
+		WithModel(model),
+		WithInstruction("Help {{.name}}."),
+		WithTools(weather),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := NewRunner(agent)
+	session := NewSession(map[string]any{"name": "Ada"})
+	if _, err := runner.Run(context.Background(), UserMessage("hello"), WithSession(session)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, streaming := range []bool{false, true} {
+		var answer *Message
+		if streaming {
+			for m, err := range runner.RunStream(context.Background(), UserMessage("what's the weather?"), WithSession(session), DryRun()) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				answer = m
+			}
+		} else {
+			answer, err = runner.Run(context.Background(), UserMessage("what's the weather?"), WithSession(session), DryRun())
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if model.calls.Load() != 1 {
+			t.Fatalf("want the model not called by a dry run, got %d calls", model.calls.Load())
+		}
+		result, ok := answer.Metadata[DryRunKey].(*DryRunResult)
+		if !ok {
+			t.Fatalf("want a dry run result, got %v", answer.Metadata)
+		}
+		var req ModelRequest
+		if err := json.Unmarshal(result.Request, &req); err != nil {
+			t.Fatal(err)
+		}
+		if req.Instruction.Text() != "Help Ada." || len(req.Messages) != 1 || req.Messages[0].Text() != "what's the weather?" {
+			t.Fatalf("want the rendered instruction and the input, got %s", result.Request)
+		}
+		if result.Rendered || len(result.Tools) != 1 || result.Tools[0].Name != "weather" || result.ToolTokens == 0 {
+			t.Fatalf("unexpected tools %+v", result)
+		}
+		if result.InstructionTokens == 0 || result.MessageTokens == 0 || result.Tokens() != result.InstructionTokens+result.MessageTokens+result.ToolTokens {
+			t.Fatalf("unexpected token estimates %+v", result)
+		}
+		if !strings.Contains(answer.Text(), `"Help Ada."`) {
+			t.Fatalf("want the request as text, got %q", answer.Text())
+		}
+		if len(session.History()) != 2 {
+			t.Fatalf("want the session untouched by the dry run, got %d messages", len(session.History()))
+		}
+	}
+
+	// Providers render the request in their own format.
+	rendering := &renderingModel{}
+	agent, err = NewAgent("rendered", WithModel(WrapModel(rendering)), WithInstruction("Be brief."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	answer, err := NewRunner(agent).Run(context.Background(), UserMessage("hi"), DryRun())
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := answer.Metadata[DryRunKey].(*DryRunResult)
+	if !result.Rendered || string(result.Request) != `{"model":"mock","system":"Be brief.","turns":1}` {
+		t.Fatalf("want the provider rendering, got %s", result.Request)
+	}
+}
@@ -17,4 +17,94 @@ var (
 	ErrMaxIterationsExceeded = errors.New("maximum iterations exceeded in agent execution")
 	// ErrMissingFinalResponse is returned when an agent's stream ends without a final response.
 	ErrNoFinalResponse = errors.New("stream ended without a final response")
+	// ErrMessageNotFound is returned when a message cannot be found in the session history.
+	ErrMessageNotFound = errors.New("message not found")
+	// ErrSessionNotFound is returned when a session cannot be found in the session store.
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrInvocationCancelled is the cause of a context cancelled by Runner.Cancel.
+	ErrInvocationCancelled = errors.New("invocation cancelled")
+	// ErrInvocationMismatch is returned when a resumed invocation ID belongs to a different user message.
+	ErrInvocationMismatch = errors.New("invocation ID belongs to a different message")
+	// ErrMissingStateKey is returned by a strict instruction template when a state key it reads is not set.
+	ErrMissingStateKey = errors.New("state key is not set")
+	// ErrNoDefaultInstruction is returned when the instructions by model miss the DefaultInstructionVariant entry.
+	ErrNoDefaultInstruction = errors.New("instructions by model have no default")
+	// ErrInvalidLanguageTag is returned when a language is not a BCP-47 tag.
+	ErrInvalidLanguageTag = errors.New("invalid BCP-47 language tag")
+	// ErrInvalidOutputFormat is returned for an unknown OutputFormat, or one set on an agent with an output schema.
+	ErrInvalidOutputFormat = errors.New("invalid output format")
+	// ErrJobNotFound is returned when a job cannot be found in the job store.
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobActive is returned when a job is submitted on a session that already runs one.
+	ErrJobActive = errors.New("session already has an active job")
+	// ErrJobNotFinished is returned when the result of a queued or running job is requested.
+	ErrJobNotFinished = errors.New("job not finished")
+	// ErrJobFailed is returned for the result of a job that ended with an error.
+	ErrJobFailed = errors.New("job failed")
+	// ErrJobInterrupted marks a job that stopped without finishing, e.g. because the process restarted.
+	ErrJobInterrupted = errors.New("job interrupted")
+	// ErrScheduleNotFound is returned when a schedule cannot be found.
+	ErrScheduleNotFound = errors.New("schedule not found")
+	// ErrScheduleExists is returned when a schedule ID is added twice.
+	ErrScheduleExists = errors.New("schedule already exists")
+	// ErrTranscriptNotFound is returned when a transcript store holds no entries for an invocation.
+	ErrTranscriptNotFound = errors.New("transcript not found")
+	// ErrToolNotReplayable is returned by the tools of a reconstructed transcript request.
+	ErrToolNotReplayable = errors.New("recorded tool cannot be called")
+	// ErrUnhealthy is returned by HealthCheck when a component check fails.
+	ErrUnhealthy = errors.New("unhealthy")
+	// ErrStreamingCandidates is returned when a streaming request asks for several candidates.
+	ErrStreamingCandidates = errors.New("streaming does not support multiple candidates")
+	// ErrNoConsensus is returned by a SelfConsistent agent when no sample produced an answer.
+	ErrNoConsensus = errors.New("no sample produced an answer")
+	// ErrInvocationNotFound is returned when a session holds no answer of an invocation.
+	ErrInvocationNotFound = errors.New("invocation not found")
+	// ErrInvalidFeedback is returned for feedback that misses its invocation or says nothing.
+	ErrInvalidFeedback = errors.New("invalid feedback")
+	// ErrIdempotencyKeyReused is returned when an idempotency key is reused in a session with another input.
+	ErrIdempotencyKeyReused = errors.New("idempotency key reused with a different input")
+	// ErrRunnerDraining is returned for runs started after Drain was called.
+	ErrRunnerDraining = errors.New("runner is draining")
+	// ErrLimitExceeded is wrapped by LimitError when an invocation exceeds one of its Limits.
+	ErrLimitExceeded = errors.New("limit exceeded")
+	// ErrTransferDepthExceeded is wrapped by TransferError when a transfer exceeds the maximum transfer depth.
+	ErrTransferDepthExceeded = errors.New("maximum transfer depth exceeded")
+	// ErrTransferLoop is wrapped by TransferError when an agent immediately transfers back to the agent that transferred to it.
+	ErrTransferLoop = errors.New("transfer loop detected")
+	// ErrTransferNotAllowed is wrapped by TransferError when an agent transfers to an agent it is not allowed to.
+	ErrTransferNotAllowed = errors.New("transfer not allowed")
+	// ErrExtensionConflict is returned when a request extension sets a field the provider already sets.
+	ErrExtensionConflict = errors.New("extension conflicts with the request")
+	// ErrSnapshotIncompatible is returned when a snapshot cannot be restored for an agent graph.
+	ErrSnapshotIncompatible = errors.New("snapshot incompatible")
+	// ErrNoStageOutput is wrapped by StageError when a pipeline stage ends without a completed answer.
+	ErrNoStageOutput = errors.New("stage produced no output")
+	// ErrInputTooLarge is wrapped by InputLimitError when a user message exceeds the input limits of a Runner.
+	ErrInputTooLarge = errors.New("input too large")
+	// ErrSessionTooLarge is wrapped by SessionSizeError when a session store refuses a session over its size cap.
+	ErrSessionTooLarge = errors.New("session too large")
+	// ErrNoVariants is returned when an experiment is created without variants.
+	ErrNoVariants = errors.New("experiment has no variants")
+	// ErrTemplateLimit is returned when an instruction template exceeds the limits of its TemplateSandbox.
+	ErrTemplateLimit = errors.New("template limit exceeded")
+	// ErrOutputInvalid is wrapped by OutputValidationError when the answers of an agent keep failing its output validators.
+	ErrOutputInvalid = errors.New("output failed validation")
+	// ErrInvalidConfig is wrapped by ConfigProblem for a problem of the configuration of an agent.
+	ErrInvalidConfig = errors.New("invalid agent configuration")
+	// ErrCapabilityUnsupported is wrapped by CapabilityError when a request needs a capability the model lacks.
+	ErrCapabilityUnsupported = errors.New("capability not supported by the model")
+	// ErrAgentNotCloneable is returned by CloneAgent for agents not created by NewAgent.
+	ErrAgentNotCloneable = errors.New("agent cannot be cloned")
+	// ErrInvalidStructuredOutput is wrapped by StructuredOutputError when an answer holds no value of the expected type.
+	ErrInvalidStructuredOutput = errors.New("invalid structured output")
+	// ErrOverloaded is returned when a run is rejected because too many runs are waiting.
+	ErrOverloaded = errors.New("overloaded")
+	// ErrNeedsInput is wrapped by NeedsInputError when a tool pauses the invocation for the answer of the user.
+	ErrNeedsInput = errors.New("needs user input")
+	// ErrInvalidExport is returned by ImportSession for data that is not a session written by ExportSession.
+	ErrInvalidExport = errors.New("invalid session export")
+	// ErrBlobNotFound is returned when a blob store holds no data under a reference.
+	ErrBlobNotFound = errors.New("blob not found")
+	// ErrFutureVersion is wrapped by FutureVersionError when persisted data was written by a newer version of blades.
+	ErrFutureVersion = errors.New("persisted data of a future version")
 )
@@ -0,0 +1,109 @@
+package evaluate
+
+import (
+	"math"
+)
+
+// CalibrationBin is a range of confidence of a CalibrationReport.
+type CalibrationBin struct {
+	// Lower and Upper bound the confidence of the results in the bin; Upper
+	// is inclusive for the last bin only.
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+	// Count is the number of results in the bin.
+	Count int `json:"count"`
+	// Confidence is the mean confidence of the results in the bin.
+	Confidence float64 `json:"confidence"`
+	// Accuracy is the fraction of the results in the bin that passed.
+	Accuracy float64 `json:"accuracy"`
+}
+
+// CalibrationReport tells how well the confidence of an agent in its answers
+// predicts whether they are correct, as judged by the evaluator.
+type CalibrationReport struct {
+	// Count is the number of results with both a confidence and an evaluation.
+	Count int `json:"count"`
+	// Skipped is the number of results without either, which are left out.
+	Skipped int `json:"skipped"`
+	// Bins split the results by confidence into ranges of equal width.
+	Bins []CalibrationBin `json:"bins"`
+	// ExpectedCalibrationError is the mean gap between the confidence and
+	// the accuracy of the bins, weighted by their counts; 0 is perfect.
+	ExpectedCalibrationError float64 `json:"expectedCalibrationError"`
+	// BrierScore is the mean squared difference between the confidence and
+	// the outcome, 1 for a pass and 0 for a fail; lower is better.
+	BrierScore float64 `json:"brierScore"`
+	// Correlation is the Pearson correlation of the confidence and the
+	// outcome, or 0 if either does not vary.
+	Correlation float64 `json:"correlation"`
+}
+
+// Calibrate correlates the confidence of the results, see
+// blades.WithConfidence, with their evaluation over a dataset, splitting
+// the confidence into bins ranges; it defaults to 10.
+func Calibrate(results []*Result, bins int) *CalibrationReport {
+	if bins <= 0 {
+		bins = 10
+	}
+	report := &CalibrationReport{Bins: make([]CalibrationBin, bins)}
+	for i := range report.Bins {
+		report.Bins[i].Lower = float64(i) / float64(bins)
+		report.Bins[i].Upper = float64(i+1) / float64(bins)
+	}
+	var confidences, outcomes []float64
+	for _, result := range results {
+		if result.ConfidenceMethod == "" || result.Evaluation == nil {
+			report.Skipped++
+			continue
+		}
+		outcome := 0.0
+		if result.Evaluation.Pass {
+			outcome = 1
+		}
+		confidences = append(confidences, result.Confidence)
+		outcomes = append(outcomes, outcome)
+		bin := &report.Bins[min(max(int(result.Confidence*float64(bins)), 0), bins-1)]
+		bin.Count++
+		bin.Confidence += result.Confidence
+		bin.Accuracy += outcome
+		report.BrierScore += (result.Confidence - outcome) * (result.Confidence - outcome)
+	}
+	report.Count = len(confidences)
+	if report.Count == 0 {
+		return report
+	}
+	for i := range report.Bins {
+		bin := &report.Bins[i]
+		if bin.Count == 0 {
+			continue
+		}
+		bin.Confidence /= float64(bin.Count)
+		bin.Accuracy /= float64(bin.Count)
+		report.ExpectedCalibrationError += math.Abs(bin.Confidence-bin.Accuracy) * float64(bin.Count) / float64(report.Count)
+	}
+	report.BrierScore /= float64(report.Count)
+	report.Correlation = correlation(confidences, outcomes)
+	return report
+}
+
+// correlation returns the Pearson correlation of x and y, or 0 if either
+// does not vary.
+func correlation(x, y []float64) float64 {
+	n := float64(len(x))
+	var meanX, meanY float64
+	for i := range x {
+		meanX += x[i] / n
+		meanY += y[i] / n
+	}
+	var cov, varX, varY float64
+	for i := range x {
+		dx, dy := x[i]-meanX, y[i]-meanY
+		cov += dx * dy
+		varX += dx * dx
+		varY += dy * dy
+	}
+	if varX == 0 || varY == 0 {
+		return 0
+	}
+	return cov / math.Sqrt(varX*varY)
+}
@@ -3,6 +3,7 @@ package evaluate
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 
 	"github.com/go-kratos/blades"
 	"github.com/google/jsonschema-go/jsonschema"
@@ -36,6 +37,9 @@ func (r *Criteria) Evaluate(ctx context.Context, message *blades.Message) (*Eval
 		if err != nil {
 			return nil, err
 		}
+		if msg.IsRefusal() || msg.IsFiltered() {
+			return nil, fmt.Errorf("evaluate: judge %s did not answer (%s)", r.agent.Name(), msg.FinishReason)
+		}
 		var evaluation Evaluation
 		if err := json.Unmarshal([]byte(msg.Text()), &evaluation); err != nil {
 			return nil, err
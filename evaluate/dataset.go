@@ -0,0 +1,90 @@
+package evaluate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/go-kratos/blades"
+)
+
+// Example is a dataset entry built from user feedback: an input, the answer
+// the user rejected and the answer they expected.
+type Example struct {
+	InvocationID string         `json:"invocationId"`
+	Input        string         `json:"input"`
+	Output       string         `json:"output"`
+	Corrected    string         `json:"corrected,omitempty"`
+	Rating       blades.Rating  `json:"rating,omitempty"`
+	Comment      string         `json:"comment,omitempty"`
+	Metadata     map[string]any `json:"metadata,omitempty"`
+	// InstructionVersion, Experiment and Variant identify what produced the output.
+	InstructionVersion string `json:"instructionVersion,omitempty"`
+	Experiment         string `json:"experiment,omitempty"`
+	Variant            string `json:"variant,omitempty"`
+}
+
+// Case returns the evaluation case of the example.
+func (e Example) Case() Case {
+	return Case{Name: e.InvocationID, Input: blades.UserMessage(e.Input)}
+}
+
+// FeedbackDataset exports the negative or corrected feedback of the store as
+// examples, reading the input and answer of each invocation from its stored
+// session. Feedback whose session or invocation no longer exists is skipped.
+func FeedbackDataset(ctx context.Context, feedback blades.FeedbackStore, sessions blades.SessionStore) ([]Example, error) {
+	all, err := feedback.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	var examples []Example
+	for _, f := range all {
+		if f.Rating != blades.RatingNegative && f.Correction == "" {
+			continue
+		}
+		session, err := sessions.Load(ctx, f.SessionID)
+		if errors.Is(err, blades.ErrSessionNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		input, output, err := blades.InvocationMessages(session, f.InvocationID)
+		if errors.Is(err, blades.ErrInvocationNotFound) || input == nil {
+			continue
+		}
+		if f.MessageID != "" {
+			for _, m := range session.History() {
+				if m.ID == f.MessageID {
+					output = m
+				}
+			}
+		}
+		examples = append(examples, Example{
+			InvocationID:       f.InvocationID,
+			Input:              input.Text(),
+			Output:             output.Text(),
+			Corrected:          f.Correction,
+			Rating:             f.Rating,
+			Comment:            f.Comment,
+			Metadata:           f.Metadata,
+			InstructionVersion: f.InstructionVersion,
+			Experiment:         f.Experiment,
+			Variant:            f.Variant,
+		})
+	}
+	return examples, nil
+}
+
+// WriteDataset writes the examples as JSON lines, e.g. for fine-tuning.
+func WriteDataset(w io.Writer, examples []Example) error {
+	enc := json.NewEncoder(w)
+	for _, example := range examples {
+		if err := enc.Encode(example); err != nil {
+			return fmt.Errorf("evaluate: write dataset: %w", err)
+		}
+	}
+	return nil
+}
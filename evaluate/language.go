@@ -0,0 +1,37 @@
+package evaluate
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-kratos/blades"
+)
+
+const languagePrompt = `You are an expert evaluator. Decide whether the response below is written in the language with the BCP-47 tag %q.
+Code, identifiers, proper names and quoted text may stay in their original language.
+- Pass: the response is written in that language.
+- Fail: the response, or a substantial part of it, is written in another language.
+Score 1 for a response entirely in that language and 0 for a response entirely in other languages.
+Response:
+%s`
+
+// Language is a judge that evaluates whether responses are written in the
+// expected language, e.g. to check agents configured with blades.WithLanguage.
+type Language struct {
+	tag      string
+	criteria *Criteria
+}
+
+// NewLanguage creates a Language evaluator for the BCP-47 tag; opts configure the judge agent.
+func NewLanguage(name, tag string, opts ...blades.AgentOption) (*Language, error) {
+	criteria, err := NewCriteria(name, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Language{tag: tag, criteria: criteria}, nil
+}
+
+// Evaluate evaluates whether the response is written in the expected language.
+func (l *Language) Evaluate(ctx context.Context, message *blades.Message) (*Evaluation, error) {
+	return l.criteria.Evaluate(ctx, blades.UserMessage(fmt.Sprintf(languagePrompt, l.tag, message.Text())))
+}
@@ -0,0 +1,104 @@
+package evaluate
+
+import (
+	"context"
+
+	"github.com/go-kratos/blades"
+)
+
+// Case is a single evaluation case.
+type Case struct {
+	Name  string
+	Input *blades.Message
+}
+
+// Result is the outcome of running and evaluating a Case.
+type Result struct {
+	Case       Case
+	Output     *blades.Message
+	Evaluation *Evaluation
+	// InstructionVersion, Experiment and Variant are read from the output,
+	// so that results can be compared across versions and variants.
+	InstructionVersion string
+	Experiment         string
+	Variant            string
+	// Confidence is the confidence of the agent in the output, estimated
+	// with the method ConfidenceMethod, which is empty if it was not; see
+	// blades.WithConfidence.
+	Confidence       float64
+	ConfidenceMethod string
+}
+
+// RunnerOption configures a Runner.
+type RunnerOption func(*Runner)
+
+// WithEvaluator sets the evaluator applied to the output of every case.
+func WithEvaluator(evaluator Evaluator) RunnerOption {
+	return func(r *Runner) {
+		r.evaluator = evaluator
+	}
+}
+
+// WithSeed sets the sampling seed propagated to every model request of every
+// case, including the evaluator's, so that runs are as reproducible as the
+// providers allow.
+func WithSeed(seed int64) RunnerOption {
+	return func(r *Runner) {
+		r.modelOptions = append(r.modelOptions, blades.Seed(seed))
+	}
+}
+
+// WithModelOptions sets model options propagated to every case.
+func WithModelOptions(opts ...blades.ModelOption) RunnerOption {
+	return func(r *Runner) {
+		r.modelOptions = append(r.modelOptions, opts...)
+	}
+}
+
+// Runner runs an agent over a set of evaluation cases.
+type Runner struct {
+	runner       *blades.Runner
+	evaluator    Evaluator
+	modelOptions []blades.ModelOption
+}
+
+// NewRunner creates a Runner for the given agent.
+func NewRunner(agent blades.Agent, opts ...RunnerOption) *Runner {
+	r := &Runner{runner: blades.NewRunner(agent)}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Run runs every case in its own session and evaluates the output.
+// It stops at the first error.
+func (r *Runner) Run(ctx context.Context, cases ...Case) ([]*Result, error) {
+	if len(r.modelOptions) > 0 {
+		ctx = blades.NewModelOptionsContext(ctx, r.modelOptions...)
+	}
+	results := make([]*Result, 0, len(cases))
+	for _, c := range cases {
+		output, err := r.runner.Run(ctx, c.Input.Clone())
+		if err != nil {
+			return results, err
+		}
+		result := &Result{Case: c, Output: output}
+		result.InstructionVersion, _ = output.Metadata[blades.InstructionVersionKey].(string)
+		result.Experiment, _ = output.Metadata[blades.ExperimentKey].(string)
+		result.Variant, _ = output.Metadata[blades.VariantKey].(string)
+		if confidence, ok := output.Metadata[blades.ConfidenceKey].(float64); ok {
+			result.Confidence = confidence
+			result.ConfidenceMethod, _ = output.Metadata[blades.ConfidenceMethodKey].(string)
+		}
+		if r.evaluator != nil {
+			evaluation, err := r.evaluator.Evaluate(ctx, output)
+			if err != nil {
+				return results, err
+			}
+			result.Evaluation = evaluation
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
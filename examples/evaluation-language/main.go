@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"log"
+	"os"
+
+	"github.com/go-kratos/blades"
+	"github.com/go-kratos/blades/contrib/openai"
+	"github.com/go-kratos/blades/evaluate"
+)
+
+// cases.json lists conversations and the language every response must be in.
+//
+//go:embed cases.json
+var casesJSON []byte
+
+type languageCase struct {
+	Name     string   `json:"name"`
+	Language string   `json:"language"`
+	Turns    []string `json:"turns"`
+}
+
+func main() {
+	model := openai.NewModel(os.Getenv("OPENAI_MODEL"), openai.Config{
+		APIKey: os.Getenv("OPENAI_API_KEY"),
+	})
+	var cases []languageCase
+	if err := json.Unmarshal(casesJSON, &cases); err != nil {
+		log.Fatal(err)
+	}
+	ctx := context.Background()
+	failed := 0
+	for _, c := range cases {
+		agent, err := blades.NewAgent(
+			"Assistant",
+			blades.WithModel(model),
+			blades.WithInstruction("You are a helpful assistant."),
+			blades.WithLanguage(c.Language),
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+		judge, err := evaluate.NewLanguage("Language Judge", c.Language, blades.WithModel(model))
+		if err != nil {
+			log.Fatal(err)
+		}
+		runner := blades.NewRunner(agent)
+		session := blades.NewSession()
+		for i, turn := range c.Turns {
+			output, err := runner.Run(ctx, blades.UserMessage(turn), blades.WithSession(session))
+			if err != nil {
+				log.Fatal(err)
+			}
+			evaluation, err := judge.Evaluate(ctx, output)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if !evaluation.Pass {
+				failed++
+			}
+			log.Printf("%s turn %d (%s): pass=%t score=%.2f", c.Name, i+1, c.Language, evaluation.Pass, evaluation.Score)
+		}
+	}
+	if failed > 0 {
+		log.Fatalf("%d responses were not in the requested language", failed)
+	}
+}
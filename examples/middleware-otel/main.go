@@ -36,10 +36,14 @@ func main() {
 			sdktrace.WithResource(resource),
 		),
 	)
-	// Create a blades agent with OpenTelemetry middleware
-	model := openai.NewModel(os.Getenv("OPENAI_MODEL"), openai.Config{
-		APIKey: os.Getenv("OPENAI_API_KEY"),
-	})
+	// Create a blades agent with OpenTelemetry middleware; the model is wrapped
+	// as well, so every model call gets its own chat span.
+	model := blades.WrapModel(
+		openai.NewModel(os.Getenv("OPENAI_MODEL"), openai.Config{
+			APIKey: os.Getenv("OPENAI_API_KEY"),
+		}),
+		middleware.ModelTracing(),
+	)
 	agent, err := blades.NewAgent(
 		"OpenTelemetry Agent",
 		blades.WithMiddleware(
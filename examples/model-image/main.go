@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
 
 	"github.com/go-kratos/blades"
@@ -14,7 +16,8 @@ import (
 func main() {
 	model := openai.NewImage(
 		"gpt-image-1",
-		openai.ImageConfig{Size: "1024x1024", OutputFormat: "png"},
+		// Partial images stream low-resolution previews while the image renders.
+		openai.ImageConfig{Size: "1024x1024", OutputFormat: "png", PartialImages: 2},
 	)
 	agent, err := blades.NewAgent(
 		"Image Agent",
@@ -23,18 +26,39 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	runner := blades.NewRunner(agent)
-	output, err := runner.Run(
-		context.Background(),
-		blades.UserMessage("A watercolor illustration of a mountain cabin at sunrise"),
-	)
-	if err != nil {
-		log.Fatalf("generate image: %v", err)
-	}
 	outputDir := "generated"
 	if err := os.MkdirAll(outputDir, 0o755); err != nil {
 		log.Fatalf("create output dir: %v", err)
 	}
+	// Cancelling the context, e.g. with Ctrl+C, aborts the generation.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	runner := blades.NewRunner(agent)
+	var output *blades.Message
+	stream := runner.RunStream(ctx, blades.UserMessage("A watercolor illustration of a mountain cabin at sunrise"))
+	for message, err := range stream {
+		switch {
+		case errors.Is(err, openai.ErrContentPolicy):
+			log.Fatalf("prompt rejected by the content policy: %v", err)
+		case errors.Is(err, openai.ErrTransient):
+			log.Fatalf("temporary failure, try again later: %v", err)
+		case err != nil:
+			log.Fatalf("generate image: %v", err)
+		}
+		if data := message.Data(); data != nil && data.Preview {
+			// Overwrite the same file so an image viewer shows the progress.
+			path := filepath.Join(outputDir, "preview."+data.MIMEType.Format())
+			if err := os.WriteFile(path, data.Bytes, 0o644); err != nil {
+				log.Fatalf("write file %s: %v", path, err)
+			}
+			log.Printf("preview updated: %s", path)
+			continue
+		}
+		output = message
+	}
+	if output == nil {
+		log.Fatal("generate image: no result")
+	}
 	saved := 0
 	for _, part := range output.Parts {
 		switch img := part.(type) {
@@ -4,28 +4,11 @@ import (
 	"context"
 	"log"
 	"os"
-	"strings"
-	"text/template"
 
 	"github.com/go-kratos/blades"
 	"github.com/go-kratos/blades/contrib/openai"
 )
 
-func buildPrompt(params map[string]any) (string, error) {
-	var (
-		tmpl = "Respond concisely and accurately for a {{.audience}} audience."
-		buf  strings.Builder
-	)
-	t, err := template.New("message").Parse(tmpl)
-	if err != nil {
-		return "", err
-	}
-	if err := t.Execute(&buf, params); err != nil {
-		return "", err
-	}
-	return buf.String(), nil
-}
-
 func main() {
 	// Initialize the agent with a template
 	model := openai.NewModel(os.Getenv("OPENAI_MODEL"), openai.Config{
@@ -47,12 +30,13 @@ func main() {
 	}
 
 	// Build prompt using the template builder
-	// Note: Use exported methods when calling from another package.
-	prompt, err := buildPrompt(params)
+	messages, err := blades.NewPromptTemplate().
+		User("Respond concisely and accurately for a {{.audience}} audience.").
+		Build(params)
 	if err != nil {
 		log.Fatal(err)
 	}
-	input := blades.UserMessage(prompt)
+	input := messages[0]
 	// Run the agent with the templated prompt
 	runner := blades.NewRunner(agent)
 	output, err := runner.Run(context.Background(), input)
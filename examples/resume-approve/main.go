@@ -47,13 +47,16 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	sequentialAgent := flow.NewSequentialAgent(flow.SequentialConfig{
+	sequentialAgent, err := flow.NewSequentialAgent(flow.SequentialConfig{
 		Name: "WritingReviewFlow",
 		SubAgents: []blades.Agent{
 			writerAgent,
 			reviewerAgent,
 		},
 	})
+	if err != nil {
+		log.Fatal(err)
+	}
 	input := blades.UserMessage("Please write a short paragraph about climate change.")
 	ctx := context.Background()
 	session := blades.NewSession()
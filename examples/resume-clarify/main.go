@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"log"
+	"os"
+
+	"github.com/go-kratos/blades"
+	"github.com/go-kratos/blades/contrib/openai"
+	"github.com/go-kratos/blades/flow"
+)
+
+func main() {
+	model := openai.NewModel(os.Getenv("OPENAI_MODEL"), openai.Config{
+		APIKey: os.Getenv("OPENAI_API_KEY"),
+	})
+	askUser, err := blades.NewAskUserTool()
+	if err != nil {
+		log.Fatal(err)
+	}
+	plannerAgent, err := blades.NewAgent(
+		"PlannerAgent",
+		blades.WithModel(model),
+		blades.WithInstruction("Plan the deployment the user asks for. If the target region is not given, ask the user for it."),
+		blades.WithTools(askUser),
+		blades.WithOutputKey("plan"),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	writerAgent, err := blades.NewAgent(
+		"WriterAgent",
+		blades.WithModel(model),
+		blades.WithInstruction(`Write the runbook of the deployment plan.
+			Plan: {{.plan}}`),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sequentialAgent, err := flow.NewSequentialAgent(flow.SequentialConfig{
+		Name:      "DeploymentFlow",
+		SubAgents: []blades.Agent{plannerAgent, writerAgent},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx := context.Background()
+	session := blades.NewSession()
+	invocationID := "invocation-001"
+	runner := blades.NewRunner(sequentialAgent, blades.WithResumable(true))
+	output, err := runner.Run(
+		ctx,
+		blades.UserMessage("Deploy the billing service."),
+		blades.WithSession(session),
+		blades.WithInvocationID(invocationID),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// The flow pauses while the planner waits for the answer of the user.
+	answers := bufio.NewScanner(os.Stdin)
+	for output.Status == blades.StatusNeedsInput {
+		log.Println(output.Author, "asks:", output.Text())
+		if !answers.Scan() {
+			log.Fatal("no answer")
+		}
+		output, err = runner.Run(
+			ctx,
+			blades.UserMessage(answers.Text()),
+			blades.WithSession(session),
+			blades.WithInvocationID(invocationID),
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	log.Println(output.Author, output.Text())
+}
@@ -22,15 +22,17 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	// The runner is safe for concurrent use and shared by all requests. Inputs
+	// over 32k characters are rejected, which HTTPStatus maps to 413.
+	runner := blades.NewRunner(agent, blades.WithInputLimits(32000, 0, 0))
 	// Set up HTTP handler
 	mux := http.NewServeMux()
 	mux.HandleFunc("/generate", func(w http.ResponseWriter, r *http.Request) {
 		r.ParseForm()
-		runner := blades.NewRunner(agent)
 		input := blades.UserMessage(r.FormValue("input"))
 		output, err := runner.Run(r.Context(), input)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, err.Error(), blades.HTTPStatus(err))
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/go-kratos/kratos/v2"
+	"github.com/go-kratos/kratos/v2/config"
+	"github.com/go-kratos/kratos/v2/config/file"
+	klog "github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware/logging"
+	"github.com/go-kratos/kratos/v2/middleware/recovery"
+	"github.com/go-kratos/kratos/v2/transport/http"
+
+	"github.com/go-kratos/blades"
+	bladesconfig "github.com/go-kratos/blades/config"
+	bladeskratos "github.com/go-kratos/blades/contrib/kratos"
+	"github.com/go-kratos/blades/contrib/openai"
+)
+
+func main() {
+	logger := klog.NewStdLogger(os.Stdout)
+	// Agents are defined in the config and rebuilt when the file changes.
+	c := config.New(config.WithSource(file.NewSource("configs")))
+	if err := c.Load(); err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+	registry := bladesconfig.NewRegistry()
+	registry.RegisterProvider("openai", func(spec bladesconfig.ModelSpec) (blades.ModelProvider, error) {
+		apiKey := spec.APIKey
+		if apiKey == "" {
+			apiKey = os.Getenv("OPENAI_API_KEY")
+		}
+		return openai.NewModel(spec.Model, openai.Config{APIKey: apiKey, BaseURL: spec.BaseURL}), nil
+	})
+	agent, err := bladeskratos.LoadAgent(c, "blades", registry)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// The kratos middlewares wrap the chat completions endpoint like any other.
+	srv := http.NewServer(
+		http.Address(":8000"),
+		http.Middleware(recovery.Recovery(), logging.Server(logger)),
+	)
+	bladeskratos.RegisterHTTPServer(srv, agent,
+		bladeskratos.WithRunnerOptions(blades.WithInputLimits(32000, 0, 0)),
+	)
+	app := kratos.New(
+		kratos.Name("blades-agent"),
+		kratos.Logger(logger),
+		kratos.Server(srv),
+	)
+	// curl localhost:8000/v1/chat/completions -H 'Content-Type: application/json' \
+	//   -d '{"messages":[{"role":"user","content":"Hello"}]}'
+	if err := app.Run(); err != nil {
+		log.Fatal(err)
+	}
+}
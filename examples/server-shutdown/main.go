@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/go-kratos/blades"
+	"github.com/go-kratos/blades/contrib/openai"
+)
+
+func main() {
+	model := openai.NewModel(os.Getenv("OPENAI_MODEL"), openai.Config{
+		APIKey: os.Getenv("OPENAI_API_KEY"),
+	})
+	agent, err := blades.NewAgent(
+		"Server Agent",
+		blades.WithModel(model),
+		blades.WithInstruction("You are a helpful assistant that provides detailed and accurate information."),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// A single runner serves every request, so it can drain them all on shutdown.
+	runner := blades.NewRunner(agent, blades.WithResumable(true))
+	sessions := blades.NewInMemorySessionStore()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/generate", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		session := blades.NewSession()
+		output, err := runner.Run(r.Context(), blades.UserMessage(r.FormValue("input")), blades.WithSession(session))
+		if err != nil {
+			http.Error(w, err.Error(), blades.HTTPStatus(err))
+			return
+		}
+		sessions.Save(r.Context(), session)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(output)
+	})
+	server := &http.Server{Addr: ":8000", Handler: mux}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	// Kubernetes sends SIGTERM and kills the pod after terminationGracePeriodSeconds.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	log.Println("shutting down")
+
+	shutdown, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	// Runs still going after the grace period are checkpointed and cancelled,
+	// which ends the requests waiting for them.
+	if err := runner.Drain(shutdown, blades.WithGracePeriod(20*time.Second), blades.WithCheckpointStore(sessions)); err != nil {
+		log.Println("drain:", err)
+	}
+	if err := server.Shutdown(shutdown); err != nil {
+		log.Println("shutdown:", err)
+	}
+}
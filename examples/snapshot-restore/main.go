@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/go-kratos/blades"
+	"github.com/go-kratos/blades/contrib/openai"
+	"github.com/go-kratos/blades/flow"
+	"github.com/go-kratos/blades/stream"
+)
+
+var errPaused = errors.New("paused before the review")
+
+// breakpoint stops the run before the agent calls its model.
+func breakpoint() blades.Middleware {
+	return func(next blades.Handler) blades.Handler {
+		return blades.HandleFunc(func(ctx context.Context, invocation *blades.Invocation) blades.Generator[*blades.Message, error] {
+			return stream.Error[*blades.Message](errPaused)
+		})
+	}
+}
+
+// newFlow builds the writing flow with the given reviewer.
+func newFlow(model blades.ModelProvider, reviewer blades.Agent) blades.Agent {
+	writerAgent, err := blades.NewAgent(
+		"WriterAgent",
+		blades.WithModel(model),
+		blades.WithInstruction("Draft a short paragraph on climate change."),
+		blades.WithOutputKey("draft"),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	editorAgent, err := blades.NewAgent(
+		"EditorAgent",
+		blades.WithModel(model),
+		blades.WithInstruction(`Tighten the wording of the draft.
+			Draft: {{.draft}}`),
+		blades.WithOutputKey("edited"),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sequentialAgent, err := flow.NewSequentialAgent(flow.SequentialConfig{
+		Name:      "WritingReviewFlow",
+		SubAgents: []blades.Agent{writerAgent, editorAgent, reviewer},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	return sequentialAgent
+}
+
+func main() {
+	model := openai.NewModel(os.Getenv("OPENAI_MODEL"), openai.Config{
+		APIKey: os.Getenv("OPENAI_API_KEY"),
+	})
+	input := blades.UserMessage("Please write a short paragraph about climate change.")
+	invocationID := "invocation-001"
+	ctx := context.Background()
+
+	// First run: pause after the editor, before the reviewer.
+	reviewerAgent, err := blades.NewAgent(
+		"ReviewerAgent",
+		blades.WithModel(model),
+		blades.WithInstruction(`Review the text and suggest improvements.
+			Text: {{.edited}}`),
+		blades.WithMiddleware(breakpoint()),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	session := blades.NewSession()
+	runner := blades.NewRunner(newFlow(model, reviewerAgent))
+	if _, err := runner.Run(ctx, input, blades.WithSession(session), blades.WithInvocationID(invocationID)); !errors.Is(err, errPaused) {
+		log.Fatal(err)
+	}
+	data, err := blades.Snapshot(session, invocationID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	path := filepath.Join(os.TempDir(), "blades-snapshot.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("snapshot saved to", path)
+
+	// Later, possibly in another process: tweak the reviewer and resume.
+	// The writer and editor are replayed from the snapshot, not run again.
+	reviewerAgent, err = blades.NewAgent(
+		"ReviewerAgent",
+		blades.WithModel(model),
+		blades.WithInstruction(`Review the text strictly, listing at most three concrete fixes.
+			Text: {{.edited}}`),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	resumed := newFlow(model, reviewerAgent)
+	data, err = os.ReadFile(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	restored, err := blades.Restore(data, blades.WithRestoreAgent(resumed))
+	if err != nil {
+		log.Fatal(err)
+	}
+	resumeRunner := blades.NewRunner(resumed, blades.WithResumable(true))
+	output, err := resumeRunner.Run(ctx, input, blades.WithSession(restored), blades.WithInvocationID(invocationID))
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Println("final answer:", output.Text())
+}
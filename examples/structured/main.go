@@ -7,7 +7,6 @@ import (
 
 	"github.com/go-kratos/blades"
 	"github.com/go-kratos/blades/contrib/openai"
-	"github.com/google/jsonschema-go/jsonschema"
 )
 
 // ActorsFilms represents an actor and their associated films.
@@ -17,27 +16,25 @@ type ActorsFilms struct {
 }
 
 func main() {
-	schema, err := jsonschema.For[ActorsFilms](nil)
-	if err != nil {
-		panic(err)
-	}
 	model := openai.NewModel(os.Getenv("OPENAI_MODEL"), openai.Config{
 		APIKey: os.Getenv("OPENAI_API_KEY"),
 	})
 	agent, err := blades.NewAgent(
 		"filmography",
 		blades.WithModel(model),
-		blades.WithOutputSchema(schema),
 	)
 	if err != nil {
 		log.Fatal(err)
 	}
-
+	// The runner asks the model for the schema of ActorsFilms and parses its answer.
+	structured, err := blades.NewStructured[ActorsFilms](blades.NewRunner(agent))
+	if err != nil {
+		log.Fatal(err)
+	}
 	input := blades.UserMessage("Generate the filmography of 5 movies for Tom Hanks")
-	runner := blades.NewRunner(agent)
-	actorsFilms, err := runner.Run(context.Background(), input)
+	actorsFilms, err := structured.Run(context.Background(), input)
 	if err != nil {
 		log.Fatal(err)
 	}
-	log.Println(actorsFilms)
+	log.Printf("%s: %v", actorsFilms.Actor, actorsFilms.Movies)
 }
@@ -27,7 +27,7 @@ func weatherHandle(ctx context.Context, req WeatherReq) (WeatherRes, error) {
 	if !ok {
 		return WeatherRes{}, blades.ErrNoSessionContext
 	}
-	session.SetState("location", req.Location)
+	session.PutState(ctx, "location", req.Location)
 	return WeatherRes{Forecast: "Sunny, 25°C"}, nil
 }
 
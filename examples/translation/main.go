@@ -45,19 +45,13 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	var (
-		input  = blades.UserMessage(string(content))
-		output *blades.Message
-	)
-	for _, agent := range []blades.Agent{tr, refine} {
-		runner := blades.NewRunner(agent)
-		output, err = runner.Run(context.Background(), input)
-		if err != nil {
-			log.Fatal(err)
-		}
-		input = output
+	// The translation runs to completion before the refine agent polishes it.
+	runner := blades.NewRunner(blades.Pipe(tr, refine))
+	result, err := runner.Run(context.Background(), blades.UserMessage(string(content)))
+	if err != nil {
+		log.Fatal(err)
 	}
-	if err := os.WriteFile(output.Text(), []byte(output.Text()), 0644); err != nil {
+	if err := os.WriteFile(output, []byte(result.Text()), 0644); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -46,7 +46,7 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	loopAgent := flow.NewLoopAgent(flow.LoopConfig{
+	loopAgent, err := flow.NewLoopAgent(flow.LoopConfig{
 		Name:          "WritingReviewFlow",
 		Description:   "An agent that loops between writing and reviewing until the draft is good.",
 		MaxIterations: 3,
@@ -58,6 +58,9 @@ func main() {
 			reviewerAgent,
 		},
 	})
+	if err != nil {
+		log.Fatal(err)
+	}
 	input := blades.UserMessage("Please write a short paragraph about climate change.")
 	runner := blades.NewRunner(loopAgent)
 	stream := runner.RunStream(context.Background(), input)
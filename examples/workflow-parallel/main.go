@@ -36,7 +36,7 @@ func main() {
 		log.Fatal(err)
 	}
 	editorAgent2, err := blades.NewAgent(
-		"editorAgent1",
+		"editorAgent2",
 		blades.WithModel(model),
 		blades.WithInstruction(`Edit the paragraph for style.
 			**Paragraph:**
@@ -64,7 +64,7 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	parallelAgent := flow.NewParallelAgent(flow.ParallelConfig{
+	parallelAgent, err := flow.NewParallelAgent(flow.ParallelConfig{
 		Name:        "EditorParallelAgent",
 		Description: "Edits the drafted paragraph in parallel for grammar and style.",
 		SubAgents: []blades.Agent{
@@ -72,7 +72,10 @@ func main() {
 			editorAgent2,
 		},
 	})
-	sequentialAgent := flow.NewSequentialAgent(flow.SequentialConfig{
+	if err != nil {
+		log.Fatal(err)
+	}
+	sequentialAgent, err := flow.NewSequentialAgent(flow.SequentialConfig{
 		Name:        "WritingSequenceAgent",
 		Description: "Drafts, edits, and reviews a paragraph about climate change.",
 		SubAgents: []blades.Agent{
@@ -81,6 +84,9 @@ func main() {
 			reviewerAgent,
 		},
 	})
+	if err != nil {
+		log.Fatal(err)
+	}
 	session := blades.NewSession()
 	input := blades.UserMessage("Please write a short paragraph about climate change.")
 	// Run the sequential agent with streaming
@@ -95,6 +101,11 @@ func main() {
 		if message.Status != blades.StatusCompleted {
 			continue
 		}
+		// The reviewer's answer is final; the draft and edits are intermediate.
+		if message.Final {
+			log.Println("final answer:", message.Text())
+			continue
+		}
 		log.Println(message.Author, message.Text())
 	}
 }
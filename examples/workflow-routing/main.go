@@ -3,13 +3,16 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"log"
+	"maps"
 	"os"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/go-kratos/blades"
 	"github.com/go-kratos/blades/contrib/openai"
+	"github.com/go-kratos/blades/flow"
 )
 
 // RoutingWorkflow is a workflow that routes requests to different agents based on the content of the prompt.
@@ -54,13 +57,27 @@ func NewRoutingWorkflow(routes map[string]string) (*RoutingWorkflow, error) {
 // Run selects a route using the prompt content and streams from the chosen runner.
 func (r *RoutingWorkflow) Run(ctx context.Context, invocation *blades.Invocation) blades.Generator[*blades.Message, error] {
 	return func(yield func(*blades.Message, error) bool) {
+		started := time.Now()
 		agent, err := r.selectRoute(ctx, invocation)
+		record := flow.RoutingRecord{
+			InvocationID: invocation.ID,
+			Router:       r.Name(),
+			Candidates:   slices.Sorted(maps.Keys(r.agents)),
+			Latency:      time.Since(started),
+		}
 		if err != nil {
+			record.Error = err.Error()
+			flow.RecordRouting(ctx, invocation.Session, record)
 			yield(nil, err)
 			return
 		}
+		record.Selected = agent.Name()
+		flow.RecordRouting(ctx, invocation.Session, record)
 		stream := agent.Run(ctx, invocation)
 		for msg, err := range stream {
+			if msg != nil && msg.Status == blades.StatusCompleted && msg.Metadata != nil {
+				msg.Metadata[flow.RoutingKey] = record
+			}
 			if !yield(msg, err) {
 				break
 			}
@@ -81,16 +98,17 @@ func (r *RoutingWorkflow) selectRoute(ctx context.Context, invocation *blades.In
 	}
 	buf.WriteString(string(routes))
 	buf.WriteString("\nOnly return the name of the routing key.")
+	var output string
 	for res, err := range r.Agent.Run(ctx, &blades.Invocation{Message: blades.UserMessage(buf.String())}) {
 		if err != nil {
 			return nil, err
 		}
-		choice := strings.TrimSpace(res.Text())
-		if a, ok := r.agents[choice]; ok {
+		output = strings.TrimSpace(res.Text())
+		if a, ok := r.agents[output]; ok {
 			return a, nil
 		}
 	}
-	return nil, fmt.Errorf("no route selected")
+	return nil, &flow.RouteError{Router: r.Name(), Output: output}
 }
 
 func main() {
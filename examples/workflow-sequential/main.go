@@ -32,7 +32,7 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	sequentialAgent := flow.NewSequentialAgent(flow.SequentialConfig{
+	sequentialAgent, err := flow.NewSequentialAgent(flow.SequentialConfig{
 		Name: "WritingReviewFlow",
 		SubAgents: []blades.Agent{
 			writerAgent,
@@ -49,6 +49,11 @@ func main() {
 		if err != nil {
 			log.Fatal(err)
 		}
+		// The reviewer's output is the final answer of the flow; the draft is intermediate.
+		if message.Final {
+			log.Println("final answer:", message.Text())
+			continue
+		}
 		log.Println(message.Author, message.Text())
 	}
 }
@@ -0,0 +1,164 @@
+package blades
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"slices"
+)
+
+const (
+	// InstructionVersionKey is the metadata key of the instruction version of
+	// the agent that wrote a message.
+	InstructionVersionKey = "instruction_version"
+	// ExperimentKey is the metadata key of the experiment a message was
+	// produced in; see ExperimentStateKey for the session state key of its variant.
+	ExperimentKey = "experiment"
+	// VariantKey is the metadata key of the experiment variant that produced a message.
+	VariantKey = "variant"
+)
+
+// ExperimentStateKey returns the session state key holding the variant the
+// session was assigned to in the experiment.
+func ExperimentStateKey(experiment string) string {
+	return "blades." + ExperimentKey + "." + experiment
+}
+
+// Assignment picks the variant of an experiment for a session.
+type Assignment func(ctx context.Context, session Session) string
+
+// AssignByHash returns the variant for the key, e.g. a session or user ID, so
+// that every variant gets a stable, equal fraction of the keys.
+func AssignByHash(key string, variants ...string) string {
+	if len(variants) == 0 {
+		return ""
+	}
+	variants = slices.Clone(variants)
+	slices.Sort(variants)
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return variants[h.Sum32()%uint32(len(variants))]
+}
+
+// experimentAgent routes every session to one variant of an experiment.
+type experimentAgent struct {
+	name     string
+	variants map[string]Agent
+	names    []string
+	assign   Assignment
+}
+
+// Experiment returns an agent that runs one of the variants for each session
+// and stamps the experiment and variant on the messages it produces. The
+// variant is picked by assign, by default AssignByHash of the session ID, and
+// recorded under ExperimentStateKey, so that a session keeps its variant even
+// if the assignment changes. An assignment that names no variant falls back to
+// the hash.
+func Experiment(name string, variants map[string]Agent, assign Assignment) (Agent, error) {
+	if len(variants) == 0 {
+		return nil, fmt.Errorf("experiment %s: %w", name, ErrNoVariants)
+	}
+	names := make([]string, 0, len(variants))
+	for variant := range variants {
+		names = append(names, variant)
+	}
+	slices.Sort(names)
+	return &experimentAgent{name: name, variants: variants, names: names, assign: assign}, nil
+}
+
+// Name returns the name of the experiment.
+func (a *experimentAgent) Name() string {
+	return a.name
+}
+
+// Description returns the description of the experiment.
+func (a *experimentAgent) Description() string {
+	return fmt.Sprintf("Experiment %s with the variants %v", a.name, a.names)
+}
+
+// SubAgents returns the variants, ordered by name.
+func (a *experimentAgent) SubAgents() []Agent {
+	agents := make([]Agent, 0, len(a.names))
+	for _, name := range a.names {
+		agents = append(agents, a.variants[name])
+	}
+	return agents
+}
+
+// Run runs the variant assigned to the session of the invocation.
+func (a *experimentAgent) Run(ctx context.Context, invocation *Invocation) Generator[*Message, error] {
+	ctx = NewPathContext(ctx, a.Name())
+	return PathErrors(ctx, func(yield func(*Message, error) bool) {
+		variant := a.variant(ctx, invocation.Session)
+		agent := a.variants[variant]
+		ctx := context.WithValue(ctx, ctxExperimentKey{}, experiment{name: a.name, variant: variant})
+		for message, err := range agent.Run(ctx, invocation.Child(agent.Name())) {
+			if !yield(message, err) {
+				return
+			}
+		}
+	})
+}
+
+// variant returns the variant recorded for the session, or assigns and records one.
+func (a *experimentAgent) variant(ctx context.Context, session Session) string {
+	if session == nil {
+		return a.pick(ctx, nil, "")
+	}
+	key := ExperimentStateKey(a.name)
+	if variant, ok := session.State()[key].(string); ok {
+		if _, ok := a.variants[variant]; ok {
+			return variant
+		}
+	}
+	// The variant is assigned once, even to concurrent runs of the session.
+	var variant string
+	UpdateState(ctx, session, key, func(current any) any {
+		if recorded, ok := current.(string); ok {
+			if _, ok := a.variants[recorded]; ok {
+				variant = recorded
+				return recorded
+			}
+		}
+		variant = a.pick(ctx, session, session.ID())
+		return variant
+	})
+	return variant
+}
+
+func (a *experimentAgent) pick(ctx context.Context, session Session, key string) string {
+	if a.assign != nil {
+		if variant := a.assign(ctx, session); a.variants[variant] != nil {
+			return variant
+		}
+	}
+	return AssignByHash(key, a.names...)
+}
+
+// experiment is the experiment and variant an agent runs in.
+type experiment struct {
+	name    string
+	variant string
+}
+
+// ctxExperimentKey is the context key for the experiment of a run.
+type ctxExperimentKey struct{}
+
+// stampVersion records the instruction version of the agent and the
+// experiment of the context on the message.
+func stampVersion(ctx context.Context, version string, message *Message) {
+	e, inExperiment := ctx.Value(ctxExperimentKey{}).(experiment)
+	if version == "" && !inExperiment {
+		return
+	}
+	if message.Metadata == nil {
+		message.Metadata = make(map[string]any)
+	}
+	if version != "" {
+		message.Metadata[InstructionVersionKey] = version
+	}
+	if inExperiment {
+		message.Metadata[ExperimentKey] = e.name
+		message.Metadata[VariantKey] = e.variant
+	}
+}
@@ -0,0 +1,149 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestExperiment(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "transcript.jsonl")
+	transcripts := NewJSONLTranscriptStore(path)
+	newVariant := func(name, instruction string, opts ...AgentOption) Agent {
+		opts = append(opts, WithModel(WrapModel(replyModel(name+": "), Audit(transcripts))), WithInstruction(instruction))
+		agent, err := NewAgent(name, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return agent
+	}
+	concise := newVariant("concise", "Answer briefly.")
+	detailed := newVariant("detailed", "Answer in detail.", WithInstructionsVersion("detailed-v2"))
+	if v := concise.(interface{ InstructionVersion() string }).InstructionVersion(); !strings.HasPrefix(v, "sha256:") || len(v) != 19 {
+		t.Fatalf("want a content hash version, got %q", v)
+	}
+	experiment, err := Experiment("tone", map[string]Agent{"a": concise, "b": detailed}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := NewRunner(experiment)
+
+	// Sessions keep their variant and split across both.
+	counts := map[string]int{}
+	feedback := NewInMemoryFeedbackStore()
+	for i := range 40 {
+		session := NewSession()
+		var variant string
+		for turn := range 2 {
+			id := fmt.Sprintf("inv-%d-%d", i, turn)
+			answer, err := runner.Run(context.Background(), UserMessage("hello"), WithSession(session), WithInvocationID(id))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := answer.Metadata[VariantKey].(string)
+			if turn > 0 && got != variant {
+				t.Fatalf("session %d: want variant %q kept, got %q", i, variant, got)
+			}
+			variant = got
+		}
+		if session.State()[ExperimentStateKey("tone")] != variant || variant != AssignByHash(session.ID(), "a", "b") {
+			t.Fatalf("want variant %q recorded, got state %v", variant, session.State())
+		}
+		counts[variant]++
+		f, err := runner.NewFeedback(session, fmt.Sprintf("inv-%d-1", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Rating = RatingPositive
+		feedback.Save(context.Background(), f)
+	}
+	if counts["a"] < 10 || counts["b"] < 10 {
+		t.Fatalf("want both variants assigned, got %v", counts)
+	}
+
+	detailedFeedback, err := QueryFeedback(context.Background(), feedback, FeedbackQuery{InstructionVersion: "detailed-v2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(detailedFeedback) != counts["b"] || detailedFeedback[0].Experiment != "tone" || detailedFeedback[0].Variant != "b" {
+		t.Fatalf("want the feedback of variant b, got %d of %d", len(detailedFeedback), counts["b"])
+	}
+
+	transcript, err := transcripts.Load(context.Background(), "inv-0-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := transcript.Entries[0]
+	if entry.Experiment != "tone" || entry.Variant == "" || entry.InstructionVersion == "" {
+		t.Fatalf("want the version and variant in the transcript, got %+v", entry)
+	}
+
+	// An assignment picks the variant of new sessions.
+	forced, err := Experiment("forced", map[string]Agent{"a": concise, "b": detailed}, func(ctx context.Context, session Session) string {
+		return "b"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	answer, err := NewRunner(forced).Run(context.Background(), UserMessage("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer.Text() != "detailed: hello" || answer.Metadata[InstructionVersionKey] != "detailed-v2" {
+		t.Fatalf("want the detailed variant, got %q with %v", answer.Text(), answer.Metadata)
+	}
+
+	if _, err := Experiment("empty", nil, nil); !errors.Is(err, ErrNoVariants) {
+		t.Fatalf("want ErrNoVariants, got %v", err)
+	}
+}
+
+func TestExperimentConcurrentAssignment(t *testing.T) {
+	variants := make(map[string]Agent)
+	for _, name := range []string{"a", "b"} {
+		agent, err := NewAgent(name, WithModel(replyModel(name+": ")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		variants[name] = agent
+	}
+	// Each call assigns the other variant, so concurrent first runs would
+	// disagree if the assignment were not atomic.
+	var calls atomic.Int64
+	experiment, err := Experiment("tone", variants, func(ctx context.Context, session Session) string {
+		n := calls.Add(1)
+		time.Sleep(10 * time.Millisecond)
+		return []string{"a", "b"}[n%2]
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := NewRunner(experiment)
+	session := NewSession()
+	got := make([]string, 8)
+	var wg sync.WaitGroup
+	for i := range got {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			answer, err := runner.Run(context.Background(), UserMessage("hi"), WithSession(session))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			got[i], _ = answer.Metadata[VariantKey].(string)
+		}()
+	}
+	wg.Wait()
+	for _, variant := range got {
+		if variant != got[0] || variant == "" {
+			t.Fatalf("want one variant for the session, got %v", got)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+// Package export writes recorded conversations as fine-tuning datasets.
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/go-kratos/blades"
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+// Format is the output format of an export.
+type Format string
+
+const (
+	// FormatOpenAIChat writes one {"messages":[...]} object per conversation,
+	// as expected by OpenAI chat fine-tuning.
+	FormatOpenAIChat Format = "openai_chat"
+	// FormatInstruction writes one {"instruction":...,"response":...} object
+	// per turn of a conversation.
+	FormatInstruction Format = "instruction"
+)
+
+// Option configures an Exporter.
+type Option func(*Exporter)
+
+// WithRating keeps only the conversations whose latest feedback has the rating.
+func WithRating(rating blades.Rating) Option {
+	return func(e *Exporter) {
+		e.rating = rating
+	}
+}
+
+// WithAgent keeps only the model calls of the named agent.
+func WithAgent(name string) Option {
+	return func(e *Exporter) {
+		e.agent = name
+	}
+}
+
+// WithTimeRange keeps only the conversations started in [since, until).
+// A zero bound is open.
+func WithTimeRange(since, until time.Time) Option {
+	return func(e *Exporter) {
+		e.since, e.until = since, until
+	}
+}
+
+// WithScrubber applies the scrubber to all exported text, tool arguments and
+// tool results, e.g. to remove personal data.
+func WithScrubber(scrubber blades.Scrubber) Option {
+	return func(e *Exporter) {
+		e.scrubbers = append(e.scrubbers, scrubber)
+	}
+}
+
+// WithToolCalls sets whether tool calls and results are exported in the
+// format of the provider. When disabled they are removed and only the text
+// of the conversation is kept. Enabled by default.
+func WithToolCalls(keep bool) Option {
+	return func(e *Exporter) {
+		e.toolCalls = keep
+	}
+}
+
+// Exporter writes the conversations recorded in a TranscriptStore, together
+// with the feedback given on them, as datasets.
+type Exporter struct {
+	transcripts blades.TranscriptStore
+	feedback    blades.FeedbackStore
+	rating      blades.Rating
+	agent       string
+	since       time.Time
+	until       time.Time
+	scrubbers   []blades.Scrubber
+	toolCalls   bool
+}
+
+// New creates an Exporter. The feedback store may be nil, in which case
+// rating filters match nothing and no corrections are applied.
+func New(transcripts blades.TranscriptStore, feedback blades.FeedbackStore, opts ...Option) *Exporter {
+	e := &Exporter{transcripts: transcripts, feedback: feedback, toolCalls: true}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Export writes the conversations of the invocations to w as JSON lines in the
+// format, and returns the number of records written. Without invocation IDs,
+// every invocation that received feedback is exported. Invocations are
+// written in ID order, one at a time, so large datasets are not held in
+// memory. A correction given as feedback replaces the final answer.
+func (e *Exporter) Export(ctx context.Context, w io.Writer, format Format, invocationIDs ...string) (int, error) {
+	if format != FormatOpenAIChat && format != FormatInstruction {
+		return 0, fmt.Errorf("export: unknown format %q", format)
+	}
+	feedback, err := e.latestFeedback(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if len(invocationIDs) == 0 {
+		for id := range feedback {
+			invocationIDs = append(invocationIDs, id)
+		}
+	}
+	ids := slices.Clone(invocationIDs)
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+	var (
+		enc     = json.NewEncoder(w)
+		written int
+	)
+	for _, id := range ids {
+		f, rated := feedback[id]
+		if e.rating != "" && (!rated || f.Rating != e.rating) {
+			continue
+		}
+		conversation, err := e.conversation(ctx, id)
+		if err != nil {
+			return written, err
+		}
+		if conversation == nil {
+			continue
+		}
+		if rated && f.Correction != "" {
+			conversation.correct(f.Correction)
+		}
+		records := e.records(format, conversation)
+		for _, record := range records {
+			if err := enc.Encode(record); err != nil {
+				return written, fmt.Errorf("export: %s: %w", id, err)
+			}
+			written++
+		}
+	}
+	return written, nil
+}
+
+// latestFeedback returns the latest feedback per invocation.
+func (e *Exporter) latestFeedback(ctx context.Context) (map[string]blades.Feedback, error) {
+	latest := make(map[string]blades.Feedback)
+	if e.feedback == nil {
+		return latest, nil
+	}
+	all, err := e.feedback.List(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("export: %w", err)
+	}
+	for _, f := range all {
+		if old, ok := latest[f.InvocationID]; !ok || !f.CreatedAt.Before(old.CreatedAt) {
+			latest[f.InvocationID] = f
+		}
+	}
+	return latest, nil
+}
+
+// conversation is the last model call of an invocation: the instruction, the
+// messages sent and the final answer.
+type conversation struct {
+	instruction *blades.Message
+	messages    []*blades.Message
+	tools       []blades.TranscriptTool
+}
+
+// correct replaces the final answer.
+func (c *conversation) correct(text string) {
+	answer := blades.AssistantMessage(text)
+	answer.Status = blades.StatusCompleted
+	c.messages[len(c.messages)-1] = answer
+}
+
+// conversation returns the conversation of the invocation, or nil if it does
+// not pass the filters or has no final answer.
+func (e *Exporter) conversation(ctx context.Context, invocationID string) (*conversation, error) {
+	transcript, err := e.transcripts.Load(ctx, invocationID)
+	if errors.Is(err, blades.ErrTranscriptNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("export: %w", err)
+	}
+	started := transcript.Entries[0].CreatedAt
+	if (!e.since.IsZero() && started.Before(e.since)) || (!e.until.IsZero() && !started.Before(e.until)) {
+		return nil, nil
+	}
+	for _, entry := range slices.Backward(transcript.Entries) {
+		if e.agent != "" && entry.Agent != e.agent {
+			continue
+		}
+		if entry.Response == nil || entry.Response.Role != blades.RoleAssistant || entry.Response.Status != blades.StatusCompleted {
+			continue
+		}
+		return &conversation{
+			instruction: entry.Request.Instruction,
+			messages:    append(slices.Clone(entry.Request.Messages), entry.Response),
+			tools:       entry.Request.Tools,
+		}, nil
+	}
+	return nil, nil
+}
+
+func (e *Exporter) scrub(s string) string {
+	for _, scrubber := range e.scrubbers {
+		s = scrubber(s)
+	}
+	return s
+}
+
+// text returns the scrubbed text of the message.
+func (e *Exporter) text(m *blades.Message) string {
+	if m == nil {
+		return ""
+	}
+	return e.scrub(m.Text())
+}
+
+func (e *Exporter) records(format Format, c *conversation) []any {
+	if format == FormatInstruction {
+		return e.instructionRecords(c)
+	}
+	return []any{e.chatRecord(c)}
+}
+
+// ChatRecord is a conversation in the OpenAI chat fine-tuning format.
+type ChatRecord struct {
+	Messages []ChatMessage `json:"messages"`
+	Tools    []ChatTool    `json:"tools,omitempty"`
+}
+
+// ChatMessage is a message of a ChatRecord.
+type ChatMessage struct {
+	Role       string         `json:"role"`
+	Content    string         `json:"content,omitempty"`
+	ToolCalls  []ChatToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string         `json:"tool_call_id,omitempty"`
+}
+
+// ChatToolCall is a tool call of an assistant ChatMessage.
+type ChatToolCall struct {
+	ID       string       `json:"id"`
+	Type     string       `json:"type"`
+	Function ChatFunction `json:"function"`
+}
+
+// ChatFunction is the function called by a ChatToolCall.
+type ChatFunction struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// ChatTool describes a tool offered in a ChatRecord.
+type ChatTool struct {
+	Type     string             `json:"type"`
+	Function ChatToolDefinition `json:"function"`
+}
+
+// ChatToolDefinition is the definition of the function of a ChatTool.
+type ChatToolDefinition struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description,omitempty"`
+	Parameters  *jsonschema.Schema `json:"parameters,omitempty"`
+}
+
+func (e *Exporter) chatRecord(c *conversation) ChatRecord {
+	var record ChatRecord
+	if text := e.text(c.instruction); text != "" {
+		record.Messages = append(record.Messages, ChatMessage{Role: "system", Content: text})
+	}
+	for _, m := range c.messages {
+		switch m.Role {
+		case blades.RoleSystem, blades.RoleDeveloper:
+			record.Messages = append(record.Messages, ChatMessage{Role: "system", Content: e.text(m)})
+		case blades.RoleUser:
+			record.Messages = append(record.Messages, ChatMessage{Role: "user", Content: e.text(m)})
+		case blades.RoleAssistant:
+			record.Messages = append(record.Messages, ChatMessage{Role: "assistant", Content: e.text(m)})
+		case blades.RoleTool:
+			record.Messages = append(record.Messages, e.toolMessages(m)...)
+		}
+	}
+	if e.toolCalls {
+		for _, tool := range c.tools {
+			record.Tools = append(record.Tools, ChatTool{
+				Type: "function",
+				Function: ChatToolDefinition{
+					Name:        tool.Name,
+					Description: tool.Description,
+					Parameters:  tool.InputSchema,
+				},
+			})
+		}
+	}
+	return record
+}
+
+// toolMessages converts a tool call message to an assistant message with
+// the calls followed by one tool message per result. Without tool calls,
+// only the text the model said alongside the calls is kept.
+func (e *Exporter) toolMessages(m *blades.Message) []ChatMessage {
+	call := ChatMessage{Role: "assistant", Content: e.text(m)}
+	var results []ChatMessage
+	if e.toolCalls {
+		for _, part := range m.Parts {
+			tool, ok := part.(blades.ToolPart)
+			if !ok {
+				continue
+			}
+			call.ToolCalls = append(call.ToolCalls, ChatToolCall{
+				ID:       tool.ID,
+				Type:     "function",
+				Function: ChatFunction{Name: tool.Name, Arguments: e.scrub(tool.Request)},
+			})
+			results = append(results, ChatMessage{Role: "tool", Content: e.scrub(tool.Response), ToolCallID: tool.ID})
+		}
+	}
+	if call.Content == "" && len(call.ToolCalls) == 0 {
+		return nil
+	}
+	return append([]ChatMessage{call}, results...)
+}
+
+// InstructionRecord is a turn in the generic instruction/response format.
+type InstructionRecord struct {
+	System      string `json:"system,omitempty"`
+	Instruction string `json:"instruction"`
+	Response    string `json:"response"`
+}
+
+// instructionRecords returns one record per user turn that has an answer,
+// leaving out the tool calls in between.
+func (e *Exporter) instructionRecords(c *conversation) []any {
+	var (
+		records []any
+		current *InstructionRecord
+	)
+	system := e.text(c.instruction)
+	for _, m := range c.messages {
+		switch m.Role {
+		case blades.RoleUser:
+			if current != nil && current.Response != "" {
+				records = append(records, *current)
+			}
+			current = &InstructionRecord{System: system, Instruction: e.text(m)}
+		case blades.RoleAssistant:
+			if current != nil {
+				current.Response = e.text(m)
+			}
+		}
+	}
+	if current != nil && current.Response != "" {
+		records = append(records, *current)
+	}
+	return records
+}
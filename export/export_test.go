@@ -0,0 +1,148 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/blades"
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+var start = time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func message(role blades.Role, status blades.Status, parts ...blades.Part) *blades.Message {
+	return &blades.Message{Role: role, Status: status, Parts: parts}
+}
+
+func text(role blades.Role, s string) *blades.Message {
+	return message(role, blades.StatusCompleted, blades.TextPart{Text: s})
+}
+
+// newStores records a tool-use conversation, a multi-turn conversation with
+// a correction, and a conversation without feedback.
+func newStores(t *testing.T) (blades.TranscriptStore, blades.FeedbackStore) {
+	t.Helper()
+	ctx := context.Background()
+	transcripts := blades.NewJSONLTranscriptStore(filepath.Join(t.TempDir(), "transcripts.jsonl"))
+	instruction := text(blades.RoleSystem, "You are a helpful assistant.")
+	weather := blades.TranscriptTool{
+		Name:        "weather",
+		Description: "Returns the weather of a city.",
+		InputSchema: &jsonschema.Schema{Type: "object", Properties: map[string]*jsonschema.Schema{"city": {Type: "string"}}},
+	}
+	question := text(blades.RoleUser, "What is the weather in Paris? Mail it to ann@example.com")
+	call := message(blades.RoleTool, blades.StatusCompleted, blades.ToolPart{ID: "call_1", Name: "weather", Request: `{"city":"Paris"}`})
+	result := message(blades.RoleTool, blades.StatusCompleted, blades.ToolPart{ID: "call_1", Name: "weather", Request: `{"city":"Paris"}`, Response: "sunny, 21C"})
+	entries := []blades.TranscriptEntry{
+		{
+			InvocationID: "inv-1", Agent: "assistant", CreatedAt: start,
+			Request:  blades.TranscriptRequest{Instruction: instruction, Messages: []*blades.Message{question}, Tools: []blades.TranscriptTool{weather}},
+			Response: call,
+		},
+		{
+			InvocationID: "inv-1", Agent: "assistant", CreatedAt: start.Add(time.Second),
+			Request:  blades.TranscriptRequest{Instruction: instruction, Messages: []*blades.Message{question, result}, Tools: []blades.TranscriptTool{weather}},
+			Response: text(blades.RoleAssistant, "It is sunny and 21C in Paris."),
+		},
+		{
+			InvocationID: "inv-2", Agent: "assistant", CreatedAt: start.Add(time.Hour),
+			Request: blades.TranscriptRequest{Instruction: instruction, Messages: []*blades.Message{
+				text(blades.RoleUser, "Hi!"),
+				text(blades.RoleAssistant, "Hello! How can I help?"),
+				text(blades.RoleUser, "What is 2+2?"),
+			}},
+			Response: text(blades.RoleAssistant, "5"),
+		},
+		{
+			InvocationID: "inv-3", Agent: "other", CreatedAt: start.Add(2 * time.Hour),
+			Request:  blades.TranscriptRequest{Messages: []*blades.Message{text(blades.RoleUser, "Ping")}},
+			Response: text(blades.RoleAssistant, "Pong"),
+		},
+	}
+	for _, entry := range entries {
+		if err := transcripts.Append(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	feedback := blades.NewInMemoryFeedbackStore()
+	for _, f := range []blades.Feedback{
+		{ID: "f1", InvocationID: "inv-1", Rating: blades.RatingPositive, CreatedAt: start},
+		{ID: "f2", InvocationID: "inv-2", Rating: blades.RatingNegative, Correction: "4", CreatedAt: start},
+	} {
+		if err := feedback.Save(ctx, f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return transcripts, feedback
+}
+
+func TestExportGolden(t *testing.T) {
+	email := blades.RegexpScrubber(regexp.MustCompile(`[\w.]+@[\w.]+`))
+	tests := []struct {
+		golden string
+		format Format
+		opts   []Option
+	}{
+		{"openai_chat.jsonl", FormatOpenAIChat, []Option{WithScrubber(email)}},
+		{"openai_chat_no_tools.jsonl", FormatOpenAIChat, []Option{WithToolCalls(false)}},
+		{"instruction.jsonl", FormatInstruction, []Option{WithScrubber(email)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			transcripts, feedback := newStores(t)
+			var buf bytes.Buffer
+			if _, err := New(transcripts, feedback, tt.opts...).Export(context.Background(), &buf, tt.format); err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join("testdata", tt.golden)
+			if *update {
+				if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Fatalf("output differs from %s:\n%s", path, buf.String())
+			}
+		})
+	}
+}
+
+func TestExportFilters(t *testing.T) {
+	tests := []struct {
+		name string
+		ids  []string
+		opts []Option
+		want int
+	}{
+		{"rated", nil, nil, 2},
+		{"explicit ids", []string{"inv-3", "inv-1", "inv-3"}, nil, 2},
+		{"thumbs up", nil, []Option{WithRating(blades.RatingPositive)}, 1},
+		{"agent", []string{"inv-1", "inv-2", "inv-3"}, []Option{WithAgent("other")}, 1},
+		{"time range", []string{"inv-1", "inv-2", "inv-3"}, []Option{WithTimeRange(start.Add(time.Minute), start.Add(2*time.Hour))}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transcripts, feedback := newStores(t)
+			var buf bytes.Buffer
+			n, err := New(transcripts, feedback, tt.opts...).Export(context.Background(), &buf, FormatOpenAIChat, tt.ids...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != tt.want || bytes.Count(buf.Bytes(), []byte("\n")) != tt.want {
+				t.Fatalf("want %d records, got %d:\n%s", tt.want, n, buf.String())
+			}
+		})
+	}
+}
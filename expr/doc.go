@@ -0,0 +1,47 @@
+// Package expr implements a small, sandboxed expression language for
+// conditions defined outside Go code, such as the edges of a graph or the
+// condition of a loop flow loaded from a YAML config:
+//
+//	state.revision < 3 && !contains(state.draft, 'TODO')
+//
+// Expressions only read the variables they are given and call a fixed set of
+// functions; they cannot assign, loop or call into Go.
+//
+// # Grammar
+//
+//	expression = or .
+//	or         = and { "||" and } .
+//	and        = comparison { "&&" comparison } .
+//	comparison = unary [ ( "==" | "!=" | "<" | "<=" | ">" | ">=" ) unary ] .
+//	unary      = ( "!" | "-" ) unary | postfix .
+//	postfix    = primary { "." identifier | "[" expression "]" } .
+//	primary    = literal | identifier | call | "(" expression ")" .
+//	call       = identifier "(" [ expression { "," expression } ] ")" .
+//	literal    = number | string | "true" | "false" | "null" .
+//	identifier = letter { letter | digit } .    letters include "_"
+//	number     = digit { digit } [ "." digit { digit } ] .
+//	string     = "'" { char } "'" | `"` { char } `"` .
+//
+// Strings support the escapes \\, \', \", \n and \t. Whitespace between
+// tokens is ignored.
+//
+// # Semantics
+//
+// An identifier names a variable; an unknown variable is null. "a.b" reads
+// the key "b" of the map a, or its exported field b if a is a struct, and
+// "a[i]" reads the element i of a slice or the key i of a map. Reading a
+// missing key or an out of range index yields null rather than an error.
+//
+// All numbers are compared as float64, whatever their Go type. "==" and "!="
+// compare values of any type; values of different types are not equal. The
+// ordering operators compare two numbers or two strings, and fail for other
+// operands. "!", "&&" and "||" require booleans, and "&&" and "||" only
+// evaluate their right operand if the left one does not decide the result.
+//
+// # Functions
+//
+//	contains(s, sub)   reports whether the string s contains sub, the slice s
+//	                   has an element equal to sub, or the map s has the key sub
+//	len(v)             the length of a string, slice or map; 0 for null
+//	lower(s)           s in lower case
+package expr
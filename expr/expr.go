@@ -0,0 +1,423 @@
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ErrNotBool is returned by Expr.Bool when the expression does not evaluate to a boolean.
+var ErrNotBool = errors.New("expr: result is not a boolean")
+
+// Expr is a compiled expression. It is safe for concurrent use.
+type Expr struct {
+	src  string
+	root node
+}
+
+// Compile parses the expression src. Syntax errors, unknown functions and
+// wrong argument counts are reported as a *SyntaxError.
+func Compile(src string) (*Expr, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, p.errorf(t, "unexpected %s", t)
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+// MustCompile is like Compile but panics if the expression cannot be compiled.
+func MustCompile(src string) *Expr {
+	e, err := Compile(src)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// String returns the source of the expression.
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Eval evaluates the expression with the given variables. The result is
+// null, a bool, a float64, a string or a value read from vars.
+func (e *Expr) Eval(vars map[string]any) (any, error) {
+	return e.root.eval(vars)
+}
+
+// Bool evaluates the expression and returns its boolean result.
+func (e *Expr) Bool(vars map[string]any) (bool, error) {
+	v, err := e.Eval(vars)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("%w: %s", ErrNotBool, typeName(v))
+	}
+	return b, nil
+}
+
+type node interface {
+	eval(vars map[string]any) (any, error)
+}
+
+type literalNode struct {
+	value any
+}
+
+func (n *literalNode) eval(map[string]any) (any, error) {
+	return n.value, nil
+}
+
+type identNode struct {
+	name string
+}
+
+func (n *identNode) eval(vars map[string]any) (any, error) {
+	return normalize(vars[n.name]), nil
+}
+
+type fieldNode struct {
+	x    node
+	name string
+}
+
+func (n *fieldNode) eval(vars map[string]any) (any, error) {
+	x, err := n.x.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	return lookup(x, n.name), nil
+}
+
+type indexNode struct {
+	x, index node
+	pos      int
+}
+
+func (n *indexNode) eval(vars map[string]any) (any, error) {
+	x, err := n.x.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	index, err := n.index.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	switch i := index.(type) {
+	case string:
+		return lookup(x, i), nil
+	case float64:
+		rv := indirect(x)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			return nil, evalError(n.pos, "cannot index %s with a number", typeName(x))
+		}
+		if i != float64(int(i)) || int(i) < 0 || int(i) >= rv.Len() {
+			return nil, nil
+		}
+		return normalize(rv.Index(int(i)).Interface()), nil
+	default:
+		return nil, evalError(n.pos, "invalid index of type %s", typeName(index))
+	}
+}
+
+type unaryNode struct {
+	op  string
+	x   node
+	pos int
+}
+
+func (n *unaryNode) eval(vars map[string]any) (any, error) {
+	x, err := n.x.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "!":
+		b, ok := x.(bool)
+		if !ok {
+			return nil, evalError(n.pos, "operator ! requires a boolean, got %s", typeName(x))
+		}
+		return !b, nil
+	default:
+		f, ok := number(x)
+		if !ok {
+			return nil, evalError(n.pos, "operator - requires a number, got %s", typeName(x))
+		}
+		return -f, nil
+	}
+}
+
+type binaryNode struct {
+	op   string
+	x, y node
+	pos  int
+}
+
+func (n *binaryNode) eval(vars map[string]any) (any, error) {
+	x, err := n.x.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "&&" || n.op == "||" {
+		left, ok := x.(bool)
+		if !ok {
+			return nil, evalError(n.pos, "operator %s requires booleans, got %s", n.op, typeName(x))
+		}
+		if left == (n.op == "||") {
+			return left, nil
+		}
+		y, err := n.y.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		right, ok := y.(bool)
+		if !ok {
+			return nil, evalError(n.pos, "operator %s requires booleans, got %s", n.op, typeName(y))
+		}
+		return right, nil
+	}
+	y, err := n.y.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return equal(x, y), nil
+	case "!=":
+		return !equal(x, y), nil
+	}
+	var cmp int
+	if a, ok := number(x); ok {
+		b, ok := number(y)
+		if !ok {
+			return nil, evalError(n.pos, "cannot compare %s with %s", typeName(x), typeName(y))
+		}
+		switch {
+		case a < b:
+			cmp = -1
+		case a > b:
+			cmp = 1
+		}
+	} else if a, ok := x.(string); ok {
+		b, ok := y.(string)
+		if !ok {
+			return nil, evalError(n.pos, "cannot compare %s with %s", typeName(x), typeName(y))
+		}
+		cmp = strings.Compare(a, b)
+	} else {
+		return nil, evalError(n.pos, "operator %s requires numbers or strings, got %s", n.op, typeName(x))
+	}
+	switch n.op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
+
+type callNode struct {
+	name string
+	fn   func(args []any) (any, error)
+	args []node
+	pos  int
+}
+
+func (n *callNode) eval(vars map[string]any) (any, error) {
+	args := make([]any, len(n.args))
+	for i, arg := range n.args {
+		v, err := arg.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	v, err := n.fn(args)
+	if err != nil {
+		return nil, evalError(n.pos, "%s: %v", n.name, err)
+	}
+	return v, nil
+}
+
+// function is a function callable from expressions.
+type function struct {
+	arity int
+	call  func(args []any) (any, error)
+}
+
+// functions is the whitelist of functions callable from expressions.
+var functions = map[string]function{
+	"contains": {2, builtinContains},
+	"len":      {1, builtinLen},
+	"lower":    {1, builtinLower},
+}
+
+func builtinContains(args []any) (any, error) {
+	if s, ok := args[0].(string); ok {
+		sub, ok := args[1].(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot look for %s in a string", typeName(args[1]))
+		}
+		return strings.Contains(s, sub), nil
+	}
+	if args[0] == nil {
+		return false, nil
+	}
+	rv := indirect(args[0])
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if equal(normalize(rv.Index(i).Interface()), args[1]) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case reflect.Map:
+		key, ok := args[1].(string)
+		if !ok || rv.Type().Key().Kind() != reflect.String {
+			return false, nil
+		}
+		return rv.MapIndex(reflect.ValueOf(key).Convert(rv.Type().Key())).IsValid(), nil
+	}
+	return nil, fmt.Errorf("unsupported value of type %s", typeName(args[0]))
+}
+
+func builtinLen(args []any) (any, error) {
+	if args[0] == nil {
+		return float64(0), nil
+	}
+	if s, ok := args[0].(string); ok {
+		return float64(len([]rune(s))), nil
+	}
+	rv := indirect(args[0])
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(rv.Len()), nil
+	}
+	return nil, fmt.Errorf("unsupported value of type %s", typeName(args[0]))
+}
+
+func builtinLower(args []any) (any, error) {
+	s, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("unsupported value of type %s", typeName(args[0]))
+	}
+	return strings.ToLower(s), nil
+}
+
+// evalError reports an evaluation failure at the byte offset pos.
+func evalError(pos int, format string, args ...any) error {
+	return fmt.Errorf("expr: column %d: %s", pos+1, fmt.Sprintf(format, args...))
+}
+
+// lookup returns the key name of a map or the exported field name of a struct, or nil.
+func lookup(x any, name string) any {
+	rv := indirect(x)
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		v := rv.MapIndex(reflect.ValueOf(name).Convert(rv.Type().Key()))
+		if !v.IsValid() {
+			return nil
+		}
+		return normalize(v.Interface())
+	case reflect.Struct:
+		field, ok := rv.Type().FieldByName(name)
+		if !ok || !field.IsExported() {
+			return nil
+		}
+		return normalize(rv.FieldByIndex(field.Index).Interface())
+	}
+	return nil
+}
+
+// indirect dereferences pointers and interfaces.
+func indirect(x any) reflect.Value {
+	rv := reflect.ValueOf(x)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return reflect.Value{}
+		}
+		rv = rv.Elem()
+	}
+	return rv
+}
+
+// normalize converts numbers to float64 and named strings and bools to their
+// underlying type, so values read from Go data compare like literals.
+func normalize(x any) any {
+	if f, ok := number(x); ok {
+		return f
+	}
+	rv := indirect(x)
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.String:
+		return rv.String()
+	case reflect.Bool:
+		return rv.Bool()
+	}
+	return x
+}
+
+// number returns x as a float64 if it is a number.
+func number(x any) (float64, bool) {
+	rv := indirect(x)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+// equal reports whether x and y are equal values of the same type.
+func equal(x, y any) bool {
+	x, y = normalize(x), normalize(y)
+	switch a := x.(type) {
+	case nil:
+		return y == nil
+	case float64, string, bool:
+		return x == y
+	default:
+		if y == nil {
+			return false
+		}
+		return reflect.DeepEqual(a, y)
+	}
+}
+
+// typeName names the type of x in error messages.
+func typeName(x any) string {
+	switch normalize(x).(type) {
+	case nil:
+		return "null"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	}
+	return fmt.Sprintf("%T", x)
+}
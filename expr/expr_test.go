@@ -0,0 +1,161 @@
+package expr
+
+import (
+	"errors"
+	"testing"
+)
+
+type draft struct {
+	Title string
+	Words int
+}
+
+func TestEval(t *testing.T) {
+	type status string
+	vars := map[string]any{
+		"state": map[string]any{
+			"revision": 2,
+			"score":    float32(0.75),
+			"draft":    "Intro. TODO: conclusion",
+			"tags":     []string{"go", "agents"},
+			"status":   status("review"),
+			"doc":      &draft{Title: "Plan", Words: 120},
+			"meta":     map[string]int{"pages": 3},
+			"approved": false,
+		},
+	}
+	tests := []struct {
+		expr string
+		want any
+	}{
+		{"state.revision < 3 && !contains(state.draft, 'TODO')", false},
+		{"state.revision < 3 && contains(state.draft, 'TODO')", true},
+		{"state.revision == 2", true},
+		{"state.revision >= 2.5", false},
+		{"state.score > 0.5", true},
+		{"-state.revision < -1", true},
+		{`state.status == "review"`, true},
+		{"state.status < 'x'", true},
+		{"state.revision == '2'", false},
+		{"state.missing == null", true},
+		{"state.missing.deeper == null", true},
+		{"contains(state.tags, 'go')", true},
+		{"contains(state.meta, 'pages')", true},
+		{"contains(state.missing, 'x')", false},
+		{"len(state.tags) == 2 && len(state.missing) == 0 && len('héllo') == 5", true},
+		{"lower(state.doc.Title) == 'plan'", true},
+		{"state.doc.Words > 100", true},
+		{"state.tags[1] == 'agents'", true},
+		{"state.tags[5] == null", true},
+		{"state['meta']['pages'] == 3", true},
+		{"state.approved || state.revision > 1", true},
+		// The right operand is not evaluated, so its type error does not matter.
+		{"state.approved && state.draft > 1", false},
+		{"true || state.draft", true},
+		{`'it\'s' == "it's"`, true},
+		{"(1 < 2) == true", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			e, err := Compile(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := e.Eval(vars)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("want %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	vars := map[string]any{"state": map[string]any{"draft": "text", "tags": []string{"a"}}}
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"state.draft > 1", "expr: column 13: cannot compare string with number"},
+		{"state.missing < 3", "expr: column 15: operator < requires numbers or strings, got null"},
+		{"!state.draft", "expr: column 1: operator ! requires a boolean, got string"},
+		{"state.draft && true", "expr: column 13: operator && requires booleans, got string"},
+		{"state.draft[0]", "expr: column 12: cannot index string with a number"},
+		{"lower(state.tags)", "expr: column 1: lower: unsupported value of type []string"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := MustCompile(tt.expr).Eval(vars)
+			if err == nil || err.Error() != tt.want {
+				t.Fatalf("want %q, got %v", tt.want, err)
+			}
+		})
+	}
+	if _, err := MustCompile("len(state.tags)").Bool(vars); !errors.Is(err, ErrNotBool) {
+		t.Fatalf("want ErrNotBool, got %v", err)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"", "expr: column 1: unexpected end of expression"},
+		{"state.revision < ", "expr: column 18: unexpected end of expression"},
+		{"state.revision < 3 & x", `expr: column 20: unexpected character '&'`},
+		{"state.revision 3", `expr: column 16: unexpected "3"`},
+		{"(a || b", `expr: column 8: expected ")", found end of expression`},
+		{"state.", "expr: column 7: expected a field name, found end of expression"},
+		{"'open", "expr: column 1: unterminated string"},
+		{`'bad \q'`, `expr: column 6: unknown escape \q`},
+		{"exec('rm')", `expr: column 1: unknown function "exec"`},
+		{"len(a, b)", "expr: column 1: len takes 1 arguments, got 2"},
+		{"contains(a b)", `expr: column 12: expected ",", found "b"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := Compile(tt.expr)
+			var syntax *SyntaxError
+			if !errors.As(err, &syntax) || err.Error() != tt.want {
+				t.Fatalf("want %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func FuzzCompile(f *testing.F) {
+	for _, seed := range []string{
+		"state.revision < 3 && !contains(state.draft, 'TODO')",
+		"len(state.tags) > 0 || lower(state.name) == \"x\"",
+		"state['a'][0].b != null",
+		"-(1) >= -2.5",
+		"((((a))))",
+		"'\\n\\t\\\\'",
+	} {
+		f.Add(seed)
+	}
+	vars := map[string]any{"state": map[string]any{
+		"revision": 1,
+		"draft":    "TODO",
+		"tags":     []any{"a", 1, true, nil},
+		"a":        []map[string]any{{"b": 1}},
+	}}
+	f.Fuzz(func(t *testing.T, src string) {
+		e, err := Compile(src)
+		if err != nil {
+			var syntax *SyntaxError
+			if !errors.As(err, &syntax) {
+				t.Fatalf("want a *SyntaxError, got %T: %v", err, err)
+			}
+			if syntax.Column < 1 || syntax.Column > len(src)+1 {
+				t.Fatalf("column %d out of range for %q", syntax.Column, src)
+			}
+			return
+		}
+		// Evaluation may fail but must not panic.
+		_, _ = e.Eval(vars)
+	})
+}
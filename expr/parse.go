@@ -0,0 +1,338 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SyntaxError reports an expression that cannot be compiled.
+type SyntaxError struct {
+	// Column is the 1-based byte column of the offending token.
+	Column  int
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("expr: column %d: %s", e.Column, e.Message)
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokenEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+// lex splits src into tokens.
+func lex(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isLetter(c):
+			start := i
+			for i < len(src) && (isLetter(src[i]) || isDigit(src[i])) {
+				i++
+			}
+			tokens = append(tokens, token{tokenIdent, src[start:i], start})
+		case isDigit(c):
+			start := i
+			for i < len(src) && isDigit(src[i]) {
+				i++
+			}
+			if i+1 < len(src) && src[i] == '.' && isDigit(src[i+1]) {
+				i++
+				for i < len(src) && isDigit(src[i]) {
+					i++
+				}
+			}
+			tokens = append(tokens, token{tokenNumber, src[start:i], start})
+		case c == '\'' || c == '"':
+			start := i
+			var buf strings.Builder
+			for i++; ; i++ {
+				if i >= len(src) {
+					return nil, &SyntaxError{Column: start + 1, Message: "unterminated string"}
+				}
+				if src[i] == c {
+					i++
+					break
+				}
+				if src[i] != '\\' {
+					buf.WriteByte(src[i])
+					continue
+				}
+				if i++; i >= len(src) {
+					return nil, &SyntaxError{Column: start + 1, Message: "unterminated string"}
+				}
+				switch src[i] {
+				case '\\', '\'', '"':
+					buf.WriteByte(src[i])
+				case 'n':
+					buf.WriteByte('\n')
+				case 't':
+					buf.WriteByte('\t')
+				default:
+					return nil, &SyntaxError{Column: i, Message: fmt.Sprintf("unknown escape \\%c", src[i])}
+				}
+			}
+			tokens = append(tokens, token{tokenString, buf.String(), start})
+		default:
+			op := src[i : i+1]
+			if i+1 < len(src) {
+				switch two := src[i : i+2]; two {
+				case "&&", "||", "==", "!=", "<=", ">=":
+					op = two
+				}
+			}
+			switch op {
+			case "(", ")", "[", "]", ".", ",", "!", "-", "<", ">", "&&", "||", "==", "!=", "<=", ">=":
+			default:
+				return nil, &SyntaxError{Column: i + 1, Message: fmt.Sprintf("unexpected character %q", rune(c))}
+			}
+			tokens = append(tokens, token{tokenOp, op, i})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(src)}), nil
+}
+
+func isLetter(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// maxDepth bounds the nesting of expressions.
+const maxDepth = 100
+
+// parser is a recursive descent parser over the tokens of an expression.
+type parser struct {
+	tokens []token
+	next   int
+	depth  int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) advance() token {
+	t := p.tokens[p.next]
+	if t.kind != tokenEOF {
+		p.next++
+	}
+	return t
+}
+
+// accept consumes the next token if it is the operator op.
+func (p *parser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokenOp && t.text == op {
+		p.next++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(op string) error {
+	if !p.accept(op) {
+		return p.errorf(p.peek(), "expected %q, found %s", op, p.peek())
+	}
+	return nil
+}
+
+func (p *parser) errorf(t token, format string, args ...any) error {
+	return &SyntaxError{Column: t.pos + 1, Message: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) or() (node, error) {
+	if p.depth++; p.depth > maxDepth {
+		return nil, p.errorf(p.peek(), "expression is nested too deeply")
+	}
+	defer func() { p.depth-- }()
+	x, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if !p.accept("||") {
+			return x, nil
+		}
+		y, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		x = &binaryNode{op: t.text, x: x, y: y, pos: t.pos}
+	}
+}
+
+func (p *parser) and() (node, error) {
+	x, err := p.comparison()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if !p.accept("&&") {
+			return x, nil
+		}
+		y, err := p.comparison()
+		if err != nil {
+			return nil, err
+		}
+		x = &binaryNode{op: t.text, x: x, y: y, pos: t.pos}
+	}
+}
+
+func (p *parser) comparison() (node, error) {
+	x, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	for _, op := range []string{"==", "!=", "<", "<=", ">", ">="} {
+		if !p.accept(op) {
+			continue
+		}
+		y, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &binaryNode{op: op, x: x, y: y, pos: t.pos}, nil
+	}
+	return x, nil
+}
+
+func (p *parser) unary() (node, error) {
+	t := p.peek()
+	if p.accept("!") || p.accept("-") {
+		if p.depth++; p.depth > maxDepth {
+			return nil, p.errorf(t, "expression is nested too deeply")
+		}
+		defer func() { p.depth-- }()
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: t.text, x: x, pos: t.pos}, nil
+	}
+	return p.postfix()
+}
+
+func (p *parser) postfix() (node, error) {
+	x, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		switch {
+		case p.accept("."):
+			name := p.advance()
+			if name.kind != tokenIdent {
+				return nil, p.errorf(name, "expected a field name, found %s", name)
+			}
+			x = &fieldNode{x: x, name: name.text}
+		case p.accept("["):
+			index, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			x = &indexNode{x: x, index: index, pos: t.pos}
+		default:
+			return x, nil
+		}
+	}
+}
+
+func (p *parser) primary() (node, error) {
+	t := p.advance()
+	switch t.kind {
+	case tokenNumber:
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, p.errorf(t, "invalid number %s", t)
+		}
+		return &literalNode{value: v}, nil
+	case tokenString:
+		return &literalNode{value: t.text}, nil
+	case tokenIdent:
+		switch t.text {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null":
+			return &literalNode{value: nil}, nil
+		}
+		if !p.accept("(") {
+			return &identNode{name: t.text}, nil
+		}
+		return p.call(t)
+	case tokenOp:
+		if t.text == "(" {
+			x, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return x, nil
+		}
+	}
+	return nil, p.errorf(t, "unexpected %s", t)
+}
+
+// call parses the arguments of a call to name, whose "(" is consumed.
+func (p *parser) call(name token) (node, error) {
+	fn, ok := functions[name.text]
+	if !ok {
+		return nil, p.errorf(name, "unknown function %q", name.text)
+	}
+	var args []node
+	if !p.accept(")") {
+		for {
+			arg, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.accept(")") {
+				break
+			}
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(args) != fn.arity {
+		return nil, p.errorf(name, "%s takes %d arguments, got %d", name.text, fn.arity, len(args))
+	}
+	return &callNode{name: name.text, fn: fn.call, args: args, pos: name.pos}, nil
+}
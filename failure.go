@@ -0,0 +1,63 @@
+package blades
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrorClass categorizes the error of a StatusFailed message.
+type ErrorClass string
+
+const (
+	// ErrorClassModel indicates the model provider failed or returned no response.
+	ErrorClassModel ErrorClass = "model"
+	// ErrorClassTool indicates a tool call failed.
+	ErrorClassTool ErrorClass = "tool"
+	// ErrorClassTimeout indicates the invocation ran past its deadline.
+	ErrorClassTimeout ErrorClass = "timeout"
+	// ErrorClassMaxIterations indicates the agent exceeded its maximum iterations.
+	ErrorClassMaxIterations ErrorClass = "max_iterations"
+	// ErrorClassLimit indicates the invocation exceeded one of its Limits.
+	ErrorClassLimit ErrorClass = "limit"
+	// ErrorClassValidation indicates the answers kept failing the output validators.
+	ErrorClassValidation ErrorClass = "validation"
+	// ErrorClassInternal indicates any other failure, such as a session or configuration error.
+	ErrorClassInternal ErrorClass = "internal"
+)
+
+// ErrorDetail describes the error that ended an invocation.
+type ErrorDetail struct {
+	Class   ErrorClass `json:"class"`
+	Message string     `json:"message"`
+}
+
+// NewFailedMessage creates the terminal StatusFailed message for an agent that
+// failed with err, keeping any partial text it generated before the failure.
+func NewFailedMessage(author string, class ErrorClass, err error, partial string) *Message {
+	switch {
+	case errors.Is(err, ErrLimitExceeded):
+		class = ErrorClassLimit
+	case errors.Is(err, context.DeadlineExceeded):
+		class = ErrorClassTimeout
+	case errors.Is(err, ErrMaxIterationsExceeded):
+		class = ErrorClassMaxIterations
+	}
+	message := NewAssistantMessage(StatusFailed)
+	message.Author = author
+	message.Error = &ErrorDetail{Class: class, Message: err.Error()}
+	if partial != "" {
+		message.Parts = Parts(partial)
+	}
+	return message
+}
+
+// failInvocation yields the StatusFailed message for err followed by err itself,
+// so that consumers that only look at messages still see which agent failed and why.
+func (a *agent) failInvocation(invocation *Invocation, yield func(*Message, error) bool, class ErrorClass, err error, partial string) {
+	message := NewFailedMessage(a.name, class, err, partial)
+	message.InvocationID = invocation.ID
+	if !yield(message, nil) {
+		return
+	}
+	yield(nil, err)
+}
@@ -0,0 +1,339 @@
+package blades
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Rating is the judgement of a user on an answer.
+type Rating string
+
+const (
+	// RatingPositive is a thumbs-up.
+	RatingPositive Rating = "positive"
+	// RatingNegative is a thumbs-down.
+	RatingNegative Rating = "negative"
+)
+
+// Feedback is the judgement of a user on an answer of an invocation.
+type Feedback struct {
+	ID           string `json:"id"`
+	InvocationID string `json:"invocationId"`
+	SessionID    string `json:"sessionId,omitempty"`
+	// MessageID is the answer the feedback is about, by default the final
+	// answer of the invocation.
+	MessageID string `json:"messageId,omitempty"`
+	Rating    Rating `json:"rating,omitempty"`
+	Comment   string `json:"comment,omitempty"`
+	// Correction is the answer the user expected instead.
+	Correction string         `json:"correction,omitempty"`
+	Metadata   map[string]any `json:"metadata,omitempty"`
+	CreatedAt  time.Time      `json:"createdAt"`
+	// InstructionVersion, Experiment and Variant are copied from the answer,
+	// so that feedback can be compared across versions and variants.
+	InstructionVersion string `json:"instructionVersion,omitempty"`
+	Experiment         string `json:"experiment,omitempty"`
+	Variant            string `json:"variant,omitempty"`
+}
+
+// FeedbackQuery selects feedback by the version and variant of the answer.
+// Zero values match everything.
+type FeedbackQuery struct {
+	InvocationID       string
+	InstructionVersion string
+	Experiment         string
+	Variant            string
+}
+
+// match reports whether the feedback matches the query, except for the invocation.
+func (q FeedbackQuery) match(f Feedback) bool {
+	return (q.InstructionVersion == "" || f.InstructionVersion == q.InstructionVersion) &&
+		(q.Experiment == "" || f.Experiment == q.Experiment) &&
+		(q.Variant == "" || f.Variant == q.Variant)
+}
+
+// QueryFeedback returns the feedback of the store that matches the query.
+func QueryFeedback(ctx context.Context, store FeedbackStore, query FeedbackQuery) ([]Feedback, error) {
+	all, err := store.List(ctx, query.InvocationID)
+	if err != nil {
+		return nil, err
+	}
+	var feedback []Feedback
+	for _, f := range all {
+		if query.match(f) {
+			feedback = append(feedback, f)
+		}
+	}
+	return feedback, nil
+}
+
+// setAnswer records the version and variant of the answer on the feedback.
+func (f *Feedback) setAnswer(answer *Message) {
+	f.InstructionVersion, _ = answer.Metadata[InstructionVersionKey].(string)
+	f.Experiment, _ = answer.Metadata[ExperimentKey].(string)
+	f.Variant, _ = answer.Metadata[VariantKey].(string)
+}
+
+// validate checks that the feedback refers to an invocation and says something about it.
+func (f *Feedback) validate() error {
+	if f.InvocationID == "" {
+		return fmt.Errorf("%w: missing invocation ID", ErrInvalidFeedback)
+	}
+	switch f.Rating {
+	case "", RatingPositive, RatingNegative:
+	default:
+		return fmt.Errorf("%w: unknown rating %q", ErrInvalidFeedback, f.Rating)
+	}
+	if f.Rating == "" && f.Comment == "" && f.Correction == "" {
+		return fmt.Errorf("%w: no rating, comment or correction", ErrInvalidFeedback)
+	}
+	return nil
+}
+
+// FeedbackStore persists feedback.
+type FeedbackStore interface {
+	// Save stores the feedback, replacing any feedback with the same ID.
+	Save(context.Context, Feedback) error
+	// List returns the feedback on the invocation and its sub-agents, or all
+	// feedback if the ID is empty, in the order it was first saved.
+	List(ctx context.Context, invocationID string) ([]Feedback, error)
+}
+
+// InMemoryFeedbackStore is an in-memory implementation of FeedbackStore.
+type InMemoryFeedbackStore struct {
+	mu       sync.RWMutex
+	feedback []Feedback
+}
+
+// NewInMemoryFeedbackStore creates a new instance of InMemoryFeedbackStore.
+func NewInMemoryFeedbackStore() *InMemoryFeedbackStore {
+	return &InMemoryFeedbackStore{}
+}
+
+// Save stores the feedback in memory.
+func (s *InMemoryFeedbackStore) Save(ctx context.Context, feedback Feedback) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.feedback = saveFeedback(s.feedback, feedback)
+	return nil
+}
+
+// List returns the feedback on the invocation.
+func (s *InMemoryFeedbackStore) List(ctx context.Context, invocationID string) ([]Feedback, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return filterFeedback(s.feedback, invocationID), nil
+}
+
+// FeedbackVersion is the format version of the feedback written by
+// JSONLFeedbackStore. Version 0 feedback was written without an envelope.
+const FeedbackVersion = 1
+
+// feedbackMigrations upgrades the feedback of older versions on load.
+var feedbackMigrations = NewMigrations("feedback", FeedbackVersion).
+	Register(0, keepPayload)
+
+// JSONLFeedbackStore is a FeedbackStore that appends feedback to a file, one
+// JSON object per line. Feedback saved again with the same ID supersedes the
+// earlier line.
+type JSONLFeedbackStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewJSONLFeedbackStore creates a store writing to the file at path.
+func NewJSONLFeedbackStore(path string) *JSONLFeedbackStore {
+	return &JSONLFeedbackStore{path: path}
+}
+
+// Save writes the feedback as a line at the end of the file.
+func (s *JSONLFeedbackStore) Save(ctx context.Context, feedback Feedback) error {
+	data, err := feedbackMigrations.Marshal(feedback)
+	if err != nil {
+		return fmt.Errorf("feedback store: encode: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("feedback store: %w", err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("feedback store: %w", err)
+	}
+	return f.Close()
+}
+
+// List reads the feedback on the invocation from the file.
+func (s *JSONLFeedbackStore) List(ctx context.Context, invocationID string) ([]Feedback, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("feedback store: %w", err)
+	}
+	defer f.Close()
+	var all []Feedback
+	dec := json.NewDecoder(f)
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("feedback store: decode %s: %w", s.path, err)
+		}
+		var feedback Feedback
+		if err := feedbackMigrations.Unmarshal(raw, &feedback); err != nil {
+			return nil, fmt.Errorf("feedback store: load %s: %w", s.path, err)
+		}
+		all = saveFeedback(all, feedback)
+	}
+	return filterFeedback(all, invocationID), nil
+}
+
+// saveFeedback replaces the feedback with the same ID or appends it.
+func saveFeedback(all []Feedback, feedback Feedback) []Feedback {
+	for i := range all {
+		if all[i].ID == feedback.ID {
+			all[i] = feedback
+			return all
+		}
+	}
+	return append(all, feedback)
+}
+
+func filterFeedback(all []Feedback, invocationID string) []Feedback {
+	var feedback []Feedback
+	for _, f := range all {
+		if invocationID == "" || isInvocationOrChild(f.InvocationID, invocationID) {
+			feedback = append(feedback, f)
+		}
+	}
+	return feedback
+}
+
+// InvocationMessages returns the user input of the invocation and its final
+// answer, the last completed assistant message of the invocation or its
+// sub-agents. It returns ErrInvocationNotFound if the session holds no
+// answer of the invocation.
+func InvocationMessages(session Session, invocationID string) (input, output *Message, err error) {
+	if session != nil {
+		for _, m := range session.History() {
+			if !isInvocationOrChild(m.InvocationID, invocationID) {
+				continue
+			}
+			switch {
+			case m.Role == RoleUser && m.InvocationID == invocationID:
+				input = m
+			case m.Role == RoleAssistant && m.Status == StatusCompleted:
+				output = m
+			}
+		}
+	}
+	if output == nil {
+		return nil, nil, fmt.Errorf("invocation %s: %w", invocationID, ErrInvocationNotFound)
+	}
+	return input, output, nil
+}
+
+// NewFeedback returns feedback on the final answer of an invocation run in
+// the session, with the IDs of the invocation, the session and the answer
+// filled in, ready for a rating, comment or correction to be set.
+func (r *Runner) NewFeedback(session Session, invocationID string) (Feedback, error) {
+	_, output, err := InvocationMessages(session, invocationID)
+	if err != nil {
+		return Feedback{}, err
+	}
+	feedback := Feedback{
+		ID:           uuid.NewString(),
+		InvocationID: invocationID,
+		SessionID:    session.ID(),
+		MessageID:    output.ID,
+	}
+	feedback.setAnswer(output)
+	return feedback, nil
+}
+
+// FeedbackHandler returns an HTTP handler that accepts feedback posted as a
+// JSON Feedback object. The invocation must exist in the stored session, and
+// the message, if set, must belong to it. The stored feedback is written
+// back with status 201.
+func FeedbackHandler(store FeedbackStore, sessions SessionStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var feedback Feedback
+		if err := json.NewDecoder(r.Body).Decode(&feedback); err != nil {
+			http.Error(w, fmt.Sprintf("%v: %v", ErrInvalidFeedback, err), http.StatusBadRequest)
+			return
+		}
+		if err := feedback.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := checkFeedbackTarget(r.Context(), sessions, &feedback); err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, ErrSessionNotFound) || errors.Is(err, ErrInvocationNotFound) || errors.Is(err, ErrMessageNotFound) {
+				status = http.StatusNotFound
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		if feedback.ID == "" {
+			feedback.ID = uuid.NewString()
+		}
+		feedback.CreatedAt = time.Now()
+		if err := store.Save(r.Context(), feedback); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(feedback)
+	})
+}
+
+// checkFeedbackTarget checks that the invocation and message of the feedback
+// exist, defaulting the message to the final answer of the invocation, and
+// records the version and variant of the answer.
+func checkFeedbackTarget(ctx context.Context, sessions SessionStore, feedback *Feedback) error {
+	if feedback.SessionID == "" {
+		return fmt.Errorf("%w: missing session ID", ErrInvalidFeedback)
+	}
+	session, err := sessions.Load(ctx, feedback.SessionID)
+	if err != nil {
+		return err
+	}
+	_, output, err := InvocationMessages(session, feedback.InvocationID)
+	if err != nil {
+		return err
+	}
+	if feedback.MessageID == "" {
+		feedback.MessageID = output.ID
+		feedback.setAnswer(output)
+		return nil
+	}
+	for _, m := range session.History() {
+		if m.ID == feedback.MessageID && isInvocationOrChild(m.InvocationID, feedback.InvocationID) {
+			feedback.setAnswer(m)
+			return nil
+		}
+	}
+	return fmt.Errorf("invocation %s: %w: %s", feedback.InvocationID, ErrMessageNotFound, feedback.MessageID)
+}
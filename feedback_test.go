@@ -0,0 +1,80 @@
+package blades
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFeedbackHandler(t *testing.T) {
+	ctx := context.Background()
+	model := &mockModel{generate: func(context.Context, *ModelRequest) (*ModelResponse, error) {
+		return textResponse("Paris is in Italy."), nil
+	}}
+	agent, err := NewAgent("geo", WithModel(model))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := NewRunner(agent)
+	session := NewSession()
+	if _, err := runner.Run(ctx, UserMessage("Where is Paris?"), WithSession(session), WithInvocationID("inv-1")); err != nil {
+		t.Fatal(err)
+	}
+	sessions := NewInMemorySessionStore()
+	if err := sessions.Save(ctx, session); err != nil {
+		t.Fatal(err)
+	}
+	feedback, err := runner.NewFeedback(session, "inv-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runner.NewFeedback(session, "inv-2"); err == nil {
+		t.Fatal("want an error for an unknown invocation")
+	}
+	feedback.Rating = RatingNegative
+	feedback.Correction = "Paris is in France."
+
+	store := NewJSONLFeedbackStore(filepath.Join(t.TempDir(), "feedback.jsonl"))
+	handler := FeedbackHandler(store, sessions)
+	post := func(body any) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/feedback", strings.NewReader(string(data))))
+		return rec
+	}
+	tests := []struct {
+		name     string
+		feedback Feedback
+		want     int
+	}{
+		{"valid", feedback, http.StatusCreated},
+		{"unknown invocation", Feedback{InvocationID: "inv-2", SessionID: session.ID(), Rating: RatingPositive}, http.StatusNotFound},
+		{"unknown message", Feedback{InvocationID: "inv-1", SessionID: session.ID(), MessageID: "nope", Rating: RatingPositive}, http.StatusNotFound},
+		{"unknown session", Feedback{InvocationID: "inv-1", SessionID: "nope", Rating: RatingPositive}, http.StatusNotFound},
+		{"empty", Feedback{InvocationID: "inv-1", SessionID: session.ID()}, http.StatusBadRequest},
+		{"bad rating", Feedback{InvocationID: "inv-1", SessionID: session.ID(), Rating: "meh"}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := post(tt.feedback); rec.Code != tt.want {
+				t.Fatalf("want status %d, got %d: %s", tt.want, rec.Code, rec.Body)
+			}
+		})
+	}
+	// Saving again with the same ID supersedes the earlier feedback.
+	feedback.Comment = "wrong country"
+	if rec := post(feedback); rec.Code != http.StatusCreated {
+		t.Fatalf("want status 201, got %d", rec.Code)
+	}
+	stored, err := store.List(ctx, "inv-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 || stored[0].Comment != "wrong country" || stored[0].MessageID != feedback.MessageID {
+		t.Fatalf("unexpected stored feedback: %+v", stored)
+	}
+}
@@ -0,0 +1,147 @@
+package blades
+
+import (
+	"context"
+	"strings"
+)
+
+// ExampleKey is the message metadata key marking the few-shot example
+// messages of a request, which are never stored in the session.
+const ExampleKey = "example"
+
+// Example is a few-shot example: an input and the output the model should
+// answer it with.
+type Example struct {
+	Input  string `json:"input"`
+	Output string `json:"output"`
+}
+
+// ExampleFormatter places the few-shot examples of an agent in a request.
+// Model providers that implement it format the examples for their models,
+// e.g. in the system prompt for models that follow examples better there.
+type ExampleFormatter interface {
+	FormatExamples(model string, req *ModelRequest, examples []Example)
+}
+
+// ExampleFormatterFunc is an adapter to allow the use of ordinary functions as ExampleFormatters.
+type ExampleFormatterFunc func(model string, req *ModelRequest, examples []Example)
+
+// FormatExamples implements the ExampleFormatter interface for ExampleFormatterFunc.
+func (f ExampleFormatterFunc) FormatExamples(model string, req *ModelRequest, examples []Example) {
+	f(model, req, examples)
+}
+
+var (
+	// ExamplesAsMessages places each example as a user message followed by
+	// an assistant message, after the system messages and before the
+	// history. It is the default.
+	ExamplesAsMessages ExampleFormatter = ExampleFormatterFunc(func(_ string, req *ModelRequest, examples []Example) {
+		at := 0
+		for at < len(req.Messages) && IsSystemRole(req.Messages[at].Role) {
+			at++
+		}
+		messages := make([]*Message, 0, len(req.Messages)+2*len(examples))
+		messages = append(messages, req.Messages[:at]...)
+		for _, example := range examples {
+			messages = append(messages, exampleMessages(example)...)
+		}
+		req.Messages = append(messages, req.Messages[at:]...)
+	})
+	// ExamplesInInstruction appends the examples to the instruction as text.
+	ExamplesInInstruction ExampleFormatter = ExampleFormatterFunc(func(_ string, req *ModelRequest, examples []Example) {
+		var buf strings.Builder
+		buf.WriteString("Examples:")
+		for _, example := range examples {
+			buf.WriteString("\n\nInput: ")
+			buf.WriteString(example.Input)
+			buf.WriteString("\nOutput: ")
+			buf.WriteString(example.Output)
+		}
+		// The instruction may be shared, so it is copied before it is extended.
+		instruction := SystemMessage[string]()
+		if req.Instruction != nil {
+			instruction = req.Instruction.Clone()
+		}
+		instruction.Parts = append(instruction.Parts, TextPart{Text: buf.String()})
+		req.Instruction = instruction
+	})
+)
+
+// WithExamples sets the few-shot examples of the Agent. They are sent with
+// every request, by default as alternating user and assistant messages after
+// the system prompt and before the history, but are never stored in the
+// session, so they do not show up as turns of the conversation. Model
+// providers that implement ExampleFormatter place them their own way, and
+// WithExampleFormatter overrides both.
+func WithExamples(examples []Example) AgentOption {
+	return func(a *agent) {
+		a.examples = append([]Example(nil), examples...)
+	}
+}
+
+// WithExampleFormatter sets how the Agent places its examples in requests,
+// e.g. ExamplesInInstruction.
+func WithExampleFormatter(formatter ExampleFormatter) AgentOption {
+	return func(a *agent) {
+		a.exampleFormatter = formatter
+	}
+}
+
+// WithExamplesTokenBudget caps the tokens the examples of the Agent take, as
+// counted by its TokenCounter: the examples that do not fit, from the first
+// that does not on, are left out. Zero means no cap.
+func WithExamplesTokenBudget(tokens int64) AgentOption {
+	return func(a *agent) {
+		a.examplesBudget = tokens
+	}
+}
+
+// exampleMessages returns the user and assistant messages of the example.
+func exampleMessages(example Example) []*Message {
+	input := UserMessage(example.Input)
+	output := AssistantMessage(example.Output)
+	output.Status = StatusCompleted
+	for _, m := range []*Message{input, output} {
+		m.Metadata = map[string]any{ExampleKey: true}
+	}
+	return []*Message{input, output}
+}
+
+// isExample reports whether the message is a few-shot example.
+func isExample(m *Message) bool {
+	example, _ := m.Metadata[ExampleKey].(bool)
+	return example
+}
+
+// budgetExamples returns the leading examples of the agent that fit its
+// examples token budget.
+func (a *agent) budgetExamples() []Example {
+	if a.examplesBudget <= 0 {
+		return a.examples
+	}
+	var tokens int64
+	for i, example := range a.examples {
+		tokens += a.tokenCounter.CountTokens(exampleMessages(example)...)
+		if tokens > a.examplesBudget {
+			return a.examples[:i]
+		}
+	}
+	return a.examples
+}
+
+// addExamples places the examples of the agent in the request with the
+// formatter of the agent, or else of its model.
+func (a *agent) addExamples(ctx context.Context, model string, req *ModelRequest) {
+	examples := a.budgetExamples()
+	if len(examples) == 0 {
+		return
+	}
+	formatter := a.exampleFormatter
+	if formatter == nil {
+		formatter, _ = a.provider(ctx).(ExampleFormatter)
+	}
+	if formatter == nil {
+		formatter = ExamplesAsMessages
+	}
+	formatter.FormatExamples(model, req, examples)
+}
@@ -0,0 +1,155 @@
+package blades
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+// exampleModel is a mockModel that formats examples in its instruction.
+type exampleModel struct {
+	mockModel
+}
+
+func (m *exampleModel) FormatExamples(model string, req *ModelRequest, examples []Example) {
+	ExamplesInInstruction.FormatExamples(model, req, examples)
+}
+
+func TestExamples(t *testing.T) {
+	examples := []Example{
+		{Input: "2+2", Output: "4"},
+		{Input: "3*3", Output: "9"},
+	}
+	type turn struct {
+		Role string `json:"role"`
+		Text string `json:"text"`
+	}
+	tests := []struct {
+		name        string
+		model       func(*ModelRequest) ModelProvider
+		opts        []AgentOption
+		instruction string
+		messages    string
+	}{
+		{
+			name:        "messages",
+			instruction: "Answer with the result only.",
+			messages:    `[{"role":"user","text":"2+2"},{"role":"assistant","text":"4"},{"role":"user","text":"3*3"},{"role":"assistant","text":"9"},{"role":"user","text":"earlier"},{"role":"assistant","text":"noted"},{"role":"user","text":"5-1"}]`,
+		},
+		{
+			name:        "budget",
+			opts:        []AgentOption{WithExamplesTokenBudget(12)},
+			instruction: "Answer with the result only.",
+			messages:    `[{"role":"user","text":"2+2"},{"role":"assistant","text":"4"},{"role":"user","text":"earlier"},{"role":"assistant","text":"noted"},{"role":"user","text":"5-1"}]`,
+		},
+		{
+			name: "provider",
+			model: func(req *ModelRequest) ModelProvider {
+				m := &exampleModel{}
+				m.generate = func(_ context.Context, r *ModelRequest) (*ModelResponse, error) {
+					*req = *r
+					return textResponse("4"), nil
+				}
+				return m
+			},
+			instruction: "Answer with the result only.\nExamples:\n\nInput: 2+2\nOutput: 4\n\nInput: 3*3\nOutput: 9",
+			messages:    `[{"role":"user","text":"earlier"},{"role":"assistant","text":"noted"},{"role":"user","text":"5-1"}]`,
+		},
+		{
+			name:        "option",
+			opts:        []AgentOption{WithExampleFormatter(ExamplesInInstruction), WithExamplesTokenBudget(12)},
+			instruction: "Answer with the result only.\nExamples:\n\nInput: 2+2\nOutput: 4",
+			messages:    `[{"role":"user","text":"earlier"},{"role":"assistant","text":"noted"},{"role":"user","text":"5-1"}]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req ModelRequest
+			var model ModelProvider = &mockModel{generate: func(_ context.Context, r *ModelRequest) (*ModelResponse, error) {
+				req = *r
+				return textResponse("4"), nil
+			}}
+			if tt.model != nil {
+				model = tt.model(&req)
+			}
+			// The history is injected the way history middleware does.
+			history := func(next Handler) Handler {
+				return HandleFunc(func(ctx context.Context, invocation *Invocation) Generator[*Message, error] {
+					invocation.History = []*Message{UserMessage("earlier"), AssistantMessage("noted")}
+					return next.Handle(ctx, invocation)
+				})
+			}
+			opts := append([]AgentOption{
+				WithModel(model),
+				WithInstruction("Answer with the result only."),
+				WithExamples(examples),
+				WithMiddleware(history),
+			}, tt.opts...)
+			agent, err := NewAgent("calc", opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			session := NewSession()
+			if _, err := NewRunner(agent).Run(context.Background(), UserMessage("5-1"), WithSession(session)); err != nil {
+				t.Fatal(err)
+			}
+			if got := req.Instruction.Text(); got != tt.instruction {
+				t.Fatalf("want the instruction %q, got %q", tt.instruction, got)
+			}
+			turns := make([]turn, 0, len(req.Messages))
+			for _, m := range req.Messages {
+				turns = append(turns, turn{Role: string(m.Role), Text: m.Text()})
+			}
+			data, err := json.Marshal(turns)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.messages {
+				t.Fatalf("want the messages %s, got %s", tt.messages, data)
+			}
+			for _, m := range session.History() {
+				if isExample(m) || m.Text() == "2+2" || m.Text() == "3*3" {
+					t.Fatalf("want no examples in the session, got %v", m)
+				}
+			}
+			if n := len(session.History()); n != 2 {
+				t.Fatalf("want only the turn in the session, got %d messages", n)
+			}
+		})
+	}
+}
+
+func TestExamplesKeptOnOverflow(t *testing.T) {
+	RegisterModelCapabilities("examples-window", ModelCapabilities{ContextWindow: 60})
+	var req ModelRequest
+	model := &mockModel{name: "examples-window", generate: func(_ context.Context, r *ModelRequest) (*ModelResponse, error) {
+		req = *r
+		return textResponse("4"), nil
+	}}
+	agent, err := NewAgent("calc",
+		WithModel(model),
+		WithExamples([]Example{{Input: "2+2", Output: "4"}}),
+		WithContextOverflowPolicy(ContextOverflowTruncate),
+		WithMiddleware(func(next Handler) Handler {
+			return HandleFunc(func(ctx context.Context, invocation *Invocation) Generator[*Message, error] {
+				for range 10 {
+					invocation.History = append(invocation.History, UserMessage("an earlier question"), AssistantMessage("an earlier answer"))
+				}
+				return next.Handle(ctx, invocation)
+			})
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := NewSession()
+	if _, err := NewRunner(agent).Run(context.Background(), UserMessage("5-1"), WithSession(session)); err != nil {
+		t.Fatal(err)
+	}
+	if len(req.Messages) < 3 || !isExample(req.Messages[0]) || !isExample(req.Messages[1]) {
+		t.Fatalf("want the examples kept first, got %v", req.Messages)
+	}
+	if len(req.Messages) >= 23 {
+		t.Fatalf("want the history truncated, got %d messages", len(req.Messages))
+	}
+}
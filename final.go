@@ -0,0 +1,52 @@
+package blades
+
+// MarkFinal returns the messages of the stream with the final answer marked.
+//
+// If final is false, the stream holds intermediate output and Final is
+// cleared on every message. Otherwise a final answer already marked within
+// the stream, such as the answer of a nested flow, is kept; without one, the
+// last message is marked if it is a completed assistant message. Completed
+// assistant messages are therefore held back until the next message arrives.
+func MarkFinal(messages Generator[*Message, error], final bool) Generator[*Message, error] {
+	return func(yield func(*Message, error) bool) {
+		var (
+			pending *Message
+			marked  bool
+		)
+		for message, err := range messages {
+			if pending != nil {
+				if !yield(pending, nil) {
+					return
+				}
+				pending = nil
+			}
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if message == nil {
+				if !yield(message, nil) {
+					return
+				}
+				continue
+			}
+			if !final {
+				message.Final = false
+			}
+			marked = marked || message.Final
+			if final && message.Role == RoleAssistant && message.Status == StatusCompleted {
+				pending = message
+				continue
+			}
+			if !yield(message, nil) {
+				return
+			}
+		}
+		if pending != nil {
+			if !marked {
+				pending.Final = true
+			}
+			yield(pending, nil)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package blades
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMarkFinal(t *testing.T) {
+	newMessages := func(finals ...bool) []*Message {
+		messages := []*Message{{Role: RoleTool, Status: StatusCompleted}}
+		for _, final := range finals {
+			message := NewAssistantMessage(StatusCompleted)
+			message.Final = final
+			messages = append(messages, message)
+		}
+		return messages
+	}
+	collect := func(messages []*Message, final bool) []bool {
+		var got []bool
+		for message, err := range MarkFinal(messageStream(messages...), final) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, message.Final)
+		}
+		return got
+	}
+	tests := []struct {
+		name     string
+		messages []*Message
+		final    bool
+		want     []bool
+	}{
+		{"last answer", newMessages(false, false), true, []bool{false, false, true}},
+		{"inner answer kept", newMessages(true, false), true, []bool{false, true, false}},
+		{"intermediate", newMessages(true, false), false, []bool{false, false, false}},
+		{"no answer", newMessages(), true, []bool{false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := collect(tt.messages, tt.final); !slices.Equal(got, tt.want) {
+				t.Fatalf("want finals %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// messageStream yields the messages.
+func messageStream(messages ...*Message) Generator[*Message, error] {
+	return func(yield func(*Message, error) bool) {
+		for _, message := range messages {
+			if !yield(message, nil) {
+				return
+			}
+		}
+	}
+}
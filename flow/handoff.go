@@ -3,10 +3,13 @@ package flow
 import (
 	"context"
 	"fmt"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/go-kratos/blades"
 	"github.com/go-kratos/blades/internal/handoff"
+	"github.com/go-kratos/blades/tools"
 )
 
 type HandoffConfig struct {
@@ -14,44 +17,164 @@ type HandoffConfig struct {
 	Description string
 	Model       blades.ModelProvider
 	SubAgents   []blades.Agent
+	// Transfers lists, by the name of the routing agent or of a sub-agent,
+	// the sub-agents it may hand off to. A nil Transfers lets every agent hand
+	// off to every sub-agent; otherwise an agent that is not listed may not
+	// hand off at all.
+	Transfers map[string][]string
+	// MinConfidence, Fallback and MaxRoutes make the routing agent score its
+	// routes instead of handing off with a tool: it answers with a confidence
+	// between 0 and 1 for each of them, and the routes with a positive
+	// confidence of at least MinConfidence are taken, most confident first and
+	// ties in the order of SubAgents.
+	MinConfidence float64
+	// Fallback names the sub-agent that handles the request when no route is
+	// confident enough; without one, such requests fail with a RouteError.
+	Fallback string
+	// MaxRoutes is the number of routes taken; it defaults to 1. With more than
+	// one route taken, the routes run in parallel, without further handoffs,
+	// and Combiner synthesizes their answers.
+	MaxRoutes int
+	// Combiner answers with the synthesis of the answers of the routes; it is
+	// required when MaxRoutes is above 1.
+	Combiner blades.Agent
 }
 
 type HandoffAgent struct {
 	blades.Agent
-	targets map[string]blades.Agent
+	targets    map[string]blades.Agent
+	candidates []string
+	transfers  map[string][]string
+	// scored is set when the routing agent scores its routes.
+	scored        bool
+	routes        []string
+	minConfidence float64
+	fallback      string
+	maxRoutes     int
+	combiner      blades.Agent
+}
+
+// NewHandoffTool returns the tool that hands the request off to another agent.
+// Sub-agents of a handoff flow call it to pass the request on to one another.
+func NewHandoffTool() tools.Tool {
+	return handoff.NewHandoffTool()
 }
 
 func NewHandoffAgent(config HandoffConfig) (blades.Agent, error) {
-	instruction, err := handoff.BuildInstruction(config.SubAgents)
-	if err != nil {
+	if err := validateNames(config.Name, config.SubAgents); err != nil {
 		return nil, err
 	}
-	rootAgent, err := blades.NewAgent(
-		config.Name,
+	targets := make(map[string]blades.Agent)
+	candidates := make([]string, 0, len(config.SubAgents))
+	for _, agent := range config.SubAgents {
+		name := strings.TrimSpace(agent.Name())
+		targets[name] = agent
+		candidates = append(candidates, name)
+	}
+	for from, to := range config.Transfers {
+		if _, ok := targets[from]; !ok && from != config.Name {
+			return nil, fmt.Errorf("flow %s: transfers: unknown agent %q", config.Name, from)
+		}
+		for _, name := range to {
+			if _, ok := targets[name]; !ok {
+				return nil, fmt.Errorf("flow %s: transfers: %s: unknown sub-agent %q", config.Name, from, name)
+			}
+		}
+	}
+	// The routing agent is only told about the agents it may hand off to.
+	routes := config.SubAgents
+	if config.Transfers != nil {
+		routes = make([]blades.Agent, 0, len(config.Transfers[config.Name]))
+		for _, name := range config.Transfers[config.Name] {
+			routes = append(routes, targets[name])
+		}
+	}
+	a := &HandoffAgent{
+		targets:       targets,
+		candidates:    candidates,
+		transfers:     config.Transfers,
+		scored:        config.MinConfidence > 0 || config.Fallback != "" || config.MaxRoutes > 0,
+		minConfidence: config.MinConfidence,
+		fallback:      config.Fallback,
+		maxRoutes:     max(config.MaxRoutes, 1),
+		combiner:      config.Combiner,
+	}
+	opts := []blades.AgentOption{
 		blades.WithModel(config.Model),
 		blades.WithDescription(config.Description),
-		blades.WithInstruction(instruction),
-		blades.WithTools(handoff.NewHandoffTool()),
-	)
+	}
+	if a.scored {
+		if err := validateScoring(config, targets); err != nil {
+			return nil, err
+		}
+		for _, route := range routes {
+			a.routes = append(a.routes, route.Name())
+		}
+		instruction, err := handoff.BuildScoringInstruction(routes)
+		if err != nil {
+			return nil, err
+		}
+		schema, err := routeScoresSchema(a.routes)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, blades.WithInstruction(instruction), blades.WithOutputSchema(schema))
+	} else {
+		instruction, err := handoff.BuildInstruction(routes)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, blades.WithInstruction(instruction), blades.WithTools(handoff.NewHandoffTool()))
+	}
+	rootAgent, err := blades.NewAgent(config.Name, opts...)
 	if err != nil {
 		return nil, err
 	}
-	targets := make(map[string]blades.Agent)
-	for _, agent := range config.SubAgents {
-		targets[strings.TrimSpace(agent.Name())] = agent
+	a.Agent = rootAgent
+	return a, nil
+}
+
+// SubAgents returns the routing agent followed by the handoff targets and the
+// combiner, if any.
+func (a *HandoffAgent) SubAgents() []blades.Agent {
+	agents := []blades.Agent{a.Agent}
+	for _, name := range a.candidates {
+		agents = append(agents, a.targets[name])
+	}
+	if a.combiner != nil {
+		agents = append(agents, a.combiner)
+	}
+	return agents
+}
+
+// allowed reports whether the agent from may hand off to the agent to.
+func (a *HandoffAgent) allowed(from, to string) bool {
+	if a.transfers == nil {
+		return true
 	}
-	return &HandoffAgent{
-		Agent:   rootAgent,
-		targets: targets,
-	}, nil
+	return slices.Contains(a.transfers[from], to)
 }
 
+// Run routes the request to a sub-agent, which may in turn hand it off to
+// another sub-agent. Each handoff is checked against Transfers and recorded
+// with blades.Transfer, which stops runaway transfers; the transfer chain is
+// set on the final message of every sub-agent.
+//
+// A routing agent that scores its routes hands the request off to the most
+// confident route or to the fallback agent, or runs the most confident routes
+// in parallel and combines their answers; see HandoffConfig.
 func (a *HandoffAgent) Run(ctx context.Context, invocation *blades.Invocation) blades.Generator[*blades.Message, error] {
-	return func(yield func(*blades.Message, error) bool) {
+	ctx = blades.NewPathContext(ctx, a.Name())
+	if a.scored {
+		return blades.PathErrors(ctx, a.runScored(ctx, invocation))
+	}
+	return blades.PathErrors(ctx, func(yield func(*blades.Message, error) bool) {
 		var (
 			err         error
 			targetAgent string
 			message     *blades.Message
+			input       = invocation.Clone()
+			started     = time.Now()
 		)
 		for message, err = range a.Agent.Run(ctx, invocation) {
 			if err != nil {
@@ -62,20 +185,79 @@ func (a *HandoffAgent) Run(ctx context.Context, invocation *blades.Invocation) b
 				targetAgent, _ = target.(string)
 			}
 		}
+		record := RoutingRecord{
+			InvocationID: invocation.ID,
+			Router:       a.Name(),
+			Candidates:   a.candidates,
+			Latency:      time.Since(started),
+		}
 		agent, ok := a.targets[targetAgent]
 		if !ok {
 			// If no target agent found, return the last message from the root agent
 			if message != nil && message.Text() != "" {
+				record.Selected = a.Name()
+				RecordRouting(ctx, invocation.Session, record)
+				attachRouting(message, record)
 				yield(message, nil)
 				return
 			}
-			yield(nil, fmt.Errorf("target agent not found: %s", targetAgent))
+			err := &RouteError{Router: a.Name(), Output: targetAgent}
+			record.Error = err.Error()
+			RecordRouting(ctx, invocation.Session, record)
+			yield(nil, err)
+			return
+		}
+		record.Selected = agent.Name()
+		RecordRouting(ctx, invocation.Session, record)
+		a.handoff(ctx, input, agent, record, yield)
+	})
+}
+
+// handoff runs the selected agent, then the agents it hands off to.
+func (a *HandoffAgent) handoff(ctx context.Context, input *blades.Invocation, agent blades.Agent, record RoutingRecord, yield func(*blades.Message, error) bool) {
+	from := a.Name()
+	for agent != nil {
+		if !a.allowed(from, agent.Name()) {
+			yield(nil, &blades.TransferError{Chain: transferChain(ctx, from, agent.Name()), Err: blades.ErrTransferNotAllowed})
 			return
 		}
-		for message, err := range agent.Run(ctx, invocation) {
+		agentCtx, err := blades.Transfer(ctx, from, agent.Name(), input.Message)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		next := ""
+		for message, err := range agent.Run(agentCtx, input.Child(agent.Name())) {
+			if message != nil {
+				if target, ok := message.Actions[handoff.ActionHandoffToAgent]; ok {
+					next, _ = target.(string)
+				}
+				if message.Role == blades.RoleAssistant && message.Status == blades.StatusCompleted {
+					blades.AttachTransferChain(agentCtx, message)
+				}
+			}
+			attachRouting(message, record)
 			if !yield(message, err) {
 				return
 			}
 		}
+		if next == "" {
+			return
+		}
+		target, ok := a.targets[next]
+		if !ok {
+			yield(nil, &RouteError{Router: agent.Name(), Output: next})
+			return
+		}
+		from, agent, ctx = agent.Name(), target, agentCtx
+	}
+}
+
+// transferChain returns the transfer chain of ctx extended by a transfer from one agent to another.
+func transferChain(ctx context.Context, from, to string) []string {
+	chain := blades.TransferChain(ctx)
+	if len(chain) == 0 {
+		chain = []string{from}
 	}
+	return append(chain, to)
 }
@@ -0,0 +1,185 @@
+package flow
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-kratos/blades"
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+// routeScore is the confidence of a route as answered by a scoring router.
+type routeScore struct {
+	Agent      string  `json:"agent" jsonschema:"the name of the agent"`
+	Confidence float64 `json:"confidence" jsonschema:"how confident the agent can answer the question, from 0 to 1"`
+}
+
+// routerOutput is the structured output of a scoring router.
+type routerOutput struct {
+	Routes []routeScore `json:"routes" jsonschema:"the confidence of each agent"`
+}
+
+// routeScoresSchema returns the output schema of a router scoring the routes.
+func routeScoresSchema(routes []string) (*jsonschema.Schema, error) {
+	schema, err := jsonschema.For[routerOutput](nil)
+	if err != nil {
+		return nil, err
+	}
+	item := schema.Properties["routes"].Items
+	for _, route := range routes {
+		item.Properties["agent"].Enum = append(item.Properties["agent"].Enum, route)
+	}
+	low, high := 0.0, 1.0
+	item.Properties["confidence"].Minimum = &low
+	item.Properties["confidence"].Maximum = &high
+	return schema, nil
+}
+
+// validateScoring checks the scoring options of the config.
+func validateScoring(config HandoffConfig, targets map[string]blades.Agent) error {
+	if config.MinConfidence < 0 || config.MinConfidence > 1 {
+		return fmt.Errorf("flow %s: min confidence %v is not between 0 and 1", config.Name, config.MinConfidence)
+	}
+	if config.Fallback != "" {
+		if _, ok := targets[config.Fallback]; !ok {
+			return fmt.Errorf("flow %s: fallback: unknown sub-agent %q", config.Name, config.Fallback)
+		}
+		if config.Transfers != nil && !slices.Contains(config.Transfers[config.Name], config.Fallback) {
+			return fmt.Errorf("flow %s: fallback %q is not a transfer target of %s", config.Name, config.Fallback, config.Name)
+		}
+	}
+	if config.MaxRoutes > 1 && config.Combiner == nil {
+		return fmt.Errorf("flow %s: a combiner is required to take %d routes", config.Name, config.MaxRoutes)
+	}
+	return nil
+}
+
+// parseRouteScores parses the confidences answered by a scoring router.
+func parseRouteScores(text string) (map[string]float64, error) {
+	output, err := blades.ParseStructured[routerOutput](text)
+	if err != nil {
+		return nil, err
+	}
+	scores := make(map[string]float64, len(output.Routes))
+	for _, route := range output.Routes {
+		scores[strings.TrimSpace(route.Agent)] = route.Confidence
+	}
+	return scores, nil
+}
+
+// rank returns the routes to take: those with a positive confidence of at
+// least the minimum, most confident first and ties in declaration order.
+func (a *HandoffAgent) rank(scores map[string]float64) []string {
+	var ranked []string
+	for _, route := range a.routes {
+		if score := scores[route]; score > 0 && score >= a.minConfidence {
+			ranked = append(ranked, route)
+		}
+	}
+	slices.SortStableFunc(ranked, func(x, y string) int {
+		return cmp.Compare(scores[y], scores[x])
+	})
+	return ranked[:min(len(ranked), a.maxRoutes)]
+}
+
+// runScored routes the request with the confidences answered by the routing agent.
+func (a *HandoffAgent) runScored(ctx context.Context, invocation *blades.Invocation) blades.Generator[*blades.Message, error] {
+	return func(yield func(*blades.Message, error) bool) {
+		var (
+			output  string
+			input   = invocation.Clone()
+			started = time.Now()
+		)
+		for message, err := range a.Agent.Run(ctx, invocation) {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if message != nil && message.Role == blades.RoleAssistant && message.Status == blades.StatusCompleted {
+				output = message.Text()
+			}
+		}
+		record := RoutingRecord{
+			InvocationID: invocation.ID,
+			Router:       a.Name(),
+			Candidates:   a.candidates,
+			Latency:      time.Since(started),
+		}
+		scores, err := parseRouteScores(output)
+		routes := a.rank(scores)
+		if err == nil && len(routes) == 0 && a.fallback != "" {
+			routes, record.Fallback = []string{a.fallback}, true
+		}
+		record.Scores = scores
+		if err != nil || len(routes) == 0 {
+			err := &RouteError{Router: a.Name(), Output: output}
+			record.Error = err.Error()
+			RecordRouting(ctx, invocation.Session, record)
+			yield(nil, err)
+			return
+		}
+		record.Selected, record.Routes = routes[0], routes
+		if !record.Fallback {
+			confidence := scores[routes[0]]
+			record.Confidence = &confidence
+		}
+		RecordRouting(ctx, invocation.Session, record)
+		if len(routes) == 1 {
+			a.handoff(ctx, input, a.targets[routes[0]], record, yield)
+			return
+		}
+		a.combine(ctx, input, routes, record, yield)
+	}
+}
+
+// combine runs the routes in parallel, then the combiner on their answers.
+func (a *HandoffAgent) combine(ctx context.Context, input *blades.Invocation, routes []string, record RoutingRecord, yield func(*blades.Message, error) bool) {
+	agents := make([]blades.Agent, 0, len(routes))
+	for _, route := range routes {
+		agents = append(agents, a.targets[route])
+	}
+	parallel, err := NewParallelAgent(ParallelConfig{Name: a.Name(), SubAgents: agents})
+	if err != nil {
+		yield(nil, err)
+		return
+	}
+	answers := make(map[string]string, len(routes))
+	for message, err := range blades.MarkFinal(parallel.Run(ctx, input), false) {
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		if message != nil && message.Role == blades.RoleAssistant && message.Status == blades.StatusCompleted {
+			answers[message.Author] = message.Text()
+		}
+		attachRouting(message, record)
+		if !yield(message, nil) {
+			return
+		}
+	}
+	combiner := input.Child(a.combiner.Name())
+	combiner.Message = blades.UserMessage(combinePrompt(input.Message, routes, answers))
+	for message, err := range blades.MarkFinal(a.combiner.Run(ctx, combiner), true) {
+		attachRouting(message, record)
+		if !yield(message, err) {
+			return
+		}
+	}
+}
+
+// combinePrompt asks the combiner to synthesize the answers of the routes.
+func combinePrompt(question *blades.Message, routes []string, answers map[string]string) string {
+	var b strings.Builder
+	b.WriteString("The question was routed to several agents. Combine their answers into one answer to the question.\n\nQuestion:\n")
+	if question != nil {
+		b.WriteString(question.Text())
+	}
+	for _, route := range routes {
+		fmt.Fprintf(&b, "\n\nAnswer of %s:\n%s", route, answers[route])
+	}
+	return b.String()
+}
@@ -0,0 +1,160 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-kratos/blades"
+)
+
+// lastMessageModel replies with the text of the last message of the request.
+type lastMessageModel struct{}
+
+func (m *lastMessageModel) Name() string { return "last-message" }
+
+func (m *lastMessageModel) Generate(ctx context.Context, req *blades.ModelRequest) (*blades.ModelResponse, error) {
+	return (&echoModel{text: req.Messages[len(req.Messages)-1].Text()}).Generate(ctx, req)
+}
+
+func (m *lastMessageModel) NewStreaming(ctx context.Context, req *blades.ModelRequest) blades.Generator[*blades.ModelResponse, error] {
+	return func(yield func(*blades.ModelResponse, error) bool) {
+		res, err := m.Generate(ctx, req)
+		yield(res, err)
+	}
+}
+
+func TestHandoffAgentScoredRouting(t *testing.T) {
+	newAgent := func(name, text string) blades.Agent {
+		agent, err := blades.NewAgent(name, blades.WithDescription(name+" tutor"), blades.WithModel(&echoModel{text: text}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return agent
+	}
+	math, history, art, general := newAgent("math", "4"), newAgent("history", "1066"), newAgent("art", "Monet"), newAgent("general", "I can help")
+	combiner, err := blades.NewAgent("combiner", blades.WithModel(&lastMessageModel{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	score := func(s float64) *float64 { return &s }
+	tests := []struct {
+		name       string
+		output     string
+		config     HandoffConfig
+		wantErr    error
+		answer     string
+		routes     []string
+		confidence *float64
+		fallback   bool
+	}{
+		{
+			name:       "most confident",
+			output:     `{"routes":[{"agent":"math","confidence":0.3},{"agent":"history","confidence":0.9},{"agent":"art","confidence":0.1}]}`,
+			config:     HandoffConfig{MinConfidence: 0.5},
+			answer:     "1066",
+			routes:     []string{"history"},
+			confidence: score(0.9),
+		},
+		{
+			name:       "tie",
+			output:     "Scores:\n```json\n{\"routes\":[{\"agent\":\"history\",\"confidence\":0.7},{\"agent\":\"math\",\"confidence\":0.7}]}\n```",
+			config:     HandoffConfig{MinConfidence: 0.5},
+			answer:     "4",
+			routes:     []string{"math"},
+			confidence: score(0.7),
+		},
+		{
+			name:     "all below threshold",
+			output:   `{"routes":[{"agent":"math","confidence":0.2},{"agent":"history","confidence":0.4}]}`,
+			config:   HandoffConfig{MinConfidence: 0.5, Fallback: "general"},
+			answer:   "I can help",
+			routes:   []string{"general"},
+			fallback: true,
+		},
+		{
+			name:    "all below threshold without fallback",
+			output:  `{"routes":[{"agent":"math","confidence":0.2},{"agent":"history","confidence":0.4}]}`,
+			config:  HandoffConfig{MinConfidence: 0.5},
+			wantErr: ErrNoRouteSelected,
+		},
+		{
+			name:    "invalid output",
+			output:  "math",
+			config:  HandoffConfig{Fallback: "general"},
+			wantErr: ErrNoRouteSelected,
+		},
+		{
+			name:       "multi-route",
+			output:     `{"routes":[{"agent":"math","confidence":0.6},{"agent":"history","confidence":0.8},{"agent":"art","confidence":0.6}]}`,
+			config:     HandoffConfig{MinConfidence: 0.5, MaxRoutes: 2, Combiner: combiner},
+			answer:     "Question:\nWhen was 2+2 first written down?\n\nAnswer of history:\n1066\n\nAnswer of math:\n4",
+			routes:     []string{"history", "math"},
+			confidence: score(0.8),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			config.Name = "triage"
+			config.Model = &echoModel{text: tt.output}
+			config.SubAgents = []blades.Agent{math, history, art, general}
+			triage, err := NewHandoffAgent(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			session := blades.NewSession()
+			var messages []*blades.Message
+			for m, err := range blades.NewRunner(triage).RunStream(context.Background(), blades.UserMessage("When was 2+2 first written down?"), blades.WithSession(session)) {
+				if err != nil {
+					messages = append(messages, nil)
+					if !errors.Is(err, tt.wantErr) {
+						t.Fatalf("want %v, got %v", tt.wantErr, err)
+					}
+					break
+				}
+				messages = append(messages, m)
+			}
+			records := RoutingRecords(session, "triage")
+			if len(records) != 1 {
+				t.Fatalf("want one routing record, got %+v", records)
+			}
+			record := records[0]
+			if tt.wantErr != nil {
+				if messages[len(messages)-1] != nil || record.Error == "" || record.Selected != "" {
+					t.Fatalf("want a routing error, got %+v", record)
+				}
+				return
+			}
+			if len(record.Scores) == 0 || !reflect.DeepEqual(record.Routes, tt.routes) || record.Selected != tt.routes[0] || record.Fallback != tt.fallback || !reflect.DeepEqual(record.Confidence, tt.confidence) {
+				t.Fatalf("unexpected routing record %+v", record)
+			}
+			answer := messages[len(messages)-1]
+			if !strings.HasSuffix(answer.Text(), tt.answer) || !answer.Final {
+				t.Fatalf("want the final answer %q, got %q", tt.answer, answer.Text())
+			}
+			if got, ok := RoutingFromMessage(answer); !ok || !reflect.DeepEqual(got.Routes, tt.routes) {
+				t.Fatalf("want the routing record in the metadata, got %v", answer.Metadata)
+			}
+			for _, m := range messages[:len(messages)-1] {
+				if m.Final {
+					t.Fatalf("want the answers of the routes intermediate, got %q from %s", m.Text(), m.Author)
+				}
+			}
+		})
+	}
+
+	for _, config := range []HandoffConfig{
+		{MaxRoutes: 2},
+		{Fallback: "physics"},
+		{MinConfidence: 1.5},
+		{Fallback: "general", Transfers: map[string][]string{"triage": {"math"}}},
+	} {
+		config.Name, config.Model, config.SubAgents = "triage", &echoModel{}, []blades.Agent{math, general}
+		if _, err := NewHandoffAgent(config); err == nil {
+			t.Fatalf("want an error for %+v", config)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/go-kratos/blades"
+)
+
+// handoffModel hands off to a fixed agent on the first call and replies with an empty text afterwards.
+type handoffModel struct {
+	target string
+}
+
+func (m *handoffModel) Name() string { return "handoff" }
+
+func (m *handoffModel) Generate(ctx context.Context, req *blades.ModelRequest) (*blades.ModelResponse, error) {
+	if last := req.Messages[len(req.Messages)-1]; last.Role == blades.RoleTool {
+		return &blades.ModelResponse{Message: blades.NewAssistantMessage(blades.StatusCompleted)}, nil
+	}
+	message := &blades.Message{Role: blades.RoleTool, Status: blades.StatusCompleted, Parts: []blades.Part{
+		blades.ToolPart{ID: "call-1", Name: "handoff_to_agent", Request: `{"agentName":"` + m.target + `"}`},
+	}}
+	return &blades.ModelResponse{Message: message}, nil
+}
+
+func (m *handoffModel) NewStreaming(ctx context.Context, req *blades.ModelRequest) blades.Generator[*blades.ModelResponse, error] {
+	return func(yield func(*blades.ModelResponse, error) bool) {
+		res, err := m.Generate(ctx, req)
+		yield(res, err)
+	}
+}
+
+func TestHandoffAgentRouting(t *testing.T) {
+	math, err := blades.NewAgent("math", blades.WithDescription("Math tutor"), blades.WithModel(&echoModel{text: "4"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err := blades.NewAgent("history", blades.WithDescription("History tutor"), blades.WithModel(&echoModel{text: "1066"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		target   string
+		wantErr  error
+		selected string
+	}{
+		{name: "selected", target: "math", selected: "math"},
+		{name: "unknown target", target: "physics", wantErr: ErrNoRouteSelected},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			triage, err := NewHandoffAgent(HandoffConfig{
+				Name:      "triage",
+				Model:     &handoffModel{target: tt.target},
+				SubAgents: []blades.Agent{math, history},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			session := blades.NewSession()
+			output, err := blades.NewRunner(triage).Run(context.Background(), blades.UserMessage("2+2?"), blades.WithSession(session))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("want %v, got %v", tt.wantErr, err)
+			}
+			records := RoutingRecords(session, "triage")
+			if len(records) != 1 {
+				t.Fatalf("expected one routing record, got %v", records)
+			}
+			record := records[0]
+			if record.Router != "triage" || record.Selected != tt.selected || len(record.Candidates) != 2 {
+				t.Fatalf("unexpected routing record: %+v", record)
+			}
+			if tt.wantErr != nil {
+				var routeErr *RouteError
+				if !errors.As(err, &routeErr) || routeErr.Output != tt.target || record.Error == "" {
+					t.Fatalf("expected a route error with the router output, got %v (record %+v)", err, record)
+				}
+				return
+			}
+			if got, ok := RoutingFromMessage(output); !ok || got.Selected != tt.selected {
+				t.Fatalf("expected routing metadata on the final message, got %+v", output.Metadata)
+			}
+		})
+	}
+}
+
+func TestHandoffAgentTransfers(t *testing.T) {
+	newAgent := func(name, target string) blades.Agent {
+		agent, err := blades.NewAgent(name, blades.WithModel(&handoffModel{target: target}), blades.WithTools(NewHandoffTool()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return agent
+	}
+	answer, err := blades.NewAgent("answer", blades.WithModel(&echoModel{text: "done"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		subAgents []blades.Agent
+		transfers map[string][]string
+		opts      []blades.RunnerOption
+		wantErr   error
+		wantChain []string
+	}{
+		{
+			name:      "handed on",
+			subAgents: []blades.Agent{newAgent("a", "answer"), answer},
+			wantChain: []string{"triage", "a", "answer"},
+		},
+		{
+			name:      "back-transfer loop",
+			subAgents: []blades.Agent{newAgent("a", "b"), newAgent("b", "a")},
+			wantErr:   blades.ErrTransferLoop,
+			wantChain: []string{"triage", "a", "b", "a"},
+		},
+		{
+			name:      "not allowed",
+			subAgents: []blades.Agent{newAgent("a", "answer"), answer},
+			transfers: map[string][]string{"triage": {"a"}},
+			wantErr:   blades.ErrTransferNotAllowed,
+			wantChain: []string{"triage", "a", "answer"},
+		},
+		{
+			name:      "depth exceeded",
+			subAgents: []blades.Agent{newAgent("a", "answer"), answer},
+			opts:      []blades.RunnerOption{blades.WithMaxTransferDepth(1)},
+			wantErr:   blades.ErrTransferDepthExceeded,
+			wantChain: []string{"triage", "a", "answer"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			triage, err := NewHandoffAgent(HandoffConfig{
+				Name:      "triage",
+				Model:     &handoffModel{target: "a"},
+				SubAgents: tt.subAgents,
+				Transfers: tt.transfers,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			output, err := blades.NewRunner(triage, tt.opts...).Run(context.Background(), blades.UserMessage("help"))
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := output.Metadata[blades.TransferChainKey]; !reflect.DeepEqual(got, tt.wantChain) {
+					t.Fatalf("want the transfer chain %v in the metadata, got %v", tt.wantChain, got)
+				}
+				return
+			}
+			var transferErr *blades.TransferError
+			if !errors.Is(err, tt.wantErr) || !errors.As(err, &transferErr) {
+				t.Fatalf("want %v, got %v", tt.wantErr, err)
+			}
+			if !reflect.DeepEqual(transferErr.Chain, tt.wantChain) {
+				t.Fatalf("want the transfer chain %v, got %v", tt.wantChain, transferErr.Chain)
+			}
+		})
+	}
+
+	_, err = NewHandoffAgent(HandoffConfig{
+		Name:      "triage",
+		Model:     &handoffModel{target: "a"},
+		SubAgents: []blades.Agent{answer},
+		Transfers: map[string][]string{"triage": {"missing"}},
+	})
+	if err == nil {
+		t.Fatal("want an error for an unknown transfer target")
+	}
+}
+
+func TestFlowDuplicateClones(t *testing.T) {
+	tutor, err := blades.NewAgent("tutor", blades.WithModel(&echoModel{text: "4"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clone, err := blades.CloneAgent(tutor, blades.WithModel(&echoModel{text: "four"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	renamed, err := blades.CloneAgent(tutor, blades.WithName("tutor-cheap"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewHandoffAgent(HandoffConfig{Name: "triage", Model: &handoffModel{}, SubAgents: []blades.Agent{tutor, clone}}); !errors.Is(err, ErrDuplicateAgentName) {
+		t.Fatalf("handoff: want ErrDuplicateAgentName, got %v", err)
+	}
+	if _, err := NewHandoffAgent(HandoffConfig{Name: "triage", Model: &handoffModel{}, SubAgents: []blades.Agent{tutor, renamed}}); err != nil {
+		t.Fatalf("handoff: %v", err)
+	}
+	if _, err := NewSequentialAgent(SequentialConfig{Name: "pipeline", SubAgents: []blades.Agent{tutor, clone}}); !errors.Is(err, ErrDuplicateAgentName) {
+		t.Fatalf("sequential: want ErrDuplicateAgentName, got %v", err)
+	}
+	if _, err := NewLoopAgent(LoopConfig{Name: "loop", SubAgents: []blades.Agent{tutor, clone}}); !errors.Is(err, ErrDuplicateAgentName) {
+		t.Fatalf("loop: want ErrDuplicateAgentName, got %v", err)
+	}
+}
+
+func TestHandoffAgentRoutingInParallel(t *testing.T) {
+	router := func(name, target string) blades.Agent {
+		math, err := blades.NewAgent("math", blades.WithDescription("Math tutor"), blades.WithModel(&echoModel{text: "4"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		history, err := blades.NewAgent("history", blades.WithDescription("History tutor"), blades.WithModel(&echoModel{text: "1066"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		agent, err := NewHandoffAgent(HandoffConfig{
+			Name:      name,
+			Model:     &handoffModel{target: target},
+			SubAgents: []blades.Agent{math, history},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return agent
+	}
+	parallel, err := NewParallelAgent(ParallelConfig{
+		Name:      "both",
+		SubAgents: []blades.Agent{router("first", "math"), router("second", "history")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := blades.NewSession()
+	if _, err := blades.NewRunner(parallel).Run(context.Background(), blades.UserMessage("2+2?"), blades.WithSession(session)); err != nil {
+		t.Fatal(err)
+	}
+	// The records survive an export of the session to JSON.
+	data, err := blades.ExportSession(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := blades.ImportSession(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for router, selected := range map[string]string{"first": "math", "second": "history"} {
+		records := RoutingRecords(restored, router)
+		if len(records) != 1 || records[0].Selected != selected {
+			t.Fatalf("router %s: want one record selecting %s, got %+v", router, selected, records)
+		}
+	}
+}
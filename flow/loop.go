@@ -2,13 +2,42 @@ package flow
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
 
 	"github.com/go-kratos/blades"
+	"github.com/go-kratos/blades/expr"
 )
 
 // LoopCondition is a function that determines whether to continue looping.
+// The session of the run is available through blades.FromSessionContext, so
+// the condition can read the values stored by output keys.
 type LoopCondition func(ctx context.Context, output *blades.Message) (bool, error)
 
+// ConditionExpr compiles an expression into a LoopCondition that continues
+// the loop while it is true, so conditions can be defined in config files;
+// see package expr for the syntax. The expression reads the session state as
+// "state" and the text of the iteration output as "output":
+//
+//	state.revision < 3 && !contains(output, 'APPROVED')
+func ConditionExpr(src string) (LoopCondition, error) {
+	e, err := expr.Compile(src)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, output *blades.Message) (bool, error) {
+		var state map[string]any
+		if session, ok := blades.FromSessionContext(ctx); ok {
+			state = session.State()
+		}
+		ok, err := e.Bool(map[string]any{"state": state, "output": output.Text()})
+		if err != nil {
+			return false, fmt.Errorf("loop condition %q: %w", src, err)
+		}
+		return ok, nil
+	}, nil
+}
+
 // LoopConfig is the configuration for a LoopAgent.
 type LoopConfig struct {
 	Name          string
@@ -16,6 +45,12 @@ type LoopConfig struct {
 	MaxIterations int
 	Condition     LoopCondition
 	SubAgents     []blades.Agent
+	// StateKeys lists the session state keys set before the flow runs, which
+	// sub-agent instructions may read in addition to earlier output keys.
+	StateKeys []string
+	// Logger receives the warnings about state keys that the sub-agents read
+	// and no earlier step provides. Defaults to slog.Default().
+	Logger *slog.Logger
 }
 
 // loopAgent is an agent that runs sub-agents in a loop.
@@ -24,11 +59,33 @@ type loopAgent struct {
 }
 
 // NewLoopAgent creates a new LoopAgent.
-func NewLoopAgent(config LoopConfig) blades.Agent {
+// It returns an error if two sub-agents share a name or an output key.
+func NewLoopAgent(config LoopConfig) (blades.Agent, error) {
+	if err := validateSubAgents(config.Name, config.SubAgents, nil); err != nil {
+		return nil, err
+	}
 	if config.MaxIterations <= 0 {
 		config.MaxIterations = 1
 	}
-	return &loopAgent{config: config}
+	// Keys produced later in the loop are only available from the second
+	// iteration, so the first iteration is checked like a sequence.
+	warnUnresolvedStateKeys(config.Logger, config.Name, config.SubAgents, config.StateKeys)
+	return &loopAgent{config: config}, nil
+}
+
+// outputKeys returns the output keys of the sub-agents.
+func (a *loopAgent) outputKeys() []string {
+	return collectOutputKeys(a.config.SubAgents)
+}
+
+// requiredStateKeys returns the keys the sub-agents read that the flow does not produce.
+func (a *loopAgent) requiredStateKeys() []string {
+	return unresolvedKeyNames(unresolvedStateKeys(a.config.SubAgents, a.config.StateKeys))
+}
+
+// SubAgents returns the sub-agents of the flow.
+func (a *loopAgent) SubAgents() []blades.Agent {
+	return a.config.SubAgents
 }
 
 // Name returns the name of the agent.
@@ -43,25 +100,39 @@ func (a *loopAgent) Description() string {
 
 // Run runs the sub-agents loop.
 func (a *loopAgent) Run(ctx context.Context, input *blades.Invocation) blades.Generator[*blades.Message, error] {
-	return func(yield func(*blades.Message, error) bool) {
+	ctx = blades.NewPathContext(ctx, a.Name())
+	return blades.PathErrors(ctx, func(yield func(*blades.Message, error) bool) {
 		for iteration := 0; iteration < a.config.MaxIterations; iteration++ {
 			for _, agent := range a.config.SubAgents {
 				var (
 					err        error
 					message    *blades.Message
-					invocation = input.Clone()
+					last       *blades.Message
+					invocation = input.Child(fmt.Sprintf("%s.%d", agent.Name(), iteration))
 				)
-				for message, err = range agent.Run(ctx, invocation) {
+				// Check the limits between iterations, so a loop whose sub-agents stay within
+				// their own limits still stops once the whole run exceeds them.
+				if err := blades.CheckLimits(ctx, agent.Name(), invocation); err != nil {
+					yieldFailure(yield, agent, invocation, nil, err)
+					return
+				}
+				// The output of an iteration is intermediate; the enclosing flow
+				// or runner marks the last one as the final answer.
+				for message, err = range blades.MarkFinal(agent.Run(ctx, invocation), false) {
 					if err != nil {
-						yield(nil, err)
+						yieldFailure(yield, agent, invocation, last, err)
 						return
 					}
 					if !yield(message, nil) {
 						return
 					}
+					last = message
+				}
+				if message != nil && (message.Status == blades.StatusCancelled || message.Status == blades.StatusNeedsInput) {
+					return
 				}
 				if a.config.Condition != nil && message != nil {
-					shouldContinue, err := a.config.Condition(ctx, message)
+					shouldContinue, err := a.config.Condition(conditionContext(ctx, invocation), message)
 					if err != nil {
 						yield(nil, err)
 						return
@@ -72,5 +143,14 @@ func (a *loopAgent) Run(ctx context.Context, input *blades.Invocation) blades.Ge
 				}
 			}
 		}
+	})
+}
+
+// conditionContext returns the context of the loop condition, which carries
+// the session of the invocation.
+func conditionContext(ctx context.Context, invocation *blades.Invocation) context.Context {
+	if invocation.Session == nil {
+		return ctx
 	}
+	return blades.NewSessionContext(ctx, invocation.Session)
 }
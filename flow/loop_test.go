@@ -0,0 +1,191 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/blades"
+	"github.com/go-kratos/blades/tools"
+)
+
+// adversarialModel calls a tool, then answers, spending tokens and time on every call.
+type adversarialModel struct{}
+
+func (m *adversarialModel) Name() string { return "adversarial" }
+
+func (m *adversarialModel) Generate(ctx context.Context, req *blades.ModelRequest) (*blades.ModelResponse, error) {
+	select {
+	case <-time.After(time.Millisecond):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	last := req.Messages[len(req.Messages)-1]
+	if last.Role != blades.RoleTool {
+		message := &blades.Message{
+			ID:     blades.NewMessageID(),
+			Role:   blades.RoleTool,
+			Status: blades.StatusCompleted,
+			Parts:  []blades.Part{blades.ToolPart{ID: "call", Name: "noop", Request: "{}"}},
+		}
+		message.TokenUsage.TotalTokens = 10
+		return &blades.ModelResponse{Message: message}, nil
+	}
+	message := blades.NewAssistantMessage(blades.StatusCompleted)
+	message.Parts = blades.Parts("again")
+	message.TokenUsage.TotalTokens = 10
+	return &blades.ModelResponse{Message: message}, nil
+}
+
+func (m *adversarialModel) NewStreaming(ctx context.Context, req *blades.ModelRequest) blades.Generator[*blades.ModelResponse, error] {
+	return func(yield func(*blades.ModelResponse, error) bool) {
+		yield(m.Generate(ctx, req))
+	}
+}
+
+// newEndlessLoop returns a loop that would run its worker a million times.
+func newEndlessLoop(t *testing.T, name string, subAgent blades.Agent) blades.Agent {
+	t.Helper()
+	loop, err := NewLoopAgent(LoopConfig{
+		Name:          name,
+		MaxIterations: 1_000_000,
+		SubAgents:     []blades.Agent{subAgent},
+		Condition: func(ctx context.Context, output *blades.Message) (bool, error) {
+			return true, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loop
+}
+
+func TestLoopAgentLimits(t *testing.T) {
+	noop := tools.NewTool("noop", "Does nothing.", tools.HandleFunc(func(context.Context, string) (string, error) {
+		return "ok", nil
+	}))
+	worker, err := blades.NewAgent("worker", blades.WithModel(&adversarialModel{}), blades.WithTools(noop))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		limits blades.Limits
+		agent  blades.Agent
+		want   blades.Limit
+	}{
+		{"tokens", blades.Limits{MaxTotalTokens: 100}, newEndlessLoop(t, "loop", worker), blades.LimitTotalTokens},
+		{"tool calls", blades.Limits{MaxToolCalls: 5}, newEndlessLoop(t, "loop", worker), blades.LimitToolCalls},
+		{"wall time", blades.Limits{MaxWallTime: 20 * time.Millisecond}, newEndlessLoop(t, "loop", worker), blades.LimitWallTime},
+		{"depth", blades.Limits{MaxSubAgentDepth: 1}, newEndlessLoop(t, "outer", newEndlessLoop(t, "inner", worker)), blades.LimitSubAgentDepth},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := blades.NewRunner(tt.agent, blades.WithLimits(tt.limits))
+			done := make(chan struct{})
+			var runErr error
+			go func() {
+				defer close(done)
+				_, runErr = runner.Run(context.Background(), blades.UserMessage("go"))
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("the limit did not terminate the loop")
+			}
+			var limitErr *blades.LimitError
+			if !errors.As(runErr, &limitErr) || !errors.Is(runErr, blades.ErrLimitExceeded) {
+				t.Fatalf("want a LimitError, got %v", runErr)
+			}
+			if limitErr.Limit != tt.want || limitErr.Agent != "worker" {
+				t.Fatalf("want %s exceeded by worker, got %s by %s", tt.want, limitErr.Limit, limitErr.Agent)
+			}
+		})
+	}
+}
+
+// scoringModel answers with a review whose score rises on every call.
+type scoringModel struct {
+	calls int
+}
+
+func (m *scoringModel) Name() string { return "scoring" }
+
+func (m *scoringModel) Generate(ctx context.Context, req *blades.ModelRequest) (*blades.ModelResponse, error) {
+	m.calls++
+	message := blades.NewAssistantMessage(blades.StatusCompleted)
+	message.Parts = blades.Parts(fmt.Sprintf(`{"score": %d}`, m.calls*3))
+	return &blades.ModelResponse{Message: message}, nil
+}
+
+func (m *scoringModel) NewStreaming(ctx context.Context, req *blades.ModelRequest) blades.Generator[*blades.ModelResponse, error] {
+	return func(yield func(*blades.ModelResponse, error) bool) {
+		yield(m.Generate(ctx, req))
+	}
+}
+
+func TestLoopConditionReadsOutputKey(t *testing.T) {
+	model := &scoringModel{}
+	reviewer, err := blades.NewAgent("reviewer", blades.WithModel(model), blades.WithOutputKeyJSON("review"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	loop, err := NewLoopAgent(LoopConfig{
+		Name:          "review-loop",
+		MaxIterations: 10,
+		SubAgents:     []blades.Agent{reviewer},
+		Condition: func(ctx context.Context, output *blades.Message) (bool, error) {
+			session, ok := blades.FromSessionContext(ctx)
+			if !ok {
+				return false, blades.ErrNoSessionContext
+			}
+			review, _ := session.State()["review"].(map[string]any)
+			score, _ := review["score"].(float64)
+			return score < 8, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	invocation := &blades.Invocation{Session: blades.NewSession(), Message: blades.UserMessage("review the draft")}
+	for _, err := range loop.Run(context.Background(), invocation) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if model.calls != 3 {
+		t.Fatalf("expected the loop to stop at score 9 after 3 calls, got %d", model.calls)
+	}
+}
+
+func TestLoopConditionExpr(t *testing.T) {
+	model := &scoringModel{}
+	reviewer, err := blades.NewAgent("reviewer", blades.WithModel(model), blades.WithOutputKeyJSON("review"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	condition, err := ConditionExpr("state.review.score < 8 && !contains(lower(output), 'approved')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	loop, err := NewLoopAgent(LoopConfig{
+		Name:          "review-loop",
+		MaxIterations: 10,
+		SubAgents:     []blades.Agent{reviewer},
+		Condition:     condition,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	invocation := &blades.Invocation{Session: blades.NewSession(), Message: blades.UserMessage("review the draft")}
+	for _, err := range loop.Run(context.Background(), invocation) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if model.calls != 3 {
+		t.Fatalf("expected the loop to stop at score 9 after 3 calls, got %d", model.calls)
+	}
+}
@@ -2,26 +2,86 @@ package flow
 
 import (
 	"context"
+	"slices"
 
 	"github.com/go-kratos/blades"
-	"golang.org/x/sync/errgroup"
+	"github.com/go-kratos/blades/stream"
 )
 
+// BranchStateKeyPrefix prefixes the session state keys of the BranchRecords
+// of resumable runs, which end with the invocation ID of the branch.
+const BranchStateKeyPrefix = "blades.branch:"
+
+// BranchRecord is the record of a branch of a ParallelAgent that completed in
+// a resumable run, stored in the session state so that resuming the run does
+// not run the branch again.
+type BranchRecord struct {
+	Agent        string `json:"agent"`
+	InvocationID string `json:"invocationId"`
+	// Messages are the messages the branch yielded, without streamed deltas.
+	Messages []*blades.Message `json:"messages"`
+	// Writes are the state writes of the branch.
+	Writes []blades.StateWrite `json:"writes"`
+	// Committed reports whether the writes were applied to the session.
+	Committed bool `json:"committed"`
+}
+
+// MergeFunc combines the value already stored under a session key with a new one.
+type MergeFunc func(existing, value any) any
+
 // ParallelConfig is the configuration for a ParallelAgent.
 type ParallelConfig struct {
 	Name        string
 	Description string
 	SubAgents   []blades.Agent
+	// MergeKeys lists the session keys that several branches may write, with
+	// the function that merges their values. Writing any other key from more
+	// than one branch fails the run.
+	MergeKeys map[string]MergeFunc
+	// FinalAgent names the branch whose output is the final answer of the
+	// flow; it defaults to the last declared branch, whatever the order the
+	// branches finish in. The output of the others is intermediate.
+	FinalAgent string
 }
 
 // parallelAgent is an agent that runs sub-agents in parallel.
 type parallelAgent struct {
 	config ParallelConfig
+	final  string
 }
 
 // NewParallelAgent creates a new ParallelAgent.
-func NewParallelAgent(config ParallelConfig) blades.Agent {
-	return &parallelAgent{config: config}
+// It returns an error if two sub-agents share a name, share an output key
+// that has no merge function in MergeKeys, or if FinalAgent is not a sub-agent.
+func NewParallelAgent(config ParallelConfig) (blades.Agent, error) {
+	if err := validateSubAgents(config.Name, config.SubAgents, config.MergeKeys); err != nil {
+		return nil, err
+	}
+	final, err := finalAgent(config.Name, config.SubAgents, config.FinalAgent)
+	if err != nil {
+		return nil, err
+	}
+	return &parallelAgent{config: config, final: final}, nil
+}
+
+// outputKeys returns the output keys of the sub-agents.
+func (p *parallelAgent) outputKeys() []string {
+	return collectOutputKeys(p.config.SubAgents)
+}
+
+// requiredStateKeys returns the keys the sub-agents read; branches cannot
+// depend on each other's output.
+func (p *parallelAgent) requiredStateKeys() []string {
+	var unresolved []unresolvedKey
+	for _, agent := range p.config.SubAgents {
+		unresolved = append(unresolved, unresolvedStateKeys([]blades.Agent{agent}, nil)...)
+	}
+	return unresolvedKeyNames(unresolved)
+}
+
+// SubAgents returns the branches of the flow.
+func (p *parallelAgent) SubAgents() []blades.Agent {
+	return p.config.SubAgents
 }
 
 // Name returns the name of the agent.
@@ -35,38 +95,125 @@ func (p *parallelAgent) Description() string {
 }
 
 // Run runs the sub-agents in parallel.
+// Messages are interleaved as they arrive, attributed to the sub-agent that
+// produced them. The first error cancels the remaining sub-agents.
+//
+// Each branch writes the session state through its own blades.StateOverlay,
+// so it reads its own writes while other branches do not see them. The writes
+// of a branch are applied atomically once it completes, in the order the
+// branches are declared; a branch that fails leaves no writes behind.
+//
+// The final answer of the final branch is marked with blades.Message.Final,
+// even if other branches finish after it.
+//
+// In resumable runs, each branch that completes is recorded in the session
+// state with a BranchRecord, keyed by its invocation ID. Resuming the run only
+// runs the branches without a record; the others yield their recorded
+// messages again and their writes are applied in their turn, as if they had
+// just run.
 func (p *parallelAgent) Run(ctx context.Context, invocation *blades.Invocation) blades.Generator[*blades.Message, error] {
-	return func(yield func(*blades.Message, error) bool) {
-		type result struct {
-			message *blades.Message
-			err     error
-		}
-		ch := make(chan result, len(p.config.SubAgents)*8)
+	ctx = blades.NewPathContext(ctx, p.Name())
+	return blades.PathErrors(ctx, func(yield func(*blades.Message, error) bool) {
 		ctx, cancel := context.WithCancel(ctx)
 		defer cancel()
-		eg, ctx := errgroup.WithContext(ctx)
-		for _, agent := range p.config.SubAgents {
-			eg.Go(func() error {
-				for message, err := range agent.Run(ctx, invocation.Clone()) {
-					if err != nil {
-						// Send error result and stop
-						ch <- result{message: nil, err: err}
-						return err
-					}
-					ch <- result{message: message, err: nil}
-				}
-				return nil
-			})
+		writes := newStateWrites(p.config.MergeKeys, len(p.config.SubAgents))
+		streams := make([]blades.Generator[*blades.Message, error], 0, len(p.config.SubAgents))
+		for i, agent := range p.config.SubAgents {
+			streams = append(streams, p.branch(ctx, invocation, writes, i, agent))
+		}
+		for message, err := range stream.Merge(streams...) {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(message, nil) {
+				return
+			}
+		}
+	})
+}
+
+// branch runs the i-th sub-agent and commits its state writes once it completes.
+func (p *parallelAgent) branch(ctx context.Context, invocation *blades.Invocation, writes *stateWrites, i int, agent blades.Agent) blades.Generator[*blades.Message, error] {
+	return func(yield func(*blades.Message, error) bool) {
+		defer writes.release(i)
+		branch := invocation.Child(agent.Name())
+		key := BranchStateKeyPrefix + branch.ID
+		if branch.Resumable && branch.Session != nil {
+			if record, ok := blades.DecodeState[BranchRecord](branch.Session.State()[key]); ok {
+				p.replay(ctx, branch.Session, writes, i, agent, key, record, yield)
+				return
+			}
+		}
+		branchCtx := ctx
+		var overlay *blades.StateOverlay
+		if branch.Session != nil {
+			overlay = blades.NewStateOverlay(branch.Session)
+			branch.Session = overlay
+			branchCtx = blades.NewSessionContext(ctx, overlay)
+		}
+		var last *blades.Message
+		var recorded []*blades.Message
+		for message, err := range blades.MarkFinal(agent.Run(branchCtx, branch), agent.Name() == p.final) {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if message != nil && message.Author == "" {
+				message.Author = agent.Name()
+			}
+			if branch.Resumable && message != nil && message.Status != blades.StatusIncomplete {
+				recorded = append(recorded, message.Clone())
+			}
+			last = message
+			if !yield(message, nil) {
+				return
+			}
+		}
+		if overlay == nil || last != nil && (last.Status == blades.StatusFailed || last.Status == blades.StatusCancelled) {
+			return
 		}
-		go func() {
-			eg.Wait()
-			close(ch)
-		}()
-		for res := range ch {
-			if !yield(res.message, res.err) {
-				cancel()
-				break
+		branchWrites := overlay.Discard()
+		if !branch.Resumable {
+			if err := writes.commit(ctx, i, agent.Name(), overlay.Session, branchWrites); err != nil {
+				yield(nil, err)
 			}
+			return
 		}
+		// The branch is recorded as soon as it completes, so that it is not run
+		// again on resume even if the run fails before its writes are committed.
+		record := BranchRecord{Agent: agent.Name(), InvocationID: branch.ID, Messages: recorded, Writes: slices.Clone(branchWrites)}
+		overlay.Session.PutState(ctx, key, record)
+		record.Committed = true
+		if err := writes.commit(ctx, i, agent.Name(), overlay.Session, branchWrites, blades.StateWrite{Key: key, Value: record}); err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+// replay yields the recorded messages of a branch that completed in an earlier
+// run, then applies its writes in its turn.
+func (p *parallelAgent) replay(ctx context.Context, session blades.Session, writes *stateWrites, i int, agent blades.Agent, key string, record BranchRecord, yield func(*blades.Message, error) bool) {
+	messages := func(yield func(*blades.Message, error) bool) {
+		for _, message := range record.Messages {
+			if !yield(message.Clone(), nil) {
+				return
+			}
+		}
+	}
+	for message := range blades.MarkFinal(messages, agent.Name() == p.final) {
+		if !yield(message, nil) {
+			return
+		}
+	}
+	var err error
+	if record.Committed {
+		err = writes.restore(ctx, i, agent.Name(), session, record.Writes)
+	} else {
+		record.Committed = true
+		err = writes.commit(ctx, i, agent.Name(), session, slices.Clone(record.Writes), blades.StateWrite{Key: key, Value: record})
+	}
+	if err != nil {
+		yield(nil, err)
 	}
 }
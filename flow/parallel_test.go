@@ -0,0 +1,461 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/blades"
+)
+
+// echoModel is a ModelProvider that replies with a fixed text.
+type echoModel struct {
+	text string
+}
+
+func (m *echoModel) Name() string { return "echo" }
+
+func (m *echoModel) Generate(ctx context.Context, req *blades.ModelRequest) (*blades.ModelResponse, error) {
+	message := blades.NewAssistantMessage(blades.StatusCompleted)
+	message.Parts = blades.Parts(m.text)
+	return &blades.ModelResponse{Message: message}, nil
+}
+
+func (m *echoModel) NewStreaming(ctx context.Context, req *blades.ModelRequest) blades.Generator[*blades.ModelResponse, error] {
+	return func(yield func(*blades.ModelResponse, error) bool) {
+		res, err := m.Generate(ctx, req)
+		yield(res, err)
+	}
+}
+
+func TestParallelAgentConcurrentOutputKeys(t *testing.T) {
+	const n = 50
+	subAgents := make([]blades.Agent, 0, n)
+	for i := 0; i < n; i++ {
+		agent, err := blades.NewAgent(
+			fmt.Sprintf("agent-%d", i),
+			blades.WithModel(&echoModel{text: fmt.Sprint(i)}),
+			blades.WithOutputKey(fmt.Sprintf("out-%d", i)),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		subAgents = append(subAgents, agent)
+	}
+	parallel, err := NewParallelAgent(ParallelConfig{Name: "parallel", SubAgents: subAgents})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, streaming := range []bool{false, true} {
+		session := blades.NewSession()
+		runner := blades.NewRunner(parallel)
+		if streaming {
+			for _, err := range runner.RunStream(context.Background(), blades.UserMessage("go"), blades.WithSession(session)) {
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+		} else if _, err := runner.Run(context.Background(), blades.UserMessage("go"), blades.WithSession(session)); err != nil {
+			t.Fatal(err)
+		}
+		state := session.State()
+		for i := 0; i < n; i++ {
+			if got := state[fmt.Sprintf("out-%d", i)]; got != fmt.Sprint(i) {
+				t.Fatalf("streaming=%v: unexpected out-%d: %v", streaming, i, got)
+			}
+		}
+	}
+}
+
+func TestParallelAgentEarlyBreak(t *testing.T) {
+	subAgents := make([]blades.Agent, 0, 20)
+	for i := 0; i < 20; i++ {
+		agent, err := blades.NewAgent(fmt.Sprintf("agent-%d", i), blades.WithModel(&echoModel{text: "x"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		subAgents = append(subAgents, agent)
+	}
+	parallel, err := NewParallelAgent(ParallelConfig{Name: "parallel", SubAgents: subAgents})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range parallel.Run(context.Background(), &blades.Invocation{Message: blades.UserMessage("go")}) {
+		break
+	}
+}
+
+// stateAgent writes its name to a session key without declaring an output key.
+type stateAgent struct {
+	name, key string
+}
+
+func (a *stateAgent) Name() string        { return a.name }
+func (a *stateAgent) Description() string { return "" }
+
+func (a *stateAgent) Run(ctx context.Context, invocation *blades.Invocation) blades.Generator[*blades.Message, error] {
+	return func(yield func(*blades.Message, error) bool) {
+		invocation.Session.SetState(a.key, a.name)
+		yield(blades.AssistantMessage(a.name), nil)
+	}
+}
+
+func TestParallelAgentValidation(t *testing.T) {
+	newAgent := func(name, key string) blades.Agent {
+		agent, err := blades.NewAgent(name, blades.WithModel(&echoModel{text: name}), blades.WithOutputKey(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return agent
+	}
+	nested, err := NewSequentialAgent(SequentialConfig{Name: "nested", SubAgents: []blades.Agent{newAgent("c", "k1")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	concat := func(existing, value any) any { return fmt.Sprint(existing, "+", value) }
+	tests := []struct {
+		name    string
+		config  ParallelConfig
+		wantErr error
+	}{
+		{
+			name:   "unique",
+			config: ParallelConfig{SubAgents: []blades.Agent{newAgent("a", "k1"), newAgent("b", "k2")}},
+		},
+		{
+			name:    "duplicate name",
+			config:  ParallelConfig{SubAgents: []blades.Agent{newAgent("a", "k1"), newAgent("a", "k2")}},
+			wantErr: ErrDuplicateAgentName,
+		},
+		{
+			name:    "duplicate output key",
+			config:  ParallelConfig{SubAgents: []blades.Agent{newAgent("a", "k1"), newAgent("b", "k1")}},
+			wantErr: ErrDuplicateOutputKey,
+		},
+		{
+			name:    "duplicate output key in nested flow",
+			config:  ParallelConfig{SubAgents: []blades.Agent{newAgent("a", "k1"), nested}},
+			wantErr: ErrDuplicateOutputKey,
+		},
+		{
+			name: "merged output key",
+			config: ParallelConfig{
+				SubAgents: []blades.Agent{newAgent("a", "k1"), newAgent("b", "k1")},
+				MergeKeys: map[string]MergeFunc{"k1": concat},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Name = "parallel"
+			_, err := NewParallelAgent(tt.config)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("want %v, got %v", tt.wantErr, err)
+			}
+			_, err = NewSequentialAgent(SequentialConfig{Name: "sequential", SubAgents: tt.config.SubAgents})
+			if tt.config.MergeKeys == nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("sequential: want %v, got %v", tt.wantErr, err)
+			}
+			_, err = NewLoopAgent(LoopConfig{Name: "loop", SubAgents: tt.config.SubAgents})
+			if tt.config.MergeKeys == nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("loop: want %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParallelAgentStateCollision(t *testing.T) {
+	subAgents := []blades.Agent{&stateAgent{name: "a", key: "shared"}, &stateAgent{name: "b", key: "shared"}}
+	tests := []struct {
+		name      string
+		mergeKeys map[string]MergeFunc
+		wantErr   error
+	}{
+		{name: "no merge function", wantErr: ErrDuplicateOutputKey},
+		{name: "merge function", mergeKeys: map[string]MergeFunc{"shared": func(existing, value any) any {
+			return fmt.Sprint(existing, "+", value)
+		}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parallel, err := NewParallelAgent(ParallelConfig{Name: "parallel", SubAgents: subAgents, MergeKeys: tt.mergeKeys})
+			if err != nil {
+				t.Fatal(err)
+			}
+			session := blades.NewSession()
+			_, err = blades.NewRunner(parallel).Run(context.Background(), blades.UserMessage("go"), blades.WithSession(session))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("want %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr == nil {
+				if got := session.State()["shared"]; got != "a+b" && got != "b+a" {
+					t.Fatalf("expected merged state, got %v", got)
+				}
+			}
+		})
+	}
+}
+
+// instructionModel replies with the instruction it received.
+type instructionModel struct{}
+
+func (m *instructionModel) Name() string { return "instruction" }
+
+func (m *instructionModel) Generate(ctx context.Context, req *blades.ModelRequest) (*blades.ModelResponse, error) {
+	message := blades.NewAssistantMessage(blades.StatusCompleted)
+	message.Parts = blades.Parts(req.Instruction.Text())
+	return &blades.ModelResponse{Message: message}, nil
+}
+
+func (m *instructionModel) NewStreaming(ctx context.Context, req *blades.ModelRequest) blades.Generator[*blades.ModelResponse, error] {
+	return func(yield func(*blades.ModelResponse, error) bool) {
+		yield(m.Generate(ctx, req))
+	}
+}
+
+// writerAgent writes its keys one after another, checking that it reads its
+// own writes, and then fails with err if set.
+type writerAgent struct {
+	name string
+	keys []string
+	err  error
+}
+
+func (a *writerAgent) Name() string        { return a.name }
+func (a *writerAgent) Description() string { return "" }
+
+func (a *writerAgent) Run(ctx context.Context, invocation *blades.Invocation) blades.Generator[*blades.Message, error] {
+	return func(yield func(*blades.Message, error) bool) {
+		for _, key := range a.keys {
+			invocation.Session.SetState(key, a.name)
+			if got := invocation.Session.State()[key]; got != a.name {
+				yield(nil, fmt.Errorf("%s: want to read own write of %q, got %v", a.name, key, got))
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+		if a.err != nil {
+			yield(nil, a.err)
+			return
+		}
+		yield(blades.AssistantMessage(a.name), nil)
+	}
+}
+
+func TestParallelAgentTransactionalState(t *testing.T) {
+	writer, err := blades.NewAgent("writer", blades.WithModel(&echoModel{text: "first draft"}), blades.WithOutputKey("draft"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reviewer, err := blades.NewAgent("reviewer",
+		blades.WithModel(&instructionModel{}),
+		blades.WithInstruction("Review {{.draft}}"),
+		blades.WithOutputKey("review"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	drafting, err := NewSequentialAgent(SequentialConfig{Name: "drafting", SubAgents: []blades.Agent{writer, reviewer}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parallel, err := NewParallelAgent(ParallelConfig{Name: "parallel", SubAgents: []blades.Agent{
+		drafting,
+		&writerAgent{name: "a", keys: []string{"a1", "a2", "a3"}},
+		&writerAgent{name: "b", keys: []string{"b1", "b2", "b3"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := blades.NewSession()
+	// Readers see all the writes of a branch or none of them.
+	done := make(chan struct{})
+	readerErr := make(chan error, 1)
+	go func() {
+		defer close(readerErr)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			state := session.State()
+			for _, keys := range [][]string{{"a1", "a2", "a3"}, {"b1", "b2", "b3"}, {"draft", "review"}} {
+				n := 0
+				for _, key := range keys {
+					if _, ok := state[key]; ok {
+						n++
+					}
+				}
+				if n != 0 && n != len(keys) {
+					readerErr <- fmt.Errorf("observed a partial write of %v: %v", keys, state)
+					return
+				}
+			}
+		}
+	}()
+	_, err = blades.NewRunner(parallel).Run(context.Background(), blades.UserMessage("go"), blades.WithSession(session))
+	close(done)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-readerErr; err != nil {
+		t.Fatal(err)
+	}
+	state := session.State()
+	if got := state["review"]; got != "Review first draft" {
+		t.Fatalf("want the branch template to read its own write, got %v", got)
+	}
+	for _, key := range []string{"a1", "a2", "a3", "b1", "b2", "b3"} {
+		if state[key] == nil {
+			t.Fatalf("want %s committed, got %v", key, state)
+		}
+	}
+}
+
+func TestParallelAgentFailedBranchWrites(t *testing.T) {
+	failure := errors.New("branch failed")
+	parallel, err := NewParallelAgent(ParallelConfig{Name: "parallel", SubAgents: []blades.Agent{
+		&writerAgent{name: "ok", keys: []string{"ok"}},
+		&writerAgent{name: "bad", keys: []string{"bad1", "bad2"}, err: failure},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := blades.NewSession()
+	_, err = blades.NewRunner(parallel).Run(context.Background(), blades.UserMessage("go"), blades.WithSession(session))
+	if !errors.Is(err, failure) {
+		t.Fatalf("want the branch failure, got %v", err)
+	}
+	state := session.State()
+	if _, ok := state["bad1"]; ok {
+		t.Fatalf("want no writes from the failed branch, got %v", state)
+	}
+	if _, ok := state["bad2"]; ok {
+		t.Fatalf("want no writes from the failed branch, got %v", state)
+	}
+}
+
+// countingModel replies with a fixed text, or with the error of fail, and counts its calls.
+type countingModel struct {
+	text  string
+	calls atomic.Int64
+	fail  func(call int64) error
+}
+
+func (m *countingModel) Name() string { return "counting" }
+
+func (m *countingModel) Generate(ctx context.Context, req *blades.ModelRequest) (*blades.ModelResponse, error) {
+	call := m.calls.Add(1)
+	if m.fail != nil {
+		if err := m.fail(call); err != nil {
+			return nil, err
+		}
+	}
+	return (&echoModel{text: m.text}).Generate(ctx, req)
+}
+
+func (m *countingModel) NewStreaming(ctx context.Context, req *blades.ModelRequest) blades.Generator[*blades.ModelResponse, error] {
+	return func(yield func(*blades.ModelResponse, error) bool) {
+		res, err := m.Generate(ctx, req)
+		yield(res, err)
+	}
+}
+
+func TestParallelAgentResume(t *testing.T) {
+	for _, roundTrip := range []bool{false, true} {
+		t.Run(fmt.Sprintf("round trip %t", roundTrip), func(t *testing.T) {
+			testParallelAgentResume(t, roundTrip)
+		})
+	}
+}
+
+func testParallelAgentResume(t *testing.T, roundTrip bool) {
+	session := blades.NewSession()
+	records := func() int {
+		n := 0
+		for key := range session.State() {
+			if strings.HasPrefix(key, BranchStateKeyPrefix) {
+				n++
+			}
+		}
+		return n
+	}
+	models := make([]*countingModel, 5)
+	subAgents := make([]blades.Agent, 0, len(models))
+	for i := range models {
+		name := fmt.Sprintf("branch-%d", i+1)
+		models[i] = &countingModel{text: name}
+		agent, err := blades.NewAgent(name, blades.WithModel(models[i]), blades.WithOutputKey("out-"+name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		subAgents = append(subAgents, agent)
+	}
+	failure := errors.New("branch 3 failed")
+	models[2].fail = func(call int64) error {
+		if call > 1 {
+			return nil
+		}
+		// Fail once the other branches completed, so that none of them is cancelled.
+		for deadline := time.Now().Add(5 * time.Second); records() < 4 && time.Now().Before(deadline); {
+			time.Sleep(time.Millisecond)
+		}
+		return failure
+	}
+	parallel, err := NewParallelAgent(ParallelConfig{Name: "parallel", SubAgents: subAgents})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := blades.NewRunner(parallel, blades.WithResumable(true))
+	if _, err := runner.Run(context.Background(), blades.UserMessage("go"), blades.WithSession(session), blades.WithInvocationID("run-1")); !errors.Is(err, failure) {
+		t.Fatalf("want the branch failure, got %v", err)
+	}
+	if roundTrip {
+		// A session restored from JSON holds the records as maps.
+		data, err := blades.ExportSession(session)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if session, err = blades.ImportSession(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	answer, err := runner.Run(context.Background(), blades.UserMessage("go"), blades.WithSession(session), blades.WithInvocationID("run-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, model := range models {
+		want := int64(1)
+		if i == 2 {
+			want = 2
+		}
+		if got := model.calls.Load(); got != want {
+			t.Fatalf("want branch-%d invoked %d times, got %d", i+1, want, got)
+		}
+	}
+	state := session.State()
+	for i := range models {
+		name := fmt.Sprintf("branch-%d", i+1)
+		if got := state["out-"+name]; got != name {
+			t.Fatalf("want out-%s restored, got %v", name, got)
+		}
+		record, ok := blades.DecodeState[BranchRecord](state[BranchStateKeyPrefix+"run-1."+name])
+		if !ok || !record.Committed || record.Agent != name {
+			t.Fatalf("want a committed record of %s, got %+v", name, state[BranchStateKeyPrefix+"run-1."+name])
+		}
+	}
+
+	// The final answer is the one of a fresh run.
+	fresh, err := blades.NewRunner(parallel).Run(context.Background(), blades.UserMessage("go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer.Text() != fresh.Text() || !answer.Final || answer.Author != "branch-5" {
+		t.Fatalf("want the final answer %q of the last branch, got %q from %s", fresh.Text(), answer.Text(), answer.Author)
+	}
+}
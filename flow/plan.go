@@ -0,0 +1,472 @@
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/go-kratos/blades"
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+const (
+	// PlanKey is the metadata key of the Plan of a plan-and-execute agent on
+	// its final message, and the prefix of the session state key of the plan;
+	// see PlanStateKey.
+	PlanKey = "plan"
+	// PlanTaskKey is the metadata key of the PlanTask on the events yielded
+	// when a task starts and finishes.
+	PlanTaskKey = "plan_task"
+)
+
+var (
+	// ErrInvalidPlan is returned when a planner answers with a plan that cannot be executed.
+	ErrInvalidPlan = errors.New("invalid plan")
+	// ErrTaskBudgetExceeded is returned when a plan needs more task runs than MaxTasks.
+	ErrTaskBudgetExceeded = errors.New("task budget exceeded")
+	// ErrReplanLimitExceeded is returned when a task fails after MaxReplans replans.
+	ErrReplanLimitExceeded = errors.New("replan limit exceeded")
+)
+
+// TaskStatus is the execution status of a task of a plan.
+type TaskStatus string
+
+const (
+	// TaskPending indicates the task waits for its dependencies or its turn.
+	TaskPending TaskStatus = "pending"
+	// TaskRunning indicates the executor is working on the task.
+	TaskRunning TaskStatus = "running"
+	// TaskCompleted indicates the task is done and its result recorded.
+	TaskCompleted TaskStatus = "completed"
+	// TaskFailed indicates the executor failed the task.
+	TaskFailed TaskStatus = "failed"
+)
+
+// PlanTask is a step of a plan.
+type PlanTask struct {
+	ID          string     `json:"id"`
+	Description string     `json:"description"`
+	DependsOn   []string   `json:"dependsOn,omitempty"`
+	Status      TaskStatus `json:"status"`
+	Result      string     `json:"result,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// Plan is the task list of a plan-and-execute agent.
+type Plan struct {
+	Tasks []PlanTask `json:"tasks"`
+	// Replans counts the times the plan was revised after a failed task.
+	Replans int `json:"replans"`
+}
+
+// Done reports whether every task of the plan is completed.
+func (p Plan) Done() bool {
+	for _, task := range p.Tasks {
+		if task.Status != TaskCompleted {
+			return false
+		}
+	}
+	return true
+}
+
+// clone returns a copy of the plan that later status updates do not change.
+func (p Plan) clone() Plan {
+	tasks := make([]PlanTask, len(p.Tasks))
+	for i, task := range p.Tasks {
+		task.DependsOn = slices.Clone(task.DependsOn)
+		tasks[i] = task
+	}
+	return Plan{Tasks: tasks, Replans: p.Replans}
+}
+
+// PlanStateKey returns the session state key holding the Plan of the
+// plan-and-execute agent, so that several of them in a session do not write
+// the same key.
+func PlanStateKey(agent string) string {
+	return "blades." + PlanKey + "." + agent
+}
+
+// PlanFromSession returns the plan of the plan-and-execute agent stored in
+// the session state, including in a session restored from JSON.
+func PlanFromSession(session blades.Session, agent string) (Plan, bool) {
+	if session == nil {
+		return Plan{}, false
+	}
+	return blades.DecodeState[Plan](session.State()[PlanStateKey(agent)])
+}
+
+// PlanTaskFromMessage returns the task attached to a task event.
+func PlanTaskFromMessage(message *blades.Message) (PlanTask, bool) {
+	if message == nil {
+		return PlanTask{}, false
+	}
+	return blades.DecodeState[PlanTask](message.Metadata[PlanTaskKey])
+}
+
+// plannedTask is a task as answered by a planner.
+type plannedTask struct {
+	ID          string   `json:"id" jsonschema:"short unique identifier of the task"`
+	Description string   `json:"description" jsonschema:"what the task must achieve"`
+	DependsOn   []string `json:"dependsOn,omitempty" jsonschema:"identifiers of the tasks that must be completed first"`
+}
+
+// plannerOutput is the structured output of a planner.
+type plannerOutput struct {
+	Tasks []plannedTask `json:"tasks" jsonschema:"the tasks of the plan, in execution order"`
+}
+
+// PlanSchema returns the output schema of planners and replanners, which
+// answer with a JSON object such as
+// {"tasks":[{"id":"a","description":"...","dependsOn":[]}]}.
+func PlanSchema() (*jsonschema.Schema, error) {
+	return jsonschema.For[plannerOutput](nil)
+}
+
+// PlanExecuteConfig is the configuration for a plan-and-execute agent.
+type PlanExecuteConfig struct {
+	Name        string
+	Description string
+	// Planner answers the input with a plan, see PlanSchema.
+	Planner blades.Agent
+	// Executor runs the tasks one at a time.
+	Executor blades.Agent
+	// Replanner, if set, revises the plan when a task fails. It receives the
+	// goal, the plan with the results so far and the error, and answers with
+	// the tasks that remain to be done.
+	Replanner blades.Agent
+	// MaxTasks bounds the task runs of an invocation, including retries of
+	// replanned tasks. Zero means no bound.
+	MaxTasks int
+	// MaxReplans bounds the replans of an invocation. Defaults to 3.
+	MaxReplans int
+}
+
+// planExecuteAgent is an agent that plans a task list and then executes it.
+type planExecuteAgent struct {
+	config PlanExecuteConfig
+}
+
+// NewPlanExecuteAgent creates an agent that asks the planner for a task list,
+// stores it in the session state under its PlanStateKey, and runs the tasks in
+// dependency order with the executor. A started and a finished event carrying
+// the task under PlanTaskKey are yielded for every task run, and the final
+// message answers with the result of the last task.
+func NewPlanExecuteAgent(config PlanExecuteConfig) (blades.Agent, error) {
+	if config.Planner == nil || config.Executor == nil {
+		return nil, fmt.Errorf("flow %s: planner and executor are required", config.Name)
+	}
+	agents := []blades.Agent{config.Planner, config.Executor}
+	if config.Replanner != nil {
+		agents = append(agents, config.Replanner)
+	}
+	if err := validateSubAgents(config.Name, agents, nil); err != nil {
+		return nil, err
+	}
+	if config.MaxReplans <= 0 {
+		config.MaxReplans = 3
+	}
+	return &planExecuteAgent{config: config}, nil
+}
+
+// SubAgents returns the sub-agents of the flow.
+func (a *planExecuteAgent) SubAgents() []blades.Agent {
+	agents := []blades.Agent{a.config.Planner, a.config.Executor}
+	if a.config.Replanner != nil {
+		agents = append(agents, a.config.Replanner)
+	}
+	return agents
+}
+
+// Name returns the name of the agent.
+func (a *planExecuteAgent) Name() string {
+	return a.config.Name
+}
+
+// Description returns the description of the agent.
+func (a *planExecuteAgent) Description() string {
+	return a.config.Description
+}
+
+// Run plans the input and executes the plan.
+func (a *planExecuteAgent) Run(ctx context.Context, input *blades.Invocation) blades.Generator[*blades.Message, error] {
+	ctx = blades.NewPathContext(ctx, a.Name())
+	return blades.PathErrors(ctx, func(yield func(*blades.Message, error) bool) {
+		goal := input.Message.Text()
+		planner := input.Child(a.config.Planner.Name())
+		output, ok := a.runAgent(ctx, yield, a.config.Planner, planner)
+		if !ok {
+			return
+		}
+		tasks, err := parsePlan(output, nil)
+		if err != nil {
+			yieldFailure(yield, a.config.Planner, planner, nil, fmt.Errorf("flow %s: %w", a.config.Name, err))
+			return
+		}
+		plan := Plan{Tasks: tasks}
+		a.save(ctx, input, plan)
+		var (
+			runs int
+			last *PlanTask
+		)
+		for !plan.Done() {
+			i := nextTask(plan)
+			if i < 0 {
+				yieldFailure(yield, a, input, nil, fmt.Errorf("flow %s: %w: no task is ready", a.config.Name, ErrInvalidPlan))
+				return
+			}
+			if a.config.MaxTasks > 0 && runs >= a.config.MaxTasks {
+				yieldFailure(yield, a, input, nil, fmt.Errorf("flow %s: %w: %d tasks run", a.config.Name, ErrTaskBudgetExceeded, runs))
+				return
+			}
+			runs++
+			task := &plan.Tasks[i]
+			invocation := input.Child(fmt.Sprintf("task-%s.%d", task.ID, runs))
+			if err := blades.CheckLimits(ctx, a.config.Executor.Name(), invocation); err != nil {
+				yieldFailure(yield, a.config.Executor, invocation, nil, err)
+				return
+			}
+			task.Status = TaskRunning
+			a.save(ctx, input, plan)
+			if !yield(a.event(input, *task), nil) {
+				return
+			}
+			invocation.Message = blades.UserMessage(taskPrompt(goal, plan, *task))
+			result, err := a.execute(ctx, yield, invocation)
+			if errors.Is(err, errStopped) {
+				return
+			}
+			if err == nil {
+				task.Status, task.Result = TaskCompleted, result.Text()
+			} else {
+				task.Status, task.Error = TaskFailed, err.Error()
+			}
+			finished := *task
+			a.save(ctx, input, plan)
+			if !yield(a.event(input, finished), nil) {
+				return
+			}
+			if err == nil {
+				last = &finished
+				continue
+			}
+			if a.config.Replanner == nil {
+				yieldFailure(yield, a.config.Executor, invocation, nil, err)
+				return
+			}
+			if plan.Replans >= a.config.MaxReplans {
+				yieldFailure(yield, a, input, nil, fmt.Errorf("flow %s: %w: task %s: %w", a.config.Name, ErrReplanLimitExceeded, finished.ID, err))
+				return
+			}
+			replanner := input.Child(fmt.Sprintf("%s.%d", a.config.Replanner.Name(), plan.Replans))
+			replanner.Message = blades.UserMessage(replanPrompt(goal, plan, finished))
+			output, ok := a.runAgent(ctx, yield, a.config.Replanner, replanner)
+			if !ok {
+				return
+			}
+			completed := completedTasks(plan)
+			tasks, err := parsePlan(output, completed)
+			if err != nil {
+				yieldFailure(yield, a.config.Replanner, replanner, nil, fmt.Errorf("flow %s: %w", a.config.Name, err))
+				return
+			}
+			plan = Plan{Tasks: append(completed, tasks...), Replans: plan.Replans + 1}
+			a.save(ctx, input, plan)
+		}
+		message := blades.NewAssistantMessage(blades.StatusCompleted)
+		message.Author = a.config.Name
+		message.InvocationID = input.ID
+		if last != nil {
+			message.Parts = blades.Parts(last.Result)
+		}
+		message.Metadata[PlanKey] = plan.clone()
+		yield(message, nil)
+	})
+}
+
+// errStopped reports that the consumer stopped the iteration.
+var errStopped = errors.New("stopped")
+
+// runAgent runs a planner and returns its final message, forwarding its
+// messages. It yields the failure and returns false if the agent fails.
+func (a *planExecuteAgent) runAgent(ctx context.Context, yield func(*blades.Message, error) bool, agent blades.Agent, invocation *blades.Invocation) (*blades.Message, bool) {
+	var last *blades.Message
+	for message, err := range blades.MarkFinal(agent.Run(ctx, invocation), false) {
+		if err != nil {
+			yieldFailure(yield, agent, invocation, last, err)
+			return nil, false
+		}
+		if message == nil {
+			yieldFailure(yield, agent, invocation, last, a.nilMessage(agent))
+			return nil, false
+		}
+		if !yield(message, nil) {
+			return nil, false
+		}
+		last = message
+	}
+	if last == nil || last.Status != blades.StatusCompleted {
+		yieldFailure(yield, agent, invocation, last, blades.ErrNoFinalResponse)
+		return nil, false
+	}
+	return last, true
+}
+
+// execute runs the executor on a task and returns its final message,
+// forwarding its messages except a final failure, which fails the task.
+func (a *planExecuteAgent) execute(ctx context.Context, yield func(*blades.Message, error) bool, invocation *blades.Invocation) (*blades.Message, error) {
+	var last *blades.Message
+	for message, err := range blades.MarkFinal(a.config.Executor.Run(ctx, invocation), false) {
+		if err != nil {
+			return nil, err
+		}
+		if message == nil {
+			return nil, a.nilMessage(a.config.Executor)
+		}
+		if message.Status == blades.StatusFailed {
+			last = message
+			continue
+		}
+		if !yield(message, nil) {
+			return nil, errStopped
+		}
+		last = message
+	}
+	if last == nil || last.Status != blades.StatusCompleted {
+		return nil, blades.ErrNoFinalResponse
+	}
+	return last, nil
+}
+
+// nilMessage returns the error of a sub-agent that yielded a nil message,
+// which the plan cannot record.
+func (a *planExecuteAgent) nilMessage(agent blades.Agent) error {
+	return fmt.Errorf("flow %s: agent %s yielded a nil message: %w", a.config.Name, agent.Name(), blades.ErrNoFinalResponse)
+}
+
+// save stores a copy of the plan in the session state.
+func (a *planExecuteAgent) save(ctx context.Context, invocation *blades.Invocation, plan Plan) {
+	if invocation.Session == nil {
+		return
+	}
+	invocation.Session.PutState(ctx, PlanStateKey(a.config.Name), plan.clone())
+}
+
+// event returns the message reporting the status of a task.
+func (a *planExecuteAgent) event(invocation *blades.Invocation, task PlanTask) *blades.Message {
+	message := blades.NewAssistantMessage(blades.StatusInProgress)
+	message.Author = a.config.Name
+	message.InvocationID = invocation.ID
+	task.DependsOn = slices.Clone(task.DependsOn)
+	message.Metadata[PlanTaskKey] = task
+	return message
+}
+
+// nextTask returns the index of the first pending task whose dependencies are
+// completed, or -1.
+func nextTask(plan Plan) int {
+	status := make(map[string]TaskStatus, len(plan.Tasks))
+	for _, task := range plan.Tasks {
+		status[task.ID] = task.Status
+	}
+	for i, task := range plan.Tasks {
+		if task.Status != TaskPending {
+			continue
+		}
+		ready := true
+		for _, dep := range task.DependsOn {
+			if status[dep] != TaskCompleted {
+				ready = false
+				break
+			}
+		}
+		if ready {
+			return i
+		}
+	}
+	return -1
+}
+
+// completedTasks returns the completed tasks of the plan, which a replan keeps.
+func completedTasks(plan Plan) []PlanTask {
+	var tasks []PlanTask
+	for _, task := range plan.clone().Tasks {
+		if task.Status == TaskCompleted {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
+}
+
+// parsePlan parses the tasks answered by a planner. Their identifiers must be
+// unique, also among the completed tasks, and their dependencies must refer to
+// other tasks without cycles.
+func parsePlan(message *blades.Message, completed []PlanTask) ([]PlanTask, error) {
+	output, err := blades.ParseStructured[plannerOutput](message.Text())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPlan, err)
+	}
+	if len(output.Tasks) == 0 {
+		return nil, fmt.Errorf("%w: no tasks", ErrInvalidPlan)
+	}
+	known := make(map[string]bool, len(completed)+len(output.Tasks))
+	for _, task := range completed {
+		known[task.ID] = true
+	}
+	for _, task := range output.Tasks {
+		if task.ID == "" {
+			return nil, fmt.Errorf("%w: task without id", ErrInvalidPlan)
+		}
+		if known[task.ID] {
+			return nil, fmt.Errorf("%w: duplicate task %q", ErrInvalidPlan, task.ID)
+		}
+		known[task.ID] = true
+	}
+	tasks := make([]PlanTask, 0, len(output.Tasks))
+	for _, task := range output.Tasks {
+		for _, dep := range task.DependsOn {
+			if !known[dep] {
+				return nil, fmt.Errorf("%w: task %q depends on unknown task %q", ErrInvalidPlan, task.ID, dep)
+			}
+		}
+		tasks = append(tasks, PlanTask{
+			ID:          task.ID,
+			Description: task.Description,
+			DependsOn:   task.DependsOn,
+			Status:      TaskPending,
+		})
+	}
+	// Every task must become ready once the tasks before it are done.
+	plan := Plan{Tasks: slices.Concat(completed, tasks)}
+	for !plan.Done() {
+		i := nextTask(plan)
+		if i < 0 {
+			return nil, fmt.Errorf("%w: dependency cycle", ErrInvalidPlan)
+		}
+		plan.Tasks[i].Status = TaskCompleted
+	}
+	return tasks, nil
+}
+
+// taskPrompt returns the input of the executor for a task, with the results
+// of the tasks it depends on.
+func taskPrompt(goal string, plan Plan, task PlanTask) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Goal: %s\n\nYour task: %s\n", goal, task.Description)
+	for _, dep := range plan.Tasks {
+		if slices.Contains(task.DependsOn, dep.ID) {
+			fmt.Fprintf(&b, "\nResult of %q (%s):\n%s\n", dep.ID, dep.Description, dep.Result)
+		}
+	}
+	return b.String()
+}
+
+// replanPrompt returns the input of the replanner after a task failed.
+func replanPrompt(goal string, plan Plan, failed PlanTask) string {
+	data, _ := json.MarshalIndent(plan, "", "  ")
+	return fmt.Sprintf("Goal: %s\n\nCurrent plan:\n%s\n\nTask %q failed: %s\n\n"+
+		"Answer with the tasks that remain to reach the goal. Completed tasks are kept; "+
+		"new tasks may depend on them but must not reuse their ids.", goal, data, failed.ID, failed.Error)
+}
@@ -0,0 +1,191 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-kratos/blades"
+)
+
+// scriptedModel answers each call with the next reply of its script, failing
+// when the reply is empty.
+type scriptedModel struct {
+	replies []string
+	prompts []string
+}
+
+func (m *scriptedModel) Name() string { return "scripted" }
+
+func (m *scriptedModel) Generate(ctx context.Context, req *blades.ModelRequest) (*blades.ModelResponse, error) {
+	m.prompts = append(m.prompts, req.Messages[len(req.Messages)-1].Text())
+	if len(m.replies) == 0 {
+		return nil, errors.New("script exhausted")
+	}
+	reply := m.replies[0]
+	m.replies = m.replies[1:]
+	if reply == "" {
+		return nil, errors.New("tool unavailable")
+	}
+	message := blades.NewAssistantMessage(blades.StatusCompleted)
+	message.Parts = blades.Parts(reply)
+	return &blades.ModelResponse{Message: message}, nil
+}
+
+func (m *scriptedModel) NewStreaming(ctx context.Context, req *blades.ModelRequest) blades.Generator[*blades.ModelResponse, error] {
+	return func(yield func(*blades.ModelResponse, error) bool) {
+		yield(m.Generate(ctx, req))
+	}
+}
+
+func newPlanExecuteAgent(t *testing.T, executor []string, replanner []string, maxTasks int) (blades.Agent, *scriptedModel) {
+	t.Helper()
+	planner, err := blades.NewAgent("planner", blades.WithModel(&scriptedModel{replies: []string{
+		"```json\n" + `{"tasks":[{"id":"search","description":"find flights"},{"id":"book","description":"book the cheapest","dependsOn":["search"]}]}` + "\n```",
+	}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	model := &scriptedModel{replies: executor}
+	worker, err := blades.NewAgent("worker", blades.WithModel(model))
+	if err != nil {
+		t.Fatal(err)
+	}
+	replan, err := blades.NewAgent("replanner", blades.WithModel(&scriptedModel{replies: replanner}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent, err := NewPlanExecuteAgent(PlanExecuteConfig{
+		Name:      "travel",
+		Planner:   planner,
+		Executor:  worker,
+		Replanner: replan,
+		MaxTasks:  maxTasks,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return agent, model
+}
+
+func TestPlanExecuteReplan(t *testing.T) {
+	agent, worker := newPlanExecuteAgent(t,
+		[]string{"flight AB1 for $100", "", "booked on the phone"},
+		[]string{`{"tasks":[{"id":"call","description":"book by phone","dependsOn":["search"]}]}`},
+		0,
+	)
+	session := blades.NewSession()
+	invocation := &blades.Invocation{Session: session, Message: blades.UserMessage("book a flight")}
+	var (
+		events []string
+		final  *blades.Message
+	)
+	for message, err := range agent.Run(context.Background(), invocation) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if task, ok := PlanTaskFromMessage(message); ok {
+			events = append(events, task.ID+":"+string(task.Status))
+		}
+		final = message
+	}
+	want := []string{"search:running", "search:completed", "book:running", "book:failed", "call:running", "call:completed"}
+	if strings.Join(events, " ") != strings.Join(want, " ") {
+		t.Fatalf("want events %v, got %v", want, events)
+	}
+	if final.Text() != "booked on the phone" {
+		t.Fatalf("want the result of the last task, got %q", final.Text())
+	}
+	if !strings.Contains(worker.prompts[2], "flight AB1 for $100") {
+		t.Fatalf("want the dependency result in the task input, got %q", worker.prompts[2])
+	}
+	data, err := blades.ExportSession(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := blades.ImportSession(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, ok := PlanFromSession(restored, "travel")
+	if !ok || !plan.Done() || plan.Replans != 1 || len(plan.Tasks) != 2 {
+		t.Fatalf("want a done plan of 2 tasks after 1 replan, got %+v", plan)
+	}
+	if plan.Tasks[0].ID != "search" || plan.Tasks[1].ID != "call" {
+		t.Fatalf("want the completed task kept and the new task added, got %+v", plan.Tasks)
+	}
+}
+
+func TestPlanExecuteTermination(t *testing.T) {
+	tests := []struct {
+		name      string
+		executor  []string
+		replanner []string
+		maxTasks  int
+		want      error
+	}{
+		{"budget", []string{"found", "", "booked"}, []string{`{"tasks":[{"id":"retry","description":"book again"}]}`}, 2, ErrTaskBudgetExceeded},
+		{"replan limit", []string{"found", "", "", "", ""}, []string{
+			`{"tasks":[{"id":"r1","description":"retry"}]}`,
+			`{"tasks":[{"id":"r2","description":"retry"}]}`,
+			`{"tasks":[{"id":"r3","description":"retry"}]}`,
+		}, 0, ErrReplanLimitExceeded},
+		{"invalid replan", []string{"found", ""}, []string{`{"tasks":[{"id":"search","description":"again"}]}`}, 0, ErrInvalidPlan},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agent, _ := newPlanExecuteAgent(t, tt.executor, tt.replanner, tt.maxTasks)
+			invocation := &blades.Invocation{Session: blades.NewSession(), Message: blades.UserMessage("book a flight")}
+			var last *blades.Message
+			for message, err := range agent.Run(context.Background(), invocation) {
+				if err != nil {
+					if !errors.Is(err, tt.want) {
+						t.Fatalf("want %v, got %v", tt.want, err)
+					}
+					if last == nil || last.Status != blades.StatusFailed {
+						t.Fatalf("want a failed message before the error, got %+v", last)
+					}
+					return
+				}
+				last = message
+			}
+			t.Fatalf("want %v, got none", tt.want)
+		})
+	}
+}
+
+// nilAgent yields a nil message.
+type nilAgent struct{}
+
+func (nilAgent) Name() string        { return "nil" }
+func (nilAgent) Description() string { return "" }
+func (nilAgent) Run(ctx context.Context, invocation *blades.Invocation) blades.Generator[*blades.Message, error] {
+	return func(yield func(*blades.Message, error) bool) {
+		yield(nil, nil)
+	}
+}
+
+func TestPlanExecuteNilMessage(t *testing.T) {
+	planner, err := blades.NewAgent("planner", blades.WithModel(&scriptedModel{replies: []string{
+		`{"tasks":[{"id":"search","description":"find flights"}]}`,
+	}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, config := range map[string]PlanExecuteConfig{
+		"planner":  {Name: "travel", Planner: nilAgent{}, Executor: planner},
+		"executor": {Name: "travel", Planner: planner, Executor: nilAgent{}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			agent, err := NewPlanExecuteAgent(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = blades.NewRunner(agent).Run(context.Background(), blades.UserMessage("book a flight"))
+			if !errors.Is(err, blades.ErrNoFinalResponse) {
+				t.Fatalf("want %v, got %v", blades.ErrNoFinalResponse, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-kratos/blades"
+)
+
+// RoutingKey is the metadata key of the routing record on the final routed
+// message, and the prefix of the session state keys of the routing records;
+// see RoutingStateKey.
+const RoutingKey = "routing"
+
+// RoutingStateKey returns the session state key holding the routing records
+// of the router, so that routers running side by side, e.g. in a parallel
+// flow, do not write the same key.
+func RoutingStateKey(router string) string {
+	return "blades." + RoutingKey + "." + router
+}
+
+// ErrNoRouteSelected is returned when a router does not pick any of its candidates.
+var ErrNoRouteSelected = errors.New("no route selected")
+
+// RouteError reports a routing failure together with the raw router output.
+type RouteError struct {
+	Router string
+	Output string
+}
+
+func (e *RouteError) Error() string {
+	return fmt.Sprintf("router %s: %s: output %q", e.Router, ErrNoRouteSelected, e.Output)
+}
+
+// Unwrap returns ErrNoRouteSelected.
+func (e *RouteError) Unwrap() error {
+	return ErrNoRouteSelected
+}
+
+// RoutingRecord describes one routing decision.
+type RoutingRecord struct {
+	InvocationID string        `json:"invocationId,omitempty"`
+	Router       string        `json:"router"`
+	Selected     string        `json:"selected,omitempty"`
+	Candidates   []string      `json:"candidates"`
+	Latency      time.Duration `json:"latency"`
+	Confidence   *float64      `json:"confidence,omitempty"`
+	// Scores are the confidences of the routes answered by a scoring router.
+	Scores map[string]float64 `json:"scores,omitempty"`
+	// Routes are the routes taken by a scoring router, most confident first.
+	Routes []string `json:"routes,omitempty"`
+	// Fallback reports whether no route was confident enough and the fallback
+	// agent was selected.
+	Fallback bool   `json:"fallback,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// RecordRouting appends the record to the routing records of its router in
+// the session state. Concurrent appends are serialized; see blades.UpdateState.
+func RecordRouting(ctx context.Context, session blades.Session, record RoutingRecord) {
+	if session == nil {
+		return
+	}
+	blades.UpdateState(ctx, session, RoutingStateKey(record.Router), func(current any) any {
+		records, _ := blades.DecodeState[[]RoutingRecord](current)
+		return append(records, record)
+	})
+}
+
+// RoutingRecords returns the routing records of the router stored in the
+// session state, including those of a session restored from JSON.
+func RoutingRecords(session blades.Session, router string) []RoutingRecord {
+	if session == nil {
+		return nil
+	}
+	records, _ := blades.DecodeState[[]RoutingRecord](session.State()[RoutingStateKey(router)])
+	return records
+}
+
+// RoutingFromMessage returns the routing record attached to a routed message.
+func RoutingFromMessage(message *blades.Message) (RoutingRecord, bool) {
+	if message == nil {
+		return RoutingRecord{}, false
+	}
+	return blades.DecodeState[RoutingRecord](message.Metadata[RoutingKey])
+}
+
+// attachRouting sets the routing record on the final message of a routed agent.
+func attachRouting(message *blades.Message, record RoutingRecord) {
+	if message == nil || message.Role != blades.RoleAssistant || message.Status != blades.StatusCompleted {
+		return
+	}
+	if message.Metadata == nil {
+		message.Metadata = make(map[string]any)
+	}
+	message.Metadata[RoutingKey] = record
+}
@@ -2,6 +2,7 @@ package flow
 
 import (
 	"context"
+	"log/slog"
 
 	"github.com/go-kratos/blades"
 )
@@ -11,18 +12,55 @@ type SequentialConfig struct {
 	Name        string
 	Description string
 	SubAgents   []blades.Agent
+	// StateKeys lists the session state keys set before the flow runs, which
+	// sub-agent instructions may read in addition to earlier output keys.
+	StateKeys []string
+	// FinalAgent names the sub-agent whose output is the final answer of the
+	// flow; it defaults to the last sub-agent. The output of the others is
+	// intermediate.
+	FinalAgent string
+	// Logger receives the warnings about state keys that the sub-agents read
+	// and no earlier step provides. Defaults to slog.Default().
+	Logger *slog.Logger
 }
 
 // sequentialAgent is an agent that runs sub-agents sequentially.
 type sequentialAgent struct {
 	config SequentialConfig
+	final  string
 }
 
 // NewSequentialAgent creates a new SequentialAgent.
-func NewSequentialAgent(config SequentialConfig) blades.Agent {
+// It returns an error if two sub-agents share a name or an output key, or if
+// FinalAgent is not a sub-agent.
+func NewSequentialAgent(config SequentialConfig) (blades.Agent, error) {
+	if err := validateSubAgents(config.Name, config.SubAgents, nil); err != nil {
+		return nil, err
+	}
+	final, err := finalAgent(config.Name, config.SubAgents, config.FinalAgent)
+	if err != nil {
+		return nil, err
+	}
+	warnUnresolvedStateKeys(config.Logger, config.Name, config.SubAgents, config.StateKeys)
 	return &sequentialAgent{
 		config: config,
-	}
+		final:  final,
+	}, nil
+}
+
+// outputKeys returns the output keys of the sub-agents.
+func (a *sequentialAgent) outputKeys() []string {
+	return collectOutputKeys(a.config.SubAgents)
+}
+
+// requiredStateKeys returns the keys the sub-agents read that the flow does not produce.
+func (a *sequentialAgent) requiredStateKeys() []string {
+	return unresolvedKeyNames(unresolvedStateKeys(a.config.SubAgents, a.config.StateKeys))
+}
+
+// SubAgents returns the sub-agents of the flow.
+func (a *sequentialAgent) SubAgents() []blades.Agent {
+	return a.config.SubAgents
 }
 
 // Name returns the name of the agent.
@@ -35,24 +73,48 @@ func (a *sequentialAgent) Description() string {
 	return a.config.Description
 }
 
-// Run runs the sub-agents sequentially.
+// Run runs the sub-agents sequentially. The final answer of the final agent
+// is marked with blades.Message.Final.
 func (a *sequentialAgent) Run(ctx context.Context, input *blades.Invocation) blades.Generator[*blades.Message, error] {
-	return func(yield func(*blades.Message, error) bool) {
+	ctx = blades.NewPathContext(ctx, a.Name())
+	return blades.PathErrors(ctx, func(yield func(*blades.Message, error) bool) {
 		for _, agent := range a.config.SubAgents {
 			var (
 				err        error
 				message    *blades.Message
-				invocation = input.Clone()
+				last       *blades.Message
+				invocation = input.Child(agent.Name())
 			)
-			for message, err = range agent.Run(ctx, invocation) {
+			if err := blades.CheckLimits(ctx, agent.Name(), invocation); err != nil {
+				yieldFailure(yield, agent, invocation, nil, err)
+				return
+			}
+			for message, err = range blades.MarkFinal(agent.Run(ctx, invocation), agent.Name() == a.final) {
 				if err != nil {
-					yield(nil, err)
+					yieldFailure(yield, agent, invocation, last, err)
 					return
 				}
 				if !yield(message, nil) {
 					return
 				}
+				last = message
+			}
+			if message != nil && (message.Status == blades.StatusCancelled || message.Status == blades.StatusNeedsInput) {
+				return
 			}
 		}
+	})
+}
+
+// yieldFailure yields a StatusFailed message for a sub-agent that returned err
+// without one, so the failing agent stays visible in the stream, then yields err.
+func yieldFailure(yield func(*blades.Message, error) bool, agent blades.Agent, invocation *blades.Invocation, last *blades.Message, err error) {
+	if last == nil || last.Status != blades.StatusFailed {
+		message := blades.NewFailedMessage(agent.Name(), blades.ErrorClassInternal, err, "")
+		message.InvocationID = invocation.ID
+		if !yield(message, nil) {
+			return
+		}
 	}
+	yield(nil, err)
 }
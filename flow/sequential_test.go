@@ -0,0 +1,522 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-kratos/blades"
+	"github.com/go-kratos/blades/tools"
+)
+
+func TestSequentialAgentInvocationIDs(t *testing.T) {
+	newAgent := func(name string) blades.Agent {
+		agent, err := blades.NewAgent(name, blades.WithModel(&echoModel{text: name}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return agent
+	}
+	loop, err := NewLoopAgent(LoopConfig{Name: "loop", MaxIterations: 2, SubAgents: []blades.Agent{newAgent("critic")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sequential, err := NewSequentialAgent(SequentialConfig{Name: "pipeline", SubAgents: []blades.Agent{newAgent("writer"), loop}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := blades.NewSession()
+	runner := blades.NewRunner(sequential)
+	if _, err := runner.Run(context.Background(), blades.UserMessage("go"), blades.WithSession(session), blades.WithInvocationID("root")); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range session.Messages(blades.MessageFilter{Role: blades.RoleAssistant}) {
+		got = append(got, m.Author+"="+m.InvocationID)
+	}
+	want := []string{
+		"writer=root.writer",
+		"critic=root.loop.critic.0",
+		"critic=root.loop.critic.1",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("want %v, got %v", want, got)
+		}
+	}
+}
+
+// failingModel streams a partial reply and then fails.
+type failingModel struct {
+	partial string
+	err     error
+}
+
+func (m *failingModel) Name() string { return "failing" }
+
+func (m *failingModel) Generate(ctx context.Context, req *blades.ModelRequest) (*blades.ModelResponse, error) {
+	return nil, m.err
+}
+
+func (m *failingModel) NewStreaming(ctx context.Context, req *blades.ModelRequest) blades.Generator[*blades.ModelResponse, error] {
+	return func(yield func(*blades.ModelResponse, error) bool) {
+		message := blades.NewAssistantMessage(blades.StatusIncomplete)
+		message.Parts = blades.Parts(m.partial)
+		if !yield(&blades.ModelResponse{Message: message}, nil) {
+			return
+		}
+		yield(nil, m.err)
+	}
+}
+
+func TestSequentialAgentFailure(t *testing.T) {
+	errUnavailable := errors.New("model unavailable")
+	writer, err := blades.NewAgent("writer", blades.WithModel(&echoModel{text: "draft"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reviewer, err := blades.NewAgent("reviewer", blades.WithModel(&failingModel{partial: "looks", err: errUnavailable}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sequential, err := NewSequentialAgent(SequentialConfig{Name: "pipeline", SubAgents: []blades.Agent{writer, reviewer}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := blades.NewRunner(sequential)
+
+	var (
+		last   *blades.Message
+		gotErr error
+	)
+	for message, err := range runner.RunStream(context.Background(), blades.UserMessage("go")) {
+		if err != nil {
+			gotErr = err
+			break
+		}
+		last = message
+	}
+	if !errors.Is(gotErr, errUnavailable) {
+		t.Fatalf("expected the model error, got %v", gotErr)
+	}
+	if last == nil || last.Status != blades.StatusFailed || last.Author != "reviewer" {
+		t.Fatalf("expected a failed message from the reviewer, got %+v", last)
+	}
+	if last.Error == nil || last.Error.Class != blades.ErrorClassModel || last.Error.Message != errUnavailable.Error() {
+		t.Fatalf("unexpected error detail: %+v", last.Error)
+	}
+	if last.Text() != "looks" {
+		t.Fatalf("expected the partial text, got %q", last.Text())
+	}
+	// Run keeps returning the error.
+	if _, err := runner.Run(context.Background(), blades.UserMessage("go")); !errors.Is(err, errUnavailable) {
+		t.Fatalf("expected Run to return the model error, got %v", err)
+	}
+}
+
+func TestUnresolvedStateKeys(t *testing.T) {
+	newAgent := func(name, instruction, key string) blades.Agent {
+		agent, err := blades.NewAgent(name, blades.WithModel(&echoModel{text: name}), blades.WithInstruction(instruction), blades.WithOutputKey(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return agent
+	}
+	writer := newAgent("writer", "Draft.{{if .suggestions}} Consider {{.suggestions}}.{{end}}", "draft")
+	reviewer := newAgent("reviewer", "Review {{.draft}} in a {{.tone}} tone.", "suggestions")
+	editor := newAgent("editor", "Edit {{.draft}} for {{.audience}}.", "edit")
+	parallel, err := NewParallelAgent(ParallelConfig{Name: "editors", SubAgents: []blades.Agent{editor}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		agents    []blades.Agent
+		stateKeys []string
+		want      []unresolvedKey
+	}{
+		{
+			name:   "earlier output and guarded key",
+			agents: []blades.Agent{writer, reviewer},
+			want:   []unresolvedKey{{agent: "reviewer", key: "tone"}},
+		},
+		{
+			name:      "initial state key",
+			agents:    []blades.Agent{writer, reviewer},
+			stateKeys: []string{"tone"},
+		},
+		{
+			name:   "later output",
+			agents: []blades.Agent{reviewer, writer},
+			want:   []unresolvedKey{{agent: "reviewer", key: "draft"}, {agent: "reviewer", key: "tone"}},
+		},
+		{
+			name:   "nested flow",
+			agents: []blades.Agent{writer, parallel},
+			want:   []unresolvedKey{{agent: "editors", key: "audience"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := unresolvedStateKeys(tt.agents, tt.stateKeys)
+			if len(got) != len(tt.want) {
+				t.Fatalf("want %v, got %v", tt.want, got)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Fatalf("want %v, got %v", tt.want, got)
+				}
+			}
+		})
+	}
+
+	var logs strings.Builder
+	if _, err := NewSequentialAgent(SequentialConfig{
+		Name:      "review",
+		SubAgents: []blades.Agent{writer, reviewer},
+		Logger:    slog.New(slog.NewTextHandler(&logs, nil)),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs.String(), "level=WARN") || !strings.Contains(logs.String(), "agent=reviewer key=tone") {
+		t.Fatalf("want the unresolved key logged, got %q", logs.String())
+	}
+}
+
+func TestFlowFinalAnswer(t *testing.T) {
+	newAgent := func(name string) blades.Agent {
+		agent, err := blades.NewAgent(name, blades.WithModel(&echoModel{text: name}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return agent
+	}
+	newSequential := func(config SequentialConfig) blades.Agent {
+		agent, err := NewSequentialAgent(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return agent
+	}
+	newParallel := func(config ParallelConfig) blades.Agent {
+		agent, err := NewParallelAgent(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return agent
+	}
+	newLoop := func(config LoopConfig) blades.Agent {
+		agent, err := NewLoopAgent(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return agent
+	}
+	tests := []struct {
+		name  string
+		agent blades.Agent
+		want  string
+	}{
+		{
+			name:  "sequential default",
+			agent: newSequential(SequentialConfig{Name: "flow", SubAgents: []blades.Agent{newAgent("writer"), newAgent("reviewer")}}),
+			want:  "reviewer",
+		},
+		{
+			name:  "sequential final agent",
+			agent: newSequential(SequentialConfig{Name: "flow", SubAgents: []blades.Agent{newAgent("writer"), newAgent("reviewer")}, FinalAgent: "writer"}),
+			want:  "writer",
+		},
+		{
+			name: "nested loop",
+			agent: newSequential(SequentialConfig{Name: "flow", SubAgents: []blades.Agent{
+				newAgent("writer"),
+				newLoop(LoopConfig{Name: "loop", MaxIterations: 2, SubAgents: []blades.Agent{newAgent("critic")}}),
+			}}),
+			want: "critic",
+		},
+		{
+			name:  "parallel default",
+			agent: newParallel(ParallelConfig{Name: "flow", SubAgents: []blades.Agent{newAgent("grammar"), newAgent("style")}}),
+			want:  "style",
+		},
+		{
+			name: "nested parallel",
+			agent: newSequential(SequentialConfig{Name: "flow", SubAgents: []blades.Agent{
+				newParallel(ParallelConfig{Name: "edits", SubAgents: []blades.Agent{newAgent("grammar"), newAgent("style")}, FinalAgent: "grammar"}),
+				newAgent("publisher"),
+			}, FinalAgent: "edits"}),
+			want: "grammar",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := blades.NewRunner(tt.agent)
+			var finals []string
+			for message, err := range runner.RunStream(context.Background(), blades.UserMessage("go")) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if message.Final {
+					finals = append(finals, message.Author)
+				}
+			}
+			if len(finals) != 1 || finals[0] != tt.want {
+				t.Fatalf("want only %s marked final, got %v", tt.want, finals)
+			}
+			output, err := runner.Run(context.Background(), blades.UserMessage("go"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !output.Final || output.Author != tt.want {
+				t.Fatalf("want Run to return the final answer of %s, got %s (final %v)", tt.want, output.Author, output.Final)
+			}
+		})
+	}
+
+	if _, err := NewSequentialAgent(SequentialConfig{Name: "flow", SubAgents: []blades.Agent{newAgent("writer")}, FinalAgent: "editor"}); err == nil {
+		t.Fatal("want an error for a final agent that is not a sub-agent")
+	}
+}
+
+func TestFlowPathError(t *testing.T) {
+	newAgent := func(name string, model blades.ModelProvider) blades.Agent {
+		agent, err := blades.NewAgent(name, blades.WithModel(model))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return agent
+	}
+	editors, err := NewParallelAgent(ParallelConfig{
+		Name: "EditorParallelAgent",
+		SubAgents: []blades.Agent{
+			newAgent("editorAgent1", &echoModel{text: "ok"}),
+			newAgent("editorAgent2", &failingModel{err: errors.New("unexpected status 400")}),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writing, err := NewSequentialAgent(SequentialConfig{
+		Name:      "WritingSequenceAgent",
+		SubAgents: []blades.Agent{newAgent("writerAgent", &echoModel{text: "draft"}), editors},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = blades.NewRunner(writing).Run(context.Background(), blades.UserMessage("write"))
+	var pathErr *blades.PathError
+	if !errors.As(err, &pathErr) {
+		t.Fatalf("want a path error, got %v", err)
+	}
+	want := []string{"WritingSequenceAgent", "EditorParallelAgent", "editorAgent2"}
+	if !slices.Equal(pathErr.Path, want) {
+		t.Fatalf("want path %v, got %v", want, pathErr.Path)
+	}
+	if got := fmt.Sprintf("%v", err); !strings.HasPrefix(got, "WritingSequenceAgent/EditorParallelAgent/editorAgent2: ") {
+		t.Fatalf("unexpected error %q", got)
+	}
+}
+
+// askingModel asks the user for the region, then plans for the answer.
+type askingModel struct{}
+
+func (m *askingModel) Name() string { return "asking" }
+
+func (m *askingModel) Generate(ctx context.Context, req *blades.ModelRequest) (*blades.ModelResponse, error) {
+	for _, part := range req.Messages[len(req.Messages)-1].Parts {
+		if call, ok := part.(blades.ToolPart); ok && call.Name == blades.AskUserToolName {
+			message := blades.NewAssistantMessage(blades.StatusCompleted)
+			message.Parts = blades.Parts("plan for " + call.Response)
+			return &blades.ModelResponse{Message: message}, nil
+		}
+	}
+	return &blades.ModelResponse{Message: &blades.Message{Role: blades.RoleTool, Status: blades.StatusCompleted, Parts: []blades.Part{
+		blades.ToolPart{ID: "call-1", Name: blades.AskUserToolName, Request: `{"question":"Which region?"}`},
+	}}}, nil
+}
+
+func (m *askingModel) NewStreaming(ctx context.Context, req *blades.ModelRequest) blades.Generator[*blades.ModelResponse, error] {
+	return func(yield func(*blades.ModelResponse, error) bool) {
+		yield(m.Generate(ctx, req))
+	}
+}
+
+func TestSequentialAgentAskUser(t *testing.T) {
+	askUser, err := blades.NewAskUserTool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	newAgent := func(name string, opts ...blades.AgentOption) blades.Agent {
+		agent, err := blades.NewAgent(name, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return agent
+	}
+	newFlow := func(researcher blades.ModelProvider) blades.Agent {
+		sequential, err := NewSequentialAgent(SequentialConfig{Name: "trip", SubAgents: []blades.Agent{
+			newAgent("researcher", blades.WithModel(researcher), blades.WithOutputKey("facts")),
+			newAgent("planner", blades.WithModel(&askingModel{}), blades.WithTools(askUser), blades.WithOutputKey("plan")),
+			newAgent("writer", blades.WithModel(&instructionModel{}), blades.WithInstruction("write the {{.plan}}")),
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sequential
+	}
+	ctx := context.Background()
+	session := blades.NewSession()
+	runner := blades.NewRunner(newFlow(&echoModel{text: "facts"}), blades.WithResumable(true))
+	var last *blades.Message
+	for m, err := range runner.RunStream(ctx, blades.UserMessage("plan a trip"), blades.WithSession(session), blades.WithInvocationID("inv-1")) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		last = m
+	}
+	if last.Status != blades.StatusNeedsInput || last.Author != "planner" || last.Text() != "Which region?" {
+		t.Fatalf("want the stream to end with the question of the planner, got %s from %s: %q", last.Status, last.Author, last.Text())
+	}
+	if _, ok := session.State()["plan"]; ok {
+		t.Fatalf("want the writer not run before the answer, got state %v", session.State())
+	}
+
+	// Resume with the answer in another process; the researcher completed
+	// and is not called again.
+	data, err := blades.Snapshot(session, "inv-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resumed := newFlow(&failingModel{err: errors.New("researcher called again")})
+	restored, err := blades.Restore(data, blades.WithRestoreAgent(resumed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := blades.NewRunner(resumed, blades.WithResumable(true)).Run(ctx, blades.UserMessage("the alps"), blades.WithSession(restored), blades.WithInvocationID("inv-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output.Author != "writer" || output.Text() != "write the plan for the alps" {
+		t.Fatalf("want the flow resumed with the answer, got %s: %q", output.Author, output.Text())
+	}
+}
+
+// meteredModel answers with a fixed usage, after calling the tool of the
+// request once if it has one.
+type meteredModel struct {
+	name  string
+	usage blades.TokenUsage
+}
+
+func (m *meteredModel) Name() string { return m.name }
+
+func (m *meteredModel) Generate(ctx context.Context, req *blades.ModelRequest) (*blades.ModelResponse, error) {
+	message := blades.NewAssistantMessage(blades.StatusCompleted)
+	message.Parts = blades.Parts(m.name)
+	if last := req.Messages[len(req.Messages)-1]; len(req.Tools) > 0 && last.Role != blades.RoleTool {
+		message.Role = blades.RoleTool
+		message.Parts = []blades.Part{blades.ToolPart{ID: "call-1", Name: req.Tools[0].Name(), Request: "{}"}}
+	}
+	message.TokenUsage = m.usage
+	return &blades.ModelResponse{Message: message}, nil
+}
+
+func (m *meteredModel) NewStreaming(ctx context.Context, req *blades.ModelRequest) blades.Generator[*blades.ModelResponse, error] {
+	return func(yield func(*blades.ModelResponse, error) bool) {
+		yield(m.Generate(ctx, req))
+	}
+}
+
+func TestSequentialAgentReport(t *testing.T) {
+	blades.RegisterModelPricing("report-large", blades.ModelPricing{Input: 2, Output: 10})
+	blades.RegisterModelPricing("report-small", blades.ModelPricing{Input: 1, Output: 4})
+	large := &meteredModel{name: "report-large", usage: blades.TokenUsage{InputTokens: 100, OutputTokens: 20, TotalTokens: 120}}
+	small := &meteredModel{name: "report-small", usage: blades.TokenUsage{InputTokens: 50, OutputTokens: 10, TotalTokens: 60}}
+	search := tools.NewTool("search", "Searches the web.", tools.HandleFunc(func(context.Context, string) (string, error) {
+		return "results", nil
+	}))
+	newAgent := func(name string, model blades.ModelProvider, opts ...blades.AgentOption) blades.Agent {
+		agent, err := blades.NewAgent(name, append([]blades.AgentOption{blades.WithModel(model)}, opts...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return agent
+	}
+	editors, err := NewParallelAgent(ParallelConfig{Name: "editors", SubAgents: []blades.Agent{newAgent("grammar", small), newAgent("style", small)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	review, err := NewLoopAgent(LoopConfig{Name: "review", MaxIterations: 2, SubAgents: []blades.Agent{newAgent("critic", small)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipeline, err := NewSequentialAgent(SequentialConfig{Name: "pipeline", SubAgents: []blades.Agent{
+		newAgent("researcher", large, blades.WithTools(search)),
+		editors,
+		review,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := blades.NewRunner(pipeline)
+	if _, err := runner.Run(context.Background(), blades.UserMessage("go"), blades.WithInvocationID("inv-1")); err != nil {
+		t.Fatal(err)
+	}
+	report, ok := runner.Report("inv-1")
+	if !ok || len(report.Steps) != 1 {
+		t.Fatalf("want the report of the pipeline, got %v", report)
+	}
+	root := report.Steps[0]
+	steps := map[string]*blades.StepReport{}
+	var walk func(step *blades.StepReport)
+	walk = func(step *blades.StepReport) {
+		steps[step.Name] = step
+		for _, sub := range step.Steps {
+			walk(sub)
+		}
+	}
+	walk(root)
+	tests := []struct {
+		step       string
+		modelCalls int
+		toolCalls  int
+		runs       int
+		tokens     int64
+		cost       float64
+		models     []string
+		substeps   []string
+	}{
+		{step: "pipeline", modelCalls: 6, toolCalls: 1, runs: 1, tokens: 480, cost: 0.00116, models: []string{"report-large", "report-small"}, substeps: []string{"researcher", "editors", "review"}},
+		{step: "researcher", modelCalls: 2, toolCalls: 1, runs: 1, tokens: 240, cost: 0.0008, models: []string{"report-large"}},
+		{step: "editors", modelCalls: 2, runs: 1, tokens: 120, cost: 0.00018, models: []string{"report-small"}},
+		{step: "grammar", modelCalls: 1, runs: 1, tokens: 60, cost: 0.00009, models: []string{"report-small"}},
+		{step: "review", modelCalls: 2, runs: 1, tokens: 120, cost: 0.00018, models: []string{"report-small"}, substeps: []string{"critic"}},
+		{step: "critic", modelCalls: 2, runs: 2, tokens: 120, cost: 0.00018, models: []string{"report-small"}},
+	}
+	for _, tt := range tests {
+		step, ok := steps[tt.step]
+		if !ok {
+			t.Fatalf("want step %s in the report:\n%s", tt.step, report)
+		}
+		var substeps []string
+		for _, sub := range step.Steps {
+			substeps = append(substeps, sub.Name)
+		}
+		if step.ModelCalls != tt.modelCalls || step.ToolCalls != tt.toolCalls || step.Runs != tt.runs || step.Usage.TotalTokens != tt.tokens ||
+			math.Abs(step.Cost-tt.cost) > 1e-12 || !slices.Equal(step.Models, tt.models) || (tt.substeps != nil && !slices.Equal(substeps, tt.substeps)) {
+			t.Fatalf("want %s with %d calls, %d tools, %d runs, %d tokens, $%g by %v over %v, got %+v", tt.step, tt.modelCalls, tt.toolCalls, tt.runs, tt.tokens, tt.cost, tt.models, tt.substeps, step)
+		}
+	}
+	if root.WallTime < steps["researcher"].WallTime+steps["review"].WallTime {
+		t.Fatalf("want the time of the pipeline to cover its steps, got %s", report)
+	}
+}
@@ -0,0 +1,257 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/go-kratos/blades"
+)
+
+var (
+	// ErrDuplicateAgentName is returned when two sub-agents of a flow share a name.
+	ErrDuplicateAgentName = errors.New("duplicate sub-agent name")
+	// ErrDuplicateOutputKey is returned when two sub-agents of a flow write the same session key.
+	ErrDuplicateOutputKey = errors.New("duplicate output key")
+)
+
+// validateSubAgents checks that the sub-agents of a flow have unique names and
+// output keys. Keys listed in merge may be shared.
+func validateSubAgents(flow string, agents []blades.Agent, merge map[string]MergeFunc) error {
+	if err := validateNames(flow, agents); err != nil {
+		return err
+	}
+	owners := make(map[string]string, len(agents))
+	for _, agent := range agents {
+		name := agent.Name()
+		for _, key := range outputKeys(agent) {
+			if owner, ok := owners[key]; ok {
+				if _, ok := merge[key]; !ok {
+					return fmt.Errorf("flow %s: %w: %q is written by both %q and %q", flow, ErrDuplicateOutputKey, key, owner, name)
+				}
+			}
+			owners[key] = name
+		}
+	}
+	return nil
+}
+
+// validateNames checks that the sub-agents of a flow have unique names, such
+// as clones of an agent that were not renamed.
+func validateNames(flow string, agents []blades.Agent) error {
+	names := make(map[string]struct{}, len(agents))
+	for _, agent := range agents {
+		name := strings.TrimSpace(agent.Name())
+		if _, ok := names[name]; ok {
+			return fmt.Errorf("flow %s: %w: %q", flow, ErrDuplicateAgentName, name)
+		}
+		names[name] = struct{}{}
+	}
+	return nil
+}
+
+// finalAgent returns the name of the sub-agent whose output is the final
+// answer of a flow: the configured one, or the last sub-agent by default.
+// It returns an error if the configured name is not a sub-agent.
+func finalAgent(flow string, agents []blades.Agent, name string) (string, error) {
+	if name == "" {
+		if len(agents) == 0 {
+			return "", nil
+		}
+		return agents[len(agents)-1].Name(), nil
+	}
+	for _, agent := range agents {
+		if agent.Name() == name {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("flow %s: final agent %q is not a sub-agent", flow, name)
+}
+
+// outputKeys returns the session keys an agent writes its output to:
+// its own output key, or those of its sub-agents for flows.
+func outputKeys(agent blades.Agent) []string {
+	switch v := agent.(type) {
+	case interface{ OutputKey() string }:
+		if key := v.OutputKey(); key != "" {
+			return []string{key}
+		}
+	case interface{ outputKeys() []string }:
+		return v.outputKeys()
+	}
+	return nil
+}
+
+// collectOutputKeys returns the distinct output keys of the agents.
+func collectOutputKeys(agents []blades.Agent) []string {
+	var keys []string
+	seen := make(map[string]struct{})
+	for _, agent := range agents {
+		for _, key := range outputKeys(agent) {
+			if _, ok := seen[key]; !ok {
+				seen[key] = struct{}{}
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+// requiredStateKeys returns the session keys an agent reads before it can run:
+// the unguarded template variables of its instruction, or for flows those not
+// produced by their own sub-agents.
+func requiredStateKeys(agent blades.Agent) []string {
+	switch v := agent.(type) {
+	case interface{ RequiredStateKeys() []string }:
+		return v.RequiredStateKeys()
+	case interface{ requiredStateKeys() []string }:
+		return v.requiredStateKeys()
+	}
+	return nil
+}
+
+// unresolvedKey is a state key read by an agent that no earlier step produces.
+type unresolvedKey struct {
+	agent string
+	key   string
+}
+
+// unresolvedStateKeys returns the keys the agents read, in run order, that are
+// neither initial state keys nor output keys of an earlier agent.
+func unresolvedStateKeys(agents []blades.Agent, stateKeys []string) []unresolvedKey {
+	available := make(map[string]struct{}, len(stateKeys))
+	for _, key := range stateKeys {
+		available[key] = struct{}{}
+	}
+	var unresolved []unresolvedKey
+	for _, agent := range agents {
+		for _, key := range requiredStateKeys(agent) {
+			if _, ok := available[key]; !ok {
+				unresolved = append(unresolved, unresolvedKey{agent: agent.Name(), key: key})
+			}
+		}
+		for _, key := range outputKeys(agent) {
+			available[key] = struct{}{}
+		}
+	}
+	return unresolved
+}
+
+// unresolvedKeyNames returns the distinct key names of unresolved.
+func unresolvedKeyNames(unresolved []unresolvedKey) []string {
+	var keys []string
+	for _, u := range unresolved {
+		if !slices.Contains(keys, u.key) {
+			keys = append(keys, u.key)
+		}
+	}
+	return keys
+}
+
+// warnUnresolvedStateKeys logs the template variables of the sub-agents that
+// no earlier step or initial state key can populate. It does not fail, since
+// the flow may be nested in one whose earlier steps produce them. A nil
+// logger logs to slog.Default().
+func warnUnresolvedStateKeys(logger *slog.Logger, flow string, agents []blades.Agent, stateKeys []string) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	for _, u := range unresolvedStateKeys(agents, stateKeys) {
+		logger.Warn("flow: state key provided by no earlier step or initial state key", "flow", flow, "agent", u.agent, "key", u.key)
+	}
+}
+
+// stateWrites commits the state writes of parallel branches to the session,
+// in the order the branches are declared, and tracks which branch wrote each key.
+type stateWrites struct {
+	mu      sync.Mutex
+	merge   map[string]MergeFunc
+	writers map[string]string
+	// done[i] is closed once branch i committed its writes or ended without them.
+	done []chan struct{}
+}
+
+func newStateWrites(merge map[string]MergeFunc, branches int) *stateWrites {
+	w := &stateWrites{merge: merge, writers: make(map[string]string), done: make([]chan struct{}, branches)}
+	for i := range w.done {
+		w.done[i] = make(chan struct{})
+	}
+	return w
+}
+
+// release marks branch i as settled, letting the next branch commit.
+func (w *stateWrites) release(i int) {
+	close(w.done[i])
+}
+
+// wait waits for the branches declared before branch i to settle.
+func (w *stateWrites) wait(ctx context.Context, i int) error {
+	if i == 0 {
+		return nil
+	}
+	select {
+	case <-w.done[i-1]:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+// commit waits for the earlier branches to settle, then applies the writes of
+// branch i atomically with the extra writes, merging the values of keys
+// written by another branch with their merge function. A key written by
+// another branch without a merge function fails the commit, and nothing is
+// applied.
+func (w *stateWrites) commit(ctx context.Context, i int, branch string, session blades.Session, writes []blades.StateWrite, extra ...blades.StateWrite) error {
+	if err := w.wait(ctx, i); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	state := session.State()
+	for j, write := range writes {
+		writer, ok := w.writers[write.Key]
+		if !ok || writer == branch {
+			continue
+		}
+		merge, ok := w.merge[write.Key]
+		if !ok {
+			return fmt.Errorf("%w: session key %q is written by parallel branches %q and %q without a merge function", ErrDuplicateOutputKey, write.Key, writer, branch)
+		}
+		writes[j].Value = merge(state[write.Key], write.Value)
+	}
+	for _, write := range writes {
+		w.writers[write.Key] = branch
+	}
+	blades.ApplyState(ctx, session, append(writes, extra...)...)
+	return nil
+}
+
+// restore waits for the earlier branches to settle, then registers the writes
+// branch i committed in an earlier run and applies them again, except those
+// of keys with a merge function, whose values already hold them.
+func (w *stateWrites) restore(ctx context.Context, i int, branch string, session blades.Session, writes []blades.StateWrite) error {
+	if err := w.wait(ctx, i); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var apply []blades.StateWrite
+	for _, write := range writes {
+		if writer, ok := w.writers[write.Key]; ok && writer != branch {
+			if _, ok := w.merge[write.Key]; !ok {
+				return fmt.Errorf("%w: session key %q is written by parallel branches %q and %q without a merge function", ErrDuplicateOutputKey, write.Key, writer, branch)
+			}
+		}
+		w.writers[write.Key] = branch
+		if _, ok := w.merge[write.Key]; !ok {
+			apply = append(apply, write)
+		}
+	}
+	blades.ApplyState(ctx, session, apply...)
+	return nil
+}
@@ -6,5 +6,7 @@ require (
 	github.com/go-kratos/kit v0.0.0-20251121083925-65298ad2aa44
 	github.com/google/jsonschema-go v0.3.0
 	github.com/google/uuid v1.6.0
+	go.uber.org/goleak v1.3.0
 	golang.org/x/sync v0.17.0
+	gopkg.in/yaml.v3 v3.0.1
 )
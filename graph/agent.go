@@ -0,0 +1,131 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-kratos/blades"
+)
+
+const (
+	// InputKey is the state key under which the agent built by NewAgent puts
+	// the text of the user message.
+	InputKey = "input"
+	// OutputKey is the state key the agent built by NewAgent answers with.
+	OutputKey = "output"
+)
+
+// AgentNode returns a handler that runs the agent with the value of the
+// input key as user message and stores the text of its answer under the
+// output key. The messages of the agent, including its streaming chunks, are
+// forwarded through the emitter of the node; once the node reaches its emit
+// limit the remaining ones are dropped. Within a blades invocation, the agent
+// runs as a child of it; otherwise in a new invocation and session.
+func AgentNode(agent blades.Agent, inputKey, outputKey string) Handler {
+	return func(ctx context.Context, state State) (State, error) {
+		input := blades.UserMessage(fmt.Sprint(state[inputKey]))
+		var invocation *blades.Invocation
+		if parent, ok := blades.FromInvocationContext(ctx); ok {
+			invocation = parent.Child(agent.Name())
+			invocation.Message = input
+		} else {
+			invocation = &blades.Invocation{
+				ID:         blades.NewInvocationID(),
+				Session:    blades.NewSession(),
+				Streamable: true,
+				Message:    input,
+			}
+		}
+		emitter := EmitterFromContext(ctx)
+		var answer *blades.Message
+		for m, err := range agent.Run(ctx, invocation) {
+			if err != nil {
+				return nil, err
+			}
+			if err := emitter.Send(m); err != nil && !errors.Is(err, ErrEmitLimit) {
+				return nil, err
+			}
+			if m.Role == blades.RoleAssistant && m.Status == blades.StatusCompleted {
+				answer = m
+			}
+		}
+		if answer == nil {
+			return nil, fmt.Errorf("agent %s: no answer", agent.Name())
+		}
+		next := state.Clone()
+		next[outputKey] = answer.Text()
+		return next, nil
+	}
+}
+
+// graphAgent runs a compiled graph as a blades agent.
+type graphAgent struct {
+	name        string
+	description string
+	executor    *Executor
+}
+
+// NewAgent returns an agent that runs the graph, starting from the session
+// state with the text of the user message under InputKey. It yields the
+// messages the nodes emit, then the value the graph stores under OutputKey,
+// if any, as its final answer.
+func NewAgent(name, description string, executor *Executor) blades.Agent {
+	return &graphAgent{name: name, description: description, executor: executor}
+}
+
+// Name returns the name of the agent.
+func (a *graphAgent) Name() string {
+	return a.name
+}
+
+// Description returns the description of the agent.
+func (a *graphAgent) Description() string {
+	return a.description
+}
+
+// Run runs the graph and yields the messages emitted by its nodes.
+func (a *graphAgent) Run(ctx context.Context, invocation *blades.Invocation) blades.Generator[*blades.Message, error] {
+	ctx = blades.NewPathContext(ctx, a.name)
+	return blades.PathErrors(ctx, func(yield func(*blades.Message, error) bool) {
+		state := State{}
+		if invocation.Session != nil {
+			for k, v := range invocation.Session.State() {
+				state[k] = v
+			}
+		}
+		if invocation.Message != nil {
+			state[InputKey] = invocation.Message.Text()
+		}
+		ctx := blades.NewInvocationContext(ctx, invocation)
+		for event, err := range a.executor.Stream(ctx, state) {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			switch event.Type {
+			case EventMessage:
+				if event.Message.InvocationID == "" {
+					event.Message.InvocationID = invocation.ID
+				}
+				if event.Message.Author == "" {
+					event.Message.Author = event.Node
+				}
+				if !yield(event.Message, nil) {
+					return
+				}
+			case EventDone:
+				output, ok := event.State[OutputKey]
+				if !ok {
+					return
+				}
+				answer := blades.AssistantMessage(fmt.Sprint(output))
+				answer.InvocationID = invocation.ID
+				answer.Author = a.name
+				answer.Status = blades.StatusCompleted
+				answer.Final = true
+				yield(answer, nil)
+			}
+		}
+	})
+}
@@ -0,0 +1,170 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/go-kratos/blades"
+)
+
+// defaultEmitLimit is the number of messages a node may emit by default.
+const defaultEmitLimit = 1000
+
+var (
+	// ErrEmitLimit is returned by Emitter.Send once the node has emitted as
+	// many messages as the graph allows; see WithEmitLimit.
+	ErrEmitLimit = errors.New("graph: node emit limit exceeded")
+	// ErrEmitterClosed is returned by Emitter.Send once the node has finished.
+	ErrEmitterClosed = errors.New("graph: emitter closed")
+)
+
+// EventType is the kind of an Event of a streamed execution.
+type EventType string
+
+const (
+	// EventNodeStarted is sent before the handler of a node runs.
+	EventNodeStarted EventType = "node_started"
+	// EventMessage carries a message emitted by the handler of a node.
+	EventMessage EventType = "message"
+	// EventNodeFinished is sent after the handler of a node returned, with
+	// its error, if any.
+	EventNodeFinished EventType = "node_finished"
+	// EventDone is the last event of a successful execution, with the final state.
+	EventDone EventType = "done"
+)
+
+// Event is an event of an execution streamed by Executor.Stream. The messages
+// of a node are sent after its EventNodeStarted and before its EventNodeFinished.
+type Event struct {
+	Type    EventType
+	Node    string
+	Message *blades.Message
+	Err     error
+	State   State
+}
+
+// Emitter sends user-visible messages, e.g. progress notes, from a node
+// handler to the consumer of the execution.
+type Emitter interface {
+	// Send emits the message. It returns ErrEmitLimit once the node has
+	// emitted too many messages, and ErrEmitterClosed once it has finished.
+	Send(*blades.Message) error
+}
+
+// WithEmitLimit caps the number of messages each node may emit per run.
+// Defaults to 1000.
+func WithEmitLimit(n int) Option {
+	return func(g *Graph) {
+		g.emitLimit = n
+	}
+}
+
+type ctxEmitterKey struct{}
+
+// EmitterFromContext returns the emitter of the node running in the context.
+// Outside of a node, or when the execution is not streamed, the messages
+// are discarded.
+func EmitterFromContext(ctx context.Context) Emitter {
+	if emitter, ok := ctx.Value(ctxEmitterKey{}).(Emitter); ok {
+		return emitter
+	}
+	return discardEmitter{}
+}
+
+// discardEmitter drops the messages of executions that are not streamed.
+type discardEmitter struct{}
+
+func (discardEmitter) Send(*blades.Message) error { return nil }
+
+// eventSink delivers the events of a streamed execution to its consumer.
+type eventSink struct {
+	events chan Event
+	// stop is closed when the consumer stops reading the events.
+	stop chan struct{}
+}
+
+func (s *eventSink) send(event Event) error {
+	select {
+	case s.events <- event:
+		return nil
+	case <-s.stop:
+		return ErrEmitterClosed
+	}
+}
+
+// nodeEmitter sends the messages of one node run to the sink.
+type nodeEmitter struct {
+	mu     sync.Mutex
+	node   string
+	sink   *eventSink
+	limit  int
+	sent   int
+	closed bool
+}
+
+func (e *nodeEmitter) Send(m *blades.Message) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return ErrEmitterClosed
+	}
+	if e.sent >= e.limit {
+		return ErrEmitLimit
+	}
+	e.sent++
+	return e.sink.send(Event{Type: EventMessage, Node: e.node, Message: m})
+}
+
+// close waits for the sends in flight and rejects the later ones, so that no
+// message of the node follows its EventNodeFinished.
+func (e *nodeEmitter) close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.closed = true
+}
+
+// Stream runs the graph task like Execute and yields the start and finish of
+// every node, with the messages the node emits in between, then EventDone
+// with the final state. Stopping the iteration cancels the execution.
+func (e *Executor) Stream(ctx context.Context, state State) blades.Generator[Event, error] {
+	return func(yield func(Event, error) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		sink := &eventSink{events: make(chan Event), stop: make(chan struct{})}
+		t := newTask(e)
+		t.sink = sink
+		var (
+			result State
+			err    error
+			done   = make(chan struct{})
+		)
+		go func() {
+			defer close(done)
+			result, err = t.run(ctx, state)
+		}()
+		defer func() {
+			close(sink.stop)
+			<-done
+			if t.history != nil {
+				e.setHistory(t.history)
+			}
+		}()
+		for {
+			select {
+			case event := <-sink.events:
+				if !yield(event, nil) {
+					cancel()
+					return
+				}
+			case <-done:
+				if err != nil {
+					yield(Event{}, err)
+					return
+				}
+				yield(Event{Type: EventDone, State: result}, nil)
+				return
+			}
+		}
+	}
+}
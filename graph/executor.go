@@ -3,6 +3,7 @@ package graph
 import (
 	"context"
 	"sort"
+	"sync"
 )
 
 // nodeInfo contains precomputed information for a node to avoid runtime lookups.
@@ -20,6 +21,9 @@ type nodeInfo struct {
 type Executor struct {
 	graph     *Graph
 	nodeInfos map[string]*nodeInfo // Precomputed node information
+
+	mu      sync.Mutex
+	history *History // History of the latest execution
 }
 
 // NewExecutor creates a new Executor for the given graph.
@@ -71,7 +75,11 @@ func NewExecutor(g *Graph) *Executor {
 // Execute runs the graph task starting from the given state.
 func (e *Executor) Execute(ctx context.Context, state State) (State, error) {
 	t := newTask(e)
-	return t.run(ctx, state)
+	result, err := t.run(ctx, state)
+	if t.history != nil {
+		e.setHistory(t.history)
+	}
+	return result, err
 }
 
 // cloneEdges creates a copy of edge slice to avoid shared state issues.
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"strings"
+
+	"github.com/go-kratos/blades/expr"
 )
 
 // Option configures the Graph behavior.
@@ -36,6 +38,21 @@ func WithEdgeCondition(condition EdgeCondition) EdgeOption {
 	}
 }
 
+// ConditionExpr compiles an expression over the graph state, available as
+// "state", into an EdgeCondition, so conditions can be defined in config
+// files; see package expr for the syntax. The condition is false if the
+// expression fails to evaluate or does not evaluate to a boolean.
+func ConditionExpr(src string) (EdgeCondition, error) {
+	e, err := expr.Compile(src)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, state State) bool {
+		ok, err := e.Bool(map[string]any{"state": map[string]any(state)})
+		return err == nil && ok
+	}, nil
+}
+
 // conditionalEdge represents an edge with an optional condition.
 type conditionalEdge struct {
 	to        string
@@ -50,14 +67,21 @@ type Graph struct {
 	finishPoint string
 	parallel    bool
 	middlewares []Middleware
+	keys        map[string]*nodeKeys
+	initialKeys []string
+	strictKeys  bool
+	history     *historyConfig
+	emitLimit   int
 }
 
 // New creates a new Graph instance with the provided options.
 func New(opts ...Option) *Graph {
 	g := &Graph{
-		nodes:    make(map[string]Handler),
-		edges:    make(map[string][]conditionalEdge),
-		parallel: true,
+		nodes:     make(map[string]Handler),
+		edges:     make(map[string][]conditionalEdge),
+		keys:      make(map[string]*nodeKeys),
+		parallel:  true,
+		emitLimit: defaultEmitLimit,
 	}
 	for _, opt := range opts {
 		if opt != nil {
@@ -67,13 +91,21 @@ func New(opts ...Option) *Graph {
 	return g
 }
 
-// AddNode adds a named node with its handler to the graph.
+// AddNode adds a named node with its handler to the graph. Options can
+// declare the state keys the node reads and writes.
 // Returns the graph for chaining.
-func (g *Graph) AddNode(name string, handler Handler) *Graph {
+func (g *Graph) AddNode(name string, handler Handler, opts ...NodeOption) *Graph {
 	if _, ok := g.nodes[name]; ok {
 		return g
 	}
 	g.nodes[name] = handler
+	if len(opts) > 0 {
+		keys := &nodeKeys{}
+		for _, opt := range opts {
+			opt(keys)
+		}
+		g.keys[name] = keys
+	}
 	return g
 }
 
@@ -246,6 +278,10 @@ func (g *Graph) Compile() (*Executor, error) {
 	if err := g.validate(); err != nil {
 		return nil, err
 	}
+	// Check the declared state keys before spending tokens on a run
+	if err := g.validateKeys(); err != nil {
+		return nil, err
+	}
 	// Check for cycles before other structural checks
 	if err := g.ensureAcyclic(); err != nil {
 		return nil, err
@@ -5,11 +5,13 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"slices"
 	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/go-kratos/blades"
 	kitretry "github.com/go-kratos/kit/retry"
 )
 
@@ -231,6 +233,51 @@ func TestGraphConditionalRouting(t *testing.T) {
 	}
 }
 
+func TestGraphConditionExpr(t *testing.T) {
+	toSmall, err := ConditionExpr("state.value < 3 && !contains(state.steps, 'skip')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	toLarge, err := ConditionExpr("state.value >= 3 || contains(state.steps, 'skip')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		value int
+		want  []string
+	}{
+		{1, []string{"small", "end"}},
+		{5, []string{"large", "end"}},
+	}
+	for _, tt := range tests {
+		g := New()
+		_ = g.AddNode("start", incrementHandler(0))
+		_ = g.AddNode("small", stepHandler("small"))
+		_ = g.AddNode("large", stepHandler("large"))
+		_ = g.AddNode("end", stepHandler("end"))
+		_ = g.AddEdge("start", "small", WithEdgeCondition(toSmall))
+		_ = g.AddEdge("start", "large", WithEdgeCondition(toLarge))
+		_ = g.AddEdge("small", "end")
+		_ = g.AddEdge("large", "end")
+		_ = g.SetEntryPoint("start")
+		_ = g.SetFinishPoint("end")
+		executor, err := g.Compile()
+		if err != nil {
+			t.Fatalf("compile error: %v", err)
+		}
+		result, err := executor.Execute(context.Background(), State{valueKey: tt.value})
+		if err != nil {
+			t.Fatalf("run error: %v", err)
+		}
+		if steps, _ := result[stepsKey].([]string); !reflect.DeepEqual(steps, tt.want) {
+			t.Fatalf("value %d: want steps %v, got %v", tt.value, tt.want, steps)
+		}
+	}
+	if _, err := ConditionExpr("state.value <"); err == nil {
+		t.Fatal("want a syntax error")
+	}
+}
+
 func TestGraphConditionalMixedPrecedence(t *testing.T) {
 	g := New()
 
@@ -2862,3 +2909,697 @@ func TestRetryMiddlewareRespectsRetryablePredicate(t *testing.T) {
 		t.Fatalf("expected single attempt for non-retryable error, got %d", attempts)
 	}
 }
+
+// writeKeys returns a handler that sets each key to the node name.
+func writeKeys(name string, keys ...string) Handler {
+	return func(ctx context.Context, state State) (State, error) {
+		next := state.Clone()
+		for _, key := range keys {
+			next[key] = name
+		}
+		return next, nil
+	}
+}
+
+func TestGraphKeyValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		build   func() *Graph
+		wantErr string
+	}{
+		{
+			name: "wired",
+			build: func() *Graph {
+				g := New(WithInitialKeys("topic"))
+				g.AddNode("draft", writeKeys("draft", "draft"), Reads("topic"), Writes("draft"))
+				g.AddNode("review", writeKeys("review", "revision"), Reads("draft"), Writes("revision"))
+				g.AddNode("publish", writeKeys("publish"), Reads("draft", "revision"))
+				return g.AddEdge("draft", "review").AddEdge("review", "publish").SetEntryPoint("draft").SetFinishPoint("publish")
+			},
+		},
+		{
+			name: "typo",
+			build: func() *Graph {
+				g := New()
+				g.AddNode("draft", writeKeys("draft", "draft"), Writes("draft"))
+				g.AddNode("review", writeKeys("review", "revision"), Reads("draft"), Writes("revision"))
+				g.AddNode("publish", writeKeys("publish"), Reads("draft", "revison"))
+				return g.AddEdge("draft", "review").AddEdge("review", "publish").SetEntryPoint("draft").SetFinishPoint("publish")
+			},
+			wantErr: `node publish reads key "revison"`,
+		},
+		{
+			name: "missing initial key",
+			build: func() *Graph {
+				g := New()
+				g.AddNode("draft", writeKeys("draft", "draft"), Reads("topic"), Writes("draft"))
+				return g.SetEntryPoint("draft").SetFinishPoint("draft")
+			},
+			wantErr: `node draft reads key "topic"`,
+		},
+		{
+			name: "written by a sibling branch",
+			build: func() *Graph {
+				g := New()
+				g.AddNode("start", stepHandler("start"), Writes(stepsKey))
+				g.AddNode("left", writeKeys("left", "left"), Writes("left"))
+				g.AddNode("right", writeKeys("right"), Reads("left"))
+				g.AddNode("join", stepHandler("join"))
+				return g.AddEdge("start", "left").AddEdge("start", "right").AddEdge("left", "join").AddEdge("right", "join").
+					SetEntryPoint("start").SetFinishPoint("join")
+			},
+			wantErr: `node right reads key "left"`,
+		},
+		{
+			name: "undeclared ancestor",
+			build: func() *Graph {
+				g := New()
+				g.AddNode("draft", writeKeys("draft", "draft"))
+				g.AddNode("publish", writeKeys("publish"), Reads("draft"))
+				return g.AddEdge("draft", "publish").SetEntryPoint("draft").SetFinishPoint("publish")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.build().Compile()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestGraphKeyValidationLoop(t *testing.T) {
+	// Compile rejects cycles, so the key check is exercised directly: a key
+	// written later in the cycle is available on the next pass.
+	g := New(WithInitialKeys("draft"))
+	g.AddNode("review", writeKeys("review", "feedback"), Reads("draft", "revision"), Writes("feedback"))
+	g.AddNode("revise", writeKeys("revise", "revision"), Reads("feedback"), Writes("revision"))
+	g.AddNode("publish", writeKeys("publish"), Reads("revision"))
+	g.AddEdge("review", "revise").AddEdge("revise", "review").AddEdge("revise", "publish")
+	if err := g.validateKeys(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	g.AddNode("audit", writeKeys("audit"), Reads("approval"))
+	g.AddEdge("revise", "audit")
+	if err := g.validateKeys(); err == nil || !strings.Contains(err.Error(), `node audit reads key "approval"`) {
+		t.Fatalf("expected error for audit, got %v", err)
+	}
+}
+
+func TestGraphStrictKeys(t *testing.T) {
+	peek := func(ctx context.Context, state State) (State, error) {
+		next := state.Clone()
+		if _, ok := state["secret"]; ok {
+			return nil, errors.New("read an undeclared key")
+		}
+		next["summary"] = fmt.Sprint(state["draft"])
+		return next, nil
+	}
+	g := New(WithStrictKeys(true), WithInitialKeys("draft", "secret"))
+	g.AddNode("summarize", peek, Reads("draft"), Writes("summary"))
+	g.AddNode("leak", writeKeys("leak", "secret"), Reads("summary"))
+	g.AddEdge("summarize", "leak").SetEntryPoint("summarize").SetFinishPoint("leak")
+	executor, err := g.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = executor.Execute(context.Background(), State{"draft": "text", "secret": "s3cr3t"})
+	if err == nil || !strings.Contains(err.Error(), `node leak writes undeclared key "secret"`) {
+		t.Fatalf("expected undeclared write error, got %v", err)
+	}
+
+	g = New(WithStrictKeys(true), WithInitialKeys("draft", "secret"))
+	g.AddNode("summarize", peek, Reads("draft"), Writes("summary"))
+	g.SetEntryPoint("summarize").SetFinishPoint("summarize")
+	executor, err = g.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := executor.Execute(context.Background(), State{"draft": "text", "secret": "s3cr3t"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := State{"draft": "text", "secret": "s3cr3t", "summary": "text"}
+	if !reflect.DeepEqual(state, want) {
+		t.Fatalf("want %v, got %v", want, state)
+	}
+}
+
+func TestGraphNodePanic(t *testing.T) {
+	t.Run("error", func(t *testing.T) {
+		g := New()
+		g.AddNode("start", stepHandler("start"))
+		g.AddNode("loop", func(ctx context.Context, state State) (State, error) {
+			_ = state["missing"].(int) // panics on the missing key
+			return state, nil
+		})
+		g.AddEdge("start", "loop").SetEntryPoint("start").SetFinishPoint("loop")
+		executor, err := g.Compile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = executor.Execute(context.Background(), State{})
+		var panicErr *blades.PanicError
+		if !errors.As(err, &panicErr) {
+			t.Fatalf("expected a PanicError, got %v", err)
+		}
+		if panicErr.Name != "loop" || len(panicErr.Stack) == 0 || !strings.Contains(err.Error(), "node loop panicked") {
+			t.Fatalf("unexpected panic error: %v", err)
+		}
+	})
+
+	t.Run("retried", func(t *testing.T) {
+		attempts := 0
+		g := New(WithMiddleware(Retry(3)))
+		g.AddNode("flaky", func(ctx context.Context, state State) (State, error) {
+			attempts++
+			if attempts == 1 {
+				panic("transient")
+			}
+			return appendStep(state, "flaky"), nil
+		})
+		g.SetEntryPoint("flaky").SetFinishPoint("flaky")
+		executor, err := g.Compile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		state, err := executor.Execute(context.Background(), State{})
+		if err != nil {
+			t.Fatalf("expected the retry to recover, got %v", err)
+		}
+		if attempts != 2 || !reflect.DeepEqual(getStringSlice(state[stepsKey]), []string{"flaky"}) {
+			t.Fatalf("unexpected result after %d attempts: %v", attempts, state)
+		}
+	})
+
+	t.Run("cancels siblings", func(t *testing.T) {
+		cancelled := make(chan error, 1)
+		started := make(chan struct{})
+		g := New()
+		g.AddNode("start", stepHandler("start"))
+		g.AddNode("boom", func(ctx context.Context, state State) (State, error) {
+			// The sibling must be running for the panic to cancel it.
+			select {
+			case <-started:
+			case <-time.After(5 * time.Second):
+			}
+			panic("boom")
+		})
+		g.AddNode("slow", func(ctx context.Context, state State) (State, error) {
+			close(started)
+			select {
+			case <-ctx.Done():
+				cancelled <- context.Cause(ctx)
+				return nil, ctx.Err()
+			case <-time.After(5 * time.Second):
+				cancelled <- nil
+				return state, nil
+			}
+		})
+		g.AddNode("join", stepHandler("join"))
+		g.AddEdge("start", "boom").AddEdge("start", "slow").AddEdge("boom", "join").AddEdge("slow", "join")
+		g.SetEntryPoint("start").SetFinishPoint("join")
+		executor, err := g.Compile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = executor.Execute(context.Background(), State{})
+		var panicErr *blades.PanicError
+		if !errors.As(err, &panicErr) || panicErr.Name != "boom" {
+			t.Fatalf("expected a PanicError from boom, got %v", err)
+		}
+		select {
+		case cause := <-cancelled:
+			if !errors.As(cause, &panicErr) {
+				t.Fatalf("expected the sibling to be cancelled by the panic, got %v", cause)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("the sibling never ran")
+		}
+	})
+}
+
+func TestGraphHistory(t *testing.T) {
+	attempts := 0
+	g := New(WithHistory(WithHistoryRedactor(func(key string, value any) any {
+		if key == "secret" {
+			return "[redacted]"
+		}
+		return value
+	})), WithMiddleware(Retry(2)))
+	g.AddNode("start", stepHandler("start"))
+	g.AddNode("flaky", func(ctx context.Context, state State) (State, error) {
+		attempts++
+		if attempts == 1 {
+			return nil, errors.New("transient")
+		}
+		next := appendStep(state, "flaky")
+		delete(next, "scratch")
+		return next, nil
+	})
+	g.AddEdge("start", "flaky")
+	g.SetEntryPoint("start")
+	g.SetFinishPoint("flaky")
+	executor, err := g.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := executor.Execute(context.Background(), State{"secret": "hunter2", "scratch": 1}); err != nil {
+		t.Fatal(err)
+	}
+	history := executor.History()
+	if history == nil || len(history.Steps) != 3 {
+		t.Fatalf("expected 3 steps, got %+v", history)
+	}
+	var got []string
+	for _, step := range history.Steps {
+		got = append(got, fmt.Sprintf("%s#%d:%v", step.Node, step.Attempt, step.Err))
+	}
+	if want := []string{"start#1:<nil>", "flaky#1:transient", "flaky#2:<nil>"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("steps = %v, want %v", got, want)
+	}
+	last := history.Steps[2]
+	if last.Input["secret"] != "[redacted]" {
+		t.Fatalf("secret not redacted: %v", last.Input)
+	}
+	if !reflect.DeepEqual(last.Diff.Set, State{stepsKey: []string{"start", "flaky"}}) || !reflect.DeepEqual(last.Diff.Deleted, []string{"scratch"}) {
+		t.Fatalf("unexpected diff: %+v", last.Diff)
+	}
+	// Snapshots are deep copies.
+	getStringSlice(last.Input[stepsKey])[0] = "mutated"
+	if history.Steps[1].Input[stepsKey].([]string)[0] != "start" {
+		t.Fatal("snapshots share memory")
+	}
+	report := history.String()
+	for _, want := range []string{"step 1: flaky (attempt 1", "error: transient", "deleted: scratch", "secret = [redacted]"} {
+		if !strings.Contains(report, want) {
+			t.Fatalf("report misses %q:\n%s", want, report)
+		}
+	}
+}
+
+func TestGraphHistoryLimit(t *testing.T) {
+	g := New(WithHistory(WithHistoryLimit(2)))
+	g.AddNode("a", stepHandler("a"))
+	g.AddNode("b", stepHandler("b"))
+	g.AddNode("c", stepHandler("c"))
+	g.AddEdge("a", "b")
+	g.AddEdge("b", "c")
+	g.SetEntryPoint("a")
+	g.SetFinishPoint("c")
+	executor, err := g.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := executor.Execute(context.Background(), State{}); err != nil {
+		t.Fatal(err)
+	}
+	history := executor.History()
+	if history.Dropped != 1 || len(history.Steps) != 2 || history.Steps[0].Node != "b" {
+		t.Fatalf("unexpected history: dropped %d, steps %+v", history.Dropped, history.Steps)
+	}
+}
+
+func TestGraphReplay(t *testing.T) {
+	calls := map[string]int{}
+	var mu sync.Mutex
+	counted := func(name string) Handler {
+		return func(ctx context.Context, state State) (State, error) {
+			mu.Lock()
+			calls[name]++
+			mu.Unlock()
+			return appendStep(state, name), nil
+		}
+	}
+	g := New(WithHistory())
+	g.AddNode("start", counted("start"))
+	g.AddNode("left", counted("left"))
+	g.AddNode("right", counted("right"))
+	g.AddNode("join", counted("join"))
+	g.AddEdge("start", "left")
+	g.AddEdge("start", "right")
+	g.AddEdge("left", "join")
+	g.AddEdge("right", "join")
+	g.SetEntryPoint("start")
+	g.SetFinishPoint("join")
+	executor, err := g.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := executor.Execute(context.Background(), State{}); err != nil {
+		t.Fatal(err)
+	}
+	history := executor.History()
+	step := slices.IndexFunc(history.Steps, func(s Step) bool { return s.Node == "left" })
+	state, err := executor.Replay(context.Background(), history, step)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := getStringSlice(state[stepsKey]); !reflect.DeepEqual(got, []string{"start", "left", "join"}) {
+		t.Fatalf("replayed steps = %v", got)
+	}
+	if calls["start"] != 1 || calls["left"] != 2 || calls["right"] != 1 || calls["join"] != 2 {
+		t.Fatalf("unexpected calls: %v", calls)
+	}
+	if replayed := executor.History(); len(replayed.Steps) != 2 || replayed.Steps[0].Node != "left" {
+		t.Fatalf("unexpected replay history: %+v", replayed.Steps)
+	}
+	if _, err := executor.Replay(context.Background(), history, len(history.Steps)); err == nil {
+		t.Fatal("expected out of range error")
+	}
+}
+
+func TestStateCloneDeep(t *testing.T) {
+	type record struct{ Tags []string }
+	index := map[string]int{"a": 1}
+	pointer := &record{Tags: []string{"p"}}
+	state := State{
+		"items":  []string{"a", "b"},
+		"nested": map[string]any{"list": []any{map[string]any{"n": 1}}, "ints": []int{1}},
+		"typed":  map[string][]string{"k": {"v"}},
+		"array":  [2][]string{{"x"}, {"y"}},
+		"ptr":    pointer,
+		"index":  Share(index),
+		"none":   []string(nil),
+	}
+	c := state.Clone()
+	c["items"].([]string)[0] = "mutated"
+	c["nested"].(map[string]any)["list"].([]any)[0].(map[string]any)["n"] = 2
+	c["nested"].(map[string]any)["ints"].([]int)[0] = 2
+	c["typed"].(map[string][]string)["k"][0] = "mutated"
+	array := c["array"].([2][]string)
+	array[0][0] = "mutated"
+	c["index"].(Shared[map[string]int]).Value["a"] = 2
+	want := State{
+		"items":  []string{"a", "b"},
+		"nested": map[string]any{"list": []any{map[string]any{"n": 1}}, "ints": []int{1}},
+		"typed":  map[string][]string{"k": {"v"}},
+		"array":  [2][]string{{"x"}, {"y"}},
+		"ptr":    pointer,
+		"index":  Share(map[string]int{"a": 2}),
+		"none":   []string(nil),
+	}
+	if !reflect.DeepEqual(state, want) {
+		t.Fatalf("the original changed:\n%#v\nwant\n%#v", state, want)
+	}
+	if c["ptr"] != pointer || c["none"].([]string) != nil {
+		t.Fatalf("want pointers shared and nil slices kept, got %#v", c)
+	}
+}
+
+func TestGraphParallelBranchesAppendIsolated(t *testing.T) {
+	g := New(WithParallel(true))
+	g.AddNode("start", func(ctx context.Context, state State) (State, error) {
+		// Spare capacity lets an in-place append of one branch overwrite the other's.
+		items := make([]string, 1, 4)
+		items[0] = "start"
+		return State{"items": items, "meta": map[string]any{"branch": "none"}}, nil
+	})
+	seen := make(map[string][]string)
+	var mu sync.Mutex
+	branch := func(name string) Handler {
+		return func(ctx context.Context, state State) (State, error) {
+			items := append(state["items"].([]string), name)
+			state["meta"].(map[string]any)["branch"] = name
+			time.Sleep(5 * time.Millisecond)
+			mu.Lock()
+			seen[name] = slices.Clone(items)
+			mu.Unlock()
+			if got := state["meta"].(map[string]any)["branch"]; got != name {
+				return nil, fmt.Errorf("branch %s sees the metadata of %v", name, got)
+			}
+			return State{name: items}, nil
+		}
+	}
+	g.AddNode("a", branch("a"))
+	g.AddNode("b", branch("b"))
+	g.AddNode("join", func(ctx context.Context, state State) (State, error) {
+		return state, nil
+	})
+	g.AddEdge("start", "a")
+	g.AddEdge("start", "b")
+	g.AddEdge("a", "join")
+	g.AddEdge("b", "join")
+	g.SetEntryPoint("start")
+	g.SetFinishPoint("join")
+	executor, err := g.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 20 {
+		out, err := executor.Execute(context.Background(), State{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"a", "b"} {
+			want := []string{"start", name}
+			if !reflect.DeepEqual(out[name], want) || !reflect.DeepEqual(seen[name], want) {
+				t.Fatalf("branch %s: want %v, got %v (seen %v)", name, want, out[name], seen[name])
+			}
+		}
+	}
+}
+
+func TestGraphHistoryInPlaceMutation(t *testing.T) {
+	g := New(WithHistory())
+	g.AddNode("start", func(ctx context.Context, state State) (State, error) {
+		// The node mutates its input in place rather than a clone.
+		state["items"].([]string)[0] = "changed"
+		return state, nil
+	})
+	g.SetEntryPoint("start")
+	g.SetFinishPoint("start")
+	executor, err := g.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := State{"items": []string{"original"}}
+	if _, err := executor.Execute(context.Background(), input); err != nil {
+		t.Fatal(err)
+	}
+	if input["items"].([]string)[0] != "original" {
+		t.Fatalf("the caller's state changed: %v", input)
+	}
+	step := executor.History().Steps[0]
+	if step.Input["items"].([]string)[0] != "original" || !reflect.DeepEqual(step.Diff.Set, State{"items": []string{"changed"}}) {
+		t.Fatalf("want the in-place mutation recorded, got input %v and diff %+v", step.Input, step.Diff)
+	}
+}
+
+func BenchmarkStateClone(b *testing.B) {
+	items := make([]any, 100)
+	for i := range items {
+		items[i] = map[string]any{"id": i, "name": fmt.Sprint("item ", i), "tags": []any{"a", "b"}}
+	}
+	state := State{
+		"query":    "find the items",
+		"count":    100,
+		"items":    items,
+		"selected": []string{"1", "2", "3"},
+		"index":    Share(make(map[string]int, 1000)),
+	}
+	b.ReportAllocs()
+	for b.Loop() {
+		state.Clone()
+	}
+}
+
+func TestGraphEmitter(t *testing.T) {
+	var late Emitter
+	g := New(WithEmitLimit(2))
+	g.AddNode("search", func(ctx context.Context, state State) (State, error) {
+		emitter := EmitterFromContext(ctx)
+		for _, text := range []string{"searching", "found 12 documents", "dropped"} {
+			if err := emitter.Send(blades.AssistantMessage(text)); err != nil {
+				if !errors.Is(err, ErrEmitLimit) {
+					return nil, err
+				}
+			}
+		}
+		late = emitter
+		return appendStep(state, "search"), nil
+	})
+	g.AddNode("analyze", func(ctx context.Context, state State) (State, error) {
+		if err := EmitterFromContext(ctx).Send(blades.AssistantMessage("analyzing")); err != nil {
+			return nil, err
+		}
+		return appendStep(state, "analyze"), nil
+	})
+	g.AddEdge("search", "analyze")
+	g.SetEntryPoint("search")
+	g.SetFinishPoint("analyze")
+	executor, err := g.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for event, err := range executor.Stream(context.Background(), State{}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch event.Type {
+		case EventMessage:
+			got = append(got, event.Node+": "+event.Message.Text())
+		case EventDone:
+			got = append(got, fmt.Sprintf("done: %v", event.State[stepsKey]))
+		default:
+			got = append(got, fmt.Sprintf("%s %s", event.Type, event.Node))
+		}
+	}
+	want := []string{
+		"node_started search",
+		"search: searching",
+		"search: found 12 documents",
+		"node_finished search",
+		"node_started analyze",
+		"analyze: analyzing",
+		"node_finished analyze",
+		"done: [search analyze]",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("events = %q, want %q", got, want)
+	}
+	if err := late.Send(blades.AssistantMessage("late")); !errors.Is(err, ErrEmitterClosed) {
+		t.Fatalf("send after the node finished: %v", err)
+	}
+	// Without a stream the messages are discarded.
+	if _, err := executor.Execute(context.Background(), State{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGraphStreamStops(t *testing.T) {
+	g := New()
+	g.AddNode("chatty", func(ctx context.Context, state State) (State, error) {
+		for {
+			if err := EmitterFromContext(ctx).Send(blades.AssistantMessage("tick")); err != nil {
+				return nil, err
+			}
+		}
+	})
+	g.SetEntryPoint("chatty")
+	g.SetFinishPoint("chatty")
+	executor, err := g.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []error
+	for event, err := range executor.Stream(context.Background(), State{}) {
+		if err != nil {
+			got = append(got, err)
+			break
+		}
+		if event.Type == EventMessage {
+			break
+		}
+	}
+	if len(got) != 0 {
+		t.Fatalf("unexpected errors: %v", got)
+	}
+}
+
+// chunkAgent streams its answer in chunks.
+type chunkAgent struct {
+	name   string
+	chunks []string
+}
+
+func (a *chunkAgent) Name() string        { return a.name }
+func (a *chunkAgent) Description() string { return "" }
+
+func (a *chunkAgent) Run(ctx context.Context, invocation *blades.Invocation) blades.Generator[*blades.Message, error] {
+	return func(yield func(*blades.Message, error) bool) {
+		prefix := invocation.Message.Text() + ": "
+		for _, chunk := range a.chunks {
+			m := blades.AssistantMessage(chunk)
+			m.Status = blades.StatusIncomplete
+			if !yield(m, nil) {
+				return
+			}
+		}
+		answer := blades.AssistantMessage(prefix + strings.Join(a.chunks, ""))
+		answer.Status = blades.StatusCompleted
+		yield(answer, nil)
+	}
+}
+
+func TestAgentNode(t *testing.T) {
+	g := New()
+	g.AddNode("writer", AgentNode(&chunkAgent{name: "writer", chunks: []string{"Hel", "lo"}}, InputKey, "draft"))
+	g.AddNode("reviewer", AgentNode(&chunkAgent{name: "reviewer", chunks: []string{"OK"}}, "draft", OutputKey))
+	g.AddEdge("writer", "reviewer")
+	g.SetEntryPoint("writer")
+	g.SetFinishPoint("reviewer")
+	executor, err := g.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent := NewAgent("pipeline", "", executor)
+	invocation := &blades.Invocation{ID: "inv", Session: blades.NewSession(), Message: blades.UserMessage("greet")}
+	var got []string
+	for m, err := range agent.Run(context.Background(), invocation) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.InvocationID != "inv" {
+			t.Fatalf("message %q of invocation %q", m.Text(), m.InvocationID)
+		}
+		got = append(got, fmt.Sprintf("%s/%s/%v: %s", m.Author, m.Status, m.Final, m.Text()))
+	}
+	want := []string{
+		"writer/incomplete/false: Hel",
+		"writer/incomplete/false: lo",
+		"writer/completed/false: greet: Hello",
+		"reviewer/incomplete/false: OK",
+		"reviewer/completed/false: greet: Hello: OK",
+		"pipeline/completed/true: greet: Hello: OK",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("messages = %q, want %q", got, want)
+	}
+}
+
+func TestGraphStateSnapshots(t *testing.T) {
+	setState := func(key, value string) Handler {
+		return func(ctx context.Context, state State) (State, error) {
+			session, _ := blades.FromSessionContext(ctx)
+			session.SetState(key, value)
+			return state, nil
+		}
+	}
+	g := New()
+	g.AddNode("plan", setState("plan", "draft"))
+	g.AddNode("login", setState("session_token", "tok-123"))
+	g.AddEdge("plan", "login")
+	g.SetEntryPoint("plan")
+	g.SetFinishPoint("login")
+	executor, err := g.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := blades.NewRunner(NewAgent("pipeline", "", executor))
+	for _, err := range runner.RunStream(context.Background(), blades.UserMessage("go"), blades.WithInvocationID("inv"), blades.WithStateSnapshots()) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	report, _ := runner.Report("inv")
+	var got []string
+	for _, diff := range report.StateDiffs() {
+		for _, change := range diff.Changes {
+			got = append(got, fmt.Sprintf("%s: %s %s=%v", diff.Step, change.Kind, change.Key, change.New))
+		}
+	}
+	want := []string{"pipeline/plan: added plan=draft", "pipeline/login: added session_token=[REDACTED]"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("diffs = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,260 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultHistoryLimit is the number of steps a history keeps by default.
+const defaultHistoryLimit = 1000
+
+// reportValueLimit is the length at which the report truncates a value.
+const reportValueLimit = 120
+
+// Redactor returns the value to record for a state key, e.g. a placeholder
+// for a large or sensitive value.
+type Redactor func(key string, value any) any
+
+// HistoryOption configures the execution history.
+type HistoryOption func(*historyConfig)
+
+type historyConfig struct {
+	limit  int
+	redact Redactor
+}
+
+// WithHistoryLimit sets the number of steps a history keeps. Older steps are
+// dropped once it is reached. Defaults to 1000; zero or less keeps every step.
+func WithHistoryLimit(n int) HistoryOption {
+	return func(c *historyConfig) {
+		c.limit = n
+	}
+}
+
+// WithHistoryRedactor sets the function that replaces state values before
+// they are recorded.
+func WithHistoryRedactor(redact Redactor) HistoryOption {
+	return func(c *historyConfig) {
+		c.redact = redact
+	}
+}
+
+// WithHistory records every node attempt of an execution. The history of the
+// latest execution is returned by Executor.History.
+func WithHistory(opts ...HistoryOption) Option {
+	return func(g *Graph) {
+		config := &historyConfig{limit: defaultHistoryLimit}
+		for _, opt := range opts {
+			opt(config)
+		}
+		g.history = config
+	}
+}
+
+// StateDiff is the change a node made to its input state.
+type StateDiff struct {
+	// Set holds the keys the node added or changed, with their new values.
+	Set State
+	// Deleted holds the keys the node removed.
+	Deleted []string
+}
+
+// Step is a node attempt recorded in a History.
+type Step struct {
+	Node string
+	// Attempt counts the attempts of the node in the execution, from 1.
+	Attempt int
+	// Input is a copy of the state the node received, made like State.Clone:
+	// values behind pointers or wrapped in Shared are recorded by reference.
+	Input    State
+	Diff     StateDiff
+	Duration time.Duration
+	Err      error
+}
+
+// History is the sequence of node attempts of an execution, in the order
+// they completed.
+type History struct {
+	Steps []Step
+	// Dropped counts the steps dropped because of the history limit.
+	Dropped int
+
+	mu       sync.Mutex
+	config   *historyConfig
+	attempts map[string]int
+}
+
+func newHistory(config *historyConfig) *History {
+	return &History{config: config, attempts: make(map[string]int)}
+}
+
+// record wraps the handler of a node to record each call as a step.
+func (h *History) record(node string, next Handler) Handler {
+	return func(ctx context.Context, state State) (State, error) {
+		h.mu.Lock()
+		h.attempts[node]++
+		attempt := h.attempts[node]
+		h.mu.Unlock()
+		step := Step{Node: node, Attempt: attempt, Input: h.snapshot(state)}
+		before := state.Clone()
+		start := time.Now()
+		out, err := next(ctx, state)
+		step.Duration = time.Since(start)
+		step.Err = err
+		if err == nil {
+			step.Diff = h.diff(before, out)
+		}
+		h.append(step)
+		return out, err
+	}
+}
+
+func (h *History) append(step Step) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.Steps = append(h.Steps, step)
+	if limit := h.config.limit; limit > 0 && len(h.Steps) > limit {
+		h.Dropped += len(h.Steps) - limit
+		h.Steps = slices.Delete(h.Steps, 0, len(h.Steps)-limit)
+	}
+}
+
+// value returns the recorded copy of a state value.
+func (h *History) value(key string, v any) any {
+	if h.config.redact != nil {
+		v = h.config.redact(key, v)
+	}
+	return cloneValue(v)
+}
+
+func (h *History) snapshot(state State) State {
+	snapshot := make(State, len(state))
+	for key, v := range state {
+		snapshot[key] = h.value(key, v)
+	}
+	return snapshot
+}
+
+func (h *History) diff(before, after State) StateDiff {
+	diff := StateDiff{Set: State{}}
+	for key, v := range after {
+		if old, ok := before[key]; !ok || !reflect.DeepEqual(old, v) {
+			diff.Set[key] = h.value(key, v)
+		}
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			diff.Deleted = append(diff.Deleted, key)
+		}
+	}
+	slices.Sort(diff.Deleted)
+	return diff
+}
+
+// String renders the history as a step-by-step report.
+func (h *History) String() string {
+	var b strings.Builder
+	if h.Dropped > 0 {
+		fmt.Fprintf(&b, "(%d earlier steps dropped)\n", h.Dropped)
+	}
+	for i, step := range h.Steps {
+		fmt.Fprintf(&b, "step %d: %s (attempt %d, %s)\n", i, step.Node, step.Attempt, step.Duration)
+		b.WriteString("  input:\n")
+		writeState(&b, "    ", step.Input)
+		if step.Err != nil {
+			fmt.Fprintf(&b, "  error: %v\n", step.Err)
+			continue
+		}
+		if len(step.Diff.Set) == 0 && len(step.Diff.Deleted) == 0 {
+			b.WriteString("  no changes\n")
+			continue
+		}
+		if len(step.Diff.Set) > 0 {
+			b.WriteString("  set:\n")
+			writeState(&b, "    ", step.Diff.Set)
+		}
+		if len(step.Diff.Deleted) > 0 {
+			fmt.Fprintf(&b, "  deleted: %s\n", strings.Join(step.Diff.Deleted, ", "))
+		}
+	}
+	return b.String()
+}
+
+func writeState(b *strings.Builder, indent string, state State) {
+	keys := make([]string, 0, len(state))
+	for key := range state {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		value := fmt.Sprintf("%v", state[key])
+		if len(value) > reportValueLimit {
+			value = value[:reportValueLimit] + "..."
+		}
+		fmt.Fprintf(b, "%s%s = %s\n", indent, key, value)
+	}
+}
+
+// History returns the history of the latest execution, or nil if the graph
+// does not record it. With concurrent executions, it is the one that
+// finished last.
+func (e *Executor) History() *History {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.history
+}
+
+// Replay executes the graph again from a step of the history, running its
+// node on the recorded input and then the nodes reachable from it. Nodes
+// that are not reachable from it are treated as skipped, and redacted values
+// are replayed as recorded.
+func (e *Executor) Replay(ctx context.Context, history *History, step int) (State, error) {
+	if history == nil || step < 0 || step >= len(history.Steps) {
+		return nil, fmt.Errorf("graph: replay step %d out of range", step)
+	}
+	recorded := history.Steps[step]
+	replay := NewExecutor(e.graph.from(recorded.Node))
+	state, err := replay.Execute(ctx, recorded.Input.Clone())
+	if h := replay.History(); h != nil {
+		e.setHistory(h)
+	}
+	return state, err
+}
+
+func (e *Executor) setHistory(h *History) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.history = h
+}
+
+// from returns a copy of the graph that starts at the node and keeps only the
+// edges of the nodes reachable from it.
+func (g *Graph) from(node string) *Graph {
+	reachable := map[string]bool{}
+	queue := []string{node}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if reachable[name] {
+			continue
+		}
+		reachable[name] = true
+		for _, edge := range g.edges[name] {
+			queue = append(queue, edge.to)
+		}
+	}
+	sub := *g
+	sub.entryPoint = node
+	sub.edges = make(map[string][]conditionalEdge, len(reachable))
+	for from, edges := range g.edges {
+		if reachable[from] {
+			sub.edges[from] = edges
+		}
+	}
+	return &sub
+}
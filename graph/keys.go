@@ -0,0 +1,138 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+)
+
+// NodeOption configures a node when it is added to the graph.
+type NodeOption func(*nodeKeys)
+
+// nodeKeys are the state keys a node declares to read and write.
+type nodeKeys struct {
+	reads  []string
+	writes []string
+}
+
+// Reads declares the state keys the node reads. Compile verifies that an
+// ancestor node writes them or that they are initial keys.
+func Reads(keys ...string) NodeOption {
+	return func(k *nodeKeys) {
+		k.reads = append(k.reads, keys...)
+	}
+}
+
+// Writes declares the state keys the node writes.
+func Writes(keys ...string) NodeOption {
+	return func(k *nodeKeys) {
+		k.writes = append(k.writes, keys...)
+	}
+}
+
+// WithInitialKeys declares the keys of the initial state passed to Execute,
+// which every node may read.
+func WithInitialKeys(keys ...string) Option {
+	return func(g *Graph) {
+		g.initialKeys = append(g.initialKeys, keys...)
+	}
+}
+
+// WithStrictKeys makes nodes that declare their keys fail when they write an
+// undeclared key. Such nodes only see the keys they declare.
+func WithStrictKeys(enabled bool) Option {
+	return func(g *Graph) {
+		g.strictKeys = enabled
+	}
+}
+
+// validateKeys verifies that every key a node reads is written by one of its
+// ancestors or is an initial key. Nodes without declarations may write any key,
+// so a node with such an ancestor is not checked. In a cycle, the nodes later
+// in the cycle are ancestors too.
+func (g *Graph) validateKeys() error {
+	predecessors := make(map[string][]string, len(g.nodes))
+	for from, edges := range g.edges {
+		for _, edge := range edges {
+			predecessors[edge.to] = append(predecessors[edge.to], from)
+		}
+	}
+	names := make([]string, 0, len(g.keys))
+	for name := range g.keys {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		reads := g.keys[name].reads
+		if len(reads) == 0 {
+			continue
+		}
+		available := make(map[string]bool)
+		for _, key := range g.initialKeys {
+			available[key] = true
+		}
+		opaque := false
+		visited := make(map[string]bool)
+		queue := slices.Clone(predecessors[name])
+		for len(queue) > 0 {
+			node := queue[0]
+			queue = queue[1:]
+			if visited[node] {
+				continue
+			}
+			visited[node] = true
+			keys, ok := g.keys[node]
+			if !ok {
+				opaque = true
+				break
+			}
+			for _, key := range keys.writes {
+				available[key] = true
+			}
+			queue = append(queue, predecessors[node]...)
+		}
+		if opaque {
+			continue
+		}
+		for _, key := range reads {
+			if !available[key] {
+				return fmt.Errorf("graph: node %s reads key %q, which no ancestor writes and is not an initial key", name, key)
+			}
+		}
+	}
+	return nil
+}
+
+// strictHandler restricts the handler of a node to the keys it declares.
+func strictHandler(node string, keys *nodeKeys, next Handler) Handler {
+	return func(ctx context.Context, state State) (State, error) {
+		view := State{}
+		for _, key := range slices.Concat(keys.reads, keys.writes) {
+			if v, ok := state[key]; ok {
+				view[key] = v
+			}
+		}
+		out, err := next(ctx, view)
+		if err != nil {
+			return nil, err
+		}
+		for key, v := range out {
+			if slices.Contains(keys.writes, key) {
+				continue
+			}
+			if old, ok := view[key]; !ok || !reflect.DeepEqual(old, v) {
+				return nil, fmt.Errorf("graph: node %s writes undeclared key %q", node, key)
+			}
+		}
+		result := state.Clone()
+		for _, key := range keys.writes {
+			if v, ok := out[key]; ok {
+				result[key] = v
+			} else {
+				delete(result, key)
+			}
+		}
+		return result, nil
+	}
+}
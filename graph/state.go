@@ -1,17 +1,125 @@
 package graph
 
-import "maps"
+import (
+	"reflect"
+)
 
 // State represents the mutable data that flows through the graph.
 // It is implemented as a map of string keys to arbitrary values.
 // Handlers should treat State as immutable and always return a cloned instance.
 type State map[string]any
 
-// Clone performs a shallow copy using maps.Clone so callers can mutate without
-// affecting the original map (nested references are shared intentionally).
+// Shared marks a state value that Clone shares between the copies instead of
+// copying it, e.g. a large read-only index or a value that synchronizes its
+// own access. Mutations of a shared value are seen by every branch and by
+// the recorded history.
+type Shared[T any] struct {
+	Value T
+}
+
+// Share wraps the value so that Clone shares it.
+func Share[T any](v T) Shared[T] {
+	return Shared[T]{Value: v}
+}
+
+func (Shared[T]) shared() {}
+
+// sharedValue is implemented by Shared.
+type sharedValue interface {
+	shared()
+}
+
+// Clone returns a deep copy of the state, so that a node or a parallel branch
+// can mutate the copy, including the maps and slices nested in its values,
+// without affecting the original or its siblings.
+//
+// Maps, slices and arrays are copied recursively, whatever their element
+// types. Pointers, channels, functions and the values wrapped in Shared are
+// shared, as are the maps and slices reachable only through them; structs are
+// copied like an assignment would.
 func (s State) Clone() State {
-	if s == nil {
-		return State{}
+	c := make(State, len(s))
+	for key, v := range s {
+		c[key] = cloneValue(v)
+	}
+	return c
+}
+
+// cloneValue copies the maps, slices and arrays of a value tree, with fast
+// paths for the types decoded from JSON.
+func cloneValue(v any) any {
+	switch v := v.(type) {
+	case nil, string, bool, int, int64, float64, sharedValue:
+		return v
+	case State:
+		return v.Clone()
+	case map[string]any:
+		c := make(map[string]any, len(v))
+		for key, e := range v {
+			c[key] = cloneValue(e)
+		}
+		return c
+	case []any:
+		if v == nil {
+			return v
+		}
+		c := make([]any, len(v))
+		for i, e := range v {
+			c[i] = cloneValue(e)
+		}
+		return c
+	case []string:
+		if v == nil {
+			return v
+		}
+		return append([]string(nil), v...)
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array:
+		return cloneReflect(rv).Interface()
+	default:
+		return v
+	}
+}
+
+// cloneReflect copies the maps, slices and arrays of a value, and those held
+// by its elements.
+func cloneReflect(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(iter.Key(), cloneReflect(iter.Value()))
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := range v.Len() {
+			c.Index(i).Set(cloneReflect(v.Index(i)))
+		}
+		return c
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for i := range v.Len() {
+			c.Index(i).Set(cloneReflect(v.Index(i)))
+		}
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(reflect.ValueOf(cloneValue(v.Elem().Interface())))
+		return c
+	default:
+		return v
 	}
-	return State(maps.Clone(map[string]any(s)))
 }
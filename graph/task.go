@@ -3,7 +3,11 @@ package graph
 import (
 	"context"
 	"fmt"
+	"runtime/debug"
 	"sync"
+
+	"github.com/go-kratos/blades"
+	"github.com/go-kratos/blades/internal/panics"
 )
 
 const entryContributionParent = "graph_entry"
@@ -36,6 +40,12 @@ type Task struct {
 	finished    bool
 	finishState State
 	err         error
+	// cancel cancels the nodes in flight when the task fails.
+	cancel context.CancelCauseFunc
+	// history records the node attempts if the graph has WithHistory.
+	history *History
+	// sink receives the events of the execution if it is streamed.
+	sink *eventSink
 }
 
 func newTask(e *Executor) *Task {
@@ -55,11 +65,16 @@ func newTask(e *Executor) *Task {
 		inFlight:      make(map[string]bool, len(e.graph.nodes)),
 		visited:       make(map[string]bool, len(e.graph.nodes)),
 	}
+	if e.graph.history != nil {
+		task.history = newHistory(e.graph.history)
+	}
 	task.readyCond = sync.NewCond(&task.mu)
 	return task
 }
 
 func (t *Task) run(ctx context.Context, state State) (State, error) {
+	ctx, t.cancel = context.WithCancelCause(ctx)
+	defer t.cancel(nil)
 	// Add initial contribution to entry point
 	t.addInitialContribution(state)
 	// Main scheduling loop
@@ -86,7 +101,8 @@ type terminationResult struct {
 func (t *Task) addInitialContribution(initial State) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
-	if t.addContributionLocked(t.executor.graph.entryPoint, entryContributionParent, initial) {
+	// The graph works on its own copy, so the caller's state is left untouched.
+	if t.addContributionLocked(t.executor.graph.entryPoint, entryContributionParent, initial.Clone()) {
 		t.received[t.executor.graph.entryPoint]++
 	}
 	t.ready = append(t.ready, t.executor.graph.entryPoint)
@@ -176,16 +192,51 @@ func (t *Task) executeNode(ctx context.Context, node string, state State) {
 	}
 	t.mu.Unlock()
 
-	// Execute handler
-	handler := t.executor.graph.nodes[node]
+	// A panic outside the node handler, e.g. in a middleware or an edge condition, fails the task.
+	defer func() {
+		if v := recover(); v != nil {
+			t.fail(fmt.Errorf("graph: failed to execute node %s: %w", node, &blades.PanicError{Scope: "node", Name: node, Value: v, Stack: debug.Stack()}))
+		}
+	}()
+
+	// Execute handler; a panic in it is an error that the middlewares, e.g. retries, see.
+	handler := recoverNode(node, t.executor.graph.nodes[node])
+	if keys, ok := t.executor.graph.keys[node]; ok && t.executor.graph.strictKeys {
+		handler = strictHandler(node, keys, handler)
+	}
+	if t.history != nil {
+		handler = t.history.record(node, handler)
+	}
 	if len(t.executor.graph.middlewares) > 0 {
 		handler = ChainMiddlewares(t.executor.graph.middlewares...)(handler)
 	}
 
-	nodeCtx := NewNodeContext(ctx, &NodeContext{Name: node})
+	if err := blades.CheckLimits(ctx, node, nil); err != nil {
+		t.fail(fmt.Errorf("graph: failed to execute node %s: %w", node, err))
+		return
+	}
+
+	nodeCtx := blades.NewPathContext(NewNodeContext(ctx, &NodeContext{Name: node}), node)
+	var emitter *nodeEmitter
+	if t.sink != nil {
+		if err := t.sink.send(Event{Type: EventNodeStarted, Node: node}); err != nil {
+			t.fail(fmt.Errorf("graph: failed to execute node %s: %w", node, err))
+			return
+		}
+		emitter = &nodeEmitter{node: node, sink: t.sink, limit: t.executor.graph.emitLimit}
+		nodeCtx = context.WithValue(nodeCtx, ctxEmitterKey{}, Emitter(emitter))
+	}
+	end := blades.TrackStep(nodeCtx)
 	nextState, err := handler(nodeCtx, state)
+	end()
+	if emitter != nil {
+		emitter.close()
+		if sendErr := t.sink.send(Event{Type: EventNodeFinished, Node: node, Err: err}); sendErr != nil && err == nil {
+			err = sendErr
+		}
+	}
 	if err != nil {
-		t.fail(fmt.Errorf("graph: failed to execute node %s: %w", node, err))
+		t.fail(fmt.Errorf("graph: failed to execute node %s: %w", node, blades.WrapPathError(nodeCtx, err)))
 		return
 	}
 
@@ -303,9 +354,19 @@ func (t *Task) fail(err error) {
 		return
 	}
 	t.err = err
+	// Cancel the sibling branches still in flight.
+	t.cancel(err)
 	t.readyCond.Broadcast()
 }
 
+// recoverNode converts a panic in the node handler into a *blades.PanicError.
+func recoverNode(node string, next Handler) Handler {
+	return func(ctx context.Context, state State) (result State, err error) {
+		defer panics.Recover("node", node, &err)
+		return next(ctx, state)
+	}
+}
+
 func (t *Task) buildAggregateLocked(node string) State {
 	state := State{}
 	contribs, ok := t.contributions[node]
@@ -318,12 +379,15 @@ func (t *Task) buildAggregateLocked(node string) State {
 	info := t.executor.nodeInfos[node]
 	order := info.predecessors
 
-	// Merge in predecessor order for determinism; the entry node's list already includes the synthetic parent
+	// Merge in predecessor order for determinism; the entry node's list already includes the synthetic parent.
+	// Each contribution is a copy owned by its edge, so they are merged without copying again.
+	updates := make([]State, 0, len(contribs))
 	for _, parent := range order {
 		if contribution, exists := contribs[parent]; exists {
-			state = mergeStates(state, contribution)
+			updates = append(updates, contribution)
 		}
 	}
+	state = mergeStates(nil, updates...)
 
 	// Clean up contributions
 	delete(t.contributions, node)
@@ -0,0 +1,195 @@
+package blades
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Checkable is implemented by components that can verify their dependencies,
+// e.g. a model provider reaching its API or an MCP client pinging its server.
+type Checkable interface {
+	Check(context.Context) error
+}
+
+// Composite is implemented by agents that run sub-agents, so that HealthCheck walks them.
+type Composite interface {
+	SubAgents() []Agent
+}
+
+// HealthStatus is the outcome of a component check.
+type HealthStatus string
+
+const (
+	// HealthPass indicates the component check succeeded.
+	HealthPass HealthStatus = "pass"
+	// HealthFail indicates the component check failed or timed out.
+	HealthFail HealthStatus = "fail"
+	// HealthSkip indicates the component cannot be checked.
+	HealthSkip HealthStatus = "skip"
+)
+
+// ComponentHealth is the result of checking one component.
+type ComponentHealth struct {
+	Name    string        `json:"name"`
+	Kind    string        `json:"kind"`
+	Status  HealthStatus  `json:"status"`
+	Error   string        `json:"error,omitempty"`
+	Latency time.Duration `json:"latency"`
+}
+
+// HealthReport is the result of HealthCheck.
+type HealthReport struct {
+	Agent      string            `json:"agent"`
+	Healthy    bool              `json:"healthy"`
+	Components []ComponentHealth `json:"components"`
+	CheckedAt  time.Time         `json:"checkedAt"`
+}
+
+// HealthOption defines options for HealthCheck.
+type HealthOption func(*healthOptions)
+
+type healthOptions struct {
+	timeout    time.Duration
+	components []healthComponent
+}
+
+// WithHealthTimeout sets the timeout of each component check. Defaults to 5 seconds.
+func WithHealthTimeout(timeout time.Duration) HealthOption {
+	return func(o *healthOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithHealthComponent adds a component that is not part of the agent, such as
+// a session or memory store, to the check.
+func WithHealthComponent(name, kind string, component Checkable) HealthOption {
+	return func(o *healthOptions) {
+		o.components = append(o.components, healthComponent{name: name, kind: kind, check: component.Check})
+	}
+}
+
+// healthComponent is a named check found while walking an agent.
+type healthComponent struct {
+	name  string
+	kind  string
+	check func(context.Context) error
+}
+
+// healthComponents returns the checks of the agent's model, tools and tools resolver.
+// Models and tools that are not Checkable are skipped; a resolver that is not
+// Checkable is checked by resolving its tools.
+func (a *agent) healthComponents() []healthComponent {
+	var components []healthComponent
+	add := func(name, kind string, v any) {
+		c := healthComponent{name: a.name + "/" + name, kind: kind}
+		if checkable, ok := v.(Checkable); ok {
+			c.check = checkable.Check
+		}
+		components = append(components, c)
+	}
+	var model any = a.model
+	if wrapped, ok := a.model.(*wrappedModel); ok {
+		model = wrapped.model
+	}
+	add(a.model.Name(), "model", model)
+	for _, tool := range a.tools {
+		add(tool.Name(), "tool", tool)
+	}
+	if a.toolsResolver != nil {
+		c := healthComponent{name: a.name + "/resolver", kind: "resolver"}
+		if checkable, ok := a.toolsResolver.(Checkable); ok {
+			c.check = checkable.Check
+		} else {
+			c.check = func(ctx context.Context) error {
+				_, err := a.toolsResolver.Resolve(ctx)
+				return err
+			}
+		}
+		components = append(components, c)
+	}
+	return components
+}
+
+// collectHealthComponents walks the agent and its sub-agents.
+func collectHealthComponents(root Agent) []healthComponent {
+	var components []healthComponent
+	if a, ok := root.(*agent); ok {
+		components = append(components, a.healthComponents()...)
+	} else if checkable, ok := root.(Checkable); ok {
+		components = append(components, healthComponent{name: root.Name(), kind: "agent", check: checkable.Check})
+	}
+	if composite, ok := root.(Composite); ok {
+		for _, sub := range composite.SubAgents() {
+			components = append(components, collectHealthComponents(sub)...)
+		}
+	}
+	return components
+}
+
+// HealthCheck checks the dependencies of the agent and its sub-agents: models,
+// tools, tool resolvers and the components added with WithHealthComponent.
+// The checks run concurrently, each with its own timeout. It returns the report
+// and, if any check failed, an error wrapping ErrUnhealthy.
+func HealthCheck(ctx context.Context, agent Agent, opts ...HealthOption) (*HealthReport, error) {
+	o := &healthOptions{timeout: 5 * time.Second}
+	for _, opt := range opts {
+		opt(o)
+	}
+	components := append(collectHealthComponents(agent), o.components...)
+	report := &HealthReport{
+		Agent:      agent.Name(),
+		Healthy:    true,
+		Components: make([]ComponentHealth, len(components)),
+		CheckedAt:  time.Now(),
+	}
+	var wg sync.WaitGroup
+	for i, c := range components {
+		report.Components[i] = ComponentHealth{Name: c.name, Kind: c.kind, Status: HealthSkip}
+		if c.check == nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, o.timeout)
+			defer cancel()
+			started := time.Now()
+			err := c.check(ctx)
+			result := &report.Components[i]
+			result.Latency = time.Since(started)
+			result.Status = HealthPass
+			if err != nil {
+				result.Status, result.Error = HealthFail, err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+	var failed []string
+	for _, c := range report.Components {
+		if c.Status == HealthFail {
+			failed = append(failed, c.Name)
+		}
+	}
+	if len(failed) > 0 {
+		report.Healthy = false
+		return report, fmt.Errorf("health check %s: %w: %v", agent.Name(), ErrUnhealthy, failed)
+	}
+	return report, nil
+}
+
+// HealthHandler returns an HTTP handler, e.g. for /healthz, that runs
+// HealthCheck and writes the report as JSON, with status 503 if it failed.
+func HealthHandler(agent Agent, opts ...HealthOption) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report, err := HealthCheck(r.Context(), agent, opts...)
+		w.Header().Set("Content-Type", "application/json")
+		if err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	})
+}
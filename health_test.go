@@ -0,0 +1,106 @@
+package blades
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/blades/tools"
+)
+
+// checkableModel is a mock model whose reachability check returns err.
+type checkableModel struct {
+	mockModel
+	err error
+}
+
+func (m *checkableModel) Check(ctx context.Context) error {
+	return m.err
+}
+
+// checkableTool is a tool whose check blocks until ctx is done.
+type checkableTool struct {
+	tools.Tool
+}
+
+func (t *checkableTool) Check(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// groupAgent is a composite agent without its own dependencies.
+type groupAgent struct {
+	Agent
+	subAgents []Agent
+}
+
+func (a *groupAgent) SubAgents() []Agent {
+	return a.subAgents
+}
+
+func TestHealthCheck(t *testing.T) {
+	healthy, err := NewAgent("healthy", WithModel(WrapModel(&checkableModel{mockModel: mockModel{name: "up"}})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	slow := &checkableTool{Tool: tools.NewTool("slow", "A slow tool.", nil)}
+	unhealthy, err := NewAgent("unhealthy",
+		WithModel(&checkableModel{mockModel: mockModel{name: "down"}, err: errors.New("connection refused")}),
+		WithTools(slow, tools.NewTool("plain", "An unchecked tool.", nil)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := HealthCheck(context.Background(), healthy)
+	if err != nil || !report.Healthy {
+		t.Fatalf("want healthy, got %+v, %v", report, err)
+	}
+
+	group := &groupAgent{Agent: healthy, subAgents: []Agent{healthy, unhealthy}}
+	report, err = HealthCheck(context.Background(), group,
+		WithHealthTimeout(10*time.Millisecond),
+		WithHealthComponent("sessions", "store", NewInMemorySessionStore()),
+	)
+	if !errors.Is(err, ErrUnhealthy) || report.Healthy {
+		t.Fatalf("want ErrUnhealthy, got %v", err)
+	}
+	want := map[string]HealthStatus{
+		"healthy/up":      HealthPass,
+		"unhealthy/down":  HealthFail,
+		"unhealthy/slow":  HealthFail,
+		"unhealthy/plain": HealthSkip,
+		"sessions":        HealthPass,
+	}
+	if len(report.Components) != len(want) {
+		t.Fatalf("want %d components, got %+v", len(want), report.Components)
+	}
+	for _, c := range report.Components {
+		if want[c.Name] != c.Status {
+			t.Fatalf("%s: want %s, got %s (%s)", c.Name, want[c.Name], c.Status, c.Error)
+		}
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	agent, err := NewAgent("down", WithModel(&checkableModel{err: errors.New("connection refused")}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	HealthHandler(agent).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("want status 503, got %d", rec.Code)
+	}
+	var report HealthReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Healthy || len(report.Components) != 1 || report.Components[0].Error != "connection refused" {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+}
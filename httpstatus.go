@@ -0,0 +1,25 @@
+package blades
+
+import (
+	"errors"
+	"net/http"
+)
+
+// HTTPStatus returns the HTTP status code that answers a request whose run
+// failed with err: 413 for input over the limits of the Runner, 503 while the
+// Runner drains or is overloaded, 404 for a missing session, 422 for an
+// idempotency key reused with another input and 500 otherwise.
+func HTTPStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrInputTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrRunnerDraining), errors.Is(err, ErrOverloaded):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, ErrSessionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrIdempotencyKeyReused):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
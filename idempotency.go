@@ -0,0 +1,192 @@
+package blades
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-kratos/blades/stream"
+)
+
+// DefaultIdempotencyWindow is how long the Runner replays the answer of an
+// idempotency key by default.
+const DefaultIdempotencyWindow = 24 * time.Hour
+
+// IdempotencyRecord is the answer of a completed run with an idempotency key.
+// Keys are scoped to the session of the run.
+type IdempotencyRecord struct {
+	SessionID string `json:"sessionId"`
+	Key       string `json:"key"`
+	// InputHash is the hash of the parts of the input message, which a run
+	// reusing the key must repeat.
+	InputHash    string    `json:"inputHash"`
+	InvocationID string    `json:"invocationId"`
+	Result       *Message  `json:"result"`
+	CompletedAt  time.Time `json:"completedAt"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
+
+// IdempotencyStore records the answers of runs by idempotency key.
+type IdempotencyStore interface {
+	// Get returns the record of the key in the session, or nil if there is none.
+	Get(ctx context.Context, sessionID, key string) (*IdempotencyRecord, error)
+	// Put records the answer of the key in the session of the record.
+	// Records may be dropped once expired.
+	Put(ctx context.Context, record *IdempotencyRecord) error
+}
+
+// InMemoryIdempotencyStore keeps the records in memory, dropping the expired
+// ones as new ones are recorded.
+type InMemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]*IdempotencyRecord
+}
+
+// NewInMemoryIdempotencyStore creates an empty InMemoryIdempotencyStore.
+func NewInMemoryIdempotencyStore() *InMemoryIdempotencyStore {
+	return &InMemoryIdempotencyStore{records: make(map[string]*IdempotencyRecord)}
+}
+
+// Get returns the record of the key in the session, or nil if there is none.
+func (s *InMemoryIdempotencyStore) Get(ctx context.Context, sessionID, key string) (*IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.records[idempotencyScope(sessionID, key)], nil
+}
+
+// Put records the answer of the key.
+func (s *InMemoryIdempotencyStore) Put(ctx context.Context, record *IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for key, r := range s.records {
+		if now.After(r.ExpiresAt) {
+			delete(s.records, key)
+		}
+	}
+	s.records[idempotencyScope(record.SessionID, record.Key)] = record
+	return nil
+}
+
+// idempotencyScope returns the key of the records of the key in the session.
+func idempotencyScope(sessionID, key string) string {
+	return sessionID + "/" + key
+}
+
+// inputHash returns the hash of the parts of the input message, which
+// differs from that of a different input, whatever its ID.
+func inputHash(message *Message) (string, error) {
+	parts := make([]json.RawMessage, 0, len(message.Parts))
+	for _, part := range message.Parts {
+		data, err := marshalPart(part)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, data)
+	}
+	data, err := json.Marshal(parts)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// WithIdempotencyKey sets the idempotency key of the run. Keys are scoped to
+// the session of the run: a run repeating the key and the input of a
+// completed run of the session within the idempotency window returns its
+// final message instead of running again, and concurrent runs with the same
+// key in a session are collapsed into one execution. Reusing a key in the
+// session with another input fails with ErrIdempotencyKeyReused. Runs that
+// failed are not recorded, so they can be retried with the same key. An
+// empty key is ignored.
+func WithIdempotencyKey(key string) RunOption {
+	return func(r *RunOptions) {
+		r.IdempotencyKey = key
+	}
+}
+
+// WithIdempotencyStore sets the store of the answers of idempotency keys.
+// Defaults to an InMemoryIdempotencyStore.
+func WithIdempotencyStore(store IdempotencyStore) RunnerOption {
+	return func(r *Runner) {
+		r.idempotencyStore = store
+	}
+}
+
+// WithIdempotencyWindow sets how long the answer of an idempotency key is
+// replayed. Defaults to DefaultIdempotencyWindow.
+func WithIdempotencyWindow(window time.Duration) RunnerOption {
+	return func(r *Runner) {
+		r.idempotencyWindow = window
+	}
+}
+
+// idempotent replays the answer recorded for the idempotency key of the
+// options, or runs the agent and records its final message. It runs under
+// the flight of the key, so the record is looked up and saved by one
+// execution at a time.
+func (r *Runner) idempotent(ctx context.Context, message *Message, streamable bool, o *RunOptions) Generator[*Message, error] {
+	sessionID := idempotencySession(o)
+	hash, err := inputHash(message)
+	if err != nil {
+		return stream.Error[*Message](fmt.Errorf("idempotency key %s: %w", o.IdempotencyKey, err))
+	}
+	record, err := r.idempotencyStore.Get(ctx, sessionID, o.IdempotencyKey)
+	if err != nil {
+		return stream.Error[*Message](fmt.Errorf("idempotency key %s: %w", o.IdempotencyKey, err))
+	}
+	if record != nil && record.Result != nil && time.Now().Before(record.ExpiresAt) {
+		if record.InputHash != hash {
+			return stream.Error[*Message](fmt.Errorf("idempotency key %s: %w", o.IdempotencyKey, ErrIdempotencyKeyReused))
+		}
+		result := record.Result.Clone()
+		result.Final = true
+		return stream.Just(result)
+	}
+	messages := r.run(ctx, message, streamable, o)
+	return func(yield func(*Message, error) bool) {
+		var output, final *Message
+		for m, err := range messages {
+			if !yield(m, err) || err != nil {
+				return
+			}
+			output = m
+			if m != nil && m.Final {
+				final = m
+			}
+		}
+		if final == nil {
+			final = output
+		}
+		if final == nil {
+			return
+		}
+		now := time.Now()
+		record := &IdempotencyRecord{
+			SessionID:    sessionID,
+			Key:          o.IdempotencyKey,
+			InputHash:    hash,
+			InvocationID: o.InvocationID,
+			Result:       final.Clone(),
+			CompletedAt:  now,
+			ExpiresAt:    now.Add(r.idempotencyWindow),
+		}
+		if err := r.idempotencyStore.Put(context.WithoutCancel(ctx), record); err != nil {
+			yield(nil, fmt.Errorf("idempotency key %s: %w", o.IdempotencyKey, err))
+		}
+	}
+}
+
+// idempotencySession returns the ID of the session the idempotency key of
+// the run is scoped to.
+func idempotencySession(o *RunOptions) string {
+	if o.Session == nil {
+		return ""
+	}
+	return o.Session.ID()
+}
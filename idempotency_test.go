@@ -0,0 +1,180 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingModel answers with the number of the call.
+func countingModel() *mockModel {
+	model := &mockModel{}
+	model.generate = func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+		return textResponse(fmt.Sprintf("answer %d", model.calls.Load())), nil
+	}
+	return model
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	model := countingModel()
+	agent, err := NewAgent("worker", WithModel(model))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := NewRunner(agent)
+	session := NewSession()
+	ctx := context.Background()
+
+	first, err := runner.Run(ctx, UserMessage("hello"), WithSession(session), WithIdempotencyKey("k1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The retry of a client whose connection dropped.
+	second, err := runner.Run(ctx, UserMessage("hello"), WithSession(session), WithIdempotencyKey("k1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Text() != "answer 1" || second.Text() != "answer 1" || !second.Final {
+		t.Fatalf("want the final answer replayed, got %q then %q", first.Text(), second.Text())
+	}
+	var replayed []*Message
+	for m, err := range runner.RunStream(ctx, UserMessage("hello"), WithSession(session), WithIdempotencyKey("k1")) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		replayed = append(replayed, m)
+	}
+	if len(replayed) != 1 || replayed[0].Text() != "answer 1" {
+		t.Fatalf("want the final answer streamed once, got %v", replayed)
+	}
+	if n := model.calls.Load(); n != 1 {
+		t.Fatalf("want the agent run once, got %d model calls", n)
+	}
+	if n := len(session.Messages(MessageFilter{Role: RoleUser})); n != 1 {
+		t.Fatalf("want the replayed input not recorded, got %d user messages", n)
+	}
+
+	other, err := runner.Run(ctx, UserMessage("hello"), WithSession(session), WithIdempotencyKey("k2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Text() != "answer 2" {
+		t.Fatalf("want another key to run again, got %q", other.Text())
+	}
+	// The key of another session is not replayed.
+	foreign, err := runner.Run(ctx, UserMessage("hello"), WithSession(NewSession()), WithIdempotencyKey("k1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if foreign.Text() != "answer 3" {
+		t.Fatalf("want the key scoped to its session, got %q", foreign.Text())
+	}
+	if _, err := runner.Run(ctx, UserMessage("goodbye"), WithSession(session), WithIdempotencyKey("k1")); !errors.Is(err, ErrIdempotencyKeyReused) {
+		t.Fatalf("want %v for another input, got %v", ErrIdempotencyKeyReused, err)
+	}
+}
+
+func TestIdempotencyConcurrent(t *testing.T) {
+	release := make(chan struct{})
+	model := &mockModel{generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+		<-release
+		return textResponse("done"), nil
+	}}
+	agent, err := NewAgent("worker", WithModel(model))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := NewRunner(agent)
+	session := NewSession()
+
+	outputs := make([]string, 4)
+	var wg sync.WaitGroup
+	for i := range outputs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			output, err := runner.Run(context.Background(), UserMessage("hello"), WithSession(session), WithIdempotencyKey("k"))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			outputs[i] = output.Text()
+		}()
+	}
+	for model.calls.Load() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := model.calls.Load(); n != 1 {
+		t.Fatalf("want the duplicates collapsed into 1 model call, got %d", n)
+	}
+	for _, output := range outputs {
+		if output != "done" {
+			t.Fatalf("want every duplicate answered, got %v", outputs)
+		}
+	}
+	if n := len(session.Messages(MessageFilter{Role: RoleUser})); n != 1 {
+		t.Fatalf("want the input recorded once, got %d user messages", n)
+	}
+}
+
+func TestIdempotencyExpiry(t *testing.T) {
+	model := countingModel()
+	agent, err := NewAgent("worker", WithModel(model))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewInMemoryIdempotencyStore()
+	runner := NewRunner(agent, WithIdempotencyStore(store), WithIdempotencyWindow(20*time.Millisecond))
+	session := NewSession()
+	ctx := context.Background()
+
+	if _, err := runner.Run(ctx, UserMessage("hello"), WithSession(session), WithIdempotencyKey("k")); err != nil {
+		t.Fatal(err)
+	}
+	record, err := store.Get(ctx, session.ID(), "k")
+	if err != nil || record == nil || record.Result.Text() != "answer 1" {
+		t.Fatalf("want the answer recorded, got %v, %v", record, err)
+	}
+	time.Sleep(40 * time.Millisecond)
+	output, err := runner.Run(ctx, UserMessage("hello"), WithSession(session), WithIdempotencyKey("k"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output.Text() != "answer 2" {
+		t.Fatalf("want the expired key run again, got %q", output.Text())
+	}
+}
+
+func TestIdempotencyFailure(t *testing.T) {
+	errFlaky := errors.New("flaky")
+	model := &mockModel{}
+	model.generate = func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+		if model.calls.Load() == 1 {
+			return nil, errFlaky
+		}
+		return textResponse("done"), nil
+	}
+	agent, err := NewAgent("worker", WithModel(model))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := NewRunner(agent)
+	session := NewSession()
+	ctx := context.Background()
+	if _, err := runner.Run(ctx, UserMessage("hello"), WithSession(session), WithIdempotencyKey("k")); !errors.Is(err, errFlaky) {
+		t.Fatalf("want %v, got %v", errFlaky, err)
+	}
+	output, err := runner.Run(ctx, UserMessage("hello"), WithSession(session), WithIdempotencyKey("k"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output.Text() != "done" {
+		t.Fatalf("want the failed run retried, got %q", output.Text())
+	}
+}
@@ -0,0 +1,289 @@
+package blades
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// InputLimitPolicy is what a Runner does with a user message over its input limits.
+type InputLimitPolicy int
+
+const (
+	// InputLimitReject fails the run with an *InputLimitError. It is the default.
+	InputLimitReject InputLimitPolicy = iota
+	// InputLimitTruncate cuts the message down to the limits and appends a
+	// notice the model can see, telling what was cut. The notice counts
+	// against the limits.
+	InputLimitTruncate
+)
+
+// InputLimitError is returned when a user message exceeds the input limits of
+// the Runner. It unwraps to ErrInputTooLarge.
+type InputLimitError struct {
+	// Limit is LimitInputChars, LimitInputParts or LimitInputPartBytes.
+	Limit Limit
+	// Part is the index of the part over the limit, or -1 for the whole message.
+	Part int
+	// MIMEType is the type of a file or data part over the limit.
+	MIMEType MIMEType
+	// Max and Size are the limit and the measured size that exceeded it.
+	Max  int
+	Size int
+}
+
+func (e *InputLimitError) Error() string {
+	if e.Part < 0 {
+		return fmt.Sprintf("input %s: %d > %d", e.Limit, e.Size, e.Max)
+	}
+	if e.MIMEType != "" {
+		return fmt.Sprintf("input part %d (%s): %s: %d > %d", e.Part, e.MIMEType, e.Limit, e.Size, e.Max)
+	}
+	return fmt.Sprintf("input part %d: %s: %d > %d", e.Part, e.Limit, e.Size, e.Max)
+}
+
+// Unwrap returns ErrInputTooLarge.
+func (e *InputLimitError) Unwrap() error {
+	return ErrInputTooLarge
+}
+
+// inputLimits are the caps on the user message of a run. Zero fields are unlimited.
+type inputLimits struct {
+	maxChars     int
+	maxParts     int
+	maxPartBytes int
+	// mimeBytes caps the file and data parts by MIME type, e.g. "image/png" or
+	// "image/*", instead of maxPartBytes.
+	mimeBytes map[MIMEType]int
+	policy    InputLimitPolicy
+}
+
+// WithInputLimits caps the user message of every run before any provider call:
+// maxChars the characters of its text, maxParts its number of parts and
+// maxPartBytes the size of each part, counting the URI of file parts, which
+// may be a data URI. Zero values are unlimited. Messages over the limits are
+// rejected unless WithInputLimitPolicy says otherwise.
+func WithInputLimits(maxChars, maxParts, maxPartBytes int) RunnerOption {
+	return func(r *Runner) {
+		r.inputLimits.maxChars = maxChars
+		r.inputLimits.maxParts = maxParts
+		r.inputLimits.maxPartBytes = maxPartBytes
+	}
+}
+
+// WithMIMEInputLimit caps the size of the file and data parts of the MIME
+// type, e.g. "image/png", or of a whole family, e.g. "image/*", in place of
+// the part size of WithInputLimits. An exact type wins over its family.
+func WithMIMEInputLimit(mimeType MIMEType, maxBytes int) RunnerOption {
+	return func(r *Runner) {
+		if r.inputLimits.mimeBytes == nil {
+			r.inputLimits.mimeBytes = make(map[MIMEType]int)
+		}
+		r.inputLimits.mimeBytes[mimeType] = maxBytes
+	}
+}
+
+// WithInputLimitPolicy sets what the Runner does with user messages over its input limits.
+func WithInputLimitPolicy(policy InputLimitPolicy) RunnerOption {
+	return func(r *Runner) {
+		r.inputLimits.policy = policy
+	}
+}
+
+// enabled reports whether any input limit is set.
+func (l *inputLimits) enabled() bool {
+	return l.maxChars > 0 || l.maxParts > 0 || l.maxPartBytes > 0 || len(l.mimeBytes) > 0
+}
+
+// partLimit returns the size cap of the part and its size, or a zero cap if
+// the part is unlimited.
+func (l *inputLimits) partLimit(part Part) (limit, size int, mimeType MIMEType) {
+	switch v := part.(type) {
+	case TextPart:
+		return l.maxPartBytes, len(v.Text), ""
+	case FilePart:
+		return l.mimeLimit(v.MIMEType), len(v.URI), v.MIMEType
+	case DataPart:
+		return l.mimeLimit(v.MIMEType), len(v.Bytes), v.MIMEType
+	}
+	return 0, 0, ""
+}
+
+// mimeLimit returns the size cap of a file or data part of the MIME type.
+func (l *inputLimits) mimeLimit(mimeType MIMEType) int {
+	if limit, ok := l.mimeBytes[mimeType]; ok {
+		return limit
+	}
+	family, _, _ := strings.Cut(string(mimeType), "/")
+	if limit, ok := l.mimeBytes[MIMEType(family+"/*")]; ok {
+		return limit
+	}
+	return l.maxPartBytes
+}
+
+// check returns the message if it is within the limits, a truncated copy of it
+// under InputLimitTruncate, or the first limit it exceeds.
+func (l *inputLimits) check(message *Message) (*Message, error) {
+	if message == nil || !l.enabled() {
+		return message, nil
+	}
+	_, notices, err := l.fit(message.Parts, l.maxParts, l.maxChars, l.policy != InputLimitTruncate)
+	if err != nil {
+		return nil, err
+	}
+	if len(notices) == 0 {
+		return message, nil
+	}
+	truncated := message.Clone()
+	truncated.Parts = l.truncate(message.Parts, notices)
+	return truncated, nil
+}
+
+// shortInputNotice replaces the notice of a truncated message when the limits
+// leave no room for the full one.
+const shortInputNotice = "[Input truncated.]"
+
+// inputNotice returns the notice telling the model what was cut from its input.
+func inputNotice(notices []string) string {
+	return "\n\n[Input truncated to fit the limits: " + strings.Join(notices, "; ") + ".]"
+}
+
+// truncate cuts the parts down to the limits and appends the notice of what
+// was cut. The notice is part of the message, so room is reserved for it
+// under the limits; it is shortened, or left out, when there is none.
+func (l *inputLimits) truncate(parts []Part, notices []string) []Part {
+	notice := inputNotice(notices)
+	// Cutting more to make room changes the notice, e.g. the characters
+	// kept, so the room is adjusted until the notice fits in it.
+	for range 3 {
+		kept, cut, ok := l.fitNotice(parts, notice)
+		if !ok {
+			break
+		}
+		next := inputNotice(cut)
+		if len(next) <= len(notice) && utf8.RuneCountInString(next) <= utf8.RuneCountInString(notice) {
+			return append(kept, TextPart{Text: next})
+		}
+		notice = next
+	}
+	if kept, _, ok := l.fitNotice(parts, shortInputNotice); ok {
+		return append(kept, TextPart{Text: shortInputNotice})
+	}
+	kept, _, _ := l.fit(parts, l.maxParts, l.maxChars, false)
+	return kept
+}
+
+// fitNotice cuts the parts down to the limits less the room of the notice,
+// and reports whether the limits leave room for it next to some content.
+func (l *inputLimits) fitNotice(parts []Part, notice string) ([]Part, []string, bool) {
+	maxParts, maxChars := l.maxParts, l.maxChars
+	if maxParts > 0 {
+		if maxParts--; maxParts == 0 {
+			return nil, nil, false
+		}
+	}
+	if maxChars > 0 {
+		if maxChars -= utf8.RuneCountInString(notice); maxChars < 0 {
+			return nil, nil, false
+		}
+	}
+	if l.maxPartBytes > 0 && len(notice) > l.maxPartBytes {
+		return nil, nil, false
+	}
+	kept, notices, _ := l.fit(parts, maxParts, maxChars, false)
+	return kept, notices, true
+}
+
+// fit cuts the parts down to maxParts parts and maxChars characters, which
+// apply when the limits set them, and to the part sizes. It returns the parts
+// kept and what was cut, or with reject the first limit exceeded.
+func (l *inputLimits) fit(parts []Part, maxParts, maxChars int, reject bool) ([]Part, []string, error) {
+	var notices []string
+	if l.maxParts > 0 && len(parts) > maxParts {
+		if reject {
+			return nil, nil, &InputLimitError{Limit: LimitInputParts, Part: -1, Max: maxParts, Size: len(parts)}
+		}
+		notices = append(notices, fmt.Sprintf("removed %d of %d parts", len(parts)-maxParts, len(parts)))
+		parts = parts[:maxParts]
+	}
+	kept := make([]Part, 0, len(parts))
+	for i, part := range parts {
+		limit, size, mimeType := l.partLimit(part)
+		if limit <= 0 || size <= limit {
+			kept = append(kept, part)
+			continue
+		}
+		if reject {
+			return nil, nil, &InputLimitError{Limit: LimitInputPartBytes, Part: i, MIMEType: mimeType, Max: limit, Size: size}
+		}
+		if text, ok := part.(TextPart); ok {
+			notices = append(notices, fmt.Sprintf("cut part %d from %d to %d bytes", i, size, limit))
+			kept = append(kept, TextPart{Text: truncateBytes(text.Text, limit)})
+			continue
+		}
+		notices = append(notices, fmt.Sprintf("removed %s (%s, %d bytes, over %d)", partName(part, i), mimeType, size, limit))
+	}
+	if l.maxChars > 0 {
+		chars := 0
+		for _, part := range kept {
+			if text, ok := part.(TextPart); ok {
+				chars += utf8.RuneCountInString(text.Text)
+			}
+		}
+		if chars > maxChars {
+			if reject {
+				return nil, nil, &InputLimitError{Limit: LimitInputChars, Part: -1, Max: maxChars, Size: chars}
+			}
+			notices = append(notices, fmt.Sprintf("kept %d of %d characters", maxChars, chars))
+			kept = truncateChars(kept, maxChars)
+		}
+	}
+	return kept, notices, nil
+}
+
+// truncateChars keeps the text parts up to max characters in total, cutting
+// the part that crosses it and dropping the text parts after it.
+func truncateChars(parts []Part, max int) []Part {
+	kept := make([]Part, 0, len(parts))
+	for _, part := range parts {
+		text, ok := part.(TextPart)
+		if !ok {
+			kept = append(kept, part)
+			continue
+		}
+		if max <= 0 {
+			continue
+		}
+		if n := utf8.RuneCountInString(text.Text); n > max {
+			text.Text = string([]rune(text.Text)[:max])
+			max = 0
+		} else {
+			max -= n
+		}
+		kept = append(kept, text)
+	}
+	return kept
+}
+
+// truncateBytes cuts s to at most n bytes without splitting a character.
+func truncateBytes(s string, n int) string {
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// partName names a file or data part in a truncation notice.
+func partName(part Part, i int) string {
+	var name string
+	switch v := part.(type) {
+	case FilePart:
+		name = v.Name
+	case DataPart:
+		name = v.Name
+	}
+	if name == "" {
+		return fmt.Sprintf("part %d", i)
+	}
+	return name
+}
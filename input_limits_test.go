@@ -0,0 +1,120 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestInputLimits(t *testing.T) {
+	image := DataPart{Name: "photo.png", Bytes: make([]byte, 2048), MIMEType: MIMEImagePNG}
+	newInput := func(parts ...Part) *Message {
+		message := UserMessage[string]()
+		message.Parts = parts
+		return message
+	}
+	tests := []struct {
+		name   string
+		opts   []RunnerOption
+		input  *Message
+		want   *InputLimitError
+		wantIn []Part
+	}{
+		{
+			name:   "within the limits",
+			opts:   []RunnerOption{WithInputLimits(10, 3, 4096)},
+			input:  newInput(TextPart{Text: "hello"}, TextPart{Text: "world"}, image),
+			wantIn: []Part{TextPart{Text: "hello"}, TextPart{Text: "world"}, image},
+		},
+		{
+			name:  "characters across parts",
+			opts:  []RunnerOption{WithInputLimits(10, 0, 0)},
+			input: newInput(TextPart{Text: "hello"}, image, TextPart{Text: "world!"}),
+			want:  &InputLimitError{Limit: LimitInputChars, Part: -1, Max: 10, Size: 11},
+		},
+		{
+			name:  "too many parts",
+			opts:  []RunnerOption{WithInputLimits(0, 2, 0)},
+			input: newInput(TextPart{Text: "a"}, TextPart{Text: "b"}, TextPart{Text: "c"}),
+			want:  &InputLimitError{Limit: LimitInputParts, Part: -1, Max: 2, Size: 3},
+		},
+		{
+			name:  "image over its MIME limit",
+			opts:  []RunnerOption{WithInputLimits(0, 0, 4096), WithMIMEInputLimit("image/*", 1024)},
+			input: newInput(TextPart{Text: "describe"}, image),
+			want:  &InputLimitError{Limit: LimitInputPartBytes, Part: 1, MIMEType: MIMEImagePNG, Max: 1024, Size: 2048},
+		},
+		{
+			name:  "data URI over the part limit",
+			opts:  []RunnerOption{WithInputLimits(0, 0, 16)},
+			input: newInput(FilePart{URI: "data:image/png;base64," + strings.Repeat("A", 64), MIMEType: MIMEImagePNG}),
+			want:  &InputLimitError{Limit: LimitInputPartBytes, Part: 0, MIMEType: MIMEImagePNG, Max: 16, Size: 86},
+		},
+		{
+			name:  "truncated characters across parts",
+			opts:  []RunnerOption{WithInputLimits(80, 0, 0), WithInputLimitPolicy(InputLimitTruncate)},
+			input: newInput(TextPart{Text: "héllo"}, TextPart{Text: strings.Repeat("wörld ", 20)}, TextPart{Text: "again"}),
+			// The notice counts against the limit: 15 + 65 characters.
+			wantIn: []Part{
+				TextPart{Text: "héllo"}, TextPart{Text: "wörld wörl"},
+				TextPart{Text: "\n\n[Input truncated to fit the limits: kept 15 of 130 characters.]"},
+			},
+		},
+		{
+			name:  "truncated parts and image",
+			opts:  []RunnerOption{WithInputLimits(0, 3, 0), WithMIMEInputLimit(MIMEImagePNG, 1024), WithInputLimitPolicy(InputLimitTruncate)},
+			input: newInput(TextPart{Text: "describe"}, image, TextPart{Text: "and more"}, TextPart{Text: "again"}),
+			wantIn: []Part{
+				TextPart{Text: "describe"},
+				TextPart{Text: "\n\n[Input truncated to fit the limits: removed 2 of 4 parts; removed photo.png (image/png, 2048 bytes, over 1024).]"},
+			},
+		},
+		{
+			name:   "short notice",
+			opts:   []RunnerOption{WithInputLimits(20, 0, 0), WithInputLimitPolicy(InputLimitTruncate)},
+			input:  newInput(TextPart{Text: "héllo"}, TextPart{Text: "wörld wörld wörld"}),
+			wantIn: []Part{TextPart{Text: "hé"}, TextPart{Text: "[Input truncated.]"}},
+		},
+		{
+			name:   "no room for a notice",
+			opts:   []RunnerOption{WithInputLimits(8, 0, 0), WithInputLimitPolicy(InputLimitTruncate)},
+			input:  newInput(TextPart{Text: "héllo"}, TextPart{Text: "wörld"}, TextPart{Text: "again"}),
+			wantIn: []Part{TextPart{Text: "héllo"}, TextPart{Text: "wör"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *Message
+			model := &mockModel{generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+				got = req.Messages[len(req.Messages)-1]
+				return textResponse("ok"), nil
+			}}
+			agent, err := NewAgent("limited", WithModel(model))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = NewRunner(agent, tt.opts...).Run(context.Background(), tt.input)
+			if tt.want != nil {
+				var limitErr *InputLimitError
+				if !errors.As(err, &limitErr) || *limitErr != *tt.want || !errors.Is(err, ErrInputTooLarge) {
+					t.Fatalf("want %v, got %v", tt.want, err)
+				}
+				if model.calls.Load() != 0 {
+					t.Fatal("want the input rejected before the provider call")
+				}
+				if status := HTTPStatus(err); status != http.StatusRequestEntityTooLarge {
+					t.Fatalf("want status 413, got %d", status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != newInput(tt.wantIn...).String() {
+				t.Fatalf("want parts %s, got %s", newInput(tt.wantIn...), got)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package blades
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+)
+
+const (
+	// DefaultInstructionVariant is the entry of WithInstructionsByModel used
+	// for the models no other entry matches.
+	DefaultInstructionVariant = "default"
+	// InstructionVariantKey is the metadata key of the entry of
+	// WithInstructionsByModel the agent that wrote a message ran with.
+	InstructionVariantKey = "instruction_variant"
+)
+
+// WithInstructionsByModel sets instructions by model, selected for each model
+// request by the name of the model it is sent to, so that a fallback to
+// another provider set by a middleware gets the prompt written for it.
+//
+// The keys are path.Match patterns matched against the lower-cased model
+// name, e.g. "claude-*" or "gpt-4o*"; the longest matching pattern wins and
+// the DefaultInstructionVariant entry, which is required, is used when none
+// matches. The selected key is recorded on the answers under
+// InstructionVariantKey, next to the instruction version. It replaces
+// WithInstruction and WithInstructionsSource, which it cannot be combined with.
+func WithInstructionsByModel(instructions map[string]string) AgentOption {
+	return func(a *agent) {
+		a.modelInstructions = maps.Clone(instructions)
+	}
+}
+
+// instructionVariant is a compiled entry of WithInstructionsByModel.
+type instructionVariant struct {
+	key      string
+	pattern  string
+	snapshot *instructionSnapshot
+}
+
+// ctxInstructionVariantKey is the context key for the instruction variant a
+// model request of the agent runs with.
+type ctxInstructionVariantKey struct {
+	agent *agent
+}
+
+// compileInstructionVariants compiles the instructions by model, the most
+// specific pattern first and the default last.
+func (a *agent) compileInstructionVariants() error {
+	a.instructionVariants = nil
+	if len(a.modelInstructions) == 0 {
+		return nil
+	}
+	if a.instruction != "" || a.instructionSource != nil {
+		return fmt.Errorf("agent %s: instructions by model cannot be combined with an instruction or an instruction source", a.name)
+	}
+	if _, ok := a.modelInstructions[DefaultInstructionVariant]; !ok {
+		return fmt.Errorf("agent %s: %w", a.name, ErrNoDefaultInstruction)
+	}
+	variants := make([]instructionVariant, 0, len(a.modelInstructions))
+	for key, instruction := range a.modelInstructions {
+		pattern := strings.ToLower(key)
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("agent %s: instruction pattern %q: %w", a.name, key, err)
+		}
+		snapshot, err := a.compileInstruction(instruction, a.instructionVersion)
+		if err != nil {
+			return err
+		}
+		variants = append(variants, instructionVariant{key: key, pattern: pattern, snapshot: snapshot})
+	}
+	slices.SortFunc(variants, func(x, y instructionVariant) int {
+		switch {
+		case x.key == DefaultInstructionVariant:
+			return 1
+		case y.key == DefaultInstructionVariant:
+			return -1
+		case len(x.pattern) != len(y.pattern):
+			return len(y.pattern) - len(x.pattern)
+		default:
+			return strings.Compare(x.key, y.key)
+		}
+	})
+	a.instructionVariants = variants
+	return nil
+}
+
+// instructionVariant returns the instruction variant for the model.
+func (a *agent) instructionVariant(model string) instructionVariant {
+	model = strings.ToLower(model)
+	last := len(a.instructionVariants) - 1
+	for _, variant := range a.instructionVariants[:last] {
+		if ok, _ := path.Match(variant.pattern, model); ok {
+			return variant
+		}
+	}
+	return a.instructionVariants[last]
+}
+
+// stampInstructionVariant records the instruction variant of the context on the message.
+func (a *agent) stampInstructionVariant(ctx context.Context, message *Message) {
+	key, ok := ctx.Value(ctxInstructionVariantKey{agent: a}).(string)
+	if !ok {
+		return
+	}
+	if message.Metadata == nil {
+		message.Metadata = make(map[string]any)
+	}
+	message.Metadata[InstructionVariantKey] = key
+}
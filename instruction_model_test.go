@@ -0,0 +1,139 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestInstructionsByModel(t *testing.T) {
+	instructions := map[string]string{
+		DefaultInstructionVariant: "Answer briefly.",
+		"claude-*":                "<rules>Answer {{.tone}}.</rules>",
+		"claude-3-haiku*":         "Answer in one line.",
+		"gpt-*":                   "# Rules\nAnswer {{.tone}}.",
+	}
+	tests := []struct {
+		model       string
+		want        string
+		wantVariant string
+	}{
+		{model: "claude-sonnet-4", want: "<rules>Answer politely.</rules>", wantVariant: "claude-*"},
+		{model: "Claude-3-Haiku-20240307", want: "Answer in one line.", wantVariant: "claude-3-haiku*"},
+		{model: "gpt-4o", want: "# Rules\nAnswer politely.", wantVariant: "gpt-*"},
+		{model: "llama3", want: "Answer briefly.", wantVariant: DefaultInstructionVariant},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			agent, err := NewAgent("assistant",
+				WithModel(&mockModel{name: tt.model, generate: echoInstruction}),
+				WithInstructionsByModel(instructions),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			session := NewSession(map[string]any{"tone": "politely"})
+			answer, err := NewRunner(agent).Run(context.Background(), UserMessage("hi"), WithSession(session))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if answer.Text() != tt.want || answer.Metadata[InstructionVariantKey] != tt.wantVariant {
+				t.Fatalf("want %q of variant %q, got %q of %v", tt.want, tt.wantVariant, answer.Text(), answer.Metadata[InstructionVariantKey])
+			}
+			if answer.Metadata[InstructionVersionKey] == nil {
+				t.Fatalf("want the version of the variant recorded, got %v", answer.Metadata)
+			}
+		})
+	}
+	agent, err := NewAgent("assistant", WithModel(&mockModel{}), WithInstructionsByModel(instructions))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := agent.(interface{ RequiredStateKeys() []string }).RequiredStateKeys(); !slices.Equal(keys, []string{"tone"}) {
+		t.Fatalf("want the state keys of every variant, got %v", keys)
+	}
+}
+
+func TestInstructionsByModelValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []AgentOption
+		wantErr error
+	}{
+		{name: "no default", opts: []AgentOption{WithInstructionsByModel(map[string]string{"gpt-*": "Answer."})}, wantErr: ErrNoDefaultInstruction},
+		{name: "bad pattern", opts: []AgentOption{WithInstructionsByModel(map[string]string{DefaultInstructionVariant: "Answer.", "gpt-[": "Answer."})}},
+		{name: "with an instruction", opts: []AgentOption{WithInstruction("Answer."), WithInstructionsByModel(map[string]string{DefaultInstructionVariant: "Answer."})}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewAgent("assistant", append([]AgentOption{WithModel(&mockModel{})}, tt.opts...)...)
+			if err == nil || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+				t.Fatalf("want the agent rejected with %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestInstructionsByModelFallback(t *testing.T) {
+	var prompts []string
+	primary := &mockModel{name: "gpt-4o", generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+		prompts = append(prompts, req.Instruction.Text())
+		return nil, errors.New("overloaded")
+	}}
+	secondary := &mockModel{name: "claude-sonnet-4", generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+		prompts = append(prompts, req.Instruction.Text())
+		return echoInstruction(ctx, req)
+	}}
+	// fallback runs the invocation again on the secondary model when the primary fails.
+	fallback := func(next Handler) Handler {
+		return HandleFunc(func(ctx context.Context, invocation *Invocation) Generator[*Message, error] {
+			return func(yield func(*Message, error) bool) {
+				for m, err := range next.Handle(ctx, invocation) {
+					if err != nil {
+						break
+					}
+					if m.Status == StatusFailed {
+						continue
+					}
+					if !yield(m, nil) {
+						return
+					}
+				}
+				invocation.ModelProvider = secondary
+				for m, err := range next.Handle(ctx, invocation) {
+					if !yield(m, err) {
+						return
+					}
+				}
+			}
+		})
+	}
+	assistant, err := NewAgent("assistant",
+		WithModel(primary),
+		WithInstructionsByModel(map[string]string{
+			DefaultInstructionVariant: "Answer briefly.",
+			"claude-*":                "<rules>Answer briefly.</rules>",
+			"gpt-*":                   "# Rules\nAnswer briefly.",
+		}),
+		WithMiddleware(fallback),
+		WithLanguage("fr"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	answer, err := NewRunner(assistant).Run(context.Background(), UserMessage("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prompts) != 2 || !strings.HasPrefix(prompts[0], "# Rules") || !strings.HasPrefix(prompts[1], "<rules>") || prompts[1] == "<rules>Answer briefly.</rules>" {
+		t.Fatalf("want the primary prompt, then the secondary one with the language directive, got %q", prompts)
+	}
+	if answer.Metadata[InstructionVariantKey] != "claude-*" {
+		t.Fatalf("want the fallback variant recorded, got %v", answer.Metadata)
+	}
+	if answer.Metadata[InstructionVersionKey] != assistant.(*agent).instructionVariant("claude-sonnet-4").snapshot.version {
+		t.Fatalf("want the version of the fallback variant recorded, got %v", answer.Metadata)
+	}
+}
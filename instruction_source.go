@@ -0,0 +1,187 @@
+package blades
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// InstructionSource provides the instruction of an agent, which is rendered as
+// a template like a static instruction, and its version. A source may also
+// implement
+//
+//	Watch() <-chan struct{}
+//
+// to signal changes, in which case the agent only gets the instruction again
+// after a signal; otherwise it gets it for every invocation.
+type InstructionSource interface {
+	Get(ctx context.Context) (instruction string, version string, err error)
+}
+
+// InstructionSourceFunc is an adapter to allow the use of ordinary functions
+// as InstructionSources.
+type InstructionSourceFunc func(ctx context.Context) (string, string, error)
+
+// Get calls f.
+func (f InstructionSourceFunc) Get(ctx context.Context) (string, string, error) {
+	return f(ctx)
+}
+
+// WithInstructionsSource sets the source of the instruction of the Agent, in
+// place of a static instruction. The instruction is parsed again whenever its
+// version changes, or its content if the version is empty, and swapped in
+// atomically: invocations that already started finish with the instruction
+// and version they started with. The agent fails to build if the source fails
+// at first, and an invocation fails if the source fails or its new instruction
+// does not parse.
+func WithInstructionsSource(source InstructionSource) AgentOption {
+	return func(a *agent) {
+		a.instructionSource = source
+		a.instructionWatch = nil
+		if w, ok := source.(interface{ Watch() <-chan struct{} }); ok {
+			a.instructionWatch = w.Watch()
+		}
+	}
+}
+
+// fileInstructionSource reads the instruction from a file when it changes.
+type fileInstructionSource struct {
+	path    string
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	text    string
+	version string
+}
+
+// NewFileInstructionSource returns an InstructionSource that reads the
+// instruction from the file at path whenever its modification time or size
+// changes. The version is a hash of the content.
+func NewFileInstructionSource(path string) InstructionSource {
+	return &fileInstructionSource{path: path}
+}
+
+// Get returns the content of the file.
+func (s *fileInstructionSource) Get(ctx context.Context) (string, string, error) {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return "", "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.version != "" && info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return s.text, s.version, nil
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256(data)
+	s.modTime, s.size = info.ModTime(), info.Size()
+	s.text, s.version = string(data), "sha256:"+hex.EncodeToString(sum[:])[:12]
+	return s.text, s.version, nil
+}
+
+// instructionSnapshot is a parsed instruction and its version.
+type instructionSnapshot struct {
+	template  *template.Template
+	version   string
+	stateKeys []string
+	// readKeys are all the top-level state keys the instruction reads,
+	// including the optional ones.
+	readKeys []string
+}
+
+// ctxInstructionKey is the context key for the instruction an invocation of the agent runs with.
+type ctxInstructionKey struct {
+	agent *agent
+}
+
+// compileInstruction parses an instruction; an empty version defaults to its hash.
+func (a *agent) compileInstruction(instruction, version string) (*instructionSnapshot, error) {
+	if version == "" {
+		version = a.instructionHash(instruction)
+	}
+	if instruction == "" {
+		return &instructionSnapshot{version: version}, nil
+	}
+	t, err := a.parseInstruction(instruction)
+	if err != nil {
+		return nil, err
+	}
+	if a.templateSandbox != nil {
+		if err := a.templateSandbox.prepare(t); err != nil {
+			return nil, fmt.Errorf("agent %s: %w", a.name, err)
+		}
+	}
+	required, read := templateKeys(t)
+	return &instructionSnapshot{template: t, version: version, stateKeys: required, readKeys: read}, nil
+}
+
+// currentInstruction returns the instruction of the agent, after reloading it
+// from its source if it may have changed. A watch signal stays pending until
+// a reload succeeds, so that a failed reload is retried on the next call.
+func (a *agent) currentInstruction(ctx context.Context) (*instructionSnapshot, error) {
+	if a.instructionSource == nil {
+		return a.instructions.Load(), nil
+	}
+	var pending int64
+	if a.instructionWatch != nil {
+		select {
+		case <-a.instructionWatch:
+			a.instructionPending.Add(1)
+		default:
+		}
+		pending = a.instructionPending.Load()
+		if current := a.instructions.Load(); current != nil && pending == 0 {
+			return current, nil
+		}
+	}
+	snapshot, err := a.loadInstruction(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Signals received during the reload are kept for the next call.
+	a.instructionPending.CompareAndSwap(pending, 0)
+	return snapshot, nil
+}
+
+// loadInstruction gets the instruction of the source and swaps it in if its
+// version changed.
+func (a *agent) loadInstruction(ctx context.Context) (*instructionSnapshot, error) {
+	instruction, version, err := a.instructionSource.Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("agent %s: load instruction: %w", a.name, err)
+	}
+	if version == "" {
+		version = a.instructionHash(instruction)
+	}
+	if current := a.instructions.Load(); current != nil && current.version == version {
+		return current, nil
+	}
+	a.instructionMu.Lock()
+	defer a.instructionMu.Unlock()
+	if current := a.instructions.Load(); current != nil && current.version == version {
+		return current, nil
+	}
+	snapshot, err := a.compileInstruction(instruction, version)
+	if err != nil {
+		return nil, err
+	}
+	a.instructions.Store(snapshot)
+	return snapshot, nil
+}
+
+// invocationVersion returns the instruction version the invocation of the
+// context runs with.
+func (a *agent) invocationVersion(ctx context.Context) string {
+	if snapshot, ok := ctx.Value(ctxInstructionKey{agent: a}).(*instructionSnapshot); ok {
+		return snapshot.version
+	}
+	return a.InstructionVersion()
+}
@@ -0,0 +1,226 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/blades/tools"
+)
+
+// echoInstruction answers with the instruction and the names of the tools of the request.
+func echoInstruction(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+	text := req.Instruction.Text()
+	for _, tool := range req.Tools {
+		text += " +" + tool.Name()
+	}
+	return textResponse(text), nil
+}
+
+func TestFileInstructionSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "instruction.txt")
+	write := func(text string, modTime time.Time) {
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("Greet {{.name}}.", time.Unix(1000, 0))
+	agent, err := NewAgent("greeter", WithModel(&mockModel{generate: echoInstruction}), WithInstructionsSource(NewFileInstructionSource(path)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := NewRunner(agent)
+	session := NewSession(map[string]any{"name": "Ada"})
+	answer, err := runner.Run(context.Background(), UserMessage("hi"), WithSession(session))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _ := answer.Metadata[InstructionVersionKey].(string)
+	if answer.Text() != "Greet Ada." || first == "" {
+		t.Fatalf("unexpected answer %q with version %q", answer.Text(), first)
+	}
+
+	write("Welcome {{.name}}.", time.Unix(2000, 0))
+	answer, err = runner.Run(context.Background(), UserMessage("hi"), WithSession(session))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer.Text() != "Welcome Ada." || answer.Metadata[InstructionVersionKey] == first {
+		t.Fatalf("want the edited instruction with a new version, got %q with %v", answer.Text(), answer.Metadata)
+	}
+	if got := agent.(interface{ InstructionVersion() string }).InstructionVersion(); got != answer.Metadata[InstructionVersionKey] {
+		t.Fatalf("want the current version %v, got %q", answer.Metadata[InstructionVersionKey], got)
+	}
+
+	if _, err := NewAgent("missing", WithModel(&mockModel{}), WithInstructionsSource(NewFileInstructionSource(path+".missing"))); err == nil {
+		t.Fatal("want an error for a missing file")
+	}
+}
+
+// switchSource is an instruction and tool source whose version is switched by the test.
+type switchSource struct {
+	version atomic.Int64
+	gets    atomic.Int64
+	changes chan struct{}
+}
+
+func (s *switchSource) Get(ctx context.Context) (string, string, error) {
+	s.gets.Add(1)
+	v := s.version.Load()
+	return fmt.Sprintf("Instruction v%d.", v), fmt.Sprintf("v%d", v), nil
+}
+
+func (s *switchSource) Tools(ctx context.Context) ([]tools.Tool, string, error) {
+	v := s.version.Load()
+	tool := tools.NewTool(fmt.Sprintf("tool_v%d", v), "A versioned tool.", tools.HandleFunc(func(ctx context.Context, input string) (string, error) {
+		return "", nil
+	}))
+	return []tools.Tool{tool}, fmt.Sprintf("v%d", v), nil
+}
+
+func TestInstructionSourceInFlight(t *testing.T) {
+	source := &switchSource{}
+	source.version.Store(1)
+	started, release := make(chan struct{}), make(chan struct{})
+	var blocked atomic.Bool
+	model := &mockModel{generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+		if blocked.CompareAndSwap(false, true) {
+			close(started)
+			<-release
+		}
+		return echoInstruction(ctx, req)
+	}}
+	agent, err := NewAgent("versioned",
+		WithModel(model),
+		WithInstructionsSource(source),
+		WithToolsResolver(tools.NewRefreshableResolver(tools.SourceFunc(source.Tools))),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := NewRunner(agent)
+
+	// The first invocation starts with v1 and is held in the model.
+	var inFlight *Message
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		inFlight, err = runner.Run(context.Background(), UserMessage("hi"), WithSession(NewSession()))
+		done <- err
+	}()
+	<-started
+	source.version.Store(2)
+	answer, err := runner.Run(context.Background(), UserMessage("hi"), WithSession(NewSession()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer.Text() != "Instruction v2. +tool_v2" || answer.Metadata[InstructionVersionKey] != "v2" {
+		t.Fatalf("want a new invocation on v2, got %q with %v", answer.Text(), answer.Metadata)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if inFlight.Text() != "Instruction v1. +tool_v1" || inFlight.Metadata[InstructionVersionKey] != "v1" {
+		t.Fatalf("want the in-flight invocation to finish on v1, got %q with %v", inFlight.Text(), inFlight.Metadata)
+	}
+}
+
+// watchedSource only changes after a signal.
+type watchedSource struct {
+	switchSource
+	fail atomic.Bool
+}
+
+func (s *watchedSource) Get(ctx context.Context) (string, string, error) {
+	if s.fail.Load() {
+		s.gets.Add(1)
+		return "", "", errors.New("unavailable")
+	}
+	return s.switchSource.Get(ctx)
+}
+
+func (s *watchedSource) Watch() <-chan struct{} {
+	return s.changes
+}
+
+func TestInstructionSourceWatch(t *testing.T) {
+	source := &watchedSource{switchSource: switchSource{changes: make(chan struct{}, 1)}}
+	source.version.Store(1)
+	agent, err := NewAgent("watched", WithModel(&mockModel{generate: echoInstruction}), WithInstructionsSource(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := NewRunner(agent)
+	run := func() string {
+		answer, err := runner.Run(context.Background(), UserMessage("hi"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return answer.Text()
+	}
+	source.version.Store(2)
+	if got := run(); got != "Instruction v1." || source.gets.Load() != 1 {
+		t.Fatalf("want v1 kept until a signal, got %q after %d gets", got, source.gets.Load())
+	}
+	source.changes <- struct{}{}
+	if got := run(); got != "Instruction v2." || source.gets.Load() != 2 {
+		t.Fatalf("want v2 after a signal, got %q after %d gets", got, source.gets.Load())
+	}
+	// A failed reload keeps the signal for the next invocation.
+	source.version.Store(3)
+	source.fail.Store(true)
+	source.changes <- struct{}{}
+	if _, err := runner.Run(context.Background(), UserMessage("hi")); err == nil {
+		t.Fatal("want the reload error")
+	}
+	source.fail.Store(false)
+	if got := run(); got != "Instruction v3." || source.gets.Load() != 4 {
+		t.Fatalf("want v3 after a retried reload, got %q after %d gets", got, source.gets.Load())
+	}
+	if got := run(); got != "Instruction v3." || source.gets.Load() != 4 {
+		t.Fatalf("want v3 kept once reloaded, got %q after %d gets", got, source.gets.Load())
+	}
+}
+
+func TestInstructionSourceConcurrentSwap(t *testing.T) {
+	source := &switchSource{}
+	source.version.Store(0)
+	agent, err := NewAgent("swapped", WithModel(&mockModel{generate: echoInstruction}), WithInstructionsSource(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := NewRunner(agent)
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 20 {
+				if i == 0 {
+					source.version.Store(int64(j))
+				}
+				answer, err := runner.Run(context.Background(), UserMessage("hi"), WithSession(NewSession()))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				// The answer is stamped with the version of the instruction it was rendered from.
+				if want := fmt.Sprintf("Instruction %s.", answer.Metadata[InstructionVersionKey]); answer.Text() != want {
+					t.Errorf("want %q, got %q", want, answer.Text())
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -33,3 +33,29 @@ func BuildInstruction(targets []blades.Agent) (string, error) {
 	}
 	return buf.String(), nil
 }
+
+const scoringInstructionTemplate = `You route the user's question to the agents best suited to answer it:
+{{range .Targets}}
+Agent Name: {{.Name}}
+Agent Description: {{.Description}}
+{{end}}
+Your task:
+- Score how well each agent can answer the user's question with a confidence between 0 (not at all) and 1 (certainly).
+- A question that spans several domains may score high for several agents.
+
+Important rules:
+- Answer only with a JSON object with one entry per agent, such as {"routes":[{"agent":"agent name","confidence":0.8}]}.
+- Do not answer the question yourself, and do not include any text outside of the JSON object.`
+
+var scoringPromptTmpl = template.Must(template.New("route_scoring_prompt").Parse(scoringInstructionTemplate))
+
+// BuildScoringInstruction builds the instruction for scoring the confidence of each target.
+func BuildScoringInstruction(targets []blades.Agent) (string, error) {
+	var buf bytes.Buffer
+	if err := scoringPromptTmpl.Execute(&buf, map[string]any{
+		"Targets": targets,
+	}); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
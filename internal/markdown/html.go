@@ -0,0 +1,168 @@
+package markdown
+
+import (
+	"html"
+	"strconv"
+	"strings"
+)
+
+// HTML renders the document as HTML that is safe to embed, e.g. in an email:
+// all text is escaped, raw HTML included, and links and images keep only
+// http, https and mailto URLs, or relative ones.
+func HTML(doc *Node) string {
+	var b strings.Builder
+	htmlBlocks(&b, doc.Children, false)
+	return b.String()
+}
+
+func htmlBlocks(b *strings.Builder, nodes []*Node, tight bool) {
+	for _, n := range nodes {
+		if tight && n.Kind == Paragraph {
+			htmlInlines(b, n.Children)
+			continue
+		}
+		if tight && b.Len() > 0 && !strings.HasSuffix(b.String(), "\n") {
+			b.WriteByte('\n')
+		}
+		htmlBlock(b, n)
+	}
+}
+
+func htmlBlock(b *strings.Builder, n *Node) {
+	switch n.Kind {
+	case Paragraph:
+		b.WriteString("<p>")
+		htmlInlines(b, n.Children)
+		b.WriteString("</p>\n")
+	case Heading:
+		tag := "h" + strconv.Itoa(n.Level)
+		b.WriteString("<" + tag + ">")
+		htmlInlines(b, n.Children)
+		b.WriteString("</" + tag + ">\n")
+	case CodeBlock:
+		b.WriteString("<pre><code")
+		if lang, _, _ := strings.Cut(n.Info, " "); lang != "" {
+			b.WriteString(` class="language-` + html.EscapeString(lang) + `"`)
+		}
+		b.WriteString(">" + html.EscapeString(n.Literal) + "</code></pre>\n")
+	case Quote:
+		b.WriteString("<blockquote>\n")
+		htmlBlocks(b, n.Children, false)
+		b.WriteString("</blockquote>\n")
+	case List:
+		tag := "ul"
+		if n.Ordered {
+			tag = "ol"
+		}
+		b.WriteString("<" + tag)
+		if n.Ordered && n.Start != 1 {
+			b.WriteString(` start="` + strconv.Itoa(n.Start) + `"`)
+		}
+		b.WriteString(">\n")
+		for _, item := range n.Children {
+			b.WriteString("<li>")
+			if !n.Tight && len(item.Children) > 0 {
+				b.WriteByte('\n')
+			}
+			htmlBlocks(b, item.Children, n.Tight)
+			b.WriteString("</li>\n")
+		}
+		b.WriteString("</" + tag + ">\n")
+	case Table:
+		b.WriteString("<table>\n")
+		for i, row := range n.Children {
+			cell := "td"
+			switch i {
+			case 0:
+				b.WriteString("<thead>\n")
+				cell = "th"
+			case 1:
+				b.WriteString("<tbody>\n")
+			}
+			b.WriteString("<tr>\n")
+			for c, content := range row.Children {
+				b.WriteString("<" + cell)
+				if n.Align[c] != "" {
+					b.WriteString(` align="` + n.Align[c] + `"`)
+				}
+				b.WriteString(">")
+				htmlInlines(b, content.Children)
+				b.WriteString("</" + cell + ">\n")
+			}
+			b.WriteString("</tr>\n")
+			if i == 0 {
+				b.WriteString("</thead>\n")
+			}
+		}
+		if len(n.Children) > 1 {
+			b.WriteString("</tbody>\n")
+		}
+		b.WriteString("</table>\n")
+	case Rule:
+		b.WriteString("<hr>\n")
+	}
+}
+
+func htmlInlines(b *strings.Builder, nodes []*Node) {
+	for _, n := range nodes {
+		switch n.Kind {
+		case Text:
+			b.WriteString(html.EscapeString(n.Literal))
+		case Code:
+			b.WriteString("<code>" + html.EscapeString(n.Literal) + "</code>")
+		case Emphasis, Strong, Strike:
+			tag := map[Kind]string{Emphasis: "em", Strong: "strong", Strike: "del"}[n.Kind]
+			b.WriteString("<" + tag + ">")
+			htmlInlines(b, n.Children)
+			b.WriteString("</" + tag + ">")
+		case Link:
+			if !safeURL(n.URL) {
+				htmlInlines(b, n.Children)
+				continue
+			}
+			b.WriteString(`<a href="` + html.EscapeString(n.URL) + `"`)
+			if n.Title != "" {
+				b.WriteString(` title="` + html.EscapeString(n.Title) + `"`)
+			}
+			b.WriteString(">")
+			htmlInlines(b, n.Children)
+			b.WriteString("</a>")
+		case Image:
+			alt := html.EscapeString(plainInlines(n.Children))
+			if !safeURL(n.URL) {
+				b.WriteString(alt)
+				continue
+			}
+			b.WriteString(`<img src="` + html.EscapeString(n.URL) + `" alt="` + alt + `"`)
+			if n.Title != "" {
+				b.WriteString(` title="` + html.EscapeString(n.Title) + `"`)
+			}
+			b.WriteString(">")
+		case SoftBreak:
+			b.WriteByte('\n')
+		case LineBreak:
+			b.WriteString("<br>\n")
+		}
+	}
+}
+
+// safeURL reports whether the URL is relative or has a safe scheme, which
+// rules out javascript: and data: URLs.
+func safeURL(url string) bool {
+	// Browsers ignore the whitespace and control characters of a scheme.
+	url = strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+		return r
+	}, url)
+	i := strings.IndexAny(url, ":/?#")
+	if i < 0 || url[i] != ':' {
+		return true
+	}
+	switch strings.ToLower(url[:i]) {
+	case "http", "https", "mailto":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,527 @@
+package markdown
+
+import (
+	"html"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// delimiter is a run of *, _ or ~ that may open or close emphasis.
+type delimiter struct {
+	node        *Node
+	char        byte
+	n, orig     int
+	open, close bool
+}
+
+// bracket is a [ or ![ that may open a link or an image.
+type bracket struct {
+	node  *Node
+	image bool
+	// start is the offset of the link text in the source.
+	start int
+	// bottom is the number of delimiters before the bracket.
+	bottom int
+	active bool
+}
+
+type inlineParser struct {
+	refs     map[string]reference
+	src      string
+	pos      int
+	nodes    []*Node
+	delims   []*delimiter
+	brackets []*bracket
+}
+
+// inlines parses the inlines of the text of a paragraph, heading or cell.
+func (p *parser) inlines(src string) []*Node {
+	ip := &inlineParser{refs: p.refs, src: src}
+	for ip.pos < len(src) {
+		switch c := src[ip.pos]; c {
+		case '\\':
+			ip.escape()
+		case '`':
+			ip.codeSpan()
+		case '*', '_', '~':
+			ip.delimiterRun(c)
+		case '[':
+			ip.openBracket(false, 1)
+		case '!':
+			if ip.pos+1 < len(src) && src[ip.pos+1] == '[' {
+				ip.openBracket(true, 2)
+			} else {
+				ip.text("!")
+				ip.pos++
+			}
+		case ']':
+			ip.closeBracket()
+		case '<':
+			ip.autolink()
+		case '&':
+			ip.entity()
+		case '\n':
+			ip.lineBreak()
+		default:
+			if url := ip.bareURL(); url != "" {
+				ip.nodes = append(ip.nodes, &Node{Kind: Link, URL: url, Children: []*Node{{Kind: Text, Literal: url}}})
+				ip.pos += len(url)
+				continue
+			}
+			j := ip.pos + 1
+			for j < len(src) && !strings.ContainsRune("\\`*_~[]!<&\n", rune(src[j])) && !ip.urlAt(j) {
+				j++
+			}
+			ip.text(src[ip.pos:j])
+			ip.pos = j
+		}
+	}
+	ip.processEmphasis(0)
+	return cleanup(ip.nodes)
+}
+
+// text appends the literal text, merged into the text before it.
+func (ip *inlineParser) text(s string) {
+	if n := len(ip.nodes); n > 0 && ip.nodes[n-1].Kind == Text && !ip.isMarker(ip.nodes[n-1]) {
+		ip.nodes[n-1].Literal += s
+		return
+	}
+	ip.nodes = append(ip.nodes, &Node{Kind: Text, Literal: s})
+}
+
+// isMarker reports whether the node is the text of a delimiter or bracket,
+// which is never merged.
+func (ip *inlineParser) isMarker(n *Node) bool {
+	return slices.ContainsFunc(ip.delims, func(d *delimiter) bool { return d.node == n }) ||
+		slices.ContainsFunc(ip.brackets, func(b *bracket) bool { return b.node == n })
+}
+
+// escape parses a backslash escape, or a hard line break.
+func (ip *inlineParser) escape() {
+	if ip.pos+1 < len(ip.src) {
+		next := ip.src[ip.pos+1]
+		switch {
+		case next == '\n':
+			ip.nodes = append(ip.nodes, &Node{Kind: LineBreak})
+			ip.pos += 2
+			ip.skipSpaces()
+			return
+		case isASCIIPunct(next):
+			ip.text(string(next))
+			ip.pos += 2
+			return
+		}
+	}
+	ip.text("\\")
+	ip.pos++
+}
+
+// codeSpan parses a code span, or the backticks as text if it is not closed.
+func (ip *inlineParser) codeSpan() {
+	n := runLength(ip.src, ip.pos)
+	for i := ip.pos + n; i < len(ip.src); {
+		if ip.src[i] != '`' {
+			i++
+			continue
+		}
+		m := runLength(ip.src, i)
+		if m == n {
+			code := strings.ReplaceAll(ip.src[ip.pos+n:i], "\n", " ")
+			if len(code) >= 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+				code = code[1 : len(code)-1]
+			}
+			ip.nodes = append(ip.nodes, &Node{Kind: Code, Literal: code})
+			ip.pos = i + m
+			return
+		}
+		i += m
+	}
+	ip.text(ip.src[ip.pos : ip.pos+n])
+	ip.pos += n
+}
+
+// delimiterRun parses a run of *, _ or ~, and records whether it can open or
+// close emphasis by the characters around it.
+func (ip *inlineParser) delimiterRun(c byte) {
+	n := runLength(ip.src, ip.pos)
+	before, _ := utf8.DecodeLastRuneInString(ip.src[:ip.pos])
+	if ip.pos == 0 {
+		before = ' '
+	}
+	after, _ := utf8.DecodeRuneInString(ip.src[ip.pos+n:])
+	if ip.pos+n == len(ip.src) {
+		after = ' '
+	}
+	left := !unicode.IsSpace(after) && (!isPunct(after) || unicode.IsSpace(before) || isPunct(before))
+	right := !unicode.IsSpace(before) && (!isPunct(before) || unicode.IsSpace(after) || isPunct(after))
+	open, close := left, right
+	if c == '_' {
+		open = left && (!right || isPunct(before))
+		close = right && (!left || isPunct(after))
+	}
+	run := ip.src[ip.pos : ip.pos+n]
+	ip.pos += n
+	if (c == '~' && n > 2) || (!open && !close) {
+		ip.text(run)
+		return
+	}
+	node := &Node{Kind: Text, Literal: run}
+	ip.nodes = append(ip.nodes, node)
+	ip.delims = append(ip.delims, &delimiter{node: node, char: c, n: n, orig: n, open: open, close: close})
+}
+
+// openBracket records a [ or ![ that may open a link or an image.
+func (ip *inlineParser) openBracket(image bool, width int) {
+	node := &Node{Kind: Text, Literal: ip.src[ip.pos : ip.pos+width]}
+	ip.nodes = append(ip.nodes, node)
+	ip.pos += width
+	ip.brackets = append(ip.brackets, &bracket{node: node, image: image, start: ip.pos, bottom: len(ip.delims), active: true})
+}
+
+// closeBracket parses a ], which closes a link or an image if it is followed
+// by a destination or matches a reference.
+func (ip *inlineParser) closeBracket() {
+	if len(ip.brackets) == 0 {
+		ip.text("]")
+		ip.pos++
+		return
+	}
+	b := ip.brackets[len(ip.brackets)-1]
+	url, title, end, ok := "", "", 0, false
+	if b.active {
+		url, title, end, ok = ip.linkTail(b.start)
+	}
+	if !ok {
+		ip.brackets = ip.brackets[:len(ip.brackets)-1]
+		ip.text("]")
+		ip.pos++
+		return
+	}
+	ip.processEmphasis(b.bottom)
+	i := slices.Index(ip.nodes, b.node)
+	kind := Link
+	if b.image {
+		kind = Image
+	}
+	link := &Node{Kind: kind, URL: url, Title: title, Children: cleanup(slices.Clone(ip.nodes[i+1:]))}
+	ip.nodes = append(ip.nodes[:i], link)
+	ip.delims = ip.delims[:b.bottom]
+	ip.brackets = ip.brackets[:len(ip.brackets)-1]
+	if !b.image {
+		// Links do not contain links.
+		for _, o := range ip.brackets {
+			if !o.image {
+				o.active = false
+			}
+		}
+	}
+	ip.pos = end
+}
+
+// linkTail parses what follows the ] at ip.pos of a link whose text starts
+// at start: a destination in parentheses, or a reference. It returns the URL
+// and title of the link, and the offset after it.
+func (ip *inlineParser) linkTail(start int) (string, string, int, bool) {
+	label := ip.src[start:ip.pos]
+	i := ip.pos + 1
+	if i < len(ip.src) && ip.src[i] == '(' {
+		if url, title, end, ok := parseDestination(ip.src, i); ok {
+			return url, title, end, true
+		}
+	}
+	if i < len(ip.src) && ip.src[i] == '[' {
+		if close := strings.IndexByte(ip.src[i+1:], ']'); close >= 0 {
+			ref := ip.src[i+1 : i+1+close]
+			if ref == "" {
+				ref = label
+			}
+			if r, ok := ip.refs[normalizeLabel(ref)]; ok {
+				return r.url, r.title, i + close + 2, true
+			}
+			return "", "", 0, false
+		}
+	}
+	if r, ok := ip.refs[normalizeLabel(label)]; ok {
+		return r.url, r.title, i, true
+	}
+	return "", "", 0, false
+}
+
+// parseDestination parses the destination and title of an inline link, in
+// the parentheses at src[i].
+func parseDestination(src string, i int) (string, string, int, bool) {
+	i = skipSpace(src, i+1)
+	var dest string
+	if i < len(src) && src[i] == '<' {
+		end := strings.IndexAny(src[i+1:], ">\n")
+		if end < 0 || src[i+1+end] != '>' {
+			return "", "", 0, false
+		}
+		dest = src[i+1 : i+1+end]
+		i += end + 2
+	} else {
+		depth, j := 0, i
+	dest:
+		for ; j < len(src); j++ {
+			switch c := src[j]; {
+			case c == '\\' && j+1 < len(src):
+				j++
+			case c == '(':
+				depth++
+			case c == ')':
+				if depth == 0 {
+					break dest
+				}
+				depth--
+			case c == ' ' || c == '\n' || c < 0x20:
+				break dest
+			}
+		}
+		dest = src[i:j]
+		i = j
+	}
+	i = skipSpace(src, i)
+	var title string
+	if i < len(src) {
+		if closer := closingQuote(src[i]); closer != 0 {
+			end := strings.IndexByte(src[i+1:], closer)
+			if end < 0 {
+				return "", "", 0, false
+			}
+			title = src[i+1 : i+1+end]
+			i = skipSpace(src, i+end+2)
+		}
+	}
+	if i >= len(src) || src[i] != ')' {
+		return "", "", 0, false
+	}
+	return unescape(dest), unescape(title), i + 1, true
+}
+
+// autolink parses an autolink such as <https://example.com>, or the < as text.
+func (ip *inlineParser) autolink() {
+	end := strings.IndexAny(ip.src[ip.pos+1:], "<> \n")
+	if end > 0 && ip.src[ip.pos+1+end] == '>' {
+		content := ip.src[ip.pos+1 : ip.pos+1+end]
+		url := ""
+		switch {
+		case hasScheme(content):
+			url = content
+		case strings.Contains(content, "@") && !strings.ContainsAny(content, ":/\\"):
+			url = "mailto:" + content
+		}
+		if url != "" {
+			ip.nodes = append(ip.nodes, &Node{Kind: Link, URL: url, Children: []*Node{{Kind: Text, Literal: content}}})
+			ip.pos += end + 2
+			return
+		}
+	}
+	ip.text("<")
+	ip.pos++
+}
+
+// entity parses an HTML entity such as &amp;, or the & as text.
+func (ip *inlineParser) entity() {
+	if end := strings.IndexByte(ip.src[ip.pos:], ';'); end > 1 && end < 32 {
+		candidate := ip.src[ip.pos : ip.pos+end+1]
+		if decoded := html.UnescapeString(candidate); decoded != candidate {
+			ip.text(decoded)
+			ip.pos += end + 1
+			return
+		}
+	}
+	ip.text("&")
+	ip.pos++
+}
+
+// lineBreak parses a line ending: a hard break after two spaces, otherwise
+// a soft one.
+func (ip *inlineParser) lineBreak() {
+	kind := SoftBreak
+	if n := len(ip.nodes); n > 0 && ip.nodes[n-1].Kind == Text && !ip.isMarker(ip.nodes[n-1]) {
+		last := ip.nodes[n-1]
+		trimmed := strings.TrimRight(last.Literal, " ")
+		if len(last.Literal)-len(trimmed) >= 2 {
+			kind = LineBreak
+		}
+		last.Literal = trimmed
+	}
+	ip.nodes = append(ip.nodes, &Node{Kind: kind})
+	ip.pos++
+	ip.skipSpaces()
+}
+
+func (ip *inlineParser) skipSpaces() {
+	for ip.pos < len(ip.src) && ip.src[ip.pos] == ' ' {
+		ip.pos++
+	}
+}
+
+// bareURL returns the URL starting at ip.pos, such as https://example.com,
+// without the punctuation that ends the sentence around it.
+func (ip *inlineParser) bareURL() string {
+	if !ip.urlAt(ip.pos) {
+		return ""
+	}
+	end := strings.IndexAny(ip.src[ip.pos:], " \n<")
+	if end < 0 {
+		end = len(ip.src) - ip.pos
+	}
+	url := ip.src[ip.pos : ip.pos+end]
+	for {
+		trimmed := strings.TrimRight(url, ".,:;!?\"'*_~")
+		if strings.HasSuffix(trimmed, ")") && strings.Count(trimmed, ")") > strings.Count(trimmed, "(") {
+			trimmed = trimmed[:len(trimmed)-1]
+		}
+		if trimmed == url {
+			break
+		}
+		url = trimmed
+	}
+	if url == "http://" || url == "https://" {
+		return ""
+	}
+	return url
+}
+
+// urlAt reports whether a bare URL starts at src[i], at the start of a word.
+func (ip *inlineParser) urlAt(i int) bool {
+	if !strings.HasPrefix(ip.src[i:], "http://") && !strings.HasPrefix(ip.src[i:], "https://") {
+		return false
+	}
+	before, _ := utf8.DecodeLastRuneInString(ip.src[:i])
+	return i == 0 || !unicode.IsLetter(before) && !unicode.IsDigit(before)
+}
+
+// processEmphasis matches the delimiters above bottom into emphasis, strong
+// emphasis and strikethrough, innermost first.
+func (ip *inlineParser) processEmphasis(bottom int) {
+	for c := bottom; c < len(ip.delims); c++ {
+		closer := ip.delims[c]
+		if !closer.close {
+			continue
+		}
+		o := c - 1
+		for ; o >= bottom; o-- {
+			opener := ip.delims[o]
+			if opener.char != closer.char || !opener.open {
+				continue
+			}
+			if closer.char == '~' && opener.n != closer.n {
+				continue
+			}
+			// The rule of 3: a run that can open and close only matches
+			// runs whose lengths do not sum to a multiple of 3.
+			if (opener.close || closer.open) && (opener.orig+closer.orig)%3 == 0 && (opener.orig%3 != 0 || closer.orig%3 != 0) {
+				continue
+			}
+			break
+		}
+		if o < bottom {
+			continue
+		}
+		opener := ip.delims[o]
+		use, kind := 1, Emphasis
+		switch {
+		case closer.char == '~':
+			use, kind = closer.n, Strike
+		case opener.n >= 2 && closer.n >= 2:
+			use, kind = 2, Strong
+		}
+		start, end := slices.Index(ip.nodes, opener.node), slices.Index(ip.nodes, closer.node)
+		wrap := &Node{Kind: kind, Children: slices.Clone(ip.nodes[start+1 : end])}
+		ip.nodes = slices.Replace(ip.nodes, start+1, end, wrap)
+		opener.n -= use
+		closer.n -= use
+		opener.node.Literal = opener.node.Literal[:opener.n]
+		closer.node.Literal = closer.node.Literal[use:]
+		// The delimiters between them are text now.
+		ip.delims = slices.Delete(ip.delims, o+1, c)
+		c = o + 1
+		if opener.n == 0 {
+			ip.delims = slices.Delete(ip.delims, o, o+1)
+			c--
+		}
+		if closer.n == 0 {
+			ip.delims = slices.Delete(ip.delims, c, c+1)
+		}
+		// The closer, or the delimiter after it, is looked at again.
+		c--
+	}
+}
+
+// cleanup drops empty text and merges adjacent text of the nodes.
+func cleanup(nodes []*Node) []*Node {
+	var out []*Node
+	for _, n := range nodes {
+		if n.Kind == Text {
+			if n.Literal == "" {
+				continue
+			}
+			if len(out) > 0 && out[len(out)-1].Kind == Text {
+				out[len(out)-1] = &Node{Kind: Text, Literal: out[len(out)-1].Literal + n.Literal}
+				continue
+			}
+		}
+		if len(n.Children) > 0 {
+			n.Children = cleanup(n.Children)
+		}
+		out = append(out, n)
+	}
+	return out
+}
+
+// hasScheme reports whether the text starts with a URI scheme, such as https:.
+func hasScheme(text string) bool {
+	scheme, _, ok := strings.Cut(text, ":")
+	if !ok || len(scheme) < 2 || len(scheme) > 32 {
+		return false
+	}
+	for i, r := range scheme {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || i > 0 && (r >= '0' && r <= '9' || r == '+' || r == '.' || r == '-')) {
+			return false
+		}
+	}
+	return true
+}
+
+// unescape removes the backslashes escaping punctuation and decodes the
+// entities of a link destination or title.
+func unescape(s string) string {
+	if strings.IndexByte(s, '\\') >= 0 {
+		var b strings.Builder
+		for i := 0; i < len(s); i++ {
+			if s[i] == '\\' && i+1 < len(s) && isASCIIPunct(s[i+1]) {
+				i++
+			}
+			b.WriteByte(s[i])
+		}
+		s = b.String()
+	}
+	return html.UnescapeString(s)
+}
+
+func runLength(s string, i int) int {
+	n := 0
+	for i+n < len(s) && s[i+n] == s[i] {
+		n++
+	}
+	return n
+}
+
+func skipSpace(s string, i int) int {
+	for i < len(s) && (s[i] == ' ' || s[i] == '\n') {
+		i++
+	}
+	return i
+}
+
+func isASCIIPunct(c byte) bool {
+	return c < utf8.RuneSelf && strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+func isPunct(r rune) bool {
+	return unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
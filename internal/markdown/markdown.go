@@ -0,0 +1,650 @@
+// Package markdown parses the markdown models write, CommonMark with the
+// tables, strikethrough and autolinks of GitHub, and renders it as plain
+// text, safe HTML or Slack mrkdwn.
+package markdown
+
+import (
+	"strings"
+)
+
+// Kind is the kind of a node.
+type Kind int
+
+const (
+	Document Kind = iota
+	Paragraph
+	Heading
+	CodeBlock
+	Quote
+	List
+	Item
+	Table
+	Row
+	Cell
+	Rule
+	Text
+	Code
+	Emphasis
+	Strong
+	Strike
+	Link
+	Image
+	SoftBreak
+	LineBreak
+)
+
+// Node is a node of the syntax tree of a markdown document.
+type Node struct {
+	Kind     Kind
+	Children []*Node
+	// Literal is the text of Text, Code and CodeBlock nodes.
+	Literal string
+	// Level is the level of a Heading, from 1.
+	Level int
+	// Info is the info string of a fenced CodeBlock, e.g. its language.
+	Info string
+	// Ordered, Start and Tight describe a List; the items of a tight list
+	// are not separated by blank lines.
+	Ordered bool
+	Start   int
+	Tight   bool
+	// Align is the alignment of the columns of a Table: "left", "right",
+	// "center" or "". The first Row of a Table is its header.
+	Align []string
+	// URL and Title are the destination and title of a Link or Image.
+	URL   string
+	Title string
+}
+
+// reference is a link reference definition, e.g. [docs]: https://example.com.
+type reference struct {
+	url, title string
+}
+
+type parser struct {
+	refs map[string]reference
+}
+
+// Parse returns the syntax tree of the markdown document. Raw HTML is kept
+// as text.
+func Parse(src string) *Node {
+	p := &parser{refs: make(map[string]reference)}
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	lines := strings.Split(src, "\n")
+	for i, line := range lines {
+		lines[i] = expandTabs(line)
+	}
+	doc := &Node{Kind: Document, Children: p.blocks(lines)}
+	// Inlines are parsed last, once all the references are defined.
+	p.parseInlines(doc)
+	return doc
+}
+
+// blocks parses the lines into blocks.
+func (p *parser) blocks(lines []string) []*Node {
+	var (
+		blocks []*Node
+		para   []string
+	)
+	flush := func() {
+		if len(para) > 0 {
+			if n := p.paragraph(para); n != nil {
+				blocks = append(blocks, n)
+			}
+			para = nil
+		}
+	}
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		indent, rest := indentation(line)
+		switch {
+		case rest == "":
+			flush()
+			i++
+			continue
+		case indent >= 4:
+			if len(para) > 0 {
+				// A paragraph continues on an indented line.
+				para = append(para, rest)
+				i++
+				continue
+			}
+			var code []string
+			j := i
+			for ; j < len(lines) && (isBlank(lines[j]) || indentOf(lines[j]) >= 4); j++ {
+				code = append(code, stripIndent(lines[j], 4))
+			}
+			for len(code) > 0 && strings.TrimSpace(code[len(code)-1]) == "" {
+				code = code[:len(code)-1]
+			}
+			blocks = append(blocks, &Node{Kind: CodeBlock, Literal: strings.Join(code, "\n") + "\n"})
+			i = j
+			continue
+		}
+		if fence, info, ok := openFence(rest); ok {
+			flush()
+			var code []string
+			j := i + 1
+			for ; j < len(lines); j++ {
+				if closesFence(lines[j], fence) {
+					j++
+					break
+				}
+				code = append(code, stripIndent(lines[j], indent))
+			}
+			block := &Node{Kind: CodeBlock, Info: info}
+			if len(code) > 0 {
+				block.Literal = strings.Join(code, "\n") + "\n"
+			}
+			blocks = append(blocks, block)
+			i = j
+			continue
+		}
+		if level, text, ok := atxHeading(rest); ok {
+			flush()
+			blocks = append(blocks, &Node{Kind: Heading, Level: level, Literal: text})
+			i++
+			continue
+		}
+		if len(para) > 0 {
+			if level := setextUnderline(rest); level > 0 {
+				heading := &Node{Kind: Heading, Level: level, Literal: strings.TrimSpace(strings.Join(para, "\n"))}
+				para = nil
+				blocks = append(blocks, heading)
+				i++
+				continue
+			}
+		}
+		if isRule(rest) {
+			flush()
+			blocks = append(blocks, &Node{Kind: Rule})
+			i++
+			continue
+		}
+		if strings.HasPrefix(rest, ">") {
+			flush()
+			quote, j := p.quote(lines, i)
+			blocks = append(blocks, quote)
+			i = j
+			continue
+		}
+		if m, ok := listMarker(line); ok && (len(para) == 0 || m.interrupts()) {
+			flush()
+			list, j := p.list(lines, i)
+			blocks = append(blocks, list)
+			i = j
+			continue
+		}
+		if i+1 < len(lines) && strings.Contains(rest, "|") {
+			if align, ok := delimiterRow(lines[i+1]); ok && len(splitRow(rest)) == len(align) {
+				flush()
+				table, j := p.table(lines, i, align)
+				blocks = append(blocks, table)
+				i = j
+				continue
+			}
+		}
+		para = append(para, rest)
+		i++
+	}
+	flush()
+	return blocks
+}
+
+// paragraph returns the paragraph of the lines, after the link reference
+// definitions that start it, or nil if it only holds definitions.
+func (p *parser) paragraph(lines []string) *Node {
+	for len(lines) > 0 {
+		label, ref, ok := parseDefinition(lines[0])
+		if !ok {
+			break
+		}
+		if _, seen := p.refs[label]; !seen {
+			p.refs[label] = ref
+		}
+		lines = lines[1:]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	text := strings.Join(lines, "\n")
+	return &Node{Kind: Paragraph, Literal: strings.TrimRight(text, " ")}
+}
+
+// quote parses the block quote starting at lines[i], and returns the index
+// of the line after it.
+func (p *parser) quote(lines []string, i int) (*Node, int) {
+	var inner []string
+	j := i
+	for ; j < len(lines); j++ {
+		indent, rest := indentation(lines[j])
+		if indent < 4 && strings.HasPrefix(rest, ">") {
+			inner = append(inner, strings.TrimPrefix(rest[1:], " "))
+			continue
+		}
+		// A paragraph of the quote continues on lazy lines.
+		if rest != "" && len(inner) > 0 && !isBlank(inner[len(inner)-1]) && !startsBlock(lines[j]) {
+			inner = append(inner, rest)
+			continue
+		}
+		break
+	}
+	return &Node{Kind: Quote, Children: p.blocks(inner)}, j
+}
+
+// list parses the list starting at lines[i], and returns the index of the
+// line after it.
+func (p *parser) list(lines []string, i int) (*Node, int) {
+	first, _ := listMarker(lines[i])
+	list := &Node{Kind: List, Ordered: first.ordered, Start: first.start, Tight: true}
+	j := i
+	for j < len(lines) {
+		m, ok := listMarker(lines[j])
+		if !ok || m.ordered != first.ordered || m.char != first.char {
+			break
+		}
+		var content []string
+		if m.width < len(lines[j]) {
+			content = append(content, lines[j][m.width:])
+		} else {
+			content = append(content, "")
+		}
+		for j++; j < len(lines); j++ {
+			line := lines[j]
+			if isBlank(line) {
+				content = append(content, "")
+				continue
+			}
+			if indentOf(line) >= m.width {
+				content = append(content, line[m.width:])
+				continue
+			}
+			// An unindented line ends the item, unless it continues its
+			// last paragraph.
+			if content[len(content)-1] == "" || startsBlock(line) {
+				break
+			}
+			content = append(content, strings.TrimLeft(line, " "))
+		}
+		blanks := 0
+		for len(content) > 0 && content[len(content)-1] == "" {
+			content = content[:len(content)-1]
+			blanks++
+		}
+		item := &Node{Kind: Item, Children: p.blocks(content)}
+		list.Children = append(list.Children, item)
+		if len(item.Children) > 1 && hasInnerBlank(content) {
+			list.Tight = false
+		}
+		if blanks > 0 {
+			if next, ok := listMarker(lineAt(lines, j)); ok && next.ordered == first.ordered && next.char == first.char {
+				list.Tight = false
+			}
+		}
+	}
+	return list, j
+}
+
+// table parses the table whose header is lines[i], and returns the index of
+// the line after it.
+func (p *parser) table(lines []string, i int, align []string) (*Node, int) {
+	table := &Node{Kind: Table, Align: align}
+	addRow := func(line string) {
+		cells := splitRow(strings.TrimSpace(line))
+		row := &Node{Kind: Row}
+		for c := range align {
+			var text string
+			if c < len(cells) {
+				text = cells[c]
+			}
+			row.Children = append(row.Children, &Node{Kind: Cell, Literal: text})
+		}
+		table.Children = append(table.Children, row)
+	}
+	addRow(lines[i])
+	j := i + 2
+	for ; j < len(lines) && !isBlank(lines[j]) && !startsBlock(lines[j]); j++ {
+		addRow(lines[j])
+	}
+	return table, j
+}
+
+// parseInlines replaces the text of the paragraphs, headings and cells of
+// the tree with their inlines.
+func (p *parser) parseInlines(n *Node) {
+	switch n.Kind {
+	case Paragraph, Heading, Cell:
+		n.Children = p.inlines(n.Literal)
+		n.Literal = ""
+		return
+	}
+	for _, child := range n.Children {
+		p.parseInlines(child)
+	}
+}
+
+// marker is the marker of a list item.
+type marker struct {
+	ordered bool
+	// char is the bullet, or the delimiter after the number.
+	char  byte
+	start int
+	// width is the indentation of the content of the item.
+	width int
+	empty bool
+}
+
+// interrupts reports whether the item can start a list in the middle of a
+// paragraph.
+func (m marker) interrupts() bool {
+	return !m.empty && (!m.ordered || m.start == 1)
+}
+
+// listMarker returns the list item marker the line starts with.
+func listMarker(line string) (marker, bool) {
+	indent, rest := indentation(line)
+	if indent >= 4 || rest == "" {
+		return marker{}, false
+	}
+	var m marker
+	n := 0
+	switch c := rest[0]; {
+	case c == '-' || c == '*' || c == '+':
+		m.char, n = c, 1
+	case c >= '0' && c <= '9':
+		for n < len(rest) && n < 9 && rest[n] >= '0' && rest[n] <= '9' {
+			m.start = m.start*10 + int(rest[n]-'0')
+			n++
+		}
+		if n == len(rest) || (rest[n] != '.' && rest[n] != ')') {
+			return marker{}, false
+		}
+		m.ordered, m.char = true, rest[n]
+		n++
+	default:
+		return marker{}, false
+	}
+	after := rest[n:]
+	if after != "" && after[0] != ' ' {
+		return marker{}, false
+	}
+	spaces := len(after) - len(strings.TrimLeft(after, " "))
+	switch {
+	case strings.TrimSpace(after) == "":
+		m.empty, spaces = true, 1
+	case spaces > 4:
+		// The content is indented code; the marker takes one space.
+		spaces = 1
+	}
+	m.width = indent + n + spaces
+	return m, true
+}
+
+// startsBlock reports whether the line starts a block other than a paragraph.
+func startsBlock(line string) bool {
+	indent, rest := indentation(line)
+	if indent >= 4 || rest == "" {
+		return false
+	}
+	if _, _, ok := openFence(rest); ok {
+		return true
+	}
+	if _, _, ok := atxHeading(rest); ok {
+		return true
+	}
+	_, isItem := listMarker(line)
+	return isItem || isRule(rest) || strings.HasPrefix(rest, ">")
+}
+
+// openFence returns the fence and the info string of a line opening a
+// fenced code block.
+func openFence(rest string) (string, string, bool) {
+	if rest == "" || (rest[0] != '`' && rest[0] != '~') {
+		return "", "", false
+	}
+	n := len(rest) - len(strings.TrimLeft(rest, rest[:1]))
+	if n < 3 {
+		return "", "", false
+	}
+	info := strings.TrimSpace(rest[n:])
+	if rest[0] == '`' && strings.Contains(info, "`") {
+		return "", "", false
+	}
+	return rest[:n], info, true
+}
+
+// closesFence reports whether the line closes the fenced code block.
+func closesFence(line, fence string) bool {
+	indent, rest := indentation(line)
+	if indent >= 4 || !strings.HasPrefix(rest, fence) {
+		return false
+	}
+	return strings.TrimLeft(rest, fence[:1]) == ""
+}
+
+// atxHeading returns the level and text of a heading such as "## Title".
+func atxHeading(rest string) (int, string, bool) {
+	level := len(rest) - len(strings.TrimLeft(rest, "#"))
+	if level == 0 || level > 6 || (level < len(rest) && rest[level] != ' ') {
+		return 0, "", false
+	}
+	text := strings.TrimSpace(rest[level:])
+	// A closing sequence of #s is removed.
+	if trimmed := strings.TrimRight(text, "#"); trimmed == "" || strings.HasSuffix(trimmed, " ") {
+		text = strings.TrimSpace(trimmed)
+	}
+	return level, text, true
+}
+
+// setextUnderline returns the level of the heading underlined by the line,
+// or 0 if it is not an underline.
+func setextUnderline(rest string) int {
+	rest = strings.TrimRight(rest, " ")
+	switch {
+	case rest == "":
+		return 0
+	case strings.Trim(rest, "=") == "":
+		return 1
+	case strings.Trim(rest, "-") == "":
+		return 2
+	}
+	return 0
+}
+
+// isRule reports whether the line is a thematic break, such as "---".
+func isRule(rest string) bool {
+	if rest == "" || (rest[0] != '-' && rest[0] != '*' && rest[0] != '_') {
+		return false
+	}
+	n := 0
+	for i := 0; i < len(rest); i++ {
+		switch rest[i] {
+		case rest[0]:
+			n++
+		case ' ':
+		default:
+			return false
+		}
+	}
+	return n >= 3
+}
+
+// delimiterRow returns the alignment of the columns of a table delimiter
+// row, such as "|:---|---:|".
+func delimiterRow(line string) ([]string, bool) {
+	indent, rest := indentation(line)
+	if indent >= 4 || !strings.Contains(rest, "-") {
+		return nil, false
+	}
+	cells := splitRow(rest)
+	if len(cells) == 0 || (len(cells) == 1 && !strings.Contains(rest, "|")) {
+		return nil, false
+	}
+	align := make([]string, len(cells))
+	for i, cell := range cells {
+		left, right := strings.HasPrefix(cell, ":"), strings.HasSuffix(cell, ":")
+		dashes := strings.TrimSuffix(strings.TrimPrefix(cell, ":"), ":")
+		if dashes == "" || strings.Trim(dashes, "-") != "" {
+			return nil, false
+		}
+		switch {
+		case left && right:
+			align[i] = "center"
+		case left:
+			align[i] = "left"
+		case right:
+			align[i] = "right"
+		}
+	}
+	return align, true
+}
+
+// splitRow returns the cells of a table row, split at the pipes that are
+// not escaped.
+func splitRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+	var (
+		cells []string
+		cell  strings.Builder
+	)
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+// parseDefinition parses a link reference definition such as
+// [label]: https://example.com "Title".
+func parseDefinition(line string) (string, reference, bool) {
+	if !strings.HasPrefix(line, "[") {
+		return "", reference{}, false
+	}
+	end := strings.Index(line, "]:")
+	if end < 2 || strings.ContainsAny(line[1:end], "[]") {
+		return "", reference{}, false
+	}
+	label := normalizeLabel(line[1:end])
+	rest := strings.TrimSpace(line[end+2:])
+	dest, rest, _ := strings.Cut(rest, " ")
+	dest = strings.TrimSuffix(strings.TrimPrefix(dest, "<"), ">")
+	if dest == "" {
+		return "", reference{}, false
+	}
+	var title string
+	if rest = strings.TrimSpace(rest); rest != "" {
+		if len(rest) < 2 || closingQuote(rest[0]) == 0 || closingQuote(rest[0]) != rest[len(rest)-1] {
+			return "", reference{}, false
+		}
+		title = rest[1 : len(rest)-1]
+	}
+	return label, reference{url: unescape(dest), title: unescape(title)}, true
+}
+
+// closingQuote returns the closer of a link title opened by c, or 0.
+func closingQuote(c byte) byte {
+	switch c {
+	case '"', '\'':
+		return c
+	case '(':
+		return ')'
+	}
+	return 0
+}
+
+// normalizeLabel returns the label of a link reference as it is matched:
+// case-insensitive, with its whitespace collapsed.
+func normalizeLabel(label string) string {
+	return strings.ToLower(strings.Join(strings.Fields(label), " "))
+}
+
+// hasInnerBlank reports whether a blank line separates two blocks of the
+// content of a list item, outside of fenced code.
+func hasInnerBlank(content []string) bool {
+	fence := ""
+	for i, line := range content {
+		_, rest := indentation(line)
+		if fence != "" {
+			if closesFence(line, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if f, _, ok := openFence(rest); ok {
+			fence = f
+			continue
+		}
+		if rest == "" && i > 0 && i < len(content)-1 && indentOf(content[i+1]) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// indentation returns the number of leading spaces of the line and the rest
+// of it, without its trailing spaces if it is blank.
+func indentation(line string) (int, string) {
+	rest := strings.TrimLeft(line, " ")
+	if strings.TrimSpace(rest) == "" {
+		return len(line) - len(rest), ""
+	}
+	return len(line) - len(rest), rest
+}
+
+func indentOf(line string) int {
+	n, _ := indentation(line)
+	return n
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+// stripIndent removes up to n leading spaces of the line.
+func stripIndent(line string, n int) string {
+	i := 0
+	for i < n && i < len(line) && line[i] == ' ' {
+		i++
+	}
+	return line[i:]
+}
+
+// lineAt returns lines[i], or "" past the end.
+func lineAt(lines []string, i int) string {
+	if i < len(lines) {
+		return lines[i]
+	}
+	return ""
+}
+
+// expandTabs replaces the tabs of the indentation of the line with spaces,
+// to the next multiple of 4 columns.
+func expandTabs(line string) string {
+	if !strings.Contains(line, "\t") {
+		return line
+	}
+	var b strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\t':
+			b.WriteString(strings.Repeat(" ", 4-b.Len()%4))
+		case ' ':
+			b.WriteByte(' ')
+		default:
+			return b.String() + line[i:]
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,69 @@
+package markdown
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestRenderGolden(t *testing.T) {
+	renderers := map[string]func(*Node) string{
+		".txt":   PlainText,
+		".html":  HTML,
+		".slack": Slack,
+	}
+	sources, err := filepath.Glob(filepath.Join("testdata", "*.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, source := range sources {
+		src, err := os.ReadFile(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for ext, render := range renderers {
+			golden := strings.TrimSuffix(source, ".md") + ext
+			t.Run(filepath.Base(golden), func(t *testing.T) {
+				got := render(Parse(string(src)))
+				if *update {
+					if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+						t.Fatal(err)
+					}
+				}
+				want, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != string(want) {
+					t.Fatalf("output differs from %s:\n%s", golden, got)
+				}
+			})
+		}
+	}
+}
+
+func FuzzRender(f *testing.F) {
+	sources, err := filepath.Glob(filepath.Join("testdata", "*.md"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, source := range sources {
+		src, err := os.ReadFile(source)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(string(src))
+	}
+	f.Add("|\n| -")
+	f.Add("| a | b |\n|:-:|--:|\n| 1 |")
+	f.Fuzz(func(t *testing.T, src string) {
+		doc := Parse(src)
+		PlainText(doc)
+		HTML(doc)
+		Slack(doc)
+	})
+}
@@ -0,0 +1,274 @@
+package markdown
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// PlainText renders the document as plain text, e.g. for speech: the markup is
+// removed, links are followed by their URL and images replaced by their
+// alternative text. Lists keep their markers and tables their columns.
+func PlainText(doc *Node) string {
+	r := &lineRenderer{
+		inline: plainInlines,
+		heading: func(_ int, text string) string {
+			return text
+		},
+		bullet: func(int) string { return "- " },
+		quote:  "  ",
+		code: func(_, code string) string {
+			return code
+		},
+		table: alignColumns,
+	}
+	return r.blocks(doc.Children, 0, false)
+}
+
+// Slack renders the document as Slack mrkdwn. Headings are bold, nested
+// lists are indented, and tables and code blocks are preformatted since
+// mrkdwn has neither tables nor languages.
+func Slack(doc *Node) string {
+	r := &lineRenderer{
+		inline: slackInlines,
+		heading: func(_ int, text string) string {
+			return "*" + text + "*"
+		},
+		plainHeadings: true,
+		bullet: func(depth int) string {
+			if depth > 0 {
+				return "◦ "
+			}
+			return "• "
+		},
+		quote: "> ",
+		code: func(_, code string) string {
+			return "```\n" + slackEscape(code) + "\n```"
+		},
+		table: func(rows [][]string, align []string) string {
+			return "```\n" + slackEscape(alignColumns(rows, align)) + "\n```"
+		},
+		rule:   "───",
+		escape: slackEscape,
+	}
+	return r.blocks(doc.Children, 0, false)
+}
+
+// lineRenderer renders the blocks of a document as lines of text, the way
+// a target format without nested markup needs it.
+type lineRenderer struct {
+	inline  func(nodes []*Node) string
+	heading func(level int, text string) string
+	// plainHeadings renders the text of headings without its markup.
+	plainHeadings bool
+	bullet        func(depth int) string
+	quote         string
+	code          func(info, code string) string
+	table         func(rows [][]string, align []string) string
+	rule          string
+	// escape escapes the plain text of the format, if it needs it.
+	escape func(string) string
+}
+
+// blocks renders the blocks, separated by blank lines unless tight.
+func (r *lineRenderer) blocks(nodes []*Node, depth int, tight bool) string {
+	var parts []string
+	for _, n := range nodes {
+		if text := r.block(n, depth); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	if tight {
+		return strings.Join(parts, "\n")
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+func (r *lineRenderer) block(n *Node, depth int) string {
+	switch n.Kind {
+	case Paragraph:
+		return r.inline(n.Children)
+	case Heading:
+		if r.plainHeadings {
+			return r.heading(n.Level, r.plain(n.Children))
+		}
+		return r.heading(n.Level, r.inline(n.Children))
+	case CodeBlock:
+		return r.code(n.Info, strings.TrimSuffix(n.Literal, "\n"))
+	case Quote:
+		return prefixLines(r.blocks(n.Children, depth, false), r.quote)
+	case List:
+		items := make([]string, len(n.Children))
+		for i, item := range n.Children {
+			marker := r.bullet(depth)
+			if n.Ordered {
+				marker = strconv.Itoa(n.Start+i) + ". "
+			}
+			body := r.blocks(item.Children, depth+1, n.Tight)
+			items[i] = marker + indentRest(body, strings.Repeat(" ", utf8.RuneCountInString(marker)))
+		}
+		if n.Tight {
+			return strings.Join(items, "\n")
+		}
+		return strings.Join(items, "\n\n")
+	case Table:
+		rows := make([][]string, len(n.Children))
+		for i, row := range n.Children {
+			for _, cell := range row.Children {
+				rows[i] = append(rows[i], plainInlines(cell.Children))
+			}
+		}
+		return r.table(rows, n.Align)
+	case Rule:
+		return r.rule
+	}
+	return ""
+}
+
+// plain returns the text of the inlines without markup, escaped.
+func (r *lineRenderer) plain(nodes []*Node) string {
+	text := plainInlines(nodes)
+	if r.escape != nil {
+		text = r.escape(text)
+	}
+	return strings.ReplaceAll(text, "\n", " ")
+}
+
+// plainInlines returns the text of the inlines without markup; the URL of a
+// link follows its text unless it is the text.
+func plainInlines(nodes []*Node) string {
+	var b strings.Builder
+	for _, n := range nodes {
+		switch n.Kind {
+		case Text, Code:
+			b.WriteString(n.Literal)
+		case SoftBreak, LineBreak:
+			b.WriteByte('\n')
+		case Link:
+			text := plainInlines(n.Children)
+			b.WriteString(text)
+			if !sameURL(text, n.URL) {
+				b.WriteString(" (" + n.URL + ")")
+			}
+		default:
+			b.WriteString(plainInlines(n.Children))
+		}
+	}
+	return b.String()
+}
+
+// slackInlines renders the inlines as mrkdwn.
+func slackInlines(nodes []*Node) string {
+	var b strings.Builder
+	for _, n := range nodes {
+		switch n.Kind {
+		case Text:
+			b.WriteString(slackEscape(n.Literal))
+		case Code:
+			b.WriteString("`" + slackEscape(n.Literal) + "`")
+		case Emphasis:
+			b.WriteString("_" + slackInlines(n.Children) + "_")
+		case Strong:
+			b.WriteString("*" + slackInlines(n.Children) + "*")
+		case Strike:
+			b.WriteString("~" + slackInlines(n.Children) + "~")
+		case Link, Image:
+			// The text of a link cannot hold markup.
+			text := strings.ReplaceAll(plainInlines(n.Children), "\n", " ")
+			switch {
+			case !safeURL(n.URL):
+				b.WriteString(slackEscape(text))
+			case n.Kind == Link && sameURL(text, n.URL) || text == "":
+				b.WriteString("<" + slackURL(n.URL) + ">")
+			default:
+				b.WriteString("<" + slackURL(n.URL) + "|" + slackEscape(text) + ">")
+			}
+		case SoftBreak, LineBreak:
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// slackEscape escapes the characters of the text that mrkdwn reserves.
+func slackEscape(text string) string {
+	return slackEscaper.Replace(text)
+}
+
+var slackURLEscaper = strings.NewReplacer("|", "%7C", ">", "%3E", "<", "%3C", " ", "%20")
+
+func slackURL(url string) string {
+	return slackURLEscaper.Replace(url)
+}
+
+// sameURL reports whether the text of a link is its URL, as in autolinks.
+func sameURL(text, url string) bool {
+	return text == url || "mailto:"+text == url
+}
+
+// alignColumns renders the rows as columns of aligned text, with a line of
+// dashes under the header.
+func alignColumns(rows [][]string, align []string) string {
+	// Every column is at least one dash wide, so the delimiter row counts too.
+	widths := make([]int, len(align))
+	for i := range widths {
+		widths[i] = 1
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			cell = strings.ReplaceAll(cell, "\n", " ")
+			row[i] = cell
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+	var lines []string
+	line := func(cells []string) {
+		var b strings.Builder
+		for i, cell := range cells {
+			if i > 0 {
+				b.WriteString("  ")
+			}
+			pad := max(widths[i]-utf8.RuneCountInString(cell), 0)
+			switch align[i] {
+			case "right":
+				b.WriteString(strings.Repeat(" ", pad) + cell)
+			case "center":
+				b.WriteString(strings.Repeat(" ", pad/2) + cell + strings.Repeat(" ", pad-pad/2))
+			default:
+				b.WriteString(cell + strings.Repeat(" ", pad))
+			}
+		}
+		lines = append(lines, strings.TrimRight(b.String(), " "))
+	}
+	for i, row := range rows {
+		line(row)
+		if i == 0 {
+			dashes := make([]string, len(widths))
+			for c, w := range widths {
+				dashes[c] = strings.Repeat("-", w)
+			}
+			line(dashes)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// prefixLines prefixes the lines of the text, trimming the prefix of blank ones.
+func prefixLines(text, prefix string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(prefix+line, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// indentRest indents the lines of the text after the first one.
+func indentRest(text, indent string) string {
+	first, rest, ok := strings.Cut(text, "\n")
+	if !ok {
+		return text
+	}
+	return first + "\n" + prefixLines(rest, indent)
+}
@@ -0,0 +1,37 @@
+// Package panics converts panics in user handlers into errors.
+package panics
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// Error is a panic recovered from a handler.
+type Error struct {
+	// Scope is the kind of handler, e.g. "node", "tool" or "middleware".
+	Scope string
+	// Name is the name of the node, tool or agent.
+	Name string
+	// Value is the value passed to panic.
+	Value any
+	// Stack is the stack trace of the goroutine that panicked.
+	Stack []byte
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s %s panicked: %v", e.Scope, e.Name, e.Value)
+}
+
+// Unwrap returns the panic value if it is an error.
+func (e *Error) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// Recover stores a panic of the calling function in err as an *Error.
+// It must be deferred directly.
+func Recover(scope, name string, err *error) {
+	if v := recover(); v != nil {
+		*err = &Error{Scope: scope, Name: name, Value: v, Stack: debug.Stack()}
+	}
+}
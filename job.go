@@ -0,0 +1,395 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// JobStatus is the lifecycle state of a background job.
+type JobStatus string
+
+const (
+	// JobQueued indicates the job waits for a free worker.
+	JobQueued JobStatus = "queued"
+	// JobRunning indicates the job is running.
+	JobRunning JobStatus = "running"
+	// JobCompleted indicates the job finished with a result.
+	JobCompleted JobStatus = "completed"
+	// JobFailed indicates the job ended with an error.
+	JobFailed JobStatus = "failed"
+	// JobCancelled indicates the job was cancelled before completing.
+	JobCancelled JobStatus = "cancelled"
+)
+
+// JobStateKey is the session state key holding the record of the session's job.
+const JobStateKey = "blades.job"
+
+// Job is the record of a background run. It is stored in the state of the
+// session the job runs in, so it survives restarts with a persistent SessionStore.
+type Job struct {
+	ID           string    `json:"id"`
+	InvocationID string    `json:"invocationId"`
+	Status       JobStatus `json:"status"`
+	Error        string    `json:"error,omitempty"`
+	Result       *Message  `json:"result,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+	// Messages are the messages produced so far; they are read from the session
+	// history and not stored in the record.
+	Messages []*Message `json:"-"`
+}
+
+// finished reports whether the job reached a terminal status.
+func (j *Job) finished() bool {
+	return j.Status == JobCompleted || j.Status == JobFailed || j.Status == JobCancelled
+}
+
+// JobRunnerOption defines options for configuring the JobRunner.
+type JobRunnerOption func(*JobRunner)
+
+// WithJobStore sets the store that persists job sessions. Defaults to an InMemorySessionStore.
+func WithJobStore(store SessionStore) JobRunnerOption {
+	return func(r *JobRunner) {
+		r.store = store
+	}
+}
+
+// WithJobWorkers sets the number of jobs that run concurrently; further jobs are queued. Defaults to 4.
+func WithJobWorkers(n int) JobRunnerOption {
+	return func(r *JobRunner) {
+		if n > 0 {
+			r.workers = make(chan struct{}, n)
+		}
+	}
+}
+
+// WithJobRetention sets how long finished jobs are kept before their sessions
+// are deleted from the store. Zero, the default, keeps them forever.
+func WithJobRetention(retention time.Duration) JobRunnerOption {
+	return func(r *JobRunner) {
+		r.retention = retention
+	}
+}
+
+// JobRunner runs agents in the background. A job is identified by the ID of
+// the session it runs in, so a session holds at most one active job; submitting
+// again on the session of a finished job replaces its record.
+type JobRunner struct {
+	runner    *Runner
+	store     SessionStore
+	workers   chan struct{}
+	retention time.Duration
+	mu        sync.Mutex
+	jobs      map[string]*liveJob
+	draining  bool
+}
+
+// NewJobRunner creates a new JobRunner that runs jobs with the given Runner.
+func NewJobRunner(runner *Runner, opts ...JobRunnerOption) *JobRunner {
+	r := &JobRunner{
+		runner:  runner,
+		store:   NewInMemorySessionStore(),
+		workers: make(chan struct{}, 4),
+		jobs:    make(map[string]*liveJob),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// liveJob is a job that is queued or running in this process.
+type liveJob struct {
+	mu       sync.Mutex
+	job      Job
+	session  Session
+	priority Priority
+	messages []*Message
+	err      error
+	done     bool
+	cancel   context.CancelCauseFunc
+	updated  chan struct{}
+	// saved is closed once the final status is stored.
+	saved chan struct{}
+}
+
+// update applies fn under the lock and wakes up the subscribers.
+func (j *liveJob) update(fn func()) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	fn()
+	close(j.updated)
+	j.updated = make(chan struct{})
+}
+
+// Submit queues a run of the root agent with the message and returns the job ID.
+// The job keeps running after ctx is done; use Cancel to stop it. Jobs wait
+// for a slot of the Limiter of the Runner with PriorityLow unless WithPriority
+// is given.
+func (r *JobRunner) Submit(ctx context.Context, message *Message, opts ...RunOption) (string, error) {
+	o := &RunOptions{Priority: PriorityLow}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.Session == nil {
+		o.Session = NewSession()
+	}
+	if o.InvocationID == "" {
+		o.InvocationID = NewInvocationID()
+	}
+	now := time.Now()
+	// The job is cancellable, e.g. by Drain, as soon as it is registered.
+	runCtx, cancel := context.WithCancelCause(context.WithoutCancel(ctx))
+	j := &liveJob{
+		job: Job{
+			ID:           o.Session.ID(),
+			InvocationID: o.InvocationID,
+			Status:       JobQueued,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+		session:  o.Session,
+		priority: o.Priority,
+		cancel:   cancel,
+		updated:  make(chan struct{}),
+		saved:    make(chan struct{}),
+	}
+	r.mu.Lock()
+	if r.draining {
+		r.mu.Unlock()
+		cancel(nil)
+		return "", fmt.Errorf("job runner: submit %s: %w", j.job.ID, ErrRunnerDraining)
+	}
+	if _, ok := r.jobs[j.job.ID]; ok {
+		r.mu.Unlock()
+		cancel(nil)
+		return "", fmt.Errorf("job runner: submit %s: %w", j.job.ID, ErrJobActive)
+	}
+	r.jobs[j.job.ID] = j
+	r.mu.Unlock()
+	if err := r.save(ctx, j); err != nil {
+		cancel(nil)
+		r.remove(j.job.ID)
+		// A concurrent Drain may wait for the job.
+		close(j.saved)
+		return "", err
+	}
+	go r.run(runCtx, j, message)
+	return j.job.ID, nil
+}
+
+// run waits for a worker and runs the job to completion.
+func (r *JobRunner) run(ctx context.Context, j *liveJob, message *Message) {
+	defer j.cancel(nil)
+	select {
+	case r.workers <- struct{}{}:
+		defer func() { <-r.workers }()
+	case <-ctx.Done():
+	}
+	// A job cancelled while queued does not start, even when a worker is free.
+	if ctx.Err() != nil {
+		r.finish(j, nil, context.Cause(ctx))
+		return
+	}
+	j.update(func() {
+		j.job.Status = JobRunning
+		j.job.UpdatedAt = time.Now()
+	})
+	if err := r.save(ctx, j); err != nil {
+		r.finish(j, nil, err)
+		return
+	}
+	var (
+		last *Message
+		err  error
+	)
+	for m, e := range r.runner.RunStream(ctx, message, WithSession(j.session), WithInvocationID(j.job.InvocationID), WithPriority(j.priority)) {
+		if e != nil {
+			err = e
+			break
+		}
+		last = m
+		j.update(func() {
+			j.messages = append(j.messages, m)
+			j.job.UpdatedAt = time.Now()
+		})
+	}
+	r.finish(j, last, err)
+}
+
+// finish records the terminal status of the job, persists it and releases it from memory.
+func (r *JobRunner) finish(j *liveJob, last *Message, err error) {
+	j.update(func() {
+		switch {
+		case errors.Is(err, ErrInvocationCancelled) || (last != nil && last.Status == StatusCancelled):
+			j.job.Status = JobCancelled
+		case err != nil:
+			j.job.Status = JobFailed
+			j.job.Error = err.Error()
+		case last == nil:
+			j.job.Status = JobFailed
+			j.job.Error = ErrNoFinalResponse.Error()
+		default:
+			j.job.Status = JobCompleted
+			j.job.Result = last
+		}
+		j.job.UpdatedAt = time.Now()
+		j.err = err
+		j.done = true
+	})
+	ctx := context.Background()
+	if err := r.save(ctx, j); err != nil {
+		j.update(func() {
+			j.err = err
+		})
+	}
+	r.remove(j.job.ID)
+	close(j.saved)
+	if r.retention > 0 {
+		time.AfterFunc(r.retention, func() {
+			r.store.Delete(ctx, j.job.ID)
+		})
+	}
+}
+
+// save stores the job record in its session and the session in the store.
+func (r *JobRunner) save(ctx context.Context, j *liveJob) error {
+	j.mu.Lock()
+	job := j.job
+	j.mu.Unlock()
+	j.session.SetState(JobStateKey, job)
+	if err := r.store.Save(ctx, j.session); err != nil {
+		return fmt.Errorf("job runner: save %s: %w", job.ID, err)
+	}
+	return nil
+}
+
+func (r *JobRunner) remove(jobID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.jobs, jobID)
+}
+
+func (r *JobRunner) live(jobID string) (*liveJob, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	j, ok := r.jobs[jobID]
+	return j, ok
+}
+
+// Status returns the job record with the messages produced so far.
+// A job that is neither finished nor active in this runner, e.g. after a
+// restart, is reported as failed with ErrJobInterrupted.
+func (r *JobRunner) Status(ctx context.Context, jobID string) (*Job, error) {
+	if j, ok := r.live(jobID); ok {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		job := j.job
+		job.Messages = jobMessages(j.session, job.InvocationID)
+		return &job, nil
+	}
+	session, err := r.store.Load(ctx, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("job runner: status %s: %w", jobID, ErrJobNotFound)
+	}
+	job, ok := DecodeState[Job](session.State()[JobStateKey])
+	if !ok {
+		return nil, fmt.Errorf("job runner: status %s: %w", jobID, ErrJobNotFound)
+	}
+	if !job.finished() {
+		job.Status = JobFailed
+		job.Error = ErrJobInterrupted.Error()
+	}
+	job.Messages = jobMessages(session, job.InvocationID)
+	return &job, nil
+}
+
+// Result returns the final message of a completed job. It returns
+// ErrJobNotFinished while the job is queued or running.
+func (r *JobRunner) Result(ctx context.Context, jobID string) (*Message, error) {
+	job, err := r.Status(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+	switch job.Status {
+	case JobCompleted:
+		return job.Result, nil
+	case JobCancelled:
+		return nil, fmt.Errorf("job runner: result %s: %w", jobID, ErrInvocationCancelled)
+	case JobFailed:
+		return nil, fmt.Errorf("job runner: result %s: %w: %s", jobID, ErrJobFailed, job.Error)
+	default:
+		return nil, fmt.Errorf("job runner: result %s: %w", jobID, ErrJobNotFinished)
+	}
+}
+
+// Cancel cancels a queued or running job and reports whether it was active.
+func (r *JobRunner) Cancel(jobID string) bool {
+	j, ok := r.live(jobID)
+	if ok {
+		j.cancel(ErrInvocationCancelled)
+	}
+	return ok
+}
+
+// Subscribe streams the messages of the job. For an active job it yields the
+// messages produced so far and then follows the live stream; for a finished
+// job it replays the messages recorded in its session.
+func (r *JobRunner) Subscribe(ctx context.Context, jobID string) Generator[*Message, error] {
+	return func(yield func(*Message, error) bool) {
+		j, ok := r.live(jobID)
+		if !ok {
+			job, err := r.Status(ctx, jobID)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			for _, m := range job.Messages {
+				if !yield(m, nil) {
+					return
+				}
+			}
+			if job.Status == JobFailed {
+				yield(nil, fmt.Errorf("job runner: subscribe %s: %w: %s", jobID, ErrJobFailed, job.Error))
+			}
+			return
+		}
+		for i := 0; ; {
+			j.mu.Lock()
+			messages, done, err, updated := j.messages[i:], j.done, j.err, j.updated
+			j.mu.Unlock()
+			for _, m := range messages {
+				if !yield(m, nil) {
+					return
+				}
+			}
+			i += len(messages)
+			if done {
+				if err != nil && !errors.Is(err, ErrInvocationCancelled) {
+					yield(nil, err)
+				}
+				return
+			}
+			select {
+			case <-updated:
+			case <-ctx.Done():
+				yield(nil, ctx.Err())
+				return
+			}
+		}
+	}
+}
+
+// jobMessages returns the messages of the invocation and its sub-agents recorded in the session.
+func jobMessages(session Session, invocationID string) []*Message {
+	var messages []*Message
+	for _, m := range session.History() {
+		if m.Role != RoleUser && isInvocationOrChild(m.InvocationID, invocationID) {
+			messages = append(messages, m)
+		}
+	}
+	return messages
+}
@@ -0,0 +1,163 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestJobRunner(t *testing.T) {
+	release := make(chan struct{})
+	model := &mockModel{
+		generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+			select {
+			case <-release:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			return textResponse("done: " + req.Messages[len(req.Messages)-1].Text()), nil
+		},
+	}
+	agent, err := NewAgent("worker", WithModel(model))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewInMemorySessionStore()
+	jobs := NewJobRunner(NewRunner(agent), WithJobStore(store), WithJobWorkers(1))
+	ctx := context.Background()
+
+	first, err := jobs.Submit(ctx, UserMessage("first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitJobStatus(t, jobs, first, JobRunning)
+	session := NewSession()
+	second, err := jobs.Submit(ctx, UserMessage("second"), WithSession(session))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jobs.Submit(ctx, UserMessage("again"), WithSession(session)); !errors.Is(err, ErrJobActive) {
+		t.Fatalf("expected ErrJobActive, got %v", err)
+	}
+	if _, err := jobs.Result(ctx, first); !errors.Is(err, ErrJobNotFinished) {
+		t.Fatalf("expected ErrJobNotFinished, got %v", err)
+	}
+	// With a single worker the second job waits in the queue and can be cancelled there.
+	if job, err := jobs.Status(ctx, second); err != nil || job.Status != JobQueued {
+		t.Fatalf("expected the second job to be queued, got %+v, %v", job, err)
+	}
+	if !jobs.Cancel(second) {
+		t.Fatal("expected the queued job to be cancellable")
+	}
+	waitJobStatus(t, jobs, second, JobCancelled)
+
+	done := make(chan []*Message)
+	go func() {
+		var messages []*Message
+		for m, err := range jobs.Subscribe(ctx, first) {
+			if err != nil {
+				t.Error(err)
+			}
+			messages = append(messages, m)
+		}
+		done <- messages
+	}()
+	close(release)
+	if messages := <-done; len(messages) != 1 || messages[0].Text() != "done: first" {
+		t.Fatalf("unexpected live messages: %v", messages)
+	}
+	result, err := jobs.Result(ctx, first)
+	if err != nil || result.Text() != "done: first" {
+		t.Fatalf("unexpected result %v, %v", result, err)
+	}
+	// A finished job is replayed from its session.
+	var replayed []*Message
+	for m, err := range jobs.Subscribe(ctx, first) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		replayed = append(replayed, m)
+	}
+	if len(replayed) != 1 || replayed[0].ID != result.ID {
+		t.Fatalf("unexpected replayed messages: %v", replayed)
+	}
+
+	// A job left running by a previous process is reported as interrupted.
+	stale := NewSession(map[string]any{JobStateKey: Job{ID: "stale", Status: JobRunning}})
+	if err := store.Save(ctx, stale); err != nil {
+		t.Fatal(err)
+	}
+	restarted := NewJobRunner(NewRunner(agent), WithJobStore(store))
+	if job, err := restarted.Status(ctx, stale.ID()); err != nil || job.Status != JobFailed || job.Error != ErrJobInterrupted.Error() {
+		t.Fatalf("expected an interrupted job, got %+v, %v", job, err)
+	}
+	if job, err := restarted.Status(ctx, first); err != nil || job.Status != JobCompleted {
+		t.Fatalf("expected the completed job to survive a restart, got %+v, %v", job, err)
+	}
+	// A store that keeps sessions as JSON hands the record back as a map.
+	persisted, err := store.Load(ctx, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ExportSession(persisted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, err := ImportSession(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(ctx, imported); err != nil {
+		t.Fatal(err)
+	}
+	if job, err := restarted.Status(ctx, first); err != nil || job.Status != JobCompleted || job.Result.Text() != "done: first" {
+		t.Fatalf("expected the decoded job to survive a restart, got %+v, %v", job, err)
+	}
+}
+
+func TestJobRunnerRetention(t *testing.T) {
+	model := &mockModel{
+		generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+			return textResponse("ok"), nil
+		},
+	}
+	agent, err := NewAgent("worker", WithModel(model))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs := NewJobRunner(NewRunner(agent), WithJobRetention(time.Millisecond))
+	id, err := jobs.Submit(context.Background(), UserMessage("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		_, err := jobs.Status(context.Background(), id)
+		if errors.Is(err, ErrJobNotFound) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the job to expire, got %v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func waitJobStatus(t *testing.T, jobs *JobRunner, id string, status JobStatus) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		job, err := jobs.Status(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status == status {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected job status %s, got %s", status, job.Status)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
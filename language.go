@@ -0,0 +1,78 @@
+package blades
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// LanguageStateKey is the session state key of the BCP-47 tag of the language
+// the agents respond in, set by the language detection middleware.
+const LanguageStateKey = "blades.language"
+
+// languageTag matches the language, script and region subtags of a BCP-47 tag.
+var languageTag = regexp.MustCompile(`^(?i)[a-z]{2,3}(-[a-z]{4})?(-([a-z]{2}|[0-9]{3}))?(-[a-z0-9]{5,8}|-[0-9][a-z0-9]{3})*$`)
+
+// languageNames are the English names of common languages, used in the directive.
+var languageNames = map[string]string{
+	"ar": "Arabic", "bn": "Bengali", "cs": "Czech", "da": "Danish", "de": "German",
+	"el": "Greek", "en": "English", "es": "Spanish", "fa": "Persian", "fi": "Finnish",
+	"fr": "French", "he": "Hebrew", "hi": "Hindi", "hu": "Hungarian", "id": "Indonesian",
+	"it": "Italian", "ja": "Japanese", "ko": "Korean", "ms": "Malay", "nl": "Dutch",
+	"no": "Norwegian", "pl": "Polish", "pt": "Portuguese", "ro": "Romanian", "ru": "Russian",
+	"sv": "Swedish", "th": "Thai", "tr": "Turkish", "uk": "Ukrainian", "vi": "Vietnamese",
+	"zh": "Chinese", "zh-hans": "Simplified Chinese", "zh-hant": "Traditional Chinese",
+}
+
+// WithLanguage makes the Agent respond in the language of the BCP-47 tag,
+// e.g. "es" or "pt-BR", by appending LanguageDirective to its instruction.
+func WithLanguage(tag string) AgentOption {
+	return func(a *agent) {
+		a.language = tag
+	}
+}
+
+// LanguageDirective returns the instruction that makes a model respond in the
+// language of the BCP-47 tag, whatever the language of the conversation.
+func LanguageDirective(tag string) (string, error) {
+	if !languageTag.MatchString(tag) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidLanguageTag, tag)
+	}
+	name := tag
+	lower := strings.ToLower(tag)
+	for _, key := range []string{lower, strings.SplitN(lower, "-", 2)[0]} {
+		if n, ok := languageNames[key]; ok {
+			name = fmt.Sprintf("%s (%s)", n, tag)
+			break
+		}
+	}
+	return fmt.Sprintf("Always respond in %s. Keep using it even if the user, the tools or the documents "+
+		"switch to another language, unless the user explicitly asks you to change the response language. "+
+		"Keep code, identifiers and quoted text in their original language.", name), nil
+}
+
+// SessionLanguage returns the language tag stored in the session state under
+// LanguageStateKey. It reports false when none is set or the value is not a
+// BCP-47 tag.
+func SessionLanguage(session Session) (string, bool) {
+	tag, ok := session.State()[LanguageStateKey].(string)
+	if !ok || !languageTag.MatchString(tag) {
+		return "", false
+	}
+	return tag, true
+}
+
+// AppendLanguageDirective appends the directive for the tag to the invocation
+// instruction, after any instruction rendered by the agent.
+func AppendLanguageDirective(invocation *Invocation, tag string) error {
+	directive, err := LanguageDirective(tag)
+	if err != nil {
+		return err
+	}
+	instruction := SystemMessage[string]()
+	if invocation.Instruction != nil {
+		instruction = MergeParts(instruction, invocation.Instruction)
+	}
+	invocation.Instruction = MergeParts(instruction, SystemMessage(directive))
+	return nil
+}
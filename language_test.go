@@ -0,0 +1,92 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestAgentLanguage(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []AgentOption
+		state    State
+		want     []string
+		wantErr  error
+		notFound string
+	}{
+		{
+			name:  "appended after the instruction",
+			opts:  []AgentOption{WithInstruction("You help {{.user}}."), WithLanguage("es")},
+			state: State{"user": "Ana"},
+			want:  []string{"You help Ana.", "Always respond in Spanish (es)."},
+		},
+		{
+			name: "regional tag",
+			opts: []AgentOption{WithLanguage("pt-BR")},
+			want: []string{"Always respond in Portuguese (pt-BR)."},
+		},
+		{
+			name:  "session language",
+			state: State{LanguageStateKey: "ja"},
+			want:  []string{"Always respond in Japanese (ja)."},
+		},
+		{
+			name:     "option wins over the session",
+			opts:     []AgentOption{WithLanguage("de")},
+			state:    State{LanguageStateKey: "fr"},
+			want:     []string{"Always respond in German (de)."},
+			notFound: "French",
+		},
+		{
+			name:     "invalid session language ignored",
+			opts:     []AgentOption{WithInstruction("You help.")},
+			state:    State{LanguageStateKey: "not a tag"},
+			want:     []string{"You help."},
+			notFound: "Always respond",
+		},
+		{
+			name:    "invalid tag",
+			opts:    []AgentOption{WithLanguage("not a tag")},
+			wantErr: ErrInvalidLanguageTag,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var instruction string
+			model := &mockModel{
+				generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+					instruction = req.Instruction.Text()
+					return textResponse("ok"), nil
+				},
+			}
+			agent, err := NewAgent("polyglot", append([]AgentOption{WithModel(model)}, tt.opts...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			session := NewSession(tt.state)
+			_, err = NewRunner(agent).Run(context.Background(), UserMessage("hi"), WithSession(session))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("want %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			last := -1
+			for _, want := range tt.want {
+				i := strings.Index(instruction, want)
+				if i <= last {
+					t.Fatalf("want %q in order in %q", tt.want, instruction)
+				}
+				last = i
+			}
+			if tt.notFound != "" && strings.Contains(instruction, tt.notFound) {
+				t.Fatalf("want no %q in %q", tt.notFound, instruction)
+			}
+		})
+	}
+}
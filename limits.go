@@ -0,0 +1,178 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Limits are hard caps on the resources of one invocation, including the
+// sub-agents, loops and graph nodes it runs. Zero fields are unlimited.
+type Limits struct {
+	// MaxTotalTokens caps the tokens reported by all model calls.
+	MaxTotalTokens int64
+	// MaxToolCalls caps the number of tool calls.
+	MaxToolCalls int64
+	// MaxWallTime caps the time from the start of the run.
+	MaxWallTime time.Duration
+	// MaxSubAgentDepth caps the nesting of sub-agents; the root agent is at depth 0.
+	MaxSubAgentDepth int
+}
+
+// Limit names a field of Limits.
+type Limit string
+
+const (
+	// LimitTotalTokens is the MaxTotalTokens limit.
+	LimitTotalTokens Limit = "max_total_tokens"
+	// LimitToolCalls is the MaxToolCalls limit.
+	LimitToolCalls Limit = "max_tool_calls"
+	// LimitWallTime is the MaxWallTime limit.
+	LimitWallTime Limit = "max_wall_time"
+	// LimitSubAgentDepth is the MaxSubAgentDepth limit.
+	LimitSubAgentDepth Limit = "max_sub_agent_depth"
+	// LimitInputChars caps the characters of the text of a user message.
+	LimitInputChars Limit = "max_input_chars"
+	// LimitInputParts caps the number of parts of a user message.
+	LimitInputParts Limit = "max_input_parts"
+	// LimitInputPartBytes caps the size of a part of a user message.
+	LimitInputPartBytes Limit = "max_input_part_bytes"
+)
+
+// LimitError is returned when an invocation exceeds one of its Limits.
+// It unwraps to ErrLimitExceeded.
+type LimitError struct {
+	Limit Limit
+	// Agent is the agent that exceeded the limit.
+	Agent string
+	// Max and Used are the limit and the usage that exceeded it; for
+	// LimitWallTime they are durations.
+	Max  int64
+	Used int64
+}
+
+func (e *LimitError) Error() string {
+	if e.Limit == LimitWallTime {
+		return fmt.Sprintf("agent %s: %s: %s > %s", e.Agent, e.Limit, time.Duration(e.Used), time.Duration(e.Max))
+	}
+	return fmt.Sprintf("agent %s: %s: %d > %d", e.Agent, e.Limit, e.Used, e.Max)
+}
+
+// Unwrap returns ErrLimitExceeded.
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// WithLimits sets the limits enforced on every run of the Runner.
+func WithLimits(limits Limits) RunnerOption {
+	return func(r *Runner) {
+		r.limits = limits
+	}
+}
+
+// budget tracks the usage of one run against its limits.
+type budget struct {
+	limits    Limits
+	started   time.Time
+	tokens    atomic.Int64
+	toolCalls atomic.Int64
+}
+
+// ctxBudgetKey is the context key for the budget of a run.
+type ctxBudgetKey struct{}
+
+// withLimits returns a context that enforces the limits, unless ctx already
+// belongs to a run with limits, in which case the outer run's budget applies.
+func withLimits(ctx context.Context, agent string, limits Limits) (context.Context, context.CancelFunc) {
+	if limits == (Limits{}) {
+		return ctx, func() {}
+	}
+	if _, ok := ctx.Value(ctxBudgetKey{}).(*budget); ok {
+		return ctx, func() {}
+	}
+	b := &budget{limits: limits, started: time.Now()}
+	ctx = context.WithValue(ctx, ctxBudgetKey{}, b)
+	if limits.MaxWallTime > 0 {
+		// The deadline interrupts model and tool calls that are in progress.
+		return context.WithTimeoutCause(ctx, limits.MaxWallTime, &LimitError{
+			Limit: LimitWallTime,
+			Agent: agent,
+			Max:   int64(limits.MaxWallTime),
+			Used:  int64(limits.MaxWallTime),
+		})
+	}
+	return ctx, func() {}
+}
+
+// CheckLimits returns a *LimitError if the run of ctx has exceeded its limits.
+// Agents check it before every model call; flows and graphs check it between
+// iterations. The invocation, which may be nil, is used to check the depth.
+func CheckLimits(ctx context.Context, agent string, invocation *Invocation) error {
+	b, ok := ctx.Value(ctxBudgetKey{}).(*budget)
+	if !ok {
+		return nil
+	}
+	l := b.limits
+	if used := time.Since(b.started); l.MaxWallTime > 0 && used > l.MaxWallTime {
+		return &LimitError{Limit: LimitWallTime, Agent: agent, Max: int64(l.MaxWallTime), Used: int64(used)}
+	}
+	if used := b.tokens.Load(); l.MaxTotalTokens > 0 && used > l.MaxTotalTokens {
+		return &LimitError{Limit: LimitTotalTokens, Agent: agent, Max: l.MaxTotalTokens, Used: used}
+	}
+	if used := b.toolCalls.Load(); l.MaxToolCalls > 0 && used > l.MaxToolCalls {
+		return &LimitError{Limit: LimitToolCalls, Agent: agent, Max: l.MaxToolCalls, Used: used}
+	}
+	if invocation != nil && l.MaxSubAgentDepth > 0 && invocation.depth > l.MaxSubAgentDepth {
+		return &LimitError{Limit: LimitSubAgentDepth, Agent: agent, Max: int64(l.MaxSubAgentDepth), Used: int64(invocation.depth)}
+	}
+	return nil
+}
+
+// spendTokens records the token usage of a model response and checks the token limit.
+func spendTokens(ctx context.Context, agent string, usage TokenUsage) error {
+	b, ok := ctx.Value(ctxBudgetKey{}).(*budget)
+	if !ok {
+		return nil
+	}
+	tokens := usage.TotalTokens
+	if tokens == 0 {
+		tokens = usage.InputTokens + usage.OutputTokens
+	}
+	used := b.tokens.Add(tokens)
+	if max := b.limits.MaxTotalTokens; max > 0 && used > max {
+		return &LimitError{Limit: LimitTotalTokens, Agent: agent, Max: max, Used: used}
+	}
+	return nil
+}
+
+// spendToolCalls records the tool calls requested by a model response before
+// they run, and checks the tool call limit.
+func spendToolCalls(ctx context.Context, agent string, message *Message) error {
+	b, ok := ctx.Value(ctxBudgetKey{}).(*budget)
+	if !ok {
+		return nil
+	}
+	var calls int64
+	for _, part := range message.Parts {
+		if _, ok := part.(ToolPart); ok {
+			calls++
+		}
+	}
+	used := b.toolCalls.Add(calls)
+	if max := b.limits.MaxToolCalls; max > 0 && used > max {
+		return &LimitError{Limit: LimitToolCalls, Agent: agent, Max: max, Used: used}
+	}
+	return nil
+}
+
+// limitCause returns the LimitError that cancelled ctx in place of err, so
+// that a call interrupted by the wall time limit reports the limit.
+func limitCause(ctx context.Context, err error) error {
+	var limitErr *LimitError
+	if errors.As(context.Cause(ctx), &limitErr) {
+		return limitErr
+	}
+	return err
+}
@@ -19,6 +19,11 @@ func NewInMemoryStore() *InMemoryStore {
 	return &InMemoryStore{}
 }
 
+// Check implements blades.Checkable; an in-memory store is always available.
+func (s *InMemoryStore) Check(ctx context.Context) error {
+	return nil
+}
+
 // AddMemory adds a new memory to the in-memory store.
 func (s *InMemoryStore) AddMemory(ctx context.Context, m *Memory) error {
 	s.m.Lock()
@@ -32,7 +37,7 @@ func (s *InMemoryStore) SaveSession(ctx context.Context, session blades.Session)
 	s.m.Lock()
 	defer s.m.Unlock()
 	for _, m := range session.History() {
-		s.AddMemory(ctx, &Memory{Content: m})
+		s.memories = append(s.memories, &Memory{Content: m})
 	}
 	return nil
 }
@@ -3,6 +3,7 @@ package memory
 import (
 	"context"
 
+	"github.com/go-kratos/blades"
 	"github.com/go-kratos/blades/tools"
 )
 
@@ -16,9 +17,23 @@ type Response struct {
 	Memories []*Memory `json:"memories" jsonschema:"The memories found for the query."`
 }
 
+// memoryTool is the memory tool; it checks the health of its store.
+type memoryTool struct {
+	tools.Tool
+	store MemoryStore
+}
+
+// Check pings the store if it implements blades.Checkable.
+func (t *memoryTool) Check(ctx context.Context) error {
+	if checkable, ok := t.store.(blades.Checkable); ok {
+		return checkable.Check(ctx)
+	}
+	return nil
+}
+
 // NewMemoryTool creates a new memory tool with the given memory store.
 func NewMemoryTool(store MemoryStore) (tools.Tool, error) {
-	return tools.NewFunc[Request, Response](
+	tool, err := tools.NewFunc[Request, Response](
 		"Memory",
 		"You have memory. You can use it to answer questions. If any questions need you to look up the memory.",
 		func(ctx context.Context, req Request) (Response, error) {
@@ -29,4 +44,8 @@ func NewMemoryTool(store MemoryStore) (tools.Tool, error) {
 			return Response{Memories: memories}, nil
 		},
 	)
+	if err != nil {
+		return nil, err
+	}
+	return &memoryTool{Tool: tool, store: store}, nil
 }
@@ -2,8 +2,12 @@ package blades
 
 import (
 	"fmt"
+	"maps"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/go-kratos/blades/stream"
 	"github.com/google/uuid"
 )
 
@@ -15,6 +19,10 @@ const (
 	RoleUser Role = "user"
 	// RoleSystem provides system-level instructions.
 	RoleSystem Role = "system"
+	// RoleDeveloper provides instructions from the application developer, which
+	// newer OpenAI models take in place of system instructions. Providers
+	// without a developer role treat it as RoleSystem.
+	RoleDeveloper Role = "developer"
 	// RoleAssistant is the model output.
 	RoleAssistant Role = "assistant"
 	// RoleTool indicates a message generated by a tool.
@@ -31,6 +39,33 @@ const (
 	StatusIncomplete Status = "incomplete"
 	// StatusCompleted indicates the message is fully generated.
 	StatusCompleted Status = "completed"
+	// StatusCancelled indicates the invocation was cancelled by the user before completing.
+	StatusCancelled Status = "cancelled"
+	// StatusFailed indicates the invocation ended with an error; see Message.Error.
+	StatusFailed Status = "failed"
+	// StatusNeedsInput indicates the invocation paused until the user answers
+	// the question of the message; see NeedsInputError.
+	StatusNeedsInput Status = "needs_input"
+)
+
+// FinishReason is the reason the model stopped generating a response.
+// Providers map their own reasons to these values; reasons without a
+// counterpart are reported as they are.
+type FinishReason string
+
+const (
+	// FinishReasonStop indicates a complete answer or a stop sequence.
+	FinishReasonStop FinishReason = "stop"
+	// FinishReasonLength indicates a response cut off by the output token limit.
+	FinishReasonLength FinishReason = "length"
+	// FinishReasonToolCalls indicates a response that calls tools.
+	FinishReasonToolCalls FinishReason = "tool_calls"
+	// FinishReasonContentFilter indicates a response blocked or cut off by the
+	// provider's content filter or safety settings.
+	FinishReasonContentFilter FinishReason = "content_filter"
+	// FinishReasonRefusal indicates that the model declined to answer. The
+	// refusal, if the provider returns one, is the text of the message.
+	FinishReasonRefusal FinishReason = "refusal"
 )
 
 // TextPart is plain text content.
@@ -50,6 +85,8 @@ type DataPart struct {
 	Name     string   `json:"name"`
 	Bytes    []byte   `json:"bytes"`
 	MIMEType MIMEType `json:"mimeType"`
+	// Preview marks a low-resolution preview streamed before the final data.
+	Preview bool `json:"preview,omitempty"`
 }
 
 // ToolPart is a message generated by a tool, containing request and response.
@@ -60,21 +97,44 @@ type ToolPart struct {
 	Response string `json:"result,omitempty"`
 }
 
+// ReasoningPart is the reasoning a model produced before its answer. It is
+// not part of the message text.
+type ReasoningPart struct {
+	Text string `json:"reasoning"`
+}
+
 // Part is a part of a message, which can be text or a file.
 type Part interface {
 	isPart()
 }
 
-func (TextPart) isPart() {}
-func (FilePart) isPart() {}
-func (DataPart) isPart() {}
-func (ToolPart) isPart() {}
+func (TextPart) isPart()      {}
+func (FilePart) isPart()      {}
+func (DataPart) isPart()      {}
+func (ToolPart) isPart()      {}
+func (ReasoningPart) isPart() {}
 
 // TokenUsage tracks token consumption for a message.
 type TokenUsage struct {
 	InputTokens  int64 `json:"inputTokens"`
 	OutputTokens int64 `json:"outputTokens"`
 	TotalTokens  int64 `json:"totalTokens"`
+	// CachedInputTokens is the part of InputTokens read from the prompt cache,
+	// usually billed at a discounted rate.
+	CachedInputTokens int64 `json:"cachedInputTokens,omitempty"`
+	// CacheWriteInputTokens is the part of InputTokens written to the prompt cache.
+	CacheWriteInputTokens int64 `json:"cacheWriteInputTokens,omitempty"`
+}
+
+// Add returns the sum of the two usages.
+func (u TokenUsage) Add(o TokenUsage) TokenUsage {
+	return TokenUsage{
+		InputTokens:           u.InputTokens + o.InputTokens,
+		OutputTokens:          u.OutputTokens + o.OutputTokens,
+		TotalTokens:           u.TotalTokens + o.TotalTokens,
+		CachedInputTokens:     u.CachedInputTokens + o.CachedInputTokens,
+		CacheWriteInputTokens: u.CacheWriteInputTokens + o.CacheWriteInputTokens,
+	}
 }
 
 // Message represents a single message in a conversation.
@@ -85,10 +145,25 @@ type Message struct {
 	Author       string         `json:"author"`
 	InvocationID string         `json:"invocationId,omitempty"`
 	Status       Status         `json:"status"`
-	FinishReason string         `json:"finishReason,omitempty"`
+	FinishReason FinishReason   `json:"finishReason,omitempty"`
 	TokenUsage   TokenUsage     `json:"tokenUsage,omitempty"`
 	Actions      map[string]any `json:"actions,omitempty"`
 	Metadata     map[string]any `json:"metadata,omitempty"`
+	Error        *ErrorDetail   `json:"error,omitempty"`
+	CreatedAt    time.Time      `json:"createdAt,omitzero"`
+	// Final marks the user-facing answer of a run, as opposed to the
+	// intermediate output of the sub-agents of a flow; see MarkFinal.
+	Final bool `json:"final,omitempty"`
+}
+
+// IsRefusal reports whether the model declined to answer.
+func (m *Message) IsRefusal() bool {
+	return m.FinishReason == FinishReasonRefusal
+}
+
+// IsFiltered reports whether the provider's content filter blocked the response.
+func (m *Message) IsFiltered() bool {
+	return m.FinishReason == FinishReasonContentFilter
 }
 
 // Text returns the first text part of the message, or an empty string if none exists.
@@ -125,11 +200,45 @@ func (m *Message) Data() *DataPart {
 }
 
 // Clone creates a shallow copy of the message.
+// The parts slice and the actions and metadata maps are copied, their values are shared.
 func (m *Message) Clone() *Message {
 	if m == nil {
 		return nil
 	}
-	return &(*m)
+	clone := *m
+	clone.Parts = slices.Clone(m.Parts)
+	if m.Actions != nil {
+		clone.Actions = maps.Clone(m.Actions)
+	}
+	if m.Metadata != nil {
+		clone.Metadata = maps.Clone(m.Metadata)
+	}
+	return &clone
+}
+
+var _ stream.Delta[*Message] = (*Message)(nil)
+
+// DeltaText implements stream.Delta: a partial assistant message of text
+// parts is a text delta of the messages of its author in its invocation.
+func (m *Message) DeltaText() (string, string, bool) {
+	if m == nil || m.Role != RoleAssistant || m.Status != StatusIncomplete {
+		return "", "", false
+	}
+	for _, part := range m.Parts {
+		if _, ok := part.(TextPart); !ok {
+			return "", "", false
+		}
+	}
+	return m.Text(), m.InvocationID + "/" + m.Author, true
+}
+
+// WithDeltaText implements stream.Delta: it returns a copy of the message
+// with a new ID holding only the text.
+func (m *Message) WithDeltaText(text string) *Message {
+	delta := m.Clone()
+	delta.ID = NewMessageID()
+	delta.Parts = Parts(text)
+	return delta
 }
 
 func (m *Message) String() string {
@@ -144,6 +253,8 @@ func (m *Message) String() string {
 			buf.WriteString("[Data: " + v.Name + " (" + string(v.MIMEType) + "), " + fmt.Sprintf("%d bytes", len(v.Bytes)) + "]")
 		case ToolPart:
 			buf.WriteString("[Tool: " + v.Name + " (Request: " + v.Request + ", Response: " + v.Response + ")]")
+		case ReasoningPart:
+			buf.WriteString("[Reasoning: " + v.Text + "]")
 		}
 	}
 	return buf.String()
@@ -159,11 +270,41 @@ func SystemMessage[T contentPart](parts ...T) *Message {
 	return &Message{ID: NewMessageID(), Role: RoleSystem, Parts: Parts(parts...)}
 }
 
+// DeveloperMessage creates a developer-authored message from parts.
+func DeveloperMessage[T contentPart](parts ...T) *Message {
+	return &Message{ID: NewMessageID(), Role: RoleDeveloper, Parts: Parts(parts...)}
+}
+
 // AssistantMessage creates an assistant-authored message from parts.
 func AssistantMessage[T contentPart](parts ...T) *Message {
 	return &Message{ID: NewMessageID(), Role: RoleAssistant, Parts: Parts(parts...)}
 }
 
+// SystemSeparator separates the texts of system messages that are joined
+// for providers that accept a single system prompt.
+const SystemSeparator = "\n\n"
+
+// IsSystemRole reports whether the role carries instructions, that is
+// RoleSystem or RoleDeveloper.
+func IsSystemRole(role Role) bool {
+	return role == RoleSystem || role == RoleDeveloper
+}
+
+// JoinSystemMessages joins the texts of the messages with SystemSeparator,
+// skipping nil and empty messages.
+func JoinSystemMessages(messages ...*Message) string {
+	texts := make([]string, 0, len(messages))
+	for _, m := range messages {
+		if m == nil {
+			continue
+		}
+		if text := m.Text(); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	return strings.Join(texts, SystemSeparator)
+}
+
 // NewAssistantMessage creates a new assistant message with the given status.
 func NewAssistantMessage(status Status) *Message {
 	return &Message{
@@ -0,0 +1,159 @@
+package blades
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Part type tags used in the JSON encoding of messages.
+const (
+	partTypeText      = "text"
+	partTypeFile      = "file"
+	partTypeData      = "data"
+	partTypeTool      = "tool"
+	partTypeReasoning = "reasoning"
+)
+
+// messageJSON is the JSON shape of a Message with its parts left encoded.
+type messageJSON struct {
+	*messageAlias
+	Parts []json.RawMessage `json:"parts"`
+}
+
+type messageAlias Message
+
+// MarshalJSON encodes the message with a type tag on every part, so that it
+// can be decoded back into the same parts.
+func (m Message) MarshalJSON() ([]byte, error) {
+	var parts []json.RawMessage
+	for _, part := range m.Parts {
+		data, err := marshalPart(part)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, data)
+	}
+	alias := messageAlias(m)
+	return json.Marshal(messageJSON{messageAlias: &alias, Parts: parts})
+}
+
+// UnmarshalJSON decodes a message encoded by MarshalJSON. Parts without a
+// type tag are recognized by their fields.
+func (m *Message) UnmarshalJSON(data []byte) error {
+	aux := messageJSON{messageAlias: (*messageAlias)(m)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	m.Parts = nil
+	for _, raw := range aux.Parts {
+		part, err := unmarshalPart(raw)
+		if err != nil {
+			return err
+		}
+		m.Parts = append(m.Parts, part)
+	}
+	return nil
+}
+
+func marshalPart(part Part) ([]byte, error) {
+	switch v := part.(type) {
+	case TextPart:
+		return json.Marshal(struct {
+			Type string `json:"type"`
+			TextPart
+		}{partTypeText, v})
+	case FilePart:
+		return json.Marshal(struct {
+			Type string `json:"type"`
+			FilePart
+		}{partTypeFile, v})
+	case DataPart:
+		return json.Marshal(struct {
+			Type string `json:"type"`
+			DataPart
+		}{partTypeData, v})
+	case ToolPart:
+		return json.Marshal(struct {
+			Type string `json:"type"`
+			ToolPart
+		}{partTypeTool, v})
+	case ReasoningPart:
+		return json.Marshal(struct {
+			Type string `json:"type"`
+			ReasoningPart
+		}{partTypeReasoning, v})
+	default:
+		return nil, fmt.Errorf("message: unsupported part type %T", part)
+	}
+}
+
+func unmarshalPart(data []byte) (Part, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	var kind string
+	if raw, ok := fields["type"]; ok {
+		if err := json.Unmarshal(raw, &kind); err != nil {
+			return nil, err
+		}
+	} else {
+		kind = inferPartType(fields)
+	}
+	switch kind {
+	case partTypeText:
+		var part TextPart
+		if err := json.Unmarshal(data, &part); err != nil {
+			return nil, err
+		}
+		return part, nil
+	case partTypeFile:
+		var part FilePart
+		if err := json.Unmarshal(data, &part); err != nil {
+			return nil, err
+		}
+		return part, nil
+	case partTypeData:
+		var part DataPart
+		if err := json.Unmarshal(data, &part); err != nil {
+			return nil, err
+		}
+		return part, nil
+	case partTypeTool:
+		var part ToolPart
+		if err := json.Unmarshal(data, &part); err != nil {
+			return nil, err
+		}
+		return part, nil
+	case partTypeReasoning:
+		var part ReasoningPart
+		if err := json.Unmarshal(data, &part); err != nil {
+			return nil, err
+		}
+		return part, nil
+	default:
+		return nil, fmt.Errorf("message: unknown part type %q", kind)
+	}
+}
+
+// inferPartType recognizes untagged parts by their distinguishing fields.
+func inferPartType(fields map[string]json.RawMessage) string {
+	has := func(key string) bool {
+		_, ok := fields[key]
+		return ok
+	}
+	switch {
+	case has("arguments"), has("result"):
+		return partTypeTool
+	case has("bytes"):
+		return partTypeData
+	case has("uri"):
+		return partTypeFile
+	case has("reasoning"):
+		return partTypeReasoning
+	case has("text"):
+		return partTypeText
+	default:
+		return ""
+	}
+}
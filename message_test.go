@@ -0,0 +1,47 @@
+package blades
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMessageJSON(t *testing.T) {
+	message := &Message{
+		ID:     "m1",
+		Role:   RoleTool,
+		Author: "agent",
+		Status: StatusCompleted,
+		Parts: []Part{
+			TextPart{Text: "hello"},
+			FilePart{Name: "a.png", URI: "https://example.com/a.png", MIMEType: MIMEImagePNG},
+			DataPart{Name: "b.bin", Bytes: []byte{1, 2, 3}, MIMEType: MIMEImagePNG},
+			ToolPart{ID: "call-1", Name: "search", Request: `{"q":"x"}`, Response: "ok"},
+			ReasoningPart{Text: "thinking"},
+		},
+		Metadata:  map[string]any{"system_fingerprint": "fp"},
+		CreatedAt: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	data, err := json.Marshal(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Message
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&decoded, message) {
+		t.Fatalf("round trip mismatch:\nwant %#v\ngot  %#v", message, &decoded)
+	}
+
+	// Parts written without a type tag are recognized by their fields.
+	legacy := `{"role":"user","parts":[{"text":"hi"},{"id":"c","name":"n","arguments":"{}"}]}`
+	if err := json.Unmarshal([]byte(legacy), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	want := []Part{TextPart{Text: "hi"}, ToolPart{ID: "c", Name: "n", Request: "{}"}}
+	if !reflect.DeepEqual(decoded.Parts, want) {
+		t.Fatalf("want %#v, got %#v", want, decoded.Parts)
+	}
+}
@@ -0,0 +1,247 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/go-kratos/blades"
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+// ErrRequestRejected is returned when the classification policy rejects a request.
+var ErrRequestRejected = errors.New("request rejected")
+
+// ClassificationKey is the metadata key of the invocation message under which
+// Classify stores the Classification, and the prefix of its session state
+// key; see ClassificationStateKey.
+const ClassificationKey = "classification"
+
+// ClassificationStateKey returns the session state key under which Classify
+// stores the Classification of the last request of the agent, so that
+// agents classified side by side, e.g. in a parallel flow, do not write the
+// same key.
+func ClassificationStateKey(agent string) string {
+	return "blades." + ClassificationKey + "." + agent
+}
+
+// SessionClassification returns the Classification of the last request of
+// the agent stored in the session state, including in a session restored
+// from JSON.
+func SessionClassification(session blades.Session, agent string) (Classification, bool) {
+	if session == nil {
+		return Classification{}, false
+	}
+	return blades.DecodeState[Classification](session.State()[ClassificationStateKey(agent)])
+}
+
+// Sensitivities of a Classification.
+const (
+	SensitivityLow    = "low"
+	SensitivityMedium = "medium"
+	SensitivityHigh   = "high"
+)
+
+// Complexities of a Classification.
+const (
+	ComplexitySimple   = "simple"
+	ComplexityModerate = "moderate"
+	ComplexityComplex  = "complex"
+)
+
+// Classification are the tags the classifier gives a request.
+type Classification struct {
+	Category    string `json:"category" jsonschema:"the topic of the request"`
+	Sensitivity string `json:"sensitivity" jsonschema:"how sensitive the request is, e.g. personal, medical, legal or financial matters"`
+	Language    string `json:"language" jsonschema:"the BCP-47 tag of the language of the request"`
+	Complexity  string `json:"complexity" jsonschema:"how much reasoning the answer needs"`
+}
+
+// PolicyAction is what Classify does with a classified request.
+type PolicyAction int
+
+const (
+	// PolicyAllow runs the request, on the model the policy set in
+	// Invocation.ModelProvider if any.
+	PolicyAllow PolicyAction = iota
+	// PolicyBlock rejects the request with a *ClassificationError.
+	PolicyBlock
+	// PolicyEscalate runs the request once the ConfirmFunc of
+	// WithClassifyConfirm allows it, and rejects it with ErrConfirmDenied
+	// otherwise or without one.
+	PolicyEscalate
+)
+
+// ClassificationPolicy decides what to do with a classified request. It may
+// route the request to another model by setting invocation.ModelProvider.
+type ClassificationPolicy func(ctx context.Context, invocation *blades.Invocation, classification Classification) (PolicyAction, error)
+
+// ClassificationError is returned when the policy blocks a request. It
+// unwraps to ErrRequestRejected.
+type ClassificationError struct {
+	Classification Classification
+}
+
+func (e *ClassificationError) Error() string {
+	return fmt.Sprintf("%s: category %q is not allowed", ErrRequestRejected, e.Classification.Category)
+}
+
+// Unwrap returns ErrRequestRejected.
+func (e *ClassificationError) Unwrap() error {
+	return ErrRequestRejected
+}
+
+// ClassifyOption configures Classify.
+type ClassifyOption func(*classifier)
+
+// WithClassifyCategories sets the categories the classifier chooses from.
+// By default it names the category freely.
+func WithClassifyCategories(categories ...string) ClassifyOption {
+	return func(c *classifier) {
+		c.categories = categories
+	}
+}
+
+// WithClassifyConfirm sets the confirmation asked for escalated requests.
+func WithClassifyConfirm(confirm ConfirmFunc) ClassifyOption {
+	return func(c *classifier) {
+		c.confirm = confirm
+	}
+}
+
+// classifier tags requests with a model.
+type classifier struct {
+	model      blades.ModelProvider
+	policy     ClassificationPolicy
+	categories []string
+	confirm    ConfirmFunc
+}
+
+// ClassificationRules returns a policy that blocks the categories, escalates
+// highly sensitive requests and routes simple ones to the model, e.g. a
+// cheaper one. A nil model keeps the agent's model.
+func ClassificationRules(blocked []string, simple blades.ModelProvider) ClassificationPolicy {
+	return func(ctx context.Context, invocation *blades.Invocation, c Classification) (PolicyAction, error) {
+		switch {
+		case slices.Contains(blocked, c.Category):
+			return PolicyBlock, nil
+		case c.Sensitivity == SensitivityHigh:
+			return PolicyEscalate, nil
+		case c.Complexity == ComplexitySimple && simple != nil:
+			invocation.ModelProvider = simple
+		}
+		return PolicyAllow, nil
+	}
+}
+
+// Classify is a middleware that tags each request with a cheap classifier
+// model before the agent's model answers it. The Classification is stored
+// under the ClassificationStateKey of the agent in the session state and
+// under ClassificationKey in the metadata of the
+// invocation message, then the policy blocks, escalates or allows the
+// request, possibly on another model.
+func Classify(model blades.ModelProvider, policy ClassificationPolicy, opts ...ClassifyOption) blades.Middleware {
+	c := &classifier{model: model, policy: policy}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return func(next blades.Handler) blades.Handler {
+		return blades.HandleFunc(func(ctx context.Context, invocation *blades.Invocation) blades.Generator[*blades.Message, error] {
+			return func(yield func(*blades.Message, error) bool) {
+				if err := c.apply(ctx, invocation); err != nil {
+					yield(nil, err)
+					return
+				}
+				for msg, err := range next.Handle(ctx, invocation) {
+					if !yield(msg, err) {
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+// apply classifies the invocation message and applies the policy.
+func (c *classifier) apply(ctx context.Context, invocation *blades.Invocation) error {
+	if invocation.Message == nil {
+		return nil
+	}
+	classification, err := c.classify(ctx, invocation.Message)
+	if err != nil {
+		return fmt.Errorf("classify: %w", err)
+	}
+	if invocation.Session != nil {
+		var name string
+		if agent, ok := blades.FromAgentContext(ctx); ok {
+			name = agent.Name()
+		}
+		invocation.Session.PutState(ctx, ClassificationStateKey(name), classification)
+	}
+	if invocation.Message.Metadata == nil {
+		invocation.Message.Metadata = make(map[string]any)
+	}
+	invocation.Message.Metadata[ClassificationKey] = classification
+	action, err := c.policy(ctx, invocation, classification)
+	if err != nil {
+		return fmt.Errorf("classify: policy: %w", err)
+	}
+	switch action {
+	case PolicyBlock:
+		return &ClassificationError{Classification: classification}
+	case PolicyEscalate:
+		if c.confirm == nil {
+			return ErrConfirmDenied
+		}
+		ok, err := c.confirm(ctx, invocation.Message)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrConfirmDenied
+		}
+	}
+	return nil
+}
+
+const classifyInstruction = `Classify the user message. Do not answer it. Respond with JSON only.`
+
+// classify asks the classifier model for the tags of the message.
+func (c *classifier) classify(ctx context.Context, message *blades.Message) (Classification, error) {
+	schema, err := c.schema()
+	if err != nil {
+		return Classification{}, err
+	}
+	res, err := c.model.Generate(ctx, &blades.ModelRequest{
+		Instruction:  blades.SystemMessage(classifyInstruction),
+		Messages:     []*blades.Message{blades.UserMessage(message.Text())},
+		OutputSchema: schema,
+	})
+	if err != nil {
+		return Classification{}, err
+	}
+	classification, err := blades.ParseStructured[Classification](res.Message.Text())
+	if err != nil {
+		return Classification{}, fmt.Errorf("invalid classifier output: %w", err)
+	}
+	return classification, nil
+}
+
+// schema returns the output schema of the classifier.
+func (c *classifier) schema() (*jsonschema.Schema, error) {
+	schema, err := jsonschema.For[Classification](nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, category := range c.categories {
+		schema.Properties["category"].Enum = append(schema.Properties["category"].Enum, category)
+	}
+	for _, v := range []string{SensitivityLow, SensitivityMedium, SensitivityHigh} {
+		schema.Properties["sensitivity"].Enum = append(schema.Properties["sensitivity"].Enum, v)
+	}
+	for _, v := range []string{ComplexitySimple, ComplexityModerate, ComplexityComplex} {
+		schema.Properties["complexity"].Enum = append(schema.Properties["complexity"].Enum, v)
+	}
+	return schema, nil
+}
@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-kratos/blades"
+)
+
+func TestClassify(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		output   string
+		confirm  ConfirmFunc
+		wantText string
+		wantErr  error
+	}{
+		{
+			name:     "allow",
+			output:   `{"category":"billing","sensitivity":"low","language":"en","complexity":"complex"}`,
+			wantText: "main",
+		},
+		{
+			name:     "route simple",
+			output:   "Tags:\n```json\n{\"category\":\"billing\",\"sensitivity\":\"low\",\"language\":\"en\",\"complexity\":\"simple\"}\n```",
+			wantText: "cheap",
+		},
+		{
+			name:    "block",
+			output:  `{"category":"weapons","sensitivity":"high","language":"en","complexity":"simple"}`,
+			wantErr: ErrRequestRejected,
+		},
+		{
+			name:   "escalate confirmed",
+			output: `{"category":"health","sensitivity":"high","language":"en","complexity":"simple"}`,
+			confirm: func(context.Context, *blades.Message) (bool, error) {
+				return true, nil
+			},
+			wantText: "main",
+		},
+		{
+			name:   "escalate denied",
+			output: `{"category":"health","sensitivity":"high","language":"en","complexity":"simple"}`,
+			confirm: func(context.Context, *blades.Message) (bool, error) {
+				return false, nil
+			},
+			wantErr: ErrConfirmDenied,
+		},
+		{
+			name:    "escalate without confirmation",
+			output:  `{"category":"health","sensitivity":"high","language":"en","complexity":"simple"}`,
+			wantErr: ErrConfirmDenied,
+		},
+	}
+	reply := func(text string) *scriptedModel {
+		return &scriptedModel{respond: func(*blades.ModelRequest) *blades.Message {
+			message := blades.NewAssistantMessage(blades.StatusCompleted)
+			message.Parts = blades.Parts(text)
+			return message
+		}}
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var request *blades.ModelRequest
+			classifier := &scriptedModel{respond: func(req *blades.ModelRequest) *blades.Message {
+				request = req
+				return blades.AssistantMessage(tt.output)
+			}}
+			opts := []ClassifyOption{WithClassifyCategories("billing", "health", "weapons")}
+			if tt.confirm != nil {
+				opts = append(opts, WithClassifyConfirm(tt.confirm))
+			}
+			agent, err := blades.NewAgent("assistant",
+				blades.WithModel(reply("main")),
+				blades.WithMiddleware(Classify(classifier, ClassificationRules([]string{"weapons"}, reply("cheap")), opts...)),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			session := blades.NewSession()
+			input := blades.UserMessage("How do I pay my bill?")
+			answer, err := blades.NewRunner(agent).Run(context.Background(), input, blades.WithSession(session))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("want %v, got %v", tt.wantErr, err)
+				}
+			} else if err != nil || answer.Text() != tt.wantText {
+				t.Fatalf("want %q, got %v %v", tt.wantText, answer, err)
+			}
+			classification, ok := SessionClassification(session, "assistant")
+			if stored := session.History()[0]; !ok || stored.Metadata[ClassificationKey] != classification {
+				t.Fatalf("want the classification stored, got %v and %v", session.State(), stored.Metadata)
+			}
+			data, exportErr := blades.ExportSession(session)
+			if exportErr != nil {
+				t.Fatal(exportErr)
+			}
+			restored, importErr := blades.ImportSession(data)
+			if importErr != nil {
+				t.Fatal(importErr)
+			}
+			if got, ok := SessionClassification(restored, "assistant"); !ok || got != classification {
+				t.Fatalf("want the classification of the restored session, got %+v", got)
+			}
+			if tt.name == "block" {
+				var rejected *ClassificationError
+				if !errors.As(err, &rejected) || rejected.Classification.Category != "weapons" {
+					t.Fatalf("want a classification error, got %v", err)
+				}
+			}
+			enum := request.OutputSchema.Properties["category"].Enum
+			if !slices.Equal(enum, []any{"billing", "health", "weapons"}) || request.Messages[0].Text() != input.Text() {
+				t.Fatalf("want the message classified against the categories, got %v", request)
+			}
+		})
+	}
+}
+
+func TestClassifyInvalidOutput(t *testing.T) {
+	t.Parallel()
+
+	classifier := &scriptedModel{respond: func(*blades.ModelRequest) *blades.Message {
+		return blades.AssistantMessage("billing")
+	}}
+	main := &scriptedModel{respond: func(*blades.ModelRequest) *blades.Message {
+		t.Error("want the agent's model not called")
+		return blades.AssistantMessage("main")
+	}}
+	agent, err := blades.NewAgent("assistant",
+		blades.WithModel(main),
+		blades.WithMiddleware(Classify(classifier, ClassificationRules(nil, nil))),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = blades.NewRunner(agent).Run(context.Background(), blades.UserMessage("hi"))
+	if !errors.Is(err, blades.ErrInvalidStructuredOutput) || !strings.Contains(err.Error(), "invalid classifier output") {
+		t.Fatalf("want an invalid output error, got %v", err)
+	}
+}
@@ -0,0 +1,407 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"maps"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/go-kratos/blades"
+	"github.com/go-kratos/blades/tools"
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+// ContentKind is the kind of content of a tool result, which selects how it is compressed.
+type ContentKind int
+
+const (
+	// ContentText is free text; it is summarized, or truncated without a summarizer.
+	ContentText ContentKind = iota
+	// ContentHTML is an HTML page; it is stripped to its readable text.
+	ContentHTML
+	// ContentJSON is a JSON document; it is pretty-printed with its arrays
+	// cut to their first items and its long strings truncated.
+	ContentJSON
+)
+
+// String returns the name of the content kind.
+func (k ContentKind) String() string {
+	switch k {
+	case ContentHTML:
+		return "html"
+	case ContentJSON:
+		return "json"
+	default:
+		return "text"
+	}
+}
+
+// Compression methods recorded in Compression.Method.
+const (
+	CompressionHTMLText     = "html_text"
+	CompressionJSONSkeleton = "json_skeleton"
+	CompressionSummary      = "summary"
+	CompressionTruncate     = "truncate"
+)
+
+// CompressionActionKey is the tool action holding the Compression of each
+// compressed result of a tool message, by tool call ID.
+const CompressionActionKey = "compression"
+
+// ExpandToolName is the name of the tool added by WithExpandTool.
+const ExpandToolName = "expand_tool_result"
+
+// DefaultCompressionThresholds are the sizes in bytes above which a tool
+// result is compressed, by kind of content.
+var DefaultCompressionThresholds = map[ContentKind]int{
+	ContentText: 16 << 10,
+	ContentHTML: 4 << 10,
+	ContentJSON: 8 << 10,
+}
+
+// Compression describes a compressed tool result.
+type Compression struct {
+	Kind string `json:"kind"`
+	// Method lists the compression methods applied, joined by "+", e.g. "html_text+summary".
+	Method       string `json:"method"`
+	OriginalSize int    `json:"originalSize"`
+	Size         int    `json:"size"`
+}
+
+// CompressOption configures CompressToolResults.
+type CompressOption func(*compressor)
+
+// WithCompressionThreshold sets the size in bytes above which results of the
+// kind are compressed.
+func WithCompressionThreshold(kind ContentKind, n int) CompressOption {
+	return func(c *compressor) {
+		c.thresholds[kind] = n
+	}
+}
+
+// WithJSONItems sets how many items of each JSON array a compressed result
+// keeps. Defaults to 3.
+func WithJSONItems(n int) CompressOption {
+	return func(c *compressor) {
+		c.jsonItems = n
+	}
+}
+
+// WithSummarizer summarizes free text over its threshold with the model
+// instead of truncating it.
+func WithSummarizer(model blades.ModelProvider) CompressOption {
+	return func(c *compressor) {
+		c.summarizer = model
+	}
+}
+
+// WithExpandTool keeps the original of the last compressed results in memory
+// and adds a tool the model calls with the ID of a tool call to read its full
+// result when the compressed one is not enough. The originals are kept by
+// session, so a model only reads the results of its own conversation.
+func WithExpandTool() CompressOption {
+	return func(c *compressor) {
+		c.originals = make(map[string]string)
+	}
+}
+
+// maxOriginals is the number of originals kept for the expand tool.
+const maxOriginals = 256
+
+// maxJSONString is the length in runes above which strings of a compressed
+// JSON result are truncated.
+const maxJSONString = 200
+
+type compressor struct {
+	thresholds map[ContentKind]int
+	jsonItems  int
+	summarizer blades.ModelProvider
+	mu         sync.Mutex
+	// originals are the originals of the compressed results by originalKey,
+	// in the order of calls, if the expand tool is enabled.
+	originals map[string]string
+	order     []string
+}
+
+// CompressToolResults is a middleware that compresses the results of the
+// agent's tools over a size threshold before they enter the conversation:
+// HTML is stripped to its readable text, JSON is reduced to its skeleton and
+// the first items of its arrays, and free text is summarized or truncated.
+// A compressed result ends with a note of its original size, and its
+// Compression is recorded in the tool action CompressionActionKey.
+func CompressToolResults(opts ...CompressOption) blades.Middleware {
+	c := &compressor{thresholds: maps.Clone(DefaultCompressionThresholds), jsonItems: 3}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return func(next blades.Handler) blades.Handler {
+		return blades.HandleFunc(func(ctx context.Context, invocation *blades.Invocation) blades.Generator[*blades.Message, error] {
+			compressed := make([]tools.Tool, 0, len(invocation.Tools)+1)
+			for _, tool := range invocation.Tools {
+				compressed = append(compressed, &compressedTool{Tool: tool, compressor: c})
+			}
+			if c.originals != nil {
+				compressed = append(compressed, c.expandTool())
+			}
+			invocation.Tools = compressed
+			return next.Handle(ctx, invocation)
+		})
+	}
+}
+
+// compressedTool is a tool whose results pass through the compressor.
+type compressedTool struct {
+	tools.Tool
+	compressor *compressor
+}
+
+// Handle runs the tool and compresses its result.
+func (t *compressedTool) Handle(ctx context.Context, input string) (string, error) {
+	result, err := t.Tool.Handle(ctx, input)
+	if err != nil {
+		return result, err
+	}
+	return t.compressor.compress(ctx, t.Name(), result)
+}
+
+// compress returns the result compressed if it is over the threshold of its kind.
+func (c *compressor) compress(ctx context.Context, tool, result string) (string, error) {
+	kind := contentKind(result)
+	if len(result) <= c.thresholds[kind] {
+		return result, nil
+	}
+	var (
+		compressed = result
+		methods    []string
+		err        error
+	)
+	switch kind {
+	case ContentHTML:
+		compressed = htmlText(result)
+		methods = append(methods, CompressionHTMLText)
+	case ContentJSON:
+		if compressed, err = c.jsonSkeleton(result); err != nil {
+			return "", fmt.Errorf("compress %s result: %w", tool, err)
+		}
+		methods = append(methods, CompressionJSONSkeleton)
+	}
+	// A skeleton can still be over the threshold, e.g. for objects with many keys.
+	if kind == ContentJSON && len(compressed) > c.thresholds[ContentJSON] {
+		compressed = truncate(compressed, c.thresholds[ContentJSON])
+		methods = append(methods, CompressionTruncate)
+	}
+	// Text left over its threshold, including the text of a page, is summarized or cut.
+	if kind != ContentJSON && len(compressed) > c.thresholds[ContentText] {
+		if c.summarizer != nil {
+			if compressed, err = c.summarize(ctx, compressed); err != nil {
+				return "", fmt.Errorf("compress %s result: %w", tool, err)
+			}
+			methods = append(methods, CompressionSummary)
+		} else {
+			compressed = truncate(compressed, c.thresholds[ContentText])
+			methods = append(methods, CompressionTruncate)
+		}
+	}
+	compression := Compression{
+		Kind:         kind.String(),
+		Method:       strings.Join(methods, "+"),
+		OriginalSize: len(result),
+		Size:         len(compressed),
+	}
+	note := fmt.Sprintf("\n[compressed from %d bytes of %s by %s", compression.OriginalSize, compression.Kind, compression.Method)
+	if toolCtx, ok := blades.FromToolContext(ctx); ok {
+		c.mu.Lock()
+		compressions, _ := toolCtx.Actions()[CompressionActionKey].(map[string]Compression)
+		compressions = maps.Clone(compressions)
+		if compressions == nil {
+			compressions = make(map[string]Compression)
+		}
+		compressions[toolCtx.ID()] = compression
+		toolCtx.SetAction(CompressionActionKey, compressions)
+		if c.originals != nil {
+			c.keep(originalKey(ctx, toolCtx.ID()), result)
+			note += fmt.Sprintf("; call %s with id %q for the full result", ExpandToolName, toolCtx.ID())
+		}
+		c.mu.Unlock()
+	}
+	return compressed + note + "]", nil
+}
+
+// keep stores the original of a result for the expand tool; c.mu must be held.
+func (c *compressor) keep(id, original string) {
+	if _, ok := c.originals[id]; !ok {
+		c.order = append(c.order, id)
+	}
+	c.originals[id] = original
+	for len(c.order) > maxOriginals {
+		delete(c.originals, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// originalKey is the key of the original of a tool call result. Call IDs
+// are only unique within a conversation, so it includes the ID of the session,
+// or of the invocation when there is none.
+func originalKey(ctx context.Context, callID string) string {
+	if session, ok := blades.FromSessionContext(ctx); ok {
+		return session.ID() + "/" + callID
+	}
+	if invocation, ok := blades.FromInvocationContext(ctx); ok {
+		return invocation.ID + "/" + callID
+	}
+	return callID
+}
+
+// expandSchema is the input schema of the expand tool.
+var expandSchema = &jsonschema.Schema{
+	Type: "object",
+	Properties: map[string]*jsonschema.Schema{
+		"id": {Type: "string", Description: "The ID of the tool call whose full result to read."},
+	},
+	Required: []string{"id"},
+}
+
+// expandTool returns the tool that reads the original of a compressed result.
+func (c *compressor) expandTool() tools.Tool {
+	return tools.NewTool(
+		ExpandToolName,
+		"Read the full result of a tool call whose result was compressed, when the compressed result is not enough.",
+		tools.HandleFunc(func(ctx context.Context, input string) (string, error) {
+			var req struct {
+				ID string `json:"id"`
+			}
+			if err := json.Unmarshal([]byte(input), &req); err != nil {
+				return "", fmt.Errorf("%s: %w", ExpandToolName, err)
+			}
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			original, ok := c.originals[originalKey(ctx, req.ID)]
+			if !ok {
+				return "", fmt.Errorf("%s: no compressed result of tool call %q", ExpandToolName, req.ID)
+			}
+			return original, nil
+		}),
+		tools.WithInputSchema(expandSchema),
+	)
+}
+
+var htmlTag = regexp.MustCompile(`(?i)<(!doctype|html|head|body|div|p|span|a|table|ul|script|br)\b`)
+
+// contentKind guesses the kind of content of a result.
+func contentKind(result string) ContentKind {
+	trimmed := strings.TrimSpace(result)
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		if json.Valid([]byte(trimmed)) {
+			return ContentJSON
+		}
+	}
+	if strings.HasPrefix(trimmed, "<") && htmlTag.MatchString(trimmed) {
+		return ContentHTML
+	}
+	return ContentText
+}
+
+var (
+	htmlHidden  = regexp.MustCompile(`(?is)<!--.*?-->|<(script|style|noscript|svg|template)\b.*?</(script|style|noscript|svg|template)>`)
+	htmlBlock   = regexp.MustCompile(`(?i)</?(address|article|aside|blockquote|br|dd|div|dl|dt|figcaption|footer|form|h[1-6]|header|hr|li|main|nav|ol|p|pre|section|table|td|th|title|tr|ul)\b[^>]*>`)
+	htmlAnyTag  = regexp.MustCompile(`(?s)<[^>]*>`)
+	blankSpaces = regexp.MustCompile(`[ \t\r\f\v]+`)
+	blankLines  = regexp.MustCompile(`\n\s*\n+`)
+)
+
+// htmlText returns the readable text of an HTML page: scripts, styles and
+// comments are dropped, blocks become lines and entities are unescaped.
+func htmlText(page string) string {
+	text := htmlHidden.ReplaceAllString(page, "")
+	text = htmlBlock.ReplaceAllString(text, "\n")
+	text = htmlAnyTag.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+	text = blankSpaces.ReplaceAllString(text, " ")
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	text = blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(text)
+}
+
+// jsonSkeleton returns the document pretty-printed, with its arrays cut to
+// their first items and its long strings truncated.
+func (c *compressor) jsonSkeleton(document string) (string, error) {
+	decoder := json.NewDecoder(strings.NewReader(document))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(c.skeleton(value)); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// skeleton returns the value with its arrays cut to their first items, the
+// number of the dropped ones noted as a last item, and its long strings truncated.
+func (c *compressor) skeleton(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, e := range v {
+			v[key] = c.skeleton(e)
+		}
+		return v
+	case []any:
+		n := min(len(v), c.jsonItems)
+		items := make([]any, 0, n+1)
+		for _, e := range v[:n] {
+			items = append(items, c.skeleton(e))
+		}
+		if dropped := len(v) - n; dropped > 0 {
+			items = append(items, fmt.Sprintf("... %d more items", dropped))
+		}
+		return items
+	case string:
+		if utf8.RuneCountInString(v) > maxJSONString {
+			return string([]rune(v)[:maxJSONString]) + "..."
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// truncate cuts the text to at most n bytes, at a rune boundary.
+func truncate(text string, n int) string {
+	if len(text) <= n {
+		return text
+	}
+	for n > 0 && !utf8.RuneStart(text[n]) {
+		n--
+	}
+	return text[:n] + "..."
+}
+
+const summaryInstruction = `Summarize the content the user sends, which is the result of a tool call.
+Keep every fact, name, number and identifier that may answer a question about it; drop boilerplate.
+Answer with the summary only.`
+
+// summarize asks the summarizer for a summary of the text.
+func (c *compressor) summarize(ctx context.Context, text string) (string, error) {
+	res, err := c.summarizer.Generate(ctx, &blades.ModelRequest{
+		Instruction: blades.SystemMessage(summaryInstruction),
+		Messages:    []*blades.Message{blades.UserMessage(text)},
+	})
+	if err != nil {
+		return "", fmt.Errorf("summarize: %w", err)
+	}
+	return res.Message.Text(), nil
+}
@@ -0,0 +1,228 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-kratos/blades"
+	"github.com/go-kratos/blades/tools"
+)
+
+func TestCompressToolResults(t *testing.T) {
+	t.Parallel()
+
+	page := "<!DOCTYPE html><html><head><title>Tides</title><style>p { color: red }</style><script>track()</script></head><body>" +
+		strings.Repeat("<div class=\"ad\"><p>Tides are caused by the <b>Moon</b> &amp; the Sun.</p></div>", 40) + "</body></html>"
+	var items []map[string]any
+	for i := range 50 {
+		items = append(items, map[string]any{"id": i, "name": fmt.Sprint("station-", i), "note": strings.Repeat("x", 300)})
+	}
+	document, err := json.Marshal(map[string]any{"stations": items, "count": 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wide := make(map[string]any)
+	for i := range 200 {
+		wide[fmt.Sprintf("station-%03d", i)] = "open"
+	}
+	wideDocument, err := json.Marshal(wide)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := strings.Repeat("The tide rises twice a day. ", 100)
+	summarizer := &replyModel{message: blades.Message{Role: blades.RoleAssistant, Status: blades.StatusCompleted, Parts: blades.Parts("The tide rises twice a day.")}}
+
+	tests := []struct {
+		name       string
+		result     string
+		opts       []CompressOption
+		want       []string
+		unwanted   []string
+		wantMethod string
+	}{
+		{
+			name:       "html",
+			result:     page,
+			opts:       []CompressOption{WithCompressionThreshold(ContentHTML, 1024)},
+			want:       []string{"Tides\n\nTides are caused by the Moon & the Sun.\n\nTides are caused", "[compressed from"},
+			unwanted:   []string{"<", "track()", "color: red"},
+			wantMethod: CompressionHTMLText,
+		},
+		{
+			name:       "html over the text threshold",
+			result:     page,
+			opts:       []CompressOption{WithCompressionThreshold(ContentHTML, 1024), WithCompressionThreshold(ContentText, 100)},
+			want:       []string{"Tides are caused by the Moon & the Sun.\n\nTides are c...\n[compressed from"},
+			wantMethod: CompressionHTMLText + "+" + CompressionTruncate,
+		},
+		{
+			name:       "json",
+			result:     string(document),
+			want:       []string{"\"count\": 50", "\"name\": \"station-2\"", "\"... 47 more items\"", strings.Repeat("x", 200) + "..."},
+			unwanted:   []string{"station-3", strings.Repeat("x", 201)},
+			wantMethod: CompressionJSONSkeleton,
+		},
+		{
+			name:       "json skeleton over the threshold",
+			result:     string(wideDocument),
+			opts:       []CompressOption{WithCompressionThreshold(ContentJSON, 1024)},
+			want:       []string{"\"station-000\": \"open\"", "...\n[compressed from"},
+			unwanted:   []string{"station-199"},
+			wantMethod: CompressionJSONSkeleton + "+" + CompressionTruncate,
+		},
+		{
+			name:       "text",
+			result:     text,
+			opts:       []CompressOption{WithCompressionThreshold(ContentText, 100)},
+			want:       []string{"The tide rises twice a day. The tide rises twice a day. The tide rises t...\n[compressed from 2800 bytes of text by truncate]"},
+			wantMethod: CompressionTruncate,
+		},
+		{
+			name:       "text summary",
+			result:     text,
+			opts:       []CompressOption{WithCompressionThreshold(ContentText, 100), WithSummarizer(summarizer)},
+			want:       []string{"The tide rises twice a day.\n[compressed from 2800 bytes of text by summary]"},
+			wantMethod: CompressionSummary,
+		},
+		{
+			name:   "under the threshold",
+			result: text,
+			want:   []string{text},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tool := tools.NewTool("fetch", "Fetches a page.", tools.HandleFunc(func(context.Context, string) (string, error) {
+				return tt.result, nil
+			}))
+			var compressed tools.Tool
+			handler := CompressToolResults(tt.opts...)(blades.HandleFunc(func(ctx context.Context, invocation *blades.Invocation) blades.Generator[*blades.Message, error] {
+				compressed = invocation.Tools[0]
+				return func(yield func(*blades.Message, error) bool) {}
+			}))
+			for range handler.Handle(context.Background(), &blades.Invocation{Tools: []tools.Tool{tool}}) {
+			}
+			toolCtx := &recordingToolContext{id: "call-1", actions: make(map[string]any)}
+			got, err := compressed.Handle(blades.NewToolContext(context.Background(), toolCtx), "{}")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Fatalf("want %q in the result, got:\n%s", want, got)
+				}
+			}
+			for _, unwanted := range tt.unwanted {
+				if strings.Contains(got, unwanted) {
+					t.Fatalf("want no %q in the result, got:\n%s", unwanted, got)
+				}
+			}
+			compressions, _ := toolCtx.actions[CompressionActionKey].(map[string]Compression)
+			compression := compressions["call-1"]
+			if compression.Method != tt.wantMethod {
+				t.Fatalf("want method %q recorded, got %+v", tt.wantMethod, compressions)
+			}
+			if tt.wantMethod != "" && (compression.OriginalSize != len(tt.result) || compression.Size >= len(tt.result)) {
+				t.Fatalf("want the sizes recorded, got %+v for %d bytes", compression, len(tt.result))
+			}
+		})
+	}
+}
+
+// recordingToolContext is a ToolContext recording the actions set.
+type recordingToolContext struct {
+	id      string
+	actions map[string]any
+}
+
+func (c *recordingToolContext) ID() string                      { return c.id }
+func (c *recordingToolContext) Name() string                    { return "fetch" }
+func (c *recordingToolContext) Actions() map[string]any         { return c.actions }
+func (c *recordingToolContext) SetAction(key string, value any) { c.actions[key] = value }
+
+func TestCompressToolResultsExpand(t *testing.T) {
+	t.Parallel()
+
+	text := strings.Repeat("The tide rises twice a day. ", 100)
+	fetch := tools.NewTool("fetch", "Fetches a page.", tools.HandleFunc(func(context.Context, string) (string, error) {
+		return text, nil
+	}))
+	var results []string
+	model := &scriptedModel{respond: func(req *blades.ModelRequest) *blades.Message {
+		last := req.Messages[len(req.Messages)-1]
+		if last.Role != blades.RoleTool {
+			return &blades.Message{Role: blades.RoleTool, Status: blades.StatusCompleted, Parts: []blades.Part{
+				blades.ToolPart{ID: "call-1", Name: "fetch", Request: "{}"},
+			}}
+		}
+		call := last.Parts[0].(blades.ToolPart)
+		results = append(results, call.Response)
+		if call.Name == "fetch" {
+			return &blades.Message{Role: blades.RoleTool, Status: blades.StatusCompleted, Parts: []blades.Part{
+				blades.ToolPart{ID: "call-2", Name: ExpandToolName, Request: `{"id":"call-1"}`},
+			}}
+		}
+		return &blades.Message{Role: blades.RoleAssistant, Status: blades.StatusCompleted, Parts: blades.Parts("done")}
+	}}
+	agent, err := blades.NewAgent("reader",
+		blades.WithModel(model),
+		blades.WithTools(fetch),
+		blades.WithMiddleware(CompressToolResults(WithCompressionThreshold(ContentText, 100), WithExpandTool())),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := blades.NewSession()
+	if _, err := blades.NewRunner(agent).Run(context.Background(), blades.UserMessage("read the page"), blades.WithSession(session)); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || !strings.Contains(results[0], `call expand_tool_result with id "call-1"`) || results[1] != text {
+		t.Fatalf("want the compressed result, then the full one, got %q", results)
+	}
+	var compression Compression
+	for _, m := range session.History() {
+		if compressions, ok := m.Actions[CompressionActionKey].(map[string]Compression); ok {
+			compression = compressions["call-1"]
+		}
+	}
+	if compression.Method != CompressionTruncate || compression.OriginalSize != len(text) {
+		t.Fatalf("want the compression recorded in the tool message, got %+v", compression)
+	}
+}
+
+func TestCompressToolResultsExpandBySession(t *testing.T) {
+	t.Parallel()
+
+	fetch := tools.NewTool("fetch", "Fetches a page.", tools.HandleFunc(func(ctx context.Context, _ string) (string, error) {
+		session, _ := blades.FromSessionContext(ctx)
+		return strings.Repeat("Page of "+session.ID()+". ", 20), nil
+	}))
+	var compressed, expand tools.Tool
+	handler := CompressToolResults(WithCompressionThreshold(ContentText, 100), WithExpandTool())(blades.HandleFunc(func(ctx context.Context, invocation *blades.Invocation) blades.Generator[*blades.Message, error] {
+		compressed, expand = invocation.Tools[0], invocation.Tools[1]
+		return func(yield func(*blades.Message, error) bool) {}
+	}))
+	for range handler.Handle(context.Background(), &blades.Invocation{Tools: []tools.Tool{fetch}}) {
+	}
+	// Both conversations have a tool call with the same ID.
+	sessions := []blades.Session{blades.NewSessionWithID("alice"), blades.NewSessionWithID("bob")}
+	for _, session := range sessions {
+		ctx := blades.NewSessionContext(context.Background(), session)
+		toolCtx := &recordingToolContext{id: "call-1", actions: make(map[string]any)}
+		if _, err := compressed.Handle(blades.NewToolContext(ctx, toolCtx), "{}"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, session := range sessions {
+		got, err := expand.Handle(blades.NewSessionContext(context.Background(), session), `{"id":"call-1"}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(got, "Page of "+session.ID()+".") {
+			t.Fatalf("want the original of session %s, got %q", session.ID(), got)
+		}
+	}
+}
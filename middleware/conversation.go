@@ -9,23 +9,60 @@ import (
 // ConversationBuffered is a middleware that manages conversation history within a session.
 // It appends the session's message history to the invocation's history before processing.
 // The maxMessage parameter limits the number of messages retained from the session history.
+//
+// When the run carries blades.CacheHint, the window does not slide by one message
+// per turn, which would change the cached prefix every time; instead its start
+// advances in steps of half the window, keeping the prefix byte-stable in between.
+//
+// A tool message holds the calls of a model turn together with their results,
+// so trimming never separates a call from its result. Tool messages left at the
+// start of the window are dropped, since the turn that made the calls is gone.
 func ConversationBuffered(maxMessage int) blades.Middleware {
-	// trimMessage trims the message slice to the maximum allowed messages
-	trimMessage := func(messages []*blades.Message) []*blades.Message {
-		if maxMessage <= 0 || len(messages) <= maxMessage {
-			return messages
-		}
-		return messages[len(messages)-maxMessage:]
-	}
-	// Return the conversation middleware
 	return func(next blades.Handler) blades.Handler {
 		return blades.HandleFunc(func(ctx context.Context, invocation *blades.Invocation) blades.Generator[*blades.Message, error] {
 			session, ok := blades.FromSessionContext(ctx)
 			if ok {
+				var history []*blades.Message
+				if cacheHint(ctx) {
+					history = stableWindow(session.History(), maxMessage)
+				} else {
+					history = session.Messages(blades.MessageFilter{Last: maxMessage})
+				}
+				history = trimToolMessages(history)
 				// Append the session history to the invocation history
-				invocation.History = append(invocation.History, trimMessage(session.History())...)
+				invocation.History = append(invocation.History, history...)
 			}
 			return next.Handle(ctx, invocation)
 		})
 	}
 }
+
+// cacheHint reports whether the model options of the run request prompt caching.
+func cacheHint(ctx context.Context) bool {
+	opts, ok := blades.FromModelOptionsContext(ctx)
+	if !ok {
+		return false
+	}
+	var o blades.ModelOptions
+	o.Apply(opts...)
+	return o.CacheHint
+}
+
+// stableWindow returns at most maxMessage of the latest messages, with a start
+// aligned to multiples of half the window.
+func stableWindow(messages []*blades.Message, maxMessage int) []*blades.Message {
+	if maxMessage <= 0 || len(messages) <= maxMessage {
+		return messages
+	}
+	step := max(maxMessage/2, 1)
+	start := (len(messages) - maxMessage + step - 1) / step * step
+	return messages[start:]
+}
+
+// trimToolMessages drops the tool messages at the start of the history.
+func trimToolMessages(messages []*blades.Message) []*blades.Message {
+	for len(messages) > 0 && messages[0].Role == blades.RoleTool {
+		messages = messages[1:]
+	}
+	return messages
+}
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/go-kratos/blades"
+	"github.com/go-kratos/blades/tools"
 )
 
 // TestConversationBuffered verifies that the middleware reads session history
@@ -28,6 +29,10 @@ func TestConversationBuffered(t *testing.T) {
 	h2 := blades.AssistantMessage("h2")
 	h3 := blades.UserMessage("h3")
 	h4 := blades.AssistantMessage("h4")
+	h5 := blades.UserMessage("h5")
+	call := &blades.Message{Role: blades.RoleTool, Parts: []blades.Part{
+		blades.ToolPart{ID: "call-1", Name: "lookup", Request: "{}", Response: "found"},
+	}}
 
 	tests := []struct {
 		name          string
@@ -78,6 +83,27 @@ func TestConversationBuffered(t *testing.T) {
 			sessionHist:   []*blades.Message{h1, h2, h3},
 			wantHistTexts: []string{"h4", "h1", "h2", "h3"},
 		},
+		{
+			name:       "with session, tool exchange not split",
+			maxMessage: 3,
+			ctx: func() context.Context {
+				s := newSessionWithHistory(h1, call, h2, h3)
+				return blades.NewSessionContext(context.Background(), s)
+			}(),
+			sessionHist:   []*blades.Message{h1, call, h2, h3},
+			wantHistTexts: []string{"h2", "h3"},
+		},
+		{
+			name:       "cache hint, window start aligned",
+			maxMessage: 4,
+			ctx: func() context.Context {
+				s := newSessionWithHistory(h1, h2, h3, h4, h5)
+				ctx := blades.NewModelOptionsContext(context.Background(), blades.CacheHint())
+				return blades.NewSessionContext(ctx, s)
+			}(),
+			sessionHist:   []*blades.Message{h1, h2, h3, h4, h5},
+			wantHistTexts: []string{"h3", "h4", "h5"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -126,3 +152,97 @@ func TestConversationBuffered(t *testing.T) {
 		})
 	}
 }
+
+// TestStableWindow verifies that the window start only moves in steps, so that
+// consecutive turns share the same history prefix.
+func TestStableWindow(t *testing.T) {
+	t.Parallel()
+
+	var messages []*blades.Message
+	for range 10 {
+		messages = append(messages, blades.UserMessage("m"))
+	}
+	tests := []struct {
+		n, maxMessage, wantStart int
+	}{
+		{n: 3, maxMessage: 4, wantStart: 0},
+		{n: 5, maxMessage: 4, wantStart: 2},
+		{n: 6, maxMessage: 4, wantStart: 2},
+		{n: 7, maxMessage: 4, wantStart: 4},
+		{n: 10, maxMessage: 0, wantStart: 0},
+	}
+	for _, tt := range tests {
+		got := stableWindow(messages[:tt.n], tt.maxMessage)
+		if want := tt.n - tt.wantStart; len(got) != want {
+			t.Fatalf("n=%d max=%d: want %d messages, got %d", tt.n, tt.maxMessage, want, len(got))
+		}
+	}
+}
+
+// TestConversationToolHistory verifies that the tool exchange of a turn is
+// replayed to the model on the next turn.
+func TestConversationToolHistory(t *testing.T) {
+	var requests []*blades.ModelRequest
+	model := &scriptedModel{respond: func(req *blades.ModelRequest) *blades.Message {
+		requests = append(requests, req)
+		if last := req.Messages[len(req.Messages)-1]; last.Role == blades.RoleUser && len(requests) == 1 {
+			return &blades.Message{Role: blades.RoleTool, Status: blades.StatusCompleted, Parts: []blades.Part{
+				blades.ToolPart{ID: "call-1", Name: "weather", Request: `{"city":"Paris"}`},
+			}}
+		}
+		message := blades.NewAssistantMessage(blades.StatusCompleted)
+		message.Parts = blades.Parts("It is sunny.")
+		return message
+	}}
+	weather := tools.NewTool("weather", "Looks up the weather.", tools.HandleFunc(func(ctx context.Context, input string) (string, error) {
+		return "sunny", nil
+	}))
+	agent, err := blades.NewAgent("assistant", blades.WithModel(model), blades.WithTools(weather), blades.WithMiddleware(ConversationBuffered(10)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := blades.NewRunner(agent)
+	session := blades.NewSession()
+	for _, input := range []string{"Weather in Paris?", "And tomorrow?"} {
+		if _, err := runner.Run(context.Background(), blades.UserMessage(input), blades.WithSession(session)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The first turn made two model calls: the tool call and the answer.
+	if len(requests) != 3 {
+		t.Fatalf("want 3 model calls, got %d", len(requests))
+	}
+	var got []string
+	for _, m := range requests[2].Messages {
+		got = append(got, m.String())
+	}
+	want := []string{
+		"[Text: Weather in Paris?]",
+		`[Tool: weather (Request: {"city":"Paris"}, Response: sunny)]`,
+		"[Text: It is sunny.]",
+		"[Text: And tomorrow?]",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("want the second turn to replay the tool exchange %q, got %q", want, got)
+	}
+	if id := requests[2].Messages[1].Parts[0].(blades.ToolPart).ID; id != "call-1" {
+		t.Fatalf("want the call ID kept, got %q", id)
+	}
+}
+
+// scriptedModel answers every request with the message built by respond.
+type scriptedModel struct {
+	respond func(*blades.ModelRequest) *blades.Message
+}
+
+func (m *scriptedModel) Name() string { return "scripted" }
+
+func (m *scriptedModel) Generate(ctx context.Context, req *blades.ModelRequest) (*blades.ModelResponse, error) {
+	return &blades.ModelResponse{Message: m.respond(req)}, nil
+}
+
+func (m *scriptedModel) NewStreaming(ctx context.Context, req *blades.ModelRequest) blades.Generator[*blades.ModelResponse, error] {
+	return func(yield func(*blades.ModelResponse, error) bool) {
+		yield(m.Generate(ctx, req))
+	}
+}
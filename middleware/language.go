@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/go-kratos/blades"
+)
+
+// LanguageDetector returns the BCP-47 tag of the language of the text, or ""
+// if it cannot tell.
+type LanguageDetector func(ctx context.Context, text string) (string, error)
+
+// languageScripts maps scripts used by a single common language to its tag.
+var languageScripts = []struct {
+	table *unicode.RangeTable
+	tag   string
+}{
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Hangul, "ko"},
+	{unicode.Han, "zh"},
+	{unicode.Cyrillic, "ru"},
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+	{unicode.Greek, "el"},
+	{unicode.Thai, "th"},
+	{unicode.Devanagari, "hi"},
+}
+
+// languageStopwords are frequent words of languages written in the Latin script.
+var languageStopwords = map[string][]string{
+	"en": {"the", "and", "is", "are", "what", "how", "you", "to", "of", "in", "it", "please", "can", "my"},
+	"es": {"el", "la", "los", "las", "es", "que", "de", "y", "en", "por", "qué", "cómo", "para", "mi", "puedes"},
+	"fr": {"le", "la", "les", "est", "et", "que", "de", "des", "en", "pour", "quel", "comment", "vous", "je", "mon"},
+	"de": {"der", "die", "das", "ist", "und", "nicht", "ich", "sie", "wie", "was", "für", "mit", "ein", "eine", "mein"},
+	"pt": {"o", "os", "as", "é", "que", "de", "e", "em", "não", "para", "como", "você", "meu", "uma", "do"},
+	"it": {"il", "lo", "gli", "è", "che", "di", "e", "non", "per", "come", "sono", "mio", "una", "della", "ciao"},
+}
+
+// DetectLanguage is a LanguageDetector that guesses the language from the
+// script of the text and, for the Latin script, from frequent words.
+func DetectLanguage(ctx context.Context, text string) (string, error) {
+	counts := make(map[string]int)
+	letters := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		for _, s := range languageScripts {
+			if unicode.Is(s.table, r) {
+				counts[s.tag]++
+				break
+			}
+		}
+	}
+	// Japanese mixes kana with Han characters.
+	if counts["ja"] > 0 {
+		counts["ja"] += counts["zh"]
+		delete(counts, "zh")
+	}
+	best, bestCount := "", 0
+	for tag, n := range counts {
+		if n > bestCount {
+			best, bestCount = tag, n
+		}
+	}
+	if bestCount*2 > letters {
+		return best, nil
+	}
+	scores := make(map[string]int)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	}) {
+		for tag, stopwords := range languageStopwords {
+			for _, stopword := range stopwords {
+				if word == stopword {
+					scores[tag]++
+				}
+			}
+		}
+	}
+	best, bestCount = "", 0
+	for tag, n := range scores {
+		if n > bestCount || (n == bestCount && tag < best) {
+			best, bestCount = tag, n
+		}
+	}
+	return best, nil
+}
+
+const languageInstruction = `Identify the language of the user message. Answer with its BCP-47 tag only, e.g. "en" or "pt-BR".`
+
+// ModelLanguageDetector returns a LanguageDetector that asks the model.
+func ModelLanguageDetector(model blades.ModelProvider) LanguageDetector {
+	return func(ctx context.Context, text string) (string, error) {
+		res, err := model.Generate(ctx, &blades.ModelRequest{
+			Instruction: blades.SystemMessage(languageInstruction),
+			Messages:    []*blades.Message{blades.UserMessage(text)},
+		})
+		if err != nil {
+			return "", err
+		}
+		return strings.Trim(strings.TrimSpace(res.Message.Text()), `."'`), nil
+	}
+}
+
+// LanguageDetection is a middleware that detects the language of the first
+// user message of a session, stores it under blades.LanguageStateKey and
+// directs the agent to respond in it. Later turns keep that language even when
+// the user code-switches, since agents read it from the session state.
+// A nil detector uses DetectLanguage. Use it on agents without WithLanguage.
+func LanguageDetection(detect LanguageDetector) blades.Middleware {
+	if detect == nil {
+		detect = DetectLanguage
+	}
+	return func(next blades.Handler) blades.Handler {
+		return blades.HandleFunc(func(ctx context.Context, invocation *blades.Invocation) blades.Generator[*blades.Message, error] {
+			return func(yield func(*blades.Message, error) bool) {
+				if err := detectSessionLanguage(ctx, detect, invocation); err != nil {
+					yield(nil, err)
+					return
+				}
+				for msg, err := range next.Handle(ctx, invocation) {
+					if !yield(msg, err) {
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+// detectSessionLanguage sets the session language from the invocation message
+// unless it is already set to a valid tag.
+func detectSessionLanguage(ctx context.Context, detect LanguageDetector, invocation *blades.Invocation) error {
+	session := invocation.Session
+	if session == nil || invocation.Message == nil {
+		return nil
+	}
+	// An invalid value is replaced by the detected language.
+	if _, ok := blades.SessionLanguage(session); ok {
+		return nil
+	}
+	tag, err := detect(ctx, invocation.Message.Text())
+	if err != nil {
+		return fmt.Errorf("language detection: %w", err)
+	}
+	if tag == "" {
+		return nil
+	}
+	// The agent prepared this invocation before the session had a language.
+	if err := blades.AppendLanguageDirective(invocation, tag); err != nil {
+		return fmt.Errorf("language detection: %w", err)
+	}
+	session.SetState(blades.LanguageStateKey, tag)
+	return nil
+}
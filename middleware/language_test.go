@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-kratos/blades"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"What is the weather like in Paris today?", "en"},
+		{"¿Qué tiempo hace hoy en Madrid?", "es"},
+		{"Quel temps fait-il à Paris aujourd'hui ? Je voudrais le savoir.", "fr"},
+		{"Wie ist das Wetter heute in Berlin?", "de"},
+		{"Você pode me ajudar com o meu pedido?", "pt"},
+		{"今天北京的天气怎么样？", "zh"},
+		{"今日の東京の天気はどうですか？", "ja"},
+		{"오늘 서울 날씨 어때요?", "ko"},
+		{"Какая сегодня погода в Москве?", "ru"},
+		{"12345 !!!", ""},
+	}
+	for _, tt := range tests {
+		got, err := DetectLanguage(context.Background(), tt.text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%q: want %q, got %q", tt.text, tt.want, got)
+		}
+	}
+}
+
+func TestLanguageDetection(t *testing.T) {
+	t.Parallel()
+
+	var instructions []string
+	next := blades.HandleFunc(func(ctx context.Context, invocation *blades.Invocation) blades.Generator[*blades.Message, error] {
+		return func(yield func(*blades.Message, error) bool) {
+			text := ""
+			if invocation.Instruction != nil {
+				text = invocation.Instruction.Text()
+			}
+			instructions = append(instructions, text)
+			yield(blades.AssistantMessage("ok"), nil)
+		}
+	})
+	handler := LanguageDetection(nil)(next)
+	session := blades.NewSession()
+	// The user code-switches on the second turn.
+	for _, text := range []string{"¿Dónde está la estación de tren?", "Thanks! And what is the price of the ticket?"} {
+		invocation := &blades.Invocation{Session: session, Message: blades.UserMessage(text)}
+		for _, err := range handler.Handle(context.Background(), invocation) {
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if got := session.State()[blades.LanguageStateKey]; got != "es" {
+		t.Fatalf("want the session language es, got %v", got)
+	}
+	if !strings.Contains(instructions[0], "Spanish (es)") {
+		t.Fatalf("want the directive on the first turn, got %q", instructions[0])
+	}
+	// Later turns get the directive from the agent, which reads the session state.
+	if instructions[1] != "" {
+		t.Fatalf("want the language kept, got %q", instructions[1])
+	}
+}
@@ -0,0 +1,244 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/go-kratos/blades"
+)
+
+// ListOptions selects the stored messages of a session.
+type ListOptions struct {
+	// Last keeps only the most recent N messages. Zero keeps all of them.
+	Last int
+}
+
+// MessageStore durably stores the conversation of sessions, apart from the
+// session itself, e.g. for compliance or to rebuild a session that is gone.
+type MessageStore interface {
+	// Append stores the messages after those already stored for the session.
+	Append(ctx context.Context, sessionID string, messages []*blades.Message) error
+	// List returns the stored messages of the session in the order they
+	// were appended, or none if it has none.
+	List(ctx context.Context, sessionID string, opts ListOptions) ([]*blades.Message, error)
+}
+
+// PersistOption configures PersistMessages.
+type PersistOption func(*persister)
+
+// WithPersistToolMessages also stores the tool calls of the invocation and
+// their results. By default only the input and the final answer are stored.
+func WithPersistToolMessages(enabled bool) PersistOption {
+	return func(p *persister) {
+		p.tools = enabled
+	}
+}
+
+// WithPersistErrorHandler sets the function called when the messages cannot be
+// stored. The invocation fails with the error it returns, if any. By default
+// the error is logged, see WithPersistLogger, and the invocation succeeds.
+func WithPersistErrorHandler(fn func(ctx context.Context, err error) error) PersistOption {
+	return func(p *persister) {
+		p.onError = fn
+	}
+}
+
+// WithPersistLogger sets the logger of the errors of the default error
+// handler. Defaults to slog.Default().
+func WithPersistLogger(logger *slog.Logger) PersistOption {
+	return func(p *persister) {
+		p.logger = logger
+	}
+}
+
+// persister stores the messages of invocations.
+type persister struct {
+	store   MessageStore
+	tools   bool
+	logger  *slog.Logger
+	onError func(context.Context, error) error
+}
+
+// PersistMessages is a middleware that stores the input and the final answer
+// of every invocation that completes into the store, under the ID of its
+// session. Invocations without a session, or that fail, store nothing.
+func PersistMessages(store MessageStore, opts ...PersistOption) blades.Middleware {
+	p := &persister{store: store, logger: slog.Default()}
+	p.onError = func(ctx context.Context, err error) error {
+		p.logger.ErrorContext(ctx, "persist messages", "error", err)
+		return nil
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return func(next blades.Handler) blades.Handler {
+		return blades.HandleFunc(func(ctx context.Context, invocation *blades.Invocation) blades.Generator[*blades.Message, error] {
+			return func(yield func(*blades.Message, error) bool) {
+				var (
+					final *blades.Message
+					tools []*blades.Message
+				)
+				for message, err := range next.Handle(ctx, invocation) {
+					if !yield(message, err) || err != nil {
+						return
+					}
+					if message == nil || message.Status != blades.StatusCompleted {
+						continue
+					}
+					switch message.Role {
+					case blades.RoleAssistant:
+						final = message
+					case blades.RoleTool:
+						tools = append(tools, message)
+					}
+				}
+				if err := p.persist(ctx, invocation, tools, final); err != nil {
+					if err := p.onError(ctx, err); err != nil {
+						yield(nil, err)
+					}
+				}
+			}
+		})
+	}
+}
+
+// persist stores the messages of a completed invocation.
+func (p *persister) persist(ctx context.Context, invocation *blades.Invocation, tools []*blades.Message, final *blades.Message) error {
+	if invocation.Session == nil {
+		return nil
+	}
+	var messages []*blades.Message
+	if invocation.Message != nil {
+		messages = append(messages, invocation.Message)
+	}
+	if p.tools {
+		messages = append(messages, tools...)
+	}
+	if final != nil {
+		messages = append(messages, final)
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	sessionID := invocation.Session.ID()
+	if err := p.store.Append(context.WithoutCancel(ctx), sessionID, messages); err != nil {
+		return fmt.Errorf("session %s: %w", sessionID, err)
+	}
+	return nil
+}
+
+// LoadSession returns a new session with the ID and the stored messages of a
+// session, e.g. for a returning user whose in-memory session is gone.
+func LoadSession(ctx context.Context, store MessageStore, sessionID string, opts ListOptions) (blades.Session, error) {
+	messages, err := store.List(ctx, sessionID, opts)
+	if err != nil {
+		return nil, fmt.Errorf("load session %s: %w", sessionID, err)
+	}
+	session := blades.NewSessionWithID(sessionID)
+	for _, m := range messages {
+		if err := session.Append(ctx, m); err != nil {
+			return nil, fmt.Errorf("load session %s: %w", sessionID, err)
+		}
+	}
+	return session, nil
+}
+
+// lastMessages returns at most the last n messages, or all of them if n is zero.
+func lastMessages(messages []*blades.Message, n int) []*blades.Message {
+	if n > 0 && len(messages) > n {
+		return messages[len(messages)-n:]
+	}
+	return messages
+}
+
+// MessageVersion is the format version of the messages written by
+// FileMessageStore. Version 0 messages were written without an envelope.
+const MessageVersion = 1
+
+// messageMigrations upgrades the messages of older versions on load.
+var messageMigrations = blades.NewMigrations("message", MessageVersion).
+	Register(0, func(payload json.RawMessage) (json.RawMessage, error) { return payload, nil })
+
+// FileMessageStore is a MessageStore that appends the messages of each
+// session to a file of its own in a directory, one JSON object per line.
+type FileMessageStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewFileMessageStore creates a store writing to the directory, which is
+// created if needed.
+func NewFileMessageStore(dir string) (*FileMessageStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("message store: %w", err)
+	}
+	return &FileMessageStore{dir: dir}, nil
+}
+
+// path returns the file of the session.
+func (s *FileMessageStore) path(sessionID string) string {
+	return filepath.Join(s.dir, url.PathEscape(sessionID)+".jsonl")
+}
+
+// Append writes the messages as lines at the end of the file of the session.
+func (s *FileMessageStore) Append(ctx context.Context, sessionID string, messages []*blades.Message) error {
+	var data []byte
+	for _, m := range messages {
+		line, err := messageMigrations.Marshal(m)
+		if err != nil {
+			return fmt.Errorf("message store: encode: %w", err)
+		}
+		data = append(append(data, line...), '\n')
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.path(sessionID), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("message store: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("message store: %w", err)
+	}
+	return f.Close()
+}
+
+// List reads the messages of the session from its file.
+func (s *FileMessageStore) List(ctx context.Context, sessionID string, opts ListOptions) ([]*blades.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.Open(s.path(sessionID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("message store: %w", err)
+	}
+	defer f.Close()
+	var (
+		messages []*blades.Message
+		dec      = json.NewDecoder(f)
+	)
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("message store: decode %s: %w", sessionID, err)
+		}
+		var m blades.Message
+		if err := messageMigrations.Unmarshal(raw, &m); err != nil {
+			return nil, fmt.Errorf("message store: load %s: %w", sessionID, err)
+		}
+		messages = append(messages, &m)
+	}
+	return lastMessages(messages, opts.Last), nil
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/go-kratos/blades"
+)
+
+// SQLiteMessageStore is a MessageStore keeping the messages in a SQLite
+// table. The database is opened by the caller with the SQLite driver of their
+// choice, such as modernc.org/sqlite or github.com/mattn/go-sqlite3.
+type SQLiteMessageStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteMessageStore creates a store in the database, creating its
+// blades_messages table if needed.
+func NewSQLiteMessageStore(ctx context.Context, db *sql.DB) (*SQLiteMessageStore, error) {
+	const schema = `CREATE TABLE IF NOT EXISTS blades_messages (
+	seq INTEGER PRIMARY KEY AUTOINCREMENT,
+	session_id TEXT NOT NULL,
+	message TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS blades_messages_session ON blades_messages (session_id, seq)`
+	for _, stmt := range strings.Split(schema, ";\n") {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return nil, fmt.Errorf("message store: create table: %w", err)
+		}
+	}
+	return &SQLiteMessageStore{db: db}, nil
+}
+
+// Append inserts the messages in a single statement, so that either all of
+// them are stored or none is.
+func (s *SQLiteMessageStore) Append(ctx context.Context, sessionID string, messages []*blades.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	var (
+		values []string
+		args   []any
+	)
+	for _, m := range messages {
+		data, err := json.Marshal(m)
+		if err != nil {
+			return fmt.Errorf("message store: encode: %w", err)
+		}
+		values = append(values, "(?, ?)")
+		args = append(args, sessionID, string(data))
+	}
+	query := "INSERT INTO blades_messages (session_id, message) VALUES " + strings.Join(values, ", ")
+	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("message store: %w", err)
+	}
+	return nil
+}
+
+// List selects the messages of the session.
+func (s *SQLiteMessageStore) List(ctx context.Context, sessionID string, opts ListOptions) ([]*blades.Message, error) {
+	query, args := "SELECT message FROM blades_messages WHERE session_id = ? ORDER BY seq DESC", []any{sessionID}
+	if opts.Last > 0 {
+		query, args = query+" LIMIT ?", append(args, opts.Last)
+	}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("message store: %w", err)
+	}
+	defer rows.Close()
+	var messages []*blades.Message
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("message store: %w", err)
+		}
+		var m blades.Message
+		if err := json.Unmarshal([]byte(data), &m); err != nil {
+			return nil, fmt.Errorf("message store: decode %s: %w", sessionID, err)
+		}
+		messages = append(messages, &m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("message store: %w", err)
+	}
+	// The rows are selected newest first, so that LIMIT keeps the last ones.
+	slices.Reverse(messages)
+	return messages, nil
+}
@@ -0,0 +1,299 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-kratos/blades"
+	"github.com/go-kratos/blades/tools/toolstest"
+)
+
+// failingStore fails every call.
+type failingStore struct{}
+
+func (failingStore) Append(context.Context, string, []*blades.Message) error {
+	return errors.New("disk full")
+}
+
+func (failingStore) List(context.Context, string, ListOptions) ([]*blades.Message, error) {
+	return nil, errors.New("disk full")
+}
+
+// roles returns the roles and texts of the messages.
+func roles(messages []*blades.Message) []string {
+	var got []string
+	for _, m := range messages {
+		got = append(got, string(m.Role)+":"+m.Text())
+	}
+	return got
+}
+
+func TestPersistMessages(t *testing.T) {
+	tests := []struct {
+		name  string
+		tools bool
+		want  []string
+	}{
+		{name: "turns", want: []string{"user:weather?", "assistant:sunny", "user:thanks", "assistant:you're welcome"}},
+		{name: "tools", tools: true, want: []string{"user:weather?", "tool:", "assistant:sunny", "user:thanks", "assistant:you're welcome"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := NewFileMessageStore(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			model := toolstest.NewScriptedModel(
+				toolstest.CallTool("weather", map[string]string{"city": "Paris"}),
+				toolstest.Answer("sunny"),
+				toolstest.Answer("you're welcome"),
+			)
+			agent, err := blades.NewAgent("assistant",
+				blades.WithModel(model),
+				blades.WithTools(toolstest.NewStub("weather", "Returns the weather.", toolstest.Return("sunny"))),
+				blades.WithMiddleware(PersistMessages(store, WithPersistToolMessages(tt.tools))),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			session := blades.NewSession()
+			runner := blades.NewRunner(agent)
+			for _, input := range []string{"weather?", "thanks"} {
+				if _, err := runner.Run(context.Background(), blades.UserMessage(input), blades.WithSession(session)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			stored, err := store.List(context.Background(), session.ID(), ListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := roles(stored); !slices.Equal(got, tt.want) {
+				t.Fatalf("want %v, got %v", tt.want, got)
+			}
+			last, err := store.List(context.Background(), session.ID(), ListOptions{Last: 2})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := roles(last); !slices.Equal(got, tt.want[len(tt.want)-2:]) {
+				t.Fatalf("want the last 2 messages, got %v", got)
+			}
+			loaded, err := LoadSession(context.Background(), store, session.ID(), ListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if loaded.ID() != session.ID() || !slices.Equal(roles(loaded.History()), tt.want) {
+				t.Fatalf("unexpected loaded session %s: %v", loaded.ID(), roles(loaded.History()))
+			}
+		})
+	}
+}
+
+func TestPersistMessagesErrors(t *testing.T) {
+	newAgent := func(opts ...PersistOption) blades.Agent {
+		agent, err := blades.NewAgent("assistant",
+			blades.WithModel(toolstest.NewScriptedModel(toolstest.Answer("hi"))),
+			blades.WithMiddleware(PersistMessages(failingStore{}, opts...)),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return agent
+	}
+	// By default the error is logged and the run succeeds.
+	var logs strings.Builder
+	logged := newAgent(WithPersistLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+	if _, err := blades.NewRunner(logged).Run(context.Background(), blades.UserMessage("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs.String(), "level=ERROR") || !strings.Contains(logs.String(), "disk full") {
+		t.Fatalf("want the store error logged, got %q", logs.String())
+	}
+	strict := newAgent(WithPersistErrorHandler(func(ctx context.Context, err error) error {
+		return err
+	}))
+	if _, err := blades.NewRunner(strict).Run(context.Background(), blades.UserMessage("hello")); err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Fatalf("want the store error, got %v", err)
+	}
+	if _, err := LoadSession(context.Background(), failingStore{}, "s", ListOptions{}); err == nil {
+		t.Fatal("want the store error")
+	}
+}
+
+func TestSQLiteMessageStore(t *testing.T) {
+	db, err := sql.Open("sqlite-stub", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	store, err := NewSQLiteMessageStore(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Append(ctx, "a", []*blades.Message{blades.UserMessage("one"), blades.AssistantMessage("two")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Append(ctx, "b", []*blades.Message{blades.UserMessage("other")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Append(ctx, "a", []*blades.Message{blades.UserMessage("three")}); err != nil {
+		t.Fatal(err)
+	}
+	all, err := store.List(ctx, "a", ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"user:one", "assistant:two", "user:three"}; !slices.Equal(roles(all), want) {
+		t.Fatalf("want %v, got %v", want, roles(all))
+	}
+	last, err := store.List(ctx, "a", ListOptions{Last: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"assistant:two", "user:three"}; !slices.Equal(roles(last), want) {
+		t.Fatalf("want %v, got %v", want, roles(last))
+	}
+}
+
+// sqliteStub is a database/sql driver that runs the statements of
+// SQLiteMessageStore in memory.
+type sqliteStub struct {
+	mu  sync.Mutex
+	dbs map[string]*stubTable
+}
+
+// stubTable is the blades_messages table of a stub database.
+type stubTable struct {
+	sessions []string
+	messages []string
+}
+
+func init() {
+	sql.Register("sqlite-stub", &sqliteStub{dbs: make(map[string]*stubTable)})
+}
+
+func (d *sqliteStub) Open(name string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.dbs[name] == nil {
+		d.dbs[name] = &stubTable{}
+	}
+	return &stubConn{driver: d, table: d.dbs[name]}, nil
+}
+
+type stubConn struct {
+	driver *sqliteStub
+	table  *stubTable
+}
+
+func (c *stubConn) Prepare(query string) (driver.Stmt, error) {
+	return &stubStmt{conn: c, query: query}, nil
+}
+
+func (c *stubConn) Close() error { return nil }
+
+func (c *stubConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+type stubStmt struct {
+	conn  *stubConn
+	query string
+}
+
+func (s *stubStmt) Close() error  { return nil }
+func (s *stubStmt) NumInput() int { return -1 }
+
+func (s *stubStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.conn.driver.mu.Lock()
+	defer s.conn.driver.mu.Unlock()
+	switch {
+	case strings.HasPrefix(s.query, "CREATE"):
+	case strings.HasPrefix(s.query, "INSERT INTO blades_messages (session_id, message) VALUES "):
+		for i := 0; i+1 < len(args); i += 2 {
+			s.conn.table.sessions = append(s.conn.table.sessions, args[i].(string))
+			s.conn.table.messages = append(s.conn.table.messages, args[i+1].(string))
+		}
+	default:
+		return nil, errors.New("unexpected statement: " + s.query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *stubStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if !strings.HasPrefix(s.query, "SELECT message FROM blades_messages WHERE session_id = ? ORDER BY seq DESC") {
+		return nil, errors.New("unexpected query: " + s.query)
+	}
+	s.conn.driver.mu.Lock()
+	defer s.conn.driver.mu.Unlock()
+	var rows []string
+	for i := len(s.conn.table.messages) - 1; i >= 0; i-- {
+		if s.conn.table.sessions[i] == args[0] {
+			rows = append(rows, s.conn.table.messages[i])
+		}
+	}
+	if len(args) > 1 {
+		rows = rows[:min(len(rows), int(args[1].(int64)))]
+	}
+	return &stubRows{rows: rows}, nil
+}
+
+type stubRows struct {
+	rows []string
+}
+
+func (r *stubRows) Columns() []string { return []string{"message"} }
+func (r *stubRows) Close() error      { return nil }
+
+func (r *stubRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	dest[0], r.rows = r.rows[0], r.rows[1:]
+	return nil
+}
+
+// TestFileMessageStoreFixtures loads the messages written by older versions
+// of the format, checked in under testdata/migrations.
+func TestFileMessageStoreFixtures(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "migrations", "message_v0.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "session-1.jsonl"), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewFileMessageStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := store.Append(ctx, "session-1", []*blades.Message{blades.UserMessage("Thanks!")}); err != nil {
+		t.Fatal(err)
+	}
+	messages, err := store.List(ctx, "session-1", ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"user:What is the weather in Paris?", "tool:", "assistant:It is 21°C in Paris.", "user:Thanks!"}
+	if got := roles(messages); !slices.Equal(got, want) {
+		t.Fatalf("messages = %q, want %q", got, want)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "future.jsonl"), []byte(`{"kind":"message","version":99,"payload":{}}`+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.List(ctx, "future", ListOptions{}); !errors.Is(err, blades.ErrFutureVersion) {
+		t.Fatalf("want ErrFutureVersion, got %v", err)
+	}
+}
@@ -19,6 +19,7 @@ import (
 //   - The same invocation is passed to the handler on each attempt. Handlers must not mutate the invocation.
 //   - If all attempts are exhausted and the handler continues to return an error, the last error is returned.
 //   - Successfully generated messages from failed attempts are not replayed on subsequent retries.
+//   - The StatusFailed message of an attempt is only yielded when no further attempt is made.
 //   - Retry behavior (e.g., backoff, which errors are retryable) can be customized via retry.Option.
 //   - Context cancellation is respected during retry attempts.
 //
@@ -36,23 +37,38 @@ func Retry(attempts int, opts ...retry.Option) blades.Middleware {
 	return func(next blades.Handler) blades.Handler {
 		return blades.HandleFunc(func(ctx context.Context, invocation *blades.Invocation) blades.Generator[*blades.Message, error] {
 			return func(yield func(*blades.Message, error) bool) {
+				// failed is the StatusFailed message of the current attempt. It is
+				// held back until the attempt is known to be the last one, so that
+				// the caller does not see the failure of an attempt that is retried.
+				var failed *blades.Message
 				err := r.Do(ctx, func(ctx context.Context) error {
+					failed = nil
 					// Execute the handler and yield messages
 					for msg, err := range next.Handle(ctx, invocation) {
 						if err != nil {
 							return err
 						}
+						if msg != nil && msg.Status == blades.StatusFailed {
+							failed = msg
+							continue
+						}
 						// Yield successful messages immediately
 						if !yield(msg, nil) {
 							// Receiver stopped processing
 							return nil
 						}
 					}
+					if failed != nil {
+						yield(failed, nil)
+					}
 					return nil
 				})
 
-				// If all retries failed, yield the final error
+				// If all retries failed, yield the failure and the final error
 				if err != nil {
+					if failed != nil && !yield(failed, nil) {
+						return
+					}
 					yield(nil, err)
 				}
 			}
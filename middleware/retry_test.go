@@ -327,3 +327,54 @@ func TestRetry_ReceiverStopsProcessing(t *testing.T) {
 		t.Errorf("expected no error, got %v", lastErr)
 	}
 }
+
+func TestRetry_FailedMessages(t *testing.T) {
+	for _, succeedOn := range []int{2, 0} {
+		middleware := Retry(3)
+
+		attempts := 0
+		handler := middleware(blades.HandleFunc(func(ctx context.Context, invocation *blades.Invocation) blades.Generator[*blades.Message, error] {
+			attempts++
+			return func(yield func(*blades.Message, error) bool) {
+				if attempts == succeedOn {
+					yield(blades.AssistantMessage("success"), nil)
+					return
+				}
+				err := fmt.Errorf("attempt %d failed", attempts)
+				if !yield(blades.NewFailedMessage("agent", blades.ErrorClassModel, err, ""), nil) {
+					return
+				}
+				yield(nil, err)
+			}
+		}))
+
+		invocation := &blades.Invocation{
+			ID:      "test",
+			Message: blades.UserMessage("test"),
+		}
+
+		var messages []*blades.Message
+		var lastErr error
+		for msg, err := range handler.Handle(context.Background(), invocation) {
+			if err != nil {
+				lastErr = err
+				break
+			}
+			messages = append(messages, msg)
+		}
+
+		if succeedOn > 0 {
+			// The failure of the retried attempt is not seen by the caller.
+			if lastErr != nil || len(messages) != 1 || messages[0].Text() != "success" {
+				t.Errorf("expected only the success, got %v, %v", messages, lastErr)
+			}
+			continue
+		}
+		if len(messages) != 1 || messages[0].Status != blades.StatusFailed || messages[0].Error.Message != "attempt 3 failed" {
+			t.Errorf("expected the failure of the last attempt, got %v", messages)
+		}
+		if lastErr == nil {
+			t.Error("expected an error")
+		}
+	}
+}
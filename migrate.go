@@ -0,0 +1,153 @@
+package blades
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Envelope wraps persisted data with the kind and the version of its format,
+// so that data written by an older version of blades can be migrated on load.
+type Envelope struct {
+	Kind    string          `json:"kind"`
+	Version int             `json:"version"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Migration upgrades a payload from a version of its format to the next one.
+type Migration func(payload json.RawMessage) (json.RawMessage, error)
+
+// FutureVersionError is returned when persisted data was written by a newer
+// version of blades than the one loading it. It unwraps to ErrFutureVersion.
+type FutureVersionError struct {
+	Kind      string
+	Version   int
+	Supported int
+}
+
+func (e *FutureVersionError) Error() string {
+	return fmt.Sprintf("%s: version %d is newer than the supported version %d; upgrade blades to load it", e.Kind, e.Version, e.Supported)
+}
+
+func (e *FutureVersionError) Unwrap() error {
+	return ErrFutureVersion
+}
+
+// Migrations is the registry of the migrations of a persisted format, from
+// each version to the next one up to its current version. Data written
+// before the format was enveloped is read as its top-level "version" field,
+// or version 0 without one.
+type Migrations struct {
+	kind    string
+	current int
+
+	mu    sync.RWMutex
+	steps map[int]Migration
+}
+
+// NewMigrations returns the registry of the format of the kind, currently at
+// the version.
+func NewMigrations(kind string, current int) *Migrations {
+	return &Migrations{kind: kind, current: current, steps: make(map[int]Migration)}
+}
+
+// Kind returns the kind of the format.
+func (m *Migrations) Kind() string {
+	return m.kind
+}
+
+// Version returns the current version of the format.
+func (m *Migrations) Version() int {
+	return m.current
+}
+
+// Register adds the migration from the version to the next one. It panics if
+// the version is out of range or already has a migration, which is a
+// programming error.
+func (m *Migrations) Register(from int, migration Migration) *Migrations {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if from < 0 || from >= m.current {
+		panic(fmt.Sprintf("blades: %s: migration from version %d out of range [0, %d)", m.kind, from, m.current))
+	}
+	if _, ok := m.steps[from]; ok {
+		panic(fmt.Sprintf("blades: %s: duplicate migration from version %d", m.kind, from))
+	}
+	m.steps[from] = migration
+	return m
+}
+
+// Marshal encodes the value as the payload of an envelope at the current version.
+func (m *Migrations) Marshal(v any) ([]byte, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s: encode: %w", m.kind, err)
+	}
+	return json.Marshal(Envelope{Kind: m.kind, Version: m.current, Payload: payload})
+}
+
+// Unmarshal migrates the payload of the data to the current version and
+// decodes it into v. It returns a *FutureVersionError for data of a newer version.
+func (m *Migrations) Unmarshal(data []byte, v any) error {
+	payload, err := m.Migrate(data)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(payload, v); err != nil {
+		return fmt.Errorf("%s: decode: %w", m.kind, err)
+	}
+	return nil
+}
+
+// Migrate returns the payload of the data migrated to the current version.
+func (m *Migrations) Migrate(data []byte) (json.RawMessage, error) {
+	version, payload, err := m.open(data)
+	if err != nil {
+		return nil, err
+	}
+	if version > m.current {
+		return nil, &FutureVersionError{Kind: m.kind, Version: version, Supported: m.current}
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for ; version < m.current; version++ {
+		migration, ok := m.steps[version]
+		if !ok {
+			return nil, fmt.Errorf("%s: no migration from version %d", m.kind, version)
+		}
+		if payload, err = migration(payload); err != nil {
+			return nil, fmt.Errorf("%s: migrate from version %d: %w", m.kind, version, err)
+		}
+	}
+	return payload, nil
+}
+
+// open returns the version and the payload of the data, enveloped or not.
+func (m *Migrations) open(data []byte) (int, json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return 0, nil, fmt.Errorf("%s: decode: %w", m.kind, err)
+	}
+	var version int
+	if raw, ok := fields["version"]; ok {
+		if err := json.Unmarshal(raw, &version); err != nil {
+			return 0, nil, fmt.Errorf("%s: decode version: %w", m.kind, err)
+		}
+	}
+	payload, enveloped := fields["payload"]
+	if !enveloped {
+		return version, bytes.Clone(data), nil
+	}
+	var kind string
+	if err := json.Unmarshal(fields["kind"], &kind); err != nil || kind != m.kind {
+		return 0, nil, fmt.Errorf("%s: unexpected kind %q", m.kind, kind)
+	}
+	return version, payload, nil
+}
+
+// keepPayload is the migration of a format whose payload did not change,
+// only its envelope.
+func keepPayload(payload json.RawMessage) (json.RawMessage, error) {
+	return payload, nil
+}
@@ -0,0 +1,195 @@
+package blades
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMigrations(t *testing.T) {
+	type note struct {
+		Text   string `json:"text"`
+		Author string `json:"author"`
+	}
+	migrations := NewMigrations("note", 2).
+		Register(0, func(payload json.RawMessage) (json.RawMessage, error) {
+			var v map[string]any
+			if err := json.Unmarshal(payload, &v); err != nil {
+				return nil, err
+			}
+			v["text"], v["body"] = v["body"], nil
+			return json.Marshal(v)
+		}).
+		Register(1, func(payload json.RawMessage) (json.RawMessage, error) {
+			var v map[string]any
+			if err := json.Unmarshal(payload, &v); err != nil {
+				return nil, err
+			}
+			if v["author"] == nil {
+				v["author"] = "unknown"
+			}
+			return json.Marshal(v)
+		})
+	tests := []struct {
+		name string
+		data string
+		want note
+		err  string
+	}{
+		{name: "legacy", data: `{"body":"hello"}`, want: note{Text: "hello", Author: "unknown"}},
+		{name: "version 1", data: `{"kind":"note","version":1,"payload":{"text":"hello"}}`, want: note{Text: "hello", Author: "unknown"}},
+		{name: "current", data: `{"kind":"note","version":2,"payload":{"text":"hello","author":"ana"}}`, want: note{Text: "hello", Author: "ana"}},
+		{name: "future", data: `{"kind":"note","version":3,"payload":{}}`, err: "upgrade blades"},
+		{name: "other kind", data: `{"kind":"memo","version":2,"payload":{}}`, err: "unexpected kind"},
+		{name: "malformed", data: `{"kind":`, err: "decode"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got note
+			err := migrations.Unmarshal([]byte(tt.data), &got)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+	data, err := migrations.Marshal(note{Text: "hi", Author: "ana"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"kind":"note","version":2,"payload":{"text":"hi","author":"ana"}}`; string(data) != want {
+		t.Fatalf("envelope = %s, want %s", data, want)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("want a panic for a duplicate migration")
+		}
+	}()
+	migrations.Register(1, keepPayload)
+}
+
+// copyFixture copies the fixture of an older format version to a temporary file.
+func copyFixture(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "migrations", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestMigrationFixtures loads the data written by older versions of the
+// persisted formats, checked in under testdata/migrations.
+func TestMigrationFixtures(t *testing.T) {
+	ctx := context.Background()
+	const answer = "It is 21°C in Paris."
+	t.Run("transcript entry v0", func(t *testing.T) {
+		store := NewJSONLTranscriptStore(copyFixture(t, "transcript_entry_v0.jsonl"))
+		if err := store.Append(ctx, TranscriptEntry{InvocationID: "inv-1.review", Model: "gpt-4o-mini"}); err != nil {
+			t.Fatal(err)
+		}
+		transcript, err := store.Load(ctx, "inv-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(transcript.Entries) != 2 {
+			t.Fatalf("got %d entries, want 2", len(transcript.Entries))
+		}
+		old := transcript.Entries[0]
+		if old.Model != "gpt-4o" || old.Response.Text() != answer || old.Request.Tools[0].Name != "get_weather" {
+			t.Fatalf("unexpected entry: %+v", old)
+		}
+	})
+	t.Run("feedback v0", func(t *testing.T) {
+		feedback, err := NewJSONLFeedbackStore(copyFixture(t, "feedback_v0.jsonl")).List(ctx, "inv-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(feedback) != 1 || feedback[0].Rating != RatingPositive || feedback[0].MessageID != "msg-3" {
+			t.Fatalf("unexpected feedback: %+v", feedback)
+		}
+	})
+	t.Run("batch checkpoint v0", func(t *testing.T) {
+		restored, err := loadBatchCheckpoint(copyFixture(t, "batch_checkpoint_v0.jsonl"), []*Message{UserMessage("What is the weather in Paris?")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result, ok := restored[0]; !ok || result.Output.Text() != answer || result.Usage.TotalTokens != 50 {
+			t.Fatalf("unexpected results: %+v", restored)
+		}
+	})
+	t.Run("session snapshot v1", func(t *testing.T) {
+		data, err := os.ReadFile(filepath.Join("testdata", "migrations", "session_snapshot_v1.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		session, err := Restore(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		history := session.History()
+		if session.ID() != "session-1" || session.State()["city"] != "Paris" || len(history) != 3 || history[2].Text() != answer {
+			t.Fatalf("unexpected session %s: %v %v", session.ID(), session.State(), history)
+		}
+		if _, ok := history[1].Parts[0].(ToolPart); !ok {
+			t.Fatalf("want a tool part, got %#v", history[1].Parts[0])
+		}
+	})
+}
+
+func TestFutureVersions(t *testing.T) {
+	ctx := context.Background()
+	future := func(m *Migrations) string {
+		return `{"kind":"` + m.Kind() + `","version":99,"payload":{}}`
+	}
+	write := func(t *testing.T, data string) string {
+		path := filepath.Join(t.TempDir(), "data.jsonl")
+		if err := os.WriteFile(path, []byte(data+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	loads := map[string]func(t *testing.T) error{
+		"transcript": func(t *testing.T) error {
+			_, err := NewJSONLTranscriptStore(write(t, future(transcriptMigrations))).Load(ctx, "inv-1")
+			return err
+		},
+		"feedback": func(t *testing.T) error {
+			_, err := NewJSONLFeedbackStore(write(t, future(feedbackMigrations))).List(ctx, "")
+			return err
+		},
+		"batch checkpoint": func(t *testing.T) error {
+			_, err := loadBatchCheckpoint(write(t, future(batchMigrations)), nil)
+			return err
+		},
+		"snapshot": func(t *testing.T) error {
+			_, err := Restore([]byte(future(snapshotMigrations)))
+			return err
+		},
+	}
+	for name, load := range loads {
+		t.Run(name, func(t *testing.T) {
+			err := load(t)
+			var futureErr *FutureVersionError
+			if !errors.As(err, &futureErr) || !errors.Is(err, ErrFutureVersion) || futureErr.Version != 99 {
+				t.Fatalf("want a FutureVersionError, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package blades
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// mockModel is a scripted ModelProvider used by tests.
+type mockModel struct {
+	name     string
+	calls    atomic.Int64
+	generate func(context.Context, *ModelRequest) (*ModelResponse, error)
+}
+
+func (m *mockModel) Name() string {
+	if m.name == "" {
+		return "mock"
+	}
+	return m.name
+}
+
+func (m *mockModel) Generate(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+	m.calls.Add(1)
+	return m.generate(ctx, req)
+}
+
+func (m *mockModel) NewStreaming(ctx context.Context, req *ModelRequest) Generator[*ModelResponse, error] {
+	return func(yield func(*ModelResponse, error) bool) {
+		res, err := m.Generate(ctx, req)
+		yield(res, err)
+	}
+}
+
+// textResponse builds a completed assistant response with the given text.
+func textResponse(text string) *ModelResponse {
+	message := NewAssistantMessage(StatusCompleted)
+	message.Parts = Parts(text)
+	return &ModelResponse{Message: message}
+}
@@ -2,6 +2,10 @@ package blades
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
 
 	"github.com/go-kratos/blades/tools"
 	"github.com/google/jsonschema-go/jsonschema"
@@ -14,11 +18,201 @@ type ModelRequest struct {
 	Instruction  *Message           `json:"instruction,omitempty"`
 	InputSchema  *jsonschema.Schema `json:"inputSchema,omitempty"`
 	OutputSchema *jsonschema.Schema `json:"outputSchema,omitempty"`
+	Options      ModelOptions       `json:"options,omitzero"`
+	// Extensions are raw fields merged into the JSON body the provider sends,
+	// for provider parameters blades does not model; see MergeExtensions.
+	Extensions map[string]any `json:"extensions,omitempty"`
+}
+
+// ProviderExtensions returns the provider options of the request overlaid
+// with its extensions.
+func (r *ModelRequest) ProviderExtensions() map[string]any {
+	if len(r.Options.ProviderOptions) == 0 {
+		return r.Extensions
+	}
+	extensions := maps.Clone(r.Options.ProviderOptions)
+	maps.Copy(extensions, r.Extensions)
+	return extensions
+}
+
+// ModelOptions holds per-request generation settings.
+// Set fields override the provider's construction-time config;
+// providers that do not support a setting ignore it with a warning.
+type ModelOptions struct {
+	// Seed requests deterministic sampling where the provider supports it.
+	Seed *int64 `json:"seed,omitempty"`
+	// StopSequences stops generation before any of the given sequences is produced.
+	StopSequences []string `json:"stopSequences,omitempty"`
+	// FrequencyPenalty penalizes tokens by how often they already appeared.
+	FrequencyPenalty *float64 `json:"frequencyPenalty,omitempty"`
+	// PresencePenalty penalizes tokens that already appeared at all.
+	PresencePenalty *float64 `json:"presencePenalty,omitempty"`
+	// TopK samples only from the K most likely tokens.
+	TopK *int64 `json:"topK,omitempty"`
+	// CacheHint marks the instruction and the history prefix as stable, so
+	// that providers with explicit prompt caching cache them across turns.
+	CacheHint bool `json:"cacheHint,omitempty"`
+	// CandidateCount requests several alternative responses, which providers
+	// return in ModelResponse.Alternatives. Streaming supports only one.
+	CandidateCount int64 `json:"candidateCount,omitempty"`
+	// Logprobs asks for the log probabilities of the answer tokens, which
+	// providers that return them report under AverageLogprobKey.
+	Logprobs bool `json:"logprobs,omitempty"`
+	// ProviderOptions are raw fields merged into the JSON body the provider
+	// sends, like ModelRequest.Extensions.
+	ProviderOptions map[string]any `json:"providerOptions,omitempty"`
+}
+
+// IgnoredOptionsKey is the message metadata key under which providers list
+// the names of model options they do not support and ignored.
+const IgnoredOptionsKey = "ignored_options"
+
+// ModelOption configures ModelOptions.
+type ModelOption func(*ModelOptions)
+
+// Seed sets the sampling seed so that repeated requests return the same
+// output as far as the provider allows.
+func Seed(seed int64) ModelOption {
+	return func(o *ModelOptions) {
+		o.Seed = &seed
+	}
+}
+
+// StopSequences sets the sequences that stop generation, e.g. "\n\n".
+func StopSequences(sequences ...string) ModelOption {
+	return func(o *ModelOptions) {
+		o.StopSequences = slices.Clone(sequences)
+	}
+}
+
+// FrequencyPenalty sets the frequency penalty used to curb repetitive output.
+func FrequencyPenalty(penalty float64) ModelOption {
+	return func(o *ModelOptions) {
+		o.FrequencyPenalty = &penalty
+	}
+}
+
+// PresencePenalty sets the presence penalty used to encourage new topics.
+func PresencePenalty(penalty float64) ModelOption {
+	return func(o *ModelOptions) {
+		o.PresencePenalty = &penalty
+	}
+}
+
+// TopK limits sampling to the K most likely tokens.
+func TopK(k int64) ModelOption {
+	return func(o *ModelOptions) {
+		o.TopK = &k
+	}
+}
+
+// CacheHint asks the provider to cache the instruction and the stable history
+// prefix of the request. Providers that cache automatically only report the
+// cached tokens in TokenUsage.CachedInputTokens.
+func CacheHint() ModelOption {
+	return func(o *ModelOptions) {
+		o.CacheHint = true
+	}
+}
+
+// Logprobs asks for the log probabilities of the answer tokens, e.g. to
+// estimate the confidence in the answer with ConfidenceLogprobs.
+func Logprobs() ModelOption {
+	return func(o *ModelOptions) {
+		o.Logprobs = true
+	}
+}
+
+// CandidateCount requests n alternative responses, e.g. for best-of-n
+// sampling with WithCandidateSelector.
+func CandidateCount(n int64) ModelOption {
+	return func(o *ModelOptions) {
+		o.CandidateCount = n
+	}
+}
+
+// ProviderOptions sets raw fields of the provider's request body, such as
+// OpenAI's "service_tier", for parameters blades does not model. Fields set
+// by the provider, including those of the other options, cannot be overridden.
+func ProviderOptions(options map[string]any) ModelOption {
+	return func(o *ModelOptions) {
+		if o.ProviderOptions == nil {
+			o.ProviderOptions = make(map[string]any, len(options))
+		}
+		maps.Copy(o.ProviderOptions, options)
+	}
+}
+
+// Apply applies the given options to o.
+func (o *ModelOptions) Apply(opts ...ModelOption) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
+
+// ctxModelOptionsKey is the context key for model options.
+type ctxModelOptionsKey struct{}
+
+// NewModelOptionsContext returns a new context that carries model options.
+// They are applied to every model request made with the context, after the
+// agent's own options, so a caller can set e.g. a seed for a whole run.
+func NewModelOptionsContext(ctx context.Context, opts ...ModelOption) context.Context {
+	parent, _ := FromModelOptionsContext(ctx)
+	return context.WithValue(ctx, ctxModelOptionsKey{}, append(slices.Clip(parent), opts...))
+}
+
+// FromModelOptionsContext retrieves the model options from the context, if present.
+func FromModelOptionsContext(ctx context.Context) ([]ModelOption, bool) {
+	opts, ok := ctx.Value(ctxModelOptionsKey{}).([]ModelOption)
+	return opts, ok
 }
 
 // ModelResponse is a single assistant message as a result of generation.
 type ModelResponse struct {
 	Message *Message `json:"message"`
+	// Alternatives are the other candidates requested with CandidateCount.
+	// The token usage of all candidates is reported on Message.
+	Alternatives []*Message `json:"alternatives,omitempty"`
+	// RawResponse is the JSON response of the provider, or of the chunk for
+	// streaming responses, for fields blades does not model. Providers whose
+	// SDK does not keep the body re-encode the response it decoded.
+	RawResponse json.RawMessage `json:"rawResponse,omitempty"`
+}
+
+// MergeExtensions merges the extensions into the JSON body of a provider
+// request. Objects are merged key by key; any other value already set in the
+// body is a conflict, reported as an error wrapping ErrExtensionConflict, so
+// that extensions cannot silently override first-class options. On a
+// conflict the body is left unchanged.
+func MergeExtensions(body, extensions map[string]any) error {
+	merged := maps.Clone(body)
+	if err := mergeExtensions(merged, extensions, ""); err != nil {
+		return err
+	}
+	maps.Copy(body, merged)
+	return nil
+}
+
+func mergeExtensions(body, extensions map[string]any, prefix string) error {
+	for _, key := range slices.Sorted(maps.Keys(extensions)) {
+		value, path := extensions[key], prefix+key
+		existing, ok := body[key]
+		if !ok {
+			body[key] = value
+			continue
+		}
+		existingObject, ok1 := existing.(map[string]any)
+		object, ok2 := value.(map[string]any)
+		if !ok1 || !ok2 {
+			return fmt.Errorf("%w: %q is set by the request", ErrExtensionConflict, path)
+		}
+		merged := maps.Clone(existingObject)
+		if err := mergeExtensions(merged, object, path+"."); err != nil {
+			return err
+		}
+		body[key] = merged
+	}
+	return nil
 }
 
 // ModelProvider is an interface for multimodal chat-style models.
@@ -0,0 +1,228 @@
+package blades
+
+import (
+	"strings"
+	"sync"
+)
+
+// Support tells whether a model has a capability.
+type Support int
+
+const (
+	// SupportUnknown is a capability nothing is known about; the framework
+	// then leaves it to the provider.
+	SupportUnknown Support = iota
+	// Supported is a capability the model has.
+	Supported
+	// Unsupported is a capability the model lacks.
+	Unsupported
+)
+
+// ModelCapabilities describes what a model can do. Zero fields are unknown.
+type ModelCapabilities struct {
+	// ContextWindow is the maximum number of tokens the model accepts per request.
+	ContextWindow int64
+	// Tools is whether the model calls tools.
+	Tools Support
+	// Vision is whether the model takes image input.
+	Vision Support
+	// StructuredOutput is whether the model constrains its answer to the
+	// output schema of the request.
+	StructuredOutput Support
+	// StreamingUsage is whether streamed responses report the token usage.
+	StreamingUsage Support
+	// Logprobs is whether the model returns the log probabilities of the
+	// answer tokens; see the Logprobs model option.
+	Logprobs Support
+}
+
+// ModelInfo describes static properties of a model.
+//
+// Deprecated: Use ModelCapabilities.
+type ModelInfo = ModelCapabilities
+
+// CapabilityProvider is implemented by model providers that know the
+// capabilities of the models they serve, such as what their API adapter
+// supports. They override the defaults registered for the model name and are
+// overridden by RegisterModelCapabilities.
+type CapabilityProvider interface {
+	Capabilities(model string) ModelCapabilities
+}
+
+// merge returns the capabilities with the known fields of o replacing theirs.
+func (c ModelCapabilities) merge(o ModelCapabilities) ModelCapabilities {
+	if o.ContextWindow > 0 {
+		c.ContextWindow = o.ContextWindow
+	}
+	for _, f := range []struct{ dst, src *Support }{
+		{&c.Tools, &o.Tools},
+		{&c.Vision, &o.Vision},
+		{&c.StructuredOutput, &o.StructuredOutput},
+		{&c.StreamingUsage, &o.StreamingUsage},
+		{&c.Logprobs, &o.Logprobs},
+	} {
+		if *f.src != SupportUnknown {
+			*f.dst = *f.src
+		}
+	}
+	return c
+}
+
+// chat is a chat model with the capabilities most current models have.
+func chat(contextWindow int64) ModelCapabilities {
+	return ModelCapabilities{
+		ContextWindow:    contextWindow,
+		Tools:            Supported,
+		Vision:           Supported,
+		StructuredOutput: Supported,
+		StreamingUsage:   Supported,
+	}
+}
+
+// textOnly is a chat model without image input.
+func textOnly(contextWindow int64) ModelCapabilities {
+	c := chat(contextWindow)
+	c.Vision = Unsupported
+	return c
+}
+
+// logprobs is a model that returns the log probabilities of its tokens,
+// or, for support Unsupported, a model that does not.
+func logprobs(support Support, c ModelCapabilities) ModelCapabilities {
+	c.Logprobs = support
+	return c
+}
+
+// withoutSchema is a model without structured output, e.g. on an API with no
+// output schema parameter.
+func withoutSchema(c ModelCapabilities) ModelCapabilities {
+	c.StructuredOutput = Unsupported
+	return c
+}
+
+var (
+	capabilitiesMu sync.RWMutex
+	// defaultCapabilities are the capabilities of common models, by name or
+	// name prefix. Bedrock models are listed by their model ID.
+	defaultCapabilities = map[string]ModelCapabilities{
+		// OpenAI
+		"gpt-5":         logprobs(Unsupported, chat(400000)),
+		"gpt-4.1":       logprobs(Supported, chat(1047576)),
+		"gpt-4o":        logprobs(Supported, chat(128000)),
+		"gpt-4-turbo":   logprobs(Supported, withoutSchema(chat(128000))),
+		"gpt-3.5-turbo": logprobs(Supported, withoutSchema(textOnly(16385))),
+		"o1":            logprobs(Unsupported, chat(200000)),
+		"o1-mini":       {ContextWindow: 128000, Tools: Unsupported, Vision: Unsupported, StructuredOutput: Unsupported, StreamingUsage: Supported, Logprobs: Unsupported},
+		"o3":            logprobs(Unsupported, chat(200000)),
+		"o3-mini":       logprobs(Unsupported, textOnly(200000)),
+		"o4-mini":       logprobs(Unsupported, chat(200000)),
+		// Anthropic
+		"claude-opus-4":     logprobs(Unsupported, chat(200000)),
+		"claude-sonnet-4":   logprobs(Unsupported, chat(200000)),
+		"claude-3-7-sonnet": logprobs(Unsupported, chat(200000)),
+		"claude-3-5-haiku":  logprobs(Unsupported, chat(200000)),
+		// Gemini
+		"gemini-2.5-pro":   chat(1048576),
+		"gemini-2.5-flash": chat(1048576),
+		"gemini-2.0-flash": logprobs(Supported, chat(1048576)),
+		// DeepSeek
+		"deepseek-chat":     logprobs(Supported, withoutSchema(textOnly(65536))),
+		"deepseek-reasoner": {ContextWindow: 65536, Vision: Unsupported, StructuredOutput: Unsupported, StreamingUsage: Supported, Logprobs: Unsupported},
+		// Bedrock, whose Converse API has no output schema parameter
+		"anthropic.claude-opus-4":     withoutSchema(chat(200000)),
+		"anthropic.claude-sonnet-4":   withoutSchema(chat(200000)),
+		"anthropic.claude-3-7-sonnet": withoutSchema(chat(200000)),
+		"anthropic.claude-3-5-haiku":  withoutSchema(chat(200000)),
+		"amazon.nova-premier":         withoutSchema(chat(1000000)),
+		"amazon.nova-pro":             withoutSchema(chat(300000)),
+		"amazon.nova-lite":            withoutSchema(chat(300000)),
+		"amazon.nova-micro":           withoutSchema(textOnly(128000)),
+		"meta.llama3-1":               withoutSchema(textOnly(128000)),
+		"meta.llama3-2-90b":           withoutSchema(chat(128000)),
+		"mistral.mistral-large":       withoutSchema(textOnly(128000)),
+	}
+	registeredCapabilities = map[string]ModelCapabilities{}
+)
+
+// bedrockRegions are the prefixes of Bedrock cross-region inference profiles,
+// e.g. "us.anthropic.claude-sonnet-4-20250514-v1:0".
+var bedrockRegions = []string{"us.", "eu.", "apac.", "us-gov.", "global."}
+
+// RegisterModelCapabilities overrides the capabilities of a model name or
+// name prefix. Only the known fields override, so that
+// ModelCapabilities{ContextWindow: 32000} keeps the other capabilities.
+func RegisterModelCapabilities(name string, capabilities ModelCapabilities) {
+	capabilitiesMu.Lock()
+	defer capabilitiesMu.Unlock()
+	registeredCapabilities[name] = registeredCapabilities[name].merge(capabilities)
+}
+
+// LookupModelCapabilities returns the capabilities of the model: the defaults
+// shipped for common models with the registered overrides applied. Exact
+// names win; otherwise the longest matching prefix does, so
+// "gpt-4o-2024-08-06" resolves to the "gpt-4o" entry.
+func LookupModelCapabilities(name string) (ModelCapabilities, bool) {
+	defaults, ok := lookupCapabilities(defaultCapabilities, name)
+	registered, overridden := lookupCapabilities(registeredCapabilities, name)
+	return defaults.merge(registered), ok || overridden
+}
+
+// lookupCapabilities returns the entry of the table for the model name.
+func lookupCapabilities(table map[string]ModelCapabilities, name string) (ModelCapabilities, bool) {
+	capabilitiesMu.RLock()
+	defer capabilitiesMu.RUnlock()
+	if c, ok := table[name]; ok {
+		return c, true
+	}
+	var (
+		match string
+		found ModelCapabilities
+	)
+	for _, n := range append([]string{name}, bedrockModelIDs(name)...) {
+		for prefix, c := range table {
+			if strings.HasPrefix(n, prefix) && len(prefix) > len(match) {
+				match, found = prefix, c
+			}
+		}
+	}
+	return found, match != ""
+}
+
+// bedrockModelIDs returns the model ID of a Bedrock inference profile.
+func bedrockModelIDs(name string) []string {
+	for _, region := range bedrockRegions {
+		if id, ok := strings.CutPrefix(name, region); ok {
+			return []string{id}
+		}
+	}
+	return nil
+}
+
+// capabilitiesOf returns the capabilities of the model named name served by
+// the provider, including those the provider reports.
+func capabilitiesOf(model ModelProvider, name string) ModelCapabilities {
+	defaults, _ := lookupCapabilities(defaultCapabilities, name)
+	registered, _ := lookupCapabilities(registeredCapabilities, name)
+	var provider any = model
+	if wrapped, ok := model.(*wrappedModel); ok {
+		provider = wrapped.model
+	}
+	if p, ok := provider.(CapabilityProvider); ok {
+		defaults = defaults.merge(p.Capabilities(name))
+	}
+	return defaults.merge(registered)
+}
+
+// RegisterModelInfo registers or overrides the info for a model name or name prefix.
+//
+// Deprecated: Use RegisterModelCapabilities.
+func RegisterModelInfo(name string, info ModelInfo) {
+	RegisterModelCapabilities(name, info)
+}
+
+// LookupModelInfo returns the info registered for the model.
+//
+// Deprecated: Use LookupModelCapabilities.
+func LookupModelInfo(name string) (ModelInfo, bool) {
+	return LookupModelCapabilities(name)
+}
@@ -0,0 +1,89 @@
+package blades
+
+import (
+	"context"
+)
+
+// ModelHandler handles model requests; every ModelProvider is a ModelHandler.
+type ModelHandler interface {
+	// Generate executes the request and returns a single assistant response.
+	Generate(context.Context, *ModelRequest) (*ModelResponse, error)
+	// NewStreaming executes the request and returns a stream of assistant responses.
+	NewStreaming(context.Context, *ModelRequest) Generator[*ModelResponse, error]
+}
+
+// ModelHandlerFuncs is an adapter to build a ModelHandler from ordinary functions.
+type ModelHandlerFuncs struct {
+	GenerateFunc  func(context.Context, *ModelRequest) (*ModelResponse, error)
+	StreamingFunc func(context.Context, *ModelRequest) Generator[*ModelResponse, error]
+}
+
+// Generate implements the ModelHandler interface by calling GenerateFunc.
+func (f ModelHandlerFuncs) Generate(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+	return f.GenerateFunc(ctx, req)
+}
+
+// NewStreaming implements the ModelHandler interface by calling StreamingFunc.
+func (f ModelHandlerFuncs) NewStreaming(ctx context.Context, req *ModelRequest) Generator[*ModelResponse, error] {
+	return f.StreamingFunc(ctx, req)
+}
+
+// ModelMiddleware wraps a ModelHandler and returns a new ModelHandler with additional behavior.
+// Unlike Middleware, it runs at the model boundary and applies to direct provider calls too.
+type ModelMiddleware func(ModelHandler) ModelHandler
+
+// ChainModelMiddlewares composes model middlewares into one, applying them in order.
+// The first middleware becomes the outermost wrapper.
+func ChainModelMiddlewares(mws ...ModelMiddleware) ModelMiddleware {
+	return func(next ModelHandler) ModelHandler {
+		h := next
+		for i := len(mws) - 1; i >= 0; i-- { // apply in reverse to make mws[0] outermost
+			h = mws[i](h)
+		}
+		return h
+	}
+}
+
+// WrapModel decorates the model with the middlewares; the first middleware is
+// the outermost. The middlewares can read the model with FromModelContext.
+func WrapModel(model ModelProvider, mws ...ModelMiddleware) ModelProvider {
+	return &wrappedModel{
+		model:   model,
+		handler: ChainModelMiddlewares(mws...)(model),
+	}
+}
+
+// wrappedModel is a ModelProvider whose calls go through model middlewares.
+type wrappedModel struct {
+	model   ModelProvider
+	handler ModelHandler
+}
+
+// Name returns the name of the wrapped model.
+func (m *wrappedModel) Name() string {
+	return m.model.Name()
+}
+
+// Generate runs the request through the middlewares.
+func (m *wrappedModel) Generate(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+	return m.handler.Generate(NewModelContext(ctx, m.model), req)
+}
+
+// NewStreaming runs the streaming request through the middlewares.
+func (m *wrappedModel) NewStreaming(ctx context.Context, req *ModelRequest) Generator[*ModelResponse, error] {
+	return m.handler.NewStreaming(NewModelContext(ctx, m.model), req)
+}
+
+// ctxModelKey is the context key for the model being called.
+type ctxModelKey struct{}
+
+// NewModelContext returns a new context that carries the model being called.
+func NewModelContext(ctx context.Context, model ModelProvider) context.Context {
+	return context.WithValue(ctx, ctxModelKey{}, model)
+}
+
+// FromModelContext retrieves the model being called from the context, if present.
+func FromModelContext(ctx context.Context) (ModelProvider, bool) {
+	model, ok := ctx.Value(ctxModelKey{}).(ModelProvider)
+	return model, ok
+}
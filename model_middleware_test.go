@@ -0,0 +1,69 @@
+package blades
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// recordingMiddleware appends name to trace before and after each call.
+func recordingMiddleware(name string, trace *[]string) ModelMiddleware {
+	return func(next ModelHandler) ModelHandler {
+		return ModelHandlerFuncs{
+			GenerateFunc: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+				*trace = append(*trace, name+" before")
+				res, err := next.Generate(ctx, req)
+				*trace = append(*trace, name+" after")
+				return res, err
+			},
+			StreamingFunc: func(ctx context.Context, req *ModelRequest) Generator[*ModelResponse, error] {
+				return func(yield func(*ModelResponse, error) bool) {
+					*trace = append(*trace, name+" before")
+					for res, err := range next.NewStreaming(ctx, req) {
+						if !yield(res, err) {
+							return
+						}
+					}
+					*trace = append(*trace, name+" after")
+				}
+			},
+		}
+	}
+}
+
+func TestWrapModel(t *testing.T) {
+	var trace []string
+	model := &mockModel{
+		name: "fake",
+		generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+			if m, ok := FromModelContext(ctx); !ok || m.Name() != "fake" {
+				t.Errorf("expected the wrapped model in context, got %v", m)
+			}
+			trace = append(trace, "model")
+			return textResponse("ok"), nil
+		},
+	}
+	wrapped := WrapModel(model, recordingMiddleware("outer", &trace), recordingMiddleware("inner", &trace))
+	if wrapped.Name() != "fake" {
+		t.Fatalf("want name fake, got %s", wrapped.Name())
+	}
+	want := []string{"outer before", "inner before", "model", "inner after", "outer after"}
+
+	res, err := wrapped.Generate(context.Background(), &ModelRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Message.Text() != "ok" || !reflect.DeepEqual(trace, want) {
+		t.Fatalf("generate: want %v, got %v", want, trace)
+	}
+
+	trace = nil
+	for _, err := range wrapped.NewStreaming(context.Background(), &ModelRequest{}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(trace, want) {
+		t.Fatalf("streaming: want %v, got %v", want, trace)
+	}
+}
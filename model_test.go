@@ -0,0 +1,49 @@
+package blades
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMergeExtensions(t *testing.T) {
+	body := map[string]any{
+		"model":  "m",
+		"config": map[string]any{"seed": 1},
+	}
+	err := MergeExtensions(body, map[string]any{
+		"tier":   "flex",
+		"config": map[string]any{"thinking": map[string]any{"budget": 0}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"model":  "m",
+		"tier":   "flex",
+		"config": map[string]any{"seed": 1, "thinking": map[string]any{"budget": 0}},
+	}
+	if !reflect.DeepEqual(body, want) {
+		t.Fatalf("want %v, got %v", want, body)
+	}
+
+	err = MergeExtensions(body, map[string]any{"extra": true, "config": map[string]any{"seed": 2}})
+	if !errors.Is(err, ErrExtensionConflict) {
+		t.Fatalf("want ErrExtensionConflict, got %v", err)
+	}
+	if !reflect.DeepEqual(body, want) {
+		t.Fatalf("want the body unchanged on a conflict, got %v", body)
+	}
+}
+
+func TestProviderExtensions(t *testing.T) {
+	req := &ModelRequest{Extensions: map[string]any{"tier": "flex"}}
+	req.Options.Apply(
+		ProviderOptions(map[string]any{"tier": "default", "user": "u1"}),
+		ProviderOptions(map[string]any{"store": false}),
+	)
+	want := map[string]any{"tier": "flex", "user": "u1", "store": false}
+	if got := req.ProviderExtensions(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,101 @@
+package blades
+
+import (
+	"fmt"
+
+	"github.com/go-kratos/blades/internal/markdown"
+)
+
+// OutputFormat is the rendering of the final answer of an agent, converted
+// from the markdown the model writes.
+type OutputFormat string
+
+const (
+	// FormatMarkdown keeps the markdown of the model; it is the default.
+	FormatMarkdown OutputFormat = "markdown"
+	// FormatPlainText removes the markup, e.g. for speech. Links are
+	// followed by their URL, and lists and tables keep their layout.
+	FormatPlainText OutputFormat = "plain_text"
+	// FormatHTMLSafe renders HTML that is safe to embed, e.g. in an email:
+	// all text is escaped, raw HTML included, and links keep only http,
+	// https and mailto URLs.
+	FormatHTMLSafe OutputFormat = "html_safe"
+	// FormatSlackMrkdwn renders Slack mrkdwn. Tables and code blocks are
+	// preformatted, since mrkdwn has neither tables nor languages.
+	FormatSlackMrkdwn OutputFormat = "slack_mrkdwn"
+)
+
+// OutputFormatKey is the message metadata key of the OutputFormat a final
+// answer was converted to.
+const OutputFormatKey = "output_format"
+
+// WithOutputFormat converts the final answer of the Agent from markdown to
+// the format. Only the completed answer is converted: streamed partial
+// messages keep the markdown, and so do the session history and the output
+// key, so that later turns and agents read what the model wrote.
+func WithOutputFormat(format OutputFormat) AgentOption {
+	return func(a *agent) {
+		a.outputFormat = format
+	}
+}
+
+// ConvertMarkdown converts the markdown text to the format. It returns an
+// error if the renderer fails on the text, e.g. on malformed markup it does
+// not handle, so that callers can keep the text as written.
+func ConvertMarkdown(text string, format OutputFormat) (converted string, err error) {
+	var render func(*markdown.Node) string
+	switch format {
+	case "", FormatMarkdown:
+		return text, nil
+	case FormatPlainText:
+		render = markdown.PlainText
+	case FormatHTMLSafe:
+		render = markdown.HTML
+	case FormatSlackMrkdwn:
+		render = markdown.Slack
+	default:
+		return "", fmt.Errorf("%w: %q", ErrInvalidOutputFormat, format)
+	}
+	defer func() {
+		if v := recover(); v != nil {
+			converted, err = "", fmt.Errorf("convert markdown to %s: %v", format, v)
+		}
+	}()
+	return render(markdown.Parse(text)), nil
+}
+
+// checkOutputFormat checks that the output format is known, and that the
+// answer is not structured output, which is not markdown.
+func (a *agent) checkOutputFormat() error {
+	if _, err := ConvertMarkdown("", a.outputFormat); err != nil {
+		return fmt.Errorf("agent %s: %w", a.name, err)
+	}
+	if a.outputSchema != nil && a.outputFormat != "" && a.outputFormat != FormatMarkdown {
+		return fmt.Errorf("agent %s: %w: %s does not apply to structured output", a.name, ErrInvalidOutputFormat, a.outputFormat)
+	}
+	return nil
+}
+
+// formatOutput returns the message converted to the output format if it is
+// an accepted final answer, or the message itself.
+func (a *agent) formatOutput(message *Message, rejections []error) *Message {
+	if a.outputFormat == "" || a.outputFormat == FormatMarkdown || len(rejections) > 0 ||
+		message.Role != RoleAssistant || message.Status != StatusCompleted {
+		return message
+	}
+	converted := message.Clone()
+	for i, part := range converted.Parts {
+		if text, ok := part.(TextPart); ok {
+			// A text that cannot be converted is kept as the model wrote it.
+			if formatted, err := ConvertMarkdown(text.Text, a.outputFormat); err == nil {
+				text.Text = formatted
+				converted.Parts[i] = text
+			}
+		}
+	}
+	if converted.Metadata == nil {
+		converted.Metadata = make(map[string]any)
+	}
+	converted.Metadata[OutputFormatKey] = a.outputFormat
+	return converted
+}
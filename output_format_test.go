@@ -0,0 +1,85 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+func TestOutputFormat(t *testing.T) {
+	const answer = "The tide is **high** at <b>6</b>, see [tables](https://example.com)."
+	tests := []struct {
+		format OutputFormat
+		want   string
+	}{
+		{FormatMarkdown, answer},
+		{FormatPlainText, "The tide is high at <b>6</b>, see tables (https://example.com)."},
+		{FormatHTMLSafe, "<p>The tide is <strong>high</strong> at &lt;b&gt;6&lt;/b&gt;, see <a href=\"https://example.com\">tables</a>.</p>\n"},
+		{FormatSlackMrkdwn, "The tide is *high* at &lt;b&gt;6&lt;/b&gt;, see <https://example.com|tables>."},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			agent, err := NewAgent("tides", WithModel(&truncatingModel{segments: []string{answer}}), WithOutputFormat(tt.format))
+			if err != nil {
+				t.Fatal(err)
+			}
+			session := NewSession()
+			var deltas strings.Builder
+			var final *Message
+			for message, err := range NewRunner(agent).RunStream(context.Background(), UserMessage("tides?"), WithSession(session)) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				switch message.Status {
+				case StatusIncomplete:
+					deltas.WriteString(message.Text())
+				case StatusCompleted:
+					final = message
+				}
+			}
+			if deltas.String() != answer {
+				t.Fatalf("want the markdown streamed, got %q", deltas.String())
+			}
+			if final == nil || final.Text() != tt.want {
+				t.Fatalf("want the final answer %q, got %v", tt.want, final)
+			}
+			if format, _ := final.Metadata[OutputFormatKey].(OutputFormat); tt.format != FormatMarkdown && format != tt.format {
+				t.Fatalf("want the format recorded, got %v", final.Metadata)
+			}
+			history := session.History()
+			if got := history[len(history)-1].Text(); got != answer {
+				t.Fatalf("want the markdown in the history, got %q", got)
+			}
+		})
+	}
+}
+
+func TestOutputFormatConfig(t *testing.T) {
+	model := &truncatingModel{segments: []string{"ok"}}
+	if _, err := NewAgent("tides", WithModel(model), WithOutputFormat("rtf")); !errors.Is(err, ErrInvalidOutputFormat) {
+		t.Fatalf("want ErrInvalidOutputFormat for an unknown format, got %v", err)
+	}
+	schema := &jsonschema.Schema{Type: "object"}
+	if _, err := NewAgent("tides", WithModel(model), WithOutputSchema(schema), WithOutputFormat(FormatHTMLSafe)); !errors.Is(err, ErrInvalidOutputFormat) {
+		t.Fatalf("want ErrInvalidOutputFormat with an output schema, got %v", err)
+	}
+}
+
+func TestOutputFormatMalformedTable(t *testing.T) {
+	// An empty header over a delimiter row once panicked the renderer.
+	const answer = "|\n| -"
+	agent, err := NewAgent("tables", WithModel(&truncatingModel{segments: []string{answer}}), WithOutputFormat(FormatPlainText))
+	if err != nil {
+		t.Fatal(err)
+	}
+	final, err := NewRunner(agent).Run(context.Background(), UserMessage("table?"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if final.Text() == "" {
+		t.Fatal("want the answer rendered")
+	}
+}
@@ -0,0 +1,49 @@
+package blades
+
+import (
+	"context"
+	"runtime/debug"
+
+	"github.com/go-kratos/blades/internal/panics"
+	"github.com/go-kratos/blades/tools"
+)
+
+// PanicError is the error returned for a panic in a node, tool, agent or
+// middleware handler. It records the handler name, the panic value and the
+// stack trace.
+type PanicError = panics.Error
+
+// recoverHandler converts a panic in the handler, or in the stream it returns,
+// into a *PanicError yielded as the last error of the stream. Panics raised by
+// the consumer of the stream are not recovered.
+func recoverHandler(name string, next Handler) Handler {
+	return HandleFunc(func(ctx context.Context, invocation *Invocation) Generator[*Message, error] {
+		return func(yield func(*Message, error) bool) {
+			inYield := false
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				if inYield {
+					panic(v)
+				}
+				yield(nil, &PanicError{Scope: "agent", Name: name, Value: v, Stack: debug.Stack()})
+			}()
+			for m, err := range next.Handle(ctx, invocation) {
+				inYield = true
+				ok := yield(m, err)
+				inYield = false
+				if !ok {
+					return
+				}
+			}
+		}
+	})
+}
+
+// handleTool runs the tool, converting a panic into a *PanicError.
+func handleTool(ctx context.Context, tool tools.Tool, input string) (result string, err error) {
+	defer panics.Recover("tool", tool.Name(), &err)
+	return tool.Handle(ctx, input)
+}
@@ -0,0 +1,79 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+)
+
+// PathError is an error annotated with the path of the component it came
+// from: the names of the agents, flows, tools and graph nodes it ran in,
+// outermost first. It renders as "outer/inner/tool: error".
+type PathError struct {
+	Path []string
+	Err  error
+}
+
+func (e *PathError) Error() string {
+	if len(e.Path) == 0 {
+		return e.Err.Error()
+	}
+	return strings.Join(e.Path, "/") + ": " + e.Err.Error()
+}
+
+// Unwrap returns the annotated error.
+func (e *PathError) Unwrap() error {
+	return e.Err
+}
+
+// ctxPathKey is the context key for the component path.
+type ctxPathKey struct{}
+
+// NewPathContext returns a context whose path ends with the component. A
+// component running one of its own name, such as the router of a handoff
+// flow, appears once.
+func NewPathContext(ctx context.Context, component string) context.Context {
+	path, _ := ctx.Value(ctxPathKey{}).([]string)
+	if len(path) > 0 && path[len(path)-1] == component {
+		return ctx
+	}
+	return context.WithValue(ctx, ctxPathKey{}, append(slices.Clip(path), component))
+}
+
+// PathFromContext returns the path of the component running in ctx,
+// outermost first.
+func PathFromContext(ctx context.Context) []string {
+	path, _ := ctx.Value(ctxPathKey{}).([]string)
+	return slices.Clone(path)
+}
+
+// WrapPathError annotates err with the path of ctx in a *PathError, unless it
+// already has one: errors are annotated where they leave the innermost
+// component, whose path includes the outer ones.
+func WrapPathError(ctx context.Context, err error) error {
+	var pathErr *PathError
+	if err == nil || errors.As(err, &pathErr) {
+		return err
+	}
+	path := PathFromContext(ctx)
+	if len(path) == 0 {
+		return err
+	}
+	return &PathError{Path: path, Err: err}
+}
+
+// PathErrors returns the stream with its errors annotated by WrapPathError.
+// Agents wrap their streams with it, after adding their name to the path of
+// ctx with NewPathContext. It also times the stream as a step of the run
+// report; see TrackStep.
+func PathErrors(ctx context.Context, stream Generator[*Message, error]) Generator[*Message, error] {
+	return func(yield func(*Message, error) bool) {
+		defer TrackStep(ctx)()
+		for message, err := range stream {
+			if !yield(message, WrapPathError(ctx, err)) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-kratos/blades/tools"
+)
+
+func TestPathErrorTool(t *testing.T) {
+	store := NewJSONLTranscriptStore(filepath.Join(t.TempDir(), "transcript.jsonl"))
+	lookup := tools.NewTool("lookup", "Looks up a record.", tools.HandleFunc(func(context.Context, string) (string, error) {
+		return "", errors.New("unexpected status 400")
+	}))
+	model := WrapModel(&mockModel{generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+		message := &Message{Role: RoleTool, Status: StatusCompleted}
+		message.Parts = []Part{ToolPart{ID: "call", Name: "lookup", Request: "{}"}}
+		return &ModelResponse{Message: message}, nil
+	}}, Audit(store))
+	agent, err := NewAgent("support", WithModel(model), WithTools(lookup))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewRunner(agent).Run(context.Background(), UserMessage("find it"), WithInvocationID("inv"))
+	var pathErr *PathError
+	if !errors.As(err, &pathErr) || !slices.Equal(pathErr.Path, []string{"support", "lookup"}) {
+		t.Fatalf("want the path support/lookup, got %v", err)
+	}
+	if !strings.HasPrefix(err.Error(), "support/lookup: ") {
+		t.Fatalf("want a path prefix, got %q", err)
+	}
+	transcript, err := store.Load(context.Background(), "inv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transcript.Entries) != 1 || !slices.Equal(transcript.Entries[0].Path, []string{"support"}) {
+		t.Fatalf("want the path of the agent in the transcript, got %+v", transcript.Entries)
+	}
+}
+
+func TestNewPathContext(t *testing.T) {
+	ctx := NewPathContext(context.Background(), "triage")
+	// A component running one of its own name appears once.
+	ctx = NewPathContext(ctx, "triage")
+	a := NewPathContext(ctx, "math")
+	b := NewPathContext(ctx, "history")
+	if got := PathFromContext(a); !slices.Equal(got, []string{"triage", "math"}) {
+		t.Fatalf("unexpected path %v", got)
+	}
+	if got := PathFromContext(b); !slices.Equal(got, []string{"triage", "history"}) {
+		t.Fatalf("unexpected path %v", got)
+	}
+	// An error keeps the path of the innermost component it left.
+	err := WrapPathError(ctx, WrapPathError(a, errors.New("boom")))
+	if err.Error() != "triage/math: boom" {
+		t.Fatalf("unexpected error %q", err)
+	}
+	if WrapPathError(ctx, nil) != nil {
+		t.Fatal("want a nil error")
+	}
+}
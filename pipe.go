@@ -0,0 +1,263 @@
+package blades
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// Transform reshapes the output of a pipeline stage into the input of the next
+// one, e.g. by extracting a JSON field or wrapping the text in a template.
+type Transform func(context.Context, *Message) (*Message, error)
+
+// StageError is returned when a stage of a pipeline fails. It unwraps to the
+// error of the stage.
+type StageError struct {
+	// Stage is the index of the failing stage, counting agents and transforms.
+	Stage int
+	// Name is the name of the failing agent, or "transform".
+	Name string
+	Err  error
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("pipeline stage %d (%s): %v", e.Stage, e.Name, e.Err)
+}
+
+// Unwrap returns the error of the stage.
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// pipeStage is either an agent or a transform.
+type pipeStage struct {
+	agent     Agent
+	transform Transform
+}
+
+// Pipeline is an agent that feeds the answer of each stage to the next one.
+// The stages before the last agent run to completion and only the stream of
+// the last agent reaches the caller; a stage that follows it receives its
+// completed answer. The first stage receives the invocation as is, the next
+// ones only the output of their predecessor, without the history.
+//
+// Pipelines are immutable: Pipe, Then and Named return a new pipeline.
+type Pipeline struct {
+	name        string
+	description string
+	stages      []pipeStage
+}
+
+// Pipe returns a pipeline that runs the agents one after the other.
+func Pipe(agents ...Agent) *Pipeline {
+	return (&Pipeline{}).Pipe(agents...)
+}
+
+// Then returns a pipeline that runs the agent and reshapes its answer with the transform.
+func Then(agent Agent, transform Transform) *Pipeline {
+	return Pipe(agent).Then(transform)
+}
+
+// Pipe returns a copy of the pipeline with the agents appended.
+func (p *Pipeline) Pipe(agents ...Agent) *Pipeline {
+	next := p.clone()
+	for _, agent := range agents {
+		next.stages = append(next.stages, pipeStage{agent: agent})
+	}
+	return next
+}
+
+// Then returns a copy of the pipeline with the transform appended.
+func (p *Pipeline) Then(transform Transform) *Pipeline {
+	next := p.clone()
+	next.stages = append(next.stages, pipeStage{transform: transform})
+	return next
+}
+
+// Named returns a copy of the pipeline with the name and description.
+func (p *Pipeline) Named(name, description string) *Pipeline {
+	next := p.clone()
+	next.name = name
+	next.description = description
+	return next
+}
+
+func (p *Pipeline) clone() *Pipeline {
+	return &Pipeline{name: p.name, description: p.description, stages: slices.Clone(p.stages)}
+}
+
+// Name returns the name of the pipeline, by default the names of its agents
+// joined by " | ".
+func (p *Pipeline) Name() string {
+	if p.name != "" {
+		return p.name
+	}
+	names := make([]string, 0, len(p.stages))
+	for _, agent := range p.SubAgents() {
+		names = append(names, agent.Name())
+	}
+	return strings.Join(names, " | ")
+}
+
+// Description returns the description of the pipeline.
+func (p *Pipeline) Description() string {
+	return p.description
+}
+
+// SubAgents returns the agents of the pipeline.
+func (p *Pipeline) SubAgents() []Agent {
+	var agents []Agent
+	for _, stage := range p.stages {
+		if stage.agent != nil {
+			agents = append(agents, stage.agent)
+		}
+	}
+	return agents
+}
+
+// Run runs the stages in order. A failing stage ends the run with a *StageError.
+func (p *Pipeline) Run(ctx context.Context, invocation *Invocation) Generator[*Message, error] {
+	ctx = NewPathContext(ctx, p.Name())
+	return PathErrors(ctx, func(yield func(*Message, error) bool) {
+		if len(p.stages) == 0 {
+			return
+		}
+		input := invocation.Message
+		for i, stage := range p.stages {
+			fail := func(name string, err error) {
+				yield(nil, &StageError{Stage: i, Name: name, Err: err})
+			}
+			if stage.transform != nil {
+				output, err := stage.transform(ctx, input)
+				if err == nil && output == nil {
+					err = ErrNoStageOutput
+				}
+				if err != nil {
+					fail("transform", err)
+					return
+				}
+				input = output
+				continue
+			}
+			agent := stage.agent
+			child := invocation.Child(agent.Name())
+			if i > 0 {
+				child.Message = stageInput(input)
+				child.History = nil
+			}
+			if err := CheckLimits(ctx, agent.Name(), child); err != nil {
+				fail(agent.Name(), err)
+				return
+			}
+			// The last stage streams to the caller.
+			if i == len(p.stages)-1 {
+				for message, err := range MarkFinal(agent.Run(ctx, child), true) {
+					if err != nil {
+						fail(agent.Name(), err)
+						return
+					}
+					if !yield(message, nil) {
+						return
+					}
+				}
+				return
+			}
+			var output *Message
+			for message, err := range agent.Run(ctx, child) {
+				if err != nil {
+					fail(agent.Name(), err)
+					return
+				}
+				if message == nil {
+					continue
+				}
+				if message.Status == StatusCancelled || message.Status == StatusNeedsInput {
+					yield(message, nil)
+					return
+				}
+				if message.Role == RoleAssistant && message.Status == StatusCompleted {
+					output = message
+				}
+			}
+			if output == nil {
+				fail(agent.Name(), ErrNoStageOutput)
+				return
+			}
+			input = output
+		}
+		// The pipeline ends with a transform, whose output is the final answer.
+		message := input.Clone()
+		message.Role = RoleAssistant
+		message.Status = StatusCompleted
+		message.InvocationID = invocation.ID
+		message.Author = p.Name()
+		message.Final = true
+		yield(message, nil)
+	})
+}
+
+// stageInput returns the output of a stage as the user message of the next
+// one, without its tool calls and reasoning.
+func stageInput(output *Message) *Message {
+	if output.Role == RoleUser {
+		return output
+	}
+	input := UserMessage[string]()
+	for _, part := range output.Parts {
+		switch part.(type) {
+		case TextPart, FilePart, DataPart:
+			input.Parts = append(input.Parts, part)
+		}
+	}
+	return input
+}
+
+// JSONField returns a transform that parses the JSON value of the message
+// with ParseStructured and keeps the field at the dot-separated path. A string
+// field becomes the text of the message; any other value its JSON encoding.
+func JSONField(path string) Transform {
+	return func(ctx context.Context, message *Message) (*Message, error) {
+		value, err := ParseStructured[any](message.Text())
+		if err != nil {
+			return nil, fmt.Errorf("json field %s: %w", path, err)
+		}
+		for _, key := range strings.Split(path, ".") {
+			object, ok := value.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("json field %s: %q is not in an object", path, key)
+			}
+			if value, ok = object[key]; !ok {
+				return nil, fmt.Errorf("json field %s: %q not found", path, key)
+			}
+		}
+		if s, ok := value.(string); ok {
+			return UserMessage(s), nil
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("json field %s: %w", path, err)
+		}
+		return UserMessage(string(data)), nil
+	}
+}
+
+// Template returns a transform that renders the text template with the text
+// of the message as .Text, e.g. "Summarize:\n{{.Text}}". The template has the
+// functions of agent instructions except include; a template that does not
+// parse fails the stage.
+func Template(text string) Transform {
+	t, err := template.New("transform").Funcs(templateFuncs()).Parse(text)
+	return func(ctx context.Context, message *Message) (*Message, error) {
+		if err != nil {
+			return nil, fmt.Errorf("template: %w", err)
+		}
+		var buf strings.Builder
+		if err := t.Execute(&buf, struct{ Text string }{message.Text()}); err != nil {
+			return nil, fmt.Errorf("template: %w", err)
+		}
+		return UserMessage(buf.String()), nil
+	}
+}
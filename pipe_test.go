@@ -0,0 +1,73 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestPipe(t *testing.T) {
+	newStage := func(name string, answer func(input string) (string, error)) Agent {
+		model := &mockModel{generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+			last := req.Messages[len(req.Messages)-1]
+			text, err := answer(last.Text())
+			if err != nil {
+				return nil, err
+			}
+			return textResponse(text), nil
+		}}
+		agent, err := NewAgent(name, WithModel(model))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return agent
+	}
+	translate := newStage("translate", func(input string) (string, error) {
+		return "Here you go:\n```json\n{\"result\":{\"text\":\"hello " + input + "\"}}\n```", nil
+	})
+	refine := newStage("refine", func(input string) (string, error) {
+		return "refined(" + input + ")", nil
+	})
+
+	pipeline := Then(translate, JSONField("result.text")).
+		Then(Template("Polish: {{.Text}}")).
+		Pipe(refine)
+	if pipeline.Name() != "translate | refine" || len(pipeline.SubAgents()) != 2 {
+		t.Fatalf("unexpected pipeline %q with %d agents", pipeline.Name(), len(pipeline.SubAgents()))
+	}
+	var messages []*Message
+	for m, err := range NewRunner(pipeline).RunStream(context.Background(), UserMessage("world")) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, m)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("want only the last stage streamed, got %d messages", len(messages))
+	}
+	if last := messages[0]; last.Text() != "refined(Polish: hello world)" || !last.Final || last.Author != "refine" {
+		t.Fatalf("unexpected answer %q, final %t, author %q", last.Text(), last.Final, last.Author)
+	}
+
+	// A pipeline that ends with a transform answers with its output.
+	extract, err := NewRunner(Then(translate, JSONField("result")).Named("extract", "")).Run(context.Background(), UserMessage("world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if extract.Text() != `{"text":"hello world"}` || extract.Role != RoleAssistant || !extract.Final {
+		t.Fatalf("unexpected answer %q, role %s, final %t", extract.Text(), extract.Role, extract.Final)
+	}
+
+	// A failing stage is named in the error.
+	errDown := errors.New("model down")
+	failing := newStage("summarize", func(string) (string, error) { return "", errDown })
+	_, err = NewRunner(Pipe(translate, failing, refine)).Run(context.Background(), UserMessage("world"))
+	var stageErr *StageError
+	if !errors.As(err, &stageErr) || stageErr.Stage != 1 || stageErr.Name != "summarize" || !errors.Is(err, errDown) {
+		t.Fatalf("want the failing stage reported, got %v", err)
+	}
+	_, err = NewRunner(Then(refine, JSONField("result"))).Run(context.Background(), UserMessage("world"))
+	if !errors.As(err, &stageErr) || stageErr.Stage != 1 || stageErr.Name != "transform" || !errors.Is(err, ErrInvalidStructuredOutput) {
+		t.Fatalf("want the failing transform reported, got %v", err)
+	}
+}
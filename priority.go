@@ -0,0 +1,50 @@
+package blades
+
+import "context"
+
+// Priority orders the runs waiting for a slot of a Limiter; runs of a higher
+// priority are admitted first. The zero value is PriorityNormal.
+type Priority int
+
+const (
+	// PriorityLow is for background work, e.g. the jobs of a JobRunner.
+	PriorityLow Priority = -1
+	// PriorityNormal is the default priority.
+	PriorityNormal Priority = 0
+	// PriorityHigh is for interactive work a user waits for.
+	PriorityHigh Priority = 1
+)
+
+// String returns the name of the priority class.
+func (p Priority) String() string {
+	switch {
+	case p < PriorityNormal:
+		return "low"
+	case p > PriorityNormal:
+		return "high"
+	default:
+		return "normal"
+	}
+}
+
+// WithPriority sets the priority the run waits for a slot of the Limiter of
+// the Runner with. Runs default to PriorityNormal, and jobs to PriorityLow.
+func WithPriority(priority Priority) RunOption {
+	return func(r *RunOptions) {
+		r.Priority = priority
+	}
+}
+
+type ctxPriorityKey struct{}
+
+// NewPriorityContext returns a context carrying the priority of a run, which
+// Limiter.Acquire waits with.
+func NewPriorityContext(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, ctxPriorityKey{}, priority)
+}
+
+// PriorityFromContext returns the priority of the run in ctx, PriorityNormal if none.
+func PriorityFromContext(ctx context.Context) Priority {
+	priority, _ := ctx.Value(ctxPriorityKey{}).(Priority)
+	return priority
+}
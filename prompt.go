@@ -0,0 +1,179 @@
+package blades
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// PromptTemplate builds the messages of a prompt from templates, which are
+// rendered with text/template and the built-in template functions.
+type PromptTemplate struct {
+	funcs    TemplateFuncs
+	messages []promptMessage
+}
+
+// promptMessage is a templated message, with the template text or the file it is read from.
+type promptMessage struct {
+	role  Role
+	text  string
+	path  string
+	parts []Part
+}
+
+// NewPromptTemplate creates an empty prompt template.
+func NewPromptTemplate() *PromptTemplate {
+	return &PromptTemplate{}
+}
+
+// Funcs registers additional functions for the templates, which may override the built-in ones.
+func (p *PromptTemplate) Funcs(funcs TemplateFuncs) *PromptTemplate {
+	if p.funcs == nil {
+		p.funcs = make(TemplateFuncs, len(funcs))
+	}
+	for name, fn := range funcs {
+		p.funcs[name] = fn
+	}
+	return p
+}
+
+// System appends a system message rendered from the template text.
+func (p *PromptTemplate) System(text string) *PromptTemplate {
+	p.messages = append(p.messages, promptMessage{role: RoleSystem, text: text})
+	return p
+}
+
+// User appends a user message rendered from the template text.
+func (p *PromptTemplate) User(text string) *PromptTemplate {
+	p.messages = append(p.messages, promptMessage{role: RoleUser, text: text})
+	return p
+}
+
+// SystemFile appends a system message rendered from the template in the file at path.
+func (p *PromptTemplate) SystemFile(path string) *PromptTemplate {
+	p.messages = append(p.messages, promptMessage{role: RoleSystem, path: path})
+	return p
+}
+
+// UserFile appends a user message rendered from the template in the file at path.
+func (p *PromptTemplate) UserFile(path string) *PromptTemplate {
+	p.messages = append(p.messages, promptMessage{role: RoleUser, path: path})
+	return p
+}
+
+// UserParts appends a user message whose rendered text is followed by parts,
+// such as an image or a document, in the given order.
+func (p *PromptTemplate) UserParts(text string, parts ...Part) *PromptTemplate {
+	p.messages = append(p.messages, promptMessage{role: RoleUser, text: text, parts: parts})
+	return p
+}
+
+// Build renders the messages with params. Every top-level param a template
+// reads must be set, unless it is only read under an {{if}} or {{with}} guard
+// on the same param, or Build fails with ErrMissingStateKey. Build reports
+// the errors of all templates at once.
+func (p *PromptTemplate) Build(params map[string]any) ([]*Message, error) {
+	var (
+		errs     []error
+		messages = make([]*Message, 0, len(p.messages))
+	)
+	for i, pm := range p.messages {
+		name := fmt.Sprintf("%s message %d", pm.role, i+1)
+		if pm.path != "" {
+			name += " (" + pm.path + ")"
+		}
+		text, err := p.render(pm, params)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("prompt: %s: %w", name, err))
+			continue
+		}
+		parts := append([]Part{TextPart{Text: text}}, pm.parts...)
+		message := &Message{ID: NewMessageID(), Role: pm.role, Parts: parts}
+		if pm.role == RoleUser {
+			message.Author = "user"
+		}
+		messages = append(messages, message)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return messages, nil
+}
+
+// render parses the template of the message, checks its params and executes it.
+func (p *PromptTemplate) render(pm promptMessage, params map[string]any) (string, error) {
+	text := pm.text
+	if pm.path != "" {
+		var err error
+		if text, err = promptFiles.load(pm.path); err != nil {
+			return "", err
+		}
+	}
+	funcs := templateFuncs()
+	for name, fn := range p.funcs {
+		funcs[name] = fn
+	}
+	t, err := template.New("prompt").Funcs(funcs).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var missing []string
+	required, _ := templateKeys(t)
+	for _, key := range required {
+		if _, ok := params[key]; !ok {
+			missing = append(missing, fmt.Sprintf("%q", key))
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("%w: %s", ErrMissingStateKey, strings.Join(missing, ", "))
+	}
+	var buf strings.Builder
+	if err := t.Execute(&buf, params); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// promptFiles caches the prompt template files read from disk.
+var promptFiles = &promptFileCache{files: make(map[string]promptFile)}
+
+// promptFile is a cached file with the modification time it was read at.
+type promptFile struct {
+	text    string
+	modTime time.Time
+	size    int64
+}
+
+// promptFileCache reads template files once and reads them again when their
+// modification time or size changes, so edits show up without a restart.
+type promptFileCache struct {
+	mu    sync.Mutex
+	files map[string]promptFile
+}
+
+// load returns the content of the file at path.
+func (c *promptFileCache) load(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	file, ok := c.files[path]
+	c.mu.Unlock()
+	if ok && file.modTime.Equal(info.ModTime()) && file.size == info.Size() {
+		return file.text, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	file = promptFile{text: string(b), modTime: info.ModTime(), size: info.Size()}
+	c.mu.Lock()
+	c.files[path] = file
+	c.mu.Unlock()
+	return file.text, nil
+}
@@ -0,0 +1,80 @@
+package blades
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPromptTemplate(t *testing.T) {
+	dir := t.TempDir()
+	system := filepath.Join(dir, "system.tmpl")
+	if err := os.WriteFile(system, []byte("You help {{.audience}} readers."), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	image := DataPart{Name: "chart.png", Bytes: []byte{1, 2, 3}, MIMEType: "image/png"}
+	doc := FilePart{Name: "report.pdf", URI: "file://report.pdf", MIMEType: "application/pdf"}
+	messages, err := NewPromptTemplate().
+		SystemFile(system).
+		UserParts("Summarize {{.topic}}.", image, doc).
+		Build(map[string]any{"audience": "general", "topic": "the chart"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("want 2 messages, got %d", len(messages))
+	}
+	if messages[0].Role != RoleSystem || messages[0].Text() != "You help general readers." {
+		t.Fatalf("unexpected system message %s", messages[0])
+	}
+	parts := messages[1].Parts
+	if len(parts) != 3 || parts[0] != (TextPart{Text: "Summarize the chart."}) || parts[2] != doc {
+		t.Fatalf("want the text followed by the parts in order, got %s", messages[1])
+	}
+	if data, ok := parts[1].(DataPart); !ok || data.Name != image.Name {
+		t.Fatalf("want the image as the second part, got %#v", parts[1])
+	}
+
+	// A changed file is read again.
+	if err := os.WriteFile(system, []byte("You help {{.audience}} experts."), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(system, later, later); err != nil {
+		t.Fatal(err)
+	}
+	messages, err = NewPromptTemplate().SystemFile(system).Build(map[string]any{"audience": "domain"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := messages[0].Text(); got != "You help domain experts." {
+		t.Fatalf("want the modified file, got %q", got)
+	}
+}
+
+func TestPromptTemplateErrors(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.tmpl")
+	_, err := NewPromptTemplate().
+		SystemFile(missing).
+		User("Hello {{.name").
+		User("Summarize {{.topic}}{{if .tone}} in a {{.tone}} tone{{end}}.").
+		Build(map[string]any{})
+	if err == nil {
+		t.Fatal("want an error")
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("want the missing file reported, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "user message 2") {
+		t.Fatalf("want the bad template reported, got %v", err)
+	}
+	if !errors.Is(err, ErrMissingStateKey) || !strings.Contains(err.Error(), `"topic"`) {
+		t.Fatalf("want the missing param reported, got %v", err)
+	}
+	if strings.Contains(err.Error(), `"tone"`) {
+		t.Fatalf("want the guarded param optional, got %v", err)
+	}
+}
@@ -0,0 +1,266 @@
+// Package providertest checks that model providers stream the way blades
+// expects, so that every provider runs the same conformance suite against
+// recorded streams.
+package providertest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/blades"
+	"go.uber.org/goleak"
+)
+
+// Config configures TestStreaming.
+type Config struct {
+	// Request is sent for every check. It defaults to a single user message.
+	Request *blades.ModelRequest
+	// MinChunks is the number of incomplete chunks the stream must emit before
+	// its final response. It defaults to 2.
+	MinChunks int
+	// NoUsage states that the recorded stream reports no token usage.
+	NoUsage bool
+	// CancelWithin bounds the time the stream may take to end once its context
+	// is cancelled. It defaults to one second. The recorded stream must last
+	// longer, or a provider that ignores cancellation passes too.
+	CancelWithin time.Duration
+}
+
+// TestStreaming runs the streaming conformance suite against the provider,
+// which must be backed by a recorded stream, e.g. one served by ServeSSE.
+// It checks that:
+//
+//   - the stream emits at least MinChunks incomplete chunks before its final response,
+//   - the text of the chunks adds up to the text of the final response,
+//   - every response is StatusIncomplete except the last, which is StatusCompleted,
+//   - token usage is reported exactly once, on the final response,
+//   - the stream ends within CancelWithin once its context is cancelled,
+//   - the stream leaves no goroutine behind once its consumer stops early or
+//     its context is cancelled.
+func TestStreaming(t *testing.T, provider blades.ModelProvider, config Config) {
+	t.Helper()
+	if config.Request == nil {
+		config.Request = &blades.ModelRequest{Messages: []*blades.Message{blades.UserMessage("Hello")}}
+	}
+	if config.MinChunks <= 0 {
+		config.MinChunks = 2
+	}
+	if config.CancelWithin <= 0 {
+		config.CancelWithin = time.Second
+	}
+	chunks, final, err := collect(provider, config.Request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range checks {
+		t.Run(c.name, func(t *testing.T) {
+			if err := c.check(chunks, final, config); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+	t.Run("stop", func(t *testing.T) {
+		testStop(t, provider, config)
+	})
+	t.Run("cancel", func(t *testing.T) {
+		testCancel(t, provider, config)
+	})
+}
+
+// checks are the conformance checks of a complete stream.
+var checks = []struct {
+	name  string
+	check func(chunks []*blades.ModelResponse, final *blades.ModelResponse, config Config) error
+}{
+	{"chunks", checkChunks},
+	{"text", checkText},
+	{"status", checkStatus},
+	{"usage", checkUsage},
+}
+
+func checkChunks(chunks []*blades.ModelResponse, final *blades.ModelResponse, config Config) error {
+	if len(chunks) < config.MinChunks {
+		return fmt.Errorf("want at least %d chunks before the final response, got %d; is the stream buffered?", config.MinChunks, len(chunks))
+	}
+	return nil
+}
+
+func checkText(chunks []*blades.ModelResponse, final *blades.ModelResponse, config Config) error {
+	var text strings.Builder
+	for _, chunk := range chunks {
+		text.WriteString(chunk.Message.Text())
+	}
+	if got, want := text.String(), final.Message.Text(); got != want {
+		return fmt.Errorf("want the chunks to add up to the final text %q, got %q", want, got)
+	}
+	return nil
+}
+
+func checkStatus(chunks []*blades.ModelResponse, final *blades.ModelResponse, config Config) error {
+	for i, chunk := range chunks {
+		if chunk.Message.Status != blades.StatusIncomplete {
+			return fmt.Errorf("chunk %d: want status %q, got %q", i, blades.StatusIncomplete, chunk.Message.Status)
+		}
+	}
+	if final.Message.Status != blades.StatusCompleted {
+		return fmt.Errorf("final response: want status %q, got %q", blades.StatusCompleted, final.Message.Status)
+	}
+	return nil
+}
+
+func checkUsage(chunks []*blades.ModelResponse, final *blades.ModelResponse, config Config) error {
+	for i, chunk := range chunks {
+		if chunk.Message.TokenUsage != (blades.TokenUsage{}) {
+			return fmt.Errorf("chunk %d: want no usage before the final response, got %+v", i, chunk.Message.TokenUsage)
+		}
+	}
+	if reported := final.Message.TokenUsage != (blades.TokenUsage{}); reported == config.NoUsage {
+		return fmt.Errorf("final response: want usage reported %t, got %+v", !config.NoUsage, final.Message.TokenUsage)
+	}
+	return nil
+}
+
+// collect runs the stream to the end and returns the chunks before the final
+// response, and the final response.
+func collect(provider blades.ModelProvider, req *blades.ModelRequest) ([]*blades.ModelResponse, *blades.ModelResponse, error) {
+	var responses []*blades.ModelResponse
+	for res, err := range provider.NewStreaming(context.Background(), req) {
+		if err != nil {
+			return nil, nil, fmt.Errorf("stream: %w", err)
+		}
+		if res == nil || res.Message == nil {
+			return nil, nil, fmt.Errorf("response %d: want a message, got none", len(responses))
+		}
+		responses = append(responses, res)
+	}
+	if len(responses) == 0 {
+		return nil, nil, fmt.Errorf("want a final response, got an empty stream")
+	}
+	return responses[:len(responses)-1], responses[len(responses)-1], nil
+}
+
+// testStop stops consuming the stream after its first chunk and checks that
+// the stream leaves no goroutine behind.
+func testStop(t *testing.T, provider blades.ModelProvider, config Config) {
+	running := goleak.IgnoreCurrent()
+	for _, err := range provider.NewStreaming(context.Background(), config.Request) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		break
+	}
+	checkLeaks(t, running)
+}
+
+// testCancel cancels the stream after its first chunk and checks that it ends
+// within the bound, leaving no goroutine behind.
+func testCancel(t *testing.T, provider blades.ModelProvider, config Config) {
+	running := goleak.IgnoreCurrent()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var (
+		cancelled = make(chan time.Time, 1)
+		done      = make(chan error, 1)
+	)
+	go func() {
+		for _, err := range provider.NewStreaming(ctx, config.Request) {
+			if err != nil {
+				if ctx.Err() == nil {
+					done <- err
+					return
+				}
+				break
+			}
+			if ctx.Err() == nil {
+				cancel()
+				cancelled <- time.Now()
+			}
+		}
+		done <- nil
+	}()
+	var at time.Time
+	select {
+	case at = <-cancelled:
+	case err := <-done:
+		t.Fatalf("want the stream still running after its first chunk, it ended: %v", err)
+	case <-time.After(10 * config.CancelWithin):
+		t.Fatal("want a first chunk, got none")
+	}
+	select {
+	case <-done:
+		if elapsed := time.Since(at); elapsed > config.CancelWithin {
+			t.Fatalf("want the stream to end within %v of cancellation, took %v", config.CancelWithin, elapsed)
+		}
+	case <-time.After(config.CancelWithin):
+		t.Fatalf("want the stream to end within %v of cancellation, it is still running", config.CancelWithin)
+	}
+	checkLeaks(t, running)
+}
+
+// checkLeaks fails the test if goroutines started since running are still
+// alive, e.g. one reading a stream its consumer abandoned.
+func checkLeaks(t *testing.T, running goleak.Option) {
+	t.Helper()
+	if err := goleak.Find(running); err != nil {
+		t.Fatalf("want no goroutine left behind by the stream: %v", err)
+	}
+}
+
+// ServeSSE serves the server-sent events recorded in the file at path,
+// one event at a time with the interval in between, to every request. The
+// events are separated by blank lines, as on the wire. The interval keeps the
+// stream running long enough for the cancellation check; the server stops
+// sending once the client goes away. The server is closed with the test.
+func ServeSSE(t testing.TB, path string, interval time.Duration) *httptest.Server {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := splitEvents(data)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		flusher, _ := w.(http.Flusher)
+		for i, event := range events {
+			if i > 0 {
+				select {
+				case <-time.After(interval):
+				case <-r.Context().Done():
+					return
+				}
+			}
+			if _, err := w.Write(event); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// splitEvents splits a recorded stream into its events, each with the blank
+// line that ends it.
+func splitEvents(data []byte) [][]byte {
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	var events [][]byte
+	for _, event := range bytes.Split(data, []byte("\n\n")) {
+		event = bytes.Trim(event, "\n")
+		if len(event) == 0 {
+			continue
+		}
+		events = append(events, slices.Concat(event, []byte("\n\n")))
+	}
+	return events
+}
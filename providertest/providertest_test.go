@@ -0,0 +1,130 @@
+package providertest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/blades"
+)
+
+// chunkedModel streams its chunks with the interval in between and stops once
+// ctx is done.
+type chunkedModel struct {
+	chunks   []string
+	interval time.Duration
+}
+
+func (m *chunkedModel) Name() string { return "chunked" }
+
+func (m *chunkedModel) Generate(ctx context.Context, req *blades.ModelRequest) (*blades.ModelResponse, error) {
+	message := blades.NewAssistantMessage(blades.StatusCompleted)
+	message.Parts = blades.Parts(strings.Join(m.chunks, ""))
+	message.TokenUsage = blades.TokenUsage{InputTokens: 1, OutputTokens: 2, TotalTokens: 3}
+	return &blades.ModelResponse{Message: message}, nil
+}
+
+func (m *chunkedModel) NewStreaming(ctx context.Context, req *blades.ModelRequest) blades.Generator[*blades.ModelResponse, error] {
+	return func(yield func(*blades.ModelResponse, error) bool) {
+		for i, chunk := range m.chunks {
+			if i > 0 {
+				select {
+				case <-time.After(m.interval):
+				case <-ctx.Done():
+					yield(nil, ctx.Err())
+					return
+				}
+			}
+			message := blades.NewAssistantMessage(blades.StatusIncomplete)
+			message.Parts = blades.Parts(chunk)
+			if !yield(&blades.ModelResponse{Message: message}, nil) {
+				return
+			}
+		}
+		yield(m.Generate(ctx, req))
+	}
+}
+
+func TestStreamingConformance(t *testing.T) {
+	model := &chunkedModel{chunks: []string{"Red", " and", " blue."}, interval: 100 * time.Millisecond}
+	TestStreaming(t, model, Config{CancelWithin: 50 * time.Millisecond})
+}
+
+func TestChecks(t *testing.T) {
+	chunk := func(text string) *blades.ModelResponse {
+		message := blades.NewAssistantMessage(blades.StatusIncomplete)
+		message.Parts = blades.Parts(text)
+		return &blades.ModelResponse{Message: message}
+	}
+	final := func(text string) *blades.ModelResponse {
+		message := blades.NewAssistantMessage(blades.StatusCompleted)
+		message.Parts = blades.Parts(text)
+		message.TokenUsage = blades.TokenUsage{TotalTokens: 3}
+		return &blades.ModelResponse{Message: message}
+	}
+	withUsage := chunk(" blue.")
+	withUsage.Message.TokenUsage = blades.TokenUsage{TotalTokens: 1}
+	completed := chunk("Red and")
+	completed.Message.Status = blades.StatusCompleted
+
+	tests := []struct {
+		name    string
+		check   func([]*blades.ModelResponse, *blades.ModelResponse, Config) error
+		chunks  []*blades.ModelResponse
+		final   *blades.ModelResponse
+		config  Config
+		wantErr string
+	}{
+		{"conforming chunks", checkChunks, []*blades.ModelResponse{chunk("Red and"), chunk(" blue.")}, final("Red and blue."), Config{MinChunks: 2}, ""},
+		{"buffered", checkChunks, nil, final("Red and blue."), Config{MinChunks: 2}, "is the stream buffered?"},
+		{"conforming text", checkText, []*blades.ModelResponse{chunk("Red and"), chunk(" blue.")}, final("Red and blue."), Config{}, ""},
+		{"lost text", checkText, []*blades.ModelResponse{chunk("Red and")}, final("Red and blue."), Config{}, "add up to the final text"},
+		{"completed chunk", checkStatus, []*blades.ModelResponse{completed}, final("Red and"), Config{}, `chunk 0: want status "incomplete"`},
+		{"usage on a chunk", checkUsage, []*blades.ModelResponse{chunk("Red and"), withUsage}, final("Red and blue."), Config{}, "chunk 1: want no usage"},
+		{"missing usage", checkUsage, nil, chunk("Red"), Config{}, "want usage reported true"},
+		{"no usage recorded", checkUsage, nil, chunk("Red"), Config{NoUsage: true}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.check(tt.chunks, tt.final, tt.config)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("want no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("want an error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestServeSSE(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stream.txt")
+	recorded := "data: {\"n\":1}\r\n\r\nevent: delta\ndata: {\"n\":2}\n\n\ndata: [DONE]\n"
+	if err := os.WriteFile(path, []byte(recorded), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	server := ServeSSE(t, path, time.Millisecond)
+	res, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := res.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("want an event stream, got %q", got)
+	}
+	if want := "data: {\"n\":1}\n\nevent: delta\ndata: {\"n\":2}\n\ndata: [DONE]\n\n"; string(body) != want {
+		t.Fatalf("want %q, got %q", want, body)
+	}
+}
@@ -0,0 +1,256 @@
+package blades
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/go-kratos/blades/tools"
+)
+
+// DefaultSecretStateKeys are the patterns of the session state keys whose
+// values StateKeyRedactor masks by default.
+var DefaultSecretStateKeys = []string{"*_token", "*_key"}
+
+// Redactor rewrites text that is logged or recorded to mask sensitive
+// values. The context is that of the call, e.g. with the session whose
+// state the text was rendered from.
+type Redactor func(ctx context.Context, text string) string
+
+// Redactors is a set of redactors applied in order. The same set masks the
+// prompts logged by WithPromptLogging, the entries recorded by Audit and the
+// requests shown by DryRun.
+type Redactors []Redactor
+
+// Redact returns the text with every redactor applied.
+func (rs Redactors) Redact(ctx context.Context, text string) string {
+	for _, r := range rs {
+		text = r(ctx, text)
+	}
+	return text
+}
+
+// RedactMessage returns a redacted copy of the message; the original is left
+// untouched. The sensitive arguments of tool calls are masked even without
+// redactors; see RedactToolCall.
+func (rs Redactors) RedactMessage(ctx context.Context, m *Message) *Message {
+	if m == nil || len(rs) == 0 && !hasSensitiveToolCalls(ctx, m) {
+		return m
+	}
+	clone := m.Clone()
+	for i, part := range clone.Parts {
+		switch v := part.(type) {
+		case TextPart:
+			v.Text = rs.Redact(ctx, v.Text)
+			clone.Parts[i] = v
+		case ToolPart:
+			v = RedactToolCall(ctx, v)
+			v.Request = rs.Redact(ctx, v.Request)
+			v.Response = rs.Redact(ctx, v.Response)
+			clone.Parts[i] = v
+		}
+	}
+	if clone.Error != nil {
+		detail := *clone.Error
+		detail.Message = rs.Redact(ctx, detail.Message)
+		clone.Error = &detail
+	}
+	return clone
+}
+
+// RegexpRedactor returns a Redactor that replaces every match of the patterns with "[REDACTED]".
+func RegexpRedactor(patterns ...*regexp.Regexp) Redactor {
+	scrub := RegexpScrubber(patterns...)
+	return func(ctx context.Context, text string) string {
+		return scrub(text)
+	}
+}
+
+// StateKeyRedactor returns a Redactor that replaces the values of the
+// session state keys matching the patterns with "[REDACTED]", wherever they
+// were rendered into the text. Patterns use the syntax of path.Match and are
+// matched against the lower-cased key; DefaultSecretStateKeys are used when
+// none are given. Only string and fmt.Stringer values are masked.
+func StateKeyRedactor(patterns ...string) Redactor {
+	if len(patterns) == 0 {
+		patterns = DefaultSecretStateKeys
+	}
+	return func(ctx context.Context, text string) string {
+		session, ok := FromSessionContext(ctx)
+		if !ok {
+			invocation, ok := FromInvocationContext(ctx)
+			if !ok || invocation.Session == nil {
+				return text
+			}
+			session = invocation.Session
+		}
+		for key, value := range session.State() {
+			if !slices.ContainsFunc(patterns, func(p string) bool {
+				matched, _ := path.Match(p, strings.ToLower(key))
+				return matched
+			}) {
+				continue
+			}
+			var secret string
+			switch v := value.(type) {
+			case string:
+				secret = v
+			case fmt.Stringer:
+				secret = v.String()
+			}
+			if secret == "" {
+				continue
+			}
+			text = strings.ReplaceAll(text, secret, RedactSecret(secret))
+			// The secret may have been rendered into JSON, e.g. a tool argument.
+			if quoted, err := json.Marshal(secret); err == nil {
+				escaped := string(quoted[1 : len(quoted)-1])
+				text = strings.ReplaceAll(text, escaped, RedactSecret(secret))
+			}
+		}
+		return text
+	}
+}
+
+// ctxSensitiveKey is the context key for the sensitive fields of the tools
+// of the agents running, by tool name.
+type ctxSensitiveKey struct{}
+
+// newSensitiveContext returns a context carrying the sensitive fields of the
+// tools, after those already in ctx.
+func newSensitiveContext(ctx context.Context, ts []tools.Tool) context.Context {
+	var sensitive map[string][]string
+	for _, tool := range ts {
+		fields := tools.SensitiveFields(tool)
+		if len(fields) == 0 {
+			continue
+		}
+		if sensitive == nil {
+			sensitive = maps.Clone(sensitiveFromContext(ctx))
+		}
+		if sensitive == nil {
+			sensitive = make(map[string][]string)
+		}
+		sensitive[tool.Name()] = slices.Concat(sensitive[tool.Name()], fields)
+	}
+	if sensitive == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, ctxSensitiveKey{}, sensitive)
+}
+
+// sensitiveFromContext returns the sensitive fields carried by the context, by tool name.
+func sensitiveFromContext(ctx context.Context) map[string][]string {
+	sensitive, _ := ctx.Value(ctxSensitiveKey{}).(map[string][]string)
+	return sensitive
+}
+
+// RedactToolCall returns the tool call with the sensitive arguments of its
+// tool, see tools.WithSensitiveFields, replaced by tools.Mask. The tools are
+// those of the agents running in ctx. Every record of tool calls, such as the
+// prompt log, Audit, DryRun and tracing, masks them.
+func RedactToolCall(ctx context.Context, part ToolPart) ToolPart {
+	if fields := sensitiveFromContext(ctx)[part.Name]; len(fields) > 0 {
+		part.Request = tools.MaskArguments(part.Request, fields...)
+	}
+	return part
+}
+
+// hasSensitiveToolCalls reports whether the message calls a tool with sensitive arguments.
+func hasSensitiveToolCalls(ctx context.Context, m *Message) bool {
+	sensitive := sensitiveFromContext(ctx)
+	if len(sensitive) == 0 {
+		return false
+	}
+	return slices.ContainsFunc(m.Parts, func(part Part) bool {
+		tool, ok := part.(ToolPart)
+		return ok && len(sensitive[tool.Name]) > 0
+	})
+}
+
+// ctxRedactorsKey is the context key for the redactors of the agents running.
+type ctxRedactorsKey struct{}
+
+// NewRedactorsContext returns a context carrying the redactors after those
+// already in ctx, so an agent also applies the redactors of the flows it runs in.
+func NewRedactorsContext(ctx context.Context, redactors ...Redactor) context.Context {
+	if len(redactors) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, ctxRedactorsKey{}, slices.Concat(FromRedactorsContext(ctx), redactors))
+}
+
+// FromRedactorsContext returns the redactors carried by the context.
+func FromRedactorsContext(ctx context.Context) Redactors {
+	redactors, _ := ctx.Value(ctxRedactorsKey{}).(Redactors)
+	return redactors
+}
+
+// WithRedactors sets the redactors of the agent, which mask sensitive values
+// in the prompts it logs, the requests it shows in a dry run and the model
+// calls Audit records for it.
+func WithRedactors(redactors ...Redactor) AgentOption {
+	return func(a *agent) {
+		a.redactors = append(a.redactors, redactors...)
+	}
+}
+
+// WithPromptLogging logs the rendered instruction and the messages of every
+// model request of the agent to the logger at debug level, after applying
+// the redactors, which are added to those of WithRedactors. Without
+// redactors, a StateKeyRedactor with the default patterns is added, so that
+// prompts are never logged unredacted. Nothing is rendered for the log
+// unless the logger is enabled for debug.
+func WithPromptLogging(logger *slog.Logger, redactors ...Redactor) AgentOption {
+	if len(redactors) == 0 {
+		redactors = []Redactor{StateKeyRedactor()}
+	}
+	return func(a *agent) {
+		a.promptLogger = logger
+		a.redactors = append(a.redactors, redactors...)
+	}
+}
+
+// loggedMessage is the form of a message in the prompt log.
+type loggedMessage struct {
+	Role   Role     `json:"role"`
+	Author string   `json:"author,omitempty"`
+	Text   string   `json:"text,omitempty"`
+	Tools  []string `json:"tools,omitempty"`
+}
+
+// logPrompt logs the request the agent is about to send to its model.
+func (a *agent) logPrompt(ctx context.Context, invocation *Invocation, req *ModelRequest) {
+	if a.promptLogger == nil || !a.promptLogger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	redactors := FromRedactorsContext(ctx)
+	var instruction string
+	if req.Instruction != nil {
+		instruction = redactors.RedactMessage(ctx, req.Instruction).Text()
+	}
+	messages := make([]loggedMessage, 0, len(req.Messages))
+	for _, m := range req.Messages {
+		m = redactors.RedactMessage(ctx, m)
+		logged := loggedMessage{Role: m.Role, Author: m.Author, Text: m.Text()}
+		for _, part := range m.Parts {
+			if tool, ok := part.(ToolPart); ok {
+				logged.Tools = append(logged.Tools, fmt.Sprintf("%s(%s) = %s", tool.Name, tool.Request, tool.Response))
+			}
+		}
+		messages = append(messages, logged)
+	}
+	a.promptLogger.LogAttrs(ctx, slog.LevelDebug, "prompt",
+		slog.String("agent", a.name),
+		slog.String("invocation", invocation.ID),
+		slog.String("model", invocation.Model),
+		slog.String("instruction", instruction),
+		slog.Any("messages", messages),
+	)
+}
@@ -0,0 +1,116 @@
+package blades
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const seededSecret = "sk-live-0123456789"
+
+func TestPromptLoggingRedaction(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	path := filepath.Join(t.TempDir(), "transcript.jsonl")
+	model := WrapModel(&mockModel{generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+		return textResponse("done"), nil
+	}}, Audit(NewJSONLTranscriptStore(path)))
+	agent, err := NewAgent("support",
+		WithModel(model),
+		WithInstruction("Call the billing API with {{.billing_api_key}} for {{.customer}}."),
+		WithPromptLogging(logger, StateKeyRedactor(), RegexpRedactor(regexp.MustCompile(`password=\S+`))),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := NewSession(map[string]any{"billing_api_key": seededSecret, "customer": "ACME"})
+	runner := NewRunner(agent)
+	ctx := context.Background()
+	if _, err := runner.Run(ctx, UserMessage("my password=hunter2, key "+seededSecret), WithSession(session)); err != nil {
+		t.Fatal(err)
+	}
+	dry, err := runner.Run(ctx, UserMessage("again"), WithSession(session), DryRun())
+	if err != nil {
+		t.Fatal(err)
+	}
+	transcript, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, output := range map[string]string{"log": logs.String(), "dry run": dry.Text(), "audit": string(transcript)} {
+		if strings.Contains(output, seededSecret) || strings.Contains(output, "hunter2") {
+			t.Fatalf("secret in the %s output: %s", name, output)
+		}
+		if !strings.Contains(output, "[REDACTED]") || !strings.Contains(output, "ACME") {
+			t.Fatalf("want the %s output redacted, got %s", name, output)
+		}
+	}
+	if !strings.Contains(logs.String(), `"msg":"prompt"`) || !strings.Contains(logs.String(), `"role":"user"`) {
+		t.Fatalf("want the rendered prompt logged, got %s", logs.String())
+	}
+}
+
+func TestPromptLoggingDefaultRedactor(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	agent, err := NewAgent("support",
+		WithModel(&mockModel{generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+			return textResponse("done"), nil
+		}}),
+		WithInstruction("Call the billing API with {{.billing_api_key}}."),
+		WithPromptLogging(logger),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := NewSession(map[string]any{"billing_api_key": seededSecret})
+	if _, err := NewRunner(agent).Run(context.Background(), UserMessage("hi"), WithSession(session)); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(logs.String(), seededSecret) || !strings.Contains(logs.String(), "[REDACTED]") {
+		t.Fatalf("want the secret state key redacted by default, got %s", logs.String())
+	}
+}
+
+func TestPromptLoggingLevel(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	agent, err := NewAgent("support",
+		WithModel(&mockModel{generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+			return textResponse("done"), nil
+		}}),
+		WithPromptLogging(logger),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewRunner(agent).Run(context.Background(), UserMessage("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if logs.Len() != 0 {
+		t.Fatalf("want no prompt logged above debug level, got %s", logs.String())
+	}
+}
+
+func TestStateKeyRedactor(t *testing.T) {
+	session := NewSession(map[string]any{
+		"github_token": `tok"en`,
+		"Stripe_Key":   "sk_abc",
+		"password":     "plain",
+	})
+	ctx := NewSessionContext(context.Background(), session)
+	got := StateKeyRedactor()(ctx, `{"token":"tok\"en"} sk_abc plain`)
+	if want := `{"token":"[REDACTED]"} [REDACTED] plain`; got != want {
+		t.Fatalf("want %s, got %s", want, got)
+	}
+	got = StateKeyRedactor("password")(ctx, "sk_abc plain")
+	if want := "sk_abc [REDACTED]"; got != want {
+		t.Fatalf("want %s, got %s", want, got)
+	}
+}
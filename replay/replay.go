@@ -0,0 +1,249 @@
+// Package replay records model responses and replays them for deterministic tests.
+package replay
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/go-kratos/blades"
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+// ErrNotRecorded is returned when no response has been recorded for a request.
+var ErrNotRecorded = errors.New("replay: request not recorded")
+
+// Cassette stores recorded model responses keyed by request.
+// It is safe for concurrent use.
+type Cassette struct {
+	mu           sync.RWMutex
+	interactions map[string][]json.RawMessage
+}
+
+// NewCassette creates an empty Cassette.
+func NewCassette() *Cassette {
+	return &Cassette{interactions: make(map[string][]json.RawMessage)}
+}
+
+// LoadCassette reads a cassette saved by Cassette.Save.
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("replay: %w", err)
+	}
+	c := NewCassette()
+	if err := json.Unmarshal(data, &c.interactions); err != nil {
+		return nil, fmt.Errorf("replay: decode %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Save writes the cassette to the given path as JSON.
+func (c *Cassette) Save(path string) error {
+	c.mu.RLock()
+	data, err := json.MarshalIndent(c.interactions, "", "  ")
+	c.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("replay: encode: %w", err)
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// Len returns the number of recorded requests.
+func (c *Cassette) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.interactions)
+}
+
+func (c *Cassette) record(key string, responses []*blades.ModelResponse) error {
+	encoded := make([]json.RawMessage, 0, len(responses))
+	for _, res := range responses {
+		data, err := json.Marshal(res)
+		if err != nil {
+			return fmt.Errorf("replay: encode response: %w", err)
+		}
+		encoded = append(encoded, data)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.interactions[key] = encoded
+	return nil
+}
+
+// lookup decodes the recorded responses for key, so every replay gets fresh values.
+func (c *Cassette) lookup(key string) ([]*blades.ModelResponse, error) {
+	c.mu.RLock()
+	encoded, ok := c.interactions[key]
+	c.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotRecorded, key)
+	}
+	responses := make([]*blades.ModelResponse, 0, len(encoded))
+	for _, data := range encoded {
+		var res blades.ModelResponse
+		if err := json.Unmarshal(data, &res); err != nil {
+			return nil, fmt.Errorf("replay: decode response: %w", err)
+		}
+		responses = append(responses, &res)
+	}
+	return responses, nil
+}
+
+// keyMessage is the part of a message that identifies a request.
+// IDs and timestamps differ between runs and are left out.
+type keyMessage struct {
+	Role  blades.Role   `json:"role"`
+	Parts []blades.Part `json:"parts"`
+}
+
+// Key derives the cassette key of a request to the named model. It covers the
+// instruction, messages, tool names, schemas and model options such as the seed.
+func Key(model string, req *blades.ModelRequest) (string, error) {
+	key := struct {
+		Model        string              `json:"model"`
+		Instruction  *keyMessage         `json:"instruction,omitempty"`
+		Messages     []keyMessage        `json:"messages"`
+		Tools        []string            `json:"tools,omitempty"`
+		InputSchema  *jsonschema.Schema  `json:"inputSchema,omitempty"`
+		OutputSchema *jsonschema.Schema  `json:"outputSchema,omitempty"`
+		Options      blades.ModelOptions `json:"options"`
+	}{
+		Model:        model,
+		Messages:     make([]keyMessage, 0, len(req.Messages)),
+		InputSchema:  req.InputSchema,
+		OutputSchema: req.OutputSchema,
+		Options:      req.Options,
+	}
+	if req.Instruction != nil {
+		key.Instruction = &keyMessage{Role: req.Instruction.Role, Parts: req.Instruction.Parts}
+	}
+	for _, m := range req.Messages {
+		key.Messages = append(key.Messages, keyMessage{Role: m.Role, Parts: m.Parts})
+	}
+	for _, t := range req.Tools {
+		key.Tools = append(key.Tools, t.Name())
+	}
+	data, err := json.Marshal(key)
+	if err != nil {
+		return "", fmt.Errorf("replay: encode request: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// recorder forwards requests to a live model and records its responses.
+type recorder struct {
+	model    blades.ModelProvider
+	cassette *Cassette
+}
+
+// NewRecorder wraps a model and records every response into the cassette.
+func NewRecorder(model blades.ModelProvider, cassette *Cassette) blades.ModelProvider {
+	return &recorder{model: model, cassette: cassette}
+}
+
+// Name returns the name of the wrapped model.
+func (r *recorder) Name() string {
+	return r.model.Name()
+}
+
+// Generate forwards the request and records the response.
+func (r *recorder) Generate(ctx context.Context, req *blades.ModelRequest) (*blades.ModelResponse, error) {
+	key, err := Key(r.model.Name(), req)
+	if err != nil {
+		return nil, err
+	}
+	res, err := r.model.Generate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.cassette.record(key, []*blades.ModelResponse{res}); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// NewStreaming forwards the request and records the streamed responses once the stream completes.
+func (r *recorder) NewStreaming(ctx context.Context, req *blades.ModelRequest) blades.Generator[*blades.ModelResponse, error] {
+	return func(yield func(*blades.ModelResponse, error) bool) {
+		key, err := Key(r.model.Name(), req)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		var responses []*blades.ModelResponse
+		for res, err := range r.model.NewStreaming(ctx, req) {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			responses = append(responses, res)
+			if !yield(res, nil) {
+				return
+			}
+		}
+		if err := r.cassette.record(key, responses); err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+// player serves recorded responses without calling a live model.
+type player struct {
+	name     string
+	cassette *Cassette
+}
+
+// NewPlayer returns a model that replays the responses recorded for the named model.
+// Requests that were not recorded fail with ErrNotRecorded.
+func NewPlayer(name string, cassette *Cassette) blades.ModelProvider {
+	return &player{name: name, cassette: cassette}
+}
+
+// Name returns the name of the recorded model.
+func (p *player) Name() string {
+	return p.name
+}
+
+// Generate returns the final recorded response for the request.
+func (p *player) Generate(ctx context.Context, req *blades.ModelRequest) (*blades.ModelResponse, error) {
+	key, err := Key(p.name, req)
+	if err != nil {
+		return nil, err
+	}
+	responses, err := p.cassette.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(responses) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNotRecorded, key)
+	}
+	return responses[len(responses)-1], nil
+}
+
+// NewStreaming replays the recorded responses for the request in order.
+func (p *player) NewStreaming(ctx context.Context, req *blades.ModelRequest) blades.Generator[*blades.ModelResponse, error] {
+	return func(yield func(*blades.ModelResponse, error) bool) {
+		key, err := Key(p.name, req)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		responses, err := p.cassette.lookup(key)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		for _, res := range responses {
+			if !yield(res, nil) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-kratos/blades"
+	"github.com/go-kratos/blades/evaluate"
+)
+
+// seededModel samples its answer from the request seed, like a live provider would.
+type seededModel struct {
+	calls atomic.Int64
+}
+
+func (m *seededModel) Name() string { return "seeded" }
+
+func (m *seededModel) Generate(ctx context.Context, req *blades.ModelRequest) (*blades.ModelResponse, error) {
+	m.calls.Add(1)
+	var seed int64
+	if req.Options.Seed != nil {
+		seed = *req.Options.Seed
+	}
+	r := rand.New(rand.NewSource(seed))
+	message := blades.NewAssistantMessage(blades.StatusCompleted)
+	message.Parts = blades.Parts(fmt.Sprintf("%s -> %d", req.Messages[len(req.Messages)-1].Text(), r.Intn(1000)))
+	message.Metadata["system_fingerprint"] = "fp_test"
+	return &blades.ModelResponse{Message: message}, nil
+}
+
+func (m *seededModel) NewStreaming(ctx context.Context, req *blades.ModelRequest) blades.Generator[*blades.ModelResponse, error] {
+	return func(yield func(*blades.ModelResponse, error) bool) {
+		yield(m.Generate(ctx, req))
+	}
+}
+
+var cases = []evaluate.Case{
+	{Name: "capital", Input: blades.UserMessage("What is the capital of France?")},
+	{Name: "convert", Input: blades.UserMessage("Convert 5 kilometers to meters.")},
+}
+
+// transcript renders the run outputs without run-specific IDs and timestamps.
+func transcript(t *testing.T, model blades.ModelProvider, seed int64) ([]byte, error) {
+	t.Helper()
+	agent, err := blades.NewAgent("qa", blades.WithModel(model))
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := evaluate.NewRunner(agent, evaluate.WithSeed(seed)).Run(context.Background(), cases...)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, r := range results {
+		if err := enc.Encode(map[string]any{
+			"case":     r.Case.Name,
+			"role":     r.Output.Role,
+			"author":   r.Output.Author,
+			"text":     r.Output.Text(),
+			"metadata": r.Output.Metadata,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func TestReplayDeterministic(t *testing.T) {
+	live := &seededModel{}
+	cassette := NewCassette()
+	recorded, err := transcript(t, NewRecorder(live, cassette), 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cassette.Len() != len(cases) {
+		t.Fatalf("expected %d recorded requests, got %d", len(cases), cassette.Len())
+	}
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	if err := cassette.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadCassette(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := transcript(t, NewPlayer("seeded", loaded), 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := transcript(t, NewPlayer("seeded", loaded), 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first, second) || !bytes.Equal(first, recorded) {
+		t.Fatalf("transcripts differ:\nrecorded %s\nfirst    %s\nsecond   %s", recorded, first, second)
+	}
+	if !bytes.Contains(first, []byte("fp_test")) {
+		t.Fatalf("expected the system fingerprint in the transcript: %s", first)
+	}
+	if n := live.calls.Load(); n != int64(len(cases)) {
+		t.Fatalf("replay must not call the live model, got %d calls", n)
+	}
+
+	if _, err := transcript(t, NewPlayer("seeded", loaded), 7); !errors.Is(err, ErrNotRecorded) {
+		t.Fatalf("a different seed must not match the recording, got %v", err)
+	}
+}
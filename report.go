@@ -0,0 +1,425 @@
+package blades
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// ModelPricing is the price of a model in dollars per million tokens.
+type ModelPricing struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+	// CachedInput and CacheWriteInput are the prices of the input tokens read
+	// from and written to the prompt cache; zero prices them as Input.
+	CachedInput     float64 `json:"cachedInput,omitempty"`
+	CacheWriteInput float64 `json:"cacheWriteInput,omitempty"`
+}
+
+// Cost returns the price of the usage in dollars.
+func (p ModelPricing) Cost(usage TokenUsage) float64 {
+	cached, cacheWrite := p.CachedInput, p.CacheWriteInput
+	if cached == 0 {
+		cached = p.Input
+	}
+	if cacheWrite == 0 {
+		cacheWrite = p.Input
+	}
+	input := usage.InputTokens - usage.CachedInputTokens - usage.CacheWriteInputTokens
+	return (float64(input)*p.Input +
+		float64(usage.CachedInputTokens)*cached +
+		float64(usage.CacheWriteInputTokens)*cacheWrite +
+		float64(usage.OutputTokens)*p.Output) / 1e6
+}
+
+var (
+	pricingMu         sync.RWMutex
+	registeredPricing = map[string]ModelPricing{}
+)
+
+// RegisterModelPricing sets the pricing of a model name or name prefix, which
+// run reports compute the cost of model calls with. No pricing is shipped,
+// since prices change and differ by contract.
+func RegisterModelPricing(name string, pricing ModelPricing) {
+	pricingMu.Lock()
+	defer pricingMu.Unlock()
+	registeredPricing[name] = pricing
+}
+
+// LookupModelPricing returns the registered pricing of the model. Exact names
+// win; otherwise the longest matching prefix does.
+func LookupModelPricing(name string) (ModelPricing, bool) {
+	pricingMu.RLock()
+	defer pricingMu.RUnlock()
+	if p, ok := registeredPricing[name]; ok {
+		return p, true
+	}
+	var (
+		match string
+		found ModelPricing
+	)
+	for _, n := range append([]string{name}, bedrockModelIDs(name)...) {
+		for prefix, p := range registeredPricing {
+			if strings.HasPrefix(n, prefix) && len(prefix) > len(match) {
+				match, found = prefix, p
+			}
+		}
+	}
+	return found, match != ""
+}
+
+// StepReport is the usage and latency of a step of a run: an agent, a flow,
+// a tool running agents or a graph node. The usage, cost and calls of a step
+// include those of its sub-steps.
+type StepReport struct {
+	Name string `json:"name"`
+	// Models are the models called by the step and its sub-steps, in the
+	// order of their first call.
+	Models []string   `json:"models,omitempty"`
+	Usage  TokenUsage `json:"usage"`
+	// Cost is the cost in dollars of the calls to models with a registered
+	// pricing; see RegisterModelPricing.
+	Cost       float64 `json:"cost"`
+	ModelCalls int     `json:"modelCalls"`
+	ToolCalls  int     `json:"toolCalls"`
+	// Runs is the number of times the step ran, e.g. the iterations of a loop.
+	Runs int `json:"runs"`
+	// WallTime is the time the step ran, measured across its runs; for a
+	// step that is not timed itself, such as a tool, it is the sum of the
+	// wall times of its sub-steps.
+	WallTime time.Duration `json:"wallTime"`
+	Steps    []*StepReport `json:"steps,omitempty"`
+}
+
+// RunReport is the breakdown of the usage and latency of a run by step,
+// nested as the flows of the run are; see Runner.Report.
+type RunReport struct {
+	InvocationID string `json:"invocationId"`
+	// Steps are the steps of the run, normally its root agent alone.
+	Steps []*StepReport `json:"steps"`
+	// Snapshots are the session state the run started with and after each
+	// of its steps, in the order the steps ended; see WithStateSnapshots.
+	Snapshots []*StateSnapshot `json:"snapshots,omitempty"`
+	// DroppedSnapshots counts the earliest snapshots dropped once the run
+	// recorded 1000 of them.
+	DroppedSnapshots int `json:"droppedSnapshots,omitempty"`
+}
+
+// Total returns the sum of the usage, cost and calls of the steps of the run.
+func (r *RunReport) Total() StepReport {
+	total := StepReport{Name: "total"}
+	for _, step := range r.Steps {
+		total.add(step)
+		total.WallTime += step.WallTime
+	}
+	return total
+}
+
+// add adds the models, usage, cost and calls of the sub-step.
+func (s *StepReport) add(sub *StepReport) {
+	for _, model := range sub.Models {
+		if !slices.Contains(s.Models, model) {
+			s.Models = append(s.Models, model)
+		}
+	}
+	s.Usage = s.Usage.Add(sub.Usage)
+	s.Cost += sub.Cost
+	s.ModelCalls += sub.ModelCalls
+	s.ToolCalls += sub.ToolCalls
+}
+
+// Render writes the report as a table aligned in columns, with the sub-steps
+// indented under their step.
+func (r *RunReport) Render(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STEP\tMODELS\tCALLS\tTOOLS\tINPUT\tOUTPUT\tTOKENS\tCOST\tTIME\t")
+	var write func(step *StepReport, depth int)
+	write = func(step *StepReport, depth int) {
+		models := strings.Join(step.Models, ",")
+		if models == "" {
+			models = "-"
+		}
+		fmt.Fprintf(tw, "%s%s\t%s\t%d\t%d\t%d\t%d\t%d\t$%.4f\t%s\t\n",
+			strings.Repeat("  ", depth), step.Name, models, step.ModelCalls, step.ToolCalls,
+			step.Usage.InputTokens, step.Usage.OutputTokens, step.Usage.TotalTokens, step.Cost,
+			step.WallTime.Round(time.Millisecond))
+		for _, sub := range step.Steps {
+			write(sub, depth+1)
+		}
+	}
+	for _, step := range r.Steps {
+		write(step, 0)
+	}
+	if len(r.Steps) > 1 {
+		total := r.Total()
+		write(&total, 0)
+	}
+	return tw.Flush()
+}
+
+// String returns the report rendered as a table.
+func (r *RunReport) String() string {
+	var b strings.Builder
+	r.Render(&b)
+	return b.String()
+}
+
+// maxReports is the number of runs a Runner keeps the report of.
+const maxReports = 256
+
+// Report returns the report of the run of the invocation. It is available
+// from the start of the run, e.g. to a streaming consumer once the final
+// message is emitted, and the Runner keeps it for its last 256 runs.
+func (r *Runner) Report(invocationID string) (*RunReport, bool) {
+	r.reportsMu.Lock()
+	report, ok := r.reports[invocationID]
+	r.reportsMu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	return report(), true
+}
+
+// trackReport makes the report of the run of the invocation available until
+// the returned function is called, which freezes it.
+func (r *Runner) trackReport(invocationID string, report func() *RunReport) func() {
+	r.reportsMu.Lock()
+	defer r.reportsMu.Unlock()
+	if r.reports == nil {
+		r.reports = make(map[string]func() *RunReport)
+	}
+	if _, ok := r.reports[invocationID]; !ok {
+		r.reportOrder = append(r.reportOrder, invocationID)
+	}
+	r.reports[invocationID] = report
+	for len(r.reportOrder) > maxReports {
+		delete(r.reports, r.reportOrder[0])
+		r.reportOrder = r.reportOrder[1:]
+	}
+	return func() {
+		final := report()
+		r.reportsMu.Lock()
+		defer r.reportsMu.Unlock()
+		if _, ok := r.reports[invocationID]; ok {
+			r.reports[invocationID] = func() *RunReport { return final }
+		}
+	}
+}
+
+// ctxReportKey is the context key for the collector of the run report.
+type ctxReportKey struct{}
+
+// reportCollector collects the usage and latency of the steps of a run by
+// their path. Runs nested in a run, e.g. a Runner called by a tool, report
+// into the collector of the outer run.
+type reportCollector struct {
+	mu   sync.Mutex
+	root reportStep
+	// snapshots enables the state snapshots of the steps, redacted by
+	// snapshotRedactors; see WithStateSnapshots.
+	snapshots         bool
+	snapshotRedactors Redactors
+	states            []stateSnapshot
+	droppedStates     int
+}
+
+// stateSnapshot is the session state after the step of the path.
+type stateSnapshot struct {
+	path  []string
+	state State
+}
+
+// reportStep is the collected usage and latency of a step.
+type reportStep struct {
+	name       string
+	models     []string
+	usage      TokenUsage
+	cost       float64
+	modelCalls int
+	toolCalls  int
+	runs       int
+	running    int
+	started    time.Time
+	wallTime   time.Duration
+	steps      []*reportStep
+}
+
+// newReportContext returns a context collecting the run report, and the
+// function returning the report of the steps run under the path of ctx.
+func newReportContext(ctx context.Context, invocationID string) (context.Context, func() *RunReport) {
+	c, ok := ctx.Value(ctxReportKey{}).(*reportCollector)
+	if !ok {
+		c = &reportCollector{}
+		ctx = context.WithValue(ctx, ctxReportKey{}, c)
+	}
+	path := PathFromContext(ctx)
+	return ctx, func() *RunReport {
+		return c.report(invocationID, path)
+	}
+}
+
+// TrackStep times a run of the step of the path of ctx in the run report, until
+// the returned function is called. Agents and flows are timed by PathErrors;
+// components that run sub-steps without it, such as graph nodes, call it.
+func TrackStep(ctx context.Context) func() {
+	c, ok := ctx.Value(ctxReportKey{}).(*reportCollector)
+	if !ok {
+		return func() {}
+	}
+	path := PathFromContext(ctx)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	step := c.step(path)
+	step.runs++
+	if step.running == 0 {
+		step.started = time.Now()
+	}
+	step.running++
+	return sync.OnceFunc(func() {
+		c.mu.Lock()
+		step.running--
+		if step.running == 0 {
+			step.wallTime += time.Since(step.started)
+		}
+		c.mu.Unlock()
+		c.recordState(ctx, path)
+	})
+}
+
+// enableStateSnapshots makes the run report of ctx record the session state
+// after each step, starting with the state of the session of ctx.
+func enableStateSnapshots(ctx context.Context, redactors Redactors) {
+	c, ok := ctx.Value(ctxReportKey{}).(*reportCollector)
+	if !ok {
+		return
+	}
+	c.mu.Lock()
+	c.snapshots = true
+	c.snapshotRedactors = slices.Concat(c.snapshotRedactors, redactors)
+	c.mu.Unlock()
+	c.recordState(ctx, PathFromContext(ctx))
+}
+
+// recordState adds a snapshot of the session state of ctx after the step of
+// the path, if the run records them.
+func (c *reportCollector) recordState(ctx context.Context, path []string) {
+	c.mu.Lock()
+	enabled, redactors := c.snapshots, c.snapshotRedactors
+	c.mu.Unlock()
+	if !enabled {
+		return
+	}
+	session, ok := FromSessionContext(ctx)
+	if !ok {
+		invocation, ok := FromInvocationContext(ctx)
+		if !ok || invocation.Session == nil {
+			return
+		}
+		session = invocation.Session
+	}
+	// The redactors of the steps in ctx apply too, and secret keys are
+	// masked even without any.
+	redactors = slices.Concat(redactors, FromRedactorsContext(ctx), Redactors{StateKeyRedactor()})
+	snapshot := stateSnapshot{path: slices.Clone(path), state: snapshotState(ctx, redactors, session.State())}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.states = append(c.states, snapshot)
+	if len(c.states) > maxStateSnapshots {
+		c.droppedStates += len(c.states) - maxStateSnapshots
+		c.states = slices.Delete(c.states, 0, len(c.states)-maxStateSnapshots)
+	}
+}
+
+// recordModelCall adds the usage and tool calls of a model response to the
+// step of the path of ctx in the run report.
+func recordModelCall(ctx context.Context, model string, message *Message) {
+	c, ok := ctx.Value(ctxReportKey{}).(*reportCollector)
+	if !ok {
+		return
+	}
+	pricing, _ := LookupModelPricing(model)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	step := c.step(PathFromContext(ctx))
+	if !slices.Contains(step.models, model) {
+		step.models = append(step.models, model)
+	}
+	step.usage = step.usage.Add(message.TokenUsage)
+	step.cost += pricing.Cost(message.TokenUsage)
+	step.modelCalls++
+	for _, part := range message.Parts {
+		if _, ok := part.(ToolPart); ok {
+			step.toolCalls++
+		}
+	}
+}
+
+// step returns the step of the path, adding it and its parents if they were
+// not seen yet; c.mu must be held.
+func (c *reportCollector) step(path []string) *reportStep {
+	step := &c.root
+	for _, name := range path {
+		i := slices.IndexFunc(step.steps, func(s *reportStep) bool { return s.name == name })
+		if i < 0 {
+			step.steps = append(step.steps, &reportStep{name: name})
+			i = len(step.steps) - 1
+		}
+		step = step.steps[i]
+	}
+	return step
+}
+
+// report returns the report of the sub-steps of the path.
+func (c *reportCollector) report(invocationID string, path []string) *RunReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	report := &RunReport{InvocationID: invocationID}
+	for _, step := range c.step(path).steps {
+		report.Steps = append(report.Steps, step.report(now))
+	}
+	for _, snapshot := range c.states {
+		if len(snapshot.path) < len(path) || !slices.Equal(snapshot.path[:len(path)], path) {
+			continue
+		}
+		report.Snapshots = append(report.Snapshots, &StateSnapshot{
+			Step:  strings.Join(snapshot.path[len(path):], "/"),
+			State: snapshot.state.DeepClone(),
+		})
+	}
+	report.DroppedSnapshots = c.droppedStates
+	return report
+}
+
+// report returns the report of the step, with the time of its run so far if it is running.
+func (s *reportStep) report(now time.Time) *StepReport {
+	r := &StepReport{
+		Name:       s.name,
+		Models:     slices.Clone(s.models),
+		Usage:      s.usage,
+		Cost:       s.cost,
+		ModelCalls: s.modelCalls,
+		ToolCalls:  s.toolCalls,
+		Runs:       s.runs,
+		WallTime:   s.wallTime,
+	}
+	if s.running > 0 {
+		r.WallTime += now.Sub(s.started)
+	}
+	var subTime time.Duration
+	for _, step := range s.steps {
+		sub := step.report(now)
+		r.add(sub)
+		subTime += sub.WallTime
+		r.Steps = append(r.Steps, sub)
+	}
+	if s.runs == 0 {
+		r.WallTime = subTime
+	}
+	return r
+}
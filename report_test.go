@@ -0,0 +1,60 @@
+package blades
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestModelPricing(t *testing.T) {
+	RegisterModelPricing("pricing-test", ModelPricing{Input: 3, Output: 15, CachedInput: 0.3})
+	pricing, ok := LookupModelPricing("pricing-test-2025")
+	if !ok {
+		t.Fatal("want the pricing found by prefix")
+	}
+	usage := TokenUsage{InputTokens: 1_000_000, CachedInputTokens: 500_000, CacheWriteInputTokens: 100_000, OutputTokens: 200_000}
+	// 400k uncached and 100k written at $3, 500k cached at $0.30, 200k out at $15.
+	if cost := pricing.Cost(usage); math.Abs(cost-(1.2+0.3+0.15+3)) > 1e-9 {
+		t.Fatalf("want $4.65, got $%g", cost)
+	}
+	if _, ok := LookupModelPricing("unpriced"); ok {
+		t.Fatal("want no pricing of an unregistered model")
+	}
+}
+
+func TestRunnerReportStreaming(t *testing.T) {
+	model := &mockModel{name: "report-stream", generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+		res := textResponse("done")
+		res.Message.TokenUsage = TokenUsage{InputTokens: 7, OutputTokens: 3, TotalTokens: 10}
+		return res, nil
+	}}
+	agent, err := NewAgent("writer", WithModel(model))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := NewRunner(agent)
+	var atFinal *RunReport
+	for m, err := range runner.RunStream(context.Background(), UserMessage("go"), WithInvocationID("inv-1")) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Final {
+			atFinal, _ = runner.Report("inv-1")
+		}
+	}
+	if atFinal == nil || len(atFinal.Steps) != 1 || atFinal.Steps[0].ModelCalls != 1 || atFinal.Steps[0].Usage.TotalTokens != 10 {
+		t.Fatalf("want the report once the final message is emitted, got %v", atFinal)
+	}
+	report, _ := runner.Report("inv-1")
+	if report.Steps[0].Runs != 1 || report.Steps[0].WallTime < atFinal.Steps[0].WallTime {
+		t.Fatalf("want the report frozen when the run ended, got %+v", report.Steps[0])
+	}
+	lines := strings.Split(strings.TrimSpace(report.String()), "\n")
+	if len(lines) != 2 || strings.Index(lines[0], "TOKENS") != strings.Index(lines[1], "10 ") || !strings.HasPrefix(lines[1], "writer  report-stream  1") {
+		t.Fatalf("want an aligned table, got:\n%s", report)
+	}
+	if _, ok := runner.Report("other"); ok {
+		t.Fatal("want no report of an unknown invocation")
+	}
+}
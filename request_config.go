@@ -0,0 +1,70 @@
+package blades
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// RequestConfig overrides the provider credentials and model for the requests
+// made with a context, such as a tenant's own API key in a multi-tenant
+// deployment. Empty fields fall back to the provider's construction-time config.
+//
+// The API key is redacted when a RequestConfig is formatted or logged.
+type RequestConfig struct {
+	// Tenant identifies the caller the configuration belongs to.
+	Tenant  string
+	APIKey  string
+	BaseURL string
+	Model   string
+}
+
+// ctxRequestConfigKey is the context key for RequestConfig.
+type ctxRequestConfigKey struct{}
+
+// WithRequestConfig returns a new context that carries the request config.
+func WithRequestConfig(ctx context.Context, config RequestConfig) context.Context {
+	return context.WithValue(ctx, ctxRequestConfigKey{}, config)
+}
+
+// FromRequestConfigContext retrieves the RequestConfig from the context, if present.
+func FromRequestConfigContext(ctx context.Context) (RequestConfig, bool) {
+	config, ok := ctx.Value(ctxRequestConfigKey{}).(RequestConfig)
+	return config, ok
+}
+
+// ResolveModel returns the model of the request config in ctx, or fallback when none is set.
+func ResolveModel(ctx context.Context, fallback string) string {
+	if config, ok := FromRequestConfigContext(ctx); ok && config.Model != "" {
+		return config.Model
+	}
+	return fallback
+}
+
+// RedactSecret masks a secret so it is safe to log.
+func RedactSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "[REDACTED]"
+}
+
+// String returns the config with the API key redacted.
+func (c RequestConfig) String() string {
+	return fmt.Sprintf("{Tenant:%s APIKey:%s BaseURL:%s Model:%s}", c.Tenant, RedactSecret(c.APIKey), c.BaseURL, c.Model)
+}
+
+// GoString returns the config with the API key redacted, for the %#v verb.
+func (c RequestConfig) GoString() string {
+	return fmt.Sprintf("blades.RequestConfig{Tenant:%q, APIKey:%q, BaseURL:%q, Model:%q}", c.Tenant, RedactSecret(c.APIKey), c.BaseURL, c.Model)
+}
+
+// LogValue implements slog.LogValuer with the API key redacted.
+func (c RequestConfig) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("tenant", c.Tenant),
+		slog.String("api_key", RedactSecret(c.APIKey)),
+		slog.String("base_url", c.BaseURL),
+		slog.String("model", c.Model),
+	)
+}
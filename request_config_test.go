@@ -0,0 +1,82 @@
+package blades
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRequestConfigFallback(t *testing.T) {
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		want   string
+		wantOK bool
+	}{
+		{name: "no config", ctx: context.Background(), want: "static-model"},
+		{name: "empty model", ctx: WithRequestConfig(context.Background(), RequestConfig{APIKey: "sk-tenant"}), want: "static-model", wantOK: true},
+		{name: "override", ctx: WithRequestConfig(context.Background(), RequestConfig{Model: "tenant-model"}), want: "tenant-model", wantOK: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := FromRequestConfigContext(tt.ctx); ok != tt.wantOK {
+				t.Fatalf("want ok=%v, got %v", tt.wantOK, ok)
+			}
+			if got := ResolveModel(tt.ctx, "static-model"); got != tt.want {
+				t.Fatalf("want %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRequestConfigInvocationModel(t *testing.T) {
+	var got string
+	model := &mockModel{
+		name: "static-model",
+		generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+			return textResponse("ok"), nil
+		},
+	}
+	agent, err := NewAgent("tenant", WithModel(model), WithMiddleware(func(next Handler) Handler {
+		return HandleFunc(func(ctx context.Context, invocation *Invocation) Generator[*Message, error] {
+			got = invocation.Model
+			return next.Handle(ctx, invocation)
+		})
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := WithRequestConfig(context.Background(), RequestConfig{Tenant: "acme", Model: "tenant-model"})
+	if _, err := NewRunner(agent).Run(ctx, UserMessage("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if got != "tenant-model" {
+		t.Fatalf("expected the invocation to report the tenant model, got %q", got)
+	}
+}
+
+func TestRequestConfigRedaction(t *testing.T) {
+	const secret = "sk-very-secret"
+	config := RequestConfig{Tenant: "acme", APIKey: secret, BaseURL: "https://example.com", Model: "gpt-4o"}
+	var buf bytes.Buffer
+	slog.New(slog.NewJSONHandler(&buf, nil)).Info("request", "config", config)
+	outputs := map[string]string{
+		"%v":    fmt.Sprintf("%v", config),
+		"%+v":   fmt.Sprintf("%+v", config),
+		"%#v":   fmt.Sprintf("%#v", config),
+		"%s":    fmt.Sprintf("%s", config),
+		"field": fmt.Sprintf("%+v", struct{ Config RequestConfig }{config}),
+		"slog":  buf.String(),
+	}
+	for name, out := range outputs {
+		if strings.Contains(out, secret) {
+			t.Fatalf("%s leaks the API key: %s", name, out)
+		}
+		if !strings.Contains(out, "acme") {
+			t.Fatalf("%s drops the tenant: %s", name, out)
+		}
+	}
+}
@@ -2,6 +2,9 @@ package blades
 
 import (
 	"context"
+	"fmt"
+	"sync"
+	"time"
 
 	"github.com/go-kratos/blades/stream"
 )
@@ -17,6 +20,7 @@ func WithSession(session Session) RunOption {
 }
 
 // WithInvocationID sets a custom invocation ID for the Runner.
+// An empty ID is ignored and a new one is generated.
 func WithInvocationID(invocationID string) RunOption {
 	return func(r *RunOptions) {
 		r.InvocationID = invocationID
@@ -44,28 +48,114 @@ func WithResumeHistory(resumeHistory bool) RunnerOption {
 type RunOptions struct {
 	Session      Session
 	InvocationID string
+	// DryRun stops the run before the model calls; see DryRun.
+	DryRun bool
+	// IdempotencyKey replays the answer of a completed run; see WithIdempotencyKey.
+	IdempotencyKey string
+	// Priority orders the run among those waiting for a slot; see WithPriority.
+	Priority Priority
+	// StateSnapshots records the session state after each step of the run
+	// into its report, redacted by SnapshotRedactors; see WithStateSnapshots.
+	StateSnapshots    bool
+	SnapshotRedactors Redactors
 }
 
 // Runner is responsible for executing a Runnable agent within a session context.
+//
+// A Runner is safe for concurrent use and is meant to be shared, e.g. across
+// HTTP handlers: every Run and RunStream builds its own Invocation from a copy
+// of the input message, so no per-run state lives on the Runner apart from the
+// reports of its last runs; see Runner.Report. Resumable and
+// ResumeHistory must not be changed once runs have started.
 type Runner struct {
-	Resumable     bool
-	ResumeHistory bool
-	rootAgent     Agent
+	Resumable         bool
+	ResumeHistory     bool
+	rootAgent         Agent
+	limits            Limits
+	inputLimits       inputLimits
+	sessionPolicy     SessionPolicy
+	maxTransferDepth  int
+	singleflight      SingleflightKey
+	idempotencyStore  IdempotencyStore
+	idempotencyWindow time.Duration
+	limiter           *Limiter
+	mu                sync.Mutex
+	active            map[string]*activeRun
+	flightsMu         sync.Mutex
+	flights           map[string]*stream.Multicast[*Message]
+	reportsMu         sync.Mutex
+	reports           map[string]func() *RunReport
+	reportOrder       []string
+	draining          bool
+	drained           chan struct{}
+}
+
+// activeRun is an invocation running in the Runner.
+type activeRun struct {
+	cancel  context.CancelCauseFunc
+	session Session
 }
 
 // NewRunner creates a new Runner with the given agent and options.
 func NewRunner(rootAgent Agent, opts ...RunnerOption) *Runner {
 	r := &Runner{
-		rootAgent: rootAgent,
+		rootAgent:         rootAgent,
+		maxTransferDepth:  DefaultMaxTransferDepth,
+		idempotencyWindow: DefaultIdempotencyWindow,
 	}
 	for _, opt := range opts {
 		opt(r)
 	}
+	if r.idempotencyStore == nil {
+		r.idempotencyStore = NewInMemoryIdempotencyStore()
+	}
 	return r
 }
 
+// Cancel cancels the active invocation with the given ID and reports whether it was found.
+// It is safe to call from another goroutine. The agent stops before its next
+// model call, even if the current provider call or tool cannot be interrupted,
+// and ends the stream with a StatusCancelled message that is recorded in the session.
+func (r *Runner) Cancel(invocationID string) bool {
+	r.mu.Lock()
+	run, ok := r.active[invocationID]
+	r.mu.Unlock()
+	if ok {
+		run.cancel(ErrInvocationCancelled)
+	}
+	return ok
+}
+
+// track registers a cancellable context for the invocation until the returned
+// func is called. It returns ErrRunnerDraining once the Runner is draining.
+func (r *Runner) track(ctx context.Context, invocation *Invocation) (context.Context, func(), error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.draining {
+		cancel(nil)
+		return nil, nil, ErrRunnerDraining
+	}
+	if r.active == nil {
+		r.active = make(map[string]*activeRun)
+	}
+	r.active[invocation.ID] = &activeRun{cancel: cancel, session: invocation.Session}
+	return ctx, func() {
+		r.mu.Lock()
+		delete(r.active, invocation.ID)
+		if r.draining && len(r.active) == 0 {
+			r.closeDrained()
+		}
+		r.mu.Unlock()
+		cancel(nil)
+	}, nil
+}
+
 // buildInvocation constructs an Invocation object for the given message and options.
 func (r *Runner) buildInvocation(ctx context.Context, message *Message, streamable bool, o *RunOptions) (*Invocation, error) {
+	if o.InvocationID == "" {
+		o.InvocationID = NewInvocationID()
+	}
 	invocation := &Invocation{
 		ID:         o.InvocationID,
 		Session:    o.Session,
@@ -85,6 +175,27 @@ func (r *Runner) appendNewMessage(ctx context.Context, invocation *Invocation, m
 	if invocation.Session == nil {
 		return nil
 	}
+	if invocation.Resumable {
+		for _, m := range invocation.Session.Messages(MessageFilter{Role: RoleUser}) {
+			if m.InvocationID != invocation.ID {
+				continue
+			}
+			if m.ID == message.ID || m.Text() == message.Text() {
+				// The same input was already recorded by the run being resumed.
+				message.InvocationID = invocation.ID
+				return nil
+			}
+			question := pendingQuestion(invocation.Session, invocation.ID)
+			if question == nil {
+				return fmt.Errorf("resume invocation %s: %w: recorded %q, got %q", invocation.ID, ErrInvocationMismatch, m.Text(), message.Text())
+			}
+			// The message answers the question the invocation paused on; the
+			// agents run again with the recorded input.
+			invocation.Message = m.Clone()
+			message.InvocationID = question.InvocationID
+			return invocation.Session.Append(ctx, message)
+		}
+	}
 	message.InvocationID = invocation.ID
 	return invocation.Session.Append(ctx, message)
 }
@@ -108,27 +219,21 @@ func (r *Runner) historySets(ctx context.Context, session Session) map[string]*M
 }
 
 // Run executes the agent with the provided prompt and options within the session context.
+// It returns the message marked as the final answer, or the last message if none is.
 func (r *Runner) Run(ctx context.Context, message *Message, opts ...RunOption) (*Message, error) {
-	o := &RunOptions{
-		Session:      NewSession(),
-		InvocationID: NewInvocationID(),
-	}
-	for _, opt := range opts {
-		opt(o)
-	}
-	var (
-		err    error
-		output *Message
-	)
-	invocation, err := r.buildInvocation(ctx, message, false, o)
-	if err != nil {
-		return nil, err
-	}
-	iter := r.rootAgent.Run(NewSessionContext(ctx, o.Session), invocation)
-	for output, err = range iter {
+	o := r.runOptions(opts)
+	var output, final *Message
+	for m, err := range r.execute(ctx, message, false, o) {
 		if err != nil {
 			return nil, err
 		}
+		output = m
+		if m != nil && m.Final {
+			final = m
+		}
+	}
+	if final != nil {
+		return final, nil
 	}
 	if output == nil {
 		return nil, ErrNoFinalResponse
@@ -138,6 +243,10 @@ func (r *Runner) Run(ctx context.Context, message *Message, opts ...RunOption) (
 
 // RunStream executes the agent in a streaming manner, yielding messages as they are produced.
 func (r *Runner) RunStream(ctx context.Context, message *Message, opts ...RunOption) Generator[*Message, error] {
+	return r.execute(ctx, message, true, r.runOptions(opts))
+}
+
+func (r *Runner) runOptions(opts []RunOption) *RunOptions {
 	o := &RunOptions{
 		Session:      NewSession(),
 		InvocationID: NewInvocationID(),
@@ -145,18 +254,97 @@ func (r *Runner) RunStream(ctx context.Context, message *Message, opts ...RunOpt
 	for _, opt := range opts {
 		opt(o)
 	}
-	invocation, err := r.buildInvocation(ctx, message, true, o)
+	return o
+}
+
+// execute runs the agent, sharing the execution with concurrent runs of the
+// same idempotency key, or identical ones when the Runner deduplicates them.
+func (r *Runner) execute(ctx context.Context, message *Message, streamable bool, o *RunOptions) Generator[*Message, error] {
+	// The input is checked before it reaches the session or a provider.
+	message, err := r.inputLimits.check(message)
 	if err != nil {
 		return stream.Error[*Message](err)
 	}
-	history := r.historySets(ctx, o.Session)
-	return stream.Filter(r.rootAgent.Run(NewSessionContext(ctx, o.Session), invocation), func(msg *Message) bool {
-		// If ResumeHistory is enabled, allow all messages.
-		// Otherwise, filter out messages that already exist in history.
-		if r.ResumeHistory {
-			return true
+	if o.IdempotencyKey != "" && !o.DryRun {
+		return r.shared(ctx, "idempotency/"+idempotencyScope(idempotencySession(o), o.IdempotencyKey), streamable, func(ctx context.Context) Generator[*Message, error] {
+			return r.idempotent(ctx, message, streamable, o)
+		})
+	}
+	if r.singleflight != nil && !o.DryRun {
+		if key := r.singleflight(ctx, o.Session, message); key != "" {
+			return r.shared(ctx, key, streamable, func(ctx context.Context) Generator[*Message, error] {
+				return r.run(ctx, message, streamable, o)
+			})
 		}
-		_, exists := history[msg.ID]
-		return !exists
-	})
+	}
+	return r.run(ctx, message, streamable, o)
+}
+
+// run executes the agent in the session of the options.
+func (r *Runner) run(ctx context.Context, message *Message, streamable bool, o *RunOptions) Generator[*Message, error] {
+	if r.isDraining() {
+		return stream.Error[*Message](ErrRunnerDraining)
+	}
+	if o.DryRun {
+		if o.Session != nil {
+			fork, err := o.Session.Fork("")
+			if err != nil {
+				return stream.Error[*Message](err)
+			}
+			o.Session = fork
+		}
+		ctx = context.WithValue(ctx, ctxDryRunKey{}, true)
+	}
+	return func(yield func(*Message, error) bool) {
+		// The run waits for a slot before its input reaches the session.
+		if r.limiter != nil && !o.DryRun {
+			release, err := r.limiter.Acquire(NewPriorityContext(ctx, o.Priority))
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			defer release()
+		}
+		// The run records its own copy of the input, so that callers may share
+		// one message across concurrent runs.
+		invocation, err := r.buildInvocation(ctx, message.Clone(), streamable, o)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		var history map[string]*Message
+		if streamable {
+			history = r.historySets(ctx, o.Session)
+		}
+		ctx, done, err := r.track(ctx, invocation)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer done()
+		ctx, cancel := withLimits(ctx, r.rootAgent.Name(), r.limits)
+		defer cancel()
+		ctx = withTransfers(ctx, r.maxTransferDepth)
+		ctx, report := newReportContext(ctx, invocation.ID)
+		if o.StateSnapshots {
+			enableStateSnapshots(NewSessionContext(ctx, o.Session), o.SnapshotRedactors)
+		}
+		defer r.trackReport(invocation.ID, report)()
+		messages := stream.Filter(MarkFinal(r.rootAgent.Run(NewSessionContext(ctx, o.Session), invocation), true), func(msg *Message) bool {
+			// If ResumeHistory is enabled, allow all messages.
+			// Otherwise, filter out messages that already exist in history.
+			if !streamable || r.ResumeHistory {
+				return true
+			}
+			_, exists := history[msg.ID]
+			return !exists
+		})
+		// The policy runs once the run ended, however it ended.
+		defer r.sessionPolicy.apply(ctx, o.Session)
+		for msg, err := range messages {
+			if !yield(msg, err) {
+				return
+			}
+		}
+	}
 }
@@ -0,0 +1,214 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-kratos/blades/tools"
+)
+
+func TestRunnerCancel(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream bool
+	}{
+		{name: "run", stream: false},
+		{name: "stream", stream: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := &mockModel{
+				generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+					return &ModelResponse{Message: &Message{Role: RoleTool, Status: StatusCompleted, Parts: []Part{
+						ToolPart{ID: "call-1", Name: "slow", Request: "{}"},
+					}}}, nil
+				},
+			}
+			started, release := make(chan struct{}), make(chan struct{})
+			// The tool ignores its context, like a call that cannot be interrupted.
+			slow := tools.NewTool("slow", "a long running tool", tools.HandleFunc(func(ctx context.Context, input string) (string, error) {
+				close(started)
+				<-release
+				return "done", nil
+			}))
+			agent, err := NewAgent("worker", WithModel(model), WithTools(slow))
+			if err != nil {
+				t.Fatal(err)
+			}
+			runner := NewRunner(agent)
+			session := NewSession()
+			const invocationID = "inv-1"
+			go func() {
+				<-started
+				if !runner.Cancel(invocationID) {
+					t.Error("expected the invocation to be active")
+				}
+				close(release)
+			}()
+
+			var last *Message
+			opts := []RunOption{WithSession(session), WithInvocationID(invocationID)}
+			if tt.stream {
+				for message, err := range runner.RunStream(context.Background(), UserMessage("go"), opts...) {
+					if err != nil {
+						t.Fatal(err)
+					}
+					last = message
+				}
+			} else {
+				last, err = runner.Run(context.Background(), UserMessage("go"), opts...)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if last == nil || last.Status != StatusCancelled {
+				t.Fatalf("expected a cancelled final message, got %+v", last)
+			}
+			if n := model.calls.Load(); n != 1 {
+				t.Fatalf("expected no model calls after cancellation, got %d calls", n)
+			}
+			if !IsInvocationCancelled(session, invocationID) {
+				t.Fatal("expected the session to record the cancellation")
+			}
+			if runner.Cancel(invocationID) {
+				t.Fatal("finished invocations must not be cancellable")
+			}
+		})
+	}
+}
+
+func TestRunnerInvocationID(t *testing.T) {
+	var seen string
+	model := &mockModel{
+		generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+			seen, _ = InvocationIDFromContext(ctx)
+			return textResponse("ok"), nil
+		},
+	}
+	agent, err := NewAgent("worker", WithModel(model))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := NewRunner(agent, WithResumable(true))
+	session := NewSession()
+	// An empty ID is replaced by a generated one.
+	if _, err := runner.Run(context.Background(), UserMessage("hi"), WithSession(session), WithInvocationID("")); err != nil {
+		t.Fatal(err)
+	}
+	if seen == "" || session.History()[0].InvocationID != seen {
+		t.Fatalf("expected a generated invocation ID in context and session, got %q", seen)
+	}
+
+	tests := []struct {
+		name    string
+		message *Message
+		wantErr error
+	}{
+		{name: "same input", message: UserMessage("hi")},
+		{name: "different input", message: UserMessage("bye"), wantErr: ErrInvocationMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := runner.Run(context.Background(), tt.message, WithSession(session), WithInvocationID(seen))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("want %v, got %v", tt.wantErr, err)
+			}
+			if n := len(session.Messages(MessageFilter{Role: RoleUser})); n != 1 {
+				t.Fatalf("expected the user message to be recorded once, got %d", n)
+			}
+		})
+	}
+}
+
+// TestRunnerConcurrentUse shares one Runner, Agent and input message across
+// concurrent runs; run it with -race.
+func TestRunnerConcurrentUse(t *testing.T) {
+	model := &mockModel{generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+		if last := req.Messages[len(req.Messages)-1]; last.Role == RoleTool {
+			return textResponse("done: " + req.Instruction.Text()), nil
+		}
+		return &ModelResponse{Message: &Message{Role: RoleTool, Status: StatusCompleted, Parts: []Part{
+			ToolPart{ID: "call-1", Name: "record", Request: "a"},
+			ToolPart{ID: "call-2", Name: "record", Request: "b"},
+		}}}, nil
+	}}
+	record := tools.NewTool("record", "records the input", tools.HandleFunc(func(ctx context.Context, input string) (string, error) {
+		if session, ok := FromSessionContext(ctx); ok {
+			session.SetState(input, true)
+		}
+		return "ok", nil
+	}))
+	var handled atomic.Int64
+	count := func(next Handler) Handler {
+		return HandleFunc(func(ctx context.Context, invocation *Invocation) Generator[*Message, error] {
+			handled.Add(1)
+			return next.Handle(ctx, invocation)
+		})
+	}
+	agent, err := NewAgent("worker",
+		WithModel(model),
+		WithInstruction("serve {{.user}}"),
+		WithTools(record),
+		WithMiddleware(count),
+		WithModelOptions(StopSequences("END"), ProviderOptions(map[string]any{"tier": "flex"})),
+		WithOutputKey("answer"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := NewRunner(agent)
+	input := UserMessage("go")
+
+	const runs = 200
+	var wg sync.WaitGroup
+	errs := make(chan error, runs)
+	for i := range runs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			user := fmt.Sprintf("user-%d", i)
+			session := NewSession(map[string]any{"user": user})
+			var (
+				output *Message
+				err    error
+			)
+			if i%2 == 0 {
+				output, err = runner.Run(context.Background(), input, WithSession(session))
+			} else {
+				for m, err := range runner.RunStream(context.Background(), input, WithSession(session)) {
+					if err != nil {
+						errs <- err
+						return
+					}
+					output = m
+				}
+			}
+			if err != nil {
+				errs <- err
+				return
+			}
+			if want := "done: serve " + user; output.Text() != want {
+				errs <- fmt.Errorf("want %q, got %q", want, output.Text())
+				return
+			}
+			if state := session.State(); state["a"] != true || state["b"] != true || state["answer"] != output.Text() {
+				errs <- fmt.Errorf("want the writes of the run in its own session, got %v", state)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if n := handled.Load(); n != runs {
+		t.Fatalf("want %d handled runs, got %d", runs, n)
+	}
+	if input.InvocationID != "" || !input.CreatedAt.IsZero() {
+		t.Fatalf("want the shared input left untouched, got invocation %q, created at %v", input.InvocationID, input.CreatedAt)
+	}
+}
@@ -0,0 +1,382 @@
+package blades
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Schedule computes when a scheduled run fires next.
+type Schedule interface {
+	// Next returns the first activation time after t.
+	Next(t time.Time) time.Time
+}
+
+// Every returns a Schedule that fires at a fixed interval.
+func Every(interval time.Duration) Schedule {
+	return intervalSchedule(interval)
+}
+
+type intervalSchedule time.Duration
+
+func (s intervalSchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(s))
+}
+
+// ScheduleRun describes one run of a schedule, including its retries.
+type ScheduleRun struct {
+	JobID      string    `json:"jobId"`
+	Attempt    int       `json:"attempt"`
+	Status     JobStatus `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt,omitzero"`
+}
+
+// ScheduleRecord is the persisted state of a schedule.
+type ScheduleRecord struct {
+	ID      string       `json:"id"`
+	NextRun time.Time    `json:"nextRun"`
+	LastRun *ScheduleRun `json:"lastRun,omitempty"`
+}
+
+// ScheduleStore persists schedule records, so that schedules resume after a restart.
+type ScheduleStore interface {
+	// SaveSchedule stores the record, replacing any record with the same ID.
+	SaveSchedule(context.Context, ScheduleRecord) error
+	// LoadSchedule returns the record with the given ID.
+	LoadSchedule(context.Context, string) (ScheduleRecord, error)
+}
+
+// InMemoryScheduleStore is an in-memory implementation of ScheduleStore.
+type InMemoryScheduleStore struct {
+	mu      sync.RWMutex
+	records map[string]ScheduleRecord
+}
+
+// NewInMemoryScheduleStore creates a new instance of InMemoryScheduleStore.
+func NewInMemoryScheduleStore() *InMemoryScheduleStore {
+	return &InMemoryScheduleStore{records: make(map[string]ScheduleRecord)}
+}
+
+// SaveSchedule stores the record in memory.
+func (s *InMemoryScheduleStore) SaveSchedule(ctx context.Context, record ScheduleRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[record.ID] = record
+	return nil
+}
+
+// LoadSchedule returns the record with the given ID.
+func (s *InMemoryScheduleStore) LoadSchedule(ctx context.Context, id string) (ScheduleRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	record, ok := s.records[id]
+	if !ok {
+		return ScheduleRecord{}, fmt.Errorf("schedule store: load %s: %w", id, ErrScheduleNotFound)
+	}
+	return record, nil
+}
+
+// InputFunc builds the input message of a scheduled run.
+type InputFunc func(context.Context) (*Message, error)
+
+// MemorySaver stores the history of a session as long-term memory.
+// memory.MemoryStore implementations satisfy it.
+type MemorySaver interface {
+	SaveSession(context.Context, Session) error
+}
+
+// OverlapPolicy decides what happens when a schedule fires while its previous run is still active.
+type OverlapPolicy int
+
+const (
+	// OverlapSkip skips the activation.
+	OverlapSkip OverlapPolicy = iota
+	// OverlapAllow starts another run next to the active one.
+	OverlapAllow
+)
+
+// ScheduleOption defines options for a scheduled agent run.
+type ScheduleOption func(*scheduleEntry)
+
+// WithOverlapPolicy sets the overlap policy. Defaults to OverlapSkip.
+func WithOverlapPolicy(policy OverlapPolicy) ScheduleOption {
+	return func(e *scheduleEntry) {
+		e.overlap = policy
+	}
+}
+
+// WithScheduleRetry retries a failed run up to attempts times in total, waiting backoff between attempts.
+func WithScheduleRetry(attempts int, backoff time.Duration) ScheduleOption {
+	return func(e *scheduleEntry) {
+		e.attempts = max(attempts, 1)
+		e.backoff = backoff
+	}
+}
+
+// WithScheduleMemory saves the session of every completed run to the memory,
+// giving the otherwise isolated runs a shared long-term memory.
+func WithScheduleMemory(memory MemorySaver) ScheduleOption {
+	return func(e *scheduleEntry) {
+		e.memory = memory
+	}
+}
+
+// scheduleEntry is a schedule registered with a Scheduler.
+type scheduleEntry struct {
+	id       string
+	schedule Schedule
+	jobs     *JobRunner
+	input    InputFunc
+	overlap  OverlapPolicy
+	attempts int
+	backoff  time.Duration
+	memory   MemorySaver
+	active   sync.WaitGroup
+	running  int
+	stop     chan struct{}
+}
+
+// Scheduler runs agents through a JobRunner on a schedule. Every run gets its
+// own session; schedule records are persisted in a ScheduleStore.
+type Scheduler struct {
+	store   ScheduleStore
+	mu      sync.Mutex
+	entries map[string]*scheduleEntry
+	ctx     context.Context
+}
+
+// NewScheduler creates a new Scheduler persisting schedules in the store.
+// A nil store uses an InMemoryScheduleStore.
+func NewScheduler(store ScheduleStore) *Scheduler {
+	if store == nil {
+		store = NewInMemoryScheduleStore()
+	}
+	return &Scheduler{store: store, entries: make(map[string]*scheduleEntry)}
+}
+
+// Add registers a schedule under id. If the store holds a record for id, for
+// example from before a restart, its next run time is kept, and a run missed
+// in the meantime fires once when the scheduler starts.
+func (s *Scheduler) Add(ctx context.Context, id string, schedule Schedule, jobs *JobRunner, input InputFunc, opts ...ScheduleOption) error {
+	e := &scheduleEntry{
+		id:       id,
+		schedule: schedule,
+		jobs:     jobs,
+		input:    input,
+		attempts: 1,
+		stop:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	if _, err := s.store.LoadSchedule(ctx, id); err != nil {
+		if err := s.store.SaveSchedule(ctx, ScheduleRecord{ID: id, NextRun: schedule.Next(time.Now())}); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[id]; ok {
+		return fmt.Errorf("scheduler: add %s: %w", id, ErrScheduleExists)
+	}
+	s.entries[id] = e
+	if s.ctx != nil {
+		go s.loop(s.ctx, e)
+	}
+	return nil
+}
+
+// Remove unregisters the schedule; a run in progress is not interrupted.
+func (s *Scheduler) Remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[id]; ok {
+		close(e.stop)
+		delete(s.entries, id)
+	}
+}
+
+// Start fires the registered schedules until ctx is done.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ctx = ctx
+	for _, e := range s.entries {
+		go s.loop(ctx, e)
+	}
+}
+
+// Trigger starts a run of the schedule now, subject to its overlap policy, and
+// reports whether it started. It returns without waiting for the run, which
+// outlives ctx: it is cancelled with the context the scheduler was started
+// with, if any, so that a Trigger from a request handler is not cancelled
+// when the request returns.
+func (s *Scheduler) Trigger(ctx context.Context, id string) (bool, error) {
+	e, ok := s.entry(id)
+	if !ok {
+		return false, fmt.Errorf("scheduler: trigger %s: %w", id, ErrScheduleNotFound)
+	}
+	s.mu.Lock()
+	runCtx := s.ctx
+	s.mu.Unlock()
+	if runCtx == nil {
+		runCtx = context.WithoutCancel(ctx)
+	}
+	return s.fire(runCtx, e), nil
+}
+
+// LastRun returns the most recent run of the schedule, or nil if it never ran.
+func (s *Scheduler) LastRun(ctx context.Context, id string) (*ScheduleRun, error) {
+	record, err := s.store.LoadSchedule(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return record.LastRun, nil
+}
+
+// Wait blocks until the runs in progress of the schedule finish.
+func (s *Scheduler) Wait(id string) {
+	if e, ok := s.entry(id); ok {
+		e.active.Wait()
+	}
+}
+
+func (s *Scheduler) entry(id string) (*scheduleEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[id]
+	return e, ok
+}
+
+// loop fires the schedule at its activation times until ctx is done or it is removed.
+func (s *Scheduler) loop(ctx context.Context, e *scheduleEntry) {
+	for {
+		record, err := s.store.LoadSchedule(ctx, e.id)
+		if err != nil {
+			return
+		}
+		timer := time.NewTimer(time.Until(record.NextRun))
+		select {
+		case <-timer.C:
+		case <-e.stop:
+			timer.Stop()
+			return
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+		s.update(ctx, e.id, func(record *ScheduleRecord) {
+			record.NextRun = e.schedule.Next(time.Now())
+		})
+		s.fire(ctx, e)
+	}
+}
+
+// fire starts a run unless the overlap policy skips it.
+func (s *Scheduler) fire(ctx context.Context, e *scheduleEntry) bool {
+	s.mu.Lock()
+	if e.running > 0 && e.overlap == OverlapSkip {
+		s.mu.Unlock()
+		return false
+	}
+	e.running++
+	e.active.Add(1)
+	s.mu.Unlock()
+	go func() {
+		defer func() {
+			s.mu.Lock()
+			e.running--
+			s.mu.Unlock()
+			e.active.Done()
+		}()
+		s.run(ctx, e)
+	}()
+	return true
+}
+
+// run executes one scheduled run in a fresh session, retrying failed attempts.
+func (s *Scheduler) run(ctx context.Context, e *scheduleEntry) {
+	run := &ScheduleRun{StartedAt: time.Now()}
+attempts:
+	for run.Attempt = 1; ; run.Attempt++ {
+		session, err := s.attempt(ctx, e, run)
+		if err == nil {
+			run.Status, run.Error = JobCompleted, ""
+			if e.memory != nil {
+				if err := e.memory.SaveSession(ctx, session); err != nil {
+					run.Status, run.Error = JobFailed, fmt.Sprintf("save memory: %v", err)
+				}
+			}
+			break
+		}
+		run.Error = err.Error()
+		if run.Status == JobCancelled || run.Attempt >= e.attempts {
+			break
+		}
+		select {
+		case <-time.After(e.backoff):
+		case <-ctx.Done():
+			run.Status, run.Error = JobCancelled, ctx.Err().Error()
+			break attempts
+		}
+	}
+	run.FinishedAt = time.Now()
+	s.update(context.WithoutCancel(ctx), e.id, func(record *ScheduleRecord) {
+		record.LastRun = run
+	})
+}
+
+// attempt submits one job and waits for it to finish.
+func (s *Scheduler) attempt(ctx context.Context, e *scheduleEntry, run *ScheduleRun) (Session, error) {
+	run.Status = JobFailed
+	message, err := e.input(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("scheduler: input %s: %w", e.id, err)
+	}
+	session := NewSession()
+	jobID, err := e.jobs.Submit(ctx, message, WithSession(session))
+	if err != nil {
+		return nil, err
+	}
+	running := *run
+	running.JobID, running.Status = jobID, JobRunning
+	s.update(ctx, e.id, func(record *ScheduleRecord) {
+		record.LastRun = &running
+	})
+	run.JobID = jobID
+	for range e.jobs.Subscribe(ctx, jobID) {
+	}
+	if ctx.Err() != nil {
+		e.jobs.Cancel(jobID)
+		run.Status = JobCancelled
+		return nil, ctx.Err()
+	}
+	job, err := e.jobs.Status(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+	run.Status = job.Status
+	switch job.Status {
+	case JobCompleted:
+		return session, nil
+	case JobCancelled:
+		return nil, ErrInvocationCancelled
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrJobFailed, job.Error)
+	}
+}
+
+// update applies fn to the stored record of the schedule.
+func (s *Scheduler) update(ctx context.Context, id string, fn func(*ScheduleRecord)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, err := s.store.LoadSchedule(ctx, id)
+	if err != nil {
+		return
+	}
+	fn(&record)
+	s.store.SaveSchedule(ctx, record)
+}
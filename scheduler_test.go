@@ -0,0 +1,189 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// sessionRecorder is a MemorySaver that records the saved session IDs.
+type sessionRecorder struct {
+	mu  sync.Mutex
+	ids []string
+}
+
+func (r *sessionRecorder) SaveSession(ctx context.Context, session Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ids = append(r.ids, session.ID())
+	return nil
+}
+
+func (r *sessionRecorder) saved() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.ids...)
+}
+
+func newScheduledJobs(t *testing.T, generate func(ctx context.Context, req *ModelRequest) (*ModelResponse, error)) *JobRunner {
+	t.Helper()
+	agent, err := NewAgent("reporter", WithModel(&mockModel{generate: generate}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewJobRunner(NewRunner(agent))
+}
+
+func summarize(ctx context.Context) (*Message, error) {
+	return UserMessage("summarize yesterday's tickets"), nil
+}
+
+func TestSchedulerInterval(t *testing.T) {
+	jobs := newScheduledJobs(t, func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+		return textResponse("summary"), nil
+	})
+	store := NewInMemoryScheduleStore()
+	scheduler := NewScheduler(store)
+	memory := &sessionRecorder{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := scheduler.Add(ctx, "daily", Every(5*time.Millisecond), jobs, summarize, WithScheduleMemory(memory)); err != nil {
+		t.Fatal(err)
+	}
+	if err := scheduler.Add(ctx, "daily", Every(time.Hour), jobs, summarize); !errors.Is(err, ErrScheduleExists) {
+		t.Fatalf("expected ErrScheduleExists, got %v", err)
+	}
+	scheduler.Start(ctx)
+	deadline := time.Now().Add(2 * time.Second)
+	for len(memory.saved()) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the schedule to run twice")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	scheduler.Remove("daily")
+	ids := memory.saved()
+	if ids[0] == ids[1] {
+		t.Fatal("expected every run to use its own session")
+	}
+	run, err := scheduler.LastRun(ctx, "daily")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run == nil || run.JobID == "" {
+		t.Fatalf("unexpected last run: %+v", run)
+	}
+	// The schedule record outlives the scheduler.
+	if run, err := NewScheduler(store).LastRun(ctx, "daily"); err != nil || run == nil {
+		t.Fatalf("expected the last run to be persisted, got %+v, %v", run, err)
+	}
+}
+
+func TestSchedulerRetry(t *testing.T) {
+	var calls atomic.Int64
+	jobs := newScheduledJobs(t, func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+		if calls.Add(1) == 1 {
+			return nil, errors.New("provider unavailable")
+		}
+		return textResponse("summary"), nil
+	})
+	tests := []struct {
+		name        string
+		attempts    int
+		wantStatus  JobStatus
+		wantAttempt int
+	}{
+		{name: "no retry", attempts: 1, wantStatus: JobFailed, wantAttempt: 1},
+		{name: "retry", attempts: 3, wantStatus: JobCompleted, wantAttempt: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls.Store(0)
+			scheduler := NewScheduler(nil)
+			ctx := context.Background()
+			if err := scheduler.Add(ctx, "report", Every(time.Hour), jobs, summarize, WithScheduleRetry(tt.attempts, time.Millisecond)); err != nil {
+				t.Fatal(err)
+			}
+			if ok, err := scheduler.Trigger(ctx, "report"); err != nil || !ok {
+				t.Fatalf("expected the run to start, got %v, %v", ok, err)
+			}
+			scheduler.Wait("report")
+			run, err := scheduler.LastRun(ctx, "report")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if run.Status != tt.wantStatus || run.Attempt != tt.wantAttempt {
+				t.Fatalf("want %s after %d attempts, got %+v", tt.wantStatus, tt.wantAttempt, run)
+			}
+			if tt.wantStatus == JobFailed && run.Error == "" {
+				t.Fatal("expected the failure to be recorded")
+			}
+		})
+	}
+}
+
+func TestSchedulerOverlap(t *testing.T) {
+	release := make(chan struct{})
+	jobs := newScheduledJobs(t, func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+		<-release
+		return textResponse("summary"), nil
+	})
+	tests := []struct {
+		name   string
+		policy OverlapPolicy
+		want   bool
+	}{
+		{name: "skip", policy: OverlapSkip, want: false},
+		{name: "allow", policy: OverlapAllow, want: true},
+	}
+	scheduler := NewScheduler(nil)
+	ctx := context.Background()
+	for _, tt := range tests {
+		if err := scheduler.Add(ctx, tt.name, Every(time.Hour), jobs, summarize, WithOverlapPolicy(tt.policy)); err != nil {
+			t.Fatal(err)
+		}
+		if ok, err := scheduler.Trigger(ctx, tt.name); err != nil || !ok {
+			t.Fatalf("%s: expected the first run to start, got %v, %v", tt.name, ok, err)
+		}
+		if ok, _ := scheduler.Trigger(ctx, tt.name); ok != tt.want {
+			t.Fatalf("%s: want second run started %v, got %v", tt.name, tt.want, ok)
+		}
+	}
+	close(release)
+	for _, tt := range tests {
+		scheduler.Wait(tt.name)
+	}
+	if _, err := scheduler.Trigger(ctx, "missing"); !errors.Is(err, ErrScheduleNotFound) {
+		t.Fatalf("expected ErrScheduleNotFound, got %v", err)
+	}
+}
+
+func TestSchedulerTriggerDetached(t *testing.T) {
+	release := make(chan struct{})
+	jobs := newScheduledJobs(t, func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+		<-release
+		return textResponse("summary"), nil
+	})
+	scheduler := NewScheduler(nil)
+	if err := scheduler.Add(context.Background(), "report", Every(time.Hour), jobs, summarize); err != nil {
+		t.Fatal(err)
+	}
+	// The context of a request handler is done as soon as it returns.
+	ctx, cancel := context.WithCancel(context.Background())
+	if ok, err := scheduler.Trigger(ctx, "report"); err != nil || !ok {
+		t.Fatalf("expected the run to start, got %v, %v", ok, err)
+	}
+	cancel()
+	close(release)
+	scheduler.Wait("report")
+	run, err := scheduler.LastRun(context.Background(), "report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run == nil || run.Status != JobCompleted {
+		t.Fatalf("want the run completed, got %+v", run)
+	}
+}
@@ -2,19 +2,97 @@ package blades
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
 
-	"github.com/go-kratos/kit/container/maps"
-	"github.com/go-kratos/kit/container/slices"
 	"github.com/google/uuid"
 )
 
 // Session holds the state of a flow along with a unique session ID.
+//
+// Implementations must be safe for concurrent use, since parallel flows and
+// concurrently executing tools read and write the same session. State and
+// History return snapshots that do not change when the session is updated.
+//
+// Messages appended to a session are assigned a stable ID and a creation
+// timestamp if they do not already carry one; these, together with the
+// message parts and state, are what a persistent session store must keep.
 type Session interface {
 	ID() string
+	// ParentID returns the ID of the session this one was forked from, or an empty string.
+	ParentID() string
 	State() State
 	SetState(string, any)
+	// PutState sets a state value and attributes the write to the agent in the
+	// context, if any.
+	PutState(ctx context.Context, key string, value any)
+	// Watch returns the state changes made after the call, in write order. The
+	// channel is closed when the context is done or the session is closed.
+	Watch(ctx context.Context) <-chan StateChange
+	// Close closes the channels of the watchers. The session remains usable.
+	Close() error
 	History() []*Message
+	// Messages returns the messages in the history that match the given filter.
+	Messages(MessageFilter) []*Message
+	// LastAssistantMessage returns the most recent assistant message, or nil if none exists.
+	LastAssistantMessage() *Message
+	// TurnCount returns the number of user turns in the history.
+	TurnCount() int
 	Append(context.Context, *Message) error
+	// Fork creates a child session that shares the history up to and including
+	// the given message ID and a deep copy of the state. An empty message ID forks
+	// the whole history. The parent session is left untouched.
+	Fork(messageID string) (Session, error)
+}
+
+// MessageFilter selects messages from a session history.
+// Zero values match everything.
+type MessageFilter struct {
+	// Role keeps only messages with the given role.
+	Role Role
+	// Author keeps only messages authored by the given agent (or "user").
+	Author string
+	// Since keeps only messages created at or after the given time.
+	Since time.Time
+	// Last keeps only the most recent N matching messages. It is applied before Offset and Limit.
+	Last int
+	// Offset skips the first N matching messages.
+	Offset int
+	// Limit caps the number of returned messages.
+	Limit int
+}
+
+// Apply returns the messages that match the filter, preserving their order.
+func (f MessageFilter) Apply(messages []*Message) []*Message {
+	matched := make([]*Message, 0, len(messages))
+	for _, m := range messages {
+		if f.Role != "" && m.Role != f.Role {
+			continue
+		}
+		if f.Author != "" && m.Author != f.Author {
+			continue
+		}
+		if !f.Since.IsZero() && m.CreatedAt.Before(f.Since) {
+			continue
+		}
+		matched = append(matched, m)
+	}
+	if f.Last > 0 && len(matched) > f.Last {
+		matched = matched[len(matched)-f.Last:]
+	}
+	if f.Offset > 0 {
+		if f.Offset >= len(matched) {
+			return []*Message{}
+		}
+		matched = matched[f.Offset:]
+	}
+	if f.Limit > 0 && len(matched) > f.Limit {
+		matched = matched[:f.Limit]
+	}
+	return matched
 }
 
 // NewSession creates a new Session instance with an auto-generated UUID and optional initial state maps.
@@ -28,6 +106,14 @@ func NewSession(states ...map[string]any) Session {
 	return session
 }
 
+// NewSessionWithID creates a new Session with the given ID, e.g. to rebuild a
+// session whose history is stored elsewhere.
+func NewSessionWithID(id string, states ...map[string]any) Session {
+	session := NewSession(states...).(*sessionInMemory)
+	session.id = id
+	return session
+}
+
 // ctxSessionKey is an unexported type for keys defined in this package.
 type ctxSessionKey struct{}
 
@@ -43,25 +129,161 @@ func FromSessionContext(ctx context.Context) (Session, bool) {
 }
 
 // sessionInMemory is an in-memory implementation of the Session interface.
+// It is safe for concurrent use: every method is guarded by a read-write lock,
+// and State, History and Messages return copies that callers may freely modify.
 type sessionInMemory struct {
-	id      string
-	state   maps.Map[string, any]
-	history slices.Slice[*Message]
+	mu       sync.RWMutex
+	id       string
+	parentID string
+	state    State
+	history  []*Message
+	watchers map[*stateWatcher]struct{}
+	closed   bool
+	// unknownFields are the fields of an imported session that
+	// ExportSession writes back.
+	unknownFields map[string]json.RawMessage
 }
 
 func (s *sessionInMemory) ID() string {
 	return s.id
 }
+func (s *sessionInMemory) ParentID() string {
+	return s.parentID
+}
 func (s *sessionInMemory) State() State {
-	return s.state.ToMap()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state.Clone()
 }
 func (s *sessionInMemory) History() []*Message {
-	return s.history.ToSlice()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.history)
+}
+func (s *sessionInMemory) Messages(filter MessageFilter) []*Message {
+	return filter.Apply(s.History())
+}
+func (s *sessionInMemory) LastAssistantMessage() *Message {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for i := len(s.history) - 1; i >= 0; i-- {
+		if s.history[i].Role == RoleAssistant {
+			return s.history[i]
+		}
+	}
+	return nil
+}
+func (s *sessionInMemory) TurnCount() int {
+	return len(s.Messages(MessageFilter{Role: RoleUser}))
+}
+func (s *sessionInMemory) Stats() SessionStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return newSessionStats(s.history, s.state)
+}
+func (s *sessionInMemory) DropHistory(n int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dropped := len(s.history) - n
+	if dropped <= 0 {
+		return 0
+	}
+	// The kept messages are copied so that the dropped ones can be collected.
+	s.history = slices.Clone(s.history[dropped:])
+	return dropped
 }
 func (s *sessionInMemory) SetState(key string, value any) {
-	s.state.Store(key, value)
+	s.PutState(context.Background(), key, value)
+}
+func (s *sessionInMemory) PutState(ctx context.Context, key string, value any) {
+	s.ApplyState(ctx, []StateWrite{{Key: key, Value: value}})
+}
+func (s *sessionInMemory) ApplyState(ctx context.Context, writes []StateWrite) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state == nil {
+		s.state = State{}
+	}
+	var author string
+	if agent, ok := FromAgentContext(ctx); ok {
+		author = agent.Name()
+	}
+	now := time.Now()
+	for _, write := range writes {
+		old := s.state[write.Key]
+		s.state[write.Key] = write.Value
+		change := StateChange{Key: write.Key, Old: old, New: write.Value, Author: write.Author, Time: now}
+		if change.Author == "" {
+			change.Author = author
+		}
+		for w := range s.watchers {
+			w.send(change)
+		}
+	}
+}
+func (s *sessionInMemory) Watch(ctx context.Context) <-chan StateChange {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w := &stateWatcher{ch: make(chan StateChange, stateWatchBuffer)}
+	if s.closed {
+		close(w.ch)
+		return w.ch
+	}
+	if s.watchers == nil {
+		s.watchers = make(map[*stateWatcher]struct{})
+	}
+	s.watchers[w] = struct{}{}
+	context.AfterFunc(ctx, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.watchers[w]; ok {
+			delete(s.watchers, w)
+			close(w.ch)
+		}
+	})
+	return w.ch
+}
+func (s *sessionInMemory) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for w := range s.watchers {
+		close(w.ch)
+	}
+	s.watchers = nil
+	return nil
 }
 func (s *sessionInMemory) Append(ctx context.Context, message *Message) error {
-	s.history.Append(message)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if message.ID == "" {
+		message.ID = NewMessageID()
+	}
+	if message.CreatedAt.IsZero() {
+		message.CreatedAt = time.Now()
+	}
+	s.history = append(s.history, message)
 	return nil
 }
+func (s *sessionInMemory) Fork(messageID string) (Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	history := s.history
+	if messageID != "" {
+		index := slices.IndexFunc(history, func(m *Message) bool { return m.ID == messageID })
+		if index < 0 {
+			return nil, fmt.Errorf("session: fork %s: %w", messageID, ErrMessageNotFound)
+		}
+		history = history[:index+1]
+	}
+	fork := &sessionInMemory{
+		id:       uuid.NewString(),
+		parentID: s.id,
+		state:    s.state.DeepClone(),
+		history:  make([]*Message, 0, len(history)),
+	}
+	for _, m := range history {
+		fork.history = append(fork.history, m.Clone())
+	}
+	return fork, nil
+}
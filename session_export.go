@@ -0,0 +1,434 @@
+package blades
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ExportVersion is the format version of the sessions written by ExportSession.
+const ExportVersion = 1
+
+// ExportUnknownFieldsKey is the message metadata key under which ImportSession
+// keeps the fields of an imported message it does not know, e.g. written by a
+// newer version, so that ExportSession writes them back.
+const ExportUnknownFieldsKey = "export_unknown_fields"
+
+// maxImportBytes caps the size of a session posted to SessionImportHandler.
+const maxImportBytes = 64 << 20
+
+// sessionExport is the portable JSON shape of a session.
+type sessionExport struct {
+	Version    int               `json:"version"`
+	ID         string            `json:"id"`
+	ParentID   string            `json:"parentId,omitempty"`
+	State      State             `json:"state,omitempty"`
+	Messages   []json.RawMessage `json:"messages"`
+	ExportedAt time.Time         `json:"exportedAt"`
+}
+
+// blobPart is the JSON shape of a DataPart whose bytes are kept in a BlobStore.
+type blobPart struct {
+	Type     string   `json:"type"`
+	Name     string   `json:"name"`
+	Ref      string   `json:"ref"`
+	MIMEType MIMEType `json:"mimeType"`
+	Preview  bool     `json:"preview,omitempty"`
+}
+
+// BlobStore keeps the bytes of the data parts of exported sessions outside of
+// the export, which then refers to them by reference.
+type BlobStore interface {
+	// Put stores the data and returns its reference.
+	Put(data []byte, mimeType MIMEType) (string, error)
+	// Get returns the data stored under the reference, or an error wrapping
+	// ErrBlobNotFound.
+	Get(ref string) ([]byte, error)
+}
+
+// ExportOption configures ExportSession and ImportSession.
+type ExportOption func(*exportOptions)
+
+type exportOptions struct {
+	blobs BlobStore
+}
+
+// WithBlobStore externalizes the bytes of data parts to the store on export,
+// and resolves their references from it on import. By default the bytes are
+// embedded in the export as base64.
+func WithBlobStore(store BlobStore) ExportOption {
+	return func(o *exportOptions) {
+		o.blobs = store
+	}
+}
+
+// ExportSession serializes the session, its state and its history, with the
+// parts and tool calls of every message, to a portable JSON document that
+// ImportSession reads back, e.g. in another deployment. Fields that an
+// imported session carried but this version does not know are written back.
+func ExportSession(session Session, opts ...ExportOption) ([]byte, error) {
+	var o exportOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	export := sessionExport{
+		Version:    ExportVersion,
+		ID:         session.ID(),
+		ParentID:   session.ParentID(),
+		State:      session.State(),
+		Messages:   []json.RawMessage{},
+		ExportedAt: time.Now(),
+	}
+	for _, m := range session.History() {
+		data, err := exportMessage(m, o.blobs)
+		if err != nil {
+			return nil, fmt.Errorf("export session %s: message %s: %w", export.ID, m.ID, err)
+		}
+		export.Messages = append(export.Messages, data)
+	}
+	data, err := json.Marshal(export)
+	if err != nil {
+		return nil, fmt.Errorf("export session %s: %w", export.ID, err)
+	}
+	if s, ok := session.(*sessionInMemory); ok {
+		s.mu.RLock()
+		unknown := s.unknownFields
+		s.mu.RUnlock()
+		if data, err = addUnknownFields(data, unknown); err != nil {
+			return nil, fmt.Errorf("export session %s: %w", export.ID, err)
+		}
+	}
+	return data, nil
+}
+
+// ImportSession rebuilds a session serialized by ExportSession, with the same
+// ID. State values come back as their JSON decoding, e.g. numbers as float64.
+// Exports of a newer version are imported as far as they are understood, and
+// their unknown fields are kept to be exported again. It returns an error
+// wrapping ErrInvalidExport for a malformed export, and ErrBlobNotFound for a
+// data part whose reference cannot be resolved.
+func ImportSession(data []byte, opts ...ExportOption) (Session, error) {
+	var o exportOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	var export sessionExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("import session: %w: %v", ErrInvalidExport, err)
+	}
+	if export.Version <= 0 {
+		return nil, fmt.Errorf("import session: %w: missing version", ErrInvalidExport)
+	}
+	unknown, err := unknownFields(data, reflect.TypeFor[sessionExport]())
+	if err != nil {
+		return nil, fmt.Errorf("import session: %w: %v", ErrInvalidExport, err)
+	}
+	session := &sessionInMemory{
+		id:            export.ID,
+		parentID:      export.ParentID,
+		state:         export.State,
+		history:       make([]*Message, 0, len(export.Messages)),
+		unknownFields: unknown,
+	}
+	if session.id == "" {
+		session.id = uuid.NewString()
+	}
+	if session.state == nil {
+		session.state = State{}
+	}
+	for i, raw := range export.Messages {
+		m, err := importMessage(raw, o.blobs)
+		if err != nil {
+			return nil, fmt.Errorf("import session %s: message %d: %w", session.id, i, err)
+		}
+		session.history = append(session.history, m)
+	}
+	return session, nil
+}
+
+// exportMessage encodes the message with its unknown fields, externalizing
+// the bytes of its data parts to blobs, if set.
+func exportMessage(m *Message, blobs BlobStore) ([]byte, error) {
+	var parts []json.RawMessage
+	for _, part := range m.Parts {
+		data, err := exportPart(part, blobs)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, data)
+	}
+	alias := messageAlias(*m)
+	var unknown map[string]json.RawMessage
+	if raw, ok := m.Metadata[ExportUnknownFieldsKey]; ok {
+		// Unknown fields come back as plain maps from a session store.
+		data, err := json.Marshal(raw)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &unknown); err != nil {
+			return nil, fmt.Errorf("unknown fields: %w", err)
+		}
+		alias.Metadata = make(map[string]any, len(m.Metadata)-1)
+		for k, v := range m.Metadata {
+			if k != ExportUnknownFieldsKey {
+				alias.Metadata[k] = v
+			}
+		}
+		if len(alias.Metadata) == 0 {
+			alias.Metadata = nil
+		}
+	}
+	data, err := json.Marshal(messageJSON{messageAlias: &alias, Parts: parts})
+	if err != nil {
+		return nil, err
+	}
+	return addUnknownFields(data, unknown)
+}
+
+func exportPart(part Part, blobs BlobStore) ([]byte, error) {
+	data, ok := part.(DataPart)
+	if !ok || blobs == nil {
+		return marshalPart(part)
+	}
+	ref, err := blobs.Put(data.Bytes, data.MIMEType)
+	if err != nil {
+		return nil, fmt.Errorf("data part %s: %w", data.Name, err)
+	}
+	return json.Marshal(blobPart{Type: partTypeData, Name: data.Name, Ref: ref, MIMEType: data.MIMEType, Preview: data.Preview})
+}
+
+// importMessage decodes a message encoded by exportMessage, keeping its
+// unknown fields in its metadata.
+func importMessage(data []byte, blobs BlobStore) (*Message, error) {
+	m := &Message{}
+	aux := messageJSON{messageAlias: (*messageAlias)(m)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidExport, err)
+	}
+	for _, raw := range aux.Parts {
+		part, err := importPart(raw, blobs)
+		if err != nil {
+			return nil, err
+		}
+		m.Parts = append(m.Parts, part)
+	}
+	unknown, err := unknownFields(data, reflect.TypeFor[messageJSON]())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidExport, err)
+	}
+	if len(unknown) > 0 {
+		if m.Metadata == nil {
+			m.Metadata = make(map[string]any)
+		}
+		m.Metadata[ExportUnknownFieldsKey] = unknown
+	}
+	return m, nil
+}
+
+func importPart(data []byte, blobs BlobStore) (Part, error) {
+	var ref blobPart
+	if err := json.Unmarshal(data, &ref); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidExport, err)
+	}
+	if ref.Ref == "" || (ref.Type != "" && ref.Type != partTypeData) {
+		part, err := unmarshalPart(data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidExport, err)
+		}
+		return part, nil
+	}
+	if blobs == nil {
+		return nil, fmt.Errorf("data part %s: %w: %s: no blob store", ref.Name, ErrBlobNotFound, ref.Ref)
+	}
+	bytes, err := blobs.Get(ref.Ref)
+	if err != nil {
+		return nil, fmt.Errorf("data part %s: %w", ref.Name, err)
+	}
+	return DataPart{Name: ref.Name, Bytes: bytes, MIMEType: ref.MIMEType, Preview: ref.Preview}, nil
+}
+
+// unknownFields returns the fields of the JSON object that do not map to a
+// field of the struct type.
+func unknownFields(data []byte, t reflect.Type) (map[string]json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool)
+	jsonFields(t, known)
+	var unknown map[string]json.RawMessage
+	for k, v := range fields {
+		if known[strings.ToLower(k)] {
+			continue
+		}
+		if unknown == nil {
+			unknown = make(map[string]json.RawMessage)
+		}
+		unknown[k] = v
+	}
+	return unknown, nil
+}
+
+// jsonFields adds the lowercased JSON names of the fields of the struct type,
+// including those of embedded structs, to names.
+func jsonFields(t reflect.Type, names map[string]bool) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			jsonFields(field.Type, names)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names[strings.ToLower(name)] = true
+	}
+}
+
+// addUnknownFields adds the unknown fields to the JSON object, without
+// overriding the fields it already has.
+func addUnknownFields(data []byte, unknown map[string]json.RawMessage) ([]byte, error) {
+	if len(unknown) == 0 {
+		return data, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for k, v := range unknown {
+		if _, ok := fields[k]; !ok {
+			fields[k] = v
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// InMemoryBlobStore is a BlobStore that keeps the data in memory, addressed
+// by its SHA-256 digest.
+type InMemoryBlobStore struct {
+	mu    sync.RWMutex
+	blobs map[string][]byte
+}
+
+// NewInMemoryBlobStore creates a new in-memory blob store.
+func NewInMemoryBlobStore() *InMemoryBlobStore {
+	return &InMemoryBlobStore{blobs: make(map[string][]byte)}
+}
+
+// Put stores the data and returns its digest as reference.
+func (s *InMemoryBlobStore) Put(data []byte, mimeType MIMEType) (string, error) {
+	sum := sha256.Sum256(data)
+	ref := "sha256:" + hex.EncodeToString(sum[:])
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs[ref] = append([]byte(nil), data...)
+	return ref, nil
+}
+
+// Get returns the data stored under the reference.
+func (s *InMemoryBlobStore) Get(ref string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, ok := s.blobs[ref]
+	if !ok {
+		return nil, fmt.Errorf("blob store: get %s: %w", ref, ErrBlobNotFound)
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// SessionExportHandler returns an HTTP handler that downloads the stored
+// session named by the "session" query parameter, as written by ExportSession.
+func SessionExportHandler(sessions SessionStore, opts ...ExportOption) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		id := r.URL.Query().Get("session")
+		if id == "" {
+			http.Error(w, "missing session parameter", http.StatusBadRequest)
+			return
+		}
+		session, err := sessions.Load(r.Context(), id)
+		if err != nil {
+			http.Error(w, err.Error(), HTTPStatus(err))
+			return
+		}
+		data, err := ExportSession(session, opts...)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "session-"+id+".json"))
+		w.Write(data)
+	})
+}
+
+// SessionImportHandler returns an HTTP handler that imports a session posted
+// as written by ExportSession and saves it to the store. It answers 409 if a
+// session with the same ID is already stored, and writes the ID of the
+// imported session back with status 201.
+func SessionImportHandler(sessions SessionStore, opts ...ExportOption) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportBytes))
+		if err != nil {
+			status := http.StatusBadRequest
+			var maxBytes *http.MaxBytesError
+			if errors.As(err, &maxBytes) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		session, err := ImportSession(data, opts...)
+		if err != nil {
+			status := http.StatusBadRequest
+			if !errors.Is(err, ErrInvalidExport) && !errors.Is(err, ErrBlobNotFound) {
+				status = http.StatusInternalServerError
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		if _, err := sessions.Load(r.Context(), session.ID()); err == nil {
+			http.Error(w, fmt.Sprintf("session %s already exists", session.ID()), http.StatusConflict)
+			return
+		} else if !errors.Is(err, ErrSessionNotFound) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := sessions.Save(r.Context(), session); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"id": session.ID()})
+	})
+}
@@ -0,0 +1,252 @@
+package blades
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newExportedSession returns a session with a tool exchange and an image.
+func newExportedSession(t *testing.T) Session {
+	t.Helper()
+	ctx := context.Background()
+	session := NewSessionWithID("s1", map[string]any{"city": "Paris", "visits": 2})
+	messages := []*Message{
+		UserMessage("What is the weather in Paris?"),
+		{
+			Role:   RoleTool,
+			Author: "weather",
+			Parts: []Part{ToolPart{
+				ID:       "call-1",
+				Name:     "get_weather",
+				Request:  `{"city":"Paris"}`,
+				Response: `{"temperature":21}`,
+			}},
+		},
+		{
+			Role:     RoleAssistant,
+			Author:   "weather",
+			Status:   StatusCompleted,
+			Parts:    []Part{TextPart{Text: "It is 21°C."}, DataPart{Name: "chart.png", Bytes: []byte{0x89, 'P', 'N', 'G', 0}, MIMEType: "image/png"}},
+			Metadata: map[string]any{"source": "forecast"},
+		},
+	}
+	for _, m := range messages {
+		if err := session.Append(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return session
+}
+
+func TestExportImportSession(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     func() []ExportOption
+		embedded bool
+	}{
+		{name: "embedded", opts: func() []ExportOption { return nil }, embedded: true},
+		{name: "blob store", opts: func() []ExportOption { return []ExportOption{WithBlobStore(NewInMemoryBlobStore())} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := newExportedSession(t)
+			opts := tt.opts()
+			data, err := ExportSession(session, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Contains(string(data), `"bytes"`); got != tt.embedded {
+				t.Fatalf("embedded bytes = %v, want %v: %s", got, tt.embedded, data)
+			}
+			imported, err := ImportSession(data, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if imported.ID() != session.ID() {
+				t.Fatalf("ID = %q, want %q", imported.ID(), session.ID())
+			}
+			if got := imported.State(); got["city"] != "Paris" || got["visits"] != 2.0 {
+				t.Fatalf("state = %v", got)
+			}
+			want, got := session.History(), imported.History()
+			if len(got) != len(want) {
+				t.Fatalf("got %d messages, want %d", len(got), len(want))
+			}
+			for i := range want {
+				if got[i].ID != want[i].ID || got[i].Role != want[i].Role || got[i].Author != want[i].Author || !got[i].CreatedAt.Equal(want[i].CreatedAt) {
+					t.Fatalf("message %d = %+v, want %+v", i, got[i], want[i])
+				}
+				if !reflect.DeepEqual(got[i].Parts, want[i].Parts) {
+					t.Fatalf("message %d parts = %#v, want %#v", i, got[i].Parts, want[i].Parts)
+				}
+			}
+			if got[2].Metadata["source"] != "forecast" {
+				t.Fatalf("metadata = %v", got[2].Metadata)
+			}
+			again, err := ExportSession(imported, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !sameExport(t, data, again) {
+				t.Fatalf("export changed after a round trip:\n%s\n%s", data, again)
+			}
+		})
+	}
+}
+
+func TestImportSessionUnknownFields(t *testing.T) {
+	data := []byte(`{
+		"version": 2,
+		"id": "s1",
+		"labels": ["support"],
+		"messages": [
+			{"id": "m1", "role": "user", "parts": [{"type": "text", "text": "hi"}], "sentiment": "positive"}
+		],
+		"exportedAt": "2026-01-02T03:04:05Z"
+	}`)
+	session, err := ImportSession(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := session.History()[0].Text(); text != "hi" {
+		t.Fatalf("text = %q", text)
+	}
+	store := NewInMemorySessionStore()
+	if err := store.Save(context.Background(), session); err != nil {
+		t.Fatal(err)
+	}
+	exported, err := ExportSession(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var export struct {
+		Version  int              `json:"version"`
+		Labels   []string         `json:"labels"`
+		Messages []map[string]any `json:"messages"`
+	}
+	if err := json.Unmarshal(exported, &export); err != nil {
+		t.Fatal(err)
+	}
+	if export.Version != ExportVersion || len(export.Labels) != 1 || export.Labels[0] != "support" {
+		t.Fatalf("export = %s", exported)
+	}
+	if m := export.Messages[0]; m["sentiment"] != "positive" || m["metadata"] != nil {
+		t.Fatalf("message = %v", m)
+	}
+}
+
+func TestImportSessionErrors(t *testing.T) {
+	blobs := NewInMemoryBlobStore()
+	withBlob, err := ExportSession(newExportedSession(t), WithBlobStore(blobs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		data string
+		opts []ExportOption
+		want error
+	}{
+		{name: "not json", data: `{"version":`, want: ErrInvalidExport},
+		{name: "missing version", data: `{"id":"s1","messages":[]}`, want: ErrInvalidExport},
+		{name: "unknown part", data: `{"version":1,"messages":[{"parts":[{"type":"video"}]}]}`, want: ErrInvalidExport},
+		{name: "missing blob store", data: string(withBlob), want: ErrBlobNotFound},
+		{name: "missing blob", data: string(withBlob), opts: []ExportOption{WithBlobStore(NewInMemoryBlobStore())}, want: ErrBlobNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ImportSession([]byte(tt.data), tt.opts...); !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionExportImportHandlers(t *testing.T) {
+	ctx := context.Background()
+	source, target := NewInMemorySessionStore(), NewInMemorySessionStore()
+	if err := source.Save(ctx, newExportedSession(t)); err != nil {
+		t.Fatal(err)
+	}
+	get := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		SessionExportHandler(source).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/sessions/export"+query, nil))
+		return rec
+	}
+	post := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		SessionImportHandler(target).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/sessions/import", strings.NewReader(body)))
+		return rec
+	}
+	if rec := get("?session=missing"); rec.Code != http.StatusNotFound {
+		t.Fatalf("export missing: status %d", rec.Code)
+	}
+	exported := get("?session=s1")
+	if exported.Code != http.StatusOK {
+		t.Fatalf("export: status %d: %s", exported.Code, exported.Body)
+	}
+	if rec := post(`{"version":1,"messages":[{"parts":[{"type":"video"}]}]}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("import malformed: status %d", rec.Code)
+	}
+	if rec := post(exported.Body.String()); rec.Code != http.StatusCreated {
+		t.Fatalf("import: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := post(exported.Body.String()); rec.Code != http.StatusConflict {
+		t.Fatalf("import twice: status %d", rec.Code)
+	}
+	session, err := target.Load(ctx, "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(session.History()); n != 3 {
+		t.Fatalf("imported %d messages, want 3", n)
+	}
+}
+
+func FuzzImportSession(f *testing.F) {
+	data, err := ExportSession(newExportedSession(&testing.T{}))
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(data)
+	f.Add([]byte(`{"version":1}`))
+	f.Add([]byte(`{"version":1,"messages":[null,{"parts":[{"ref":"x"}]}]}`))
+	f.Add([]byte(`{"version":3,"state":{"a":[1,{"b":null}]},"extra":true}`))
+	f.Add([]byte(`[]`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		blobs := NewInMemoryBlobStore()
+		session, err := ImportSession(data, WithBlobStore(blobs))
+		if err != nil {
+			return
+		}
+		again, err := ExportSession(session, WithBlobStore(blobs))
+		if err != nil {
+			t.Fatalf("export of an imported session: %v", err)
+		}
+		if _, err := ImportSession(again, WithBlobStore(blobs)); err != nil {
+			t.Fatalf("import of a re-exported session: %v", err)
+		}
+	})
+}
+
+// sameExport reports whether two exports hold the same session, whatever
+// the time they were exported at.
+func sameExport(t *testing.T, a, b []byte) bool {
+	t.Helper()
+	var x, y map[string]any
+	if err := json.Unmarshal(a, &x); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &y); err != nil {
+		t.Fatal(err)
+	}
+	delete(x, "exportedAt")
+	delete(y, "exportedAt")
+	return reflect.DeepEqual(x, y)
+}
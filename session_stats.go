@@ -0,0 +1,183 @@
+package blades
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// SessionStats describes the size of a session.
+type SessionStats struct {
+	// Messages is the number of messages in the history.
+	Messages int
+	// TextBytes is the size of the text and reasoning of the history.
+	TextBytes int
+	// StateKeys is the number of state keys.
+	StateKeys int
+	// StateBytes is the size of the JSON encoding of each state value.
+	StateBytes map[string]int
+}
+
+// StateSize returns the size of all the state values.
+func (s SessionStats) StateSize() int {
+	size := 0
+	for _, n := range s.StateBytes {
+		size += n
+	}
+	return size
+}
+
+// Size returns the size of the history text and the state values.
+func (s SessionStats) Size() int {
+	return s.TextBytes + s.StateSize()
+}
+
+// StatsSession is implemented by sessions that measure themselves, e.g.
+// without copying their history and state.
+type StatsSession interface {
+	// Stats returns the size of the history and the state.
+	Stats() SessionStats
+}
+
+// MeasureSession returns the size of the history and the state of the
+// session, from its Stats if it implements StatsSession.
+func MeasureSession(session Session) SessionStats {
+	if s, ok := session.(StatsSession); ok {
+		return s.Stats()
+	}
+	return newSessionStats(session.History(), session.State())
+}
+
+// newSessionStats measures the history and the state.
+func newSessionStats(history []*Message, state State) SessionStats {
+	stats := SessionStats{
+		Messages:   len(history),
+		StateKeys:  len(state),
+		StateBytes: make(map[string]int, len(state)),
+	}
+	for _, m := range history {
+		for _, part := range m.Parts {
+			switch v := part.(type) {
+			case TextPart:
+				stats.TextBytes += len(v.Text)
+			case ReasoningPart:
+				stats.TextBytes += len(v.Text)
+			}
+		}
+	}
+	for key, value := range state {
+		stats.StateBytes[key] = len(encodeStateValue(value))
+	}
+	return stats
+}
+
+// encodeStateValue returns the JSON encoding of a state value, or its
+// formatting if it has none.
+func encodeStateValue(value any) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+// CompactionPolicy bounds the size of a session. Zero fields are unlimited.
+type CompactionPolicy struct {
+	// MaxHistory is the number of most recent messages kept in the history.
+	MaxHistory int
+	// MaxStateValueBytes caps the size of each state value. Longer strings
+	// are cut to end with an ellipsis; other values whose JSON encoding is
+	// longer are replaced by the cut encoding.
+	MaxStateValueBytes int
+}
+
+// SessionCompactor is implemented by sessions that can drop their oldest messages.
+type SessionCompactor interface {
+	// DropHistory removes all but the last n messages of the history and
+	// returns the number removed.
+	DropHistory(n int) int
+}
+
+// CompactSession applies the policy to the session. The history is only
+// compacted if the session implements SessionCompactor.
+func CompactSession(ctx context.Context, session Session, policy CompactionPolicy) {
+	if policy.MaxHistory > 0 {
+		if compactor, ok := session.(SessionCompactor); ok {
+			compactor.DropHistory(policy.MaxHistory)
+		}
+	}
+	if policy.MaxStateValueBytes <= 0 {
+		return
+	}
+	var writes []StateWrite
+	for key, value := range session.State() {
+		if truncated, ok := truncateStateValue(value, policy.MaxStateValueBytes); ok {
+			writes = append(writes, StateWrite{Key: key, Value: truncated})
+		}
+	}
+	// The writes are sorted so that watchers see them in a stable order.
+	slices.SortFunc(writes, func(a, b StateWrite) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	ApplyState(ctx, session, writes...)
+}
+
+// stateEllipsis marks a state value cut by CompactSession.
+const stateEllipsis = "…"
+
+// truncateStateValue cuts a string over max bytes, or a value whose encoding
+// is, and reports whether it was over.
+func truncateStateValue(value any, max int) (string, bool) {
+	text, ok := value.(string)
+	if !ok {
+		text = encodeStateValue(value)
+	}
+	if len(text) <= max {
+		return "", false
+	}
+	cut := min(max-len(stateEllipsis), len(text))
+	if cut < 0 {
+		cut = 0
+	}
+	for cut > 0 && cut < len(text) && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut] + stateEllipsis, true
+}
+
+// SessionPolicy watches the size of the sessions of a Runner after every run.
+type SessionPolicy struct {
+	// WarnBytes is the size of the history text and state above which OnWarn
+	// is called. Zero disables the warning.
+	WarnBytes int
+	// OnWarn is called with the stats of a session over WarnBytes.
+	OnWarn func(ctx context.Context, session Session, stats SessionStats)
+	// Compaction, if set, is applied to the session after every run, once
+	// OnWarn was called.
+	Compaction *CompactionPolicy
+}
+
+// WithSessionPolicy sets the policy applied to the session after every run of the Runner.
+func WithSessionPolicy(policy SessionPolicy) RunnerOption {
+	return func(r *Runner) {
+		r.sessionPolicy = policy
+	}
+}
+
+// apply warns about and compacts the session at the end of a run.
+func (p *SessionPolicy) apply(ctx context.Context, session Session) {
+	if session == nil {
+		return
+	}
+	if p.WarnBytes > 0 && p.OnWarn != nil {
+		if stats := MeasureSession(session); stats.Size() > p.WarnBytes {
+			p.OnWarn(ctx, session, stats)
+		}
+	}
+	if p.Compaction != nil {
+		CompactSession(ctx, session, *p.Compaction)
+	}
+}
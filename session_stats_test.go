@@ -0,0 +1,79 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSessionStats(t *testing.T) {
+	session := NewSession(map[string]any{"topic": "tides", "scores": []int{1, 2}})
+	ctx := context.Background()
+	session.Append(ctx, UserMessage("hello"))
+	answer := AssistantMessage("hi there")
+	answer.Parts = append(answer.Parts, ReasoningPart{Text: "greet"})
+	session.Append(ctx, answer)
+
+	// A session that does not implement StatsSession is measured from its
+	// history and state.
+	for _, session := range []Session{session, struct{ Session }{session}} {
+		stats := MeasureSession(session)
+		if stats.Messages != 2 || stats.TextBytes != 18 || stats.StateKeys != 2 {
+			t.Fatalf("unexpected stats %+v", stats)
+		}
+		if stats.StateBytes["topic"] != 7 || stats.StateBytes["scores"] != 5 || stats.Size() != 30 {
+			t.Fatalf("unexpected state sizes %v, total %d", stats.StateBytes, stats.Size())
+		}
+	}
+}
+
+func TestSessionPolicy(t *testing.T) {
+	model := &mockModel{generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+		return textResponse(strings.Repeat("x", 40)), nil
+	}}
+	agent, err := NewAgent("writer", WithModel(model), WithOutputKey("draft"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var warned []SessionStats
+	runner := NewRunner(agent, WithSessionPolicy(SessionPolicy{
+		WarnBytes: 100,
+		OnWarn: func(ctx context.Context, session Session, stats SessionStats) {
+			warned = append(warned, stats)
+		},
+		Compaction: &CompactionPolicy{MaxHistory: 3, MaxStateValueBytes: 10},
+	}))
+	session := NewSession()
+	for range 3 {
+		if _, err := runner.Run(context.Background(), UserMessage("write"), WithSession(session)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Each run adds 45 bytes of text and a 42-byte draft, cut back to 10 bytes.
+	if len(warned) != 2 || warned[0].Size() != 132 || warned[0].Messages != 4 {
+		t.Fatalf("want warnings after the second and third runs, got %+v", warned)
+	}
+	history := session.History()
+	if len(history) != 3 || history[0].Role != RoleAssistant {
+		t.Fatalf("want the last 3 messages kept, got %d", len(history))
+	}
+	if draft := session.State()["draft"]; draft != "xxxxxxx…" {
+		t.Fatalf("want the draft cut with an ellipsis, got %q", draft)
+	}
+}
+
+func TestSessionStoreSizeCap(t *testing.T) {
+	store := NewInMemorySessionStore(WithMaxSessionBytes(1000))
+	session := NewSession()
+	session.Append(context.Background(), UserMessage("short"))
+	if err := store.Save(context.Background(), session); err != nil {
+		t.Fatal(err)
+	}
+	session.Append(context.Background(), UserMessage(strings.Repeat("long ", 200)))
+	err := store.Save(context.Background(), session)
+	var sizeErr *SessionSizeError
+	if !errors.As(err, &sizeErr) || !errors.Is(err, ErrSessionTooLarge) || sizeErr.Max != 1000 || sizeErr.Size <= 1000 {
+		t.Fatalf("want a SessionSizeError, got %v", err)
+	}
+}
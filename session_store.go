@@ -0,0 +1,139 @@
+package blades
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// SessionStore persists sessions and the lineage between forked sessions.
+type SessionStore interface {
+	// Save stores the session, replacing any session with the same ID.
+	Save(context.Context, Session) error
+	// Load returns the session with the given ID.
+	Load(context.Context, string) (Session, error)
+	// Children returns the sessions forked directly from the given session ID.
+	Children(context.Context, string) ([]Session, error)
+	// Delete removes the session with the given ID.
+	Delete(context.Context, string) error
+}
+
+// SessionSizeError is returned when a session store refuses a session whose
+// serialized size exceeds its cap. It unwraps to ErrSessionTooLarge.
+type SessionSizeError struct {
+	SessionID string
+	Max       int
+	Size      int
+}
+
+func (e *SessionSizeError) Error() string {
+	return fmt.Sprintf("session %s: serialized size %d > %d", e.SessionID, e.Size, e.Max)
+}
+
+// Unwrap returns ErrSessionTooLarge.
+func (e *SessionSizeError) Unwrap() error {
+	return ErrSessionTooLarge
+}
+
+// SessionStoreOption configures a session store.
+type SessionStoreOption func(*sessionStoreOptions)
+
+type sessionStoreOptions struct {
+	maxBytes int
+}
+
+// WithMaxSessionBytes caps the size of the JSON encoding of the state and
+// history of a saved session. Save returns a *SessionSizeError for larger ones.
+func WithMaxSessionBytes(n int) SessionStoreOption {
+	return func(o *sessionStoreOptions) {
+		o.maxBytes = n
+	}
+}
+
+// checkSessionSize returns a *SessionSizeError if the serialized session is over max bytes.
+func checkSessionSize(session Session, max int) error {
+	if max <= 0 {
+		return nil
+	}
+	data, err := json.Marshal(struct {
+		State   State      `json:"state"`
+		History []*Message `json:"history"`
+	}{session.State(), session.History()})
+	if err != nil {
+		return fmt.Errorf("session %s: %w", session.ID(), err)
+	}
+	if len(data) > max {
+		return &SessionSizeError{SessionID: session.ID(), Max: max, Size: len(data)}
+	}
+	return nil
+}
+
+// InMemorySessionStore is an in-memory implementation of SessionStore.
+type InMemorySessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string]Session
+	opts     sessionStoreOptions
+}
+
+// NewInMemorySessionStore creates a new instance of InMemorySessionStore.
+func NewInMemorySessionStore(opts ...SessionStoreOption) *InMemorySessionStore {
+	s := &InMemorySessionStore{sessions: make(map[string]Session)}
+	for _, opt := range opts {
+		opt(&s.opts)
+	}
+	return s
+}
+
+// Save stores the session in memory. It returns a *SessionSizeError if the
+// session is over the size cap of the store.
+func (s *InMemorySessionStore) Save(ctx context.Context, session Session) error {
+	if err := checkSessionSize(session, s.opts.maxBytes); err != nil {
+		return fmt.Errorf("session store: save: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[session.ID()] = session
+	return nil
+}
+
+// Check implements Checkable; an in-memory store is always available.
+func (s *InMemorySessionStore) Check(ctx context.Context) error {
+	return nil
+}
+
+// Load returns the session with the given ID.
+func (s *InMemorySessionStore) Load(ctx context.Context, id string) (Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, fmt.Errorf("session store: load %s: %w", id, ErrSessionNotFound)
+	}
+	return session, nil
+}
+
+// Children returns the sessions forked from the given session ID, ordered by ID.
+func (s *InMemorySessionStore) Children(ctx context.Context, parentID string) ([]Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var children []Session
+	for _, session := range s.sessions {
+		if session.ParentID() == parentID {
+			children = append(children, session)
+		}
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].ID() < children[j].ID()
+	})
+	return children, nil
+}
+
+// Delete removes the session with the given ID.
+func (s *InMemorySessionStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+	return nil
+}
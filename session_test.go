@@ -0,0 +1,193 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSessionMessages(t *testing.T) {
+	session := NewSession()
+	start := time.Now()
+	messages := []*Message{
+		{Role: RoleUser, Author: "user", Parts: Parts("u1")},
+		{Role: RoleAssistant, Author: "writer", Parts: Parts("a1")},
+		{Role: RoleUser, Author: "user", Parts: Parts("u2")},
+		{Role: RoleAssistant, Author: "editor", Parts: Parts("a2")},
+		{Role: RoleUser, Author: "user", Parts: Parts("u3")},
+	}
+	for _, m := range messages {
+		if err := session.Append(context.Background(), m); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+		if m.ID == "" || m.CreatedAt.Before(start) {
+			t.Fatalf("expected ID and timestamp to be assigned, got %q %v", m.ID, m.CreatedAt)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter MessageFilter
+		want   []string
+	}{
+		{name: "all", filter: MessageFilter{}, want: []string{"u1", "a1", "u2", "a2", "u3"}},
+		{name: "role", filter: MessageFilter{Role: RoleAssistant}, want: []string{"a1", "a2"}},
+		{name: "author", filter: MessageFilter{Author: "editor"}, want: []string{"a2"}},
+		{name: "since", filter: MessageFilter{Since: time.Now().Add(time.Hour)}, want: []string{}},
+		{name: "last", filter: MessageFilter{Last: 2}, want: []string{"a2", "u3"}},
+		{name: "offset and limit", filter: MessageFilter{Offset: 1, Limit: 2}, want: []string{"a1", "u2"}},
+		{name: "offset out of range", filter: MessageFilter{Offset: 10}, want: []string{}},
+		{name: "role with last", filter: MessageFilter{Role: RoleUser, Last: 1}, want: []string{"u3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make([]string, 0)
+			for _, m := range session.Messages(tt.filter) {
+				got = append(got, m.Text())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("want %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	if last := session.LastAssistantMessage(); last == nil || last.Text() != "a2" {
+		t.Fatalf("unexpected last assistant message: %v", last)
+	}
+	if n := session.TurnCount(); n != 3 {
+		t.Fatalf("expected 3 turns, got %d", n)
+	}
+}
+
+func TestSessionFork(t *testing.T) {
+	ctx := context.Background()
+	parent := NewSession(map[string]any{
+		"draft": "v1",
+		"notes": map[string]any{"tags": []any{"a"}},
+	})
+	user := UserMessage("what's the weather in Paris?")
+	call := &Message{Role: RoleTool, Status: StatusCompleted, Parts: []Part{
+		ToolPart{ID: "call-1", Name: "weather", Request: `{"city":"Paris"}`, Response: `{"forecast":"sunny"}`},
+	}}
+	answer := AssistantMessage("It is sunny in Paris.")
+	for _, m := range []*Message{user, call, answer} {
+		if err := parent.Append(ctx, m); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+
+	fork, err := parent.Fork(call.ID)
+	if err != nil {
+		t.Fatalf("fork: %v", err)
+	}
+	if fork.ParentID() != parent.ID() || fork.ID() == parent.ID() {
+		t.Fatalf("unexpected lineage: id=%s parent=%s", fork.ID(), fork.ParentID())
+	}
+	history := fork.History()
+	if len(history) != 2 || history[1].ID != call.ID {
+		t.Fatalf("expected history prefix ending with the tool call, got %v", history)
+	}
+	if history[1] == call {
+		t.Fatal("fork history must not alias parent messages")
+	}
+
+	// Diverge the fork and make sure the parent is left untouched.
+	if err := fork.Append(ctx, AssistantMessage("It is raining in Paris.")); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	fork.SetState("draft", "v2")
+	fork.State()["notes"].(map[string]any)["tags"].([]any)[0] = "b"
+	history[1].Parts[0] = ToolPart{ID: "call-1", Name: "weather", Response: "mutated"}
+
+	if got := parent.LastAssistantMessage().Text(); got != "It is sunny in Paris." {
+		t.Fatalf("parent history changed: %s", got)
+	}
+	if got := fork.LastAssistantMessage().Text(); got != "It is raining in Paris." {
+		t.Fatalf("unexpected fork answer: %s", got)
+	}
+	if got := parent.State()["draft"]; got != "v1" {
+		t.Fatalf("parent state changed: %v", got)
+	}
+	if got := parent.State()["notes"].(map[string]any)["tags"].([]any)[0]; got != "a" {
+		t.Fatalf("nested parent state changed: %v", got)
+	}
+	if got := call.Parts[0].(ToolPart).Response; got != `{"forecast":"sunny"}` {
+		t.Fatalf("parent tool result changed: %s", got)
+	}
+
+	if _, err := parent.Fork("missing"); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("expected ErrMessageNotFound, got %v", err)
+	}
+
+	store := NewInMemorySessionStore()
+	for _, s := range []Session{parent, fork} {
+		if err := store.Save(ctx, s); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+	}
+	children, err := store.Children(ctx, parent.ID())
+	if err != nil {
+		t.Fatalf("children: %v", err)
+	}
+	if len(children) != 1 || children[0].ID() != fork.ID() {
+		t.Fatalf("unexpected children: %v", children)
+	}
+	if _, err := store.Load(ctx, "missing"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("expected ErrSessionNotFound, got %v", err)
+	}
+}
+
+func TestSessionWatch(t *testing.T) {
+	writer, err := NewAgent("writer", WithModel(&mockModel{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := NewSession(map[string]any{"draft": "v0"})
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := session.Watch(ctx)
+
+	session.PutState(NewAgentContext(ctx, writer), "draft", "v1")
+	session.SetState("review", "ok")
+	first, second := <-changes, <-changes
+	if first.Key != "draft" || first.Old != "v0" || first.New != "v1" || first.Author != "writer" || first.Time.IsZero() {
+		t.Fatalf("unexpected first change: %+v", first)
+	}
+	if second.Key != "review" || second.Old != nil || second.Author != "" {
+		t.Fatalf("unexpected second change: %+v", second)
+	}
+
+	// A slow watcher loses changes instead of blocking the writer.
+	for i := range stateWatchBuffer + 3 {
+		session.SetState("count", i)
+	}
+	for range stateWatchBuffer {
+		<-changes
+	}
+	session.SetState("count", "last")
+	if change := <-changes; change.New != "last" || change.Dropped != 3 {
+		t.Fatalf("expected the drops to be flagged, got %+v", change)
+	}
+
+	cancel()
+	if _, ok := <-changes; ok {
+		t.Fatal("expected the channel to close with the context")
+	}
+
+	changes = session.Watch(context.Background())
+	if err := session.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case _, ok := <-changes:
+		if ok {
+			t.Fatal("expected no change after close")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("watcher not closed with the session")
+	}
+	if _, ok := <-session.Watch(context.Background()); ok {
+		t.Fatal("expected a closed channel from a closed session")
+	}
+}
@@ -0,0 +1,39 @@
+package blades
+
+import "time"
+
+// stateWatchBuffer is the number of changes buffered for a watcher.
+const stateWatchBuffer = 64
+
+// StateChange is a write to the state of a session.
+type StateChange struct {
+	Key string
+	// Old is the previous value, or nil if the key was not set.
+	Old any
+	New any
+	// Author is the name of the agent that wrote the value, or empty.
+	Author string
+	Time   time.Time
+	// Dropped counts the changes dropped before this one because the watcher
+	// did not keep up.
+	Dropped int
+}
+
+// stateWatcher buffers the changes for a watcher so that writers never block.
+type stateWatcher struct {
+	ch      chan StateChange
+	dropped int
+}
+
+// send delivers the change unless the buffer is full, in which case it is
+// dropped and counted. It is called with the session lock held, which keeps
+// the changes in write order.
+func (w *stateWatcher) send(change StateChange) {
+	change.Dropped = w.dropped
+	select {
+	case w.ch <- change:
+		w.dropped = 0
+	default:
+		w.dropped++
+	}
+}
@@ -0,0 +1,85 @@
+package blades
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/go-kratos/blades/stream"
+)
+
+// SingleflightKey returns the key under which concurrent runs are collapsed
+// into one execution. An empty key runs the input on its own.
+type SingleflightKey func(ctx context.Context, session Session, message *Message) string
+
+// DefaultSingleflightKey hashes the session ID and the role and parts of the
+// input, so only identical inputs to the same session are collapsed.
+func DefaultSingleflightKey(ctx context.Context, session Session, message *Message) string {
+	if session == nil || message == nil {
+		return ""
+	}
+	parts, err := json.Marshal(message.Parts)
+	if err != nil {
+		return ""
+	}
+	h := sha256.New()
+	h.Write([]byte(session.ID()))
+	h.Write([]byte{0})
+	h.Write([]byte(message.Role))
+	h.Write([]byte{0})
+	h.Write(parts)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// WithSingleflight collapses concurrent runs with the same key, by default
+// DefaultSingleflightKey, into one execution whose messages are fanned out
+// to every caller. Only the first input is recorded in the session, and all
+// callers receive the messages of its invocation. A caller that cancels its
+// context leaves the execution, which is only cancelled once every caller
+// has left. Disabled by default.
+func WithSingleflight(key SingleflightKey) RunnerOption {
+	return func(r *Runner) {
+		if key == nil {
+			key = DefaultSingleflightKey
+		}
+		r.singleflight = key
+	}
+}
+
+// shared joins the execution running under the key, or starts it with run.
+func (r *Runner) shared(ctx context.Context, key string, streamable bool, run func(context.Context) Generator[*Message, error]) Generator[*Message, error] {
+	if streamable {
+		key += "/stream"
+	}
+	r.flightsMu.Lock()
+	defer r.flightsMu.Unlock()
+	if flight, ok := r.flights[key]; ok {
+		if messages, ok := flight.Join(ctx); ok {
+			return messages
+		}
+	}
+	// The execution outlives the caller that started it, as long as others wait for it.
+	shared, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	var flight *stream.Multicast[*Message]
+	release := func() {
+		r.flightsMu.Lock()
+		defer r.flightsMu.Unlock()
+		if r.flights[key] == flight {
+			delete(r.flights, key)
+		}
+	}
+	flight = stream.NewMulticast(run(shared), func() {
+		release()
+		cancel()
+	}, func() {
+		release()
+		cancel()
+	})
+	if r.flights == nil {
+		r.flights = make(map[string]*stream.Multicast[*Message])
+	}
+	r.flights[key] = flight
+	messages, _ := flight.Join(ctx)
+	return messages
+}
@@ -0,0 +1,107 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSingleflight(t *testing.T) {
+	release := make(chan struct{})
+	model := &mockModel{generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+		select {
+		case <-release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		return textResponse("answer to " + req.Messages[len(req.Messages)-1].Text()), nil
+	}}
+	agent, err := NewAgent("worker", WithModel(model))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := NewRunner(agent, WithSingleflight(nil))
+	session := NewSession()
+
+	inputs := []string{"hello", "hello", "hello", "bye"}
+	outputs := make([]string, len(inputs))
+	var wg sync.WaitGroup
+	for i, input := range inputs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			output, err := runner.Run(context.Background(), UserMessage(input), WithSession(session))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			outputs[i] = output.Text()
+		}()
+	}
+	// Wait until the distinct inputs are in flight before letting them finish.
+	for model.calls.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := model.calls.Load(); n != 2 {
+		t.Fatalf("want the identical runs collapsed into 2 model calls, got %d", n)
+	}
+	for i, input := range inputs {
+		if outputs[i] != "answer to "+input {
+			t.Fatalf("want %q for %q, got %q", "answer to "+input, input, outputs[i])
+		}
+	}
+	if n := len(session.Messages(MessageFilter{Role: RoleUser})); n != 2 {
+		t.Fatalf("want the duplicate input recorded once, got %d user messages", n)
+	}
+}
+
+func TestSingleflightCancel(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	model := &mockModel{generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+		started <- struct{}{}
+		select {
+		case <-release:
+			return textResponse("done"), nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}}
+	agent, err := NewAgent("worker", WithModel(model))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := NewRunner(agent, WithSingleflight(nil))
+	session := NewSession()
+
+	first, cancelFirst := context.WithCancel(context.Background())
+	second, cancelSecond := context.WithCancel(context.Background())
+	defer cancelSecond()
+	results := make(chan error, 2)
+	run := func(ctx context.Context) {
+		_, err := runner.Run(ctx, UserMessage("hello"), WithSession(session))
+		results <- err
+	}
+	go run(first)
+	<-started
+	go run(second)
+	time.Sleep(10 * time.Millisecond)
+
+	// The caller that started the execution leaves; the other one keeps it alive.
+	cancelFirst()
+	if err := <-results; !errors.Is(err, context.Canceled) {
+		t.Fatalf("want the cancelled caller to fail with context.Canceled, got %v", err)
+	}
+	close(release)
+	if err := <-results; err != nil {
+		t.Fatalf("want the remaining caller to receive the answer, got %v", err)
+	}
+	if n := model.calls.Load(); n != 1 {
+		t.Fatalf("want one shared model call, got %d", n)
+	}
+}
@@ -0,0 +1,181 @@
+package blades
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SnapshotVersion is the format version of the snapshots written by Snapshot.
+// Version 1 snapshots were written without an envelope.
+const SnapshotVersion = 2
+
+// snapshotMigrations upgrades the snapshots of older versions on load.
+var snapshotMigrations = NewMigrations("session_snapshot", SnapshotVersion).
+	Register(1, migrateSnapshotV1)
+
+// OutputStateKey is the metadata key of the session state key an agent stored
+// a completed message under, set on the message when it has an output key.
+const OutputStateKey = "output_key"
+
+// SnapshotStep records an agent that completed within the snapshotted invocation.
+type SnapshotStep struct {
+	Agent        string `json:"agent"`
+	InvocationID string `json:"invocationId"`
+	MessageID    string `json:"messageId"`
+	// OutputKey is the session state key the agent stored its output under, if any.
+	OutputKey string `json:"outputKey,omitempty"`
+}
+
+// SessionSnapshot is the serialized form of a session paused within an
+// invocation: its state, its history and the steps of the invocation that completed.
+type SessionSnapshot struct {
+	Version      int            `json:"version"`
+	SessionID    string         `json:"sessionId"`
+	ParentID     string         `json:"parentId,omitempty"`
+	InvocationID string         `json:"invocationId"`
+	State        State          `json:"state,omitempty"`
+	History      []*Message     `json:"history"`
+	Steps        []SnapshotStep `json:"steps,omitempty"`
+	CreatedAt    time.Time      `json:"createdAt"`
+}
+
+// RestoreOption configures Restore.
+type RestoreOption func(*restoreOptions)
+
+type restoreOptions struct {
+	agent Agent
+}
+
+// WithRestoreAgent checks that the snapshot can be resumed by the agent and
+// its sub-agents: every completed step must still name an agent of the graph,
+// which stores its output under the same key.
+func WithRestoreAgent(agent Agent) RestoreOption {
+	return func(o *restoreOptions) {
+		o.agent = agent
+	}
+}
+
+// Snapshot serializes the session, paused within the given invocation, so that
+// Restore can rebuild it in another process. The steps of the invocation and its
+// sub-agents that completed are recorded; a resumable Runner run with the same
+// invocation ID and input replays them from the history instead of calling
+// their models again. It returns ErrInvocationNotFound if the session holds no
+// message of the invocation.
+func Snapshot(session Session, invocationID string) ([]byte, error) {
+	snapshot := SessionSnapshot{
+		Version:      SnapshotVersion,
+		SessionID:    session.ID(),
+		ParentID:     session.ParentID(),
+		InvocationID: invocationID,
+		State:        session.State(),
+		History:      session.History(),
+		CreatedAt:    time.Now(),
+	}
+	found := false
+	for _, m := range snapshot.History {
+		if m.InvocationID != invocationID && !strings.HasPrefix(m.InvocationID, invocationID+".") {
+			continue
+		}
+		found = true
+		if m.Role != RoleAssistant || m.Status != StatusCompleted || m.Author == "" {
+			continue
+		}
+		step := SnapshotStep{Agent: m.Author, InvocationID: m.InvocationID, MessageID: m.ID}
+		step.OutputKey, _ = m.Metadata[OutputStateKey].(string)
+		snapshot.Steps = append(snapshot.Steps, step)
+	}
+	if !found {
+		return nil, fmt.Errorf("snapshot %s: %w", invocationID, ErrInvocationNotFound)
+	}
+	data, err := snapshotMigrations.Marshal(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot %s: %w", invocationID, err)
+	}
+	return data, nil
+}
+
+// Restore rebuilds the session serialized by Snapshot, with the same ID. State
+// values come back as their JSON decoding, e.g. numbers as float64. With
+// WithRestoreAgent, it returns an error wrapping ErrSnapshotIncompatible that
+// lists every mismatch between the snapshot and the agent graph, and a
+// *FutureVersionError for a snapshot written by a newer version of blades.
+func Restore(data []byte, opts ...RestoreOption) (Session, error) {
+	var o restoreOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	var snapshot SessionSnapshot
+	if err := snapshotMigrations.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("restore snapshot: %w", err)
+	}
+	if o.agent != nil {
+		if mismatches := snapshotMismatches(&snapshot, o.agent); len(mismatches) > 0 {
+			return nil, fmt.Errorf("restore snapshot of invocation %s: %w: %s", snapshot.InvocationID, ErrSnapshotIncompatible, strings.Join(mismatches, "; "))
+		}
+	}
+	if snapshot.State == nil {
+		snapshot.State = State{}
+	}
+	return &sessionInMemory{
+		id:       snapshot.SessionID,
+		parentID: snapshot.ParentID,
+		state:    snapshot.State,
+		history:  snapshot.History,
+	}, nil
+}
+
+// snapshotMismatches describes the completed steps of the snapshot that the
+// agent graph cannot resume, once per agent.
+func snapshotMismatches(snapshot *SessionSnapshot, root Agent) []string {
+	agents := make(map[string]Agent)
+	collectAgents(root, agents)
+	var (
+		mismatches []string
+		seen       = make(map[string]bool)
+	)
+	for _, step := range snapshot.Steps {
+		if seen[step.Agent] {
+			continue
+		}
+		seen[step.Agent] = true
+		agent, ok := agents[step.Agent]
+		if !ok {
+			mismatches = append(mismatches, fmt.Sprintf("agent %q completed in the snapshot is not in the agent graph", step.Agent))
+			continue
+		}
+		var outputKey string
+		if v, ok := agent.(interface{ OutputKey() string }); ok {
+			outputKey = v.OutputKey()
+		}
+		if outputKey != step.OutputKey {
+			mismatches = append(mismatches, fmt.Sprintf("agent %q has output key %q, the snapshot recorded %q", step.Agent, outputKey, step.OutputKey))
+		}
+	}
+	return mismatches
+}
+
+// collectAgents indexes the agent and its sub-agents by name; the first agent
+// of a name wins.
+func collectAgents(agent Agent, agents map[string]Agent) {
+	if _, ok := agents[agent.Name()]; !ok {
+		agents[agent.Name()] = agent
+	}
+	if composite, ok := agent.(Composite); ok {
+		for _, sub := range composite.SubAgents() {
+			collectAgents(sub, agents)
+		}
+	}
+}
+
+// migrateSnapshotV1 moves a version 1 snapshot into an envelope, updating
+// the version it records.
+func migrateSnapshotV1(payload json.RawMessage) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, err
+	}
+	fields["version"] = json.RawMessage("2")
+	return json.Marshal(fields)
+}
@@ -0,0 +1,126 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-kratos/blades/stream"
+)
+
+// sequenceAgent runs its sub-agents one after the other.
+type sequenceAgent struct {
+	name      string
+	subAgents []Agent
+}
+
+func (a *sequenceAgent) Name() string        { return a.name }
+func (a *sequenceAgent) Description() string { return "" }
+func (a *sequenceAgent) SubAgents() []Agent  { return a.subAgents }
+
+func (a *sequenceAgent) Run(ctx context.Context, invocation *Invocation) Generator[*Message, error] {
+	return func(yield func(*Message, error) bool) {
+		for _, agent := range a.subAgents {
+			for m, err := range agent.Run(ctx, invocation.Child(agent.Name())) {
+				if !yield(m, err) || err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	var calls []string
+	errPaused := errors.New("paused")
+	pause := func(next Handler) Handler {
+		return HandleFunc(func(ctx context.Context, invocation *Invocation) Generator[*Message, error] {
+			return stream.Error[*Message](errPaused)
+		})
+	}
+	newStep := func(name, instruction, outputKey, answer string, mws ...Middleware) Agent {
+		model := &mockModel{generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+			calls = append(calls, name)
+			text := answer
+			if req.Instruction != nil {
+				text += ": " + req.Instruction.Text()
+			}
+			return textResponse(text), nil
+		}}
+		opts := []AgentOption{WithModel(model), WithInstruction(instruction)}
+		if outputKey != "" {
+			opts = append(opts, WithOutputKey(outputKey))
+		}
+		if len(mws) > 0 {
+			opts = append(opts, WithMiddleware(mws...))
+		}
+		agent, err := NewAgent(name, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return agent
+	}
+	graph := func(editorKey string, reviewer Agent) Agent {
+		return &sequenceAgent{name: "flow", subAgents: []Agent{
+			newStep("writer", "write", "draft", "draft"),
+			newStep("editor", "edit {{.draft}}", editorKey, "edited"),
+			reviewer,
+		}}
+	}
+
+	// Pause before the third step.
+	session := NewSession()
+	paused := graph("edited", newStep("reviewer", "review {{.edited}}", "", "review", pause))
+	if _, err := NewRunner(paused).Run(context.Background(), UserMessage("write about tides"), WithSession(session), WithInvocationID("inv-1")); !errors.Is(err, errPaused) {
+		t.Fatalf("want the run paused, got %v", err)
+	}
+	data, err := Snapshot(session, "inv-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Resume in a new runner with tweaked reviewer instructions, without
+	// calling the models of the completed steps.
+	reviewer := newStep("reviewer", "review strictly {{.edited}}", "", "review")
+	resumed := graph("edited", reviewer)
+	restored, err := Restore(data, WithRestoreAgent(resumed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.ID() != session.ID() || restored.State()["edited"] != "edited: edit draft: write" || len(restored.History()) != len(session.History()) {
+		t.Fatalf("want the session restored, got id %s, state %v, %d messages", restored.ID(), restored.State(), len(restored.History()))
+	}
+
+	calls = nil
+	runner := NewRunner(resumed, WithResumable(true))
+	var last *Message
+	for m, err := range runner.RunStream(context.Background(), UserMessage("write about tides"), WithSession(restored), WithInvocationID("inv-1")) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		last = m
+	}
+	if len(calls) != 1 || calls[0] != "reviewer" {
+		t.Fatalf("want only the reviewer called, got %v", calls)
+	}
+	if want := "review: review strictly edited: edit draft: write"; last.Text() != want {
+		t.Fatalf("want %q, got %q", want, last.Text())
+	}
+
+	_, err = Restore(data, WithRestoreAgent(&sequenceAgent{name: "flow", subAgents: []Agent{
+		newStep("writer", "write", "draft", "draft"),
+		newStep("polisher", "edit {{.draft}}", "edited", "edited"),
+	}}))
+	if !errors.Is(err, ErrSnapshotIncompatible) || !strings.Contains(err.Error(), `agent "editor" completed in the snapshot is not in the agent graph`) {
+		t.Fatalf("want the missing agent reported, got %v", err)
+	}
+	_, err = Restore(data, WithRestoreAgent(graph("polished", reviewer)))
+	if !errors.Is(err, ErrSnapshotIncompatible) || !strings.Contains(err.Error(), `agent "editor" has output key "polished", the snapshot recorded "edited"`) {
+		t.Fatalf("want the renamed output key reported, got %v", err)
+	}
+
+	if _, err := Snapshot(session, "inv-2"); !errors.Is(err, ErrInvocationNotFound) {
+		t.Fatalf("want ErrInvocationNotFound, got %v", err)
+	}
+}
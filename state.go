@@ -1,16 +1,110 @@
 package blades
 
 import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
 	"maps"
+	"reflect"
+	"sync"
 )
 
 // State holds arbitrary key-value pairs representing the state.
 type State map[string]any
 
-// Clone creates a deep copy of the State.
+// Clone creates a shallow copy of the State.
 func (s State) Clone() State {
 	if s == nil {
 		s = State{}
 	}
 	return State(maps.Clone(map[string]any(s)))
 }
+
+// DeepClone creates a deep copy of the State.
+// Nested maps and slices are copied recursively; other values are shared.
+func (s State) DeepClone() State {
+	clone := make(State, len(s))
+	for k, v := range s {
+		clone[k] = deepCopy(v)
+	}
+	return clone
+}
+
+// deepCopy recursively copies maps and slices held by v.
+func deepCopy(v any) any {
+	if v == nil {
+		return nil
+	}
+	return deepCopyValue(reflect.ValueOf(v)).Interface()
+}
+
+func deepCopyValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		clone := reflect.New(v.Type()).Elem()
+		clone.Set(deepCopyValue(v.Elem()))
+		return clone
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		clone := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			clone.SetMapIndex(iter.Key(), deepCopyValue(iter.Value()))
+		}
+		return clone
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		clone := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			clone.Index(i).Set(deepCopyValue(v.Index(i)))
+		}
+		return clone
+	default:
+		return v
+	}
+}
+
+// stateLocks serialize the updates of UpdateState, striped by session and key.
+var stateLocks [64]sync.Mutex
+
+// UpdateState sets the state key of the session to the value update returns
+// for its current value, or nil if it is not set. The updates of a key of a
+// session through UpdateState are serialized within the process, so that
+// concurrent read-modify-writes, such as appends to a list, are not lost.
+func UpdateState(ctx context.Context, session Session, key string, update func(current any) any) {
+	h := fnv.New32a()
+	h.Write([]byte(session.ID()))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	mu := &stateLocks[h.Sum32()%uint32(len(stateLocks))]
+	mu.Lock()
+	defer mu.Unlock()
+	session.PutState(ctx, key, update(session.State()[key]))
+}
+
+// DecodeState returns the state value as a T. A value of another type, such
+// as the maps and slices of a session restored from JSON, is converted
+// through its JSON encoding; ok is false if that fails or the value is nil.
+func DecodeState[T any](value any) (v T, ok bool) {
+	if value == nil {
+		return v, false
+	}
+	if v, ok := value.(T); ok {
+		return v, true
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return v, false
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return v, false
+	}
+	return v, true
+}
@@ -0,0 +1,114 @@
+package blades
+
+import (
+	"context"
+	"sync"
+)
+
+// StateWrite is a state value set by ApplyState.
+type StateWrite struct {
+	Key   string
+	Value any
+	// Author is the name of the agent that wrote the value, or empty to
+	// attribute it to the agent in the context.
+	Author string
+}
+
+// StateApplier is implemented by sessions that can set several state values
+// atomically, so that no reader observes only some of them.
+type StateApplier interface {
+	ApplyState(ctx context.Context, writes []StateWrite)
+}
+
+// ApplyState sets the state values in order. It applies them atomically if
+// the session implements StateApplier, and one by one otherwise.
+func ApplyState(ctx context.Context, session Session, writes ...StateWrite) {
+	if len(writes) == 0 {
+		return
+	}
+	if applier, ok := session.(StateApplier); ok {
+		applier.ApplyState(ctx, writes)
+		return
+	}
+	for _, w := range writes {
+		session.PutState(ctx, w.Key, w.Value)
+	}
+}
+
+// StateOverlay is a session whose state writes are kept in a local overlay
+// until they are committed, while history writes go to the underlying
+// session. Its own reads see the local writes over the underlying state, so
+// a unit of work such as a parallel branch or a tool call sees its writes,
+// and other readers see all of them or none.
+type StateOverlay struct {
+	Session
+	mu     sync.Mutex
+	writes []StateWrite
+	index  map[string]int
+}
+
+// NewStateOverlay creates an empty overlay over the session.
+func NewStateOverlay(session Session) *StateOverlay {
+	return &StateOverlay{Session: session, index: make(map[string]int)}
+}
+
+// State returns the underlying state with the local writes applied.
+func (o *StateOverlay) State() State {
+	state := o.Session.State()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, w := range o.writes {
+		state[w.Key] = w.Value
+	}
+	return state
+}
+
+// SetState writes the value to the overlay.
+func (o *StateOverlay) SetState(key string, value any) {
+	o.PutState(context.Background(), key, value)
+}
+
+// PutState writes the value to the overlay and attributes it to the agent in the context, if any.
+func (o *StateOverlay) PutState(ctx context.Context, key string, value any) {
+	w := StateWrite{Key: key, Value: value}
+	if agent, ok := FromAgentContext(ctx); ok {
+		w.Author = agent.Name()
+	}
+	o.ApplyState(ctx, []StateWrite{w})
+}
+
+// ApplyState writes the values to the overlay.
+func (o *StateOverlay) ApplyState(ctx context.Context, writes []StateWrite) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, w := range writes {
+		if i, ok := o.index[w.Key]; ok {
+			o.writes[i] = w
+			continue
+		}
+		o.index[w.Key] = len(o.writes)
+		o.writes = append(o.writes, w)
+	}
+}
+
+// Writes returns the local writes, one per key in the order the keys were first written.
+func (o *StateOverlay) Writes() []StateWrite {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]StateWrite(nil), o.writes...)
+}
+
+// Commit applies the local writes to the underlying session and clears the overlay.
+func (o *StateOverlay) Commit(ctx context.Context) {
+	ApplyState(ctx, o.Session, o.Discard()...)
+}
+
+// Discard clears the overlay and returns the writes it held.
+func (o *StateOverlay) Discard() []StateWrite {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	writes := o.writes
+	o.writes = nil
+	o.index = make(map[string]int)
+	return writes
+}
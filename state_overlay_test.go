@@ -0,0 +1,93 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-kratos/blades/tools"
+)
+
+func TestStateOverlay(t *testing.T) {
+	session := NewSession(map[string]any{"base": 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := session.Watch(ctx)
+
+	overlay := NewStateOverlay(session)
+	overlay.SetState("a", 1)
+	overlay.SetState("b", 2)
+	overlay.SetState("a", 3)
+	if got := overlay.State(); got["base"] != 1 || got["a"] != 3 || got["b"] != 2 {
+		t.Fatalf("want the overlay to read its writes over the session state, got %v", got)
+	}
+	if got := session.State(); len(got) != 1 {
+		t.Fatalf("want the session untouched before commit, got %v", got)
+	}
+	overlay.Commit(context.Background())
+	if got := session.State(); got["a"] != 3 || got["b"] != 2 {
+		t.Fatalf("want the writes committed, got %v", got)
+	}
+	for _, want := range []StateChange{{Key: "a", New: 3}, {Key: "b", New: 2}} {
+		if got := <-changes; got.Key != want.Key || got.New != want.New {
+			t.Fatalf("want change %s=%v, got %s=%v", want.Key, want.New, got.Key, got.New)
+		}
+	}
+	overlay.SetState("c", 4)
+	overlay.Discard()
+	overlay.Commit(context.Background())
+	if _, ok := session.State()["c"]; ok {
+		t.Fatal("want discarded writes dropped")
+	}
+}
+
+func TestToolStateIsolation(t *testing.T) {
+	failure := errors.New("tool failed")
+	model := &mockModel{generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+		if last := req.Messages[len(req.Messages)-1]; last.Role == RoleTool {
+			return textResponse("done"), nil
+		}
+		return &ModelResponse{Message: &Message{Role: RoleTool, Status: StatusCompleted, Parts: []Part{
+			ToolPart{ID: "call-1", Name: "write", Request: "first"},
+			ToolPart{ID: "call-2", Name: "write", Request: "second"},
+		}}}, nil
+	}}
+	newAgent := func(fail string) Agent {
+		write := tools.NewTool("write", "writes state", tools.HandleFunc(func(ctx context.Context, input string) (string, error) {
+			session, ok := FromSessionContext(ctx)
+			if !ok {
+				return "", ErrNoSessionContext
+			}
+			session.SetState(input, true)
+			session.SetState("last", input)
+			if session.State()[input] != true {
+				return "", errors.New("want to read own write")
+			}
+			if input == fail {
+				return "", failure
+			}
+			return "ok", nil
+		}))
+		agent, err := NewAgent("writer", WithModel(model), WithTools(write))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return agent
+	}
+
+	session := NewSession()
+	if _, err := NewRunner(newAgent("")).Run(context.Background(), UserMessage("go"), WithSession(session)); err != nil {
+		t.Fatal(err)
+	}
+	if got := session.State(); got["first"] != true || got["second"] != true || got["last"] != "second" {
+		t.Fatalf("want the tool writes committed in call order, got %v", got)
+	}
+
+	session = NewSession()
+	if _, err := NewRunner(newAgent("second")).Run(context.Background(), UserMessage("go"), WithSession(session)); !errors.Is(err, failure) {
+		t.Fatalf("want the tool failure, got %v", err)
+	}
+	if got := session.State(); len(got) != 0 {
+		t.Fatalf("want no writes after a failed tool call, got %v", got)
+	}
+}
@@ -0,0 +1,197 @@
+package blades
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// maxStateSnapshots is the number of state snapshots a run report keeps;
+// older ones are dropped first.
+const maxStateSnapshots = 1000
+
+// stateValueLimit is the length at which RenderStateDiffs elides a value.
+const stateValueLimit = 120
+
+// WithStateSnapshots records a snapshot of the session state after every
+// step of the run, i.e. every agent, flow and graph node, into the run
+// report; see RunReport.StateDiffs. Snapshots are meant for debugging: each
+// is a deep copy of the state in its JSON form, with the redactors applied to
+// its strings after those of the steps and a StateKeyRedactor with the
+// default patterns, so that secrets do not leak into debug artifacts.
+func WithStateSnapshots(redactors ...Redactor) RunOption {
+	return func(r *RunOptions) {
+		r.StateSnapshots = true
+		r.SnapshotRedactors = append(r.SnapshotRedactors, redactors...)
+	}
+}
+
+// StateSnapshot is the session state after a step of a run.
+type StateSnapshot struct {
+	// Step is the path of the step below the run, joined with "/"; it is
+	// empty for the state the run started with.
+	Step  string `json:"step"`
+	State State  `json:"state"`
+}
+
+// StateDiffKind is the kind of change of a state key.
+type StateDiffKind string
+
+const (
+	StateKeyAdded   StateDiffKind = "added"
+	StateKeyChanged StateDiffKind = "changed"
+	StateKeyRemoved StateDiffKind = "removed"
+)
+
+// StateKeyDiff is the change of a state key between two snapshots.
+type StateKeyDiff struct {
+	Key  string        `json:"key"`
+	Kind StateDiffKind `json:"kind"`
+	// Old is the value before the change, unset for an added key.
+	Old any `json:"old,omitempty"`
+	// New is the value after the change, unset for a removed key.
+	New any `json:"new,omitempty"`
+}
+
+// StateDiff is the change of the session state over a step of a run, from
+// the snapshot of the previous step.
+type StateDiff struct {
+	Step    string         `json:"step"`
+	Changes []StateKeyDiff `json:"changes"`
+}
+
+// DiffState returns the keys added, changed and removed from before to
+// after, sorted by key. Values are compared deeply.
+func DiffState(before, after State) []StateKeyDiff {
+	changes := []StateKeyDiff{}
+	for key, value := range after {
+		old, ok := before[key]
+		switch {
+		case !ok:
+			changes = append(changes, StateKeyDiff{Key: key, Kind: StateKeyAdded, New: value})
+		case !reflect.DeepEqual(old, value):
+			changes = append(changes, StateKeyDiff{Key: key, Kind: StateKeyChanged, Old: old, New: value})
+		}
+	}
+	for key, value := range before {
+		if _, ok := after[key]; !ok {
+			changes = append(changes, StateKeyDiff{Key: key, Kind: StateKeyRemoved, Old: value})
+		}
+	}
+	slices.SortFunc(changes, func(a, b StateKeyDiff) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	return changes
+}
+
+// StateDiffs returns the change of the session state over each step of the
+// run, between consecutive snapshots. It is empty unless the run was started
+// WithStateSnapshots.
+func (r *RunReport) StateDiffs() []StateDiff {
+	if len(r.Snapshots) == 0 {
+		return nil
+	}
+	diffs := make([]StateDiff, 0, len(r.Snapshots)-1)
+	for i := 1; i < len(r.Snapshots); i++ {
+		diffs = append(diffs, StateDiff{
+			Step:    r.Snapshots[i].Step,
+			Changes: DiffState(r.Snapshots[i-1].State, r.Snapshots[i].State),
+		})
+	}
+	return diffs
+}
+
+// StateDiffsJSON returns the state diffs of the run as indented JSON, for
+// tooling. Unlike RenderStateDiffs, it keeps the values whole.
+func (r *RunReport) StateDiffsJSON() ([]byte, error) {
+	diffs := r.StateDiffs()
+	if diffs == nil {
+		diffs = []StateDiff{}
+	}
+	return json.MarshalIndent(diffs, "", "  ")
+}
+
+// RenderStateDiffs writes the state diffs of the run, one step after the
+// other with a line per changed key: "+" for an added key, "~" for a changed
+// one and "-" for a removed one. Values longer than 120 bytes are elided.
+func (r *RunReport) RenderStateDiffs(w io.Writer) error {
+	var b strings.Builder
+	if r.DroppedSnapshots > 0 {
+		fmt.Fprintf(&b, "(%d earlier snapshots dropped)\n", r.DroppedSnapshots)
+	}
+	for _, diff := range r.StateDiffs() {
+		fmt.Fprintf(&b, "%s:\n", diff.Step)
+		if len(diff.Changes) == 0 {
+			b.WriteString("  no changes\n")
+			continue
+		}
+		for _, change := range diff.Changes {
+			switch change.Kind {
+			case StateKeyAdded:
+				fmt.Fprintf(&b, "  + %s = %s\n", change.Key, elideStateValue(change.New))
+			case StateKeyChanged:
+				fmt.Fprintf(&b, "  ~ %s = %s -> %s\n", change.Key, elideStateValue(change.Old), elideStateValue(change.New))
+			case StateKeyRemoved:
+				fmt.Fprintf(&b, "  - %s (was %s)\n", change.Key, elideStateValue(change.Old))
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// elideStateValue renders a snapshot value as JSON, elided past stateValueLimit bytes.
+func elideStateValue(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data = []byte(fmt.Sprint(v))
+	}
+	if len(data) <= stateValueLimit {
+		return string(data)
+	}
+	return fmt.Sprintf("%s... (%d bytes)", strings.ToValidUTF8(string(data[:stateValueLimit]), ""), len(data))
+}
+
+// snapshotState returns a deep copy of the state in its JSON form, with the
+// redactors applied to its strings. A value that cannot be encoded is kept
+// as its fmt rendering.
+func snapshotState(ctx context.Context, redactors Redactors, state State) State {
+	snapshot := make(State, len(state))
+	for key, value := range state {
+		var copied any
+		data, err := json.Marshal(value)
+		if err == nil {
+			decoder := json.NewDecoder(bytes.NewReader(data))
+			// Numbers keep their precision, e.g. large integer IDs.
+			decoder.UseNumber()
+			err = decoder.Decode(&copied)
+		}
+		if err != nil {
+			copied = fmt.Sprint(value)
+		}
+		snapshot[key] = redactValue(ctx, redactors, copied)
+	}
+	return snapshot
+}
+
+// redactValue applies the redactors to the strings of a decoded JSON value, in place.
+func redactValue(ctx context.Context, redactors Redactors, v any) any {
+	switch v := v.(type) {
+	case string:
+		return redactors.Redact(ctx, v)
+	case map[string]any:
+		for key, value := range v {
+			v[key] = redactValue(ctx, redactors, value)
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = redactValue(ctx, redactors, value)
+		}
+	}
+	return v
+}
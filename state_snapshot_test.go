@@ -0,0 +1,141 @@
+package blades
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// stateStepsAgent runs a step per write, each setting session state.
+type stateStepsAgent struct {
+	writes []func(Session)
+}
+
+func (stateStepsAgent) Name() string        { return "steps" }
+func (stateStepsAgent) Description() string { return "" }
+func (a stateStepsAgent) Run(ctx context.Context, invocation *Invocation) Generator[*Message, error] {
+	ctx = NewPathContext(ctx, a.Name())
+	return PathErrors(ctx, func(yield func(*Message, error) bool) {
+		for i, write := range a.writes {
+			end := TrackStep(NewPathContext(ctx, string(rune('a'+i))))
+			write(invocation.Session)
+			end()
+		}
+		yield(AssistantMessage("done"), nil)
+	})
+}
+
+func TestRunnerStateSnapshots(t *testing.T) {
+	profile := map[string]any{"email": "ana@example.com", "tags": []any{"vip"}}
+	agent := stateStepsAgent{writes: []func(Session){
+		func(s Session) {
+			s.SetState("profile", profile)
+			s.SetState("api_key", "sk-secret")
+		},
+		func(s Session) {
+			s.SetState("city", "Paris")
+			s.SetState("notes", strings.Repeat("x", 500))
+		},
+		func(s Session) {
+			s.SetState("city", "Lyon")
+			s.SetState("draft", nil)
+		},
+	}}
+	session := NewSession()
+	session.SetState("draft", "v1")
+	runner := NewRunner(agent)
+	email := RegexpRedactor(regexp.MustCompile(`[a-z]+@example\.com`))
+	if _, err := runner.Run(context.Background(), UserMessage("go"), WithSession(session), WithInvocationID("inv-1"), WithStateSnapshots(email)); err != nil {
+		t.Fatal(err)
+	}
+	// The snapshots are copies: later writes to the state do not change them.
+	profile["tags"].([]any)[0] = "changed"
+
+	report, _ := runner.Report("inv-1")
+	if len(report.Snapshots) != 5 || report.Snapshots[0].Step != "" || report.Snapshots[1].Step != "steps/a" || report.Snapshots[4].Step != "steps" {
+		t.Fatalf("unexpected snapshots: %+v", report.Snapshots)
+	}
+	diffs := report.StateDiffs()
+	if len(diffs) != 4 {
+		t.Fatalf("want 4 diffs, got %+v", diffs)
+	}
+	first := diffs[0].Changes
+	if len(first) != 2 || first[0].Key != "api_key" || first[0].New != "[REDACTED]" || first[1].Key != "profile" {
+		t.Fatalf("unexpected first diff: %+v", first)
+	}
+	if got := first[1].New.(map[string]any); got["email"] != "[REDACTED]" || got["tags"].([]any)[0] != "vip" {
+		t.Fatalf("want a redacted deep copy of the profile, got %v", got)
+	}
+	third := diffs[2].Changes
+	if len(third) != 2 || third[0] != (StateKeyDiff{Key: "city", Kind: StateKeyChanged, Old: "Paris", New: "Lyon"}) || third[1].Kind != StateKeyChanged || third[1].New != nil {
+		t.Fatalf("unexpected third diff: %+v", third)
+	}
+	if len(diffs[3].Changes) != 0 {
+		t.Fatalf("want no changes over the agent itself, got %+v", diffs[3].Changes)
+	}
+
+	var b strings.Builder
+	if err := report.RenderStateDiffs(&b); err != nil {
+		t.Fatal(err)
+	}
+	rendered := b.String()
+	for _, want := range []string{
+		"steps/a:\n  + api_key = \"[REDACTED]\"\n",
+		`~ city = "Paris" -> "Lyon"`,
+		"... (502 bytes)",
+		"steps:\n  no changes\n",
+	} {
+		if !strings.Contains(rendered, want) {
+			t.Fatalf("want %q in:\n%s", want, rendered)
+		}
+	}
+	if strings.Contains(rendered, "sk-secret") || strings.Contains(rendered, "ana@example.com") {
+		t.Fatalf("want secrets redacted, got:\n%s", rendered)
+	}
+
+	data, err := report.StateDiffsJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var exported []StateDiff
+	if err := json.Unmarshal(data, &exported); err != nil {
+		t.Fatal(err)
+	}
+	if len(exported) != 4 || exported[1].Changes[1].Key != "notes" || len(exported[1].Changes[1].New.(string)) != 500 {
+		t.Fatalf("want whole values in the JSON export, got %s", data)
+	}
+}
+
+func TestRunnerWithoutStateSnapshots(t *testing.T) {
+	runner := NewRunner(stateStepsAgent{writes: []func(Session){
+		func(s Session) { s.SetState("city", "Paris") },
+	}})
+	if _, err := runner.Run(context.Background(), UserMessage("go"), WithInvocationID("inv-1")); err != nil {
+		t.Fatal(err)
+	}
+	report, _ := runner.Report("inv-1")
+	if len(report.Snapshots) != 0 || report.StateDiffs() != nil {
+		t.Fatalf("want no snapshots, got %+v", report.Snapshots)
+	}
+}
+
+func TestDiffState(t *testing.T) {
+	before := State{"kept": 1, "changed": map[string]any{"a": 1}, "removed": "x"}
+	after := State{"kept": 1, "changed": map[string]any{"a": 2}, "added": true}
+	got := DiffState(before, after)
+	want := []StateKeyDiff{
+		{Key: "added", Kind: StateKeyAdded, New: true},
+		{Key: "changed", Kind: StateKeyChanged, Old: map[string]any{"a": 1}, New: map[string]any{"a": 2}},
+		{Key: "removed", Kind: StateKeyRemoved, Old: "x"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i].Key != want[i].Key || got[i].Kind != want[i].Kind {
+			t.Fatalf("change %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package blades
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+)
+
+func TestUpdateState(t *testing.T) {
+	session := NewSession()
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			UpdateState(context.Background(), session, "counts", func(current any) any {
+				counts, _ := current.([]int)
+				return append(counts, len(counts))
+			})
+		}()
+	}
+	wg.Wait()
+	if counts := session.State()["counts"].([]int); len(counts) != 50 {
+		t.Fatalf("want 50 appends, got %d", len(counts))
+	}
+}
+
+func TestDecodeState(t *testing.T) {
+	type record struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}
+	want := []record{{Name: "a", Count: 1}}
+	if got, ok := DecodeState[[]record](want); !ok || got[0] != want[0] {
+		t.Fatalf("want the value as is, got %v", got)
+	}
+	// The value read back from a session persisted as JSON.
+	var restored any
+	data, _ := json.Marshal(want)
+	if err := json.Unmarshal(data, &restored); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := DecodeState[[]record](restored); !ok || len(got) != 1 || got[0] != want[0] {
+		t.Fatalf("want the decoded value, got %v, %v", got, ok)
+	}
+	if _, ok := DecodeState[[]record]("French"); ok {
+		t.Fatal("want a value of another shape rejected")
+	}
+	if _, ok := DecodeState[[]record](nil); ok {
+		t.Fatal("want nil rejected")
+	}
+}
@@ -0,0 +1,42 @@
+package stream
+
+import (
+	"errors"
+	"iter"
+)
+
+// ErrEmpty is returned when a stream ends without emitting any value.
+var ErrEmpty = errors.New("stream: no values emitted")
+
+// Collect consumes the stream and returns all emitted values.
+// It stops at the first error, which is returned together with the values
+// collected so far.
+func Collect[T any](stream iter.Seq2[T, error]) ([]T, error) {
+	var values []T
+	for v, err := range stream {
+		if err != nil {
+			return values, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// Last consumes the stream and returns the final emitted value.
+// It stops at the first error, and returns ErrEmpty if no value was emitted.
+func Last[T any](stream iter.Seq2[T, error]) (T, error) {
+	var (
+		last T
+		seen bool
+	)
+	for v, err := range stream {
+		if err != nil {
+			return *new(T), err
+		}
+		last, seen = v, true
+	}
+	if !seen {
+		return *new(T), ErrEmpty
+	}
+	return last, nil
+}
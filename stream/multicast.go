@@ -0,0 +1,108 @@
+package stream
+
+import (
+	"context"
+	"iter"
+	"sync"
+)
+
+// Multicast runs a stream once for consumers that may join while it runs.
+// Unlike Tee, the number of consumers is not fixed: a consumer that joins
+// late first receives the values emitted so far, then follows the stream.
+type Multicast[T any] struct {
+	source  iter.Seq2[T, error]
+	onIdle  func()
+	onDone  func()
+	started sync.Once
+
+	mu     sync.Mutex
+	values []item[T]
+	notify chan struct{}
+	active int
+	done   bool
+	idle   bool
+}
+
+type item[T any] struct {
+	value T
+	err   error
+}
+
+// NewMulticast returns a Multicast of the source. onIdle is called when every
+// consumer has left before the source finished, e.g. to cancel the context
+// of the source, which is then stopped by returning false from its yield.
+// onDone is called once the source has returned. Both may be nil.
+func NewMulticast[T any](source iter.Seq2[T, error], onIdle, onDone func()) *Multicast[T] {
+	return &Multicast[T]{source: source, onIdle: onIdle, onDone: onDone, notify: make(chan struct{})}
+}
+
+// Join returns the stream of a new consumer, which leaves when it stops
+// iterating or ctx is done. It returns false once every consumer has left,
+// after which the source is being cancelled and cannot be joined.
+func (m *Multicast[T]) Join(ctx context.Context) (iter.Seq2[T, error], bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.idle {
+		return nil, false
+	}
+	m.active++
+	return func(yield func(T, error) bool) {
+		m.started.Do(func() { go m.produce() })
+		defer m.leave()
+		for i := 0; ; i++ {
+			m.mu.Lock()
+			for i >= len(m.values) && !m.done {
+				notify := m.notify
+				m.mu.Unlock()
+				select {
+				case <-notify:
+				case <-ctx.Done():
+					var zero T
+					yield(zero, context.Cause(ctx))
+					return
+				}
+				m.mu.Lock()
+			}
+			if i >= len(m.values) {
+				m.mu.Unlock()
+				return
+			}
+			it := m.values[i]
+			m.mu.Unlock()
+			if !yield(it.value, it.err) {
+				return
+			}
+		}
+	}, true
+}
+
+func (m *Multicast[T]) leave() {
+	m.mu.Lock()
+	m.active--
+	idle := m.active == 0 && !m.done && !m.idle
+	if idle {
+		m.idle = true
+	}
+	m.mu.Unlock()
+	if idle && m.onIdle != nil {
+		m.onIdle()
+	}
+}
+
+func (m *Multicast[T]) produce() {
+	m.source(func(v T, err error) bool {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.values = append(m.values, item[T]{value: v, err: err})
+		close(m.notify)
+		m.notify = make(chan struct{})
+		return !m.idle
+	})
+	m.mu.Lock()
+	m.done = true
+	close(m.notify)
+	m.mu.Unlock()
+	if m.onDone != nil {
+		m.onDone()
+	}
+}
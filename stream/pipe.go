@@ -0,0 +1,218 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"sync"
+)
+
+var (
+	// ErrPipeClosed is returned by Pipe.Send once the pipe has been closed,
+	// including when the consumer stopped iterating early.
+	ErrPipeClosed = errors.New("stream: pipe closed")
+	// ErrPipeFull is returned by Pipe.Send under OverflowError when the buffer is full.
+	ErrPipeFull = errors.New("stream: pipe buffer full")
+)
+
+// OverflowPolicy decides what Pipe.Send does when the buffer is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock makes Send wait until the consumer frees a slot or the pipe is closed.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest discards the oldest buffered value to make room.
+	OverflowDropOldest
+	// OverflowError makes Send fail with ErrPipeFull.
+	OverflowError
+)
+
+// PipeOption configures a Pipe.
+type PipeOption func(*pipeOptions)
+
+type pipeOptions struct {
+	buffer int
+	policy OverflowPolicy
+}
+
+// WithPipeBuffer sets the number of values buffered between producer and consumer.
+// Defaults to 16; values below 1 are treated as 1.
+func WithPipeBuffer(n int) PipeOption {
+	return func(o *pipeOptions) {
+		o.buffer = n
+	}
+}
+
+// WithOverflowPolicy sets the policy applied when the buffer is full. Defaults to OverflowBlock.
+func WithOverflowPolicy(policy OverflowPolicy) PipeOption {
+	return func(o *pipeOptions) {
+		o.policy = policy
+	}
+}
+
+type pipeItem[T any] struct {
+	value T
+	err   error
+}
+
+// Pipe bridges a push-style producer to a pull-style iter.Seq2 consumer.
+//
+// The producer calls Send for each value and Close or CloseWithError when done.
+// The consumer ranges over Seq, which closes the pipe when it returns, so a
+// producer blocked in Send is released with ErrPipeClosed if the consumer stops
+// early. Close is idempotent and safe to call from either side.
+type Pipe[T any] struct {
+	opts    pipeOptions
+	mu      sync.Mutex
+	queue   []pipeItem[T]
+	closed  bool
+	err     error
+	dropped int
+	notify  chan struct{}
+	space   chan struct{}
+	done    chan struct{}
+}
+
+// NewPipe creates a new Pipe with the given options.
+func NewPipe[T any](opts ...PipeOption) *Pipe[T] {
+	o := pipeOptions{buffer: 16, policy: OverflowBlock}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.buffer < 1 {
+		o.buffer = 1
+	}
+	return &Pipe[T]{
+		opts:   o,
+		notify: make(chan struct{}, 1),
+		space:  make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+}
+
+// Send delivers a value to the consumer, applying the overflow policy when the buffer is full.
+func (p *Pipe[T]) Send(v T) error {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return ErrPipeClosed
+		}
+		if len(p.queue) < p.opts.buffer {
+			p.queue = append(p.queue, pipeItem[T]{value: v})
+			p.mu.Unlock()
+			signal(p.notify)
+			return nil
+		}
+		switch p.opts.policy {
+		case OverflowDropOldest:
+			p.queue = append(p.queue[1:], pipeItem[T]{value: v})
+			p.dropped++
+			p.mu.Unlock()
+			signal(p.notify)
+			return nil
+		case OverflowError:
+			p.mu.Unlock()
+			return ErrPipeFull
+		}
+		p.mu.Unlock()
+		select {
+		case <-p.space:
+		case <-p.done:
+		}
+	}
+}
+
+// Dropped returns the number of values discarded under OverflowDropOldest.
+func (p *Pipe[T]) Dropped() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.dropped
+}
+
+// Close closes the pipe. Buffered values are still delivered to the consumer.
+func (p *Pipe[T]) Close() {
+	p.CloseWithError(nil)
+}
+
+// CloseWithError closes the pipe; the consumer receives err after the buffered values.
+// Only the first call has an effect.
+func (p *Pipe[T]) CloseWithError(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	p.closed = true
+	p.err = err
+	close(p.done)
+}
+
+// Seq returns the consuming side of the pipe. It may be ranged over once.
+func (p *Pipe[T]) Seq() iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		defer p.Close()
+		for {
+			p.mu.Lock()
+			if len(p.queue) > 0 {
+				item := p.queue[0]
+				p.queue = p.queue[1:]
+				p.mu.Unlock()
+				signal(p.space)
+				if !yield(item.value, item.err) {
+					return
+				}
+				continue
+			}
+			if p.closed {
+				err := p.err
+				p.mu.Unlock()
+				if err != nil {
+					yield(*new(T), err)
+				}
+				return
+			}
+			p.mu.Unlock()
+			select {
+			case <-p.notify:
+			case <-p.done:
+			}
+		}
+	}
+}
+
+// Produce runs produce in its own goroutine, which sends its values through a
+// Pipe, and returns the consuming side, e.g. to read a provider stream ahead
+// of a slow consumer. The error produce returns is delivered after its values.
+//
+// The context passed to produce is cancelled once the consumer stops, and the
+// stream does not return before produce did, so that the goroutine never
+// outlives the stream.
+func Produce[T any](ctx context.Context, produce func(ctx context.Context, send func(T) error) error, opts ...PipeOption) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		pipe := NewPipe[T](opts...)
+		done := make(chan struct{})
+		defer func() {
+			cancel()
+			<-done
+		}()
+		go func() {
+			defer close(done)
+			pipe.CloseWithError(produce(ctx, pipe.Send))
+		}()
+		for v, err := range pipe.Seq() {
+			if !yield(v, err) {
+				return
+			}
+		}
+	}
+}
+
+// signal performs a non-blocking wake-up on a capacity-one channel.
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,103 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPipe(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []PipeOption
+		send    []int
+		want    []int
+		sendErr error
+	}{
+		{name: "block", opts: []PipeOption{WithPipeBuffer(2)}, send: []int{1, 2}, want: []int{1, 2}},
+		{name: "drop oldest", opts: []PipeOption{WithPipeBuffer(2), WithOverflowPolicy(OverflowDropOldest)}, send: []int{1, 2, 3, 4}, want: []int{3, 4}},
+		{name: "error", opts: []PipeOption{WithPipeBuffer(2), WithOverflowPolicy(OverflowError)}, send: []int{1, 2, 3}, want: []int{1, 2}, sendErr: ErrPipeFull},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipe := NewPipe[int](tt.opts...)
+			var lastErr error
+			for _, v := range tt.send {
+				if err := pipe.Send(v); err != nil {
+					lastErr = err
+				}
+			}
+			if !errors.Is(lastErr, tt.sendErr) {
+				t.Fatalf("want send error %v, got %v", tt.sendErr, lastErr)
+			}
+			pipe.CloseWithError(errBoom)
+			pipe.Close() // idempotent
+			got, err := Collect(pipe.Seq())
+			if !errors.Is(err, errBoom) || !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("want %v, got %v %v", tt.want, got, err)
+			}
+		})
+	}
+}
+
+func TestPipeConsumerStopReleasesProducer(t *testing.T) {
+	pipe := NewPipe[int](WithPipeBuffer(1))
+	done := make(chan error, 1)
+	go func() {
+		defer close(done)
+		for i := 0; ; i++ {
+			if err := pipe.Send(i); err != nil {
+				done <- err
+				return
+			}
+		}
+	}()
+	for range pipe.Seq() {
+		break
+	}
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrPipeClosed) {
+			t.Fatalf("expected ErrPipeClosed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("producer goroutine leaked after consumer stopped")
+	}
+	if err := pipe.Send(1); !errors.Is(err, ErrPipeClosed) {
+		t.Fatalf("expected ErrPipeClosed after close, got %v", err)
+	}
+}
+
+func TestProduce(t *testing.T) {
+	got, err := Collect(Produce(context.Background(), func(ctx context.Context, send func(int) error) error {
+		for i := range 3 {
+			if err := send(i); err != nil {
+				return err
+			}
+		}
+		return errBoom
+	}))
+	if !errors.Is(err, errBoom) || !reflect.DeepEqual(got, []int{0, 1, 2}) {
+		t.Fatalf("want [0 1 2] then %v, got %v %v", errBoom, got, err)
+	}
+}
+
+func TestProduceConsumerStop(t *testing.T) {
+	var stopped bool
+	for range Produce(context.Background(), func(ctx context.Context, send func(int) error) error {
+		// A producer blocked outside Send is released by its context.
+		if err := send(1); err != nil {
+			return err
+		}
+		<-ctx.Done()
+		stopped = true
+		return ctx.Err()
+	}) {
+		break
+	}
+	if !stopped {
+		t.Fatal("want the producer stopped before the stream returns")
+	}
+}
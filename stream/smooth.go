@@ -0,0 +1,180 @@
+package stream
+
+import (
+	"iter"
+	"time"
+	"unicode/utf8"
+)
+
+// Delta is implemented by the values of the streams Smooth paces.
+type Delta[T any] interface {
+	// DeltaText returns the text of the value and the key of its source if
+	// it is a text delta, which Smooth may split and merge with the adjacent
+	// deltas of the same source; ok is false for any other value.
+	DeltaText() (text string, source string, ok bool)
+	// WithDeltaText returns a copy of the text delta holding the text.
+	WithDeltaText(text string) T
+}
+
+// SmoothOption configures Smooth.
+type SmoothOption func(*smoothOptions)
+
+type smoothOptions struct {
+	chars    int
+	interval time.Duration
+	clock    clock
+}
+
+// WithSmoothChars sets the maximum number of characters of a paced delta.
+// Defaults to 24; values below 1 are treated as 1.
+func WithSmoothChars(n int) SmoothOption {
+	return func(o *smoothOptions) {
+		o.chars = n
+	}
+}
+
+// WithSmoothInterval sets the minimum interval between paced deltas. Defaults to 20ms.
+func WithSmoothInterval(d time.Duration) SmoothOption {
+	return func(o *smoothOptions) {
+		o.interval = d
+	}
+}
+
+// clock is the time source of Smooth.
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// segment is the pending text of consecutive deltas of a source.
+type segment[T any] struct {
+	delta  T
+	source string
+	text   string
+}
+
+// Smooth returns a stream that re-chunks the text deltas of the source into
+// deltas of at most WithSmoothChars characters, emitted at most once per
+// WithSmoothInterval, for providers that send large irregular chunks. It only
+// changes the pacing: the text of the deltas of each source, concatenated,
+// is unchanged. A merged delta keeps the other fields of the first delta.
+//
+// Other values, such as completed messages and tool calls, are never
+// delayed: the pending text is flushed right before them, as it is before an
+// error and once the source ends. Since the pace bounds the throughput, text
+// arriving faster than it accumulates until the next flush.
+//
+// The source runs in its own goroutine and is cancelled the next time it
+// yields once the consumer stops.
+func Smooth[T Delta[T]](stream iter.Seq2[T, error], opts ...SmoothOption) iter.Seq2[T, error] {
+	o := smoothOptions{chars: 24, interval: 20 * time.Millisecond, clock: realClock{}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	o.chars = max(o.chars, 1)
+	return func(yield func(T, error) bool) {
+		type item struct {
+			value T
+			err   error
+		}
+		var (
+			ch   = make(chan item)
+			stop = make(chan struct{})
+		)
+		go func() {
+			defer close(ch)
+			stream(func(v T, err error) bool {
+				select {
+				case ch <- item{value: v, err: err}:
+					return true
+				case <-stop:
+					return false
+				}
+			})
+		}()
+		defer close(stop)
+		var (
+			pending []segment[T]
+			last    time.Time
+			tick    <-chan time.Time
+		)
+		// emit yields the next chunk of the first pending segment.
+		emit := func() bool {
+			head := &pending[0]
+			n, i := 0, 0
+			for i < len(head.text) && n < o.chars {
+				_, size := utf8.DecodeRuneInString(head.text[i:])
+				i += size
+				n++
+			}
+			chunk := head.text[:i]
+			head.text = head.text[i:]
+			if head.text == "" {
+				pending = pending[1:]
+			}
+			last = o.clock.Now()
+			return yield(head.delta.WithDeltaText(chunk), nil)
+		}
+		// flush yields all the pending text, one delta per segment.
+		flush := func() bool {
+			segments := pending
+			pending, tick = nil, nil
+			for _, s := range segments {
+				if !yield(s.delta.WithDeltaText(s.text), nil) {
+					return false
+				}
+			}
+			return true
+		}
+		for {
+			if len(pending) > 0 && tick == nil {
+				wait := o.interval - o.clock.Now().Sub(last)
+				if wait <= 0 {
+					if !emit() {
+						return
+					}
+					continue
+				}
+				tick = o.clock.After(wait)
+			}
+			select {
+			case it, ok := <-ch:
+				if !ok {
+					flush()
+					return
+				}
+				if it.err != nil {
+					if !flush() || !yield(it.value, it.err) {
+						return
+					}
+					continue
+				}
+				text, source, ok := it.value.DeltaText()
+				if !ok {
+					if !flush() || !yield(it.value, nil) {
+						return
+					}
+					continue
+				}
+				if text == "" {
+					continue
+				}
+				if n := len(pending); n > 0 && pending[n-1].source == source {
+					pending[n-1].text += text
+				} else {
+					pending = append(pending, segment[T]{delta: it.value, source: source, text: text})
+				}
+			case <-tick:
+				tick = nil
+				if !emit() {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package stream
+
+import (
+	"errors"
+	"iter"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// delta is a text delta of a source, or another value if done is set.
+type delta struct {
+	text, source string
+	done         bool
+}
+
+func (d delta) DeltaText() (string, string, bool) { return d.text, d.source, !d.done }
+func (d delta) WithDeltaText(text string) delta   { return delta{text: text, source: d.source} }
+
+// fakeClock is a clock whose timers fire when it is advanced.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []fakeTimer
+}
+
+type fakeTimer struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	c.timers = append(c.timers, fakeTimer{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// waitTimer waits until a timer is pending.
+func (c *fakeClock) waitTimer(t *testing.T) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		c.mu.Lock()
+		n := len(c.timers)
+		c.mu.Unlock()
+		if n > 0 {
+			return
+		}
+	}
+	t.Fatal("no timer pending")
+}
+
+// advance moves the clock forward and fires the timers that are due.
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.timers[:0]
+	for _, timer := range c.timers {
+		if timer.at.After(c.now) {
+			pending = append(pending, timer)
+			continue
+		}
+		timer.ch <- c.now
+	}
+	c.timers = pending
+}
+
+// smoothed runs Smooth over the values sent on in and returns its outputs.
+func smoothed(in <-chan result[delta], clock *fakeClock, opts ...SmoothOption) <-chan result[delta] {
+	source := func(yield func(delta, error) bool) {
+		for it := range in {
+			if !yield(it.value, it.err) {
+				return
+			}
+		}
+	}
+	opts = append(opts, func(o *smoothOptions) { o.clock = clock })
+	out := make(chan result[delta], 100)
+	go func() {
+		defer close(out)
+		for v, err := range Smooth(iter.Seq2[delta, error](source), opts...) {
+			out <- result[delta]{value: v, err: err}
+		}
+	}()
+	return out
+}
+
+type result[T any] struct {
+	value T
+	err   error
+}
+
+func receive(t *testing.T, out <-chan result[delta]) result[delta] {
+	t.Helper()
+	select {
+	case it := <-out:
+		return it
+	case <-time.After(5 * time.Second):
+		t.Fatal("no value emitted")
+		return result[delta]{}
+	}
+}
+
+func expectNothing(t *testing.T, out <-chan result[delta]) {
+	t.Helper()
+	select {
+	case it := <-out:
+		t.Fatalf("want nothing emitted before the interval, got %+v", it)
+	default:
+	}
+}
+
+func TestSmoothPacing(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	in := make(chan result[delta])
+	out := smoothed(in, clock, WithSmoothChars(4), WithSmoothInterval(10*time.Millisecond))
+
+	in <- result[delta]{value: delta{text: "abcdéfghij", source: "a"}}
+	for _, want := range []string{"abcd", "éfgh", "ij"} {
+		if want != "abcd" {
+			clock.waitTimer(t)
+			expectNothing(t, out)
+			clock.advance(10 * time.Millisecond)
+		}
+		if got := receive(t, out).value.text; got != want {
+			t.Fatalf("want %q, got %q", want, got)
+		}
+	}
+
+	// Deltas of a source are merged, those of different sources are not.
+	in <- result[delta]{value: delta{text: "kl", source: "a"}}
+	in <- result[delta]{value: delta{text: "mn", source: "a"}}
+	in <- result[delta]{value: delta{text: "op", source: "b"}}
+	for _, want := range []delta{{text: "klmn", source: "a"}, {text: "op", source: "b"}} {
+		clock.waitTimer(t)
+		clock.advance(10 * time.Millisecond)
+		if got := receive(t, out).value; got != want {
+			t.Fatalf("want %+v, got %+v", want, got)
+		}
+	}
+	close(in)
+	if _, ok := <-out; ok {
+		t.Fatal("want the stream to end with the source")
+	}
+}
+
+func TestSmoothFlush(t *testing.T) {
+	boom := errors.New("boom")
+	tests := []struct {
+		name string
+		last result[delta]
+	}{
+		{"completed", result[delta]{value: delta{text: "abcdefghij", done: true}}},
+		{"error", result[delta]{err: boom}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &fakeClock{now: time.Unix(0, 0)}
+			in := make(chan result[delta])
+			out := smoothed(in, clock, WithSmoothChars(4), WithSmoothInterval(time.Hour))
+			in <- result[delta]{value: delta{text: "abcdefghij", source: "a"}}
+			if got := receive(t, out).value.text; got != "abcd" {
+				t.Fatalf("want the first chunk, got %q", got)
+			}
+			clock.waitTimer(t)
+			// The rest is flushed without waiting for the interval.
+			in <- tt.last
+			if got := receive(t, out).value.text; got != "efghij" {
+				t.Fatalf("want the pending text flushed, got %q", got)
+			}
+			if got := receive(t, out); got.value != tt.last.value || got.err != tt.last.err {
+				t.Fatalf("want %+v right after the flush, got %+v", tt.last, got)
+			}
+			close(in)
+		})
+	}
+}
+
+func TestSmoothConcatenation(t *testing.T) {
+	for seed := range uint64(20) {
+		r := rand.New(rand.NewPCG(seed, seed))
+		var (
+			values    []delta
+			wantDones int
+			want      = map[string]*strings.Builder{"a": {}, "b": {}}
+		)
+		for range 50 {
+			source := []string{"a", "b"}[r.IntN(2)]
+			text := strings.Repeat("xyzé"[r.IntN(3):], r.IntN(20))
+			values = append(values, delta{text: text, source: source})
+			want[source].WriteString(text)
+			if r.IntN(10) == 0 {
+				values = append(values, delta{done: true})
+				wantDones++
+			}
+		}
+		got := map[string]*strings.Builder{"a": {}, "b": {}}
+		dones := 0
+		for v, err := range Smooth(Just(values...), WithSmoothChars(1+r.IntN(8)), WithSmoothInterval(0)) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.done {
+				dones++
+				continue
+			}
+			got[v.source].WriteString(v.text)
+		}
+		for source := range want {
+			if got[source].String() != want[source].String() {
+				t.Fatalf("seed %d: source %s: want %q, got %q", seed, source, want[source], got[source])
+			}
+		}
+		if dones != wantDones {
+			t.Fatalf("seed %d: want %d other values, got %d", seed, wantDones, dones)
+		}
+	}
+}
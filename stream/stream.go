@@ -72,24 +72,61 @@ func Map[T, R any](stream iter.Seq2[T, error], mapper func(T) (R, error)) iter.S
 }
 
 // Merge takes multiple input streams (as iter.Seq2) and merges their outputs into a single
-// output stream.
+// output stream, interleaving values in the order they arrive.
+//
+// Each source runs in its own goroutine. Errors are forwarded inline as they
+// arrive and do not stop the other sources; a consumer that stops iterating
+// (for example on the first error) cancels every source, which then exits at
+// its next yield.
 func Merge[T any](streams ...iter.Seq2[T, error]) iter.Seq2[T, error] {
 	return func(yield func(T, error) bool) {
+		type item struct {
+			value T
+			err   error
+		}
 		var (
-			mu sync.Mutex
-			wg sync.WaitGroup
+			wg   sync.WaitGroup
+			ch   = make(chan item)
+			stop = make(chan struct{})
 		)
+		defer close(stop)
 		wg.Add(len(streams))
 		for _, stream := range streams {
 			go func(next iter.Seq2[T, error]) {
 				defer wg.Done()
 				next(func(v T, err error) bool {
-					mu.Lock()
-					defer mu.Unlock()
-					return yield(v, err)
+					select {
+					case ch <- item{value: v, err: err}:
+						return true
+					case <-stop:
+						return false
+					}
 				})
 			}(stream)
 		}
-		wg.Wait()
+		go func() {
+			wg.Wait()
+			close(ch)
+		}()
+		for it := range ch {
+			if !yield(it.value, it.err) {
+				return
+			}
+		}
+	}
+}
+
+// Concat returns a stream that runs the input streams one after another,
+// emitting all values of each before starting the next.
+// Errors are forwarded inline; the consumer decides whether to continue.
+func Concat[T any](streams ...iter.Seq2[T, error]) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for _, stream := range streams {
+			for v, err := range stream {
+				if !yield(v, err) {
+					return
+				}
+			}
+		}
 	}
 }
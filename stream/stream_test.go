@@ -0,0 +1,344 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"reflect"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var errBoom = errors.New("boom")
+
+// source is a counting stream that records how far it got and whether it was cancelled.
+type source struct {
+	values    []int
+	err       error
+	delay     time.Duration
+	produced  atomic.Int64
+	cancelled atomic.Bool
+	done      chan struct{}
+}
+
+func newSource(values []int, err error) *source {
+	return &source{values: values, err: err, done: make(chan struct{})}
+}
+
+func (s *source) seq() iter.Seq2[int, error] {
+	return func(yield func(int, error) bool) {
+		defer close(s.done)
+		for _, v := range s.values {
+			if s.delay > 0 {
+				time.Sleep(s.delay)
+			}
+			s.produced.Add(1)
+			if !yield(v, nil) {
+				s.cancelled.Store(true)
+				return
+			}
+		}
+		if s.err != nil {
+			yield(0, s.err)
+		}
+	}
+}
+
+func (s *source) wait(t *testing.T) {
+	t.Helper()
+	select {
+	case <-s.done:
+	case <-time.After(time.Second):
+		t.Fatal("source did not terminate")
+	}
+}
+
+func TestCollectAndLast(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   []int
+		err      error
+		want     []int
+		wantLast int
+		wantErr  error
+		lastErr  error
+	}{
+		{name: "values", values: []int{1, 2, 3}, want: []int{1, 2, 3}, wantLast: 3},
+		{name: "empty", values: nil, want: nil, lastErr: ErrEmpty},
+		{name: "error", values: []int{1, 2}, err: errBoom, want: []int{1, 2}, wantErr: errBoom, lastErr: errBoom},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Collect(newSource(tt.values, tt.err).seq())
+			if !errors.Is(err, tt.wantErr) || !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Collect: want %v %v, got %v %v", tt.want, tt.wantErr, got, err)
+			}
+			last, err := Last(newSource(tt.values, tt.err).seq())
+			if !errors.Is(err, tt.lastErr) {
+				t.Fatalf("Last: want error %v, got %v", tt.lastErr, err)
+			}
+			if err == nil && last != tt.wantLast {
+				t.Fatalf("Last: want %d, got %d", tt.wantLast, last)
+			}
+		})
+	}
+}
+
+func TestCancellationPropagation(t *testing.T) {
+	tests := []struct {
+		name string
+		wrap func(iter.Seq2[int, error]) iter.Seq2[int, error]
+	}{
+		{name: "map", wrap: func(s iter.Seq2[int, error]) iter.Seq2[int, error] {
+			return Map(s, func(v int) (int, error) { return v * 2, nil })
+		}},
+		{name: "filter", wrap: func(s iter.Seq2[int, error]) iter.Seq2[int, error] {
+			return Filter(s, func(int) bool { return true })
+		}},
+		{name: "timeout", wrap: func(s iter.Seq2[int, error]) iter.Seq2[int, error] {
+			return WithTimeout(s, time.Second)
+		}},
+		{name: "tee", wrap: func(s iter.Seq2[int, error]) iter.Seq2[int, error] {
+			return Tee(s, 1, WithBuffer(0))[0]
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := newSource([]int{1, 2, 3, 4, 5}, nil)
+			for range tt.wrap(src.seq()) {
+				break
+			}
+			src.wait(t)
+			if !src.cancelled.Load() {
+				t.Fatal("expected source to observe cancellation")
+			}
+			if n := src.produced.Load(); n > 2 {
+				t.Fatalf("expected source to stop promptly, produced %d values", n)
+			}
+		})
+	}
+}
+
+func TestMapErrorPassthrough(t *testing.T) {
+	mapped := Map(newSource([]int{1, 2}, errBoom).seq(), func(v int) (int, error) { return v + 1, nil })
+	got, err := Collect(mapped)
+	if !errors.Is(err, errBoom) || !reflect.DeepEqual(got, []int{2, 3}) {
+		t.Fatalf("unexpected result %v %v", got, err)
+	}
+}
+
+func TestTee(t *testing.T) {
+	t.Run("all consumers receive all values", func(t *testing.T) {
+		src := newSource([]int{1, 2, 3}, errBoom)
+		streams := Tee(src.seq(), 3, WithBuffer(1))
+		results := make([][]int, len(streams))
+		errs := make([]error, len(streams))
+		var wg sync.WaitGroup
+		for i, s := range streams {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				results[i], errs[i] = Collect(s)
+			}()
+		}
+		wg.Wait()
+		for i := range streams {
+			if !reflect.DeepEqual(results[i], []int{1, 2, 3}) || !errors.Is(errs[i], errBoom) {
+				t.Fatalf("consumer %d: got %v %v", i, results[i], errs[i])
+			}
+		}
+		if n := src.produced.Load(); n != 3 {
+			t.Fatalf("source must run once, produced %d values", n)
+		}
+	})
+
+	t.Run("early consumer stop does not affect others", func(t *testing.T) {
+		src := newSource([]int{1, 2, 3, 4}, nil)
+		streams := Tee(src.seq(), 2, WithBuffer(0))
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range streams[0] {
+				break
+			}
+		}()
+		got, err := Collect(streams[1])
+		wg.Wait()
+		if err != nil || !reflect.DeepEqual(got, []int{1, 2, 3, 4}) {
+			t.Fatalf("unexpected result %v %v", got, err)
+		}
+		if src.cancelled.Load() {
+			t.Fatal("source must not be cancelled while a consumer is active")
+		}
+	})
+
+	t.Run("detach slow consumer", func(t *testing.T) {
+		src := newSource([]int{1, 2, 3, 4, 5, 6}, nil)
+		src.delay = 5 * time.Millisecond
+		streams := Tee(src.seq(), 2, WithBuffer(2), WithSlowConsumerPolicy(Detach))
+		got, err := Collect(streams[0])
+		if err != nil || !reflect.DeepEqual(got, []int{1, 2, 3, 4, 5, 6}) {
+			t.Fatalf("fast consumer: unexpected result %v %v", got, err)
+		}
+		src.wait(t)
+		slow, err := Collect(streams[1])
+		if !errors.Is(err, ErrSlowConsumer) || !reflect.DeepEqual(slow, []int{1, 2}) {
+			t.Fatalf("slow consumer: unexpected result %v %v", slow, err)
+		}
+	})
+}
+
+func TestWithTimeout(t *testing.T) {
+	src := newSource([]int{1, 2, 3}, nil)
+	src.delay = 50 * time.Millisecond
+	got, err := Collect(WithTimeout(src.seq(), 10*time.Millisecond))
+	if !errors.Is(err, ErrTimeout) || len(got) != 0 {
+		t.Fatalf("expected timeout, got %v %v", got, err)
+	}
+	src.wait(t)
+
+	src = newSource([]int{1, 2, 3}, nil)
+	src.delay = time.Millisecond
+	got, err = Collect(WithTimeout(src.seq(), time.Second))
+	if err != nil || !reflect.DeepEqual(got, []int{1, 2, 3}) {
+		t.Fatalf("unexpected result %v %v", got, err)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	t.Run("interleaves all values and errors", func(t *testing.T) {
+		a := newSource([]int{1, 2, 3}, nil)
+		b := newSource([]int{10, 20}, errBoom)
+		var (
+			got  []int
+			errs int
+		)
+		for v, err := range Merge(a.seq(), b.seq()) {
+			if err != nil {
+				errs++
+				continue
+			}
+			got = append(got, v)
+		}
+		slices.Sort(got)
+		if !reflect.DeepEqual(got, []int{1, 2, 3, 10, 20}) || errs != 1 {
+			t.Fatalf("unexpected result %v errors=%d", got, errs)
+		}
+	})
+
+	t.Run("consumer stop cancels all sources", func(t *testing.T) {
+		sources := []*source{
+			newSource([]int{1, 2, 3, 4, 5}, nil),
+			newSource([]int{1, 2, 3, 4, 5}, nil),
+			newSource([]int{1, 2, 3, 4, 5}, nil),
+		}
+		seqs := make([]iter.Seq2[int, error], 0, len(sources))
+		for _, s := range sources {
+			seqs = append(seqs, s.seq())
+		}
+		for range Merge(seqs...) {
+			break
+		}
+		for i, s := range sources {
+			s.wait(t)
+			if !s.cancelled.Load() {
+				t.Fatalf("source %d was not cancelled", i)
+			}
+		}
+	})
+}
+
+func TestConcat(t *testing.T) {
+	got, err := Collect(Concat(newSource([]int{1, 2}, nil).seq(), newSource([]int{3}, nil).seq()))
+	if err != nil || !reflect.DeepEqual(got, []int{1, 2, 3}) {
+		t.Fatalf("unexpected result %v %v", got, err)
+	}
+	second := newSource([]int{3}, nil)
+	for v := range Concat(newSource([]int{1, 2}, nil).seq(), second.seq()) {
+		if v == 1 {
+			break
+		}
+	}
+	if second.produced.Load() != 0 {
+		t.Fatal("later streams must not start after the consumer stopped")
+	}
+}
+
+func TestMulticast(t *testing.T) {
+	gate := make(chan struct{})
+	src := newSource([]int{1, 2, 3}, nil)
+	gated := func(yield func(int, error) bool) {
+		src.seq()(func(v int, err error) bool {
+			if v == 2 {
+				<-gate
+			}
+			return yield(v, err)
+		})
+	}
+	var idle atomic.Bool
+	m := NewMulticast[int](gated, func() { idle.Store(true) }, nil)
+	first, ok := m.Join(context.Background())
+	if !ok {
+		t.Fatal("want to join a new multicast")
+	}
+	var (
+		wg  sync.WaitGroup
+		got [2][]int
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		got[0], _ = Collect(first)
+	}()
+	// A consumer joining late receives the values emitted before it joined.
+	for src.produced.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	second, ok := m.Join(context.Background())
+	if !ok {
+		t.Fatal("want to join a running multicast")
+	}
+	close(gate)
+	got[1], _ = Collect(second)
+	wg.Wait()
+	src.wait(t)
+	for _, values := range got {
+		if !slices.Equal(values, []int{1, 2, 3}) {
+			t.Fatalf("want every consumer to receive [1 2 3], got %v", got)
+		}
+	}
+	if idle.Load() {
+		t.Fatal("want no idle callback for a finished source")
+	}
+
+	// The source is cancelled only once every consumer has left.
+	blocked := newSource([]int{1, 2, 3}, nil)
+	blocked.delay = 10 * time.Millisecond
+	m = NewMulticast[int](blocked.seq(), func() { idle.Store(true) }, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	leaving, _ := m.Join(ctx)
+	staying, _ := m.Join(context.Background())
+	for _, err := range leaving {
+		cancel()
+		if err != nil {
+			break
+		}
+	}
+	for v, err := range staying {
+		if err != nil || v == 1 {
+			break
+		}
+	}
+	blocked.wait(t)
+	if !idle.Load() || !blocked.cancelled.Load() {
+		t.Fatal("want the source cancelled after the last consumer left")
+	}
+	if _, ok := m.Join(context.Background()); ok {
+		t.Fatal("want an idle multicast not to be joinable")
+	}
+}
@@ -0,0 +1,136 @@
+package stream
+
+import (
+	"errors"
+	"iter"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrSlowConsumer is emitted to a Tee consumer that was detached because it
+// fell behind the producer under the Detach policy.
+var ErrSlowConsumer = errors.New("stream: consumer detached for being too slow")
+
+// SlowConsumerPolicy decides what a Tee does when a consumer's buffer is full.
+type SlowConsumerPolicy int
+
+const (
+	// Block makes the producer wait for the slow consumer.
+	Block SlowConsumerPolicy = iota
+	// Detach drops the slow consumer, which receives ErrSlowConsumer after its
+	// buffered values, while the remaining consumers keep streaming.
+	Detach
+)
+
+// TeeOption configures a Tee.
+type TeeOption func(*teeOptions)
+
+type teeOptions struct {
+	buffer int
+	policy SlowConsumerPolicy
+}
+
+// WithBuffer sets the per-consumer buffer size. Defaults to 16.
+func WithBuffer(n int) TeeOption {
+	return func(o *teeOptions) {
+		o.buffer = n
+	}
+}
+
+// WithSlowConsumerPolicy sets the policy applied to consumers whose buffer is full.
+// Defaults to Block.
+func WithSlowConsumerPolicy(policy SlowConsumerPolicy) TeeOption {
+	return func(o *teeOptions) {
+		o.policy = policy
+	}
+}
+
+// Tee fans the stream out to n consumers without re-running it.
+//
+// The source is started by the first consumer and runs in its own goroutine.
+// Each returned stream must be consumed at most once. A consumer that stops
+// early is detached; once every consumer has stopped, the source is cancelled
+// by returning false from its yield. Under the Block policy a consumer that is
+// never iterated eventually stalls the producer, so every stream should either
+// be consumed or abandoned by breaking out of it.
+func Tee[T any](stream iter.Seq2[T, error], n int, opts ...TeeOption) []iter.Seq2[T, error] {
+	o := teeOptions{buffer: 16, policy: Block}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	type item struct {
+		value T
+		err   error
+	}
+	type consumer struct {
+		ch       chan item
+		stopped  chan struct{}
+		stopOnce sync.Once
+		closed   bool // owned by the producer
+		slow     atomic.Bool
+	}
+	var (
+		once   sync.Once
+		active atomic.Int64
+	)
+	consumers := make([]*consumer, n)
+	for i := range consumers {
+		consumers[i] = &consumer{ch: make(chan item, o.buffer), stopped: make(chan struct{})}
+	}
+	active.Store(int64(n))
+	stop := func(c *consumer) {
+		c.stopOnce.Do(func() {
+			close(c.stopped)
+			active.Add(-1)
+		})
+	}
+	produce := func() {
+		defer func() {
+			for _, c := range consumers {
+				if !c.closed {
+					close(c.ch)
+				}
+			}
+		}()
+		stream(func(v T, err error) bool {
+			for _, c := range consumers {
+				if c.closed {
+					continue
+				}
+				if o.policy == Detach {
+					select {
+					case c.ch <- item{value: v, err: err}:
+					case <-c.stopped:
+					default:
+						c.slow.Store(true)
+						c.closed = true
+						close(c.ch)
+						stop(c)
+					}
+					continue
+				}
+				select {
+				case c.ch <- item{value: v, err: err}:
+				case <-c.stopped:
+				}
+			}
+			return active.Load() > 0
+		})
+	}
+	streams := make([]iter.Seq2[T, error], n)
+	for i, c := range consumers {
+		streams[i] = func(yield func(T, error) bool) {
+			once.Do(func() { go produce() })
+			defer stop(c)
+			for it := range c.ch {
+				if !yield(it.value, it.err) {
+					return
+				}
+			}
+			if c.slow.Load() {
+				yield(*new(T), ErrSlowConsumer)
+			}
+		}
+	}
+	return streams
+}
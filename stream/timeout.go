@@ -0,0 +1,58 @@
+package stream
+
+import (
+	"errors"
+	"iter"
+	"time"
+)
+
+// ErrTimeout is emitted when a stream produces no value within the configured idle timeout.
+var ErrTimeout = errors.New("stream: timed out waiting for the next value")
+
+// WithTimeout returns a stream that aborts with ErrTimeout if the source emits
+// no value within d of the start or of the previous value.
+//
+// The source runs in its own goroutine. When the consumer stops early or the
+// timeout fires, the source is cancelled the next time it yields; sources
+// should also observe their context so blocking calls are interrupted.
+func WithTimeout[T any](stream iter.Seq2[T, error], d time.Duration) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		type item struct {
+			value T
+			err   error
+		}
+		var (
+			ch   = make(chan item)
+			stop = make(chan struct{})
+		)
+		go func() {
+			defer close(ch)
+			stream(func(v T, err error) bool {
+				select {
+				case ch <- item{value: v, err: err}:
+					return true
+				case <-stop:
+					return false
+				}
+			})
+		}()
+		defer close(stop)
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		for {
+			select {
+			case it, ok := <-ch:
+				if !ok {
+					return
+				}
+				if !yield(it.value, it.err) {
+					return
+				}
+				timer.Reset(d)
+			case <-timer.C:
+				yield(*new(T), ErrTimeout)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package blades
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ConfigCheck names a check of the configuration of an agent run by Strict.
+type ConfigCheck string
+
+const (
+	// CheckTools finds tools set on a model that cannot call them.
+	CheckTools ConfigCheck = "tools"
+	// CheckStructuredOutput finds an output schema set on a model without
+	// structured output, which only gets the schema as an instruction.
+	CheckStructuredOutput ConfigCheck = "structured_output"
+	// CheckVision finds image input sent to a model whose vision support is unknown.
+	CheckVision ConfigCheck = "vision"
+	// CheckInstructions finds instruction options that override each other.
+	CheckInstructions ConfigCheck = "instructions"
+	// CheckTemplateKeys finds placeholders of the instruction that are never
+	// bound: those written in another template syntax, and state keys that
+	// are not set when it renders.
+	CheckTemplateKeys ConfigCheck = "template_keys"
+	// CheckOutputKey finds an output key on an agent run outside of a flow,
+	// where no other agent reads it.
+	CheckOutputKey ConfigCheck = "output_key"
+	// CheckLanguage finds a language that is not a BCP-47 tag.
+	CheckLanguage ConfigCheck = "language"
+	// CheckIterations finds iteration and attempt counts that stop the agent
+	// before its first answer.
+	CheckIterations ConfigCheck = "iterations"
+)
+
+// ConfigProblem is a problem of the configuration of an agent. It unwraps to
+// ErrInvalidConfig.
+type ConfigProblem struct {
+	Agent string
+	Check ConfigCheck
+	// Problem describes what is wrong, and Hint how to fix it.
+	Problem string
+	Hint    string
+}
+
+func (p *ConfigProblem) Error() string {
+	return fmt.Sprintf("agent %s: %s: %s; %s", p.Agent, p.Check, p.Problem, p.Hint)
+}
+
+// Unwrap returns ErrInvalidConfig.
+func (p *ConfigProblem) Unwrap() error {
+	return ErrInvalidConfig
+}
+
+// ConfigError is returned by NewAgent for a Strict agent with configuration
+// problems. It lists all of them, and unwraps to each.
+type ConfigError struct {
+	Agent    string
+	Problems []*ConfigProblem
+}
+
+func (e *ConfigError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "agent %s: %s:", e.Agent, ErrInvalidConfig)
+	for _, p := range e.Problems {
+		fmt.Fprintf(&b, "\n- %s: %s; %s", p.Check, p.Problem, p.Hint)
+	}
+	return b.String()
+}
+
+// Unwrap returns the problems.
+func (e *ConfigError) Unwrap() []error {
+	errs := make([]error, len(e.Problems))
+	for i, p := range e.Problems {
+		errs[i] = p
+	}
+	return errs
+}
+
+// ConfigWarningHandler is called with the problems a Strict agent finds when
+// it runs, which depend on the invocation: the session state, the model a
+// middleware switched to or where the agent runs.
+type ConfigWarningHandler func(ctx context.Context, problem *ConfigProblem)
+
+// Strict makes NewAgent fail with a ConfigError listing every problem of the
+// configuration of the Agent it can find, instead of accepting it or failing
+// on the first one. The capabilities of the model are looked up in the
+// capability registry; see LookupModelCapabilities.
+//
+// Problems that depend on the invocation are reported once each, when the
+// agent runs, to the ConfigWarningHandler, which logs them to the logger of
+// the agent by default; see WithLogger.
+func Strict() AgentOption {
+	return func(a *agent) {
+		a.strict = true
+	}
+}
+
+// WithConfigWarningHandler sets the handler of the problems a Strict agent
+// finds when it runs.
+func WithConfigWarningHandler(handler ConfigWarningHandler) AgentOption {
+	return func(a *agent) {
+		a.configWarnings = handler
+	}
+}
+
+// foreignPlaceholder matches placeholders of other template syntaxes, such as
+// {name}, ${name} and {{name}}, which text/template leaves unbound or rejects.
+var foreignPlaceholder = regexp.MustCompile(`\$?\{\{?\s*[A-Za-z_][A-Za-z0-9_]*\s*\}\}?`)
+
+// checkConfig returns the problems of the configuration of the agent found
+// without running it.
+func (a *agent) checkConfig() error {
+	var problems []*ConfigProblem
+	add := func(check ConfigCheck, hint, format string, args ...any) {
+		problems = append(problems, &ConfigProblem{Agent: a.name, Check: check, Problem: fmt.Sprintf(format, args...), Hint: hint})
+	}
+	name := a.model.Name()
+	c := capabilitiesOf(a.model, name)
+	if (len(a.tools) > 0 || a.toolsResolver != nil) && c.Tools == Unsupported {
+		add(CheckTools, "remove WithTools and WithToolsResolver or switch models", "model %s does not support tool calling", name)
+	}
+	if a.outputSchema != nil && c.StructuredOutput == Unsupported {
+		add(CheckStructuredOutput, "switch models, or check the output with WithOutputValidators",
+			"model %s does not support structured output, so the output schema is only sent as an instruction", name)
+	}
+	if a.instruction != "" && a.instructionSource != nil {
+		add(CheckInstructions, "remove WithInstruction or WithInstructionsSource", "the instruction source replaces the static instruction")
+	}
+	if a.instruction != "" && len(a.modelInstructions) > 0 {
+		add(CheckInstructions, "move the instruction into the default entry of WithInstructionsByModel", "both WithInstruction and WithInstructionsByModel are set")
+	}
+	if a.instructionVersion != "" && a.instruction == "" && len(a.modelInstructions) == 0 {
+		add(CheckInstructions, "remove WithInstructionsVersion or set a static instruction", "the instructions version has no static instruction to version")
+	}
+	checkPlaceholders := func(source, text string) {
+		// Actions, e.g. {{.name}} or {{if .name}}, are removed first.
+		plain := templateAction.ReplaceAllString(text, "")
+		if match := foreignPlaceholder.FindString(plain); match != "" {
+			add(CheckTemplateKeys, "write state keys as {{.key}}", "the %s has the placeholder %s, which is never bound", source, match)
+		}
+	}
+	checkPlaceholders("instruction", a.instruction)
+	for _, key := range slices.Sorted(maps.Keys(a.modelInstructions)) {
+		checkPlaceholders(fmt.Sprintf("instruction for %q", key), a.modelInstructions[key])
+	}
+	if a.language != "" {
+		if _, err := LanguageDirective(a.language); err != nil {
+			add(CheckLanguage, `use a tag such as "es" or "pt-BR"`, "%v", err)
+		}
+	}
+	if a.maxIterations < 1 {
+		add(CheckIterations, "set WithMaxIterations to 1 or more", "max iterations is %d", a.maxIterations)
+	}
+	if len(a.outputValidators) > 0 && a.outputAttempts < 1 {
+		add(CheckIterations, "set WithOutputValidationAttempts to 1 or more", "output validation attempts is %d", a.outputAttempts)
+	}
+	if len(problems) > 0 {
+		return &ConfigError{Agent: a.name, Problems: problems}
+	}
+	return nil
+}
+
+// templateAction matches a well-formed action of text/template, whose
+// arguments start with a dot, a dollar variable, a string or a keyword.
+var templateAction = regexp.MustCompile(`\{\{-?\s*(\.|\$[A-Za-z_]|"|end\b|else\b|if\b|with\b|range\b|template\b|include\b|block\b|define\b|/\*)[^}]*\}\}`)
+
+// warnConfig reports a problem found when the agent runs, once.
+func (a *agent) warnConfig(ctx context.Context, check ConfigCheck, hint, format string, args ...any) {
+	problem := &ConfigProblem{Agent: a.name, Check: check, Problem: fmt.Sprintf(format, args...), Hint: hint}
+	if _, seen := a.warned.LoadOrStore(problem.Problem, true); seen {
+		return
+	}
+	if a.configWarnings != nil {
+		a.configWarnings(ctx, problem)
+		return
+	}
+	a.log().WarnContext(ctx, problem.Error(), "agent", a.name, "check", problem.Check)
+}
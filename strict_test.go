@@ -0,0 +1,129 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-kratos/blades/tools"
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+func TestStrictConfig(t *testing.T) {
+	echo := tools.NewTool("echo", "Echoes the input.", tools.HandleFunc(func(ctx context.Context, input string) (string, error) {
+		return input, nil
+	}))
+	// o1-mini calls no tools and has no structured output.
+	limited := &mockModel{name: "o1-mini"}
+	tests := []struct {
+		name   string
+		opts   []AgentOption
+		checks []ConfigCheck
+	}{
+		{name: "valid", opts: []AgentOption{WithModel(&mockModel{}), WithInstruction("Greet {{.name}}.{{if .title}} {{.title}}{{end}}"), WithTools(echo)}},
+		{name: "tools", opts: []AgentOption{WithModel(limited), WithTools(echo)}, checks: []ConfigCheck{CheckTools}},
+		{name: "structured output", opts: []AgentOption{WithModel(limited), WithOutputSchema(&jsonschema.Schema{Type: "object"})}, checks: []ConfigCheck{CheckStructuredOutput}},
+		{name: "instruction and source", opts: []AgentOption{WithModel(&mockModel{}), WithInstruction("Greet."), WithInstructionsSource(InstructionSourceFunc(func(ctx context.Context) (string, string, error) {
+			return "Welcome.", "v1", nil
+		}))}, checks: []ConfigCheck{CheckInstructions}},
+		{name: "instruction and instructions by model", opts: []AgentOption{WithModel(&mockModel{}), WithInstruction("Greet."), WithInstructionsByModel(map[string]string{DefaultInstructionVariant: "Greet."})}, checks: []ConfigCheck{CheckInstructions}},
+		{name: "version without instruction", opts: []AgentOption{WithModel(&mockModel{}), WithInstructionsVersion("v2")}, checks: []ConfigCheck{CheckInstructions}},
+		{name: "foreign placeholders", opts: []AgentOption{WithModel(&mockModel{}), WithInstruction("Greet {name} from ${city}.")}, checks: []ConfigCheck{CheckTemplateKeys}},
+		{name: "foreign placeholder by model", opts: []AgentOption{WithModel(&mockModel{}), WithInstructionsByModel(map[string]string{DefaultInstructionVariant: "Greet {{.name}}.", "gpt-*": "Greet {name}."})}, checks: []ConfigCheck{CheckTemplateKeys}},
+		{name: "language", opts: []AgentOption{WithModel(&mockModel{}), WithLanguage("Spanish")}, checks: []ConfigCheck{CheckLanguage}},
+		{name: "iterations", opts: []AgentOption{WithModel(&mockModel{}), WithMaxIterations(0), WithOutputValidators(MaxLength(10)), WithOutputValidationAttempts(0)}, checks: []ConfigCheck{CheckIterations, CheckIterations}},
+		{name: "several", opts: []AgentOption{WithModel(limited), WithTools(echo), WithLanguage("Spanish")}, checks: []ConfigCheck{CheckTools, CheckLanguage}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewAgent("greeter", append(tt.opts, Strict())...)
+			if tt.checks == nil {
+				if err != nil {
+					t.Fatalf("want the agent built, got %v", err)
+				}
+				return
+			}
+			var configErr *ConfigError
+			if !errors.As(err, &configErr) || !errors.Is(err, ErrInvalidConfig) {
+				t.Fatalf("want a ConfigError, got %v", err)
+			}
+			var checks []ConfigCheck
+			for _, p := range configErr.Problems {
+				if p.Hint == "" {
+					t.Fatalf("want a hint for %v", p)
+				}
+				checks = append(checks, p.Check)
+			}
+			if !slices.Equal(checks, tt.checks) {
+				t.Fatalf("want problems %v, got:\n%v", tt.checks, err)
+			}
+		})
+	}
+}
+
+func TestStrictConfigWarnings(t *testing.T) {
+	var warnings []*ConfigProblem
+	agent, err := NewAgent("greeter",
+		WithModel(&mockModel{generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+			return textResponse("hello"), nil
+		}}),
+		WithInstruction("Greet {{.name}}."),
+		WithOutputKey("greeting"),
+		Strict(),
+		WithConfigWarningHandler(func(ctx context.Context, problem *ConfigProblem) {
+			warnings = append(warnings, problem)
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	image := UserMessage("who is this?")
+	image.Parts = append(image.Parts, DataPart{Name: "face.png", Bytes: []byte{0x89}, MIMEType: MIMEImagePNG})
+	runner := NewRunner(agent)
+	for range 2 {
+		if _, err := runner.Run(context.Background(), image); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var checks []ConfigCheck
+	for _, w := range warnings {
+		checks = append(checks, w.Check)
+	}
+	if want := []ConfigCheck{CheckOutputKey, CheckTemplateKeys, CheckVision}; !slices.Equal(checks, want) {
+		t.Fatalf("want the warnings %v once, got %v", want, warnings)
+	}
+
+	// In a flow, the output key is read by the next agents, and a set key is bound.
+	warnings = nil
+	session := NewSession(map[string]any{"name": "Ada"})
+	if _, err := runner.Run(NewPathContext(context.Background(), "pipeline"), UserMessage("hi"), WithSession(session)); err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 0 {
+		t.Fatalf("want no warnings, got %v", warnings)
+	}
+}
+
+func TestStrictConfigWarningsLogged(t *testing.T) {
+	var logs strings.Builder
+	agent, err := NewAgent("greeter",
+		WithModel(&mockModel{generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+			return textResponse("hello"), nil
+		}}),
+		WithInstruction("Greet {{.name}}."),
+		Strict(),
+		WithLogger(slog.New(slog.NewTextHandler(&logs, nil))),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewRunner(agent).Run(context.Background(), UserMessage("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs.String(), "level=WARN") || !strings.Contains(logs.String(), "check="+string(CheckTemplateKeys)) {
+		t.Fatalf("want the warning in the agent logger, got %q", logs.String())
+	}
+}
@@ -0,0 +1,255 @@
+package blades
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+// StructuredMode is how a Structured run asks the model for its schema.
+type StructuredMode int
+
+const (
+	// StructuredNative sends the schema as the output schema of the request,
+	// or in the instruction for models without structured output.
+	StructuredNative StructuredMode = iota
+	// StructuredInstruction always sends the schema in the instruction.
+	StructuredInstruction
+)
+
+// StructuredOption configures a Structured.
+type StructuredOption func(*structuredOptions)
+
+type structuredOptions struct {
+	mode   StructuredMode
+	schema *jsonschema.Schema
+}
+
+// WithStructuredMode sets how the schema is sent. Defaults to StructuredNative.
+func WithStructuredMode(mode StructuredMode) StructuredOption {
+	return func(o *structuredOptions) {
+		o.mode = mode
+	}
+}
+
+// WithStructuredSchema sets the schema sent to the model. Defaults to the
+// schema inferred from the type.
+func WithStructuredSchema(schema *jsonschema.Schema) StructuredOption {
+	return func(o *structuredOptions) {
+		o.schema = schema
+	}
+}
+
+// StructuredOutputError is returned when an answer holds no JSON value of the
+// expected type. It unwraps to ErrInvalidStructuredOutput.
+type StructuredOutputError struct {
+	// Text is the answer of the model.
+	Text string
+	// Err is why the answer did not parse.
+	Err error
+}
+
+func (e *StructuredOutputError) Error() string {
+	text := e.Text
+	if utf8.RuneCountInString(text) > 200 {
+		text = string([]rune(text)[:200]) + "..."
+	}
+	return fmt.Sprintf("%s: %v in %q", ErrInvalidStructuredOutput, e.Err, text)
+}
+
+// Unwrap returns ErrInvalidStructuredOutput.
+func (e *StructuredOutputError) Unwrap() error {
+	return ErrInvalidStructuredOutput
+}
+
+// Structured runs the root agent of a Runner for a value of type T: the
+// agent is asked for a JSON value matching the schema of T, and its final
+// answer is parsed with ParseStructured. The schema is sent by the root agent
+// when it is created by NewAgent; the answers of other agents, such as flows,
+// are parsed as they are.
+type Structured[T any] struct {
+	runner *Runner
+	schema *jsonschema.Schema
+	mode   StructuredMode
+}
+
+// NewStructured returns a Structured running the runner.
+func NewStructured[T any](runner *Runner, opts ...StructuredOption) (*Structured[T], error) {
+	var o structuredOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.schema == nil {
+		schema, err := jsonschema.For[T](nil)
+		if err != nil {
+			return nil, fmt.Errorf("structured output: schema: %w", err)
+		}
+		o.schema = schema
+	}
+	return &Structured[T]{runner: runner, schema: o.schema, mode: o.mode}, nil
+}
+
+// Run runs the agent and returns the value of its final answer.
+func (s *Structured[T]) Run(ctx context.Context, message *Message, opts ...RunOption) (T, error) {
+	ctx, opts = s.prepare(ctx, opts)
+	output, err := s.runner.Run(ctx, message, opts...)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return ParseStructured[T](output.Text())
+}
+
+// RunStream runs the agent streaming and yields the value of its final
+// answer once it completed: a partial JSON value has no typed form, so
+// nothing is yielded before.
+func (s *Structured[T]) RunStream(ctx context.Context, message *Message, opts ...RunOption) Generator[T, error] {
+	return func(yield func(T, error) bool) {
+		var (
+			zero          T
+			output, final *Message
+		)
+		ctx, opts := s.prepare(ctx, opts)
+		for m, err := range s.runner.RunStream(ctx, message, opts...) {
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			output = m
+			if m != nil && m.Final {
+				final = m
+			}
+		}
+		if final == nil {
+			final = output
+		}
+		if final == nil {
+			yield(zero, ErrNoFinalResponse)
+			return
+		}
+		yield(ParseStructured[T](final.Text()))
+	}
+}
+
+// ctxStructuredKey is the context key for the structuredRequest of a run.
+type ctxStructuredKey struct{}
+
+// structuredRequest is the schema a Structured run asks its root invocation for.
+type structuredRequest struct {
+	invocationID string
+	schema       *jsonschema.Schema
+	inject       bool
+}
+
+// prepare returns the context and options of a run asking for the schema.
+func (s *Structured[T]) prepare(ctx context.Context, opts []RunOption) (context.Context, []RunOption) {
+	var o RunOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.InvocationID == "" {
+		o.InvocationID = NewInvocationID()
+		opts = append(opts, WithInvocationID(o.InvocationID))
+	}
+	return context.WithValue(ctx, ctxStructuredKey{}, structuredRequest{
+		invocationID: o.InvocationID,
+		schema:       s.schema,
+		inject:       s.mode == StructuredInstruction,
+	}), opts
+}
+
+// structuredFromContext returns the schema a Structured run asks the
+// invocation in ctx for, if it is the root invocation of the run.
+func structuredFromContext(ctx context.Context) (structuredRequest, bool) {
+	s, ok := ctx.Value(ctxStructuredKey{}).(structuredRequest)
+	if !ok {
+		return structuredRequest{}, false
+	}
+	invocation, ok := FromInvocationContext(ctx)
+	return s, ok && invocation.ID == s.invocationID
+}
+
+// ParseStructured returns the JSON value of type T in a model answer. Besides
+// a bare JSON value, it finds one in a fenced code block, however many
+// backticks the fence has, or embedded in prose, taking the first value that
+// fits T. It fails with a *StructuredOutputError holding the answer.
+func ParseStructured[T any](text string) (T, error) {
+	var firstErr, typeErr error
+	for _, candidate := range jsonCandidates(text) {
+		var v T
+		err := json.Unmarshal([]byte(candidate), &v)
+		if err == nil {
+			return v, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if typeErr == nil && json.Valid([]byte(candidate)) {
+			typeErr = err
+		}
+	}
+	var zero T
+	err := cmp.Or(typeErr, firstErr)
+	if err == nil {
+		err = errors.New("no JSON value found")
+	}
+	return zero, &StructuredOutputError{Text: text, Err: err}
+}
+
+// jsonCandidates returns the texts that may hold the JSON value of an
+// answer, most likely first: the whole answer, the contents of its fenced
+// code blocks, then the JSON values embedded in it.
+func jsonCandidates(text string) []string {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil
+	}
+	candidates := append([]string{text}, fencedBlocks(text)...)
+	for i := 0; i < len(text); i++ {
+		if text[i] != '{' && text[i] != '[' {
+			continue
+		}
+		var raw json.RawMessage
+		dec := json.NewDecoder(strings.NewReader(text[i:]))
+		if err := dec.Decode(&raw); err != nil {
+			continue
+		}
+		candidates = append(candidates, string(raw))
+		// The values nested in this one are not candidates of their own.
+		i += int(dec.InputOffset()) - 1
+	}
+	return candidates
+}
+
+// fencedBlocks returns the contents of the fenced code blocks of the text. A
+// block ends at a line of at least as many backticks as its opening fence, so
+// that it may hold shorter fences, or at the end of a truncated text.
+func fencedBlocks(text string) []string {
+	var (
+		blocks []string
+		lines  = strings.SplitAfter(text, "\n")
+	)
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		fence := len(line) - len(strings.TrimLeft(line, "`"))
+		if fence < 3 || strings.Contains(line[fence:], "`") {
+			continue
+		}
+		var body strings.Builder
+		for i++; i < len(lines); i++ {
+			line := strings.TrimSpace(lines[i])
+			if n := len(line) - len(strings.TrimLeft(line, "`")); n >= fence && n == len(line) {
+				break
+			}
+			body.WriteString(lines[i])
+		}
+		blocks = append(blocks, body.String())
+	}
+	return blocks
+}
@@ -0,0 +1,133 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type film struct {
+	Title string `json:"title"`
+	Year  int    `json:"year"`
+}
+
+func TestParseStructured(t *testing.T) {
+	want := film{Title: "Big", Year: 1988}
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"bare", `{"title":"Big","year":1988}`},
+		{"fenced", "```json\n{\"title\":\"Big\",\"year\":1988}\n```"},
+		{"closing fence on the same line", "```json\n{\"title\":\"Big\",\"year\":1988}```"},
+		{"prose before", "Sure! Here is the film:\n{\"title\": \"Big\", \"year\": 1988}"},
+		{"trailing commentary", "{\"title\": \"Big\", \"year\": 1988}\n\nLet me know if you need more films."},
+		{"prose and fence", "Here you go:\n\n```\n{\"title\":\"Big\",\"year\":1988}\n```\nEnjoy! {not json}"},
+		{"brackets in prose", "Films [see note 1] include {\"title\":\"Big\",\"year\":1988}."},
+		{"nested backticks", "````markdown\n```json\n{\"title\":\"Big\",\"year\":1988}\n```\n````"},
+		{"backticks in values", "```json\n{\"title\":\"Big\",\"year\":1988,\"note\":\"uses ``` fences\"}\n```"},
+		{"truncated fence", "```json\n{\"title\":\"Big\",\"year\":1988}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseStructured[film](tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Fatalf("want %+v, got %+v", want, got)
+			}
+		})
+	}
+}
+
+func TestParseStructuredArray(t *testing.T) {
+	text := "The films are:\n```json\n[{\"title\":\"Big\",\"year\":1988},{\"title\":\"Cast Away\",\"year\":2000}]\n```"
+	got, err := ParseStructured[[]film](text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []film{{"Big", 1988}, {"Cast Away", 2000}}; !slices.Equal(got, want) {
+		t.Fatalf("want %+v, got %+v", want, got)
+	}
+	// The elements of an array are not taken for an object.
+	if _, err := ParseStructured[film](text); !errors.Is(err, ErrInvalidStructuredOutput) {
+		t.Fatalf("want ErrInvalidStructuredOutput, got %v", err)
+	}
+}
+
+func TestParseStructuredError(t *testing.T) {
+	for _, text := range []string{"I cannot answer that.", `{"title": 42}`, ""} {
+		_, err := ParseStructured[film](text)
+		var structuredErr *StructuredOutputError
+		if !errors.As(err, &structuredErr) || structuredErr.Text != text || !errors.Is(err, ErrInvalidStructuredOutput) {
+			t.Fatalf("want a structured output error with the text %q, got %v", text, err)
+		}
+	}
+	_, err := ParseStructured[film](`{"title": 42}`)
+	if !strings.Contains(err.Error(), "cannot unmarshal number") {
+		t.Fatalf("want the type error, got %v", err)
+	}
+}
+
+func TestStructured(t *testing.T) {
+	tests := []struct {
+		name         string
+		mode         StructuredMode
+		wantSchema   bool
+		wantDirected bool
+	}{
+		{name: "native", mode: StructuredNative, wantSchema: true},
+		{name: "instruction", mode: StructuredInstruction, wantDirected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []*ModelRequest
+			model := &mockModel{generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+				requests = append(requests, req)
+				return textResponse("```json\n{\"title\":\"Big\",\"year\":1988}\n```"), nil
+			}}
+			agent, err := NewAgent("films", WithModel(model), WithInstruction("Name a film."))
+			if err != nil {
+				t.Fatal(err)
+			}
+			structured, err := NewStructured[film](NewRunner(agent), WithStructuredMode(tt.mode))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := structured.Run(context.Background(), UserMessage("Tom Hanks"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for value, err := range structured.RunStream(context.Background(), UserMessage("Tom Hanks")) {
+				if err != nil || value != got {
+					t.Fatalf("stream: want %+v, got %+v, %v", got, value, err)
+				}
+			}
+			if got != (film{Title: "Big", Year: 1988}) {
+				t.Fatalf("unexpected value %+v", got)
+			}
+			if len(requests) != 2 {
+				t.Fatalf("want 2 requests, got %d", len(requests))
+			}
+			for _, req := range requests {
+				if hasSchema := req.OutputSchema != nil; hasSchema != tt.wantSchema {
+					t.Fatalf("want output schema %v, got %v", tt.wantSchema, req.OutputSchema)
+				}
+				if directed := strings.Contains(req.Instruction.Text(), `"title"`); directed != tt.wantDirected {
+					t.Fatalf("want the schema in the instruction %v, got %q", tt.wantDirected, req.Instruction.Text())
+				}
+			}
+			// Runs without Structured are unchanged.
+			requests = nil
+			if _, err := NewRunner(agent).Run(context.Background(), UserMessage("Tom Hanks")); err != nil {
+				t.Fatal(err)
+			}
+			if requests[0].OutputSchema != nil || requests[0].Instruction.Text() != "Name a film." {
+				t.Fatalf("unexpected request %+v", requests[0])
+			}
+		})
+	}
+}
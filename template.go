@@ -0,0 +1,286 @@
+package blades
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+// TemplateFuncs is a map of functions available to instruction templates.
+type TemplateFuncs = template.FuncMap
+
+// WithTemplateFuncs registers additional functions for the instruction template.
+// They are merged with, and may override, the built-in functions:
+//
+//	now                        returns the current time
+//	date "2006-01-02" .since   formats a time.Time, a Unix timestamp or an RFC 3339 string
+//	join ", " .tags            joins the elements of a slice
+//	truncate 80 .summary       keeps at most N runes
+//	json .profile              marshals a value as JSON
+//	include "tone" .           renders a partial into a string
+func WithTemplateFuncs(funcs TemplateFuncs) AgentOption {
+	return func(a *agent) {
+		if a.templateFuncs == nil {
+			a.templateFuncs = make(TemplateFuncs, len(funcs))
+		}
+		for name, fn := range funcs {
+			a.templateFuncs[name] = fn
+		}
+	}
+}
+
+// WithTemplatePartials registers named partials that the instruction can reuse
+// with {{template "name" .}} or {{include "name" .}}, so shared boilerplate
+// such as tone guidelines can be defined once and shared across agents.
+func WithTemplatePartials(partials map[string]string) AgentOption {
+	return func(a *agent) {
+		if a.templatePartials == nil {
+			a.templatePartials = make(map[string]string, len(partials))
+		}
+		for name, text := range partials {
+			a.templatePartials[name] = text
+		}
+	}
+}
+
+// WithTemplateStrict makes the instruction fail with ErrMissingStateKey when a
+// state key it reads is not set, instead of rendering "<no value>". Keys that are
+// only read under an {{if}} or {{with}} guard on the same key are optional.
+// A missing nested key, e.g. the name of {{.user.name}}, fails the render.
+func WithTemplateStrict(strict bool) AgentOption {
+	return func(a *agent) {
+		a.templateStrict = strict
+	}
+}
+
+// parseInstruction parses an instruction together with its partials and functions.
+func (a *agent) parseInstruction(instruction string) (*template.Template, error) {
+	var t *template.Template
+	funcs := templateFuncs()
+	funcs["include"] = func(name string, data any) (string, error) {
+		var buf strings.Builder
+		if err := t.ExecuteTemplate(&buf, name, data); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+	for name, fn := range a.templateFuncs {
+		funcs[name] = fn
+	}
+	if a.templateSandbox != nil {
+		funcs[sandboxIterationFunc] = sandboxIteration
+	}
+	t = template.New("instruction").Funcs(funcs)
+	if a.templateStrict {
+		// Partials inherit the option, so nested keys fail wherever they are read.
+		t = t.Option("missingkey=error")
+	}
+	if _, err := t.Parse(instruction); err != nil {
+		return nil, fmt.Errorf("agent %s: parse instruction: %w", a.name, err)
+	}
+	names := make([]string, 0, len(a.templatePartials))
+	for name := range a.templatePartials {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		if _, err := t.New(name).Parse(a.templatePartials[name]); err != nil {
+			return nil, fmt.Errorf("agent %s: parse partial %s: %w", a.name, name, err)
+		}
+	}
+	return t, nil
+}
+
+// renderInstruction executes an instruction template with the session state.
+func (a *agent) renderInstruction(t *template.Template, state State) (string, error) {
+	if a.templateSandbox != nil {
+		return a.templateSandbox.execute(t, state)
+	}
+	var buf strings.Builder
+	if err := t.Execute(&buf, state); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// instructionHash returns a short hash of an instruction and its partials.
+func (a *agent) instructionHash(instruction string) string {
+	h := sha256.New()
+	h.Write([]byte(instruction))
+	names := slices.Sorted(maps.Keys(a.templatePartials))
+	for _, name := range names {
+		h.Write([]byte{0})
+		h.Write([]byte(name))
+		h.Write([]byte{0})
+		h.Write([]byte(a.templatePartials[name]))
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// templateFuncs returns the built-in template functions, except include.
+func templateFuncs() TemplateFuncs {
+	return TemplateFuncs{
+		"now":      time.Now,
+		"date":     templateDate,
+		"join":     templateJoin,
+		"truncate": templateTruncate,
+		"json":     templateJSON,
+	}
+}
+
+// templateKeys returns the top-level state keys read by the template and its
+// partials that are not guarded by an {{if}} or {{with}} on the same key, and
+// all the top-level state keys they read.
+func templateKeys(t *template.Template) (required, read []string) {
+	w := &keyWalker{required: make(map[string]struct{}), read: make(map[string]struct{}), guarded: make(map[string]int)}
+	for _, tmpl := range t.Templates() {
+		if tmpl.Tree != nil {
+			w.walk(tmpl.Tree.Root, true)
+		}
+	}
+	return slices.Sorted(maps.Keys(w.required)), slices.Sorted(maps.Keys(w.read))
+}
+
+// keyWalker collects the state keys read by a template parse tree.
+type keyWalker struct {
+	required map[string]struct{}
+	read     map[string]struct{}
+	guarded  map[string]int
+}
+
+// walk visits node; state reports whether dot is still the session state.
+func (w *keyWalker) walk(node parse.Node, state bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			w.walk(child, state)
+		}
+	case *parse.ActionNode:
+		w.pipe(n.Pipe, state, false)
+	case *parse.TemplateNode:
+		w.pipe(n.Pipe, state, false)
+	case *parse.IfNode:
+		keys := w.pipe(n.Pipe, state, true)
+		for _, key := range keys {
+			w.guarded[key]++
+		}
+		w.walk(n.List, state)
+		for _, key := range keys {
+			w.guarded[key]--
+		}
+		w.walk(n.ElseList, state)
+	case *parse.WithNode:
+		w.pipe(n.Pipe, state, true)
+		w.walk(n.List, false)
+		w.walk(n.ElseList, state)
+	case *parse.RangeNode:
+		w.pipe(n.Pipe, state, true)
+		w.walk(n.List, false)
+		w.walk(n.ElseList, state)
+	}
+}
+
+// pipe records the keys read by a pipeline and returns them. Keys read by a
+// guard pipeline are optional.
+func (w *keyWalker) pipe(pipe *parse.PipeNode, state, guard bool) []string {
+	if pipe == nil {
+		return nil
+	}
+	var keys []string
+	for _, cmd := range pipe.Cmds {
+		for _, arg := range cmd.Args {
+			var key string
+			switch n := arg.(type) {
+			case *parse.FieldNode:
+				if state {
+					key = n.Ident[0]
+				}
+			case *parse.VariableNode:
+				if len(n.Ident) > 1 && n.Ident[0] == "$" {
+					key = n.Ident[1]
+				}
+			case *parse.PipeNode:
+				keys = append(keys, w.pipe(n, state, guard)...)
+			}
+			if key == "" {
+				continue
+			}
+			keys = append(keys, key)
+			w.read[key] = struct{}{}
+			if !guard && w.guarded[key] == 0 {
+				w.required[key] = struct{}{}
+			}
+		}
+	}
+	return keys
+}
+
+func templateDate(layout string, value any) (string, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v.Format(layout), nil
+	case *time.Time:
+		if v == nil {
+			return "", nil
+		}
+		return v.Format(layout), nil
+	case int64:
+		return time.Unix(v, 0).Format(layout), nil
+	case string:
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return "", err
+		}
+		return t.Format(layout), nil
+	default:
+		return "", fmt.Errorf("date: unsupported value of type %T", value)
+	}
+}
+
+func templateJoin(sep string, value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case []string:
+		return strings.Join(v, sep), nil
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return "", fmt.Errorf("join: unsupported value of type %T", value)
+	}
+	elems := make([]string, rv.Len())
+	for i := range elems {
+		elems[i] = fmt.Sprint(rv.Index(i).Interface())
+	}
+	return strings.Join(elems, sep), nil
+}
+
+func templateTruncate(n int, s string) string {
+	if n < 0 {
+		return s
+	}
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
+
+func templateJSON(value any) (string, error) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
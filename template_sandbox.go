@@ -0,0 +1,237 @@
+package blades
+
+import (
+	"fmt"
+	"go/token"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// sandboxIterationFunc is the function the sandbox calls at the start of
+// every {{range}} iteration to count them.
+const sandboxIterationFunc = "sandboxIteration"
+
+// TemplateSandbox limits the execution of the instruction template, so that
+// instructions built from customer fragments cannot run away. Zero fields use
+// their defaults.
+type TemplateSandbox struct {
+	// AllowedKeys are the state keys an instruction fragment may read with a
+	// {{.key}} placeholder. Any other text of a fragment is literal.
+	AllowedKeys []string
+	// MaxOutputBytes caps the size of the rendered instruction, 64 KiB by default.
+	MaxOutputBytes int
+	// MaxDepth caps the nesting of {{template}} calls and of includes, 8 by default.
+	MaxDepth int
+	// MaxIterations caps the total number of {{range}} iterations of a render,
+	// 1000 by default.
+	MaxIterations int
+}
+
+// WithTemplateSandbox renders the instruction within the limits of the sandbox.
+// The agent fails to build if its templates call each other recursively or
+// nest deeper than MaxDepth, and the instruction fails to render with
+// ErrTemplateLimit once it exceeds a limit.
+func WithTemplateSandbox(sandbox TemplateSandbox) AgentOption {
+	return func(a *agent) {
+		if sandbox.MaxOutputBytes <= 0 {
+			sandbox.MaxOutputBytes = 64 << 10
+		}
+		if sandbox.MaxDepth <= 0 {
+			sandbox.MaxDepth = 8
+		}
+		if sandbox.MaxIterations <= 0 {
+			sandbox.MaxIterations = 1000
+		}
+		sandbox.AllowedKeys = slices.Clone(sandbox.AllowedKeys)
+		a.templateSandbox = &sandbox
+	}
+}
+
+// WithInstructionFragment registers user-supplied text as a partial that the
+// instruction can render with {{template "name" .}} or {{include "name" .}}.
+// The text is never executed: it is rendered literally, except for {{.key}}
+// placeholders of the AllowedKeys of the TemplateSandbox, which are replaced
+// by the state values.
+func WithInstructionFragment(name, text string) AgentOption {
+	return func(a *agent) {
+		if a.instructionFragments == nil {
+			a.instructionFragments = make(map[string]string)
+		}
+		a.instructionFragments[name] = text
+	}
+}
+
+// addInstructionFragments registers the instruction fragments as partials.
+func (a *agent) addInstructionFragments() {
+	if len(a.instructionFragments) == 0 {
+		return
+	}
+	var allowed []string
+	if a.templateSandbox != nil {
+		allowed = a.templateSandbox.AllowedKeys
+	}
+	if a.templatePartials == nil {
+		a.templatePartials = make(map[string]string, len(a.instructionFragments))
+	}
+	for name, text := range a.instructionFragments {
+		a.templatePartials[name] = fragmentTemplate(text, allowed)
+	}
+}
+
+// EscapeTemplate returns template text that renders s literally.
+func EscapeTemplate(s string) string {
+	if !strings.Contains(s, "{") {
+		return s
+	}
+	return "{{" + strconv.Quote(s) + "}}"
+}
+
+// fragmentTemplate returns the template text of an instruction fragment, where
+// everything but the placeholders of the allowed keys is escaped.
+func fragmentTemplate(text string, allowed []string) string {
+	var b, literal strings.Builder
+	for {
+		start := strings.Index(text, "{{")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(text[start+2:], "}}")
+		if end < 0 {
+			break
+		}
+		end += start + 2
+		key, ok := strings.CutPrefix(strings.TrimSpace(text[start+2:end]), ".")
+		if !ok || !token.IsIdentifier(key) || !slices.Contains(allowed, key) {
+			literal.WriteString(text[:start+1])
+			text = text[start+1:]
+			continue
+		}
+		literal.WriteString(text[:start])
+		b.WriteString(EscapeTemplate(literal.String()))
+		literal.Reset()
+		b.WriteString("{{." + key + "}}")
+		text = text[end+2:]
+	}
+	literal.WriteString(text)
+	b.WriteString(EscapeTemplate(literal.String()))
+	return b.String()
+}
+
+// prepare checks the template calls of t and counts the {{range}} iterations
+// of all its templates. It changes the parse trees of t, so it must be called
+// before t is executed.
+func (s *TemplateSandbox) prepare(t *template.Template) error {
+	tick, err := template.New("").Funcs(TemplateFuncs{sandboxIterationFunc: sandboxIteration}).Parse("{{" + sandboxIterationFunc + "}}")
+	if err != nil {
+		return err
+	}
+	calls := make(map[string][]string)
+	var walk func(name string, node parse.Node)
+	walk = func(name string, node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(name, child)
+			}
+		case *parse.TemplateNode:
+			calls[name] = append(calls[name], n.Name)
+		case *parse.IfNode:
+			walk(name, n.List)
+			walk(name, n.ElseList)
+		case *parse.WithNode:
+			walk(name, n.List)
+			walk(name, n.ElseList)
+		case *parse.RangeNode:
+			walk(name, n.List)
+			walk(name, n.ElseList)
+			n.List.Nodes = append([]parse.Node{tick.Tree.Root.Nodes[0]}, n.List.Nodes...)
+		}
+	}
+	templates := t.Templates()
+	for _, tmpl := range templates {
+		if tmpl.Tree != nil {
+			walk(tmpl.Name(), tmpl.Tree.Root)
+		}
+	}
+	var check func(name string, path []string) error
+	check = func(name string, path []string) error {
+		if slices.Contains(path, name) {
+			return fmt.Errorf("%w: template %s calls itself", ErrTemplateLimit, name)
+		}
+		if len(path) > s.MaxDepth {
+			return fmt.Errorf("%w: templates nested deeper than %d", ErrTemplateLimit, s.MaxDepth)
+		}
+		path = append(path, name)
+		for _, callee := range calls[name] {
+			if err := check(callee, path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, tmpl := range templates {
+		if err := check(tmpl.Name(), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// execute renders t within the limits of the sandbox. Every render runs on a
+// clone of t so that it counts its own includes and iterations.
+func (s *TemplateSandbox) execute(t *template.Template, data any) (string, error) {
+	t, err := t.Clone()
+	if err != nil {
+		return "", err
+	}
+	depth, iterations := 0, 0
+	t.Funcs(TemplateFuncs{
+		"include": func(name string, data any) (string, error) {
+			if depth >= s.MaxDepth {
+				return "", fmt.Errorf("%w: includes nested deeper than %d", ErrTemplateLimit, s.MaxDepth)
+			}
+			depth++
+			defer func() { depth-- }()
+			w := &limitedWriter{max: s.MaxOutputBytes}
+			if err := t.ExecuteTemplate(w, name, data); err != nil {
+				return "", err
+			}
+			return w.String(), nil
+		},
+		sandboxIterationFunc: func() (string, error) {
+			if iterations++; iterations > s.MaxIterations {
+				return "", fmt.Errorf("%w: more than %d iterations", ErrTemplateLimit, s.MaxIterations)
+			}
+			return "", nil
+		},
+	})
+	w := &limitedWriter{max: s.MaxOutputBytes}
+	if err := t.Execute(w, data); err != nil {
+		return "", err
+	}
+	return w.String(), nil
+}
+
+// sandboxIteration is the placeholder of the iteration counter of a render.
+func sandboxIteration() string {
+	return ""
+}
+
+// limitedWriter collects at most max bytes and fails past them.
+type limitedWriter struct {
+	strings.Builder
+	max int
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if w.Len()+len(p) > w.max {
+		return 0, fmt.Errorf("%w: output over %d bytes", ErrTemplateLimit, w.max)
+	}
+	return w.Builder.Write(p)
+}
@@ -0,0 +1,285 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func renderInstruction(t *testing.T, state map[string]any, opts ...AgentOption) (string, error) {
+	t.Helper()
+	var instruction string
+	model := &mockModel{
+		generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+			instruction = req.Instruction.Text()
+			return textResponse("ok"), nil
+		},
+	}
+	agent, err := NewAgent("templated", append([]AgentOption{WithModel(model)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	invocation := &Invocation{Session: NewSession(state), Message: UserMessage("hi")}
+	for _, err := range agent.Run(context.Background(), invocation) {
+		if err != nil {
+			return "", err
+		}
+	}
+	return instruction, nil
+}
+
+func TestInstructionTemplate(t *testing.T) {
+	tone := map[string]string{"tone": "Be friendly to {{.name}}."}
+	tests := []struct {
+		name    string
+		opts    []AgentOption
+		state   map[string]any
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "builtin funcs",
+			opts:  []AgentOption{WithInstruction(`{{date "2006-01-02" .since}} {{join ", " .tags}} {{truncate 5 .text}} {{json .profile}}`)},
+			state: map[string]any{"since": time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), "tags": []any{"a", "b"}, "text": "héllo world", "profile": map[string]any{"id": 1}},
+			want:  `2025-03-01 a, b héllo {"id":1}`,
+		},
+		{
+			name: "custom funcs",
+			opts: []AgentOption{
+				WithInstruction(`{{upper .name}}`),
+				WithTemplateFuncs(TemplateFuncs{"upper": strings.ToUpper}),
+			},
+			state: map[string]any{"name": "ada"},
+			want:  "ADA",
+		},
+		{
+			name:  "partials",
+			opts:  []AgentOption{WithInstruction(`{{template "tone" .}} {{include "tone" . | truncate 8}}`), WithTemplatePartials(tone)},
+			state: map[string]any{"name": "ada"},
+			want:  "Be friendly to ada. Be frien",
+		},
+		{
+			name:  "user content is not escaped or evaluated",
+			opts:  []AgentOption{WithInstruction(`Draft: {{.draft}}`)},
+			state: map[string]any{"draft": `<b>Tom & Jerry's</b> {{.secret}}`, "secret": "leak"},
+			want:  `Draft: <b>Tom & Jerry's</b> {{.secret}}`,
+		},
+		{
+			name: "missing key",
+			opts: []AgentOption{WithInstruction(`Hello {{.name}}`)},
+			want: "Hello <no value>",
+		},
+		{
+			name:    "strict missing key",
+			opts:    []AgentOption{WithInstruction(`Hello {{.name}}`), WithTemplateStrict(true)},
+			wantErr: true,
+		},
+		{
+			name:    "strict missing key in partial",
+			opts:    []AgentOption{WithInstruction(`{{template "tone" .}}`), WithTemplatePartials(tone), WithTemplateStrict(true)},
+			wantErr: true,
+		},
+		{
+			name: "strict guarded key",
+			opts: []AgentOption{WithInstruction(`Draft.{{if .suggestions}} Consider {{.suggestions}}.{{end}}`), WithTemplateStrict(true)},
+			want: "Draft.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderInstruction(t, tt.state, tt.opts...)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("want %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestInstructionTemplateParseError(t *testing.T) {
+	model := &mockModel{}
+	if _, err := NewAgent("broken", WithModel(model), WithInstruction("{{.name")); err == nil {
+		t.Fatal("expected parse error from NewAgent")
+	}
+	if _, err := NewAgent("broken", WithModel(model), WithInstruction("ok"), WithTemplatePartials(map[string]string{"bad": "{{end}}"})); err == nil {
+		t.Fatal("expected partial parse error from NewAgent")
+	}
+}
+
+func TestInstructionTemplateStateKeys(t *testing.T) {
+	tests := []struct {
+		name        string
+		instruction string
+		want        []string
+	}{
+		{name: "plain", instruction: `{{.draft}} {{.tone | printf "%s"}} {{$.user.name}}`, want: []string{"draft", "tone", "user"}},
+		{name: "if guard", instruction: `{{if .suggestions}}{{.suggestions}}{{end}}`, want: []string{}},
+		{name: "if else", instruction: `{{if .a}}{{.a}}{{else}}{{.b}}{{end}}`, want: []string{"b"}},
+		{name: "with and range change dot", instruction: `{{with .profile}}{{.name}}{{end}}{{range .items}}{{.id}}{{$.topic}}{{end}}`, want: []string{"topic"}},
+		{name: "function arguments", instruction: `{{truncate 10 .summary}} {{join ", " (index . "tags")}}`, want: []string{"summary"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := NewAgent("templated", WithModel(&mockModel{}), WithInstruction(tt.instruction))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := a.(*agent).RequiredStateKeys()
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("want %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	_, err := renderInstruction(t, nil, WithInstruction(`Review {{.draft}}`), WithTemplateStrict(true))
+	if !errors.Is(err, ErrMissingStateKey) || !strings.Contains(err.Error(), `"draft"`) || !strings.Contains(err.Error(), "templated") {
+		t.Fatalf("expected a missing state key error naming the key and agent, got %v", err)
+	}
+	// A missing nested key fails the render.
+	_, err = renderInstruction(t, map[string]any{"user": map[string]any{"id": 1}}, WithInstruction(`Hi {{.user.name}}`), WithTemplateStrict(true))
+	if err == nil || !strings.Contains(err.Error(), `"name"`) {
+		t.Fatalf("expected a missing nested key error, got %v", err)
+	}
+	// Missing optional keys render their guards.
+	got, err := renderInstruction(t, nil, WithInstruction(`Draft.{{if .suggestions}} Consider {{.suggestions}}.{{end}}{{with .tone}} Be {{.}}.{{end}}`), WithTemplateStrict(true))
+	if err != nil || got != "Draft." {
+		t.Fatalf("expected the optional keys skipped, got %q, %v", got, err)
+	}
+}
+
+func TestOutputKeyJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{name: "object", output: `{"score": 8, "issues": ["tone"]}`, want: "Score 8, first issue tone"},
+		{name: "fenced", output: "```json\n{\"score\": 9, \"issues\": [\"length\"]}\n```", want: "Score 9, first issue length"},
+		{name: "not json", output: "looks good"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs strings.Builder
+			reviewer, err := NewAgent("reviewer", WithOutputKeyJSON("review"), WithModel(&mockModel{
+				generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+					return textResponse(tt.output), nil
+				},
+			}), WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+			if err != nil {
+				t.Fatal(err)
+			}
+			session := NewSession()
+			for _, err := range reviewer.Run(context.Background(), &Invocation{Session: session, Message: UserMessage("review")}) {
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.want == "" {
+				if got := session.State()["review"]; got != tt.output {
+					t.Fatalf("expected the text to be stored, got %#v", got)
+				}
+				if !strings.Contains(logs.String(), "output is not JSON") {
+					t.Fatalf("expected a warning in the agent logger, got %q", logs.String())
+				}
+				return
+			}
+			got, err := renderInstruction(t, session.State(), WithInstruction(`Score {{.review.score}}, first issue {{index .review.issues 0}}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("want %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestTemplateSandbox(t *testing.T) {
+	state := map[string]any{"name": "Ada", "secret": "s3cr3t", "items": make([]int, 20)}
+	sandbox := TemplateSandbox{AllowedKeys: []string{"name"}}
+	got, err := renderInstruction(t, state,
+		WithInstruction(`Be kind to {{.name}}. {{template "custom" .}}`),
+		WithInstructionFragment("custom", `Greet {{ .name }}, not {{.secret}} {{printf "%s" .secret}} {{template "custom" .}}`),
+		WithTemplateSandbox(sandbox),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `Be kind to Ada. Greet Ada, not {{.secret}} {{printf "%s" .secret}} {{template "custom" .}}`; got != want {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+	if got := EscapeTemplate(`{{.secret}}`) + "!"; got != `{{"{{.secret}}"}}!` {
+		t.Fatalf("unexpected escaped text %q", got)
+	}
+
+	limits := []struct {
+		name        string
+		instruction string
+		sandbox     TemplateSandbox
+	}{
+		{"output", `{{range .items}}0123456789{{end}}`, TemplateSandbox{MaxOutputBytes: 100}},
+		{"iterations", `{{range .items}}{{range $.items}}{{end}}{{end}}`, TemplateSandbox{MaxIterations: 100}},
+		{"includes", `{{define "loop"}}{{include "loop" .}}{{end}}{{include "loop" .}}`, TemplateSandbox{}},
+	}
+	for _, tt := range limits {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := renderInstruction(t, state, WithInstruction(tt.instruction), WithTemplateSandbox(tt.sandbox)); !errors.Is(err, ErrTemplateLimit) {
+				t.Fatalf("want ErrTemplateLimit, got %v", err)
+			}
+		})
+	}
+	_, err = NewAgent("recursive", WithModel(&mockModel{}), WithTemplateSandbox(TemplateSandbox{}),
+		WithInstruction(`{{define "loop"}}{{template "loop" .}}{{end}}{{template "loop" .}}`))
+	if !errors.Is(err, ErrTemplateLimit) {
+		t.Fatalf("want recursive templates rejected, got %v", err)
+	}
+}
+
+func FuzzInstructionFragment(f *testing.F) {
+	for _, seed := range []string{
+		"Speak like a pirate.",
+		"{{.secret}}",
+		"{{ .name }} and {{.secret}}",
+		`{{printf "%s" .secret}}{{range .}}{{.}}{{end}}`,
+		`{{define "x"}}{{template "x"}}{{end}}{{template "x"}}`,
+		"{{{.name}}}}",
+		"{{- .name -}}{{/* comment */}}",
+		`"}}{{"`,
+		"{{",
+		"}}{",
+	} {
+		f.Add(seed)
+	}
+	state := map[string]any{"name": "Ada", "secret": "s3cr3t"}
+	f.Fuzz(func(t *testing.T, text string) {
+		got, err := renderInstruction(t, state,
+			WithInstruction(`<{{template "custom" .}}>`),
+			WithInstructionFragment("custom", text),
+			WithTemplateSandbox(TemplateSandbox{AllowedKeys: []string{"name"}}),
+		)
+		if err != nil {
+			if !errors.Is(err, ErrTemplateLimit) {
+				t.Fatalf("unexpected error for %q: %v", text, err)
+			}
+			return
+		}
+		got = strings.TrimSuffix(strings.TrimPrefix(got, "<"), ">")
+		if strings.Contains(got, "s3cr3t") && !strings.Contains(text, "s3cr3t") {
+			t.Fatalf("fragment %q read the secret: %q", text, got)
+		}
+		if !strings.Contains(text, "name") && got != text {
+			t.Fatalf("want fragment %q rendered literally, got %q", text, got)
+		}
+	})
+}
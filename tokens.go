@@ -0,0 +1,50 @@
+package blades
+
+// TokenCounter estimates the number of tokens a request consumes.
+type TokenCounter interface {
+	CountTokens(...*Message) int64
+}
+
+// TokenCounterFunc is an adapter to allow the use of ordinary functions as TokenCounters.
+type TokenCounterFunc func(...*Message) int64
+
+// CountTokens implements the TokenCounter interface for TokenCounterFunc.
+func (f TokenCounterFunc) CountTokens(messages ...*Message) int64 {
+	return f(messages...)
+}
+
+const (
+	// heuristicCharsPerToken approximates the average token length of English text.
+	heuristicCharsPerToken = 4
+	// heuristicMessageOverhead approximates the per-message framing tokens.
+	heuristicMessageOverhead = 4
+	// heuristicBinaryTokens approximates the cost of a file or binary part.
+	heuristicBinaryTokens = 256
+)
+
+// HeuristicTokenCounter estimates tokens as one per four characters of text,
+// plus a fixed overhead per message and per file or binary part.
+var HeuristicTokenCounter TokenCounter = TokenCounterFunc(func(messages ...*Message) int64 {
+	var tokens int64
+	for _, m := range messages {
+		if m == nil {
+			continue
+		}
+		tokens += heuristicMessageOverhead
+		for _, part := range m.Parts {
+			switch v := part.(type) {
+			case TextPart:
+				tokens += charsToTokens(len(v.Text))
+			case ToolPart:
+				tokens += charsToTokens(len(v.Name) + len(v.Request) + len(v.Response))
+			case FilePart, DataPart:
+				tokens += heuristicBinaryTokens
+			}
+		}
+	}
+	return tokens
+})
+
+func charsToTokens(n int) int64 {
+	return int64((n + heuristicCharsPerToken - 1) / heuristicCharsPerToken)
+}
@@ -2,7 +2,9 @@ package blades
 
 import (
 	"context"
+	"errors"
 
+	"github.com/go-kratos/blades/stream"
 	"github.com/go-kratos/blades/tools"
 	"github.com/google/jsonschema-go/jsonschema"
 )
@@ -37,14 +39,25 @@ func (a *agentTool) OutputSchema() *jsonschema.Schema {
 	return nil
 }
 
-// Handle runs the underlying Agent with the given input and returns the output.
+// Handle runs the underlying Agent with the given input and returns its final output.
+// The call is a transfer from the calling agent, so that agents calling each
+// other as tools are stopped by the transfer depth and loop checks.
 func (a *agentTool) Handle(ctx context.Context, input string) (string, error) {
-	iter := a.Agent.Run(ctx, &Invocation{Message: UserMessage(input)})
-	for output, err := range iter {
-		if err != nil {
-			return "", err
-		}
-		return output.Text(), nil
+	var caller string
+	if agent, ok := FromAgentContext(ctx); ok {
+		caller = agent.Name()
 	}
-	return "", ErrNoFinalResponse
+	message := UserMessage(input)
+	ctx, err := Transfer(ctx, caller, a.Name(), message)
+	if err != nil {
+		return "", err
+	}
+	output, err := stream.Last(a.Agent.Run(ctx, &Invocation{Message: message}))
+	if errors.Is(err, stream.ErrEmpty) {
+		return "", ErrNoFinalResponse
+	}
+	if err != nil {
+		return "", err
+	}
+	return output.Text(), nil
 }
@@ -3,9 +3,14 @@ package tools
 import (
 	"context"
 
+	"github.com/go-kratos/blades/internal/panics"
 	"github.com/google/jsonschema-go/jsonschema"
 )
 
+// PanicError is the error returned for a panic in a node, tool or middleware
+// handler. It records the handler name, the panic value and the stack trace.
+type PanicError = panics.Error
+
 // Option defines a configuration option for a baseTool.
 type Option func(*baseTool)
 
@@ -38,6 +43,8 @@ type baseTool struct {
 	outputSchema *jsonschema.Schema
 	handler      Handler
 	middlewares  []Middleware
+	// sensitiveFields are the arguments masked in logs, traces and records.
+	sensitiveFields []string
 }
 
 func (t *baseTool) Name() string {
@@ -56,10 +63,19 @@ func (t *baseTool) OutputSchema() *jsonschema.Schema {
 	return t.outputSchema
 }
 
+func (t *baseTool) SensitiveFields() []string {
+	return t.sensitiveFields
+}
+
+// Handle runs the handler through the middlewares. A panic in the handler is
+// returned to the middlewares as a *PanicError.
 func (t *baseTool) Handle(ctx context.Context, input string) (string, error) {
-	handler := t.handler
+	var handler Handler = HandleFunc(func(ctx context.Context, input string) (result string, err error) {
+		defer panics.Recover("tool", t.name, &err)
+		return t.handler.Handle(ctx, input)
+	})
 	if len(t.middlewares) > 0 {
-		handler = ChainMiddlewares(t.middlewares...)(t.handler)
+		handler = ChainMiddlewares(t.middlewares...)(handler)
 	}
 	return handler.Handle(ctx, input)
 }
@@ -0,0 +1,38 @@
+package builtin
+
+import (
+	"context"
+
+	"github.com/go-kratos/blades/tools"
+)
+
+// CalculatorToolName is the name of the tool created by NewCalculatorTool.
+const CalculatorToolName = "calculator"
+
+// CalculatorRequest is the input of the calculator tool.
+type CalculatorRequest struct {
+	Expression string `json:"expression" jsonschema:"The arithmetic expression to evaluate, e.g. (1200 * 1.08 - 50) / 12 or sqrt(2) ^ 2. Supports + - * / % ^, parentheses, the constants pi and e, and the functions abs, sqrt, floor, ceil, trunc, round, min, max, pow, exp, ln, log10, log2, sin, cos, tan, asin, acos and atan."`
+}
+
+// CalculatorResponse is the output of the calculator tool.
+type CalculatorResponse struct {
+	Result string `json:"result,omitempty" jsonschema:"The value of the expression with up to 30 significant digits."`
+	Error  string `json:"error,omitempty" jsonschema:"Why the expression could not be evaluated, e.g. a division by zero; fix the expression and call the tool again."`
+}
+
+// NewCalculatorTool creates a tool that evaluates arithmetic expressions; see
+// Evaluate. An expression that cannot be evaluated is answered with an
+// error the model can correct, rather than failing the run.
+func NewCalculatorTool() (tools.Tool, error) {
+	return tools.NewFunc(
+		CalculatorToolName,
+		"Evaluate an arithmetic expression exactly. Use it for any calculation instead of computing the result yourself.",
+		func(ctx context.Context, req CalculatorRequest) (CalculatorResponse, error) {
+			value, err := Evaluate(req.Expression)
+			if err != nil {
+				return CalculatorResponse{Error: err.Error()}, nil
+			}
+			return CalculatorResponse{Result: FormatResult(value)}, nil
+		},
+	)
+}
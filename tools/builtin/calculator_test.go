@@ -0,0 +1,215 @@
+package builtin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		// Numbers.
+		{"0", "0"},
+		{"42", "42"},
+		{"3.25", "3.25"},
+		{".5", "0.5"},
+		{"1e3", "1000"},
+		{"2.5E-2", "0.025"},
+		{"007", "7"},
+		// Precedence and associativity.
+		{"1 + 2 * 3", "7"},
+		{"(1 + 2) * 3", "9"},
+		{"10 - 4 - 3", "3"},
+		{"100 / 10 / 5", "2"},
+		{"2 * 3 % 4", "2"},
+		{"7 % 4 * 3", "9"},
+		{"1 + 10 % 4", "3"},
+		{"2 ^ 3 ^ 2", "512"},
+		{"(2 ^ 3) ^ 2", "64"},
+		{"2 * 3 ^ 2", "18"},
+		{"-2 ^ 2", "-4"},
+		{"(-2) ^ 2", "4"},
+		{"2 ^ -1", "0.5"},
+		{"-3 - -3", "0"},
+		{"--3", "3"},
+		{"+-+3", "-3"},
+		{"((((1))))", "1"},
+		{" 1\t+\n2 ", "3"},
+		// Precision.
+		{"0.1 + 0.2", "0.3"},
+		{"1 / 3", "0.333333333333333333333333333333"},
+		{"2 / 3 * 3", "2"},
+		{"2 ^ 64", "18446744073709551616"},
+		{"2 ^ 100", "1.26765060022822940149670320538e+30"},
+		{"99999999999999999999 + 1", "100000000000000000000"},
+		{"1e-30 * 1e-30", "1e-60"},
+		{"0.000001 * 3", "3e-06"},
+		// Remainders take the sign of the dividend.
+		{"7 % 3", "1"},
+		{"-7 % 3", "-1"},
+		{"7 % -3", "1"},
+		{"5.5 % 2", "1.5"},
+		// Constants and functions.
+		{"pi", "3.14159265358979323846264338328"},
+		{"E", "2.71828182845904523536028747135"},
+		{"abs(-2.5)", "2.5"},
+		{"sqrt(16)", "4"},
+		{"sqrt(2) ^ 2", "2"},
+		{"sqrt(0)", "0"},
+		{"floor(2.7)", "2"},
+		{"floor(-2.2)", "-3"},
+		{"ceil(2.2)", "3"},
+		{"ceil(-2.7)", "-2"},
+		{"trunc(-2.7)", "-2"},
+		{"round(2.5)", "3"},
+		{"round(-2.5)", "-3"},
+		{"round(2.4999)", "2"},
+		{"min(3, 1, 2)", "1"},
+		{"max(3, 1, 2)", "3"},
+		{"max(-1)", "-1"},
+		{"pow(2, 10)", "1024"},
+		{"pow(4, 0.5)", "2"},
+		{"exp(0)", "1"},
+		{"ln(1)", "0"},
+		{"log10(1000)", "3"},
+		{"log2(8)", "3"},
+		{"sin(0)", "0"},
+		{"cos(0)", "1"},
+		{"atan(0)", "0"},
+		{"SQRT(9) + Max(1, 2)", "5"},
+		{"round(1200 * 1.08 - 50) / 12", "103.833333333333333333333333333"},
+		{"0 ^ 0", "1"},
+		{"0 ^ 2", "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			got, err := Evaluate(tt.expression)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s := FormatResult(got); s != tt.want {
+				t.Fatalf("Evaluate(%q) = %s, want %s", tt.expression, s, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		target     error
+		message    string
+		column     int
+	}{
+		{expression: "1 / 0", target: ErrDivisionByZero, column: 3},
+		{expression: "1 % 0", target: ErrDivisionByZero, column: 3},
+		{expression: "1 / (2 - 2)", target: ErrDivisionByZero, column: 3},
+		{expression: "0 ^ -1", target: ErrDivisionByZero, column: 3},
+		{expression: "0 ^ -0.5", target: ErrDivisionByZero, column: 3},
+		{expression: "10 ^ 10 ^ 10", target: ErrOverflow, column: 4},
+		{expression: "2 ^ 1e20", target: ErrOverflow, column: 3},
+		{expression: "(10 ^ 100000000) ^ 100000000", target: ErrOverflow, column: 18},
+		{expression: "1e999999999999", target: ErrOverflow, column: 1},
+		{expression: "exp(1000)", target: ErrOverflow, column: 1},
+		{expression: "sqrt(-1)", target: ErrDomain, column: 1},
+		{expression: "ln(0)", target: ErrDomain, column: 1},
+		{expression: "log10(-5)", target: ErrDomain, column: 1},
+		{expression: "asin(2)", target: ErrDomain, column: 1},
+		{expression: "(-8) ^ (1 / 3)", target: ErrDomain, column: 6},
+		{expression: "", message: "unexpected end of expression", column: 1},
+		{expression: "1 +", message: "unexpected end of expression", column: 4},
+		{expression: "(1 + 2", message: `expected ")"`, column: 7},
+		{expression: "1 + 2)", message: `unexpected ")"`, column: 6},
+		{expression: "1 2", message: `unexpected "2"`, column: 3},
+		{expression: "2 ** 3", message: `unexpected "*"`, column: 4},
+		{expression: "1 = 1", message: "unexpected character '='", column: 3},
+		{expression: "os.Exit(1)", message: "unexpected character '.'", column: 3},
+		{expression: "x + 1", message: `unknown constant "x"`, column: 1},
+		{expression: "system(1)", message: `unknown function "system"`, column: 1},
+		{expression: "sqrt()", message: "sqrt takes 1 argument, got 0", column: 1},
+		{expression: "sqrt(1, 2)", message: "sqrt takes 1 argument, got 2", column: 1},
+		{expression: "pow(2)", message: "pow takes 2 arguments, got 1", column: 1},
+		{expression: "min()", message: "min takes at least 1 arguments, got 0", column: 1},
+		{expression: "max(1 2)", message: `expected "," or ")"`, column: 7},
+		{expression: "1e", message: `unexpected "e"`, column: 2},
+		{expression: strings.Repeat("(", 100) + "1" + strings.Repeat(")", 100), message: "nested deeper than 64 levels", column: 65},
+		{expression: strings.Repeat("-", 100) + "1", message: "nested deeper than 64 levels", column: 65},
+		{expression: strings.Repeat("1+", 600) + "1", message: "longer than 1024 bytes", column: 1025},
+	}
+	for _, tt := range tests {
+		name := tt.expression
+		if len(name) > 40 {
+			name = name[:40]
+		}
+		t.Run(name, func(t *testing.T) {
+			_, err := Evaluate(tt.expression)
+			var evalErr *EvalError
+			if !errors.As(err, &evalErr) {
+				t.Fatalf("want an *EvalError, got %v", err)
+			}
+			if tt.target != nil && !errors.Is(err, tt.target) {
+				t.Fatalf("err = %v, want %v", err, tt.target)
+			}
+			if !strings.Contains(err.Error(), tt.message) {
+				t.Fatalf("err = %v, want %q", err, tt.message)
+			}
+			if evalErr.Column != tt.column {
+				t.Fatalf("column = %d, want %d: %v", evalErr.Column, tt.column, err)
+			}
+		})
+	}
+}
+
+func TestCalculatorTool(t *testing.T) {
+	tool, err := NewCalculatorTool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tool.Name() != CalculatorToolName || tool.InputSchema().Properties["expression"] == nil {
+		t.Fatalf("unexpected tool %s: %+v", tool.Name(), tool.InputSchema())
+	}
+	tests := []struct {
+		input string
+		want  CalculatorResponse
+	}{
+		{`{"expression":"(1200 * 1.08 - 50) / 12"}`, CalculatorResponse{Result: "103.833333333333333333333333333"}},
+		{`{"expression":"1 / 0"}`, CalculatorResponse{Error: "column 3: division by zero"}},
+	}
+	for _, tt := range tests {
+		out, err := tool.Handle(context.Background(), tt.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got CalculatorResponse
+		if err := json.Unmarshal([]byte(out), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Fatalf("Handle(%s) = %+v, want %+v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func FuzzEvaluate(f *testing.F) {
+	for _, seed := range []string{"1 + 2 * 3", "2 ^ 3 ^ 2", "sqrt(-1)", "max(1, 2, 3) % 0", "((1e308 * 1e308))", "-.5e-3"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, expression string) {
+		value, err := Evaluate(expression)
+		if err != nil {
+			var evalErr *EvalError
+			if !errors.As(err, &evalErr) {
+				t.Fatalf("want an *EvalError, got %v", err)
+			}
+			return
+		}
+		if value.IsInf() {
+			t.Fatalf("Evaluate(%q) is infinite", expression)
+		}
+	})
+}
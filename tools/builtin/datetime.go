@@ -0,0 +1,169 @@
+package builtin
+
+import (
+	"context"
+	"fmt"
+	"time"
+	// The time zone database is embedded so that the tool answers the same
+	// on hosts without one.
+	_ "time/tzdata"
+
+	"github.com/go-kratos/blades/tools"
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+// DateTimeToolName is the name of the tool created by NewDateTimeTool.
+const DateTimeToolName = "datetime"
+
+// Operations of the datetime tool.
+const (
+	DateTimeNow    = "now"
+	DateTimeAdd    = "add"
+	DateTimeDiff   = "diff"
+	DateTimeFormat = "format"
+)
+
+// layouts are the names the datetime tool accepts in place of a layout.
+var layouts = map[string]string{
+	"RFC3339":  time.RFC3339,
+	"RFC1123":  time.RFC1123,
+	"RFC822":   time.RFC822,
+	"date":     time.DateOnly,
+	"datetime": time.DateTime,
+	"time":     time.TimeOnly,
+	"kitchen":  time.Kitchen,
+}
+
+// DateTimeRequest is the input of the datetime tool.
+type DateTimeRequest struct {
+	Operation    string `json:"operation" jsonschema:"now: the current time; add: the time plus years, months, days and a duration; diff: the duration from the time until another; format: the time converted to the time zone and output layout."`
+	Timezone     string `json:"timezone,omitempty" jsonschema:"IANA time zone of the result and of the times without an offset, e.g. Europe/Paris. Defaults to UTC."`
+	Time         string `json:"time,omitempty" jsonschema:"The time to operate on, in the layout. Defaults to the current time."`
+	Until        string `json:"until,omitempty" jsonschema:"For diff, the end time, in the layout. Defaults to the current time."`
+	Layout       string `json:"layout,omitempty" jsonschema:"Layout of time and until: a Go reference layout such as 2006-01-02 15:04 or 02/01/2006, or one of RFC3339, RFC1123, RFC822, date, datetime, time and kitchen. Defaults to RFC3339."`
+	OutputLayout string `json:"outputLayout,omitempty" jsonschema:"Layout of the resulting time, like layout. Defaults to RFC3339."`
+	Years        int    `json:"years,omitempty" jsonschema:"For add, the years to add; negative to subtract."`
+	Months       int    `json:"months,omitempty" jsonschema:"For add, the months to add; negative to subtract."`
+	Days         int    `json:"days,omitempty" jsonschema:"For add, the days to add; negative to subtract."`
+	Duration     string `json:"duration,omitempty" jsonschema:"For add, a duration to add such as 1h30m or -45m, after the years, months and days."`
+}
+
+// DateTimeResponse is the output of the datetime tool.
+type DateTimeResponse struct {
+	Time     string `json:"time,omitempty" jsonschema:"The resulting time in the output layout."`
+	Weekday  string `json:"weekday,omitempty" jsonschema:"The day of the week of the resulting time."`
+	Unix     int64  `json:"unix,omitempty" jsonschema:"The resulting time in seconds since 1970-01-01 UTC."`
+	Duration string `json:"duration,omitempty" jsonschema:"For diff, the duration until the end time, e.g. 36h0m0s; negative if it is earlier."`
+	Days     int    `json:"days,omitempty" jsonschema:"For diff, the whole days until the end time."`
+	Error    string `json:"error,omitempty" jsonschema:"Why the request failed; fix the arguments and call the tool again."`
+}
+
+// DateTimeOption configures the datetime tool.
+type DateTimeOption func(*dateTime)
+
+// WithClock sets the clock the datetime tool reads the current time from,
+// e.g. a fixed time in tests. Defaults to time.Now.
+func WithClock(now func() time.Time) DateTimeOption {
+	return func(d *dateTime) {
+		d.now = now
+	}
+}
+
+// dateTime answers the requests of the datetime tool.
+type dateTime struct {
+	now func() time.Time
+}
+
+// NewDateTimeTool creates a tool that tells the current time in a time zone,
+// adds to dates, measures the time between two dates, and converts between
+// layouts. A request that fails, e.g. with an unknown time zone, is answered
+// with an error the model can correct, rather than failing the run.
+func NewDateTimeTool(opts ...DateTimeOption) (tools.Tool, error) {
+	d := &dateTime{now: time.Now}
+	for _, opt := range opts {
+		opt(d)
+	}
+	schema, err := jsonschema.For[DateTimeRequest](nil)
+	if err != nil {
+		return nil, err
+	}
+	schema.Properties["operation"].Enum = []any{DateTimeNow, DateTimeAdd, DateTimeDiff, DateTimeFormat}
+	return tools.NewFunc(
+		DateTimeToolName,
+		"Get the current date and time in a time zone, add to or subtract from a date, count the time between two dates, or reformat a date. Use it for any date calculation instead of computing the result yourself.",
+		func(ctx context.Context, req DateTimeRequest) (DateTimeResponse, error) {
+			res, err := d.handle(req)
+			if err != nil {
+				return DateTimeResponse{Error: err.Error()}, nil
+			}
+			return res, nil
+		},
+		tools.WithInputSchema(schema),
+	)
+}
+
+func (d *dateTime) handle(req DateTimeRequest) (DateTimeResponse, error) {
+	loc := time.UTC
+	if req.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(req.Timezone); err != nil {
+			return DateTimeResponse{}, fmt.Errorf("unknown time zone %q", req.Timezone)
+		}
+	}
+	layout := layoutOf(req.Layout)
+	t, err := d.parse(req.Time, layout, loc)
+	if err != nil {
+		return DateTimeResponse{}, fmt.Errorf("time: %w", err)
+	}
+	switch req.Operation {
+	case DateTimeNow, DateTimeFormat:
+	case DateTimeAdd:
+		t = t.AddDate(req.Years, req.Months, req.Days)
+		if req.Duration != "" {
+			duration, err := time.ParseDuration(req.Duration)
+			if err != nil {
+				return DateTimeResponse{}, fmt.Errorf("invalid duration %q, want e.g. 1h30m", req.Duration)
+			}
+			t = t.Add(duration)
+		}
+	case DateTimeDiff:
+		until, err := d.parse(req.Until, layout, loc)
+		if err != nil {
+			return DateTimeResponse{}, fmt.Errorf("until: %w", err)
+		}
+		duration := until.Sub(t)
+		return DateTimeResponse{Duration: duration.String(), Days: int(duration / (24 * time.Hour))}, nil
+	default:
+		return DateTimeResponse{}, fmt.Errorf("unknown operation %q, want one of now, add, diff and format", req.Operation)
+	}
+	t = t.In(loc)
+	return DateTimeResponse{
+		Time:    t.Format(layoutOf(req.OutputLayout)),
+		Weekday: t.Weekday().String(),
+		Unix:    t.Unix(),
+	}, nil
+}
+
+// parse parses the value in the layout, as a time of the location unless it
+// has an offset, or returns the current time for an empty value.
+func (d *dateTime) parse(value, layout string, loc *time.Location) (time.Time, error) {
+	if value == "" {
+		return d.now().In(loc), nil
+	}
+	t, err := time.ParseInLocation(layout, value, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot parse %q with layout %q", value, layout)
+	}
+	return t, nil
+}
+
+// layoutOf resolves the name of a layout, defaulting to RFC 3339.
+func layoutOf(name string) string {
+	if name == "" {
+		return time.RFC3339
+	}
+	if layout, ok := layouts[name]; ok {
+		return layout
+	}
+	return name
+}
@@ -0,0 +1,104 @@
+package builtin
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestDateTimeTool(t *testing.T) {
+	now := time.Date(2025, 3, 30, 0, 30, 0, 0, time.UTC)
+	tool, err := NewDateTimeTool(WithClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enum := tool.InputSchema().Properties["operation"].Enum; len(enum) != 4 {
+		t.Fatalf("operation enum = %v", enum)
+	}
+	tests := []struct {
+		name string
+		req  DateTimeRequest
+		want DateTimeResponse
+	}{
+		{
+			name: "now",
+			req:  DateTimeRequest{Operation: DateTimeNow},
+			want: DateTimeResponse{Time: "2025-03-30T00:30:00Z", Weekday: "Sunday", Unix: now.Unix()},
+		},
+		{
+			name: "now in a time zone",
+			req:  DateTimeRequest{Operation: DateTimeNow, Timezone: "Asia/Tokyo", OutputLayout: "datetime"},
+			want: DateTimeResponse{Time: "2025-03-30 09:30:00", Weekday: "Sunday", Unix: now.Unix()},
+		},
+		{
+			name: "add across a daylight saving change",
+			req:  DateTimeRequest{Operation: DateTimeAdd, Timezone: "Europe/Paris", Time: "2025-03-29 12:00", Layout: "2006-01-02 15:04", Days: 1},
+			want: DateTimeResponse{Time: "2025-03-30T12:00:00+02:00", Weekday: "Sunday", Unix: 1743328800},
+		},
+		{
+			name: "add months normalizes the day",
+			req:  DateTimeRequest{Operation: DateTimeAdd, Time: "2025-01-31", Layout: "date", OutputLayout: "date", Months: 1},
+			want: DateTimeResponse{Time: "2025-03-03", Weekday: "Monday", Unix: 1740960000},
+		},
+		{
+			name: "add a duration",
+			req:  DateTimeRequest{Operation: DateTimeAdd, Years: -1, Duration: "-90m"},
+			want: DateTimeResponse{Time: "2024-03-29T23:00:00Z", Weekday: "Friday", Unix: 1711753200},
+		},
+		{
+			name: "diff",
+			req:  DateTimeRequest{Operation: DateTimeDiff, Time: "2025-01-01", Until: "2025-03-01", Layout: "date"},
+			want: DateTimeResponse{Duration: "1416h0m0s", Days: 59},
+		},
+		{
+			name: "diff until now",
+			req:  DateTimeRequest{Operation: DateTimeDiff, Time: "2025-03-31T00:30:00Z"},
+			want: DateTimeResponse{Duration: "-24h0m0s", Days: -1},
+		},
+		{
+			name: "format",
+			req:  DateTimeRequest{Operation: DateTimeFormat, Time: "2025-07-04T18:00:00-04:00", Timezone: "Europe/London", OutputLayout: "Monday 2 January 2006 at 15:04 MST"},
+			want: DateTimeResponse{Time: "Friday 4 July 2025 at 23:00 BST", Weekday: "Friday", Unix: 1751666400},
+		},
+		{
+			name: "unknown time zone",
+			req:  DateTimeRequest{Operation: DateTimeNow, Timezone: "Mars/Olympus"},
+			want: DateTimeResponse{Error: `unknown time zone "Mars/Olympus"`},
+		},
+		{
+			name: "unparsable time",
+			req:  DateTimeRequest{Operation: DateTimeFormat, Time: "next tuesday"},
+			want: DateTimeResponse{Error: `time: cannot parse "next tuesday" with layout "2006-01-02T15:04:05Z07:00"`},
+		},
+		{
+			name: "invalid duration",
+			req:  DateTimeRequest{Operation: DateTimeAdd, Duration: "2 days"},
+			want: DateTimeResponse{Error: `invalid duration "2 days", want e.g. 1h30m`},
+		},
+		{
+			name: "unknown operation",
+			req:  DateTimeRequest{Operation: "sleep"},
+			want: DateTimeResponse{Error: `unknown operation "sleep", want one of now, add, diff and format`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, err := json.Marshal(tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := tool.Handle(context.Background(), string(input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got DateTimeResponse
+			if err := json.Unmarshal([]byte(out), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,9 @@
+// Package builtin provides tools that agents commonly need and models get
+// wrong on their own: a calculator that evaluates arithmetic exactly, and a
+// datetime tool for the current time, date arithmetic, parsing and
+// formatting.
+//
+// The tools compute their results in Go without running any code the model
+// provides, and answer the same arguments with the same result, given the
+// same clock, so that they can be recorded and replayed in tests.
+package builtin
@@ -0,0 +1,584 @@
+package builtin
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+const (
+	// precision is the mantissa precision of the evaluation, in bits.
+	precision = 256
+	// resultDigits is the number of significant digits of a formatted result.
+	resultDigits = 30
+	// maxExpressionLength caps the length of an expression, in bytes.
+	maxExpressionLength = 1024
+	// maxDepth caps the nesting of parentheses, calls and unary operators.
+	maxDepth = 64
+)
+
+var (
+	// ErrDivisionByZero is returned for a division or a remainder by zero.
+	ErrDivisionByZero = errors.New("division by zero")
+	// ErrOverflow is returned when a value exceeds the range of the evaluator.
+	ErrOverflow = errors.New("numeric overflow")
+	// ErrDomain is returned for a function called outside of its domain, e.g.
+	// the square root of a negative number.
+	ErrDomain = errors.New("argument out of domain")
+)
+
+// EvalError reports an expression that cannot be evaluated.
+type EvalError struct {
+	// Column is the 1-based byte column of the offending token.
+	Column int
+	Err    error
+}
+
+func (e *EvalError) Error() string {
+	return fmt.Sprintf("column %d: %v", e.Column, e.Err)
+}
+
+func (e *EvalError) Unwrap() error {
+	return e.Err
+}
+
+// constants are the named values of expressions, to 80 significant digits.
+var constants = map[string]string{
+	"pi": "3.1415926535897932384626433832795028841971693993751058209749445923078164062862090",
+	"e":  "2.7182818284590452353602874713526624977572470936999595749669676277240766303535476",
+}
+
+// function evaluates a function of expressions on its arguments.
+type function struct {
+	minArgs, maxArgs int // maxArgs < 0 means variadic
+	eval             func(args []*big.Float) (*big.Float, error)
+}
+
+var functions map[string]function
+
+func init() {
+	functions = map[string]function{
+		"abs":   {1, 1, func(a []*big.Float) (*big.Float, error) { return newFloat().Abs(a[0]), nil }},
+		"sqrt":  {1, 1, sqrt},
+		"floor": {1, 1, func(a []*big.Float) (*big.Float, error) { return roundTo(a[0], big.ToNegativeInf), nil }},
+		"ceil":  {1, 1, func(a []*big.Float) (*big.Float, error) { return roundTo(a[0], big.ToPositiveInf), nil }},
+		"trunc": {1, 1, func(a []*big.Float) (*big.Float, error) { return roundTo(a[0], big.ToZero), nil }},
+		"round": {1, 1, round},
+		"min":   {1, -1, func(a []*big.Float) (*big.Float, error) { return extreme(a, -1), nil }},
+		"max":   {1, -1, func(a []*big.Float) (*big.Float, error) { return extreme(a, 1), nil }},
+		"pow":   {2, 2, func(a []*big.Float) (*big.Float, error) { return power(a[0], a[1]) }},
+		"exp":   {1, 1, floatFunc(math.Exp, nil)},
+		"ln":    {1, 1, floatFunc(math.Log, positive)},
+		"log10": {1, 1, floatFunc(math.Log10, positive)},
+		"log2":  {1, 1, floatFunc(math.Log2, positive)},
+		"sin":   {1, 1, floatFunc(math.Sin, nil)},
+		"cos":   {1, 1, floatFunc(math.Cos, nil)},
+		"tan":   {1, 1, floatFunc(math.Tan, nil)},
+		"asin":  {1, 1, floatFunc(math.Asin, unit)},
+		"acos":  {1, 1, floatFunc(math.Acos, unit)},
+		"atan":  {1, 1, floatFunc(math.Atan, nil)},
+	}
+}
+
+// Evaluate computes the arithmetic expression with 256 bits of precision.
+// It supports numbers such as 2, 0.5 and 1e-3, the operators + - * / % and
+// ^ (power), parentheses, the constants pi and e, and the functions abs,
+// sqrt, floor, ceil, trunc, round, min, max, pow, exp, ln, log10, log2, sin,
+// cos, tan, asin, acos and atan. The transcendental functions and powers
+// with a fractional exponent are computed in float64 precision. Errors are
+// reported as an *EvalError wrapping ErrDivisionByZero, ErrOverflow or
+// ErrDomain, if any.
+func Evaluate(expression string) (*big.Float, error) {
+	if len(expression) > maxExpressionLength {
+		return nil, &EvalError{Column: maxExpressionLength + 1, Err: fmt.Errorf("expression longer than %d bytes", maxExpressionLength)}
+	}
+	tokens, err := lex(expression)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	value, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, p.errorf(t, "unexpected %s", t)
+	}
+	return value, nil
+}
+
+// FormatResult formats a value computed by Evaluate with 30 significant digits.
+func FormatResult(x *big.Float) string {
+	if x.Sign() == 0 {
+		return "0"
+	}
+	return x.Text('g', resultDigits)
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenIdent
+	tokenOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokenEOF {
+		return "end of expression"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// lex splits the expression into tokens.
+func lex(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isDigit(c) || (c == '.' && i+1 < len(src) && isDigit(src[i+1])):
+			start := i
+			for i < len(src) && isDigit(src[i]) {
+				i++
+			}
+			if i < len(src) && src[i] == '.' {
+				i++
+				for i < len(src) && isDigit(src[i]) {
+					i++
+				}
+			}
+			if i < len(src) && (src[i] == 'e' || src[i] == 'E') {
+				j := i + 1
+				if j < len(src) && (src[j] == '+' || src[j] == '-') {
+					j++
+				}
+				if j < len(src) && isDigit(src[j]) {
+					for i = j; i < len(src) && isDigit(src[i]); i++ {
+					}
+				}
+			}
+			tokens = append(tokens, token{tokenNumber, src[start:i], start})
+		case isLetter(c):
+			start := i
+			for i < len(src) && (isLetter(src[i]) || isDigit(src[i])) {
+				i++
+			}
+			tokens = append(tokens, token{tokenIdent, src[start:i], start})
+		case strings.IndexByte("+-*/%^(),", c) >= 0:
+			tokens = append(tokens, token{tokenOp, src[i : i+1], i})
+			i++
+		default:
+			return nil, &EvalError{Column: i + 1, Err: fmt.Errorf("unexpected character %q", rune(c))}
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(src)}), nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
+
+// parser evaluates the tokens by recursive descent:
+//
+//	expression = term { ( "+" | "-" ) term } .
+//	term       = unary { ( "*" | "/" | "%" ) unary } .
+//	unary      = ( "+" | "-" ) unary | power .
+//	power      = primary [ "^" unary ] .
+//	primary    = number | constant | call | "(" expression ")" .
+//	call       = identifier "(" expression { "," expression } ")" .
+type parser struct {
+	tokens []token
+	pos    int
+	depth  int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokenOp && t.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) errorf(t token, format string, args ...any) error {
+	return &EvalError{Column: t.pos + 1, Err: fmt.Errorf(format, args...)}
+}
+
+// fail wraps the error of the operation at the token.
+func (p *parser) fail(t token, err error) error {
+	return &EvalError{Column: t.pos + 1, Err: err}
+}
+
+// enter guards the nesting of the expression.
+func (p *parser) enter(t token) error {
+	p.depth++
+	if p.depth > maxDepth {
+		return p.errorf(t, "expression nested deeper than %d levels", maxDepth)
+	}
+	return nil
+}
+
+func (p *parser) expression() (*big.Float, error) {
+	x, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if !p.accept("+") && !p.accept("-") {
+			return x, nil
+		}
+		y, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		if t.text == "+" {
+			x = newFloat().Add(x, y)
+		} else {
+			x = newFloat().Sub(x, y)
+		}
+		if err := finite(x); err != nil {
+			return nil, p.fail(t, err)
+		}
+	}
+}
+
+func (p *parser) term() (*big.Float, error) {
+	x, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if !p.accept("*") && !p.accept("/") && !p.accept("%") {
+			return x, nil
+		}
+		y, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		switch t.text {
+		case "*":
+			x = newFloat().Mul(x, y)
+		case "/":
+			if y.Sign() == 0 {
+				return nil, p.fail(t, ErrDivisionByZero)
+			}
+			x = newFloat().Quo(x, y)
+		case "%":
+			if y.Sign() == 0 {
+				return nil, p.fail(t, ErrDivisionByZero)
+			}
+			x = remainder(x, y)
+		}
+		if err := finite(x); err != nil {
+			return nil, p.fail(t, err)
+		}
+	}
+}
+
+func (p *parser) unary() (*big.Float, error) {
+	t := p.peek()
+	if !p.accept("-") && !p.accept("+") {
+		return p.power()
+	}
+	if err := p.enter(t); err != nil {
+		return nil, err
+	}
+	defer func() { p.depth-- }()
+	x, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	if t.text == "-" {
+		x = newFloat().Neg(x)
+	}
+	return x, nil
+}
+
+func (p *parser) power() (*big.Float, error) {
+	x, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if !p.accept("^") {
+		return x, nil
+	}
+	if err := p.enter(t); err != nil {
+		return nil, err
+	}
+	defer func() { p.depth-- }()
+	// The exponent binds to the right, so 2^3^2 is 2^9, and -2^2 is -4.
+	y, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	z, err := power(x, y)
+	if err != nil {
+		return nil, p.fail(t, err)
+	}
+	return z, nil
+}
+
+func (p *parser) primary() (*big.Float, error) {
+	t := p.next()
+	switch {
+	case t.kind == tokenNumber:
+		// The lexer only accepts well-formed numbers, so that parsing fails
+		// for exponents out of range only.
+		x, _, err := big.ParseFloat(t.text, 10, precision, big.ToNearestEven)
+		if err != nil {
+			return nil, p.fail(t, ErrOverflow)
+		}
+		if err := finite(x); err != nil {
+			return nil, p.fail(t, err)
+		}
+		return x, nil
+	case t.kind == tokenOp && t.text == "(":
+		if err := p.enter(t); err != nil {
+			return nil, err
+		}
+		defer func() { p.depth-- }()
+		x, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, p.errorf(p.peek(), "expected \")\", got %s", p.peek())
+		}
+		return x, nil
+	case t.kind == tokenIdent:
+		name := strings.ToLower(t.text)
+		if p.peek().kind == tokenOp && p.peek().text == "(" {
+			return p.call(t, name)
+		}
+		if value, ok := constants[name]; ok {
+			x, _, _ := big.ParseFloat(value, 10, precision, big.ToNearestEven)
+			return x, nil
+		}
+		return nil, p.errorf(t, "unknown constant %s", t)
+	}
+	return nil, p.errorf(t, "unexpected %s", t)
+}
+
+func (p *parser) call(t token, name string) (*big.Float, error) {
+	fn, ok := functions[name]
+	if !ok {
+		return nil, p.errorf(t, "unknown function %s", t)
+	}
+	if err := p.enter(t); err != nil {
+		return nil, err
+	}
+	defer func() { p.depth-- }()
+	p.next() // (
+	var args []*big.Float
+	if !p.accept(")") {
+		for {
+			x, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, x)
+			if p.accept(")") {
+				break
+			}
+			if !p.accept(",") {
+				return nil, p.errorf(p.peek(), "expected \",\" or \")\", got %s", p.peek())
+			}
+		}
+	}
+	if len(args) < fn.minArgs || (fn.maxArgs >= 0 && len(args) > fn.maxArgs) {
+		return nil, p.errorf(t, "%s takes %s, got %d", name, arity(fn), len(args))
+	}
+	x, err := fn.eval(args)
+	if err != nil {
+		return nil, p.fail(t, fmt.Errorf("%s: %w", name, err))
+	}
+	if err := finite(x); err != nil {
+		return nil, p.fail(t, fmt.Errorf("%s: %w", name, err))
+	}
+	return x, nil
+}
+
+func arity(fn function) string {
+	switch {
+	case fn.maxArgs < 0:
+		return fmt.Sprintf("at least %d arguments", fn.minArgs)
+	case fn.minArgs == 1 && fn.maxArgs == 1:
+		return "1 argument"
+	default:
+		return fmt.Sprintf("%d arguments", fn.minArgs)
+	}
+}
+
+func newFloat() *big.Float {
+	return new(big.Float).SetPrec(precision)
+}
+
+// finite returns ErrOverflow for an infinite value, which a big.Float
+// reaches when its exponent overflows.
+func finite(x *big.Float) error {
+	if x.IsInf() {
+		return ErrOverflow
+	}
+	return nil
+}
+
+// remainder returns x - y*trunc(x/y), which has the sign of x.
+func remainder(x, y *big.Float) *big.Float {
+	q := roundTo(newFloat().Quo(x, y), big.ToZero)
+	return newFloat().Sub(x, newFloat().Mul(y, q))
+}
+
+// roundTo rounds x to an integer in the mode.
+func roundTo(x *big.Float, mode big.RoundingMode) *big.Float {
+	if x.IsInt() {
+		return newFloat().Set(x)
+	}
+	i, _ := x.Int(nil) // truncated toward zero
+	z := newFloat().SetInt(i)
+	switch {
+	case mode == big.ToNegativeInf && x.Sign() < 0:
+		z.Sub(z, big.NewFloat(1))
+	case mode == big.ToPositiveInf && x.Sign() > 0:
+		z.Add(z, big.NewFloat(1))
+	}
+	return z
+}
+
+// round rounds half away from zero.
+func round(a []*big.Float) (*big.Float, error) {
+	half := big.NewFloat(0.5)
+	if a[0].Sign() < 0 {
+		half.Neg(half)
+	}
+	return roundTo(newFloat().Add(a[0], half), big.ToZero), nil
+}
+
+func sqrt(a []*big.Float) (*big.Float, error) {
+	if a[0].Sign() < 0 {
+		return nil, ErrDomain
+	}
+	if a[0].Sign() == 0 {
+		return newFloat(), nil
+	}
+	return newFloat().Sqrt(a[0]), nil
+}
+
+// extreme returns the smallest argument for a negative sign, the largest otherwise.
+func extreme(a []*big.Float, sign int) *big.Float {
+	x := a[0]
+	for _, y := range a[1:] {
+		if y.Cmp(x) == sign {
+			x = y
+		}
+	}
+	return newFloat().Set(x)
+}
+
+// maxIntExponent caps the integer exponents computed exactly; larger ones
+// overflow or underflow anyway.
+const maxIntExponent = 1 << 32
+
+// power returns x^y, exactly for integer exponents.
+func power(x, y *big.Float) (*big.Float, error) {
+	if y.IsInt() && newFloat().Abs(y).Cmp(big.NewFloat(maxIntExponent)) <= 0 {
+		n, _ := y.Int64()
+		if n < 0 {
+			if x.Sign() == 0 {
+				return nil, ErrDivisionByZero
+			}
+			x, n = newFloat().Quo(big.NewFloat(1), x), -n
+		}
+		z := newFloat().SetInt64(1)
+		base := newFloat().Set(x)
+		for ; n > 0; n >>= 1 {
+			if n&1 == 1 {
+				z.Mul(z, base)
+			}
+			if z.IsInf() {
+				return nil, ErrOverflow
+			}
+			if n > 1 {
+				base.Mul(base, base)
+				if base.IsInf() {
+					return nil, ErrOverflow
+				}
+			}
+		}
+		return z, nil
+	}
+	if x.Sign() < 0 {
+		return nil, fmt.Errorf("%w: fractional power of a negative number", ErrDomain)
+	}
+	if x.Sign() == 0 {
+		if y.Sign() < 0 {
+			return nil, ErrDivisionByZero
+		}
+		return newFloat(), nil
+	}
+	fx, _ := x.Float64()
+	fy, _ := y.Float64()
+	return fromFloat64(math.Pow(fx, fy))
+}
+
+// floatFunc computes a function in float64 precision, checking its argument
+// against the domain, if any.
+func floatFunc(fn func(float64) float64, domain func(float64) bool) func([]*big.Float) (*big.Float, error) {
+	return func(a []*big.Float) (*big.Float, error) {
+		x, _ := a[0].Float64()
+		if math.IsInf(x, 0) {
+			return nil, ErrOverflow
+		}
+		if domain != nil && !domain(x) {
+			return nil, ErrDomain
+		}
+		return fromFloat64(fn(x))
+	}
+}
+
+func fromFloat64(x float64) (*big.Float, error) {
+	switch {
+	case math.IsNaN(x):
+		return nil, ErrDomain
+	case math.IsInf(x, 0):
+		return nil, ErrOverflow
+	}
+	return newFloat().SetFloat64(x), nil
+}
+
+func positive(x float64) bool {
+	return x > 0
+}
+
+func unit(x float64) bool {
+	return x >= -1 && x <= 1
+}
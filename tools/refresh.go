@@ -0,0 +1,114 @@
+package tools
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// Source provides a set of tools and its version. A source may also implement
+//
+//	Watch() <-chan struct{}
+//
+// to signal changes, in which case the tools are only got again after a
+// signal; otherwise they are got on every resolve.
+type Source interface {
+	Get(ctx context.Context) (tools []Tool, version string, err error)
+}
+
+// SourceFunc is an adapter to allow the use of ordinary functions as Sources.
+type SourceFunc func(ctx context.Context) ([]Tool, string, error)
+
+// Get calls f.
+func (f SourceFunc) Get(ctx context.Context) ([]Tool, string, error) {
+	return f(ctx)
+}
+
+// RefreshableResolver is a Resolver over a Source that swaps in the tools of
+// the source atomically when their version changes, or on every get if the
+// version is empty. Invocations that already resolved their tools keep them.
+type RefreshableResolver struct {
+	source  Source
+	watch   <-chan struct{}
+	pending atomic.Int64 // watch signals not refreshed yet
+	mu      sync.Mutex   // serializes refreshes
+	current atomic.Pointer[toolSet]
+}
+
+// toolSet is a version of the tools of a source.
+type toolSet struct {
+	tools   []Tool
+	version string
+}
+
+// NewRefreshableResolver returns a resolver of the tools of the source.
+func NewRefreshableResolver(source Source) *RefreshableResolver {
+	r := &RefreshableResolver{source: source}
+	if w, ok := source.(interface{ Watch() <-chan struct{} }); ok {
+		r.watch = w.Watch()
+	}
+	return r
+}
+
+// Resolve returns the current tools, after getting them from the source if
+// they may have changed.
+func (r *RefreshableResolver) Resolve(ctx context.Context) ([]Tool, error) {
+	set := r.current.Load()
+	pending, changed := r.changed()
+	if set == nil || changed {
+		var err error
+		if set, err = r.refresh(ctx, pending); err != nil {
+			return nil, err
+		}
+	}
+	return slices.Clone(set.tools), nil
+}
+
+// Refresh gets the tools from the source now.
+func (r *RefreshableResolver) Refresh(ctx context.Context) error {
+	_, err := r.refresh(ctx, r.pending.Load())
+	return err
+}
+
+// Version returns the version of the current tools.
+func (r *RefreshableResolver) Version() string {
+	if set := r.current.Load(); set != nil {
+		return set.version
+	}
+	return ""
+}
+
+// changed reports whether the tools of the source may have changed, with
+// the count of pending watch signals. A signal stays pending until a refresh
+// succeeds, so that a failed refresh is retried on the next resolve.
+func (r *RefreshableResolver) changed() (int64, bool) {
+	if r.watch == nil {
+		return 0, true
+	}
+	select {
+	case <-r.watch:
+		r.pending.Add(1)
+	default:
+	}
+	pending := r.pending.Load()
+	return pending, pending > 0
+}
+
+// refresh gets the tools from the source and clears the pending signals
+// seen before, keeping those received meanwhile for the next resolve.
+func (r *RefreshableResolver) refresh(ctx context.Context, pending int64) (*toolSet, error) {
+	tools, version, err := r.source.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer r.pending.CompareAndSwap(pending, 0)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if current := r.current.Load(); current != nil && version != "" && current.version == version {
+		return current, nil
+	}
+	set := &toolSet{tools: slices.Clone(tools), version: version}
+	r.current.Store(set)
+	return set, nil
+}
@@ -0,0 +1,92 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRefreshableResolver(t *testing.T) {
+	newTool := func(name string) Tool {
+		return NewTool(name, "", HandleFunc(func(ctx context.Context, input string) (string, error) {
+			return "", nil
+		}))
+	}
+	version, gets := "v1", 0
+	var fail error
+	resolver := NewRefreshableResolver(SourceFunc(func(ctx context.Context) ([]Tool, string, error) {
+		gets++
+		if fail != nil {
+			return nil, "", fail
+		}
+		return []Tool{newTool("search_" + version)}, version, nil
+	}))
+	resolve := func() string {
+		t.Helper()
+		tools, err := resolver.Resolve(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tools[0].Name()
+	}
+	if got := resolve(); got != "search_v1" || resolver.Version() != "v1" {
+		t.Fatalf("want v1, got %q at %q", got, resolver.Version())
+	}
+	version = "v2"
+	if got := resolve(); got != "search_v2" || resolver.Version() != "v2" || gets != 2 {
+		t.Fatalf("want v2, got %q at %q after %d gets", got, resolver.Version(), gets)
+	}
+	fail = errors.New("unavailable")
+	if _, err := resolver.Resolve(context.Background()); !errors.Is(err, fail) {
+		t.Fatalf("want the source error, got %v", err)
+	}
+	if resolver.Version() != "v2" {
+		t.Fatalf("want v2 kept after a failed refresh, got %q", resolver.Version())
+	}
+}
+
+// watchedSource only changes after a signal.
+type watchedSource struct {
+	SourceFunc
+	changes chan struct{}
+}
+
+func (s *watchedSource) Watch() <-chan struct{} {
+	return s.changes
+}
+
+func TestRefreshableResolverWatch(t *testing.T) {
+	version, gets := "v1", 0
+	var fail error
+	source := &watchedSource{changes: make(chan struct{}, 1)}
+	source.SourceFunc = func(ctx context.Context) ([]Tool, string, error) {
+		gets++
+		if fail != nil {
+			return nil, "", fail
+		}
+		return []Tool{NewTool("search_"+version, "", HandleFunc(func(ctx context.Context, input string) (string, error) {
+			return "", nil
+		}))}, version, nil
+	}
+	resolver := NewRefreshableResolver(source)
+	if _, err := resolver.Resolve(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	version = "v2"
+	if _, err := resolver.Resolve(context.Background()); err != nil || resolver.Version() != "v1" || gets != 1 {
+		t.Fatalf("want v1 kept until a signal, got %q after %d gets", resolver.Version(), gets)
+	}
+	// A failed refresh keeps the signal for the next resolve.
+	fail = errors.New("unavailable")
+	source.changes <- struct{}{}
+	if _, err := resolver.Resolve(context.Background()); !errors.Is(err, fail) {
+		t.Fatalf("want the source error, got %v", err)
+	}
+	fail = nil
+	if _, err := resolver.Resolve(context.Background()); err != nil || resolver.Version() != "v2" || gets != 3 {
+		t.Fatalf("want v2 after a retried refresh, got %q after %d gets", resolver.Version(), gets)
+	}
+	if _, err := resolver.Resolve(context.Background()); err != nil || gets != 3 {
+		t.Fatalf("want no refresh without a signal, got %d gets", gets)
+	}
+}
@@ -0,0 +1,153 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Mask replaces the values of sensitive arguments.
+const Mask = "[REDACTED]"
+
+// pointerEscaper escapes a key for a JSON pointer, as of RFC 6901.
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// SensitiveTool is implemented by tools whose arguments carry sensitive
+// values, such as API tokens or customer emails, which are masked wherever
+// the tool calls are logged, traced or recorded.
+type SensitiveTool interface {
+	Tool
+	// SensitiveFields returns the sensitive fields; see MaskArguments.
+	SensitiveFields() []string
+}
+
+// WithSensitiveFields marks the arguments of the tool as sensitive; see MaskArguments.
+func WithSensitiveFields(fields ...string) Option {
+	return func(t *baseTool) {
+		t.sensitiveFields = append(t.sensitiveFields, fields...)
+	}
+}
+
+// MarkSensitive returns the tool with the fields added to its sensitive
+// fields, e.g. for tools resolved from a server whose schemas are not
+// authored locally.
+func MarkSensitive(tool Tool, fields ...string) Tool {
+	if len(fields) == 0 {
+		return tool
+	}
+	return &sensitiveTool{Tool: tool, fields: slices.Concat(SensitiveFields(tool), fields)}
+}
+
+// SensitiveFields returns the sensitive fields of the tool, if any.
+func SensitiveFields(tool Tool) []string {
+	if t, ok := tool.(SensitiveTool); ok {
+		return t.SensitiveFields()
+	}
+	return nil
+}
+
+// sensitiveTool is a tool marked sensitive by MarkSensitive.
+type sensitiveTool struct {
+	Tool
+	fields []string
+}
+
+// SensitiveFields returns the sensitive fields of the tool.
+func (t *sensitiveTool) SensitiveFields() []string {
+	return t.fields
+}
+
+// MaskArguments returns the JSON arguments with the values of the fields
+// replaced by Mask, keeping the structure and the order of the keys. A field
+// is either a JSON pointer, e.g. "/user/email", matching that value only, or
+// a name, e.g. "token", matching keys of any object case-insensitively.
+// Arguments that are not valid JSON are masked as a whole.
+func MaskArguments(arguments string, fields ...string) string {
+	if len(fields) == 0 || arguments == "" {
+		return arguments
+	}
+	dec := json.NewDecoder(strings.NewReader(arguments))
+	dec.UseNumber()
+	var buf bytes.Buffer
+	if err := maskValue(dec, &buf, "", fields); err != nil {
+		return Mask
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return Mask
+	}
+	return buf.String()
+}
+
+// maskValue copies the next value of the decoder to buf, masking the fields.
+func maskValue(dec *json.Decoder, buf *bytes.Buffer, pointer string, fields []string) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	delim, ok := token.(json.Delim)
+	if !ok {
+		data, err := json.Marshal(token)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		return nil
+	}
+	var end byte = ']'
+	if delim == '{' {
+		end = '}'
+	}
+	buf.WriteByte(byte(delim))
+	for i := 0; dec.More(); i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name := strconv.Itoa(i)
+		if delim == '{' {
+			token, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			name, _ = token.(string)
+			key, _ := json.Marshal(name)
+			buf.Write(key)
+			buf.WriteByte(':')
+		}
+		child := pointer + "/" + pointerEscaper.Replace(name)
+		if !sensitive(fields, delim == '{', name, child) {
+			if err := maskValue(dec, buf, child, fields); err != nil {
+				return err
+			}
+			continue
+		}
+		var skipped json.RawMessage
+		if err := dec.Decode(&skipped); err != nil {
+			return err
+		}
+		buf.WriteString(strconv.Quote(Mask))
+	}
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	buf.WriteByte(end)
+	return nil
+}
+
+// sensitive reports whether the value at the pointer, named name in its
+// object if key is set, matches any of the fields.
+func sensitive(fields []string, key bool, name, pointer string) bool {
+	for _, field := range fields {
+		if strings.HasPrefix(field, "/") {
+			if field == pointer {
+				return true
+			}
+		} else if key && strings.EqualFold(field, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -3,6 +3,8 @@ package tools
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/google/jsonschema-go/jsonschema"
@@ -143,3 +145,69 @@ func TestJSONAdapter(t *testing.T) {
 		t.Fatalf("unexpected greet: %s", got.Greet)
 	}
 }
+
+func TestToolPanic(t *testing.T) {
+	var seen error
+	observe := func(next Handler) Handler {
+		return HandleFunc(func(ctx context.Context, input string) (string, error) {
+			result, err := next.Handle(ctx, input)
+			seen = err
+			return result, err
+		})
+	}
+	tool := NewTool("divide", "Divides by zero.", HandleFunc(func(ctx context.Context, input string) (string, error) {
+		var values []int
+		return fmt.Sprint(values[1]), nil
+	}), WithMiddleware(observe))
+
+	_, err := tool.Handle(context.Background(), "{}")
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) {
+		t.Fatalf("Expected a PanicError, got %v", err)
+	}
+	if panicErr.Scope != "tool" || panicErr.Name != "divide" || len(panicErr.Stack) == 0 {
+		t.Errorf("Unexpected panic error: %+v", panicErr)
+	}
+	if seen != err {
+		t.Errorf("Expected the middleware to see the panic error, got %v", seen)
+	}
+}
+
+func TestMaskArguments(t *testing.T) {
+	tests := []struct {
+		name      string
+		arguments string
+		fields    []string
+		want      string
+	}{
+		{"none", `{"token":"s3cr3t"}`, nil, `{"token":"s3cr3t"}`},
+		{"name", `{"user":"ann","Token":"s3cr3t","n":1.50}`, []string{"token"}, `{"user":"ann","Token":"[REDACTED]","n":1.50}`},
+		{"nested", `{"auth":{"token":{"value":"s3cr3t"}},"items":[{"token":"a"},{"token":"b"}]}`, []string{"token"}, `{"auth":{"token":"[REDACTED]"},"items":[{"token":"[REDACTED]"},{"token":"[REDACTED]"}]}`},
+		{"pointer", `{"user":{"email":"ann@example.com"},"email":"kept"}`, []string{"/user/email"}, `{"user":{"email":"[REDACTED]"},"email":"kept"}`},
+		{"index", `{"emails":["a@example.com","b@example.com"]}`, []string{"/emails/1"}, `{"emails":["a@example.com","[REDACTED]"]}`},
+		{"escaped", `{"a/b":{"c~d":"x"}}`, []string{"/a~1b/c~0d"}, `{"a/b":{"c~d":"[REDACTED]"}}`},
+		{"whitespace", "{\n  \"password\": \"hunter2\",\n  \"ok\": true\n}", []string{"password"}, `{"password":"[REDACTED]","ok":true}`},
+		{"invalid", `{"password":"hunter2"`, []string{"password"}, Mask},
+		{"trailing", `{"password":"hunter2"} {}`, []string{"password"}, Mask},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MaskArguments(tt.arguments, tt.fields...); got != tt.want {
+				t.Fatalf("want %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMarkSensitive(t *testing.T) {
+	tool := NewTool("login", "Logs in", HandleFunc(func(ctx context.Context, input string) (string, error) {
+		return input, nil
+	}), WithSensitiveFields("password"))
+	marked := MarkSensitive(tool, "token")
+	if got := SensitiveFields(marked); len(got) != 2 || got[0] != "password" || got[1] != "token" {
+		t.Fatalf("want both fields, got %v", got)
+	}
+	if marked.Name() != "login" {
+		t.Fatalf("want the tool kept, got %s", marked.Name())
+	}
+}
@@ -0,0 +1,90 @@
+package toolstest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/go-kratos/blades"
+)
+
+// ErrScriptExhausted is returned by a ScriptedModel called after its last turn.
+var ErrScriptExhausted = errors.New("toolstest: script exhausted")
+
+var _ blades.ModelProvider = (*ScriptedModel)(nil)
+
+// ScriptedModel is a model answering with scripted turns, in order, so that an
+// agent can be driven through a conversation with tool calls end to end.
+// It is safe for concurrent use.
+type ScriptedModel struct {
+	mu       sync.Mutex
+	turns    []*blades.Message
+	requests []*blades.ModelRequest
+}
+
+// NewScriptedModel returns a model answering with the turns, e.g. built with
+// CallTool and Answer.
+func NewScriptedModel(turns ...*blades.Message) *ScriptedModel {
+	return &ScriptedModel{turns: turns}
+}
+
+// CallTool returns a turn calling the tool with the arguments marshalled as
+// JSON, or used as is if they are a string. It panics if the arguments cannot
+// be marshalled.
+func CallTool(name string, args any) *blades.Message {
+	input, ok := args.(string)
+	if !ok {
+		b, err := json.Marshal(args)
+		if err != nil {
+			panic(fmt.Sprintf("toolstest: marshal arguments: %v", err))
+		}
+		input = string(b)
+	}
+	return &blades.Message{
+		ID:     blades.NewMessageID(),
+		Role:   blades.RoleTool,
+		Status: blades.StatusCompleted,
+		Parts:  []blades.Part{blades.ToolPart{ID: "call_" + blades.NewMessageID(), Name: name, Request: input}},
+	}
+}
+
+// Answer returns a turn answering the text.
+func Answer(text string) *blades.Message {
+	message := blades.NewAssistantMessage(blades.StatusCompleted)
+	message.Parts = blades.Parts(text)
+	return message
+}
+
+// Name returns the name of the model.
+func (m *ScriptedModel) Name() string {
+	return "scripted"
+}
+
+// Generate records the request and answers with the next turn.
+func (m *ScriptedModel) Generate(ctx context.Context, req *blades.ModelRequest) (*blades.ModelResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests = append(m.requests, req)
+	if len(m.turns) == 0 {
+		return nil, ErrScriptExhausted
+	}
+	turn := m.turns[0].Clone()
+	m.turns = m.turns[1:]
+	return &blades.ModelResponse{Message: turn}, nil
+}
+
+// NewStreaming answers with the next turn in a single response.
+func (m *ScriptedModel) NewStreaming(ctx context.Context, req *blades.ModelRequest) blades.Generator[*blades.ModelResponse, error] {
+	return func(yield func(*blades.ModelResponse, error) bool) {
+		yield(m.Generate(ctx, req))
+	}
+}
+
+// Requests returns the requests the model received.
+func (m *ScriptedModel) Requests() []*blades.ModelRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*blades.ModelRequest(nil), m.requests...)
+}
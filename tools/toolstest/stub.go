@@ -0,0 +1,245 @@
+// Package toolstest provides test doubles for tools: stubs that return
+// scripted responses and record their calls, and a scripted model to drive an
+// agent through a conversation with tool calls.
+package toolstest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/blades/tools"
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+var _ tools.Tool = (*Stub)(nil)
+
+// Response is a scripted response of a Stub.
+type Response struct {
+	// Output is the result of the call.
+	Output string
+	// Err fails the call.
+	Err error
+	// Delay is how long the call takes; the call fails with the context
+	// error if the context ends first.
+	Delay time.Duration
+	// Match restricts the response to the calls whose arguments it accepts.
+	Match func(args map[string]any) bool
+}
+
+// Return returns a response with the output.
+func Return(output string) Response {
+	return Response{Output: output}
+}
+
+// ReturnJSON returns a response with v marshalled as JSON. It panics if v
+// cannot be marshalled.
+func ReturnJSON(v any) Response {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("toolstest: marshal response: %v", err))
+	}
+	return Response{Output: string(b)}
+}
+
+// Fail returns a response failing the call with err.
+func Fail(err error) Response {
+	return Response{Err: err}
+}
+
+// When returns the response restricted to the calls whose arguments match.
+func (r Response) When(match func(args map[string]any) bool) Response {
+	r.Match = match
+	return r
+}
+
+// After returns the response delayed by d.
+func (r Response) After(d time.Duration) Response {
+	r.Delay = d
+	return r
+}
+
+// Call is a recorded call of a Stub.
+type Call struct {
+	// Input is the raw arguments of the call.
+	Input string
+	// Args are the arguments parsed as a JSON object, or nil if they are not one.
+	Args map[string]any
+	// Output and Err are what the stub returned.
+	Output string
+	Err    error
+}
+
+// Stub is a tool that returns scripted responses and records its calls.
+// It is safe for concurrent use.
+type Stub struct {
+	name        string
+	description string
+	matched     []Response
+	sequence    []Response
+
+	mu    sync.Mutex
+	next  int
+	calls []Call
+}
+
+// NewStub returns a tool answering with the responses. Responses with a Match
+// answer the calls whose arguments they match, the first one winning; the
+// other calls get the remaining responses in order, one per call, the last
+// one repeating. A call no response answers fails.
+func NewStub(name, description string, responses ...Response) *Stub {
+	s := &Stub{name: name, description: description}
+	for _, r := range responses {
+		if r.Match != nil {
+			s.matched = append(s.matched, r)
+		} else {
+			s.sequence = append(s.sequence, r)
+		}
+	}
+	return s
+}
+
+// Name returns the name of the tool.
+func (s *Stub) Name() string {
+	return s.name
+}
+
+// Description returns the description of the tool.
+func (s *Stub) Description() string {
+	return s.description
+}
+
+// InputSchema returns an object schema accepting any arguments.
+func (s *Stub) InputSchema() *jsonschema.Schema {
+	return &jsonschema.Schema{Type: "object"}
+}
+
+// OutputSchema returns nil.
+func (s *Stub) OutputSchema() *jsonschema.Schema {
+	return nil
+}
+
+// Handle answers the call with the scripted response and records it.
+func (s *Stub) Handle(ctx context.Context, input string) (string, error) {
+	var args map[string]any
+	if err := json.Unmarshal([]byte(input), &args); err != nil {
+		args = nil
+	}
+	response, ok := s.respond(args)
+	if !ok {
+		response.Err = fmt.Errorf("toolstest: no response for call %d of %s with %s", len(s.Calls())+1, s.name, input)
+	}
+	if response.Delay > 0 {
+		timer := time.NewTimer(response.Delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			response = Response{Err: ctx.Err()}
+		}
+	}
+	s.mu.Lock()
+	s.calls = append(s.calls, Call{Input: input, Args: args, Output: response.Output, Err: response.Err})
+	s.mu.Unlock()
+	if response.Err != nil {
+		return "", response.Err
+	}
+	return response.Output, nil
+}
+
+// respond returns the response to a call with the arguments.
+func (s *Stub) respond(args map[string]any) (Response, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.matched {
+		if args != nil && r.Match(args) {
+			return r, true
+		}
+	}
+	if len(s.sequence) == 0 {
+		return Response{}, false
+	}
+	r := s.sequence[min(s.next, len(s.sequence)-1)]
+	s.next++
+	return r, true
+}
+
+// Calls returns the calls of the stub, in the order they ended.
+func (s *Stub) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Call(nil), s.calls...)
+}
+
+// CalledTimes reports whether the stub was called n times, and fails t otherwise.
+func (s *Stub) CalledTimes(t testing.TB, n int) bool {
+	t.Helper()
+	calls := s.Calls()
+	if len(calls) != n {
+		t.Errorf("tool %s: want %d calls, got %d%s", s.name, n, len(calls), formatCalls(calls))
+		return false
+	}
+	return true
+}
+
+// NeverCalled reports whether the stub was not called, and fails t otherwise.
+func (s *Stub) NeverCalled(t testing.TB) bool {
+	t.Helper()
+	return s.CalledTimes(t, 0)
+}
+
+// CalledWithJSON reports whether a call had arguments equal to the JSON
+// document, regardless of formatting and key order, and fails t otherwise.
+func (s *Stub) CalledWithJSON(t testing.TB, want string) bool {
+	t.Helper()
+	normalized, err := normalizeJSON(want)
+	if err != nil {
+		t.Errorf("tool %s: invalid JSON %q: %v", s.name, want, err)
+		return false
+	}
+	calls := s.Calls()
+	for _, call := range calls {
+		if got, err := normalizeJSON(call.Input); err == nil && got == normalized {
+			return true
+		}
+	}
+	t.Errorf("tool %s: no call with arguments\n\t%s%s", s.name, normalized, formatCalls(calls))
+	return false
+}
+
+// normalizeJSON returns the compact JSON document with sorted object keys.
+func normalizeJSON(s string) (string, error) {
+	var v any
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// formatCalls lists the arguments of the calls for a failure message.
+func formatCalls(calls []Call) string {
+	if len(calls) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\ncalls:")
+	for i, call := range calls {
+		input := call.Input
+		if normalized, err := normalizeJSON(input); err == nil {
+			input = normalized
+		}
+		fmt.Fprintf(&b, "\n\t%d: %s", i+1, input)
+		if call.Err != nil {
+			fmt.Fprintf(&b, " (error: %v)", call.Err)
+		}
+	}
+	return b.String()
+}
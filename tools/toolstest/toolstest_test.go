@@ -0,0 +1,118 @@
+package toolstest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/blades"
+)
+
+// recorder records the failures of the assertions.
+type recorder struct {
+	testing.TB
+	failures []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func TestStubResponses(t *testing.T) {
+	errUnavailable := errors.New("unavailable")
+	stub := NewStub("weather", "Returns the weather.",
+		ReturnJSON(map[string]string{"forecast": "sunny"}),
+		Fail(errUnavailable),
+		Return("rain").When(func(args map[string]any) bool { return args["city"] == "London" }),
+	)
+	ctx := context.Background()
+	if got, err := stub.Handle(ctx, `{"city":"Paris"}`); err != nil || got != `{"forecast":"sunny"}` {
+		t.Fatalf("first call: got %q, %v", got, err)
+	}
+	if got, err := stub.Handle(ctx, `{"city":"London"}`); err != nil || got != "rain" {
+		t.Fatalf("matched call: got %q, %v", got, err)
+	}
+	for range 2 {
+		if _, err := stub.Handle(ctx, `{"city":"Rome"}`); !errors.Is(err, errUnavailable) {
+			t.Fatalf("want the last response to repeat, got %v", err)
+		}
+	}
+	stub.CalledTimes(t, 4)
+	stub.CalledWithJSON(t, `{ "city": "London" }`)
+	if calls := stub.Calls(); calls[0].Args["city"] != "Paris" || calls[3].Err == nil {
+		t.Fatalf("unexpected calls: %+v", calls)
+	}
+
+	empty := NewStub("empty", "Has no response.")
+	if _, err := empty.Handle(ctx, `{}`); err == nil || !strings.Contains(err.Error(), "no response for call 1 of empty") {
+		t.Fatalf("want a missing response error, got %v", err)
+	}
+}
+
+func TestStubDelay(t *testing.T) {
+	stub := NewStub("slow", "Takes a while.", Return("done").After(time.Hour))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := stub.Handle(ctx, `{}`); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want context.DeadlineExceeded, got %v", err)
+	}
+	if calls := stub.Calls(); len(calls) != 1 || !errors.Is(calls[0].Err, context.DeadlineExceeded) {
+		t.Fatalf("unexpected calls: %+v", calls)
+	}
+}
+
+func TestStubAssertions(t *testing.T) {
+	stub := NewStub("lookup", "Looks up a record.", Return("ok"))
+	if _, err := stub.Handle(context.Background(), `{"id": 7, "full": true}`); err != nil {
+		t.Fatal(err)
+	}
+	r := &recorder{TB: t}
+	if stub.NeverCalled(r) || stub.CalledTimes(r, 2) || stub.CalledWithJSON(r, `{"id":8}`) {
+		t.Fatal("want the assertions to fail")
+	}
+	want := []string{
+		"tool lookup: want 0 calls, got 1\ncalls:\n\t1: {\"full\":true,\"id\":7}",
+		"tool lookup: want 2 calls, got 1\ncalls:\n\t1: {\"full\":true,\"id\":7}",
+		"tool lookup: no call with arguments\n\t{\"id\":8}\ncalls:\n\t1: {\"full\":true,\"id\":7}",
+	}
+	if strings.Join(r.failures, "\n---\n") != strings.Join(want, "\n---\n") {
+		t.Fatalf("unexpected failures:\n%s", strings.Join(r.failures, "\n---\n"))
+	}
+}
+
+func TestScriptedConversation(t *testing.T) {
+	weather := NewStub("weather", "Returns the weather.", Return("sunny"))
+	model := NewScriptedModel(
+		CallTool("weather", map[string]string{"city": "Paris"}),
+		Answer("It is sunny in Paris."),
+	)
+	agent, err := blades.NewAgent("assistant", blades.WithModel(model), blades.WithTools(weather))
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := blades.NewRunner(agent).Run(context.Background(), blades.UserMessage("Weather in Paris?"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output.Text() != "It is sunny in Paris." {
+		t.Fatalf("unexpected answer %q", output.Text())
+	}
+	weather.CalledTimes(t, 1)
+	weather.CalledWithJSON(t, `{"city":"Paris"}`)
+	requests := model.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("want 2 requests, got %d", len(requests))
+	}
+	last := requests[1].Messages[len(requests[1].Messages)-1]
+	if part, ok := last.Parts[0].(blades.ToolPart); !ok || part.Response != "sunny" {
+		t.Fatalf("want the tool result in the second request, got %+v", last.Parts)
+	}
+	if _, err := model.Generate(context.Background(), &blades.ModelRequest{}); !errors.Is(err, ErrScriptExhausted) {
+		t.Fatalf("want ErrScriptExhausted, got %v", err)
+	}
+}
@@ -0,0 +1,427 @@
+package blades
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-kratos/blades/tools"
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+// TranscriptTool is the recorded description of a tool offered to the model.
+type TranscriptTool struct {
+	Name         string             `json:"name"`
+	Description  string             `json:"description,omitempty"`
+	InputSchema  *jsonschema.Schema `json:"inputSchema,omitempty"`
+	OutputSchema *jsonschema.Schema `json:"outputSchema,omitempty"`
+}
+
+// TranscriptRequest is the recorded form of a ModelRequest.
+type TranscriptRequest struct {
+	Instruction  *Message           `json:"instruction,omitempty"`
+	Messages     []*Message         `json:"messages"`
+	Tools        []TranscriptTool   `json:"tools,omitempty"`
+	InputSchema  *jsonschema.Schema `json:"inputSchema,omitempty"`
+	OutputSchema *jsonschema.Schema `json:"outputSchema,omitempty"`
+	Options      ModelOptions       `json:"options,omitzero"`
+}
+
+// TranscriptEntry records one model call: the request sent and the response or error received.
+type TranscriptEntry struct {
+	InvocationID string `json:"invocationId"`
+	SessionID    string `json:"sessionId,omitempty"`
+	Agent        string `json:"agent,omitempty"`
+	// Path is the path of the agent that made the call, outermost first;
+	// see PathError.
+	Path      []string          `json:"path,omitempty"`
+	Model     string            `json:"model,omitempty"`
+	Request   TranscriptRequest `json:"request"`
+	Response  *Message          `json:"response,omitempty"`
+	Error     string            `json:"error,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+	// InstructionVersion is the version of the instructions of the agent.
+	InstructionVersion string `json:"instructionVersion,omitempty"`
+	// Experiment and Variant name the experiment variant the agent ran as, if any.
+	Experiment string `json:"experiment,omitempty"`
+	Variant    string `json:"variant,omitempty"`
+}
+
+// Transcript is the sequence of model calls made by an invocation and its sub-agents.
+type Transcript struct {
+	InvocationID string            `json:"invocationId"`
+	Entries      []TranscriptEntry `json:"entries"`
+}
+
+// TranscriptStore persists transcript entries.
+type TranscriptStore interface {
+	// Append stores an entry after the entries already stored.
+	Append(context.Context, TranscriptEntry) error
+	// Load returns the entries of the invocation and its sub-agents in the order
+	// they were appended. It returns ErrTranscriptNotFound if there are none.
+	Load(ctx context.Context, invocationID string) (*Transcript, error)
+}
+
+// Scrubber rewrites recorded text to remove sensitive values.
+type Scrubber func(string) string
+
+// RegexpScrubber returns a Scrubber that replaces every match of the patterns with "[REDACTED]".
+func RegexpScrubber(patterns ...*regexp.Regexp) Scrubber {
+	return func(s string) string {
+		for _, p := range patterns {
+			s = p.ReplaceAllString(s, RedactSecret("secret"))
+		}
+		return s
+	}
+}
+
+// AuditOption defines options for the Audit middleware.
+type AuditOption func(*audit)
+
+// WithAuditScrubber applies the scrubber to all recorded text, tool
+// arguments, tool results and errors before they are written.
+func WithAuditScrubber(scrubber Scrubber) AuditOption {
+	return func(a *audit) {
+		a.redactors = append(a.redactors, func(ctx context.Context, text string) string {
+			return scrubber(text)
+		})
+	}
+}
+
+// WithAuditRedactors applies the redactors like WithAuditScrubber. The
+// redactors of the agent making the call, see WithRedactors, are always applied.
+func WithAuditRedactors(redactors ...Redactor) AuditOption {
+	return func(a *audit) {
+		a.redactors = append(a.redactors, redactors...)
+	}
+}
+
+// WithAuditErrorHandler sets the function called when an entry cannot be stored.
+// By default store errors are ignored, so that auditing never fails a model call.
+func WithAuditErrorHandler(fn func(error)) AuditOption {
+	return func(a *audit) {
+		a.onError = fn
+	}
+}
+
+// audit records model calls into a TranscriptStore.
+type audit struct {
+	store     TranscriptStore
+	redactors Redactors
+	onError   func(error)
+	next      ModelHandler
+}
+
+// Audit returns a model middleware that records every model call into the store.
+// Sensitive values are scrubbed before the entry is written.
+func Audit(store TranscriptStore, opts ...AuditOption) ModelMiddleware {
+	a := &audit{store: store, onError: func(error) {}}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return func(next ModelHandler) ModelHandler {
+		c := *a
+		c.next = next
+		return &c
+	}
+}
+
+// Generate records the request and its response.
+func (a *audit) Generate(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+	res, err := a.next.Generate(ctx, req)
+	var response *Message
+	if res != nil {
+		response = res.Message
+	}
+	a.record(ctx, req, response, err)
+	return res, err
+}
+
+// NewStreaming records the request and the final response of the stream.
+func (a *audit) NewStreaming(ctx context.Context, req *ModelRequest) Generator[*ModelResponse, error] {
+	return func(yield func(*ModelResponse, error) bool) {
+		var (
+			response *Message
+			err      error
+		)
+		defer func() { a.record(ctx, req, response, err) }()
+		for res, e := range a.next.NewStreaming(ctx, req) {
+			if e != nil {
+				err = e
+				yield(nil, e)
+				return
+			}
+			if res.Message != nil && res.Message.Status != StatusIncomplete {
+				response = res.Message
+			}
+			if !yield(res, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (a *audit) record(ctx context.Context, req *ModelRequest, response *Message, err error) {
+	redactors := slices.Concat(a.redactors, FromRedactorsContext(ctx))
+	entry := TranscriptEntry{
+		Request: TranscriptRequest{
+			Instruction:  redactors.RedactMessage(ctx, req.Instruction),
+			Messages:     make([]*Message, 0, len(req.Messages)),
+			InputSchema:  req.InputSchema,
+			OutputSchema: req.OutputSchema,
+			Options:      req.Options,
+		},
+		Response:  redactors.RedactMessage(ctx, response),
+		CreatedAt: time.Now(),
+	}
+	if invocation, ok := FromInvocationContext(ctx); ok {
+		entry.InvocationID = invocation.ID
+		if invocation.Session != nil {
+			entry.SessionID = invocation.Session.ID()
+		}
+	}
+	entry.Path = PathFromContext(ctx)
+	if agent, ok := FromAgentContext(ctx); ok {
+		entry.Agent = agent.Name()
+		if v, ok := agent.(interface{ InstructionVersion() string }); ok {
+			entry.InstructionVersion = v.InstructionVersion()
+		}
+	}
+	if e, ok := ctx.Value(ctxExperimentKey{}).(experiment); ok {
+		entry.Experiment, entry.Variant = e.name, e.variant
+	}
+	if model, ok := FromModelContext(ctx); ok {
+		entry.Model = ResolveModel(ctx, model.Name())
+	}
+	for _, m := range req.Messages {
+		entry.Request.Messages = append(entry.Request.Messages, redactors.RedactMessage(ctx, m))
+	}
+	for _, t := range req.Tools {
+		entry.Request.Tools = append(entry.Request.Tools, TranscriptTool{
+			Name:         t.Name(),
+			Description:  t.Description(),
+			InputSchema:  t.InputSchema(),
+			OutputSchema: t.OutputSchema(),
+		})
+	}
+	if err != nil {
+		entry.Error = redactors.Redact(ctx, err.Error())
+	}
+	if err := a.store.Append(context.WithoutCancel(ctx), entry); err != nil {
+		a.onError(err)
+	}
+}
+
+// TranscriptVersion is the format version of the entries written by
+// JSONLTranscriptStore. Version 0 entries were written without an envelope.
+const TranscriptVersion = 1
+
+// transcriptMigrations upgrades the entries of older versions on load.
+var transcriptMigrations = NewMigrations("transcript_entry", TranscriptVersion).
+	Register(0, keepPayload)
+
+// JSONLTranscriptStore is a TranscriptStore that appends entries to a file,
+// one JSON object per line.
+type JSONLTranscriptStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewJSONLTranscriptStore creates a store writing to the file at path.
+func NewJSONLTranscriptStore(path string) *JSONLTranscriptStore {
+	return &JSONLTranscriptStore{path: path}
+}
+
+// Append writes the entry as a line at the end of the file.
+func (s *JSONLTranscriptStore) Append(ctx context.Context, entry TranscriptEntry) error {
+	data, err := transcriptMigrations.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("transcript store: encode: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("transcript store: %w", err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("transcript store: %w", err)
+	}
+	return f.Close()
+}
+
+// Load reads the entries of the invocation and its sub-agents from the file.
+func (s *JSONLTranscriptStore) Load(ctx context.Context, invocationID string) (*Transcript, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("transcript store: load %s: %w", invocationID, ErrTranscriptNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("transcript store: %w", err)
+	}
+	defer f.Close()
+	transcript := &Transcript{InvocationID: invocationID}
+	dec := json.NewDecoder(f)
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("transcript store: decode %s: %w", s.path, err)
+		}
+		var entry TranscriptEntry
+		if err := transcriptMigrations.Unmarshal(raw, &entry); err != nil {
+			return nil, fmt.Errorf("transcript store: load %s: %w", s.path, err)
+		}
+		if isInvocationOrChild(entry.InvocationID, invocationID) {
+			transcript.Entries = append(transcript.Entries, entry)
+		}
+	}
+	if len(transcript.Entries) == 0 {
+		return nil, fmt.Errorf("transcript store: load %s: %w", invocationID, ErrTranscriptNotFound)
+	}
+	return transcript, nil
+}
+
+// Requests reconstructs the model requests of the transcript in call order.
+// The tools only describe the recorded tools; calling them returns ErrToolNotReplayable.
+func (t *Transcript) Requests() []*ModelRequest {
+	requests := make([]*ModelRequest, 0, len(t.Entries))
+	for _, e := range t.Entries {
+		req := &ModelRequest{
+			Instruction:  e.Request.Instruction,
+			Messages:     e.Request.Messages,
+			InputSchema:  e.Request.InputSchema,
+			OutputSchema: e.Request.OutputSchema,
+			Options:      e.Request.Options,
+		}
+		for _, tool := range e.Request.Tools {
+			req.Tools = append(req.Tools, tools.NewTool(tool.Name, tool.Description,
+				tools.HandleFunc(func(context.Context, string) (string, error) {
+					return "", fmt.Errorf("tool %s: %w", tool.Name, ErrToolNotReplayable)
+				}),
+				tools.WithInputSchema(tool.InputSchema),
+				tools.WithOutputSchema(tool.OutputSchema),
+			))
+		}
+		requests = append(requests, req)
+	}
+	return requests
+}
+
+// TranscriptTurn is a user input of a transcript and the final response to it.
+type TranscriptTurn struct {
+	Input  *Message
+	Output *Message
+}
+
+// Turns returns the conversation of the transcript turn by turn, including
+// the earlier turns that were sent to the model as history.
+func (t *Transcript) Turns() []TranscriptTurn {
+	var (
+		turns []TranscriptTurn
+		index = make(map[string]int)
+	)
+	for _, e := range t.Entries {
+		current := -1
+		for _, m := range e.Request.Messages {
+			switch m.Role {
+			case RoleUser:
+				key := m.ID
+				if key == "" {
+					key = m.Text()
+				}
+				i, ok := index[key]
+				if !ok {
+					i = len(turns)
+					index[key] = i
+					turns = append(turns, TranscriptTurn{Input: m})
+				}
+				current = i
+			case RoleAssistant:
+				if current >= 0 && m.Status == StatusCompleted {
+					turns[current].Output = m
+				}
+			}
+		}
+		if current >= 0 && e.Response != nil && e.Response.Role == RoleAssistant {
+			turns[current].Output = e.Response
+		}
+	}
+	return turns
+}
+
+// ReplayTurn is the outcome of replaying one turn of a transcript.
+type ReplayTurn struct {
+	Index    int
+	Input    *Message
+	Original *Message
+	Replayed *Message
+}
+
+// Changed reports whether the replayed response differs from the original one.
+func (t ReplayTurn) Changed() bool {
+	var original, replayed string
+	if t.Original != nil {
+		original = t.Original.Text()
+	}
+	if t.Replayed != nil {
+		replayed = t.Replayed.Text()
+	}
+	return original != replayed
+}
+
+// ReplayOption defines options for Replay.
+type ReplayOption func(*replayOptions)
+
+type replayOptions struct {
+	pause func(context.Context, ReplayTurn) error
+}
+
+// WithReplayPause sets the function called for every turn whose response
+// changed, before the next turn runs. Returning an error stops the replay.
+func WithReplayPause(fn func(context.Context, ReplayTurn) error) ReplayOption {
+	return func(o *replayOptions) {
+		o.pause = fn
+	}
+}
+
+// Replay reruns the conversation of the transcript against the agent turn by
+// turn in a new session, and returns the original and replayed responses.
+func Replay(ctx context.Context, agent Agent, transcript *Transcript, opts ...ReplayOption) ([]ReplayTurn, error) {
+	o := &replayOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	var (
+		runner  = NewRunner(agent)
+		session = NewSession()
+		results []ReplayTurn
+	)
+	for i, turn := range transcript.Turns() {
+		input := turn.Input.Clone()
+		input.ID, input.InvocationID = NewMessageID(), ""
+		output, err := runner.Run(ctx, input, WithSession(session))
+		if err != nil {
+			return results, fmt.Errorf("replay turn %d: %w", i, err)
+		}
+		result := ReplayTurn{Index: i, Input: turn.Input, Original: turn.Output, Replayed: output}
+		results = append(results, result)
+		if o.pause != nil && result.Changed() {
+			if err := o.pause(ctx, result); err != nil {
+				return results, err
+			}
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,116 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/go-kratos/blades/tools"
+)
+
+// sessionHistory adds the earlier turns of the session to the invocation history.
+func sessionHistory(next Handler) Handler {
+	return HandleFunc(func(ctx context.Context, invocation *Invocation) Generator[*Message, error] {
+		for _, m := range invocation.Session.History() {
+			if m.InvocationID != invocation.ID {
+				invocation.History = append(invocation.History, m)
+			}
+		}
+		return next.Handle(ctx, invocation)
+	})
+}
+
+// replyModel answers every request with prefix and the last user text.
+func replyModel(prefix string) *mockModel {
+	return &mockModel{generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+		last := req.Messages[len(req.Messages)-1]
+		return textResponse(prefix + last.Text()), nil
+	}}
+}
+
+func TestTranscriptReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "transcript.jsonl")
+	store := NewJSONLTranscriptStore(path)
+	lookup := tools.NewTool("lookup", "Looks up a record.", tools.HandleFunc(func(context.Context, string) (string, error) {
+		return "", nil
+	}))
+	model := WrapModel(replyModel("v1: "), Audit(store,
+		WithAuditScrubber(RegexpScrubber(regexp.MustCompile(`sk-[a-z0-9]+`))),
+	))
+	agent, err := NewAgent("support",
+		WithModel(model),
+		WithTools(lookup),
+		WithMiddleware(sessionHistory),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := NewSession()
+	runner := NewRunner(agent)
+	if _, err := runner.Run(context.Background(), UserMessage("my key is sk-abc123"), WithSession(session)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runner.Run(context.Background(), UserMessage("hello"), WithSession(session), WithInvocationID("inv-2")); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "sk-abc123") {
+		t.Fatalf("secret written to the transcript: %s", data)
+	}
+	if _, err := store.Load(context.Background(), "missing"); !errors.Is(err, ErrTranscriptNotFound) {
+		t.Fatalf("want ErrTranscriptNotFound, got %v", err)
+	}
+	transcript, err := store.Load(context.Background(), "inv-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transcript.Entries) != 1 || transcript.Entries[0].Agent != "support" || transcript.Entries[0].Model != "mock" {
+		t.Fatalf("unexpected entries: %+v", transcript.Entries)
+	}
+	requests := transcript.Requests()
+	if len(requests) != 1 || len(requests[0].Messages) != 3 {
+		t.Fatalf("unexpected requests: %+v", requests)
+	}
+	if len(requests[0].Tools) != 1 || requests[0].Tools[0].Name() != "lookup" {
+		t.Fatalf("expected the recorded tool, got %v", requests[0].Tools)
+	}
+	if _, err := requests[0].Tools[0].Handle(context.Background(), "{}"); !errors.Is(err, ErrToolNotReplayable) {
+		t.Fatalf("want ErrToolNotReplayable, got %v", err)
+	}
+
+	var paused []int
+	replayed, err := NewAgent("support", WithModel(replyModel("v2: ")), WithMiddleware(sessionHistory))
+	if err != nil {
+		t.Fatal(err)
+	}
+	turns, err := Replay(context.Background(), replayed, transcript, WithReplayPause(func(ctx context.Context, turn ReplayTurn) error {
+		paused = append(paused, turn.Index)
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(turns) != 2 {
+		t.Fatalf("want 2 turns, got %d", len(turns))
+	}
+	for i, want := range []struct{ input, original, replayed string }{
+		{"my key is [REDACTED]", "v1: my key is [REDACTED]", "v2: my key is [REDACTED]"},
+		{"hello", "v1: hello", "v2: hello"},
+	} {
+		turn := turns[i]
+		if turn.Input.Text() != want.input || turn.Original.Text() != want.original || turn.Replayed.Text() != want.replayed {
+			t.Fatalf("turn %d: got input %q original %q replayed %q", i, turn.Input.Text(), turn.Original.Text(), turn.Replayed.Text())
+		}
+	}
+	if len(paused) != 2 {
+		t.Fatalf("want a pause for every changed turn, got %v", paused)
+	}
+}
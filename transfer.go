@@ -0,0 +1,125 @@
+package blades
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// DefaultMaxTransferDepth is the number of nested agent transfers a run allows
+// unless the Runner is configured with WithMaxTransferDepth.
+const DefaultMaxTransferDepth = 10
+
+// TransferChainKey is the metadata key of the transfer chain on the messages
+// of a transferred agent.
+const TransferChainKey = "transfer_chain"
+
+// TransferError is returned when an agent transfer is rejected. It unwraps to
+// ErrTransferDepthExceeded, ErrTransferLoop or ErrTransferNotAllowed.
+type TransferError struct {
+	// Chain lists the agents from the first one that transferred to the
+	// rejected target.
+	Chain []string
+	Err   error
+}
+
+func (e *TransferError) Error() string {
+	return fmt.Sprintf("agent transfer %s: %v", strings.Join(e.Chain, " -> "), e.Err)
+}
+
+// Unwrap returns the reason the transfer was rejected.
+func (e *TransferError) Unwrap() error {
+	return e.Err
+}
+
+// WithMaxTransferDepth sets the number of nested agent transfers a run
+// allows, across handoffs and agent tools. n <= 0 disables the limit.
+func WithMaxTransferDepth(n int) RunnerOption {
+	return func(r *Runner) {
+		r.maxTransferDepth = n
+	}
+}
+
+// transfer is one transfer of a request from an agent to another.
+type transfer struct {
+	from, to string
+	input    string
+}
+
+// transfers is the transfer state of a run, copied on every transfer so that
+// concurrent branches keep their own chains.
+type transfers struct {
+	maxDepth int
+	hops     []transfer
+}
+
+// ctxTransfersKey is the context key for the transfers of a run.
+type ctxTransfersKey struct{}
+
+// withTransfers returns a context that enforces the maximum transfer depth,
+// unless ctx already belongs to a run, in which case the outer run's depth applies.
+func withTransfers(ctx context.Context, maxDepth int) context.Context {
+	if _, ok := ctx.Value(ctxTransfersKey{}).(*transfers); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, ctxTransfersKey{}, &transfers{maxDepth: maxDepth})
+}
+
+// Transfer records that the agent from transfers the input message to the
+// agent to, and returns the context to run the target with. It returns a
+// *TransferError if the transfer exceeds the maximum transfer depth, or if
+// it hands the same input straight back to the agent that transferred it.
+func Transfer(ctx context.Context, from, to string, input *Message) (context.Context, error) {
+	t, ok := ctx.Value(ctxTransfersKey{}).(*transfers)
+	if !ok {
+		t = &transfers{maxDepth: DefaultMaxTransferDepth}
+	}
+	hop := transfer{from: from, to: to}
+	if input != nil {
+		hop.input = input.Text()
+	}
+	next := &transfers{maxDepth: t.maxDepth, hops: append(t.hops[:len(t.hops):len(t.hops)], hop)}
+	if n := len(t.hops); n > 0 {
+		if last := t.hops[n-1]; last.from == to && last.to == from && last.input == hop.input {
+			return ctx, &TransferError{Chain: next.chain(), Err: ErrTransferLoop}
+		}
+	}
+	if t.maxDepth > 0 && len(next.hops) > t.maxDepth {
+		return ctx, &TransferError{Chain: next.chain(), Err: ErrTransferDepthExceeded}
+	}
+	return context.WithValue(ctx, ctxTransfersKey{}, next), nil
+}
+
+// TransferChain returns the agents the request of ctx was transferred
+// through, starting with the first agent that transferred it.
+func TransferChain(ctx context.Context) []string {
+	t, ok := ctx.Value(ctxTransfersKey{}).(*transfers)
+	if !ok {
+		return nil
+	}
+	return t.chain()
+}
+
+// chain returns the agent names along the hops.
+func (t *transfers) chain() []string {
+	if len(t.hops) == 0 {
+		return nil
+	}
+	chain := []string{t.hops[0].from}
+	for _, hop := range t.hops {
+		chain = append(chain, hop.to)
+	}
+	return chain
+}
+
+// AttachTransferChain records the transfer chain of ctx in the metadata of the message.
+func AttachTransferChain(ctx context.Context, message *Message) {
+	chain := TransferChain(ctx)
+	if message == nil || len(chain) == 0 {
+		return
+	}
+	if message.Metadata == nil {
+		message.Metadata = make(map[string]any)
+	}
+	message.Metadata[TransferChainKey] = chain
+}
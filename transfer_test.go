@@ -0,0 +1,84 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestTransfer(t *testing.T) {
+	ctx := withTransfers(context.Background(), 3)
+	ctx, err := Transfer(ctx, "triage", "a", UserMessage("help"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, err = Transfer(ctx, "a", "b", UserMessage("help"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := TransferChain(ctx), []string{"triage", "a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("want chain %v, got %v", want, got)
+	}
+
+	var transferErr *TransferError
+	if _, err := Transfer(ctx, "b", "a", UserMessage("help")); !errors.Is(err, ErrTransferLoop) || !errors.As(err, &transferErr) {
+		t.Fatalf("want a transfer loop, got %v", err)
+	}
+	if want := []string{"triage", "a", "b", "a"}; !reflect.DeepEqual(transferErr.Chain, want) {
+		t.Fatalf("want chain %v, got %v", want, transferErr.Chain)
+	}
+	// Handing back a different request is not a loop.
+	back, err := Transfer(ctx, "b", "a", UserMessage("one more thing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Transfer(back, "a", "c", UserMessage("help")); !errors.Is(err, ErrTransferDepthExceeded) {
+		t.Fatalf("want the depth exceeded, got %v", err)
+	}
+	// Transfers of one branch do not show up in another.
+	if got := TransferChain(ctx); len(got) != 3 {
+		t.Fatalf("want the chain of ctx unchanged, got %v", got)
+	}
+}
+
+// namedAgent is an agent whose implementation is set after it is referenced.
+type namedAgent struct {
+	name string
+	Agent
+}
+
+func (a *namedAgent) Name() string { return a.name }
+
+func TestAgentToolTransferLoop(t *testing.T) {
+	newModel := func(callee string) ModelProvider {
+		return &mockModel{generate: func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+			if last := req.Messages[len(req.Messages)-1]; last.Role == RoleTool {
+				return textResponse("pong"), nil
+			}
+			return &ModelResponse{Message: &Message{Role: RoleTool, Status: StatusCompleted, Parts: []Part{
+				ToolPart{ID: "call-1", Name: callee, Request: "ping"},
+			}}}, nil
+		}}
+	}
+	// The agents call each other as tools, so each tool wraps a placeholder.
+	toA, toB := &namedAgent{name: "a"}, &namedAgent{name: "b"}
+	a, err := NewAgent("a", WithModel(newModel("b")), WithTools(NewAgentTool(toB)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewAgent("b", WithModel(newModel("a")), WithTools(NewAgentTool(toA)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	toA.Agent, toB.Agent = a, b
+
+	_, err = NewRunner(a).Run(context.Background(), UserMessage("ping"))
+	var transferErr *TransferError
+	if !errors.Is(err, ErrTransferLoop) || !errors.As(err, &transferErr) {
+		t.Fatalf("want a transfer loop, got %v", err)
+	}
+	if want := []string{"a", "b", "a"}; !reflect.DeepEqual(transferErr.Chain, want) {
+		t.Fatalf("want chain %v, got %v", want, transferErr.Chain)
+	}
+}
@@ -0,0 +1,199 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ViolationsKey is the metadata key of the violations of an answer rejected by
+// the output validators of its agent.
+const ViolationsKey = "violations"
+
+// OutputValidator checks a completed answer of an agent and returns the
+// violations it finds, joined with errors.Join if there are several.
+type OutputValidator func(ctx context.Context, message *Message) error
+
+// WithOutputValidators sets the validators run on the completed answers of the
+// Agent; tool calls and, when streaming, partial messages are not validated.
+// An answer that fails a validator is kept in the session, marked with its
+// violations under ViolationsKey, and the agent asks the model again with a
+// user message listing them. Each answer counts as an iteration, and after
+// WithOutputValidationAttempts answers the invocation fails with an
+// OutputValidationError.
+func WithOutputValidators(validators ...OutputValidator) AgentOption {
+	return func(a *agent) {
+		a.outputValidators = append(a.outputValidators, validators...)
+	}
+}
+
+// WithOutputValidationAttempts sets how many answers, including the first, the
+// Agent asks for before failing with an OutputValidationError. Defaults to 3.
+func WithOutputValidationAttempts(n int) AgentOption {
+	return func(a *agent) {
+		a.outputAttempts = n
+	}
+}
+
+// OutputValidationError is returned when all the answers of an agent failed
+// its output validators. It unwraps to ErrOutputInvalid.
+type OutputValidationError struct {
+	// Agent is the agent whose answers failed.
+	Agent string
+	// Attempts is the number of answers the agent got.
+	Attempts int
+	// Violations are the violations of all answers, in order.
+	Violations []error
+}
+
+func (e *OutputValidationError) Error() string {
+	return fmt.Sprintf("agent %s: %s after %d attempts: %v", e.Agent, ErrOutputInvalid, e.Attempts, errors.Join(e.Violations...))
+}
+
+// Unwrap returns ErrOutputInvalid.
+func (e *OutputValidationError) Unwrap() error {
+	return ErrOutputInvalid
+}
+
+// validateOutput runs the output validators on a completed answer and marks it
+// with the violations it returns.
+func (a *agent) validateOutput(ctx context.Context, message *Message) []error {
+	if len(a.outputValidators) == 0 || message.Role != RoleAssistant || message.Status != StatusCompleted {
+		return nil
+	}
+	var violations []error
+	for _, validator := range a.outputValidators {
+		err := validator(ctx, message)
+		if err == nil {
+			continue
+		}
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			violations = append(violations, joined.Unwrap()...)
+		} else {
+			violations = append(violations, err)
+		}
+	}
+	if len(violations) > 0 {
+		texts := make([]string, 0, len(violations))
+		for _, v := range violations {
+			texts = append(texts, v.Error())
+		}
+		if message.Metadata == nil {
+			message.Metadata = make(map[string]any)
+		}
+		message.Metadata[ViolationsKey] = texts
+	}
+	return violations
+}
+
+// correctionMessage asks the model to answer again without the violations.
+func correctionMessage(violations []error) *Message {
+	var b strings.Builder
+	b.WriteString("Your previous response failed validation:\n")
+	for _, v := range violations {
+		fmt.Fprintf(&b, "- %s\n", v)
+	}
+	b.WriteString("Respond again with a corrected response.")
+	return UserMessage(b.String())
+}
+
+// rejected reports whether the answer was marked with violations.
+func rejected(message *Message) bool {
+	_, ok := message.Metadata[ViolationsKey]
+	return ok
+}
+
+// ValidateJSON returns a validator that decodes the answer into a T with
+// ParseStructured and checks it with fn. An answer that does
+// not decode is a violation.
+func ValidateJSON[T any](fn func(ctx context.Context, value T) error) OutputValidator {
+	return func(ctx context.Context, message *Message) error {
+		value, err := ParseStructured[T](message.Text())
+		if err != nil {
+			return fmt.Errorf("response is not valid JSON: %w", err)
+		}
+		return fn(ctx, value)
+	}
+}
+
+// MaxLength returns a validator of answers of at most n characters.
+func MaxLength(n int) OutputValidator {
+	return func(ctx context.Context, message *Message) error {
+		if length := utf8.RuneCountInString(message.Text()); length > n {
+			return fmt.Errorf("response has %d characters, want at most %d", length, n)
+		}
+		return nil
+	}
+}
+
+// MatchesRegex returns a validator of answers that match the regular expression.
+func MatchesRegex(re *regexp.Regexp) OutputValidator {
+	return func(ctx context.Context, message *Message) error {
+		if !re.MatchString(message.Text()) {
+			return fmt.Errorf("response does not match %s", re)
+		}
+		return nil
+	}
+}
+
+// NotMatchesRegex returns a validator of answers that do not match the
+// regular expression, e.g. to forbid URLs.
+func NotMatchesRegex(re *regexp.Regexp) OutputValidator {
+	return func(ctx context.Context, message *Message) error {
+		if match := re.FindString(message.Text()); match != "" {
+			return fmt.Errorf("response contains %q, which must not match %s", match, re)
+		}
+		return nil
+	}
+}
+
+// JSONFieldRange returns a validator of JSON answers whose field at the
+// dot-separated path, e.g. "result.score" or "items.0.price", is between min
+// and max inclusive: a number by its value, an array by its number of entries
+// and a string by its number of characters.
+func JSONFieldRange(path string, min, max float64) OutputValidator {
+	return func(ctx context.Context, message *Message) error {
+		value, err := ParseStructured[any](message.Text())
+		if err != nil {
+			return fmt.Errorf("response is not valid JSON: %w", err)
+		}
+		for _, key := range strings.Split(path, ".") {
+			switch v := value.(type) {
+			case map[string]any:
+				value = v[key]
+			case []any:
+				i, err := strconv.Atoi(key)
+				if err != nil || i < 0 || i >= len(v) {
+					return fmt.Errorf("field %q is missing", path)
+				}
+				value = v[i]
+			default:
+				value = nil
+			}
+			if value == nil {
+				return fmt.Errorf("field %q is missing", path)
+			}
+		}
+		switch v := value.(type) {
+		case float64:
+			if v < min || v > max {
+				return fmt.Errorf("field %q is %v, want between %v and %v", path, v, min, max)
+			}
+		case []any:
+			if n := float64(len(v)); n < min || n > max {
+				return fmt.Errorf("field %q has %d entries, want between %v and %v", path, len(v), min, max)
+			}
+		case string:
+			if n := utf8.RuneCountInString(v); float64(n) < min || float64(n) > max {
+				return fmt.Errorf("field %q has %d characters, want between %v and %v", path, n, min, max)
+			}
+		default:
+			return fmt.Errorf("field %q is not a number, array or string", path)
+		}
+		return nil
+	}
+}
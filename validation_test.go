@@ -0,0 +1,112 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestOutputValidators(t *testing.T) {
+	type review struct {
+		Score int `json:"score"`
+	}
+	newModel := func(answers ...string) *mockModel {
+		model := &mockModel{}
+		model.generate = func(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+			return textResponse(answers[min(int(model.calls.Load())-1, len(answers)-1)]), nil
+		}
+		return model
+	}
+	scoreRange := ValidateJSON(func(ctx context.Context, r review) error {
+		if r.Score < 0 || r.Score > 100 {
+			return fmt.Errorf("score is %d, want between 0 and 100", r.Score)
+		}
+		return nil
+	})
+
+	for _, streaming := range []bool{false, true} {
+		model := newModel(`{"score": 120}`, "```json\n{\"score\": 80}\n```")
+		agent, err := NewAgent("reviewer", WithModel(model), WithOutputValidators(scoreRange), WithOutputKeyJSON("review"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		session := NewSession()
+		var answer *Message
+		if streaming {
+			for m, err := range NewRunner(agent).RunStream(context.Background(), UserMessage("review"), WithSession(session)) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				answer = m
+			}
+		} else if answer, err = NewRunner(agent).Run(context.Background(), UserMessage("review"), WithSession(session)); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(answer.Text(), "80") || rejected(answer) {
+			t.Fatalf("want the corrected answer, got %q", answer.Text())
+		}
+		history := session.History()
+		if len(history) != 4 || !rejected(history[1]) || history[2].Role != RoleUser ||
+			!strings.Contains(history[2].Text(), "score is 120, want between 0 and 100") {
+			t.Fatalf("want the rejected answer and the correction in the session, got %v", history)
+		}
+		if v, _ := session.State()["review"].(map[string]any); v["score"] != float64(80) {
+			t.Fatalf("want only the valid answer stored, got %v", session.State()["review"])
+		}
+	}
+
+	model := newModel(`{"score": -1}`, "not json", `{"score": 200}`)
+	agent, err := NewAgent("reviewer", WithModel(model), WithOutputValidators(scoreRange, MaxLength(20)), WithOutputValidationAttempts(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewRunner(agent).Run(context.Background(), UserMessage("review"))
+	var validationErr *OutputValidationError
+	if !errors.As(err, &validationErr) || !errors.Is(err, ErrOutputInvalid) {
+		t.Fatalf("want an output validation error, got %v", err)
+	}
+	if validationErr.Attempts != 3 || len(validationErr.Violations) != 3 || model.calls.Load() != 3 {
+		t.Fatalf("want the violations of the 3 attempts, got %+v", validationErr)
+	}
+	if !strings.Contains(validationErr.Violations[1].Error(), "attempt 2: response is not valid JSON") {
+		t.Fatalf("unexpected violation %v", validationErr.Violations[1])
+	}
+}
+
+func TestOutputValidatorBuiltins(t *testing.T) {
+	tests := []struct {
+		name      string
+		validator OutputValidator
+		text      string
+		violation string
+	}{
+		{"max length", MaxLength(5), "hello", ""},
+		{"too long", MaxLength(4), "héllo", "5 characters"},
+		{"matches", MatchesRegex(regexp.MustCompile(`^\d+$`)), "42", ""},
+		{"does not match", MatchesRegex(regexp.MustCompile(`^\d+$`)), "x42", "does not match"},
+		{"no url", NotMatchesRegex(regexp.MustCompile(`https?://\S+`)), "see the docs", ""},
+		{"url", NotMatchesRegex(regexp.MustCompile(`https?://\S+`)), "see https://go.dev", `"https://go.dev"`},
+		{"number", JSONFieldRange("result.score", 0, 100), `{"result": {"score": 100}}`, ""},
+		{"number out of range", JSONFieldRange("result.score", 0, 100), `{"result": {"score": 101}}`, "is 101"},
+		{"array", JSONFieldRange("movies", 3, 10), `{"movies": ["a", "b"]}`, "has 2 entries"},
+		{"array index", JSONFieldRange("movies.1", 1, 3), `{"movies": ["a", "bcd"]}`, ""},
+		{"missing", JSONFieldRange("score", 0, 1), `{}`, `"score" is missing`},
+		{"fenced", JSONFieldRange("score", 0, 1), "```json\n{\"score\": 1}\n```", ""},
+		{"in prose", JSONFieldRange("score", 0, 1), "The score is:\n{\"score\": 1}", ""},
+		{"not json", JSONFieldRange("score", 0, 1), "score: 1", "not valid JSON"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.validator(context.Background(), AssistantMessage(tt.text))
+			switch {
+			case tt.violation == "" && err != nil:
+				t.Fatalf("want no violation, got %v", err)
+			case tt.violation != "" && (err == nil || !strings.Contains(err.Error(), tt.violation)):
+				t.Fatalf("want a violation with %q, got %v", tt.violation, err)
+			}
+		})
+	}
+}